@@ -75,6 +75,10 @@ func ChannelType2APIType(channelType int) (int, bool) {
 		apiType = constant.APITypeReplicate
 	case constant.ChannelTypeCodex:
 		apiType = constant.APITypeCodex
+	case constant.ChannelTypeVoyage:
+		apiType = constant.APITypeVoyage
+	case constant.ChannelTypeLocal:
+		apiType = constant.APITypeLocal
 	}
 	if apiType == -1 {
 		return constant.APITypeOpenAI, false
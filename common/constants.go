@@ -5,6 +5,7 @@ import (
 	//"os"
 	//"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -72,6 +73,9 @@ var EmailLoginAuthServerList = []string{
 var DebugEnabled bool
 var MemoryCacheEnabled bool
 
+// MetricsToken /metrics 访问令牌，为空时不开放
+var MetricsToken string
+
 var LogConsumeEnabled = true
 
 var TLSInsecureSkipVerify bool
@@ -115,6 +119,9 @@ var RetryTimes = 0
 
 var IsMasterNode bool
 
+// ShuttingDown 收到退出信号后为 true，健康检查返回 503 以便负载均衡摘除节点
+var ShuttingDown atomic.Bool
+
 var requestInterval int
 var RequestInterval time.Duration
 
@@ -184,6 +191,12 @@ const (
 	UserStatusDisabled = 2 // also don't use 0
 )
 
+// 用户计费模式：预付费余额不能为负，后付费可透支至信用额度
+const (
+	UserBillingModePrepaid  = "prepaid"
+	UserBillingModePostpaid = "postpaid"
+)
+
 const (
 	TokenStatusEnabled   = 1 // don't use 0, 0 is the default value!
 	TokenStatusDisabled  = 2 // also don't use 0
@@ -197,6 +210,11 @@ const (
 	RedemptionCodeStatusUsed     = 3 // also don't use 0
 )
 
+const (
+	CouponStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	CouponStatusDisabled = 2 // also don't use 0
+)
+
 const (
 	ChannelStatusUnknown          = 0
 	ChannelStatusEnabled          = 1 // don't use 0, 0 is the default value!
@@ -208,4 +226,7 @@ const (
 	TopUpStatusPending = "pending"
 	TopUpStatusSuccess = "success"
 	TopUpStatusExpired = "expired"
+
+	TopUpStatusRefunded          = "refunded"
+	TopUpStatusPartiallyRefunded = "partially_refunded"
 )
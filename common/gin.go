@@ -20,6 +20,11 @@ import (
 const KeyRequestBody = "key_request_body"
 const KeyBodyStorage = "key_body_storage"
 
+// KeyRequestBodyLimit 当前接口的请求体上限（字节），由解压中间件按接口类别设置
+const KeyRequestBodyLimit = "key_request_body_limit"
+
+const keyMultipartForm = "key_multipart_form"
+
 var ErrRequestBodyTooLarge = errors.New("request body too large")
 
 func IsRequestBodyTooLargeError(err error) bool {
@@ -34,61 +39,42 @@ func IsRequestBodyTooLargeError(err error) bool {
 }
 
 func GetRequestBody(c *gin.Context) ([]byte, error) {
-	// 首先检查是否有 BodyStorage 缓存
-	if storage, exists := c.Get(KeyBodyStorage); exists && storage != nil {
-		if bs, ok := storage.(BodyStorage); ok {
-			if _, err := bs.Seek(0, io.SeekStart); err != nil {
-				return nil, fmt.Errorf("failed to seek body storage: %w", err)
-			}
-			return bs.Bytes()
-		}
-	}
-
 	// 检查旧的缓存方式
-	cached, exists := c.Get(KeyRequestBody)
-	if exists && cached != nil {
-		if b, ok := cached.([]byte); ok {
-			return b, nil
+	if _, exists := c.Get(KeyBodyStorage); !exists {
+		cached, exists := c.Get(KeyRequestBody)
+		if exists && cached != nil {
+			if b, ok := cached.([]byte); ok {
+				return b, nil
+			}
 		}
 	}
-
-	maxMB := constant.MaxRequestBodyMB
-	if maxMB <= 0 {
-		maxMB = 128 // 默认 128MB
-	}
-	maxBytes := int64(maxMB) << 20
-
-	contentLength := c.Request.ContentLength
-
-	// 使用新的存储系统
-	storage, err := CreateBodyStorageFromReader(c.Request.Body, contentLength, maxBytes)
-	_ = c.Request.Body.Close()
-
+	storage, err := GetBodyStorage(c)
 	if err != nil {
-		if IsRequestBodyTooLargeError(err) {
-			return nil, errors.Wrap(ErrRequestBodyTooLarge, fmt.Sprintf("request body exceeds %d MB", maxMB))
-		}
 		return nil, err
 	}
-
-	// 缓存存储对象
-	c.Set(KeyBodyStorage, storage)
-
-	// 获取字节数据
 	body, err := storage.Bytes()
 	if err != nil {
 		return nil, err
 	}
-
 	// 同时设置旧的缓存键以保持兼容性
 	c.Set(KeyRequestBody, body)
-
 	return body, nil
 }
 
-// GetBodyStorage 获取请求体存储对象（用于需要多次读取的场景）
+func requestBodyLimit(c *gin.Context) int64 {
+	if limit := c.GetInt64(KeyRequestBodyLimit); limit > 0 {
+		return limit
+	}
+	maxMB := constant.MaxRequestBodyMB
+	if maxMB <= 0 {
+		maxMB = 128 // 默认 128MB
+	}
+	return int64(maxMB) << 20
+}
+
+// GetBodyStorage 获取请求体存储对象（用于需要多次读取的场景），大请求体保存在磁盘上，不会整体读入内存
 func GetBodyStorage(c *gin.Context) (BodyStorage, error) {
-	// 检查是否已有存储
+	// 首先检查是否有 BodyStorage 缓存
 	if storage, exists := c.Get(KeyBodyStorage); exists && storage != nil {
 		if bs, ok := storage.(BodyStorage); ok {
 			if _, err := bs.Seek(0, io.SeekStart); err != nil {
@@ -97,28 +83,54 @@ func GetBodyStorage(c *gin.Context) (BodyStorage, error) {
 			return bs, nil
 		}
 	}
+	// 请求体已被替换为内存中的内容
+	if cached, exists := c.Get(KeyRequestBody); exists && cached != nil {
+		if b, ok := cached.([]byte); ok {
+			storage, err := CreateBodyStorage(b)
+			if err != nil {
+				return nil, err
+			}
+			c.Set(KeyBodyStorage, storage)
+			return storage, nil
+		}
+	}
 
-	// 如果没有，调用 GetRequestBody 创建存储
-	_, err := GetRequestBody(c)
+	maxBytes := requestBodyLimit(c)
+	storage, err := CreateBodyStorageFromReader(c.Request.Body, c.Request.ContentLength, maxBytes)
+	_ = c.Request.Body.Close()
 	if err != nil {
+		if IsRequestBodyTooLargeError(err) {
+			return nil, errors.Wrap(ErrRequestBodyTooLarge, fmt.Sprintf("request body exceeds %d MB", maxBytes>>20))
+		}
 		return nil, err
 	}
+	// 缓存存储对象
+	c.Set(KeyBodyStorage, storage)
+	return storage, nil
+}
 
-	// 再次获取存储
-	if storage, exists := c.Get(KeyBodyStorage); exists && storage != nil {
-		if bs, ok := storage.(BodyStorage); ok {
-			if _, err := bs.Seek(0, io.SeekStart); err != nil {
-				return nil, fmt.Errorf("failed to seek body storage: %w", err)
-			}
-			return bs, nil
-		}
+// ReplaceRequestBody 替换已缓存的请求体，后续读取请求体的处理都会拿到新内容
+func ReplaceRequestBody(c *gin.Context, body []byte) error {
+	storage, err := CreateBodyStorage(body)
+	if err != nil {
+		return err
 	}
-
-	return nil, errors.New("failed to get body storage")
+	CleanupBodyStorage(c)
+	c.Set(KeyBodyStorage, storage)
+	c.Set(KeyRequestBody, body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	return nil
 }
 
 // CleanupBodyStorage 清理请求体存储（应在请求结束时调用）
 func CleanupBodyStorage(c *gin.Context) {
+	if cached, exists := c.Get(keyMultipartForm); exists && cached != nil {
+		if form, ok := cached.(*multipart.Form); ok {
+			_ = form.RemoveAll()
+		}
+		c.Set(keyMultipartForm, nil)
+	}
 	if storage, exists := c.Get(KeyBodyStorage); exists && storage != nil {
 		if bs, ok := storage.(BodyStorage); ok {
 			bs.Close()
@@ -128,6 +140,17 @@ func CleanupBodyStorage(c *gin.Context) {
 }
 
 func UnmarshalBodyReusable(c *gin.Context, v any) error {
+	contentType := c.Request.Header.Get("Content-Type")
+	if strings.Contains(contentType, gin.MIMEMultipartPOSTForm) {
+		if _, err := parseBoundary(contentType); err == nil {
+			// 表单中的文件可能很大，不读取整个请求体
+			form, err := ParseMultipartFormReusable(c)
+			if err != nil {
+				return err
+			}
+			return processFormValues(form.Value, v)
+		}
+	}
 	requestBody, err := GetRequestBody(c)
 	if err != nil {
 		return err
@@ -135,7 +158,6 @@ func UnmarshalBodyReusable(c *gin.Context, v any) error {
 	//if DebugEnabled {
 	//	println("UnmarshalBodyReusable request body:", string(requestBody))
 	//}
-	contentType := c.Request.Header.Get("Content-Type")
 	if strings.HasPrefix(contentType, "application/json") {
 		err = Unmarshal(requestBody, v)
 	} else if strings.Contains(contentType, gin.MIMEPOSTForm) {
@@ -251,26 +273,36 @@ func init() {
 	}
 }
 
+// ParseMultipartFormReusable 从请求体存储中流式解析表单，超过内存上限的文件写入临时文件，
+// 解析结果在请求内缓存，请求结束时由 CleanupBodyStorage 删除临时文件
 func ParseMultipartFormReusable(c *gin.Context) (*multipart.Form, error) {
-	requestBody, err := GetRequestBody(c)
-	if err != nil {
-		return nil, err
+	if cached, exists := c.Get(keyMultipartForm); exists && cached != nil {
+		if form, ok := cached.(*multipart.Form); ok {
+			return form, nil
+		}
 	}
-
 	contentType := c.Request.Header.Get("Content-Type")
 	boundary, err := parseBoundary(contentType)
 	if err != nil {
 		return nil, err
 	}
+	storage, err := GetBodyStorage(c)
+	if err != nil {
+		return nil, err
+	}
 
-	reader := multipart.NewReader(bytes.NewReader(requestBody), boundary)
+	reader := multipart.NewReader(storage, boundary)
 	form, err := reader.ReadForm(multipartMemoryLimit())
 	if err != nil {
 		return nil, err
 	}
+	c.Set(keyMultipartForm, form)
 
 	// Reset request body
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	if _, err = storage.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(storage)
 	return form, nil
 }
 
@@ -293,6 +325,10 @@ func parseFormData(data []byte, v any) error {
 	if err != nil {
 		return err
 	}
+	return processFormValues(values, v)
+}
+
+func processFormValues(values map[string][]string, v any) error {
 	formMap := make(map[string]any)
 	for key, vals := range values {
 		if len(vals) == 1 {
@@ -321,16 +357,7 @@ func parseMultipartFormData(c *gin.Context, data []byte, v any) error {
 		return err
 	}
 	defer form.RemoveAll()
-	formMap := make(map[string]any)
-	for key, vals := range form.Value {
-		if len(vals) == 1 {
-			formMap[key] = vals[0]
-		} else {
-			formMap[key] = vals
-		}
-	}
-
-	return processFormMap(formMap, v)
+	return processFormValues(form.Value, v)
 }
 
 var errBoundaryNotFound = errors.New("multipart boundary not found")
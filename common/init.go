@@ -26,6 +26,7 @@ func printHelp() {
 	fmt.Println("Original Project: OneAPI by JustSong - https://github.com/songquanpeng/one-api")
 	fmt.Println("Maintainer: QuantumNous - https://github.com/QuantumNous/new-api")
 	fmt.Println("Usage: newapi [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("       newapi migrate <status|up [n]|down [n]>")
 }
 
 func InitEnv() {
@@ -82,6 +83,8 @@ func InitEnv() {
 	DebugEnabled = os.Getenv("DEBUG") == "true"
 	MemoryCacheEnabled = os.Getenv("MEMORY_CACHE_ENABLED") == "true"
 	IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
+	MetricsToken = os.Getenv("METRICS_TOKEN")
+	initLogOptions()
 	TLSInsecureSkipVerify = GetEnvOrDefaultBool("TLS_INSECURE_SKIP_VERIFY", false)
 	if TLSInsecureSkipVerify {
 		if tr, ok := http.DefaultTransport.(*http.Transport); ok && tr != nil {
@@ -128,6 +131,8 @@ func initConstantEnv() {
 	constant.DifyDebug = GetEnvOrDefaultBool("DIFY_DEBUG", true)
 	constant.MaxFileDownloadMB = GetEnvOrDefault("MAX_FILE_DOWNLOAD_MB", 64)
 	constant.StreamScannerMaxBufferMB = GetEnvOrDefault("STREAM_SCANNER_MAX_BUFFER_MB", 64)
+	// StreamPassthroughEnabled 无需改写流式响应时直接转发上游数据，不缓存全部响应
+	constant.StreamPassthroughEnabled = GetEnvOrDefaultBool("STREAM_PASSTHROUGH_ENABLED", true)
 	// MaxRequestBodyMB 请求体最大大小（解压后），用于防止超大请求/zip bomb导致内存暴涨
 	constant.MaxRequestBodyMB = GetEnvOrDefault("MAX_REQUEST_BODY_MB", 128)
 	// ForceStreamOption 覆盖请求参数，强制返回usage信息
@@ -171,4 +176,12 @@ func initConstantEnv() {
 		}
 	}
 	constant.TrustedRedirectDomains = trustedDomains
+
+	// 反向代理与 CDN 配置，用于获取真实客户端 IP
+	for _, proxy := range strings.Split(GetEnvOrDefaultString("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			constant.TrustedProxies = append(constant.TrustedProxies, proxy)
+		}
+	}
+	constant.TrustedPlatform = strings.TrimSpace(GetEnvOrDefaultString("TRUSTED_PLATFORM", ""))
 }
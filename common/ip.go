@@ -1,6 +1,10 @@
 package common
 
-import "net"
+import (
+	"fmt"
+	"net"
+	"strings"
+)
 
 func IsIP(s string) bool {
 	ip := net.ParseIP(s)
@@ -49,3 +53,28 @@ func IsIpInCIDRList(ip net.IP, cidrList []string) bool {
 	}
 	return false
 }
+
+// ParseIpList 解析按行或逗号分隔的 IP/CIDR 列表
+func ParseIpList(raw string) []string {
+	ips := make([]string, 0)
+	for _, line := range strings.Split(strings.ReplaceAll(raw, ",", "\n"), "\n") {
+		ip := strings.ReplaceAll(strings.TrimSpace(line), " ", "")
+		if ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// ValidateIpList 校验列表中的每一项都是合法的 IP 或 CIDR
+func ValidateIpList(raw string) error {
+	for _, item := range ParseIpList(raw) {
+		if _, _, err := net.ParseCIDR(item); err == nil {
+			continue
+		}
+		if net.ParseIP(item) == nil {
+			return fmt.Errorf("无效的 IP 或 CIDR: %s", item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package common
+
+// 管理权限，自定义管理员角色由这些权限组合而成；系统设置等敏感操作仅限超级管理员，不作为可分配的权限
+const (
+	PermissionChannelsRead  = "channels:read"
+	PermissionChannelsWrite = "channels:write"
+	PermissionUsersManage   = "users:manage"
+	PermissionLogsRead      = "logs:read"
+	PermissionLogsWrite     = "logs:write" // 删除、归档与恢复日志
+	PermissionBillingManage = "billing:manage"
+	PermissionAuditRead     = "audit:read"
+	PermissionSystemRead    = "system:read" // 查看运行状态
+)
+
+var AllPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionUsersManage,
+	PermissionLogsRead,
+	PermissionLogsWrite,
+	PermissionBillingManage,
+	PermissionAuditRead,
+	PermissionSystemRead,
+}
+
+// DefaultAdminPermissions 未分配自定义角色的管理员拥有的权限，与原有管理员能力保持一致
+var DefaultAdminPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionUsersManage,
+	PermissionLogsRead,
+	PermissionLogsWrite,
+	PermissionBillingManage,
+	PermissionSystemRead,
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermissions 判断权限集合是否包含全部所需权限
+func HasPermissions(granted []string, required ...string) bool {
+	for _, r := range required {
+		found := false
+		for _, g := range granted {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -2,28 +2,116 @@ package common
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
-var RDB *redis.Client
-var RedisEnabled = true
+// RDB 单机、Cluster 与 Sentinel 模式共用同一个客户端接口
+var RDB redis.UniversalClient
+
+// RedisEnabled 运行中可能因降级切换，读写都需使用原子操作
+var RedisEnabled atomic.Bool
+
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeCluster    = "cluster"
+	RedisModeSentinel   = "sentinel"
+)
 
 func RedisKeyCacheSeconds() int {
 	return SyncFrequency
 }
 
+func redisAddrs() []string {
+	var addrs []string
+	for _, addr := range strings.Split(os.Getenv("REDIS_ADDRS"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func redisTLSConfig() *tls.Config {
+	if !GetEnvOrDefaultBool("REDIS_TLS", false) {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: GetEnvOrDefaultBool("REDIS_TLS_SKIP_VERIFY", false),
+	}
+}
+
+// newRedisClient 按 REDIS_MODE 创建客户端，单机模式使用 REDIS_CONN_STRING，集群与哨兵模式使用 REDIS_ADDRS
+func newRedisClient() (redis.UniversalClient, string, error) {
+	poolSize := GetEnvOrDefault("REDIS_POOL_SIZE", 10)
+	username := os.Getenv("REDIS_USERNAME")
+	password := os.Getenv("REDIS_PASSWORD")
+	mode := strings.ToLower(GetEnvOrDefaultString("REDIS_MODE", RedisModeStandalone))
+	switch mode {
+	case RedisModeCluster:
+		addrs := redisAddrs()
+		if len(addrs) == 0 {
+			return nil, "", errors.New("REDIS_ADDRS is required in cluster mode")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     addrs,
+			Username:  username,
+			Password:  password,
+			PoolSize:  poolSize,
+			TLSConfig: redisTLSConfig(),
+		}), strings.Join(addrs, ","), nil
+	case RedisModeSentinel:
+		addrs := redisAddrs()
+		masterName := os.Getenv("REDIS_MASTER_NAME")
+		if len(addrs) == 0 || masterName == "" {
+			return nil, "", errors.New("REDIS_ADDRS and REDIS_MASTER_NAME are required in sentinel mode")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       masterName,
+			SentinelAddrs:    addrs,
+			SentinelUsername: os.Getenv("REDIS_SENTINEL_USERNAME"),
+			SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+			Username:         username,
+			Password:         password,
+			DB:               GetEnvOrDefault("REDIS_DB", 0),
+			PoolSize:         poolSize,
+			TLSConfig:        redisTLSConfig(),
+		}), masterName + "@" + strings.Join(addrs, ","), nil
+	case RedisModeStandalone:
+		opt, err := redis.ParseURL(os.Getenv("REDIS_CONN_STRING"))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse Redis connection string: %w", err)
+		}
+		opt.PoolSize = poolSize
+		if username != "" {
+			opt.Username = username
+		}
+		if password != "" {
+			opt.Password = password
+		}
+		if opt.TLSConfig == nil {
+			opt.TLSConfig = redisTLSConfig()
+		}
+		return redis.NewClient(opt), fmt.Sprintf("%s/%d", opt.Addr, opt.DB), nil
+	}
+	return nil, "", fmt.Errorf("unsupported REDIS_MODE %q", mode)
+}
+
 // InitRedisClient This function is called after init()
 func InitRedisClient() (err error) {
-	if os.Getenv("REDIS_CONN_STRING") == "" {
-		RedisEnabled = false
+	if os.Getenv("REDIS_CONN_STRING") == "" && os.Getenv("REDIS_ADDRS") == "" {
+		RedisEnabled.Store(false)
 		SysLog("REDIS_CONN_STRING not set, Redis is not enabled")
 		return nil
 	}
@@ -32,23 +120,32 @@ func InitRedisClient() (err error) {
 		SyncFrequency = 60
 	}
 	SysLog("Redis is enabled")
-	opt, err := redis.ParseURL(os.Getenv("REDIS_CONN_STRING"))
+	client, target, err := newRedisClient()
 	if err != nil {
-		FatalLog("failed to parse Redis connection string: " + err.Error())
+		FatalLog(err.Error())
 	}
-	opt.PoolSize = GetEnvOrDefault("REDIS_POOL_SIZE", 10)
-	RDB = redis.NewClient(opt)
+	RDB = client
+	RedisEnabled.Store(true)
+	fallback := GetEnvOrDefaultBool("REDIS_FALLBACK_ENABLED", false)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	_, err = RDB.Ping(ctx).Result()
 	if err != nil {
-		FatalLog("Redis ping test failed: " + err.Error())
+		if !fallback {
+			FatalLog("Redis ping test failed: " + err.Error())
+		}
+		// 启用降级时以内存模式启动，由健康检查在 Redis 恢复后切回
+		SysError("Redis ping test failed, starting in degraded mode: " + err.Error())
+		setRedisDegraded(true)
+		err = nil
+	}
+	if fallback {
+		startRedisHealthCheck()
 	}
 	if DebugEnabled {
-		SysLog(fmt.Sprintf("Redis connected to %s", opt.Addr))
-		SysLog(fmt.Sprintf("Redis database: %d", opt.DB))
+		SysLog(fmt.Sprintf("Redis connected to %s", target))
 	}
 	return err
 }
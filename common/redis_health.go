@@ -0,0 +1,96 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Redis 降级：连续多次 ping 失败后关闭 RedisEnabled，限流与缓存退回内存实现；
+// 恢复后需持续健康一个缓存周期才切回，确保降级前写入的缓存已过期
+
+type RedisHealthStats struct {
+	Configured      bool  `json:"configured"`
+	Degraded        bool  `json:"degraded"`
+	DegradedSince   int64 `json:"degraded_since"`
+	Degradations    int64 `json:"degradations"`
+	PingFailures    int64 `json:"ping_failures"`
+	LastPingLatency int64 `json:"last_ping_latency_ms"`
+}
+
+var (
+	redisHealthOnce     sync.Once
+	redisDegraded       atomic.Bool
+	redisDegradedSince  atomic.Int64
+	redisDegradations   atomic.Int64
+	redisPingFailures   atomic.Int64
+	redisLastPingMillis atomic.Int64
+)
+
+func setRedisDegraded(degraded bool) {
+	if redisDegraded.Swap(degraded) == degraded {
+		return
+	}
+	RedisEnabled.Store(!degraded)
+	if degraded {
+		redisDegradedSince.Store(time.Now().Unix())
+		redisDegradations.Add(1)
+		SysError("Redis is unavailable, falling back to in-memory rate limiting and caching")
+	} else {
+		redisDegradedSince.Store(0)
+		SysLog("Redis recovered, leaving degraded mode")
+	}
+}
+
+// GetRedisHealthStats 返回 Redis 健康状况，未启用降级时 Degraded 始终为 false
+func GetRedisHealthStats() RedisHealthStats {
+	return RedisHealthStats{
+		Configured:      RDB != nil,
+		Degraded:        redisDegraded.Load(),
+		DegradedSince:   redisDegradedSince.Load(),
+		Degradations:    redisDegradations.Load(),
+		PingFailures:    redisPingFailures.Load(),
+		LastPingLatency: redisLastPingMillis.Load(),
+	}
+}
+
+func startRedisHealthCheck() {
+	redisHealthOnce.Do(func() {
+		interval := time.Duration(GetEnvOrDefault("REDIS_HEALTH_CHECK_INTERVAL", 5)) * time.Second
+		threshold := GetEnvOrDefault("REDIS_FAILURE_THRESHOLD", 3)
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			failures := 0
+			var healthySince time.Time
+			for range ticker.C {
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				start := time.Now()
+				err := RDB.Ping(ctx).Err()
+				cancel()
+				if err != nil {
+					redisPingFailures.Add(1)
+					healthySince = time.Time{}
+					failures++
+					if failures >= threshold && !redisDegraded.Load() {
+						SysError("Redis health check failed: " + err.Error())
+						setRedisDegraded(true)
+					}
+					continue
+				}
+				redisLastPingMillis.Store(time.Since(start).Milliseconds())
+				failures = 0
+				if !redisDegraded.Load() {
+					continue
+				}
+				if healthySince.IsZero() {
+					healthySince = time.Now()
+				}
+				if time.Since(healthySince) >= time.Duration(RedisKeyCacheSeconds())*time.Second {
+					setRedisDegraded(false)
+				}
+			}
+		}()
+	})
+}
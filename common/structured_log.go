@@ -0,0 +1,91 @@
+package common
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 日志格式、级别与输出目标，分别由 LOG_FORMAT、LOG_LEVEL、LOG_OUTPUT 环境变量配置
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+	LogOutputSyslog = "syslog"
+)
+
+var (
+	LogFormat = LogFormatText
+	LogOutput = LogOutputStdout
+	LogLevel  = new(slog.LevelVar)
+)
+
+// ginWriter 每次写入时读取 gin 当前的输出，日志文件轮转后无需重建 logger
+type ginWriter struct {
+	stderr bool
+}
+
+func (w ginWriter) Write(p []byte) (int, error) {
+	var writer io.Writer = gin.DefaultWriter
+	if w.stderr {
+		writer = gin.DefaultErrorWriter
+	}
+	return writer.Write(p)
+}
+
+var (
+	jsonStdoutLogger = slog.New(slog.NewJSONHandler(ginWriter{}, &slog.HandlerOptions{Level: LogLevel}))
+	jsonStderrLogger = slog.New(slog.NewJSONHandler(ginWriter{stderr: true}, &slog.HandlerOptions{Level: LogLevel}))
+)
+
+func IsJSONLog() bool {
+	return LogFormat == LogFormatJSON
+}
+
+func LogLevelEnabled(level slog.Level) bool {
+	return level >= LogLevel.Level()
+}
+
+// ParseLogLevel 解析 debug/info/warn/error，无法识别时返回 info
+func ParseLogLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error", "err":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// LogJSON 输出一条 JSON 日志，warn 及以上写入错误输出
+func LogJSON(level slog.Level, msg string, attrs ...slog.Attr) {
+	logger := jsonStdoutLogger
+	if level >= slog.LevelWarn {
+		logger = jsonStderrLogger
+	}
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+func initLogOptions() {
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), LogFormatJSON) {
+		LogFormat = LogFormatJSON
+	}
+	switch output := strings.ToLower(os.Getenv("LOG_OUTPUT")); output {
+	case LogOutputFile, LogOutputSyslog:
+		LogOutput = output
+	}
+	level := os.Getenv("LOG_LEVEL")
+	if level == "" && DebugEnabled {
+		level = "debug"
+	}
+	LogLevel.Set(ParseLogLevel(level))
+}
@@ -16,6 +16,7 @@ type verificationValue struct {
 const (
 	EmailVerificationPurpose = "v"
 	PasswordResetPurpose     = "r"
+	TwoFARecoveryPurpose     = "t"
 )
 
 var verificationMutex sync.Mutex
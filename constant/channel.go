@@ -55,6 +55,8 @@ const (
 	ChannelTypeSora           = 55
 	ChannelTypeReplicate      = 56
 	ChannelTypeCodex          = 57
+	ChannelTypeVoyage         = 58
+	ChannelTypeLocal          = 59
 	ChannelTypeDummy          // this one is only for count, do not add any channel after this
 
 )
@@ -118,6 +120,8 @@ var ChannelBaseURLs = []string{
 	"https://api.openai.com",                    //55
 	"https://api.replicate.com",                 //56
 	"https://chatgpt.com",                       //57
+	"https://api.voyageai.com",                  //58
+	"http://localhost:8000",                     //59
 }
 
 var ChannelTypeNames = map[int]string{
@@ -175,6 +179,8 @@ var ChannelTypeNames = map[int]string{
 	ChannelTypeSora:           "Sora",
 	ChannelTypeReplicate:      "Replicate",
 	ChannelTypeCodex:          "Codex",
+	ChannelTypeVoyage:         "Voyage",
+	ChannelTypeLocal:          "Local",
 }
 
 func GetChannelTypeName(channelType int) string {
@@ -207,3 +213,8 @@ var ChannelSpecialBases = map[string]ChannelSpecialBase{
 		OpenAIBaseURL: "https://ark.cn-beijing.volces.com/api/coding/v3",
 	},
 }
+
+// ChannelTypeAllowEmptyKey 自建的本地推理服务通常不做鉴权，允许不填写密钥
+func ChannelTypeAllowEmptyKey(channelType int) bool {
+	return channelType == ChannelTypeLocal || channelType == ChannelTypeOllama
+}
@@ -6,8 +6,14 @@ const (
 	ContextKeyTokenCountMeta  ContextKey = "token_count_meta"
 	ContextKeyPromptTokens    ContextKey = "prompt_tokens"
 	ContextKeyEstimatedTokens ContextKey = "estimated_tokens"
+	ContextKeyConsumedTokens  ContextKey = "consumed_tokens"
+	ContextKeyConsumedQuota   ContextKey = "consumed_quota"
+	ContextKeyConsumedPrompt  ContextKey = "consumed_prompt_tokens"
+	ContextKeyConsumedOutput  ContextKey = "consumed_completion_tokens"
+	ContextKeyStreamFailovers ContextKey = "stream_failovers"
 
 	ContextKeyOriginalModel    ContextKey = "original_model"
+	ContextKeyRequestedModel   ContextKey = "requested_model" // 模型改写前客户端请求的模型
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
 
 	/* token related keys */
@@ -19,6 +25,12 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenMaxConcurrency    ContextKey = "token_max_concurrency"
+	// ContextKeySkipTokenQuota 费用不从令牌额度扣除，按 playground 方式只扣用户额度
+	ContextKeySkipTokenQuota         ContextKey = "skip_token_quota"
+	ContextKeyTokenContextTruncation ContextKey = "token_context_truncation"
+	ContextKeyTokenRelayRace         ContextKey = "token_relay_race"
+	ContextKeyProject                ContextKey = "project"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -43,14 +55,17 @@ const (
 	ContextKeyAutoGroupRetryIndex ContextKey = "auto_group_retry_index"
 
 	/* user related keys */
-	ContextKeyUserId      ContextKey = "id"
-	ContextKeyUserSetting ContextKey = "user_setting"
-	ContextKeyUserQuota   ContextKey = "user_quota"
-	ContextKeyUserStatus  ContextKey = "user_status"
-	ContextKeyUserEmail   ContextKey = "user_email"
-	ContextKeyUserGroup   ContextKey = "user_group"
-	ContextKeyUsingGroup  ContextKey = "group"
-	ContextKeyUserName    ContextKey = "username"
+	ContextKeyUserId          ContextKey = "id"
+	ContextKeyUserSetting     ContextKey = "user_setting"
+	ContextKeyUserQuota       ContextKey = "user_quota"
+	ContextKeyUserCreditLimit ContextKey = "user_credit_limit"
+	ContextKeyUserStatus      ContextKey = "user_status"
+	ContextKeyUserEmail       ContextKey = "user_email"
+	ContextKeyUserGroup       ContextKey = "user_group"
+	ContextKeyUsingGroup      ContextKey = "group"
+	ContextKeyUserName        ContextKey = "username"
+	// ContextKeyUserOrganizationId stores the organization the user belongs to, 0 when none
+	ContextKeyUserOrganizationId ContextKey = "user_organization_id"
 
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
@@ -63,6 +78,41 @@ const (
 	// It is not returned to end users, but can be persisted into consume/error logs for debugging.
 	ContextKeyAdminRejectReason ContextKey = "admin_reject_reason"
 
+	// ContextKeyResponsesFinalResponse stores the final /v1/responses object (raw JSON) for server-side storage
+	ContextKeyResponsesFinalResponse ContextKey = "responses_final_response"
+	// ContextKeyResponsesReplayTokens stores the estimated tokens of the replayed previous_response_id context added to the prompt estimate
+	ContextKeyResponsesReplayTokens ContextKey = "responses_replay_tokens"
+
+	// ContextKeyAudioDurationSeconds stores the audio duration (float64 seconds) of a transcription or speech request
+	ContextKeyAudioDurationSeconds ContextKey = "audio_duration_seconds"
+
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
+
+	// ContextKeyPIIRedactions stores per-rule counts of values masked before the request was sent upstream
+	ContextKeyPIIRedactions ContextKey = "pii_redactions"
+
+	// ContextKeyGuardrailApplied marks requests that had admin-configured guardrail prompts inserted
+	ContextKeyGuardrailApplied ContextKey = "guardrail_applied"
+
+	// ContextKeyParamPolicyAdjustments stores the sampling parameters clamped by admin-configured parameter policies
+	ContextKeyParamPolicyAdjustments ContextKey = "param_policy_adjustments"
+
+	// ContextKeyTransformHeaders stores request headers set by pre_relay transform hooks, forwarded upstream after channel overrides
+	ContextKeyTransformHeaders ContextKey = "transform_headers"
+
+	// ContextKeyReasoningFormatter stores the per-request reasoning output formatter for chat completions
+	ContextKeyReasoningFormatter ContextKey = "reasoning_formatter"
+
+	// ContextKeyRelayRaceEntrant marks a copied context as one entrant of a multi-channel race
+	ContextKeyRelayRaceEntrant ContextKey = "relay_race_entrant"
+
+	// ContextKeyCLIClient stores the detected command line client (claude-code, codex) of the request
+	ContextKeyCLIClient ContextKey = "cli_client"
+
+	// ContextKeyRequiredCapabilities stores the channel capabilities (vision, tools, json_schema...) detected from the request body
+	ContextKeyRequiredCapabilities ContextKey = "required_capabilities"
+
+	// ContextKeyCapabilityMismatch marks that the last upstream error was recorded as a channel capability mismatch
+	ContextKeyCapabilityMismatch ContextKey = "capability_mismatch"
 )
@@ -0,0 +1,11 @@
+package constant
+
+// 输入超出模型上下文窗口时的截断策略，令牌未配置时直接拒绝请求
+const (
+	ContextTruncationDropOldest = "drop_oldest" // 从最早的消息开始丢弃
+	ContextTruncationMiddleOut  = "middle_out"  // 保留首尾，从中间开始丢弃
+)
+
+func IsValidContextTruncation(strategy string) bool {
+	return strategy == "" || strategy == ContextTruncationDropOldest || strategy == ContextTruncationMiddleOut
+}
@@ -4,6 +4,7 @@ var StreamingTimeout int
 var DifyDebug bool
 var MaxFileDownloadMB int
 var StreamScannerMaxBufferMB int
+var StreamPassthroughEnabled bool
 var ForceStreamOption bool
 var CountToken bool
 var GetMediaToken bool
@@ -23,3 +24,9 @@ var TaskPricePatches []string
 // TrustedRedirectDomains is a list of trusted domains for redirect URL validation.
 // Domains support subdomain matching (e.g., "example.com" matches "sub.example.com").
 var TrustedRedirectDomains []string
+
+// TrustedProxies 允许设置 X-Forwarded-For 等头的反向代理地址，为空时沿用 gin 默认行为
+var TrustedProxies []string
+
+// TrustedPlatform 由 CDN 写入真实客户端 IP 的请求头，例如 CF-Connecting-IP
+var TrustedPlatform string
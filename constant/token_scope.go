@@ -0,0 +1,37 @@
+package constant
+
+// 令牌可访问的接口类别，令牌未配置范围时不做限制
+const (
+	TokenScopeChat        = "chat"        // chat/completions、completions、messages、responses
+	TokenScopeEmbeddings  = "embeddings"  // embeddings
+	TokenScopeImages      = "images"      // images 与 Midjourney
+	TokenScopeAudio       = "audio"       // 语音合成与识别
+	TokenScopeRerank      = "rerank"      // rerank
+	TokenScopeModerations = "moderations" // moderations
+	TokenScopeRealtime    = "realtime"    // realtime websocket
+	TokenScopeVideo       = "video"       // 视频与音乐等异步任务
+	TokenScopeFiles       = "files"       // files 与 batches
+	TokenScopeDashboard   = "dashboard"   // 只读的额度与用量查询
+)
+
+var TokenScopes = []string{
+	TokenScopeChat,
+	TokenScopeEmbeddings,
+	TokenScopeImages,
+	TokenScopeAudio,
+	TokenScopeRerank,
+	TokenScopeModerations,
+	TokenScopeRealtime,
+	TokenScopeVideo,
+	TokenScopeFiles,
+	TokenScopeDashboard,
+}
+
+func IsValidTokenScope(scope string) bool {
+	for _, s := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
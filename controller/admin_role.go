@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type adminRoleRequest struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type adminRoleResponse struct {
+	*model.AdminRole
+	Permissions []string `json:"permissions"`
+}
+
+func toAdminRoleResponse(role *model.AdminRole) *adminRoleResponse {
+	return &adminRoleResponse{AdminRole: role, Permissions: role.GetPermissions()}
+}
+
+// GetAllPermissions 返回可用于组合角色的全部权限，以及默认管理员拥有的权限
+func GetAllPermissions(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"permissions":         common.AllPermissions,
+		"default_permissions": common.DefaultAdminPermissions,
+	})
+}
+
+func GetAdminRoles(c *gin.Context) {
+	roles, err := model.GetAllAdminRoles()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]*adminRoleResponse, 0, len(roles))
+	for _, role := range roles {
+		items = append(items, toAdminRoleResponse(role))
+	}
+	common.ApiSuccess(c, items)
+}
+
+// applyAdminRoleRequest 校验请求并写入角色，校验失败时已返回错误信息
+func applyAdminRoleRequest(c *gin.Context, role *model.AdminRole, req *adminRoleRequest) bool {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "角色名称不能为空且不超过 64 个字符")
+		return false
+	}
+	if model.IsAdminRoleNameTaken(req.Name, role.Id) {
+		common.ApiErrorMsg(c, "角色名称已存在")
+		return false
+	}
+	permissions := make([]string, 0, len(req.Permissions))
+	for _, p := range req.Permissions {
+		if !common.IsValidPermission(p) {
+			common.ApiErrorMsg(c, "未知的权限: "+p)
+			return false
+		}
+		if !common.HasPermissions(permissions, p) {
+			permissions = append(permissions, p)
+		}
+	}
+	role.Name = req.Name
+	role.Description = req.Description
+	role.SetPermissions(permissions)
+	return true
+}
+
+func CreateAdminRole(c *gin.Context) {
+	var req adminRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role := &model.AdminRole{}
+	if !applyAdminRoleRequest(c, role, &req) {
+		return
+	}
+	if err := role.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, toAdminRoleResponse(role))
+}
+
+func UpdateAdminRole(c *gin.Context) {
+	var req adminRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role, err := model.GetAdminRoleById(req.Id)
+	if err != nil {
+		common.ApiErrorMsg(c, "角色不存在")
+		return
+	}
+	if !applyAdminRoleRequest(c, role, &req) {
+		return
+	}
+	if err := role.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, toAdminRoleResponse(role))
+}
+
+func DeleteAdminRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteAdminRoleById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// SetUserAdminRole 为管理员分配自定义角色，admin_role_id 为 0 时恢复默认管理员权限
+func SetUserAdminRole(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	var req struct {
+		AdminRoleId int `json:"admin_role_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.Role != common.RoleAdminUser {
+		common.ApiErrorMsg(c, "只能为管理员分配角色")
+		return
+	}
+	if req.AdminRoleId != 0 {
+		if _, err := model.GetAdminRoleById(req.AdminRoleId); err != nil {
+			common.ApiErrorMsg(c, "角色不存在")
+			return
+		}
+	}
+	if err := model.SetUserAdminRole(userId, req.AdminRoleId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
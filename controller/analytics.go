@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseUsageStatFilter(c *gin.Context) model.UsageStatFilter {
+	filter := model.UsageStatFilter{Period: model.UsageStatPeriodHour}
+	if c.Query("period") == model.UsageStatPeriodDay {
+		filter.Period = model.UsageStatPeriodDay
+	}
+	filter.Start, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	filter.End, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if filter.Start == 0 {
+		if filter.Period == model.UsageStatPeriodDay {
+			filter.Start = time.Now().AddDate(0, 0, -30).Unix()
+		} else {
+			filter.Start = time.Now().Add(-24 * time.Hour).Unix()
+		}
+	}
+	filter.UserId, _ = strconv.Atoi(c.Query("user_id"))
+	filter.TokenId, _ = strconv.Atoi(c.Query("token_id"))
+	filter.ChannelId, _ = strconv.Atoi(c.Query("channel_id"))
+	filter.ModelName = c.Query("model_name")
+	filter.Project = c.Query("project")
+	return filter
+}
+
+func respondUsageAnalytics(c *gin.Context, filter model.UsageStatFilter) {
+	stats, err := model.QueryUsageStats(filter)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    service.AggregateUsageStats(stats, c.Query("group_by"), c.Query("summary") == "true"),
+	})
+}
+
+// GetUsageAnalytics 查询汇总用量，group_by 可选 user/token/channel/model/project
+func GetUsageAnalytics(c *gin.Context) {
+	respondUsageAnalytics(c, parseUsageStatFilter(c))
+}
+
+func GetSelfUsageAnalytics(c *gin.Context) {
+	filter := parseUsageStatFilter(c)
+	filter.UserId = c.GetInt("id")
+	filter.ChannelId = 0
+	if c.Query("group_by") == "channel" || c.Query("group_by") == "user" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的分组维度",
+		})
+		return
+	}
+	respondUsageAnalytics(c, filter)
+}
+
+// GetDashboardOverview 管理后台概览：今日与昨日、本周与上周的用量对比及排行
+func GetDashboardOverview(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 50 {
+		limit = 50
+	}
+	overview, err := service.GetDashboardOverview(limit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, overview)
+}
@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+)
+
+const batchCompletionWindow = "24h"
+
+var batchSupportedEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+	"/v1/moderations":      true,
+}
+
+func batchError(c *gin.Context, statusCode int, errorType string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    errorType,
+		},
+	})
+}
+
+// parseBatchInput 校验 JSONL 输入，返回待执行的请求行
+func parseBatchInput(data []byte, endpoint string, maxRequests int) ([]*model.BatchRequest, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	customIds := make(map[string]struct{})
+	requests := make([]*model.BatchRequest, 0)
+	for line := 1; ; line++ {
+		raw, readErr := reader.ReadBytes('\n')
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 {
+			item := dto.BatchRequestLine{}
+			if err := common.Unmarshal(raw, &item); err != nil {
+				return nil, fmt.Errorf("line %d: invalid JSON: %s", line, err.Error())
+			}
+			if item.CustomId == "" {
+				return nil, fmt.Errorf("line %d: custom_id is required", line)
+			}
+			if _, ok := customIds[item.CustomId]; ok {
+				return nil, fmt.Errorf("line %d: duplicate custom_id %s", line, item.CustomId)
+			}
+			customIds[item.CustomId] = struct{}{}
+			if item.Method != http.MethodPost {
+				return nil, fmt.Errorf("line %d: only POST method is supported", line)
+			}
+			if item.Url != endpoint {
+				return nil, fmt.Errorf("line %d: url %s does not match batch endpoint %s", line, item.Url, endpoint)
+			}
+			if !gjson.ValidBytes(item.Body) || !gjson.ParseBytes(item.Body).IsObject() {
+				return nil, fmt.Errorf("line %d: body must be a JSON object", line)
+			}
+			if gjson.GetBytes(item.Body, "stream").Bool() {
+				return nil, fmt.Errorf("line %d: streaming is not supported in batch requests", line)
+			}
+			requests = append(requests, &model.BatchRequest{
+				Line:     line,
+				CustomId: item.CustomId,
+				Url:      item.Url,
+				Body:     string(item.Body),
+				Status:   model.BatchRequestStatusPending,
+			})
+			if len(requests) > maxRequests {
+				return nil, fmt.Errorf("batch exceeds the limit of %d requests", maxRequests)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if len(requests) == 0 {
+		return nil, errors.New("input file contains no requests")
+	}
+	return requests, nil
+}
+
+type createBatchRequest struct {
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// readBatchInput 读取批处理输入文件内容：JSON 请求通过 input_file_id 引用 /v1/files 上传的文件，
+// multipart 请求直接以字段 file 上传
+func readBatchInput(c *gin.Context, req *createBatchRequest, maxSizeMB int) ([]byte, error) {
+	maxBytes := int64(maxSizeMB) << 20
+	if req.InputFileId != "" {
+		file, err := model.GetUserFile(c.GetInt("id"), req.InputFileId)
+		if err != nil {
+			return nil, fmt.Errorf("no such file: %s", req.InputFileId)
+		}
+		if file.Purpose != dto.FilePurposeBatch {
+			return nil, fmt.Errorf("file %s must have purpose 'batch'", req.InputFileId)
+		}
+		if maxSizeMB > 0 && file.Bytes > maxBytes {
+			return nil, fmt.Errorf("input file exceeds %d MB", maxSizeMB)
+		}
+		reader, err := openStoredFile(c, file)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.New("input_file_id or multipart field 'file' is required")
+	}
+	if maxSizeMB > 0 && fileHeader.Size > maxBytes {
+		return nil, fmt.Errorf("input file exceeds %d MB", maxSizeMB)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// CreateBatch 创建批处理，支持 JSON（input_file_id）与 multipart（直接上传 file）两种方式
+func CreateBatch(c *gin.Context) {
+	setting := operation_setting.GetBatchSetting()
+	if !setting.Enabled {
+		batchError(c, http.StatusForbidden, "invalid_request_error", "batch API is disabled")
+		return
+	}
+	req := &createBatchRequest{}
+	metadata := ""
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		if err := common.UnmarshalBodyReusable(c, req); err != nil {
+			batchError(c, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+			return
+		}
+		if len(req.Metadata) > 16 {
+			batchError(c, http.StatusBadRequest, "invalid_request_error", "metadata must be a JSON object with at most 16 string values")
+			return
+		}
+		if len(req.Metadata) > 0 {
+			data, _ := common.Marshal(req.Metadata)
+			metadata = string(data)
+		}
+	} else {
+		req.InputFileId = c.PostForm("input_file_id")
+		req.Endpoint = c.PostForm("endpoint")
+		req.CompletionWindow = c.PostForm("completion_window")
+		metadata = c.PostForm("metadata")
+		if metadata != "" {
+			values := map[string]string{}
+			if err := common.UnmarshalJsonStr(metadata, &values); err != nil || len(values) > 16 {
+				batchError(c, http.StatusBadRequest, "invalid_request_error", "metadata must be a JSON object with at most 16 string values")
+				return
+			}
+		}
+	}
+	endpoint := req.Endpoint
+	if !batchSupportedEndpoints[endpoint] {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", "unsupported endpoint: "+endpoint)
+		return
+	}
+	completionWindow := req.CompletionWindow
+	if completionWindow == "" {
+		completionWindow = batchCompletionWindow
+	}
+	if completionWindow != batchCompletionWindow {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", "completion_window must be 24h")
+		return
+	}
+
+	data, err := readBatchInput(c, req, setting.MaxInputFileSizeMB)
+	if err != nil {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	requests, err := parseBatchInput(data, endpoint, setting.MaxRequestsPerBatch)
+	if err != nil {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	if req.InputFileId == "" {
+		req.InputFileId = "file-" + common.GetUUID()
+	}
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          "batch_" + common.GetUUID(),
+		UserId:           c.GetInt("id"),
+		TokenId:          c.GetInt("token_id"),
+		ClientIp:         c.ClientIP(),
+		Endpoint:         endpoint,
+		InputFileId:      req.InputFileId,
+		CompletionWindow: completionWindow,
+		Status:           dto.BatchStatusValidating,
+		Metadata:         metadata,
+		TotalCount:       len(requests),
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*3600,
+	}
+	batch.SpecificChannelId, _ = strconv.Atoi(c.GetString("specific_channel_id"))
+	if err := model.CreateBatch(batch, requests); err != nil {
+		batchError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+func getUserBatch(c *gin.Context) (*model.Batch, bool) {
+	batch, err := model.GetBatchByBatchId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			batchError(c, http.StatusNotFound, "invalid_request_error", "No batch found with id '"+c.Param("id")+"'")
+		} else {
+			batchError(c, http.StatusInternalServerError, "server_error", err.Error())
+		}
+		return nil, false
+	}
+	return batch, true
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch, ok := getUserBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+func CancelBatch(c *gin.Context) {
+	batch, ok := getUserBatch(c)
+	if !ok {
+		return
+	}
+	if err := model.CancelBatch(batch); err != nil {
+		batchError(c, http.StatusConflict, "invalid_request_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]*dto.OpenAIBatch, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, batch.ToOpenAIBatch())
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+		"first_id": nil,
+		"last_id":  nil,
+	}
+	if len(data) > 0 {
+		response["first_id"] = data[0].ID
+		response["last_id"] = data[len(data)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetBatchOutputFile 下载批处理输出文件（成功请求）
+func GetBatchOutputFile(c *gin.Context) {
+	writeBatchResultFile(c, true)
+}
+
+// GetBatchErrorFile 下载批处理错误文件（失败、取消或过期的请求）
+func GetBatchErrorFile(c *gin.Context) {
+	writeBatchResultFile(c, false)
+}
+
+func writeBatchResultFile(c *gin.Context, succeeded bool) {
+	batch, ok := getUserBatch(c)
+	if !ok {
+		return
+	}
+	if !batch.IsFinished() {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", "batch is not finished, current status: "+batch.Status)
+		return
+	}
+	fileId := batch.OutputFileId()
+	if !succeeded {
+		fileId = batch.ErrorFileId()
+	}
+	c.Header("Content-Disposition", "attachment; filename="+fileId+".jsonl")
+	c.Header("Content-Type", "application/jsonl")
+	c.Status(http.StatusOK)
+
+	afterLine := 0
+	for {
+		requests, err := model.GetBatchResultRequests(batch.Id, succeeded, afterLine, 500)
+		if err != nil {
+			common.SysError("failed to read batch results: " + err.Error())
+			return
+		}
+		for _, request := range requests {
+			data, err := common.Marshal(batchResultLine(request))
+			if err != nil {
+				continue
+			}
+			_, _ = c.Writer.Write(append(data, '\n'))
+			afterLine = request.Line
+		}
+		if len(requests) < 500 {
+			return
+		}
+	}
+}
+
+func batchResultLine(request *model.BatchRequest) dto.BatchResultLine {
+	line := dto.BatchResultLine{
+		ID:       "batch_req_" + strconv.Itoa(request.Id),
+		CustomId: request.CustomId,
+	}
+	if request.StatusCode != 0 {
+		line.Response = &dto.BatchResultResponse{
+			StatusCode: request.StatusCode,
+			RequestId:  request.RequestId,
+			Body:       []byte(request.Response),
+		}
+	}
+	if request.Error != "" {
+		line.Error = &dto.BatchError{
+			Code:    "batch_" + request.Status,
+			Message: request.Error,
+			Line:    request.Line,
+		}
+	}
+	return line
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
@@ -64,6 +65,9 @@ func GetSubscription(c *gin.Context) {
 		SystemHardLimitUSD: amount,
 		AccessUntil:        expiredTime,
 	}
+	if token == nil || !token.UnlimitedQuota {
+		subscription.Amounts = service.QuotaCurrencyAmounts(int64(quota))
+	}
 	c.JSON(200, subscription)
 	return
 }
@@ -102,6 +106,7 @@ func GetUsage(c *gin.Context) {
 	usage := OpenAIUsageResponse{
 		Object:     "list",
 		TotalUsage: amount * 100,
+		Amounts:    service.QuotaCurrencyAmounts(int64(quota)),
 	}
 	c.JSON(200, usage)
 	return
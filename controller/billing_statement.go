@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getStatementPeriod(c *gin.Context) string {
+	if period := c.Query("period"); period != "" {
+		return period
+	}
+	return service.CurrentBillingPeriod()
+}
+
+func respondStatement(c *gin.Context, userId int) {
+	statement, err := service.GetStatement(userId, getStatementPeriod(c))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.FillStatementDisplayAmounts(statement)
+	common.ApiSuccess(c, statement)
+}
+
+// exportStatement 按 format 导出账单，支持 csv 与 pdf
+func exportStatement(c *gin.Context, userId int) {
+	statement, err := service.GetStatement(userId, getStatementPeriod(c))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	filename := fmt.Sprintf("statement-%d-%s", statement.UserId, statement.Period)
+	switch c.DefaultQuery("format", "csv") {
+	case "csv":
+		data, err := service.StatementCSV(statement)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	case "pdf":
+		c.Header("Content-Disposition", "attachment; filename="+filename+".pdf")
+		c.Data(http.StatusOK, "application/pdf", service.StatementPDF(statement))
+	default:
+		common.ApiErrorMsg(c, "不支持的导出格式")
+	}
+}
+
+func GetSelfBillingStatement(c *gin.Context) {
+	respondStatement(c, c.GetInt("id"))
+}
+
+func ExportSelfBillingStatement(c *gin.Context) {
+	exportStatement(c, c.GetInt("id"))
+}
+
+func GetUserBillingStatement(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	respondStatement(c, userId)
+}
+
+func ExportUserBillingStatement(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	exportStatement(c, userId)
+}
+
+func GetBillingPeriods(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	periods, total, err := model.GetBillingPeriods(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(periods)
+	common.ApiSuccess(c, pageInfo)
+}
+
+type finalizeBillingPeriodRequest struct {
+	Period string `json:"period"`
+}
+
+// FinalizeBillingPeriod 锁定账期，之后该月账单不再随价格或日志变化
+func FinalizeBillingPeriod(c *gin.Context) {
+	var req finalizeBillingPeriodRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Period == "" {
+		common.ApiErrorMsg(c, "请提供账期")
+		return
+	}
+	billingPeriod, err := service.FinalizeBillingPeriod(req.Period, c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrBillingPeriodFinalized) {
+			common.ApiErrorMsg(c, err.Error())
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, billingPeriod)
+}
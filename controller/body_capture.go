@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBodyCaptures 列出已记录的上游请求，不包含请求/响应内容
+func GetBodyCaptures(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	channelId, _ := strconv.Atoi(c.Query("channel"))
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	captures, total, err := model.GetBodyCaptures(c.Query("request_id"), channelId, tokenId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(captures)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetBodyCapture 解密返回完整的请求/响应内容，密钥已脱敏
+func GetBodyCapture(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	capture, err := model.GetBodyCaptureById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	payload, err := capture.GetPayload()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var secrets []string
+	if channel, err := model.GetChannelById(capture.ChannelId, true); err == nil {
+		secrets = channel.GetKeys()
+	}
+	payload.RequestHeaders = service.RedactHeaders(payload.RequestHeaders, secrets...)
+	payload.RequestBody = service.RedactSecrets(payload.RequestBody, secrets...)
+	payload.ResponseHeaders = service.RedactHeaders(payload.ResponseHeaders, secrets...)
+	payload.ResponseBody = service.RedactSecrets(payload.ResponseBody, secrets...)
+	common.ApiSuccess(c, gin.H{
+		"capture": capture,
+		"payload": payload,
+	})
+}
+
+func DeleteBodyCapture(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteBodyCapture(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
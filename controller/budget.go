@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetSelfBudgets(c *gin.Context) {
+	budgets, err := service.GetSelfBudgets(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, budgets)
+}
+
+func GetBudgets(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	budgets, total, err := model.GetBudgets(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	period := service.CurrentBillingPeriod()
+	for _, budget := range budgets {
+		budget.ResetIfStale(period)
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(budgets)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// validateBudget 校验预算参数，令牌预算只能作用于自己的令牌
+func validateBudget(budget *model.Budget, userId int) error {
+	if err := budget.Validate(); err != nil {
+		return err
+	}
+	if budget.Scope == model.BudgetScopeToken {
+		if _, err := model.GetTokenByIds(budget.TokenId, userId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func AddSelfBudget(c *gin.Context) {
+	userId := c.GetInt("id")
+	budget := model.Budget{}
+	if err := c.ShouldBindJSON(&budget); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	budget.Id = 0
+	budget.UserId = userId
+	if err := validateBudget(&budget, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := budget.Insert(service.CurrentBillingPeriod()); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, budget)
+}
+
+func UpdateSelfBudget(c *gin.Context) {
+	userId := c.GetInt("id")
+	input := model.Budget{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	budget, err := model.GetBudgetByIds(input.Id, userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	budget.Scope = input.Scope
+	budget.TokenId = input.TokenId
+	budget.Group = input.Group
+	budget.SoftLimit = input.SoftLimit
+	budget.HardLimit = input.HardLimit
+	budget.AlertThresholds = input.AlertThresholds
+	if err := validateBudget(budget, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := budget.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	budget.ResetIfStale(service.CurrentBillingPeriod())
+	common.ApiSuccess(c, budget)
+}
+
+func DeleteSelfBudget(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的预算 ID")
+		return
+	}
+	if err := model.DeleteBudget(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
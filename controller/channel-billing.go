@@ -30,6 +30,8 @@ type OpenAISubscriptionResponse struct {
 	HardLimitUSD       float64 `json:"hard_limit_usd"`
 	SystemHardLimitUSD float64 `json:"system_hard_limit_usd"`
 	AccessUntil        int64   `json:"access_until"`
+	// 开启多币种展示时返回总额度在各币种下的金额
+	Amounts map[string]float64 `json:"amounts,omitempty"`
 }
 
 type OpenAIUsageDailyCost struct {
@@ -51,6 +53,8 @@ type OpenAIUsageResponse struct {
 	Object string `json:"object"`
 	//DailyCosts []OpenAIUsageDailyCost `json:"daily_costs"`
 	TotalUsage float64 `json:"total_usage"` // unit: 0.01 dollar
+	// 开启多币种展示时返回已用额度在各币种下的金额
+	Amounts map[string]float64 `json:"amounts,omitempty"`
 }
 
 type OpenAISBUsageResponse struct {
@@ -498,6 +502,9 @@ func UpdateAllChannelsBalance(c *gin.Context) {
 func AutomaticallyUpdateChannels(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Minute)
+		if !model.IsLeader() {
+			continue
+		}
 		common.SysLog("updating all channels")
 		_ = updateAllChannelsBalance()
 		common.SysLog("channels update done")
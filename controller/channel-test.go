@@ -651,7 +651,12 @@ var testAllChannelsLock sync.Mutex
 var testAllChannelsRunning bool = false
 
 func testAllChannels(notify bool) error {
+	return testChannelsInBackground(func() ([]*model.Channel, error) {
+		return model.GetAllChannels(0, 0, true, false)
+	}, notify)
+}
 
+func testChannelsInBackground(loadChannels func() ([]*model.Channel, error), notify bool) error {
 	testAllChannelsLock.Lock()
 	if testAllChannelsRunning {
 		testAllChannelsLock.Unlock()
@@ -659,8 +664,11 @@ func testAllChannels(notify bool) error {
 	}
 	testAllChannelsRunning = true
 	testAllChannelsLock.Unlock()
-	channels, getChannelErr := model.GetAllChannels(0, 0, true, false)
+	channels, getChannelErr := loadChannels()
 	if getChannelErr != nil {
+		testAllChannelsLock.Lock()
+		testAllChannelsRunning = false
+		testAllChannelsLock.Unlock()
 		return getChannelErr
 	}
 	var disableThreshold = int64(common.ChannelDisableThreshold * 1000)
@@ -731,6 +739,29 @@ func TestAllChannels(c *gin.Context) {
 	})
 }
 
+func TestTagChannels(c *gin.Context) {
+	channelTag := ChannelTag{}
+	err := c.ShouldBindJSON(&channelTag)
+	if err != nil || channelTag.Tag == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "参数错误",
+		})
+		return
+	}
+	err = testChannelsInBackground(func() ([]*model.Channel, error) {
+		return model.GetChannelsByTag(channelTag.Tag, false, true)
+	}, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
 var autoTestChannelsOnce sync.Once
 
 func AutomaticallyTestChannels() {
@@ -747,10 +778,12 @@ func AutomaticallyTestChannels() {
 			for {
 				frequency := operation_setting.GetMonitorSetting().AutoTestChannelMinutes
 				time.Sleep(time.Duration(int(math.Round(frequency))) * time.Minute)
-				common.SysLog(fmt.Sprintf("automatically test channels with interval %f minutes", frequency))
-				common.SysLog("automatically testing all channels")
-				_ = testAllChannels(false)
-				common.SysLog("automatically channel test finished")
+				if model.IsLeader() {
+					common.SysLog(fmt.Sprintf("automatically test channels with interval %f minutes", frequency))
+					common.SysLog("automatically testing all channels")
+					_ = testAllChannels(false)
+					common.SysLog("automatically channel test finished")
+				}
 				if !operation_setting.GetMonitorSetting().AutoTestChannelEnabled {
 					break
 				}
@@ -294,31 +294,7 @@ func FetchUpstreamModels(c *gin.Context) {
 		return
 	}
 
-	var url string
-	switch channel.Type {
-	case constant.ChannelTypeAli:
-		url = fmt.Sprintf("%s/compatible-mode/v1/models", baseURL)
-	case constant.ChannelTypeZhipu_v4:
-		if plan, ok := constant.ChannelSpecialBases[baseURL]; ok && plan.OpenAIBaseURL != "" {
-			url = fmt.Sprintf("%s/models", plan.OpenAIBaseURL)
-		} else {
-			url = fmt.Sprintf("%s/api/paas/v4/models", baseURL)
-		}
-	case constant.ChannelTypeVolcEngine:
-		if plan, ok := constant.ChannelSpecialBases[baseURL]; ok && plan.OpenAIBaseURL != "" {
-			url = fmt.Sprintf("%s/v1/models", plan.OpenAIBaseURL)
-		} else {
-			url = fmt.Sprintf("%s/v1/models", baseURL)
-		}
-	case constant.ChannelTypeMoonshot:
-		if plan, ok := constant.ChannelSpecialBases[baseURL]; ok && plan.OpenAIBaseURL != "" {
-			url = fmt.Sprintf("%s/models", plan.OpenAIBaseURL)
-		} else {
-			url = fmt.Sprintf("%s/v1/models", baseURL)
-		}
-	default:
-		url = fmt.Sprintf("%s/v1/models", baseURL)
-	}
+	url := getChannelUpstreamModelsURL(channel, baseURL)
 
 	// 获取用于请求的可用密钥（多密钥渠道优先使用启用状态的密钥）
 	key, _, apiErr := channel.GetNextEnabledKey()
@@ -368,6 +344,30 @@ func FetchUpstreamModels(c *gin.Context) {
 	})
 }
 
+func getChannelUpstreamModelsURL(channel *model.Channel, baseURL string) string {
+	switch channel.Type {
+	case constant.ChannelTypeAli:
+		return fmt.Sprintf("%s/compatible-mode/v1/models", baseURL)
+	case constant.ChannelTypeZhipu_v4:
+		if plan, ok := constant.ChannelSpecialBases[baseURL]; ok && plan.OpenAIBaseURL != "" {
+			return fmt.Sprintf("%s/models", plan.OpenAIBaseURL)
+		}
+		return fmt.Sprintf("%s/api/paas/v4/models", baseURL)
+	case constant.ChannelTypeVolcEngine:
+		if plan, ok := constant.ChannelSpecialBases[baseURL]; ok && plan.OpenAIBaseURL != "" {
+			return fmt.Sprintf("%s/v1/models", plan.OpenAIBaseURL)
+		}
+		return fmt.Sprintf("%s/v1/models", baseURL)
+	case constant.ChannelTypeMoonshot:
+		if plan, ok := constant.ChannelSpecialBases[baseURL]; ok && plan.OpenAIBaseURL != "" {
+			return fmt.Sprintf("%s/models", plan.OpenAIBaseURL)
+		}
+		return fmt.Sprintf("%s/v1/models", baseURL)
+	default:
+		return fmt.Sprintf("%s/v1/models", baseURL)
+	}
+}
+
 func FixChannelsAbilities(c *gin.Context) {
 	success, fails, err := model.FixAbility()
 	if err != nil {
@@ -578,9 +578,13 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 		return fmt.Errorf("渠道额外设置[channel setting] 格式错误：%s", err.Error())
 	}
 
+	if percent := channel.GetCanaryPercent(); percent < 0 || percent > 100 {
+		return fmt.Errorf("灰度流量比例必须在 0 到 100 之间")
+	}
+
 	// 如果是添加操作，检查 channel 和 key 是否为空
 	if isAdd {
-		if channel == nil || channel.Key == "" {
+		if channel == nil || (channel.Key == "" && !constant.ChannelTypeAllowEmptyKey(channel.Type)) {
 			return fmt.Errorf("channel cannot be empty")
 		}
 
@@ -592,19 +596,16 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 		}
 	}
 
-	// VertexAI 特殊校验
-	if channel.Type == constant.ChannelTypeVertexAi {
-		if channel.Other == "" {
-			return fmt.Errorf("部署地区不能为空")
-		}
-
+	// VertexAI 特殊校验：部署地区可以为空或不含 default，此时使用 global 端点，与 vertex.GetModelRegion 一致
+	if channel.Type == constant.ChannelTypeVertexAi && strings.HasPrefix(strings.TrimSpace(channel.Other), "{") {
 		regionMap, err := common.StrToMap(channel.Other)
 		if err != nil {
 			return fmt.Errorf("部署地区必须是标准的Json格式，例如{\"default\": \"us-central1\", \"region2\": \"us-east1\"}")
 		}
-
-		if regionMap["default"] == nil {
-			return fmt.Errorf("部署地区必须包含default字段")
+		for model, region := range regionMap {
+			if _, ok := region.(string); !ok {
+				return fmt.Errorf("部署地区 %s 必须是字符串", model)
+			}
 		}
 	}
 
@@ -774,8 +775,10 @@ func AddChannel(c *gin.Context) {
 	}
 
 	channels := make([]model.Channel, 0, len(keys))
+	// 允许无密钥的渠道类型仅在单个空密钥时创建渠道
+	allowEmptyKey := len(keys) == 1 && constant.ChannelTypeAllowEmptyKey(addChannelRequest.Channel.Type)
 	for _, key := range keys {
-		if key == "" {
+		if key == "" && !allowEmptyKey {
 			continue
 		}
 		localChannel := addChannelRequest.Channel
@@ -810,7 +813,7 @@ func DeleteChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -824,7 +827,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -855,12 +858,20 @@ func DisableTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	tagChannels, err := model.GetChannelsByTag(channelTag.Tag, false, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	err = model.DisableChannelByTag(channelTag.Tag)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	for _, tagChannel := range tagChannels {
+		recordManualChannelStatusChange(c, tagChannel.Id, tagChannel.Status, common.ChannelStatusManuallyDisabled, -1, model.ChannelStatusTriggerTag, "tag: "+channelTag.Tag)
+	}
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -878,12 +889,20 @@ func EnableTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	tagChannels, err := model.GetChannelsByTag(channelTag.Tag, false, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	err = model.EnableChannelByTag(channelTag.Tag)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	for _, tagChannel := range tagChannels {
+		recordManualChannelStatusChange(c, tagChannel.Id, tagChannel.Status, common.ChannelStatusEnabled, -1, model.ChannelStatusTriggerTag, "tag: "+channelTag.Tag)
+	}
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -935,7 +954,7 @@ func EditTagChannels(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -943,6 +962,28 @@ func EditTagChannels(c *gin.Context) {
 	return
 }
 
+func SetTagChannelsPriority(c *gin.Context) {
+	channelTag := ChannelTag{}
+	err := c.ShouldBindJSON(&channelTag)
+	if err != nil || channelTag.Tag == "" || channelTag.Priority == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "参数错误",
+		})
+		return
+	}
+	err = model.EditChannelByTag(channelTag.Tag, nil, nil, nil, nil, channelTag.Priority, nil, nil, nil)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RefreshChannelCache()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
 type ChannelBatch struct {
 	Ids []int   `json:"ids"`
 	Tag *string `json:"tag"`
@@ -963,7 +1004,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -1097,7 +1138,10 @@ func UpdateChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	if channel.Status != 0 {
+		recordManualChannelStatusChange(c, channel.Id, originChannel.Status, channel.Status, -1, model.ChannelStatusTriggerManual, "")
+	}
+	model.RefreshChannelCache()
 	service.ResetProxyClientCache()
 	channel.Key = ""
 	clearChannelInfo(&channel.Channel)
@@ -1244,7 +1288,7 @@ func BatchSetChannelTag(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -1341,7 +1385,7 @@ func CopyChannel(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "复制渠道失败，请稍后重试"})
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	// success
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"id": clone.Id}})
 }
@@ -1550,6 +1594,10 @@ func ManageMultiKeys(c *gin.Context) {
 			channel.ChannelInfo.MultiKeyDisabledReason = make(map[int]string)
 		}
 
+		previousKeyStatus := common.ChannelStatusEnabled
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[keyIndex]; ok {
+			previousKeyStatus = status
+		}
 		channel.ChannelInfo.MultiKeyStatusList[keyIndex] = 2 // disabled
 
 		err = channel.Update()
@@ -1557,8 +1605,9 @@ func ManageMultiKeys(c *gin.Context) {
 			common.ApiError(c, err)
 			return
 		}
+		recordManualChannelStatusChange(c, channel.Id, previousKeyStatus, common.ChannelStatusManuallyDisabled, keyIndex, model.ChannelStatusTriggerMultiKey, "")
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "密钥已禁用",
@@ -1583,6 +1632,10 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
+		previousKeyStatus := common.ChannelStatusEnabled
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[keyIndex]; ok {
+			previousKeyStatus = status
+		}
 		// 从状态列表中删除该密钥的记录，使其回到默认启用状态
 		if channel.ChannelInfo.MultiKeyStatusList != nil {
 			delete(channel.ChannelInfo.MultiKeyStatusList, keyIndex)
@@ -1599,8 +1652,9 @@ func ManageMultiKeys(c *gin.Context) {
 			common.ApiError(c, err)
 			return
 		}
+		recordManualChannelStatusChange(c, channel.Id, previousKeyStatus, common.ChannelStatusEnabled, keyIndex, model.ChannelStatusTriggerMultiKey, "")
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "密钥已启用",
@@ -1609,10 +1663,8 @@ func ManageMultiKeys(c *gin.Context) {
 
 	case "enable_all_keys":
 		// 清空所有禁用状态，使所有密钥回到默认启用状态
-		var enabledCount int
-		if channel.ChannelInfo.MultiKeyStatusList != nil {
-			enabledCount = len(channel.ChannelInfo.MultiKeyStatusList)
-		}
+		previousKeyStatuses := channel.ChannelInfo.MultiKeyStatusList
+		enabledCount := len(previousKeyStatuses)
 
 		channel.ChannelInfo.MultiKeyStatusList = make(map[int]int)
 		channel.ChannelInfo.MultiKeyDisabledTime = make(map[int]int64)
@@ -1623,8 +1675,11 @@ func ManageMultiKeys(c *gin.Context) {
 			common.ApiError(c, err)
 			return
 		}
+		for keyIndex, previousKeyStatus := range previousKeyStatuses {
+			recordManualChannelStatusChange(c, channel.Id, previousKeyStatus, common.ChannelStatusEnabled, keyIndex, model.ChannelStatusTriggerMultiKey, "")
+		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": fmt.Sprintf("已启用 %d 个密钥", enabledCount),
@@ -1643,7 +1698,7 @@ func ManageMultiKeys(c *gin.Context) {
 			channel.ChannelInfo.MultiKeyDisabledReason = make(map[int]string)
 		}
 
-		var disabledCount int
+		var disabledKeys []int
 		for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
 			status := 1 // default enabled
 			if s, exists := channel.ChannelInfo.MultiKeyStatusList[i]; exists {
@@ -1653,11 +1708,11 @@ func ManageMultiKeys(c *gin.Context) {
 			// 只禁用当前启用的密钥
 			if status == 1 {
 				channel.ChannelInfo.MultiKeyStatusList[i] = 2 // disabled
-				disabledCount++
+				disabledKeys = append(disabledKeys, i)
 			}
 		}
 
-		if disabledCount == 0 {
+		if len(disabledKeys) == 0 {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
 				"message": "没有可禁用的密钥",
@@ -1670,11 +1725,14 @@ func ManageMultiKeys(c *gin.Context) {
 			common.ApiError(c, err)
 			return
 		}
+		for _, keyIndex := range disabledKeys {
+			recordManualChannelStatusChange(c, channel.Id, common.ChannelStatusEnabled, common.ChannelStatusManuallyDisabled, keyIndex, model.ChannelStatusTriggerMultiKey, "")
+		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
-			"message": fmt.Sprintf("已禁用 %d 个密钥", disabledCount),
+			"message": fmt.Sprintf("已禁用 %d 个密钥", len(disabledKeys)),
 		})
 		return
 
@@ -1751,7 +1809,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "密钥已删除",
@@ -1819,7 +1877,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": fmt.Sprintf("已删除 %d 个自动禁用的密钥", deletedCount),
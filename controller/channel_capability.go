@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelCapabilities 列出渠道登记的能力，包括管理员设置与自动识别的记录
+func GetChannelCapabilities(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	capabilities, err := model.GetChannelCapabilities(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, capabilities)
+}
+
+// SaveChannelCapability 设置渠道在某个模型上的能力，model_name 为空或 * 时对渠道下所有模型生效
+func SaveChannelCapability(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	capability := model.ChannelCapability{}
+	if err := c.ShouldBindJSON(&capability); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if capability.MaxContext < 0 {
+		common.ApiErrorMsg(c, "最大上下文不能为负数")
+		return
+	}
+	if _, err := model.GetChannelById(id, false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	capability.ChannelId = id
+	if err := model.SaveChannelCapability(&capability); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, capability)
+}
+
+func DeleteChannelCapability(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	capabilityId, err := strconv.Atoi(c.Param("capability_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteChannelCapability(id, capabilityId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
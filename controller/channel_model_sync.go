@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel/gemini"
+	"github.com/QuantumNous/new-api/relay/channel/ollama"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChannelModelSyncResult struct {
+	ChannelId   int      `json:"channel_id"`
+	ChannelName string   `json:"channel_name"`
+	Mode        string   `json:"mode"`
+	Added       []string `json:"added"`
+	Removed     []string `json:"removed"`
+	Applied     bool     `json:"applied"`
+	Error       string   `json:"error,omitempty"`
+}
+
+func (r *ChannelModelSyncResult) changed() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0
+}
+
+// fetchChannelUpstreamModelIDs 拉取渠道上游的模型 ID 列表
+func fetchChannelUpstreamModelIDs(channel *model.Channel) ([]string, error) {
+	baseURL := constant.ChannelBaseURLs[channel.Type]
+	if channel.GetBaseURL() != "" {
+		baseURL = channel.GetBaseURL()
+	}
+
+	if channel.Type == constant.ChannelTypeOllama {
+		key := strings.Split(channel.Key, "\n")[0]
+		models, err := ollama.FetchOllamaModels(baseURL, key)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(models))
+		for _, modelInfo := range models {
+			ids = append(ids, modelInfo.Name)
+		}
+		return ids, nil
+	}
+
+	key, _, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	key = strings.TrimSpace(key)
+
+	if channel.Type == constant.ChannelTypeGemini {
+		return gemini.FetchGeminiModels(baseURL, key, channel.GetSetting().Proxy)
+	}
+
+	headers, err := buildFetchModelsHeaders(channel, key)
+	if err != nil {
+		return nil, err
+	}
+	body, err := GetResponseBody("GET", getChannelUpstreamModelsURL(channel, baseURL), channel, headers)
+	if err != nil {
+		return nil, err
+	}
+	var result OpenAIModelsResponse
+	if err = common.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %s", err.Error())
+	}
+	ids := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+// diffChannelModels 根据同步策略计算需要添加与移除的模型
+func diffChannelModels(current []string, upstream []string, mode dto.UpstreamModelSyncMode) (added []string, removed []string) {
+	currentSet := make(map[string]struct{}, len(current))
+	for _, m := range current {
+		currentSet[m] = struct{}{}
+	}
+	upstreamSet := make(map[string]struct{}, len(upstream))
+	for _, m := range upstream {
+		upstreamSet[m] = struct{}{}
+	}
+	if mode == dto.UpstreamModelSyncModeAddOnly || mode == dto.UpstreamModelSyncModeFull {
+		for _, m := range upstream {
+			if _, ok := currentSet[m]; !ok {
+				added = append(added, m)
+				currentSet[m] = struct{}{}
+			}
+		}
+	}
+	if mode == dto.UpstreamModelSyncModeRemoveOnly || mode == dto.UpstreamModelSyncModeFull {
+		for _, m := range current {
+			if _, ok := upstreamSet[m]; !ok {
+				removed = append(removed, m)
+			}
+		}
+	}
+	return added, removed
+}
+
+func syncChannelUpstreamModels(channel *model.Channel, mode dto.UpstreamModelSyncMode, dryRun bool) ChannelModelSyncResult {
+	result := ChannelModelSyncResult{
+		ChannelId:   channel.Id,
+		ChannelName: channel.Name,
+		Mode:        string(mode),
+		Added:       []string{},
+		Removed:     []string{},
+	}
+	upstream, err := fetchChannelUpstreamModelIDs(channel)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(upstream) == 0 {
+		result.Error = "上游返回的模型列表为空"
+		return result
+	}
+	current := channel.GetModels()
+	added, removed := diffChannelModels(current, upstream, mode)
+	if added != nil {
+		result.Added = added
+	}
+	if removed != nil {
+		result.Removed = removed
+	}
+	if dryRun || !result.changed() {
+		return result
+	}
+
+	removedSet := make(map[string]struct{}, len(removed))
+	for _, m := range removed {
+		removedSet[m] = struct{}{}
+	}
+	models := make([]string, 0, len(current)+len(added))
+	for _, m := range current {
+		if _, ok := removedSet[m]; !ok {
+			models = append(models, m)
+		}
+	}
+	models = append(models, added...)
+	if len(models) == 0 {
+		result.Error = "同步后模型列表为空，已跳过"
+		return result
+	}
+	channel.Models = strings.Join(models, ",")
+	if err := channel.Update(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Applied = true
+	return result
+}
+
+func notifyChannelModelSyncResults(results []ChannelModelSyncResult) {
+	var builder strings.Builder
+	changed := 0
+	for _, r := range results {
+		if !r.Applied {
+			continue
+		}
+		changed++
+		builder.WriteString(fmt.Sprintf("通道「%s」（#%d）新增：%s；移除：%s\n",
+			r.ChannelName, r.ChannelId, strings.Join(r.Added, ","), strings.Join(r.Removed, ",")))
+	}
+	if changed == 0 {
+		return
+	}
+	subject := fmt.Sprintf("%d 个通道的模型列表已与上游同步", changed)
+	service.NotifyRootUser(dto.NotifyTypeChannelUpdate+"_model_sync", subject, builder.String())
+}
+
+var channelModelSyncLock sync.Mutex
+
+func syncAllChannelUpstreamModels(dryRun bool) ([]ChannelModelSyncResult, error) {
+	if !channelModelSyncLock.TryLock() {
+		return nil, errors.New("模型同步已在运行中")
+	}
+	defer channelModelSyncLock.Unlock()
+
+	channels, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ChannelModelSyncResult, 0)
+	for _, channel := range channels {
+		mode := channel.GetOtherSettings().UpstreamModelSyncMode
+		if mode == dto.UpstreamModelSyncModeOff || channel.Status != common.ChannelStatusEnabled {
+			continue
+		}
+		results = append(results, syncChannelUpstreamModels(channel, mode, dryRun))
+		time.Sleep(common.RequestInterval)
+	}
+	if !dryRun {
+		model.InitChannelCache()
+		notifyChannelModelSyncResults(results)
+	}
+	return results, nil
+}
+
+// SyncChannelUpstreamModels 手动同步单个渠道，未配置策略时可通过 mode 参数指定
+func SyncChannelUpstreamModels(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	mode := dto.UpstreamModelSyncMode(c.Query("mode"))
+	if mode == dto.UpstreamModelSyncModeOff {
+		mode = channel.GetOtherSettings().UpstreamModelSyncMode
+	}
+	switch mode {
+	case dto.UpstreamModelSyncModeAddOnly, dto.UpstreamModelSyncModeRemoveOnly, dto.UpstreamModelSyncModeFull:
+	default:
+		common.ApiErrorMsg(c, "未配置有效的模型同步策略")
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+	result := syncChannelUpstreamModels(channel, mode, dryRun)
+	if result.Applied {
+		model.InitChannelCache()
+		notifyChannelModelSyncResults([]ChannelModelSyncResult{result})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": result.Error == "",
+		"message": result.Error,
+		"data":    result,
+	})
+}
+
+func SyncAllChannelUpstreamModels(c *gin.Context) {
+	results, err := syncAllChannelUpstreamModels(c.Query("dry_run") == "true")
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, results)
+}
+
+var autoSyncChannelModelsOnce sync.Once
+
+func AutomaticallySyncChannelModels() {
+	// 只在Master节点定时同步
+	if !common.IsMasterNode {
+		return
+	}
+	autoSyncChannelModelsOnce.Do(func() {
+		for {
+			setting := operation_setting.GetMonitorSetting()
+			if !setting.UpstreamModelSyncEnabled || setting.UpstreamModelSyncMinutes <= 0 {
+				time.Sleep(1 * time.Minute)
+				continue
+			}
+			// 间隔至少 1 分钟，避免过小的配置舍入为 0 后持续请求上游
+			time.Sleep(time.Duration(max(int(math.Round(setting.UpstreamModelSyncMinutes)), 1)) * time.Minute)
+			if !model.IsLeader() {
+				continue
+			}
+			common.SysLog("automatically syncing channel models from upstream")
+			if _, err := syncAllChannelUpstreamModels(false); err != nil {
+				common.SysLog("failed to sync channel models: " + err.Error())
+			}
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type channelProxyTestRequest struct {
+	ChannelId int    `json:"channel_id"`
+	Type      int    `json:"type"`
+	Proxy     string `json:"proxy"`
+	URL       string `json:"url"`
+}
+
+// TestChannelProxy 测试代理是否可用以及能否经代理访问渠道地址。
+// 未填写的代理与地址从已保存的渠道中读取，便于在编辑渠道时先测试再保存
+func TestChannelProxy(c *gin.Context) {
+	var req channelProxyTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.ChannelId > 0 && (req.Proxy == "" || req.URL == "") {
+		channel, err := model.GetChannelById(req.ChannelId, false)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if req.Proxy == "" {
+			req.Proxy = channel.GetSetting().Proxy
+		}
+		if req.URL == "" {
+			req.URL = channel.GetBaseURL()
+		}
+		if req.Type == 0 {
+			req.Type = channel.Type
+		}
+	}
+	if req.URL == "" && req.Type > 0 && req.Type < len(constant.ChannelBaseURLs) {
+		req.URL = constant.ChannelBaseURLs[req.Type]
+	}
+	if req.Proxy == "" {
+		common.ApiError(c, errors.New("未配置代理地址"))
+		return
+	}
+	if req.URL == "" {
+		common.ApiError(c, errors.New("未配置测试地址"))
+		return
+	}
+	common.ApiSuccess(c, service.TestProxyConnectivity(c.Request.Context(), req.Proxy, req.URL))
+}
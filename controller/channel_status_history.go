@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetChannelStatusHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	filter := model.ChannelStatusHistoryFilter{
+		TriggerType: c.Query("trigger_type"),
+	}
+	filter.ToStatus, _ = strconv.Atoi(c.Query("to_status"))
+	filter.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	filter.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+
+	histories, total, err := model.GetChannelStatusHistory(id, filter, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(histories)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// recordManualChannelStatusChange 记录管理员手动触发的渠道状态变更
+func recordManualChannelStatusChange(c *gin.Context, channelId int, fromStatus int, toStatus int, keyIndex int, triggerType string, reason string) {
+	if fromStatus == toStatus {
+		return
+	}
+	service.RecordChannelStatusChange(&model.ChannelStatusHistory{
+		ChannelId:    channelId,
+		FromStatus:   fromStatus,
+		ToStatus:     toStatus,
+		KeyIndex:     keyIndex,
+		TriggerType:  triggerType,
+		OperatorId:   c.GetInt("id"),
+		OperatorName: c.GetString("username"),
+		Reason:       reason,
+	})
+}
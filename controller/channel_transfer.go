@@ -0,0 +1,374 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	channelImportConflictSkip      = "skip"
+	channelImportConflictOverwrite = "overwrite"
+	channelImportConflictDuplicate = "duplicate"
+)
+
+var channelCSVHeader = []string{
+	"id", "name", "type", "key", "status", "base_url", "models", "group", "model_mapping",
+	"priority", "weight", "tag", "auto_ban", "test_model", "status_code_mapping", "setting",
+	"settings", "param_override", "header_override", "remark", "other", "openai_organization", "channel_info",
+}
+
+type ChannelImportRequest struct {
+	Format           string `json:"format"` // json, csv
+	Data             string `json:"data"`
+	DryRun           bool   `json:"dry_run"`
+	ConflictStrategy string `json:"conflict_strategy"` // skip, overwrite, duplicate
+}
+
+type ChannelImportItemResult struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Action string `json:"action"` // created, updated, skipped, failed
+	Id     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ChannelImportSummary struct {
+	DryRun  bool                      `json:"dry_run"`
+	Total   int                       `json:"total"`
+	Created int                       `json:"created"`
+	Updated int                       `json:"updated"`
+	Skipped int                       `json:"skipped"`
+	Failed  int                       `json:"failed"`
+	Items   []ChannelImportItemResult `json:"items"`
+}
+
+func ExportChannels(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	redactKey := c.DefaultQuery("redact_key", "true") != "false"
+	// 导出明文密钥与查看单个渠道密钥一样需要先完成安全验证
+	if !redactKey && !c.GetBool("secure_verified") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "导出渠道密钥需要安全验证",
+			"code":    "VERIFICATION_REQUIRED",
+		})
+		return
+	}
+
+	channels, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if redactKey {
+		for _, channel := range channels {
+			channel.Key = ""
+		}
+	}
+
+	filename := fmt.Sprintf("channels-%s.%s", time.Now().Format("20060102150405"), format)
+	switch format {
+	case "json":
+		data, err := common.Marshal(channels)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+	case "csv":
+		data, err := channelsToCSV(channels)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	default:
+		common.ApiErrorMsg(c, "不支持的导出格式: "+format)
+	}
+}
+
+func ImportChannels(c *gin.Context) {
+	req := ChannelImportRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.ConflictStrategy == "" {
+		req.ConflictStrategy = channelImportConflictSkip
+	}
+	switch req.ConflictStrategy {
+	case channelImportConflictSkip, channelImportConflictOverwrite, channelImportConflictDuplicate:
+	default:
+		common.ApiErrorMsg(c, "无效的冲突策略: "+req.ConflictStrategy)
+		return
+	}
+
+	var channels []*model.Channel
+	var err error
+	switch strings.ToLower(req.Format) {
+	case "", "json":
+		err = common.UnmarshalJsonStr(req.Data, &channels)
+	case "csv":
+		channels, err = channelsFromCSV(req.Data)
+	default:
+		err = errors.New("不支持的导入格式: " + req.Format)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	existing, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	existingByName := make(map[string]*model.Channel, len(existing))
+	for _, channel := range existing {
+		existingByName[channelImportConflictKey(channel)] = channel
+	}
+
+	summary := ChannelImportSummary{DryRun: req.DryRun, Total: len(channels), Items: make([]ChannelImportItemResult, 0, len(channels))}
+	for i, channel := range channels {
+		result := importChannel(channel, existingByName, req.ConflictStrategy, req.DryRun)
+		result.Index = i
+		switch result.Action {
+		case "created":
+			summary.Created++
+		case "updated":
+			summary.Updated++
+		case "skipped":
+			summary.Skipped++
+		default:
+			summary.Failed++
+		}
+		summary.Items = append(summary.Items, result)
+	}
+	if !req.DryRun && summary.Created+summary.Updated > 0 {
+		model.InitChannelCache()
+		service.ResetProxyClientCache()
+	}
+	common.ApiSuccess(c, summary)
+}
+
+// channelImportConflictKey 以类型和名称识别同一渠道，便于跨实例迁移
+func channelImportConflictKey(channel *model.Channel) string {
+	return strconv.Itoa(channel.Type) + ":" + channel.Name
+}
+
+func importChannel(channel *model.Channel, existingByName map[string]*model.Channel, strategy string, dryRun bool) ChannelImportItemResult {
+	result := ChannelImportItemResult{}
+	fail := func(err error) ChannelImportItemResult {
+		result.Action = "failed"
+		result.Error = err.Error()
+		return result
+	}
+	if channel == nil || channel.Name == "" {
+		return fail(errors.New("渠道名称不能为空"))
+	}
+	result.Name = channel.Name
+
+	origin, conflict := existingByName[channelImportConflictKey(channel)]
+	if conflict && strategy == channelImportConflictSkip {
+		result.Action = "skipped"
+		result.Id = origin.Id
+		return result
+	}
+
+	if conflict && strategy == channelImportConflictOverwrite {
+		channel.Id = origin.Id
+		channel.ChannelInfo.IsMultiKey = origin.ChannelInfo.IsMultiKey
+		if err := validateChannel(channel, false); err != nil {
+			return fail(err)
+		}
+		result.Action = "updated"
+		result.Id = origin.Id
+		if dryRun {
+			return result
+		}
+		// 导出时 key 已脱敏则保留原 key
+		if channel.Key == "" {
+			channel.Key = origin.Key
+		}
+		if err := channel.Update(); err != nil {
+			return fail(err)
+		}
+		return result
+	}
+
+	channel.Id = 0
+	channel.CreatedTime = common.GetTimestamp()
+	channel.UsedQuota = 0
+	if err := validateChannel(channel, true); err != nil {
+		return fail(err)
+	}
+	result.Action = "created"
+	if dryRun {
+		return result
+	}
+	if err := channel.Insert(); err != nil {
+		return fail(err)
+	}
+	result.Id = channel.Id
+	existingByName[channelImportConflictKey(channel)] = channel
+	return result
+}
+
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func channelsToCSV(channels []*model.Channel) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	if err := writer.Write(channelCSVHeader); err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		channelInfo, err := common.Marshal(channel.ChannelInfo)
+		if err != nil {
+			return nil, err
+		}
+		record := []string{
+			strconv.Itoa(channel.Id),
+			channel.Name,
+			strconv.Itoa(channel.Type),
+			channel.Key,
+			strconv.Itoa(channel.Status),
+			optionalString(channel.BaseURL),
+			channel.Models,
+			channel.Group,
+			optionalString(channel.ModelMapping),
+			strconv.FormatInt(channel.GetPriority(), 10),
+			strconv.Itoa(channel.GetWeight()),
+			channel.GetTag(),
+			strconv.FormatBool(channel.GetAutoBan()),
+			optionalString(channel.TestModel),
+			channel.GetStatusCodeMapping(),
+			optionalString(channel.Setting),
+			channel.OtherSettings,
+			optionalString(channel.ParamOverride),
+			optionalString(channel.HeaderOverride),
+			optionalString(channel.Remark),
+			channel.Other,
+			optionalString(channel.OpenAIOrganization),
+			string(channelInfo),
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func channelsFromCSV(data string) ([]*model.Channel, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"name", "type"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV 缺少必填列: %s", required)
+		}
+	}
+
+	channels := make([]*model.Channel, 0, len(records)-1)
+	for line, record := range records[1:] {
+		get := func(name string) string {
+			if idx, ok := columns[name]; ok && idx < len(record) {
+				return record[idx]
+			}
+			return ""
+		}
+		optional := func(name string) *string {
+			if _, ok := columns[name]; !ok {
+				return nil
+			}
+			value := get(name)
+			return &value
+		}
+		channel := &model.Channel{
+			Name:               get("name"),
+			Key:                get("key"),
+			Models:             get("models"),
+			Group:              get("group"),
+			OtherSettings:      get("settings"),
+			Other:              get("other"),
+			BaseURL:            optional("base_url"),
+			ModelMapping:       optional("model_mapping"),
+			TestModel:          optional("test_model"),
+			StatusCodeMapping:  optional("status_code_mapping"),
+			Setting:            optional("setting"),
+			ParamOverride:      optional("param_override"),
+			HeaderOverride:     optional("header_override"),
+			Remark:             optional("remark"),
+			OpenAIOrganization: optional("openai_organization"),
+		}
+		if channel.Type, err = strconv.Atoi(get("type")); err != nil {
+			return nil, fmt.Errorf("第 %d 行 type 无效: %s", line+2, get("type"))
+		}
+		if v := get("status"); v != "" {
+			if channel.Status, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("第 %d 行 status 无效: %s", line+2, v)
+			}
+		}
+		if v := get("priority"); v != "" {
+			priority, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 行 priority 无效: %s", line+2, v)
+			}
+			channel.Priority = &priority
+		}
+		if v := get("weight"); v != "" {
+			weight, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 行 weight 无效: %s", line+2, v)
+			}
+			w := uint(weight)
+			channel.Weight = &w
+		}
+		if v := get("auto_ban"); v != "" {
+			autoBan := 0
+			if b, _ := strconv.ParseBool(v); b {
+				autoBan = 1
+			}
+			channel.AutoBan = &autoBan
+		}
+		if tag := get("tag"); tag != "" {
+			channel.SetTag(tag)
+		}
+		if v := get("channel_info"); v != "" {
+			if err := common.UnmarshalJsonStr(v, &channel.ChannelInfo); err != nil {
+				return nil, fmt.Errorf("第 %d 行 channel_info 无效: %s", line+2, err.Error())
+			}
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
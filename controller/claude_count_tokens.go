@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// claudeImageTokenEstimate Anthropic 文档中单张图片的典型 token 上限（约 1.15 megapixels）
+const claudeImageTokenEstimate = 1600
+
+func abortWithClaudeMessage(c *gin.Context, statusCode int, errorType string, message string) {
+	c.JSON(statusCode, gin.H{
+		"type": "error",
+		"error": types.ClaudeError{
+			Type:    errorType,
+			Message: message,
+		},
+	})
+}
+
+// ClaudeCountTokens 兼容 Anthropic /v1/messages/count_tokens，本地估算输入 token 数，不选择渠道也不计费
+func ClaudeCountTokens(c *gin.Context) {
+	request := &dto.ClaudeRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		abortWithClaudeMessage(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if request.Model == "" {
+		abortWithClaudeMessage(c, http.StatusBadRequest, "invalid_request_error", "model: Field required")
+		return
+	}
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		tokenModelLimit, _ := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
+		limits, _ := tokenModelLimit.(map[string]bool)
+		if _, ok := limits[ratio_setting.FormatMatchingModelName(request.Model)]; !ok {
+			abortWithClaudeMessage(c, http.StatusForbidden, "permission_error", "该令牌无权访问模型 "+request.Model)
+			return
+		}
+	}
+
+	meta := request.GetTokenCountMeta()
+	inputTokens := service.CountTextToken(meta.CombineText, request.Model)
+	for _, file := range meta.Files {
+		if file.FileType == types.FileTypeImage {
+			inputTokens += claudeImageTokenEstimate
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"input_tokens": inputTokens,
+	})
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	reconciliationMaxFileSize      = 20 << 20
+	reconciliationDefaultThreshold = 5
+)
+
+// ReconcileChannelCost 上传服务商账单导出（multipart 字段 file），与渠道的消费日志按模型对账，
+// 差额比例超过 threshold（百分比）的模型会被标记；format=csv 时导出报告
+func ReconcileChannelCost(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	provider := strings.ToLower(strings.TrimSpace(c.PostForm("provider")))
+	threshold := float64(reconciliationDefaultThreshold)
+	if value := c.PostForm("threshold"); value != "" {
+		threshold, err = strconv.ParseFloat(value, 64)
+		if err != nil || threshold < 0 {
+			common.ApiErrorMsg(c, "无效的阈值")
+			return
+		}
+	}
+	start, _ := strconv.ParseInt(c.PostForm("start_timestamp"), 10, 64)
+	end, _ := strconv.ParseInt(c.PostForm("end_timestamp"), 10, 64)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		common.ApiErrorMsg(c, "请上传账单导出文件")
+		return
+	}
+	if fileHeader.Size > reconciliationMaxFileSize {
+		common.ApiErrorMsg(c, "账单文件不能超过 20 MB")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	defer file.Close()
+	rows, skipped, err := service.ParseUpstreamCostExport(provider, file)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	report, err := service.ReconcileChannelCost(channel, provider, rows, skipped, start, end, threshold)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if c.Query("format") != "csv" {
+		common.ApiSuccess(c, report)
+		return
+	}
+	data, err := service.ReconciliationCSV(report)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=reconciliation-%d-%s.csv", channel.Id, provider))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
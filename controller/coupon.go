@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const couponCodeLength = 12
+
+func GetCoupons(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	coupons, total, err := model.SearchCoupons(c.Query("keyword"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(coupons)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetCoupon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	coupon, err := model.GetCouponById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, coupon)
+}
+
+// AddCoupons 批量生成优惠券，只生成一张时可以指定券码
+func AddCoupons(c *gin.Context) {
+	req := model.Coupon{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Count <= 0 || req.Count > 1000 {
+		common.ApiErrorMsg(c, "生成数量必须在 1 到 1000 之间")
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code != "" && req.Count != 1 {
+		common.ApiErrorMsg(c, "指定券码时只能生成一张")
+		return
+	}
+	if len(req.Code) > 32 {
+		common.ApiErrorMsg(c, "券码长度不能超过 32 个字符")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	codes := make([]string, 0, req.Count)
+	for i := 0; i < req.Count; i++ {
+		code := req.Code
+		if code == "" {
+			key, err := common.GenerateRandomCharsKey(couponCodeLength)
+			if err != nil {
+				common.ApiError(c, err)
+				return
+			}
+			code = strings.ToUpper(key)
+		}
+		coupon := model.Coupon{
+			Code:         code,
+			Name:         req.Name,
+			Status:       common.CouponStatusEnabled,
+			BonusType:    req.BonusType,
+			BonusValue:   req.BonusValue,
+			MaxBonus:     req.MaxBonus,
+			MinTopUp:     req.MinTopUp,
+			PerUserLimit: req.PerUserLimit,
+			TotalLimit:   req.TotalLimit,
+			NewUserOnly:  req.NewUserOnly,
+			ExpiredTime:  req.ExpiredTime,
+			CreatedTime:  common.GetTimestamp(),
+		}
+		if err := coupon.Insert(); err != nil {
+			common.SysError("failed to insert coupon: " + err.Error())
+			c.JSON(200, gin.H{
+				"success": false,
+				"message": "优惠券创建失败，券码可能已存在",
+				"data":    codes,
+			})
+			return
+		}
+		codes = append(codes, code)
+	}
+	common.ApiSuccess(c, codes)
+}
+
+func UpdateCoupon(c *gin.Context) {
+	req := model.Coupon{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	coupon, err := model.GetCouponById(req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if c.Query("status_only") != "" {
+		coupon.Status = req.Status
+	} else {
+		// If you add more fields, please also update coupon.Update()
+		coupon.Name = req.Name
+		coupon.BonusType = req.BonusType
+		coupon.BonusValue = req.BonusValue
+		coupon.MaxBonus = req.MaxBonus
+		coupon.MinTopUp = req.MinTopUp
+		coupon.PerUserLimit = req.PerUserLimit
+		coupon.TotalLimit = req.TotalLimit
+		coupon.NewUserOnly = req.NewUserOnly
+		coupon.ExpiredTime = req.ExpiredTime
+		if err = coupon.Validate(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if err = coupon.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, coupon)
+}
+
+func DeleteCoupon(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteCouponById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetCouponUsages 优惠券使用明细，可按 coupon_id、user_id 筛选
+func GetCouponUsages(c *gin.Context) {
+	couponId, _ := strconv.Atoi(c.Query("coupon_id"))
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	pageInfo := common.GetPageQuery(c)
+	usages, total, err := model.GetCouponUsages(couponId, userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(usages)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetCouponReports(c *gin.Context) {
+	reports, err := model.GetCouponReports()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, reports)
+}
@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FetchExchangeRates 立即从配置的地址拉取一次汇率
+func FetchExchangeRates(c *gin.Context) {
+	rates, err := service.FetchExchangeRates()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, rates)
+}
@@ -26,8 +26,13 @@ type CustomOAuthProviderResponse struct {
 	UsernameField         string `json:"username_field"`
 	DisplayNameField      string `json:"display_name_field"`
 	EmailField            string `json:"email_field"`
+	GroupField            string `json:"group_field"`
+	GroupMapping          string `json:"group_mapping"`
 	WellKnown             string `json:"well_known"`
+	Issuer                string `json:"issuer"`
 	AuthStyle             int    `json:"auth_style"`
+	UsePKCE               bool   `json:"use_pkce"`
+	AutoProvision         bool   `json:"auto_provision"`
 }
 
 func toCustomOAuthProviderResponse(p *model.CustomOAuthProvider) *CustomOAuthProviderResponse {
@@ -45,8 +50,13 @@ func toCustomOAuthProviderResponse(p *model.CustomOAuthProvider) *CustomOAuthPro
 		UsernameField:         p.UsernameField,
 		DisplayNameField:      p.DisplayNameField,
 		EmailField:            p.EmailField,
+		GroupField:            p.GroupField,
+		GroupMapping:          p.GroupMapping,
 		WellKnown:             p.WellKnown,
+		Issuer:                p.Issuer,
 		AuthStyle:             p.AuthStyle,
+		UsePKCE:               p.UsePKCE,
+		AutoProvision:         p.AutoProvision,
 	}
 }
 
@@ -99,16 +109,21 @@ type CreateCustomOAuthProviderRequest struct {
 	Enabled               bool   `json:"enabled"`
 	ClientId              string `json:"client_id" binding:"required"`
 	ClientSecret          string `json:"client_secret" binding:"required"`
-	AuthorizationEndpoint string `json:"authorization_endpoint" binding:"required"`
-	TokenEndpoint         string `json:"token_endpoint" binding:"required"`
-	UserInfoEndpoint      string `json:"user_info_endpoint" binding:"required"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"` // Endpoints may be left empty when discovery is configured
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"user_info_endpoint"`
 	Scopes                string `json:"scopes"`
 	UserIdField           string `json:"user_id_field"`
 	UsernameField         string `json:"username_field"`
 	DisplayNameField      string `json:"display_name_field"`
 	EmailField            string `json:"email_field"`
+	GroupField            string `json:"group_field"`
+	GroupMapping          string `json:"group_mapping"`
 	WellKnown             string `json:"well_known"`
+	Issuer                string `json:"issuer"`
 	AuthStyle             int    `json:"auth_style"`
+	UsePKCE               bool   `json:"use_pkce"`
+	AutoProvision         bool   `json:"auto_provision"`
 }
 
 // CreateCustomOAuthProvider creates a new custom OAuth provider
@@ -145,8 +160,18 @@ func CreateCustomOAuthProvider(c *gin.Context) {
 		UsernameField:         req.UsernameField,
 		DisplayNameField:      req.DisplayNameField,
 		EmailField:            req.EmailField,
+		GroupField:            req.GroupField,
+		GroupMapping:          req.GroupMapping,
 		WellKnown:             req.WellKnown,
+		Issuer:                req.Issuer,
 		AuthStyle:             req.AuthStyle,
+		UsePKCE:               req.UsePKCE,
+		AutoProvision:         req.AutoProvision,
+	}
+
+	if err := oauth.ApplyDiscovery(c.Request.Context(), provider); err != nil {
+		common.ApiErrorMsg(c, "获取 OIDC Discovery 文档失败: "+err.Error())
+		return
 	}
 
 	if err := model.CreateCustomOAuthProvider(provider); err != nil {
@@ -179,8 +204,13 @@ type UpdateCustomOAuthProviderRequest struct {
 	UsernameField         string `json:"username_field"`
 	DisplayNameField      string `json:"display_name_field"`
 	EmailField            string `json:"email_field"`
+	GroupField            string `json:"group_field"`
+	GroupMapping          string `json:"group_mapping"`
 	WellKnown             string `json:"well_known"`
+	Issuer                string `json:"issuer"`
 	AuthStyle             int    `json:"auth_style"`
+	UsePKCE               bool   `json:"use_pkce"`
+	AutoProvision         bool   `json:"auto_provision"`
 }
 
 // UpdateCustomOAuthProvider updates an existing custom OAuth provider
@@ -258,8 +288,18 @@ func UpdateCustomOAuthProvider(c *gin.Context) {
 	if req.EmailField != "" {
 		provider.EmailField = req.EmailField
 	}
+	provider.GroupField = req.GroupField
+	provider.GroupMapping = req.GroupMapping
 	provider.WellKnown = req.WellKnown
+	provider.Issuer = req.Issuer
 	provider.AuthStyle = req.AuthStyle
+	provider.UsePKCE = req.UsePKCE
+	provider.AutoProvision = req.AutoProvision
+
+	if err := oauth.ApplyDiscovery(c.Request.Context(), provider); err != nil {
+		common.ApiErrorMsg(c, "获取 OIDC Discovery 文档失败: "+err.Error())
+		return
+	}
 
 	if err := model.UpdateCustomOAuthProvider(provider); err != nil {
 		common.ApiError(c, err)
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/filestorage"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var filePurposes = map[string]bool{
+	dto.FilePurposeBatch:      true,
+	dto.FilePurposeFineTune:   true,
+	dto.FilePurposeAssistants: true,
+	dto.FilePurposeVision:     true,
+	dto.FilePurposeUserData:   true,
+}
+
+func fileStorageKey(userId int, fileId string) string {
+	return "files/" + strconv.Itoa(userId) + "/" + fileId
+}
+
+// UploadFile 上传文件，multipart 字段 file 为文件内容，purpose 为用途
+func UploadFile(c *gin.Context) {
+	setting := operation_setting.GetFileSetting()
+	if !setting.Enabled {
+		batchError(c, http.StatusForbidden, "invalid_request_error", "files API is disabled")
+		return
+	}
+	purpose := c.PostForm("purpose")
+	if !filePurposes[purpose] {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", "invalid purpose: "+purpose)
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", "file is required as multipart field 'file'")
+		return
+	}
+	if setting.MaxFileSizeMB > 0 && fileHeader.Size > int64(setting.MaxFileSizeMB)<<20 {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("file exceeds %d MB", setting.MaxFileSizeMB))
+		return
+	}
+	userId := c.GetInt("id")
+
+	storage, err := filestorage.GetStorage("")
+	if err != nil {
+		batchError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	defer src.Close()
+
+	file := &model.File{
+		FileId:    "file-" + common.GetUUID(),
+		UserId:    userId,
+		Filename:  fileHeader.Filename,
+		Purpose:   purpose,
+		Bytes:     fileHeader.Size,
+		Storage:   setting.StorageDriver,
+		CreatedAt: common.GetTimestamp(),
+	}
+	file.StorageKey = fileStorageKey(userId, file.FileId)
+	// 先写入记录占用存储空间，再写入文件内容，避免并发上传同时通过空间检查
+	if setting.UserQuotaMB > 0 {
+		err = model.ReserveFile(file, int64(setting.UserQuotaMB)<<20)
+	} else {
+		err = model.CreateFile(file)
+	}
+	if errors.Is(err, model.ErrFileQuotaExceeded) {
+		batchError(c, http.StatusForbidden, "insufficient_quota", fmt.Sprintf("file storage quota of %d MB exceeded", setting.UserQuotaMB))
+		return
+	}
+	if err != nil {
+		batchError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	if err := storage.Put(c.Request.Context(), file.StorageKey, src, fileHeader.Size); err != nil {
+		_ = model.DeleteFile(file.Id)
+		batchError(c, http.StatusInternalServerError, "server_error", "failed to store file: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func getUserFile(c *gin.Context, fileId string) (*model.File, bool) {
+	file, err := model.GetUserFile(c.GetInt("id"), fileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			batchError(c, http.StatusNotFound, "invalid_request_error", "No such File object: "+fileId)
+		} else {
+			batchError(c, http.StatusInternalServerError, "server_error", err.Error())
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+// openStoredFile 打开文件内容，调用方负责关闭
+func openStoredFile(c *gin.Context, file *model.File) (io.ReadCloser, error) {
+	storage, err := filestorage.GetStorage(file.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(c.Request.Context(), file.StorageKey)
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		batchError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	data := make([]*dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, file.ToOpenAIFile())
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+		"first_id": nil,
+		"last_id":  nil,
+	}
+	if len(data) > 0 {
+		response["first_id"] = data[0].ID
+		response["last_id"] = data[len(data)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, ok := getUserFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func DeleteFile(c *gin.Context) {
+	file, ok := getUserFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	storage, err := filestorage.GetStorage(file.Storage)
+	if err != nil {
+		batchError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	if err := storage.Delete(c.Request.Context(), file.StorageKey); err != nil {
+		batchError(c, http.StatusInternalServerError, "server_error", "failed to delete file: "+err.Error())
+		return
+	}
+	if err := model.DeleteFile(file.Id); err != nil {
+		batchError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.FileId,
+		"object":  "file",
+		"deleted": true,
+	})
+}
+
+// GetFileContent 下载文件内容
+func GetFileContent(c *gin.Context) {
+	file, ok := getUserFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	reader, err := openStoredFile(c, file)
+	if err != nil {
+		if errors.Is(err, filestorage.ErrNotFound) {
+			batchError(c, http.StatusNotFound, "invalid_request_error", "file content not found: "+file.FileId)
+		} else {
+			batchError(c, http.StatusInternalServerError, "server_error", err.Error())
+		}
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Disposition", "attachment; filename="+strconv.Quote(file.Filename))
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", reader, nil)
+}
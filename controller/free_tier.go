@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondFreeTierUsage 返回当天各模型的免费额度余量，以及最近 days 天（默认 7，最多 31）的免费额度使用记录
+func respondFreeTierUsage(c *gin.Context, userId int) {
+	days, _ := strconv.Atoi(c.Query("days"))
+	if days <= 0 {
+		days = 7
+	}
+	days = min(days, 31)
+	today, err := service.GetFreeTierStatus(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	now := time.Now()
+	history, err := model.GetFreeTierUsages(userId, service.FreeTierDay(now.AddDate(0, 0, 1-days)), service.FreeTierDay(now))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"today":   today,
+		"history": history,
+	})
+}
+
+func GetSelfFreeTierUsage(c *gin.Context) {
+	respondFreeTierUsage(c, c.GetInt("id"))
+}
+
+func GetUserFreeTierUsage(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userId == 0 {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	respondFreeTierUsage(c, userId)
+}
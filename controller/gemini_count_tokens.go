@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// geminiImageTokenEstimate Gemini 对单张图片按固定 258 token 计费
+const geminiImageTokenEstimate = 258
+
+type geminiCountTokensRequest struct {
+	Contents               []dto.GeminiChatContent `json:"contents,omitempty"`
+	GenerateContentRequest *dto.GeminiChatRequest  `json:"generateContentRequest,omitempty"`
+}
+
+func abortWithGeminiMessage(c *gin.Context, statusCode int, status string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": gin.H{
+			"code":    statusCode,
+			"message": message,
+			"status":  status,
+		},
+	})
+	c.Abort()
+}
+
+// GeminiCountTokens 处理 /v1beta/models/{model}:countTokens，本地估算 token 数，
+// 其它 action 直接放行给后续的渠道分发与转发
+func GeminiCountTokens(c *gin.Context) {
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	modelName, action, found := strings.Cut(path, ":")
+	if !found || action != "countTokens" {
+		return
+	}
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		tokenModelLimit, _ := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
+		limits, _ := tokenModelLimit.(map[string]bool)
+		if _, ok := limits[ratio_setting.FormatMatchingModelName(modelName)]; !ok {
+			abortWithGeminiMessage(c, http.StatusForbidden, "PERMISSION_DENIED", "该令牌无权访问模型 "+modelName)
+			return
+		}
+	}
+
+	request := &geminiCountTokensRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		abortWithGeminiMessage(c, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	chatRequest := request.GenerateContentRequest
+	if chatRequest == nil {
+		chatRequest = &dto.GeminiChatRequest{Contents: request.Contents}
+	}
+
+	meta := chatRequest.GetTokenCountMeta()
+	totalTokens := service.CountTextToken(meta.CombineText, modelName)
+	for _, file := range meta.Files {
+		if file.FileType == types.FileTypeImage {
+			totalTokens += geminiImageTokenEstimate
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"totalTokens": totalTokens,
+	})
+	c.Abort()
+}
@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/graphql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	graphqlMaxPageSize = 100
+	graphqlMaxBodySize = 64 << 10
+)
+
+type graphqlPermissionsKey struct{}
+
+var (
+	graphqlSchema     *graphql.Schema
+	graphqlSchemaOnce sync.Once
+)
+
+// scalarFields 声明按 json 标签直接读取的标量字段，可为个别字段指定所需权限
+func scalarFields(names []string, permissions map[string]string) map[string]*graphql.FieldDef {
+	fields := make(map[string]*graphql.FieldDef, len(names))
+	for _, name := range names {
+		fields[name] = &graphql.FieldDef{Permission: permissions[name]}
+	}
+	return fields
+}
+
+func pageObject(name string, item *graphql.Object) *graphql.Object {
+	return &graphql.Object{
+		Name: name,
+		Fields: map[string]*graphql.FieldDef{
+			"total": {},
+			"items": {Type: item},
+		},
+	}
+}
+
+func graphqlPage(args graphql.Args) *common.PageInfo {
+	page := max(args.Int("page", 1), 1)
+	pageSize := args.Int("page_size", common.ItemsPerPage)
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	return &common.PageInfo{Page: page, PageSize: min(pageSize, graphqlMaxPageSize)}
+}
+
+func graphqlPageResult(total int64, items any) map[string]any {
+	return map[string]any{"total": total, "items": items}
+}
+
+// buildGraphQLSchema 管理后台的只读查询，字段权限与 REST 接口使用同一套 RBAC 权限
+func buildGraphQLSchema() *graphql.Schema {
+	logObject := &graphql.Object{
+		Name: "Log",
+		Fields: scalarFields([]string{
+			"id", "user_id", "created_at", "type", "content", "username", "token_name", "token_id",
+			"model_name", "quota", "prompt_tokens", "completion_tokens", "use_time", "is_stream",
+			"channel", "channel_name", "group", "project", "ip", "request_id", "other",
+		}, nil),
+	}
+	tokenObject := &graphql.Object{
+		Name: "Token",
+		Fields: scalarFields([]string{
+			"id", "user_id", "name", "status", "created_time", "accessed_time", "expired_time",
+			"remain_quota", "unlimited_quota", "used_quota", "group", "project", "model_limits_enabled",
+			"model_limits", "allow_ips", "deny_ips", "scopes",
+		}, map[string]string{
+			"remain_quota": common.PermissionBillingManage,
+			"used_quota":   common.PermissionBillingManage,
+		}),
+	}
+	userObject := &graphql.Object{
+		Name: "User",
+		Fields: scalarFields([]string{
+			"id", "username", "display_name", "role", "admin_role_id", "status", "email", "group",
+			"quota", "used_quota", "request_count", "aff_code", "aff_count", "inviter_id", "remark",
+		}, map[string]string{
+			"quota":      common.PermissionBillingManage,
+			"used_quota": common.PermissionBillingManage,
+		}),
+	}
+	userObject.Fields["tokens"] = &graphql.FieldDef{
+		Type:       tokenObject,
+		Permission: common.PermissionUsersManage,
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			user := p.Source.(*model.User)
+			pageInfo := graphqlPage(p.Args)
+			return model.GetAllUserTokens(user.Id, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+		},
+	}
+	userObject.Fields["logs"] = &graphql.FieldDef{
+		Type:       logObject,
+		Permission: common.PermissionLogsRead,
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			user := p.Source.(*model.User)
+			pageInfo := graphqlPage(p.Args)
+			logs, _, err := model.GetAllLogs(p.Args.Int("type", model.LogTypeUnknown), p.Args.Int64("start_timestamp", 0),
+				p.Args.Int64("end_timestamp", 0), p.Args.String("model_name", ""), user.Username, "",
+				pageInfo.GetStartIdx(), pageInfo.GetPageSize(), 0, "", "")
+			return logs, err
+		},
+	}
+	channelObject := &graphql.Object{
+		Name: "Channel",
+		Fields: scalarFields([]string{
+			"id", "type", "name", "status", "group", "models", "tag", "priority", "weight", "base_url",
+			"created_time", "test_time", "response_time", "balance", "balance_updated_time", "used_quota",
+		}, map[string]string{
+			"balance":    common.PermissionBillingManage,
+			"used_quota": common.PermissionBillingManage,
+		}),
+	}
+	usageObject := &graphql.Object{
+		Name: "UsageStat",
+		Fields: scalarFields([]string{
+			"bucket_start", "user_id", "token_id", "channel_id", "model_name", "project", "requests",
+			"errors", "prompt_tokens", "completion_tokens", "quota", "total_use_time",
+		}, nil),
+	}
+	statObject := &graphql.Object{
+		Name:   "Stat",
+		Fields: scalarFields([]string{"quota", "rpm", "tpm"}, nil),
+	}
+
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: map[string]*graphql.FieldDef{
+			"channels": {
+				Type:       pageObject("ChannelPage", channelObject),
+				Permission: common.PermissionChannelsRead,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					pageInfo := graphqlPage(p.Args)
+					channels, err := model.GetAllChannels(pageInfo.GetStartIdx(), pageInfo.GetPageSize(), false, p.Args.Bool("id_sort", false))
+					if err != nil {
+						return nil, err
+					}
+					var total int64
+					if err = model.DB.Model(&model.Channel{}).Count(&total).Error; err != nil {
+						return nil, err
+					}
+					return graphqlPageResult(total, channels), nil
+				},
+			},
+			"channel": {
+				Type:       channelObject,
+				Permission: common.PermissionChannelsRead,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return model.GetChannelById(p.Args.Int("id", 0), false)
+				},
+			},
+			"users": {
+				Type:       pageObject("UserPage", userObject),
+				Permission: common.PermissionUsersManage,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					pageInfo := graphqlPage(p.Args)
+					keyword, group := p.Args.String("keyword", ""), p.Args.String("group", "")
+					var users []*model.User
+					var total int64
+					var err error
+					if keyword != "" || group != "" {
+						users, total, err = model.SearchUsers(keyword, group, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+					} else {
+						users, total, err = model.GetAllUsers(pageInfo)
+					}
+					if err != nil {
+						return nil, err
+					}
+					return graphqlPageResult(total, users), nil
+				},
+			},
+			"user": {
+				Type:       userObject,
+				Permission: common.PermissionUsersManage,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return model.GetUserById(p.Args.Int("id", 0), false)
+				},
+			},
+			"tokens": {
+				Type:       tokenObject,
+				Permission: common.PermissionUsersManage,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					userId := p.Args.Int("user_id", 0)
+					if userId == 0 {
+						return nil, fmt.Errorf("user_id is required")
+					}
+					pageInfo := graphqlPage(p.Args)
+					return model.GetAllUserTokens(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+				},
+			},
+			"logs": {
+				Type:       pageObject("LogPage", logObject),
+				Permission: common.PermissionLogsRead,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					pageInfo := graphqlPage(p.Args)
+					logs, total, err := model.GetAllLogs(p.Args.Int("type", model.LogTypeUnknown), p.Args.Int64("start_timestamp", 0),
+						p.Args.Int64("end_timestamp", 0), p.Args.String("model_name", ""), p.Args.String("username", ""),
+						p.Args.String("token_name", ""), pageInfo.GetStartIdx(), pageInfo.GetPageSize(), p.Args.Int("channel", 0),
+						p.Args.String("group", ""), p.Args.String("request_id", ""))
+					if err != nil {
+						return nil, err
+					}
+					return graphqlPageResult(total, logs), nil
+				},
+			},
+			"usage": {
+				Type:       usageObject,
+				Permission: common.PermissionLogsRead,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					period := p.Args.String("period", model.UsageStatPeriodDay)
+					if period != model.UsageStatPeriodHour && period != model.UsageStatPeriodDay {
+						return nil, fmt.Errorf("period must be hour or day")
+					}
+					return model.QueryUsageStats(model.UsageStatFilter{
+						Period:    period,
+						Start:     p.Args.Int64("start_timestamp", 0),
+						End:       p.Args.Int64("end_timestamp", 0),
+						UserId:    p.Args.Int("user_id", 0),
+						TokenId:   p.Args.Int("token_id", 0),
+						ChannelId: p.Args.Int("channel_id", 0),
+						ModelName: p.Args.String("model_name", ""),
+						Project:   p.Args.String("project", ""),
+					})
+				},
+			},
+			"stat": {
+				Type:       statObject,
+				Permission: common.PermissionLogsRead,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					stat := model.SumUsedQuota(p.Args.Int("type", model.LogTypeUnknown), p.Args.Int64("start_timestamp", 0),
+						p.Args.Int64("end_timestamp", 0), p.Args.String("model_name", ""), p.Args.String("username", ""),
+						p.Args.String("token_name", ""), p.Args.Int("channel", 0), p.Args.String("group", ""))
+					return stat, nil
+				},
+			},
+		},
+	}
+	return &graphql.Schema{
+		Query: query,
+		Authorize: func(ctx context.Context, permission string) bool {
+			granted, _ := ctx.Value(graphqlPermissionsKey{}).([]string)
+			return common.HasPermissions(granted, permission)
+		},
+		MaxDepth: 6,
+	}
+}
+
+// GraphQL 管理后台的 GraphQL 查询入口，无权限的字段返回 null 并在 errors 中说明
+func GraphQL(c *gin.Context) {
+	graphqlSchemaOnce.Do(func() {
+		graphqlSchema = buildGraphQLSchema()
+	})
+	var req graphql.Request
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := common.UnmarshalJsonStr(variables, &req.Variables); err != nil {
+				c.JSON(http.StatusBadRequest, graphql.Response{Errors: []*graphql.Error{{Message: "invalid variables"}}})
+				return
+			}
+		}
+	} else {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, graphqlMaxBodySize)
+		if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+			c.JSON(http.StatusBadRequest, graphql.Response{Errors: []*graphql.Error{{Message: "invalid request body"}}})
+			return
+		}
+	}
+	if req.Query == "" {
+		c.JSON(http.StatusBadRequest, graphql.Response{Errors: []*graphql.Error{{Message: "query is required"}}})
+		return
+	}
+	permissions := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	ctx := context.WithValue(c.Request.Context(), graphqlPermissionsKey{}, permissions)
+	c.JSON(http.StatusOK, graphqlSchema.Execute(ctx, req))
+}
@@ -0,0 +1,367 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const impersonateMaxResponseBytes = 64 << 10
+
+type impersonateChatRequest struct {
+	TokenId int             `json:"token_id"`
+	UserId  int             `json:"user_id"`
+	Group   string          `json:"group"` // 仅按用户测试时生效，为空使用用户所在分组
+	Model   string          `json:"model"`
+	Request json.RawMessage `json:"request"` // 完整的 chat completions 请求体，为空时使用简单的测试消息
+	DryRun  bool            `json:"dry_run"` // 只做鉴权、选渠道和计费预估，不请求上游
+}
+
+// impersonateTiming 各阶段耗时（毫秒），未执行到的阶段为 0
+type impersonateTiming struct {
+	Auth       int64 `json:"auth"`
+	Distribute int64 `json:"distribute"`
+	FirstByte  int64 `json:"first_byte"`
+	Relay      int64 `json:"relay"`
+	Total      int64 `json:"total"`
+}
+
+type impersonateResult struct {
+	RequestId      string              `json:"request_id"`
+	UserId         int                 `json:"user_id"`
+	TokenId        int                 `json:"token_id"`
+	Group          string              `json:"group"`
+	RequestedModel string              `json:"requested_model"`
+	RewrittenModel string              `json:"rewritten_model,omitempty"`
+	UpstreamModel  string              `json:"upstream_model,omitempty"`
+	ChannelId      int                 `json:"channel_id,omitempty"`
+	ChannelName    string              `json:"channel_name,omitempty"`
+	ChannelType    int                 `json:"channel_type,omitempty"`
+	UsedChannels   []string            `json:"used_channels,omitempty"`
+	Stage          string              `json:"stage"` // 请求结束时所处的阶段：auth、distribute、billing、relay、done
+	StatusCode     int                 `json:"status_code"`
+	Response       any                 `json:"response,omitempty"`
+	BillingPreview *impersonateBilling `json:"billing_preview,omitempty"`
+	Billing        []*model.Log        `json:"billing,omitempty"`
+	Timing         impersonateTiming   `json:"timing"`
+}
+
+type impersonateBilling struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	UsePrice         bool    `json:"use_price"`
+	ModelPrice       float64 `json:"model_price"`
+	ModelRatio       float64 `json:"model_ratio"`
+	CompletionRatio  float64 `json:"completion_ratio"`
+	GroupRatio       float64 `json:"group_ratio"`
+	FreeModel        bool    `json:"free_model"`
+	PreConsumedQuota int     `json:"pre_consumed_quota"`
+	Error            string  `json:"error,omitempty"`
+}
+
+// firstWriteWriter 记录首次写出响应的时间
+type firstWriteWriter struct {
+	gin.ResponseWriter
+	onFirstWrite func()
+}
+
+func (w *firstWriteWriter) Write(data []byte) (int, error) {
+	if w.onFirstWrite != nil {
+		w.onFirstWrite()
+		w.onFirstWrite = nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *firstWriteWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// ImpersonateChat 以指定令牌或用户的身份执行一次 chat completions 请求，
+// 返回选中的渠道、模型改写结果、各阶段耗时与计费信息，用于排查用户的调用问题
+func ImpersonateChat(c *gin.Context) {
+	var req impersonateChatRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var token *model.Token
+	var err error
+	if req.TokenId != 0 {
+		token, err = model.GetTokenById(req.TokenId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		req.UserId = token.UserId
+	} else if req.UserId == 0 {
+		common.ApiErrorMsg(c, "token_id 和 user_id 不能同时为空")
+		return
+	}
+	user, err := model.GetUserById(req.UserId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser && user.Id != c.GetInt("id") {
+		common.ApiErrorMsg(c, "无权以同级或更高权限的用户身份测试")
+		return
+	}
+	body, err := buildImpersonateBody(&req)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	admin, err := model.GetUserCache(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	result := &impersonateResult{
+		RequestId:      common.GetTimeString() + common.GetRandomString(8),
+		UserId:         user.Id,
+		RequestedModel: req.Model,
+		Stage:          "auth",
+	}
+	start := time.Now()
+	var stageStart time.Time
+	mark := func(stage string, elapsed *int64) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			*elapsed = time.Since(stageStart).Milliseconds()
+			stageStart = time.Now()
+			result.Stage = stage
+			c.Next()
+		}
+	}
+
+	engine := gin.New()
+	handlers := []gin.HandlerFunc{func(ctx *gin.Context) {
+		ctx.Set(common.RequestIdKey, result.RequestId)
+		ctx.Writer = &firstWriteWriter{ResponseWriter: ctx.Writer, onFirstWrite: func() {
+			result.Timing.FirstByte = time.Since(start).Milliseconds()
+		}}
+		stageStart = time.Now()
+		ctx.Next()
+	}}
+	if token != nil {
+		handlers = append(handlers, middleware.TokenAuth())
+	} else {
+		handlers = append(handlers, impersonateUserAuth(user, req.Group))
+	}
+	// 与真实请求走同一组中间件，限流、内容策略与参数策略同样生效
+	handlers = append(handlers, mark("distribute", &result.Timing.Auth), middleware.ModelRequestRateLimit())
+	handlers = append(handlers, middleware.RelayMiddlewares()...)
+	handlers = append(handlers, mark("billing", &result.Timing.Distribute), impersonateBillAdmin(admin), func(ctx *gin.Context) {
+		collectImpersonateSelection(ctx, result)
+		result.BillingPreview = previewImpersonateBilling(ctx, result)
+		if req.DryRun {
+			result.Stage = "done"
+			ctx.Abort()
+			return
+		}
+		model.RecordLog(admin.Id, model.LogTypeManage, fmt.Sprintf("以用户 %d 的身份测试模型 %s，请求 %s 的费用由管理员承担", user.Id, req.Model, result.RequestId))
+		result.Stage = "relay"
+		stageStart = time.Now()
+		Relay(ctx, types.RelayFormatOpenAI)
+		result.Timing.Relay = time.Since(stageStart).Milliseconds()
+		result.UsedChannels = ctx.GetStringSlice("use_channel")
+		// 重试后实际使用的渠道可能变化
+		collectImpersonateSelection(ctx, result)
+		if ctx.Writer.Status() < http.StatusBadRequest {
+			result.Stage = "done"
+		}
+	})
+	engine.POST("/v1/chat/completions", handlers...)
+
+	ctx := context.WithValue(c.Request.Context(), common.RequestIdKey, result.RequestId)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	// 记录管理员的真实地址，令牌的 IP 限制按该地址判断
+	httpReq.RemoteAddr = net.JoinHostPort(c.ClientIP(), "0")
+	if token != nil {
+		result.TokenId = token.Id
+		httpReq.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httpReq)
+
+	result.Timing.Total = time.Since(start).Milliseconds()
+	result.StatusCode = recorder.Code
+	result.Response = decodeImpersonateResponse(recorder.Body.Bytes())
+	if !req.DryRun && result.Stage == "done" {
+		logs, _, err := model.GetAllLogs(model.LogTypeConsume, 0, 0, "", "", "", 0, 10, 0, "", result.RequestId)
+		if err == nil {
+			result.Billing = logs
+		}
+	}
+	common.ApiSuccess(c, result)
+}
+
+func buildImpersonateBody(req *impersonateChatRequest) ([]byte, error) {
+	if len(req.Request) == 0 {
+		if req.Model == "" {
+			return nil, errors.New("model 不能为空")
+		}
+		return common.Marshal(dto.GeneralOpenAIRequest{
+			Model:     req.Model,
+			Messages:  []dto.Message{{Role: "user", Content: "hi"}},
+			MaxTokens: 16,
+		})
+	}
+	var body map[string]any
+	if err := common.Unmarshal(req.Request, &body); err != nil {
+		return nil, fmt.Errorf("request 不是合法的 JSON: %w", err)
+	}
+	if req.Model != "" {
+		body["model"] = req.Model
+	}
+	req.Model, _ = body["model"].(string)
+	if req.Model == "" {
+		return nil, errors.New("model 不能为空")
+	}
+	return common.Marshal(body)
+}
+
+// impersonateUserAuth 不指定令牌时，仿照 playground 以用户身份构造临时令牌
+func impersonateUserAuth(user *model.User, group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userCache, err := model.GetUserCache(user.Id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+			c.Abort()
+			return
+		}
+		if userCache.Status != common.UserStatusEnabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"message": "用户已被封禁"}})
+			c.Abort()
+			return
+		}
+		userCache.WriteContext(c)
+		usingGroup := userCache.Group
+		if group != "" && group != usingGroup {
+			if !service.GroupInUserUsableGroups(usingGroup, group) {
+				c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"message": fmt.Sprintf("无权访问 %s 分组", group)}})
+				c.Abort()
+				return
+			}
+			usingGroup = group
+		}
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, usingGroup)
+		tempToken := &model.Token{
+			UserId: user.Id,
+			Name:   "impersonate-" + usingGroup,
+			Group:  usingGroup,
+		}
+		_ = middleware.SetupContextForToken(c, tempToken)
+		c.Next()
+	}
+}
+
+// impersonateBillAdmin 限流与策略检查之后把计费身份换成发起测试的管理员，分组与倍率仍按被测试的用户计算；
+// 不扣除被测试令牌的额度，费用与日志记在管理员名下
+func impersonateBillAdmin(admin *model.UserBase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		common.SetContextKey(c, constant.ContextKeyUserId, admin.Id)
+		common.SetContextKey(c, constant.ContextKeyUserQuota, admin.Quota)
+		common.SetContextKey(c, constant.ContextKeyUserCreditLimit, admin.CreditLimit)
+		common.SetContextKey(c, constant.ContextKeyUserEmail, admin.Email)
+		common.SetContextKey(c, constant.ContextKeyUserName, admin.Username)
+		common.SetContextKey(c, constant.ContextKeyUserSetting, admin.GetSetting())
+		common.SetContextKey(c, constant.ContextKeyUserOrganizationId, admin.OrganizationId)
+		common.SetContextKey(c, constant.ContextKeyTokenUnlimited, true)
+		common.SetContextKey(c, constant.ContextKeySkipTokenQuota, true)
+		c.Next()
+	}
+}
+
+func collectImpersonateSelection(c *gin.Context, result *impersonateResult) {
+	result.Group = common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	if autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup); autoGroup != "" {
+		result.Group += "(" + autoGroup + ")"
+	}
+	result.ChannelId = common.GetContextKeyInt(c, constant.ContextKeyChannelId)
+	result.ChannelName = common.GetContextKeyString(c, constant.ContextKeyChannelName)
+	result.ChannelType = common.GetContextKeyInt(c, constant.ContextKeyChannelType)
+	if requested := common.GetContextKeyString(c, constant.ContextKeyRequestedModel); requested != "" {
+		result.RewrittenModel = common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	}
+}
+
+// previewImpersonateBilling 按选中的渠道估算提示词 token 与预扣费额度，同时得到渠道模型映射后的上游模型
+func previewImpersonateBilling(c *gin.Context, result *impersonateResult) *impersonateBilling {
+	preview := &impersonateBilling{}
+	request := &dto.GeneralOpenAIRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		preview.Error = err.Error()
+		return preview
+	}
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatOpenAI, request, nil)
+	if err != nil {
+		preview.Error = err.Error()
+		return preview
+	}
+	info.InitChannelMeta(c)
+	if err := helper.ModelMappedHelper(c, info, nil); err != nil {
+		preview.Error = err.Error()
+		return preview
+	}
+	result.UpstreamModel = info.UpstreamModelName
+	meta := request.GetTokenCountMeta()
+	tokens, err := service.EstimateRequestToken(c, meta, info)
+	if err != nil {
+		preview.Error = err.Error()
+		return preview
+	}
+	preview.PromptTokens = tokens
+	priceData, err := helper.ModelPriceHelper(c, info, tokens, meta)
+	if err != nil {
+		preview.Error = err.Error()
+		return preview
+	}
+	preview.UsePrice = priceData.UsePrice
+	preview.ModelPrice = priceData.ModelPrice
+	preview.ModelRatio = priceData.ModelRatio
+	preview.CompletionRatio = priceData.CompletionRatio
+	preview.GroupRatio = priceData.GroupRatioInfo.GroupRatio
+	preview.FreeModel = priceData.FreeModel
+	preview.PreConsumedQuota = priceData.QuotaToPreConsume
+	return preview
+}
+
+func decodeImpersonateResponse(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) > impersonateMaxResponseBytes {
+		return string(data[:impersonateMaxResponseBytes]) + "...(truncated)"
+	}
+	var decoded any
+	if err := common.Unmarshal(data, &decoded); err == nil {
+		return decoded
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// LdapLogin 使用目录账号登录，首次登录时自动创建本地账户
+func LdapLogin(c *gin.Context) {
+	if !system_setting.GetLDAPSettings().Enabled {
+		common.ApiErrorI18n(c, i18n.MsgUserLdapLoginDisabled)
+		return
+	}
+	var loginRequest LoginRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&loginRequest); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	ldapUser, err := service.LdapAuthenticate(loginRequest.Username, loginRequest.Password)
+	if err != nil {
+		if !errors.Is(err, service.ErrLdapInvalidCredentials) {
+			common.SysError(fmt.Sprintf("[LDAP] authentication failed: %s", err.Error()))
+			err = errors.New("LDAP 服务暂时不可用，请稍后重试")
+		}
+		common.ApiError(c, err)
+		return
+	}
+	user, err := findOrCreateLdapUser(c, ldapUser)
+	if err != nil {
+		var deletedErr *OAuthUserDeletedError
+		if errors.As(err, &deletedErr) {
+			common.ApiErrorI18n(c, i18n.MsgOAuthUserDeleted)
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		common.ApiErrorI18n(c, i18n.MsgOAuthUserBanned)
+		return
+	}
+
+	if model.IsTwoFAEnabled(user.Id) {
+		session := sessions.Default(c)
+		session.Set("pending_username", user.Username)
+		session.Set("pending_user_id", user.Id)
+		if err = session.Save(); err != nil {
+			common.ApiErrorI18n(c, i18n.MsgUserSessionSaveFailed)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": i18n.T(c, i18n.MsgUserRequire2FA),
+			"success": true,
+			"data": map[string]interface{}{
+				"require_2fa": true,
+			},
+		})
+		return
+	}
+
+	setupLogin(user, c)
+}
+
+func findOrCreateLdapUser(c *gin.Context, ldapUser *service.LdapUser) (*model.User, error) {
+	role, mapped := service.LdapMapRole(ldapUser.Groups)
+	user := &model.User{LdapDn: ldapUser.DN}
+	if model.IsLdapDnAlreadyTaken(ldapUser.DN) {
+		if err := user.FillUserByLdapDn(); err != nil {
+			return nil, err
+		}
+		if user.Id == 0 {
+			return nil, &OAuthUserDeletedError{}
+		}
+		// 每次登录按目录中的组刷新角色，超级管理员不受影响
+		if mapped && user.Role != role && user.Role != common.RoleRootUser {
+			if err := model.UpdateLdapUserRoleAndStatus(user.Id, role, user.Status); err != nil {
+				return nil, err
+			}
+			user.Role = role
+		}
+		return user, nil
+	}
+
+	user.Username = "ldap_" + strconv.Itoa(model.GetMaxUserId()+1)
+	if name := ldapUser.Username; len(name) <= 20 {
+		if exist, err := model.CheckUserExistOrDeleted(name, ""); err == nil && !exist {
+			user.Username = name
+		}
+	}
+	user.DisplayName = ldapUser.DisplayName
+	if user.DisplayName == "" {
+		user.DisplayName = ldapUser.Username
+	}
+	if len([]rune(user.DisplayName)) > 20 {
+		user.DisplayName = string([]rune(user.DisplayName)[:20])
+	}
+	if ldapUser.Email != "" && !model.IsEmailAlreadyTaken(ldapUser.Email) {
+		user.Email = ldapUser.Email
+	}
+	// 本地密码随机生成，目录账户只能通过 LDAP 或管理员重置后登录
+	user.Password = common.GetRandomString(16)
+	user.Role = common.RoleCommonUser
+	if mapped {
+		user.Role = role
+	}
+	user.Status = common.UserStatusEnabled
+
+	inviterId := 0
+	if affCode := sessions.Default(c).Get("aff"); affCode != nil {
+		inviterId, _ = model.GetUserIdByAffCode(affCode.(string))
+	}
+	if err := user.Insert(inviterId); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/logarchive"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	logArchiveSearchDefaultLimit = 100
+	logArchiveSearchMaxLimit     = 1000
+)
+
+// GetLogArchives 列出与时间范围有交集的归档文件
+func GetLogArchives(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	archives, total, err := model.GetLogArchives(startTimestamp, endTimestamp, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(archives)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// SearchArchivedLogs 在归档文件中按条件查询日志，供审计使用
+func SearchArchivedLogs(c *gin.Context) {
+	query := &logarchive.Query{
+		Username:  c.Query("username"),
+		TokenName: c.Query("token_name"),
+		ModelName: c.Query("model_name"),
+		Group:     c.Query("group"),
+		RequestId: c.Query("request_id"),
+	}
+	query.Type, _ = strconv.Atoi(c.Query("type"))
+	query.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	query.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	query.ChannelId, _ = strconv.Atoi(c.Query("channel"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = logArchiveSearchDefaultLimit
+	}
+	if limit > logArchiveSearchMaxLimit {
+		limit = logArchiveSearchMaxLimit
+	}
+	logs, err := logarchive.Search(c.Request.Context(), query, limit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, logs)
+}
+
+// DownloadLogArchive 下载归档文件原始内容（gzip 压缩的 JSONL）
+func DownloadLogArchive(c *gin.Context) {
+	archive, ok := getLogArchiveParam(c)
+	if !ok {
+		return
+	}
+	reader, err := logarchive.Open(c.Request.Context(), archive)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Disposition", "attachment; filename="+path.Base(archive.ObjectKey))
+	c.Header("Content-Type", "application/gzip")
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
+
+// RestoreLogArchive 把归档中的日志写回数据库，已存在的日志跳过
+func RestoreLogArchive(c *gin.Context) {
+	archive, ok := getLogArchiveParam(c)
+	if !ok {
+		return
+	}
+	restored, err := logarchive.Restore(c.Request.Context(), archive)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateLogArchivePurged(archive.Id, false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"restored": restored})
+}
+
+// RunLogArchive 立即在后台执行一次归档
+func RunLogArchive(c *gin.Context) {
+	if logarchive.IsRunning() {
+		common.ApiError(c, logarchive.ErrArchiveRunning)
+		return
+	}
+	gopool.Go(func() {
+		archived, err := logarchive.Run(context.Background())
+		if err != nil && !errors.Is(err, logarchive.ErrArchiveRunning) {
+			common.SysError("log archive failed: " + err.Error())
+			return
+		}
+		common.SysLog("manual log archive finished, archived " + strconv.Itoa(archived) + " logs")
+	})
+	common.ApiSuccess(c, nil)
+}
+
+func getLogArchiveParam(c *gin.Context) (*model.LogArchive, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	archive, err := model.GetLogArchiveById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return archive, true
+}
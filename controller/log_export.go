@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/logexport"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const logExportListLimit = 20
+
+// logExportItem 导出记录，已完成的导出附带签名下载链接
+type logExportItem struct {
+	*model.LogExport
+	DownloadURL       string `json:"download_url,omitempty"`
+	DownloadExpiresAt int64  `json:"download_expires_at,omitempty"`
+}
+
+func newLogExportItem(export *model.LogExport) *logExportItem {
+	item := &logExportItem{LogExport: export}
+	if export.Status == model.LogExportStatusCompleted {
+		item.DownloadURL, item.DownloadExpiresAt = logexport.DownloadURL(export)
+	}
+	return item
+}
+
+// CreateSelfLogExport 提交日志导出，文件在后台生成，完成后通过通知渠道告知用户
+func CreateSelfLogExport(c *gin.Context) {
+	req := logexport.Request{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	export, err := logexport.Create(c.GetInt("id"), &req)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, newLogExportItem(export))
+}
+
+func GetSelfLogExports(c *gin.Context) {
+	exports, err := model.GetUserLogExports(c.GetInt("id"), logExportListLimit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]*logExportItem, 0, len(exports))
+	for _, export := range exports {
+		items = append(items, newLogExportItem(export))
+	}
+	common.ApiSuccess(c, items)
+}
+
+func GetSelfLogExport(c *gin.Context) {
+	export, err := model.GetUserLogExport(c.GetInt("id"), c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		common.ApiErrorMsg(c, "导出记录不存在")
+		return
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, newLogExportItem(export))
+}
+
+// DownloadLogExport 通过签名链接下载导出文件，无需登录
+func DownloadLogExport(c *gin.Context) {
+	exportId := c.Param("id")
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if !logexport.VerifySign(exportId, expires, c.Query("sign")) {
+		c.String(http.StatusForbidden, "download link is invalid or expired")
+		return
+	}
+	export, err := model.GetLogExportByExportId(exportId)
+	if err != nil || export.Status != model.LogExportStatusCompleted || export.ExpiresAt <= common.GetTimestamp() {
+		c.String(http.StatusNotFound, "export not found or expired")
+		return
+	}
+	reader, err := logexport.Open(c.Request.Context(), export)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer reader.Close()
+	contentType := "text/csv; charset=utf-8"
+	if export.Format == model.LogExportFormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Disposition", "attachment; filename="+export.Filename())
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", strconv.FormatInt(export.Bytes, 10))
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
@@ -0,0 +1,433 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 网关自身的 MCP 服务，同时支持 Streamable HTTP（POST /mcp）与旧版 SSE（GET /mcp/sse + POST /mcp/message）传输。
+// 工具只读取当前令牌及其用户自身的信息，调用不计费
+
+const mcpMaxMessageBytes = 1 << 20
+
+// mcpProtocolVersions 支持的协议版本，客户端请求的版本不在其中时返回最新版本
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+type mcpToolHandler func(c *gin.Context, arguments json.RawMessage) (any, error)
+
+type mcpToolEntry struct {
+	tool    dto.MCPTool
+	handler mcpToolHandler
+}
+
+var mcpTools = []mcpToolEntry{
+	{
+		tool: dto.MCPTool{
+			Name:        "list_models",
+			Description: "List the models this API token can call, with the endpoint types each model supports.",
+			InputSchema: map[string]any{"type": "object", "properties": map[string]any{}},
+		},
+		handler: mcpListModels,
+	},
+	{
+		tool: dto.MCPTool{
+			Name:        "get_token_balance",
+			Description: "Get the remaining and used quota of this API token and the balance of its owner.",
+			InputSchema: map[string]any{"type": "object", "properties": map[string]any{}},
+		},
+		handler: mcpGetTokenBalance,
+	},
+	{
+		tool: dto.MCPTool{
+			Name:        "get_usage",
+			Description: "Get the quota and tokens consumed by this API token in a time range, optionally for a single model. Defaults to the last 24 hours.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"start_timestamp": map[string]any{"type": "integer", "description": "Unix timestamp in seconds"},
+					"end_timestamp":   map[string]any{"type": "integer", "description": "Unix timestamp in seconds"},
+					"model":           map[string]any{"type": "string", "description": "Only count usage of this model"},
+				},
+			},
+		},
+		handler: mcpGetUsage,
+	},
+}
+
+func mcpDisabled(c *gin.Context) bool {
+	if operation_setting.GetMCPSetting().Enabled {
+		return false
+	}
+	c.AbortWithStatus(http.StatusNotFound)
+	return true
+}
+
+// McpStreamableHTTP Streamable HTTP 传输，每个请求直接以 JSON 返回结果，不保存会话
+func McpStreamableHTTP(c *gin.Context) {
+	if mcpDisabled(c) {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, mcpMaxMessageBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, mcpErrorResponse(nil, dto.JSONRPCParseError, err.Error()))
+		return
+	}
+	responses, batch, err := handleMCPPayload(c, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, mcpErrorResponse(nil, dto.JSONRPCParseError, err.Error()))
+		return
+	}
+	if len(responses) == 0 {
+		// 只包含通知或响应的消息
+		c.Status(http.StatusAccepted)
+		return
+	}
+	if batch {
+		c.JSON(http.StatusOK, responses)
+		return
+	}
+	c.JSON(http.StatusOK, responses[0])
+}
+
+// McpStreamableHTTPStream 不提供服务端主动推送的流
+func McpStreamableHTTPStream(c *gin.Context) {
+	if mcpDisabled(c) {
+		return
+	}
+	c.Header("Allow", http.MethodPost)
+	c.Status(http.StatusMethodNotAllowed)
+}
+
+type mcpSSESession struct {
+	tokenId  int
+	messages chan []byte
+}
+
+var (
+	mcpSSESessions      sync.Map // session id -> *mcpSSESession
+	mcpSSETokenSessions = make(map[int]int)
+	mcpSSETokenLock     sync.Mutex
+)
+
+// acquireMCPSSESession 限制单个令牌同时保持的 SSE 连接数
+func acquireMCPSSESession(tokenId int) bool {
+	mcpSSETokenLock.Lock()
+	defer mcpSSETokenLock.Unlock()
+	if limit := operation_setting.GetMCPSetting().MaxSSESessionsPerToken; limit > 0 && mcpSSETokenSessions[tokenId] >= limit {
+		return false
+	}
+	mcpSSETokenSessions[tokenId]++
+	return true
+}
+
+func releaseMCPSSESession(tokenId int) {
+	mcpSSETokenLock.Lock()
+	defer mcpSSETokenLock.Unlock()
+	if mcpSSETokenSessions[tokenId] <= 1 {
+		delete(mcpSSETokenSessions, tokenId)
+		return
+	}
+	mcpSSETokenSessions[tokenId]--
+}
+
+// McpSSE 旧版 SSE 传输：先推送 endpoint 事件告知消息地址，之后的响应都通过该连接推送。
+// 会话保存在当前实例内存中，多实例部署时消息请求需与连接落在同一实例
+func McpSSE(c *gin.Context) {
+	if mcpDisabled(c) {
+		return
+	}
+	tokenId := c.GetInt("token_id")
+	if !acquireMCPSSESession(tokenId) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many MCP SSE sessions for this token"})
+		return
+	}
+	defer releaseMCPSSESession(tokenId)
+
+	sessionId := common.GetUUID()
+	session := &mcpSSESession{tokenId: tokenId, messages: make(chan []byte, 16)}
+	mcpSSESessions.Store(sessionId, session)
+	defer mcpSSESessions.Delete(sessionId)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	fmt.Fprintf(c.Writer, "event: endpoint\ndata: /mcp/message?session_id=%s\n\n", sessionId)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case message := <-session.messages:
+			fmt.Fprintf(c.Writer, "event: message\ndata: %s\n\n", message)
+			c.Writer.Flush()
+		case <-ticker.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// McpSSEMessage 接收旧版 SSE 传输的客户端消息，响应通过对应的 SSE 连接推送
+func McpSSEMessage(c *gin.Context) {
+	if mcpDisabled(c) {
+		return
+	}
+	value, ok := mcpSSESessions.Load(c.Query("session_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	session := value.(*mcpSSESession)
+	if session.tokenId != c.GetInt("token_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "session belongs to another token"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, mcpMaxMessageBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	responses, batch, err := handleMCPPayload(c, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(responses) > 0 {
+		var message []byte
+		if batch {
+			message, err = common.Marshal(responses)
+		} else {
+			message, err = common.Marshal(responses[0])
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		select {
+		case session.messages <- message:
+		case <-time.After(10 * time.Second):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "SSE connection is not reading messages"})
+			return
+		}
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// handleMCPPayload 处理单条或批量 JSON-RPC 消息，通知不产生响应
+func handleMCPPayload(c *gin.Context, body []byte) ([]*dto.JSONRPCResponse, bool, error) {
+	body = bytes.TrimSpace(body)
+	var requests []dto.JSONRPCRequest
+	batch := len(body) > 0 && body[0] == '['
+	if batch {
+		if err := common.Unmarshal(body, &requests); err != nil {
+			return nil, true, err
+		}
+	} else {
+		var request dto.JSONRPCRequest
+		if err := common.Unmarshal(body, &request); err != nil {
+			return nil, false, err
+		}
+		requests = append(requests, request)
+	}
+	responses := make([]*dto.JSONRPCResponse, 0, len(requests))
+	for i := range requests {
+		if response := handleMCPRequest(c, &requests[i]); response != nil {
+			responses = append(responses, response)
+		}
+	}
+	return responses, batch, nil
+}
+
+func handleMCPRequest(c *gin.Context, request *dto.JSONRPCRequest) *dto.JSONRPCResponse {
+	if request.Method == "" {
+		// 客户端对服务端请求的响应，本服务不会发起请求，直接忽略
+		return nil
+	}
+	if request.IsNotification() {
+		return nil
+	}
+	if request.JSONRPC != dto.JSONRPCVersion {
+		return mcpErrorResponse(request.ID, dto.JSONRPCInvalidRequest, "jsonrpc must be 2.0")
+	}
+	switch request.Method {
+	case "initialize":
+		var params dto.MCPInitializeParams
+		if len(request.Params) > 0 {
+			if err := common.Unmarshal(request.Params, &params); err != nil {
+				return mcpErrorResponse(request.ID, dto.JSONRPCInvalidParams, err.Error())
+			}
+		}
+		protocolVersion := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+			protocolVersion = params.ProtocolVersion
+		}
+		return mcpResultResponse(request.ID, dto.MCPInitializeResult{
+			ProtocolVersion: protocolVersion,
+			Capabilities:    map[string]any{"tools": map[string]any{"listChanged": false}},
+			ServerInfo:      dto.MCPImplementation{Name: common.SystemName, Version: common.Version},
+			Instructions:    "Tools to inspect the models, quota and usage of the API token used to connect.",
+		})
+	case "ping":
+		return mcpResultResponse(request.ID, map[string]any{})
+	case "tools/list":
+		tools := make([]dto.MCPTool, 0, len(mcpTools))
+		for _, entry := range mcpTools {
+			tools = append(tools, entry.tool)
+		}
+		return mcpResultResponse(request.ID, map[string]any{"tools": tools})
+	case "tools/call":
+		var params dto.MCPToolCallParams
+		if err := common.Unmarshal(request.Params, &params); err != nil {
+			return mcpErrorResponse(request.ID, dto.JSONRPCInvalidParams, err.Error())
+		}
+		index := slices.IndexFunc(mcpTools, func(entry mcpToolEntry) bool {
+			return entry.tool.Name == params.Name
+		})
+		if index < 0 {
+			return mcpErrorResponse(request.ID, dto.JSONRPCInvalidParams, "unknown tool: "+params.Name)
+		}
+		return mcpResultResponse(request.ID, callMCPTool(c, mcpTools[index], params.Arguments))
+	}
+	return mcpErrorResponse(request.ID, dto.JSONRPCMethodNotFound, "method not found: "+request.Method)
+}
+
+// callMCPTool 工具执行失败按 MCP 约定放在结果中返回，而不是 JSON-RPC 错误
+func callMCPTool(c *gin.Context, entry mcpToolEntry, arguments json.RawMessage) dto.MCPToolCallResult {
+	result, err := entry.handler(c, arguments)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("MCP tool %s failed: %s", entry.tool.Name, err.Error()))
+		return dto.MCPToolCallResult{
+			Content: []dto.MCPContent{{Type: "text", Text: err.Error()}},
+			IsError: true,
+		}
+	}
+	text, err := common.Marshal(result)
+	if err != nil {
+		return dto.MCPToolCallResult{
+			Content: []dto.MCPContent{{Type: "text", Text: err.Error()}},
+			IsError: true,
+		}
+	}
+	return dto.MCPToolCallResult{
+		Content:           []dto.MCPContent{{Type: "text", Text: string(text)}},
+		StructuredContent: result,
+	}
+}
+
+func mcpResultResponse(id json.RawMessage, result any) *dto.JSONRPCResponse {
+	return &dto.JSONRPCResponse{JSONRPC: dto.JSONRPCVersion, ID: id, Result: result}
+}
+
+func mcpErrorResponse(id json.RawMessage, code int, message string) *dto.JSONRPCResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &dto.JSONRPCResponse{JSONRPC: dto.JSONRPCVersion, ID: id, Error: &dto.JSONRPCError{Code: code, Message: message}}
+}
+
+func mcpListModels(c *gin.Context, _ json.RawMessage) (any, error) {
+	models, err := getUserOpenAIModels(c)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]gin.H, 0, len(models))
+	for _, m := range models {
+		items = append(items, gin.H{
+			"id":                       m.Id,
+			"owned_by":                 m.OwnedBy,
+			"supported_endpoint_types": m.SupportedEndpointTypes,
+		})
+	}
+	return gin.H{"models": items}, nil
+}
+
+func mcpGetTokenBalance(c *gin.Context, _ json.RawMessage) (any, error) {
+	token, err := model.GetTokenById(c.GetInt("token_id"))
+	if err != nil {
+		return nil, err
+	}
+	userQuota, err := model.GetUserQuota(token.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := token.ExpiredTime
+	if expiresAt == -1 {
+		expiresAt = 0
+	}
+	result := gin.H{
+		"token_name":         token.Name,
+		"unlimited_quota":    token.UnlimitedQuota,
+		"token_used_quota":   token.UsedQuota,
+		"token_used_display": logger.LogQuota(token.UsedQuota),
+		"user_quota":         userQuota,
+		"user_quota_display": logger.LogQuota(userQuota),
+		"expires_at":         expiresAt,
+	}
+	if !token.UnlimitedQuota {
+		result["token_remain_quota"] = token.RemainQuota
+		result["token_remain_display"] = logger.LogQuota(token.RemainQuota)
+	}
+	if creditLimit := common.GetContextKeyInt(c, constant.ContextKeyUserCreditLimit); creditLimit > 0 {
+		result["user_credit_limit"] = creditLimit
+	}
+	return result, nil
+}
+
+func mcpGetUsage(c *gin.Context, arguments json.RawMessage) (any, error) {
+	var args struct {
+		StartTimestamp int64  `json:"start_timestamp"`
+		EndTimestamp   int64  `json:"end_timestamp"`
+		Model          string `json:"model"`
+	}
+	if len(arguments) > 0 {
+		if err := common.Unmarshal(arguments, &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+	if args.EndTimestamp == 0 {
+		args.EndTimestamp = time.Now().Unix()
+	}
+	if args.StartTimestamp == 0 {
+		args.StartTimestamp = args.EndTimestamp - 24*60*60
+	}
+	if args.StartTimestamp > args.EndTimestamp {
+		return nil, errors.New("start_timestamp must not be after end_timestamp")
+	}
+	username := common.GetContextKeyString(c, constant.ContextKeyUserName)
+	tokenName := c.GetString("token_name")
+	if username == "" || tokenName == "" {
+		return nil, errors.New("token context is missing")
+	}
+	stat := model.SumUsedQuota(model.LogTypeConsume, args.StartTimestamp, args.EndTimestamp, args.Model, username, tokenName, 0, "")
+	tokens := model.SumUsedToken(model.LogTypeConsume, args.StartTimestamp, args.EndTimestamp, args.Model, username, tokenName)
+	return gin.H{
+		"start_timestamp": args.StartTimestamp,
+		"end_timestamp":   args.EndTimestamp,
+		"model":           args.Model,
+		"quota":           stat.Quota,
+		"quota_display":   logger.LogQuota(stat.Quota),
+		"tokens":          tokens,
+		"rpm":             stat.Rpm,
+		"tpm":             stat.Tpm,
+	}, nil
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsHandler = promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+
+// Metrics Prometheus 指标，未设置 METRICS_TOKEN 时不开放；令牌只从 Authorization 头读取，避免出现在访问日志中
+func Metrics(c *gin.Context) {
+	if common.MetricsToken == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(common.MetricsToken)) != 1 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
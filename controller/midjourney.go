@@ -20,176 +20,190 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// midjourneyTaskTimeout 提交超过该时间仍未完成的任务视为失败，毫秒
+const midjourneyTaskTimeout = 3600000
+
+// UpdateMidjourneyTaskBulk 任务状态保存在数据库中，重启或切换主节点后由新的主节点继续轮询上游
 func UpdateMidjourneyTaskBulk() {
 	//imageModel := "midjourney"
 	ctx := context.TODO()
 	for {
 		time.Sleep(time.Duration(15) * time.Second)
-
-		tasks := model.GetAllUnFinishTasks()
-		if len(tasks) == 0 {
+		if !model.IsLeader() {
 			continue
 		}
+		updateMidjourneyTasks(ctx)
+	}
+}
 
-		logger.LogInfo(ctx, fmt.Sprintf("检测到未完成的任务数有: %v", len(tasks)))
-		taskChannelM := make(map[int][]string)
-		taskM := make(map[string]*model.Midjourney)
-		nullTaskIds := make([]int, 0)
-		for _, task := range tasks {
-			if task.MjId == "" {
-				// 统计失败的未完成任务
-				nullTaskIds = append(nullTaskIds, task.Id)
-				continue
-			}
-			taskM[task.MjId] = task
-			taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.MjId)
+func updateMidjourneyTasks(ctx context.Context) {
+	tasks := model.GetAllUnFinishTasks()
+	if len(tasks) == 0 {
+		return
+	}
+
+	logger.LogInfo(ctx, fmt.Sprintf("检测到未完成的任务数有: %v", len(tasks)))
+	// 渠道 -> mj_id -> 任务，任务已存在时上游会为多次提交返回同一个 mj_id
+	taskChannelM := make(map[int]map[string][]*model.Midjourney)
+	nullTaskIds := make([]int, 0)
+	for _, task := range tasks {
+		if task.MjId == "" {
+			// 统计失败的未完成任务
+			nullTaskIds = append(nullTaskIds, task.Id)
+			continue
 		}
-		if len(nullTaskIds) > 0 {
-			err := model.MjBulkUpdateByTaskIds(nullTaskIds, map[string]any{
-				"status":   "FAILURE",
-				"progress": "100%",
-			})
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Fix null mj_id task error: %v", err))
-			} else {
-				logger.LogInfo(ctx, fmt.Sprintf("Fix null mj_id task success: %v", nullTaskIds))
-			}
+		if taskChannelM[task.ChannelId] == nil {
+			taskChannelM[task.ChannelId] = make(map[string][]*model.Midjourney)
 		}
-		if len(taskChannelM) == 0 {
-			continue
+		taskChannelM[task.ChannelId][task.MjId] = append(taskChannelM[task.ChannelId][task.MjId], task)
+	}
+	if len(nullTaskIds) > 0 {
+		err := model.MjBulkUpdateByTaskIds(nullTaskIds, map[string]any{
+			"status":   "FAILURE",
+			"progress": "100%",
+		})
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Fix null mj_id task error: %v", err))
+		} else {
+			logger.LogInfo(ctx, fmt.Sprintf("Fix null mj_id task success: %v", nullTaskIds))
 		}
+	}
 
-		for channelId, taskIds := range taskChannelM {
-			logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
-			if len(taskIds) == 0 {
-				continue
-			}
-			midjourneyChannel, err := model.CacheGetChannel(channelId)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
-				err := model.MjBulkUpdate(taskIds, map[string]any{
-					"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
-					"status":      "FAILURE",
-					"progress":    "100%",
-				})
-				if err != nil {
-					logger.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
+	for channelId, taskM := range taskChannelM {
+		logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskM)))
+		midjourneyChannel, err := model.CacheGetChannel(channelId)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
+			for _, sameIdTasks := range taskM {
+				for _, task := range sameIdTasks {
+					task.FailReason = fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
+					task.Status = "FAILURE"
+					if err := service.SaveMidjourneyTask(ctx, task); err != nil {
+						logger.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
+					}
 				}
-				continue
 			}
-			requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
+			continue
+		}
+		taskIds := make([]string, 0, len(taskM))
+		for mjId := range taskM {
+			taskIds = append(taskIds, mjId)
+		}
+		responseItems, err := fetchMidjourneyTasks(midjourneyChannel, taskIds)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Get Task error: %v", err))
+			continue
+		}
 
-			body, _ := json.Marshal(map[string]any{
-				"ids": taskIds,
-			})
-			req, err := http.NewRequest("POST", requestUrl, bytes.NewBuffer(body))
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task error: %v", err))
-				continue
+		returned := make(map[string]bool, len(responseItems))
+		for _, responseItem := range responseItems {
+			returned[responseItem.MjId] = true
+			for _, task := range taskM[responseItem.MjId] {
+				updateMidjourneyTask(ctx, task, responseItem)
 			}
-			// 设置超时时间
-			timeout := time.Second * 15
-			ctx, cancel := context.WithTimeout(context.Background(), timeout)
-			// 使用带有超时的 context 创建新的请求
-			req = req.WithContext(ctx)
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
-			resp, err := service.GetHttpClient().Do(req)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
-				continue
-			}
-			if resp.StatusCode != http.StatusOK {
-				logger.LogError(ctx, fmt.Sprintf("Get Task status code: %d", resp.StatusCode))
-				continue
-			}
-			responseBody, err := io.ReadAll(resp.Body)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task parse body error: %v", err))
-				continue
-			}
-			var responseItems []dto.MidjourneyDto
-			err = json.Unmarshal(responseBody, &responseItems)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task parse body error2: %v, body: %s", err, string(responseBody)))
+		}
+		// 上游重启或清理后不再返回的任务，超时后按失败处理并退还额度
+		nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+		for mjId, sameIdTasks := range taskM {
+			if returned[mjId] {
 				continue
 			}
-			resp.Body.Close()
-			req.Body.Close()
-			cancel()
-
-			for _, responseItem := range responseItems {
-				task := taskM[responseItem.MjId]
-
-				useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - task.SubmitTime
-				// 如果时间超过一小时，且进度不是100%，则认为任务失败
-				if useTime > 3600000 && task.Progress != "100%" {
-					responseItem.FailReason = "上游任务超时（超过1小时）"
-					responseItem.Status = "FAILURE"
-				}
-				if !checkMjTaskNeedUpdate(task, responseItem) {
+			for _, task := range sameIdTasks {
+				if nowMs-task.SubmitTime <= midjourneyTaskTimeout {
 					continue
 				}
-				task.Code = 1
-				task.Progress = responseItem.Progress
-				task.PromptEn = responseItem.PromptEn
-				task.State = responseItem.State
-				task.SubmitTime = responseItem.SubmitTime
-				task.StartTime = responseItem.StartTime
-				task.FinishTime = responseItem.FinishTime
-				task.ImageUrl = responseItem.ImageUrl
-				task.Status = responseItem.Status
-				task.FailReason = responseItem.FailReason
-				if responseItem.Properties != nil {
-					propertiesStr, _ := json.Marshal(responseItem.Properties)
-					task.Properties = string(propertiesStr)
-				}
-				if responseItem.Buttons != nil {
-					buttonStr, _ := json.Marshal(responseItem.Buttons)
-					task.Buttons = string(buttonStr)
-				}
-				// 映射 VideoUrl
-				task.VideoUrl = responseItem.VideoUrl
-
-				// 映射 VideoUrls - 将数组序列化为 JSON 字符串
-				if responseItem.VideoUrls != nil && len(responseItem.VideoUrls) > 0 {
-					videoUrlsStr, err := json.Marshal(responseItem.VideoUrls)
-					if err != nil {
-						logger.LogError(ctx, fmt.Sprintf("序列化 VideoUrls 失败: %v", err))
-						task.VideoUrls = "[]" // 失败时设置为空数组
-					} else {
-						task.VideoUrls = string(videoUrlsStr)
-					}
-				} else {
-					task.VideoUrls = "" // 空值时清空字段
-				}
-
-				shouldReturnQuota := false
-				if (task.Progress != "100%" && responseItem.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
-					logger.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
-					task.Progress = "100%"
-					if task.Quota != 0 {
-						shouldReturnQuota = true
-					}
-				}
-				err = task.Update()
-				if err != nil {
+				task.FailReason = "上游未返回任务（超过1小时）"
+				task.Status = "FAILURE"
+				if err := service.SaveMidjourneyTask(ctx, task); err != nil {
 					logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
-				} else {
-					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
-						if err != nil {
-							logger.LogError(ctx, "fail to increase user quota: "+err.Error())
-						}
-						logContent := fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, logger.LogQuota(task.Quota))
-						model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-					}
 				}
 			}
 		}
 	}
 }
 
+func fetchMidjourneyTasks(midjourneyChannel *model.Channel, taskIds []string) ([]dto.MidjourneyDto, error) {
+	requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
+	body, _ := json.Marshal(map[string]any{
+		"ids": taskIds,
+	})
+	// 设置超时时间
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", requestUrl, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("mj-api-secret", midjourneyChannel.Key)
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var responseItems []dto.MidjourneyDto
+	if err := json.Unmarshal(responseBody, &responseItems); err != nil {
+		return nil, fmt.Errorf("parse body error: %v, body: %s", err, string(responseBody))
+	}
+	return responseItems, nil
+}
+
+func updateMidjourneyTask(ctx context.Context, task *model.Midjourney, responseItem dto.MidjourneyDto) {
+	useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - task.SubmitTime
+	// 如果时间超过一小时，且进度不是100%，则认为任务失败
+	if useTime > midjourneyTaskTimeout && task.Progress != "100%" {
+		responseItem.FailReason = "上游任务超时（超过1小时）"
+		responseItem.Status = "FAILURE"
+	}
+	if !checkMjTaskNeedUpdate(task, responseItem) {
+		return
+	}
+	task.Code = 1
+	task.Progress = responseItem.Progress
+	task.PromptEn = responseItem.PromptEn
+	task.State = responseItem.State
+	task.SubmitTime = responseItem.SubmitTime
+	task.StartTime = responseItem.StartTime
+	task.FinishTime = responseItem.FinishTime
+	task.ImageUrl = responseItem.ImageUrl
+	task.Status = responseItem.Status
+	task.FailReason = responseItem.FailReason
+	if responseItem.Properties != nil {
+		propertiesStr, _ := json.Marshal(responseItem.Properties)
+		task.Properties = string(propertiesStr)
+	}
+	if responseItem.Buttons != nil {
+		buttonStr, _ := json.Marshal(responseItem.Buttons)
+		task.Buttons = string(buttonStr)
+	}
+	// 映射 VideoUrl
+	task.VideoUrl = responseItem.VideoUrl
+
+	// 映射 VideoUrls - 将数组序列化为 JSON 字符串
+	if responseItem.VideoUrls != nil && len(responseItem.VideoUrls) > 0 {
+		videoUrlsStr, err := json.Marshal(responseItem.VideoUrls)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("序列化 VideoUrls 失败: %v", err))
+			task.VideoUrls = "[]" // 失败时设置为空数组
+		} else {
+			task.VideoUrls = string(videoUrlsStr)
+		}
+	} else {
+		task.VideoUrls = "" // 空值时清空字段
+	}
+
+	if err := service.SaveMidjourneyTask(ctx, task); err != nil {
+		logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
+	}
+}
+
 func checkMjTaskNeedUpdate(oldTask *model.Midjourney, newTask dto.MidjourneyDto) bool {
 	if oldTask.Code != 1 {
 		return true
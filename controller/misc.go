@@ -11,9 +11,11 @@ import (
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/console_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-gonic/gin"
@@ -31,14 +33,30 @@ func TestStatus(c *gin.Context) {
 	// 获取HTTP统计信息
 	httpStats := middleware.GetStats()
 	c.JSON(http.StatusOK, gin.H{
-		"success":    true,
-		"message":    "Server is running",
-		"http_stats": httpStats,
+		"success":        true,
+		"message":        "Server is running",
+		"http_stats":     httpStats,
+		"redis_health":   common.GetRedisHealthStats(),
+		"clickhouse":     model.GetClickHouseLogStats(),
+		"log_batch":      model.GetLogBatchStats(),
+		"pricing":        ratio_setting.GetPricingSnapshotStats(),
+		"db_replicas":    model.GetReplicaStats(),
+		"leader":         model.GetLeaderStatus(),
+		"config_sync":    model.GetConfigSyncStatus(),
+		"caches":         model.GetCacheStats(),
+		"upstream_pools": service.GetUpstreamPoolStats(),
 	})
 	return
 }
 
 func GetStatus(c *gin.Context) {
+	if common.ShuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": "Server is shutting down",
+		})
+		return
+	}
 
 	cs := console_setting.GetConsoleSetting()
 	common.OptionMapRWMutex.RLock()
@@ -91,6 +109,7 @@ func GetStatus(c *gin.Context) {
 		"usd_exchange_rate": operation_setting.USDExchangeRate,
 		"price":             operation_setting.Price,
 		"stripe_unit_price": setting.StripeUnitPrice,
+		"currency_display":  service.CurrencyDisplayInfo(),
 
 		// 面板启用开关
 		"api_info_enabled":      cs.ApiInfoEnabled,
@@ -105,6 +124,8 @@ func GetStatus(c *gin.Context) {
 		"oidc_enabled":                system_setting.GetOIDCSettings().Enabled,
 		"oidc_client_id":              system_setting.GetOIDCSettings().ClientId,
 		"oidc_authorization_endpoint": system_setting.GetOIDCSettings().AuthorizationEndpoint,
+		"ldap_login":                  system_setting.GetLDAPSettings().Enabled,
+		"twofa_email_recovery":        system_setting.GetTwoFASettings().EmailRecoveryEnabled,
 		"passkey_login":               passkeySetting.Enabled,
 		"passkey_display_name":        passkeySetting.RPDisplayName,
 		"passkey_rp_id":               passkeySetting.RPID,
@@ -139,6 +160,7 @@ func GetStatus(c *gin.Context) {
 			ClientId              string `json:"client_id"`
 			AuthorizationEndpoint string `json:"authorization_endpoint"`
 			Scopes                string `json:"scopes"`
+			UsePKCE               bool   `json:"use_pkce"`
 		}
 		providersInfo := make([]CustomOAuthInfo, 0, len(customProviders))
 		for _, p := range customProviders {
@@ -149,6 +171,7 @@ func GetStatus(c *gin.Context) {
 				ClientId:              config.ClientId,
 				AuthorizationEndpoint: config.AuthorizationEndpoint,
 				Scopes:                config.Scopes,
+				UsePKCE:               config.UsePKCE,
 			})
 		}
 		data["custom_oauth_providers"] = providersInfo
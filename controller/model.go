@@ -109,7 +109,8 @@ func init() {
 	})
 }
 
-func ListModels(c *gin.Context, modelType int) {
+// getUserOpenAIModels 返回当前令牌可用的模型列表，启用模型限制时以令牌的限制为准
+func getUserOpenAIModels(c *gin.Context) ([]dto.OpenAIModels, error) {
 	userOpenAiModels := make([]dto.OpenAIModels, 0)
 
 	acceptUnsetRatioModel := operation_setting.SelfUseModeEnabled
@@ -132,7 +133,11 @@ func ListModels(c *gin.Context, modelType int) {
 		} else {
 			tokenModelLimit = map[string]bool{}
 		}
+		userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
 		for allowModel, _ := range tokenModelLimit {
+			if !operation_setting.IsModelAllowedForGroup(userGroup, allowModel) {
+				continue
+			}
 			if !acceptUnsetRatioModel {
 				_, _, exist := ratio_setting.GetModelRatioOrPrice(allowModel)
 				if !exist {
@@ -156,11 +161,7 @@ func ListModels(c *gin.Context, modelType int) {
 		userId := c.GetInt("id")
 		userGroup, err := model.GetUserGroup(userId, false)
 		if err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": "get user group failed",
-			})
-			return
+			return nil, err
 		}
 		group := userGroup
 		tokenGroup := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
@@ -181,6 +182,9 @@ func ListModels(c *gin.Context, modelType int) {
 			models = model.GetGroupEnabledModels(group)
 		}
 		for _, modelName := range models {
+			if !operation_setting.IsModelAllowedForGroup(userGroup, modelName) {
+				continue
+			}
 			if !acceptUnsetRatioModel {
 				_, _, exist := ratio_setting.GetModelRatioOrPrice(modelName)
 				if !exist {
@@ -200,6 +204,30 @@ func ListModels(c *gin.Context, modelType int) {
 				})
 			}
 		}
+		// 虚拟模型在默认目标模型可用时一并列出
+		for _, virtual := range listVirtualModels() {
+			if common.StringsContains(models, virtual.Default) && !common.StringsContains(models, virtual.Name) {
+				userOpenAiModels = append(userOpenAiModels, dto.OpenAIModels{
+					Id:                     virtual.Name,
+					Object:                 "model",
+					Created:                1626777600,
+					OwnedBy:                "custom",
+					SupportedEndpointTypes: model.GetModelSupportEndpointTypes(virtual.Default),
+				})
+			}
+		}
+	}
+	return userOpenAiModels, nil
+}
+
+func ListModels(c *gin.Context, modelType int) {
+	userOpenAiModels, err := getUserOpenAIModels(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "get user group failed",
+		})
+		return
 	}
 
 	switch modelType {
@@ -272,6 +300,11 @@ func RetrieveModel(c *gin.Context, modelType int) {
 				DisplayName: aiModel.Id,
 				Type:        "model",
 			})
+		case constant.ChannelTypeGemini:
+			c.JSON(200, dto.GeminiModel{
+				Name:        aiModel.Id,
+				DisplayName: aiModel.Id,
+			})
 		default:
 			c.JSON(200, aiModel)
 		}
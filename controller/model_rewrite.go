@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type modelRewriteUpdateRequest struct {
+	Enabled bool                                 `json:"enabled"`
+	Rules   []operation_setting.ModelRewriteRule `json:"rules"`
+}
+
+type modelRewriteDryRunRequest struct {
+	Model string `json:"model"`
+	Group string `json:"group"`
+	Time  int64  `json:"time,omitempty"` // 按指定时间评估时间段规则，默认当前时间
+	// 传入时使用这组规则试算，便于保存前验证
+	Rules []operation_setting.ModelRewriteRule `json:"rules,omitempty"`
+}
+
+func GetModelRewriteRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    operation_setting.GetModelRewriteSetting(),
+	})
+}
+
+func UpdateModelRewriteRules(c *gin.Context) {
+	var req modelRewriteUpdateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Rules == nil {
+		req.Rules = []operation_setting.ModelRewriteRule{}
+	}
+	if err := operation_setting.ValidateModelRewriteRules(req.Rules); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "模型改写规则设置失败: " + err.Error(),
+		})
+		return
+	}
+	rules, err := common.Marshal(req.Rules)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateOption("model_rewrite_setting.rules", string(rules)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateOption("model_rewrite_setting.enabled", strconv.FormatBool(req.Enabled)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    operation_setting.GetModelRewriteSetting(),
+	})
+}
+
+// DryRunModelRewrite 查看指定模型在某分组下会被改写成什么，不受总开关影响
+func DryRunModelRewrite(c *gin.Context) {
+	var req modelRewriteDryRunRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Model == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "model is required",
+		})
+		return
+	}
+	rules := req.Rules
+	if rules == nil {
+		rules = operation_setting.GetModelRewriteSetting().Rules
+	} else if err := operation_setting.ValidateModelRewriteRules(rules); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	now := time.Now()
+	if req.Time > 0 {
+		now = time.Unix(req.Time, 0)
+	}
+	resolved, rule := service.EvaluateModelRewriteRules(rules, req.Model, req.Group, now)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"model":     req.Model,
+			"group":     req.Group,
+			"resolved":  resolved,
+			"rewritten": rule != nil,
+			"rule":      rule,
+			"enabled":   operation_setting.GetModelRewriteSetting().Enabled,
+		},
+	})
+}
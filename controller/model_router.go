@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type modelRouterUpdateRequest struct {
+	Enabled bool                             `json:"enabled"`
+	Models  []operation_setting.VirtualModel `json:"models"`
+}
+
+type modelRouterDryRunRequest struct {
+	Model string `json:"model"`
+	Group string `json:"group"`
+	// 传入完整请求体时从中提取特征，否则直接使用 features
+	Body     json.RawMessage             `json:"body,omitempty"`
+	Features *service.ModelRouteFeatures `json:"features,omitempty"`
+	// 传入时使用这组虚拟模型试算，便于保存前验证
+	Models []operation_setting.VirtualModel `json:"models,omitempty"`
+}
+
+func listVirtualModels() []operation_setting.VirtualModel {
+	setting := operation_setting.GetModelRouterSetting()
+	if !setting.Enabled {
+		return nil
+	}
+	return setting.Models
+}
+
+func GetModelRouterSetting(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    operation_setting.GetModelRouterSetting(),
+	})
+}
+
+func UpdateModelRouterSetting(c *gin.Context) {
+	var req modelRouterUpdateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Models == nil {
+		req.Models = []operation_setting.VirtualModel{}
+	}
+	if err := operation_setting.ValidateVirtualModels(req.Models); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "虚拟模型设置失败: " + err.Error(),
+		})
+		return
+	}
+	models, err := common.Marshal(req.Models)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateOption("model_router_setting.models", string(models)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateOption("model_router_setting.enabled", strconv.FormatBool(req.Enabled)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    operation_setting.GetModelRouterSetting(),
+	})
+}
+
+// DryRunModelRouter 查看虚拟模型对给定请求会路由到哪个模型，不受总开关影响
+func DryRunModelRouter(c *gin.Context) {
+	var req modelRouterDryRunRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Model == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "model is required",
+		})
+		return
+	}
+	models := req.Models
+	if models == nil {
+		models = operation_setting.GetModelRouterSetting().Models
+	} else if err := operation_setting.ValidateVirtualModels(models); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var virtual *operation_setting.VirtualModel
+	for i := range models {
+		if models[i].Name == req.Model {
+			virtual = &models[i]
+			break
+		}
+	}
+	if virtual == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "virtual model not found: " + req.Model,
+		})
+		return
+	}
+	features := service.ModelRouteFeatures{}
+	if len(req.Body) > 0 {
+		features = service.ExtractModelRouteFeatures(req.Body, virtual.Default)
+	} else if req.Features != nil {
+		features = *req.Features
+	}
+	resolved, rule := service.EvaluateModelRouter(virtual, features, req.Group)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"model":    req.Model,
+			"group":    req.Group,
+			"features": features,
+			"resolved": resolved,
+			"rule":     rule,
+			"enabled":  operation_setting.GetModelRouterSetting().Enabled,
+		},
+	})
+}
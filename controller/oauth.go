@@ -27,15 +27,27 @@ func GenerateOAuthCode(c *gin.Context) {
 		session.Set("aff", affCode)
 	}
 	session.Set("oauth_state", state)
+	// Custom providers with PKCE enabled get a code challenge; the verifier stays in the session
+	codeChallenge := ""
+	if genericProvider, ok := oauth.GetProvider(c.Query("provider")).(*oauth.GenericOAuthProvider); ok && genericProvider.GetConfig().UsePKCE {
+		verifier, challenge, err := oauth.GeneratePKCE()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		session.Set(oauth.PKCEVerifierSessionKey, verifier)
+		codeChallenge = challenge
+	}
 	err := session.Save()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    state,
+		"success":        true,
+		"message":        "",
+		"data":           state,
+		"code_challenge": codeChallenge,
 	})
 }
 
@@ -230,12 +242,25 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 	}
 
 	// User doesn't exist, create new user if registration is enabled
-	if !common.RegisterEnabled {
+	// (custom providers may provision accounts even when registration is disabled)
+	genericProvider, isGeneric := provider.(*oauth.GenericOAuthProvider)
+	if !common.RegisterEnabled && !(isGeneric && genericProvider.GetConfig().AutoProvision) {
 		return nil, &OAuthRegistrationDisabledError{}
 	}
 
 	// Set up new user
 	user.Username = provider.GetProviderPrefix() + strconv.Itoa(model.GetMaxUserId()+1)
+	if isGeneric {
+		// Custom providers keep the mapped username when it is valid and still free
+		if name := oauthUser.Username; name != "" && len(name) <= 20 {
+			if exist, err := model.CheckUserExistOrDeleted(name, ""); err == nil && !exist {
+				user.Username = name
+			}
+		}
+		if group := genericProvider.GetConfig().MapGroup(oauthUser.Groups); group != "" {
+			user.Group = group
+		}
+	}
 	if oauthUser.DisplayName != "" {
 		user.DisplayName = oauthUser.DisplayName
 	} else if oauthUser.Username != "" {
@@ -261,7 +286,7 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 	}
 
 	// For custom providers, create the binding after user is created
-	if genericProvider, ok := provider.(*oauth.GenericOAuthProvider); ok {
+	if isGeneric {
 		binding := &model.UserOAuthBinding{
 			UserId:         user.Id,
 			ProviderId:     genericProvider.GetProviderId(),
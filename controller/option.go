@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/console_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -21,11 +24,7 @@ func GetOptions(c *gin.Context) {
 	var options []*model.Option
 	common.OptionMapRWMutex.Lock()
 	for k, v := range common.OptionMap {
-		if strings.HasSuffix(k, "Token") ||
-			strings.HasSuffix(k, "Secret") ||
-			strings.HasSuffix(k, "Key") ||
-			strings.HasSuffix(k, "secret") ||
-			strings.HasSuffix(k, "api_key") {
+		if isSensitiveOption(k) {
 			continue
 		}
 		options = append(options, &model.Option{
@@ -42,6 +41,42 @@ func GetOptions(c *gin.Context) {
 	return
 }
 
+func isSensitiveOption(key string) bool {
+	return strings.HasSuffix(key, "Token") ||
+		strings.HasSuffix(key, "Secret") ||
+		strings.HasSuffix(key, "Key") ||
+		strings.HasSuffix(key, "secret") ||
+		strings.HasSuffix(key, "password") ||
+		strings.HasSuffix(key, "_key")
+}
+
+// GetEffectiveOptions 返回处理本次请求的实例当前生效的配置与同步状态，敏感配置只显示是否已设置
+func GetEffectiveOptions(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"sync":    model.GetConfigSyncStatus(),
+		"options": maskedOptions(),
+	})
+}
+
+// maskedOptions 复制当前配置，已设置的敏感配置替换为掩码
+func maskedOptions() map[string]string {
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	options := make(map[string]string, len(common.OptionMap))
+	for k, v := range common.OptionMap {
+		if isSensitiveOption(k) && v != "" {
+			v = "******"
+		}
+		options[k] = v
+	}
+	return options
+}
+
+// GetCacheStats 返回本实例各缓存的命中率与失效广播统计
+func GetCacheStats(c *gin.Context) {
+	common.ApiSuccess(c, model.GetCacheStats())
+}
+
 type OptionUpdateRequest struct {
 	Key   string `json:"key"`
 	Value any    `json:"value"`
@@ -92,6 +127,33 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ldap.enabled":
+		if option.Value == "true" && (system_setting.GetLDAPSettings().URL == "" || system_setting.GetLDAPSettings().BaseDN == "") {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用 LDAP 登录，请先填入 LDAP 服务器地址以及 Base DN！",
+			})
+			return
+		}
+	case "ldap.group_role_mapping":
+		if err = service.ValidateLdapGroupRoleMapping(option.Value.(string)); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "LDAP 组角色映射设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "scim.group_mapping":
+		if mapping := option.Value.(string); mapping != "" {
+			var groups map[string]string
+			if err = json.Unmarshal([]byte(mapping), &groups); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "SCIM 组映射设置失败: " + err.Error(),
+				})
+				return
+			}
+		}
 	case "LinuxDOOAuthEnabled":
 		if option.Value == "true" && common.LinuxDOClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -232,6 +294,280 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "channel_disable_rule_setting.rules":
+		var rules []operation_setting.ChannelDisableRule
+		err = json.Unmarshal([]byte(option.Value.(string)), &rules)
+		if err == nil {
+			err = operation_setting.ValidateChannelDisableRules(rules)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "渠道禁用规则设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "model_rewrite_setting.rules":
+		var rules []operation_setting.ModelRewriteRule
+		err = json.Unmarshal([]byte(option.Value.(string)), &rules)
+		if err == nil {
+			err = operation_setting.ValidateModelRewriteRules(rules)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "模型改写规则设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "monitor_setting.upstream_model_sync_minutes":
+		if minutes, err := strconv.ParseFloat(option.Value.(string), 64); err != nil || minutes < 1 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "上游模型同步间隔不能小于 1 分钟",
+			})
+			return
+		}
+	case "currency_setting.packages":
+		var packages []operation_setting.CurrencyPackage
+		err = json.Unmarshal([]byte(option.Value.(string)), &packages)
+		if err == nil {
+			err = operation_setting.ValidateCurrencyPackages(packages)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "币种套餐设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "usage_event_setting.backend":
+		if backend := option.Value.(string); backend != operation_setting.UsageEventBackendKafka && backend != operation_setting.UsageEventBackendNats {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "不支持的用量事件后端: " + backend,
+			})
+			return
+		}
+	case "usage_event_setting.format":
+		if format := option.Value.(string); format != operation_setting.UsageEventFormatJSON && format != operation_setting.UsageEventFormatAvro {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "不支持的用量事件格式: " + format,
+			})
+			return
+		}
+	case "model_router_setting.models":
+		var models []operation_setting.VirtualModel
+		err = json.Unmarshal([]byte(option.Value.(string)), &models)
+		if err == nil {
+			err = operation_setting.ValidateVirtualModels(models)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "虚拟模型设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "pricing_rule_setting.rules":
+		var rules []ratio_setting.PricingRule
+		err = json.Unmarshal([]byte(option.Value.(string)), &rules)
+		if err == nil {
+			err = ratio_setting.ValidatePricingRules(rules)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "差异化定价规则设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "pricing_rule_setting.timezone", "free_tier_setting.timezone":
+		if tz := option.Value.(string); tz != "" {
+			if _, err = time.LoadLocation(tz); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无效的时区: " + tz,
+				})
+				return
+			}
+		}
+	case "referral_setting.commission_rate":
+		rate, err := strconv.ParseFloat(option.Value.(string), 64)
+		if err != nil || rate < 0 || rate > 100 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "返佣比例必须在 0 到 100 之间",
+			})
+			return
+		}
+	case "model_access_setting.groups":
+		var groups map[string]operation_setting.GroupModelPolicy
+		err = json.Unmarshal([]byte(option.Value.(string)), &groups)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分组模型访问策略设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "moderation_setting.providers":
+		var providers []string
+		err = json.Unmarshal([]byte(option.Value.(string)), &providers)
+		if err == nil {
+			for _, p := range providers {
+				if !operation_setting.IsValidModerationProvider(p) {
+					err = fmt.Errorf("不支持的审核方式 %s", p)
+					break
+				}
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "内容审核方式设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "moderation_setting.patterns":
+		var patterns []string
+		err = json.Unmarshal([]byte(option.Value.(string)), &patterns)
+		if err == nil {
+			err = service.ValidateModerationPatterns(patterns)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "内容审核正则设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "moderation_setting.groups", "moderation_setting.models":
+		var rules map[string]operation_setting.ModerationRule
+		err = json.Unmarshal([]byte(option.Value.(string)), &rules)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "内容审核规则设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "pii_setting.custom_rules":
+		var rules []operation_setting.PIIRule
+		err = json.Unmarshal([]byte(option.Value.(string)), &rules)
+		if err == nil {
+			err = service.ValidatePIIRules(rules)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "个人信息识别规则设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "pii_setting.groups":
+		var policies map[string]operation_setting.PIIPolicy
+		err = json.Unmarshal([]byte(option.Value.(string)), &policies)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分组脱敏策略设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "guardrail_setting.groups", "guardrail_setting.tokens":
+		var rules map[string]operation_setting.GuardrailRule
+		err = json.Unmarshal([]byte(option.Value.(string)), &rules)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "护栏提示词设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "param_policy_setting.groups", "param_policy_setting.users":
+		var policies map[string]operation_setting.ParamPolicy
+		err = json.Unmarshal([]byte(option.Value.(string)), &policies)
+		if err == nil {
+			err = operation_setting.ValidateParamPolicies(policies)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "采样参数策略设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "relay_timeout_setting.models":
+		var policies map[string]operation_setting.RelayTimeoutPolicy
+		err = json.Unmarshal([]byte(option.Value.(string)), &policies)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "超时策略设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "context_limit_setting.models":
+		var windows map[string]int
+		err = json.Unmarshal([]byte(option.Value.(string)), &windows)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "上下文窗口设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "transform_hook_setting.hooks":
+		var hooks []operation_setting.TransformHookConfig
+		err = json.Unmarshal([]byte(option.Value.(string)), &hooks)
+		if err == nil {
+			err = service.ValidateTransformHooks(hooks)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "请求转换器设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "token_rotation_setting.groups":
+		var groups map[string]operation_setting.GroupRotationPolicy
+		err = json.Unmarshal([]byte(option.Value.(string)), &groups)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分组令牌轮换策略设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "StripeQuotaPackages":
+		if err = ValidateStripeQuotaPackages(option.Value.(string)); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "Stripe 额度套餐设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "body_capture_setting.channel_sample_rates", "body_capture_setting.token_sample_rates":
+		var rates map[int]float64
+		err = json.Unmarshal([]byte(option.Value.(string)), &rates)
+		if err == nil {
+			for id, rate := range rates {
+				if rate < 0 || rate > 1 {
+					err = fmt.Errorf("#%d 的采样率必须在 0 到 1 之间", id)
+					break
+				}
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "采样率设置失败: " + err.Error(),
+			})
+			return
+		}
 	}
 	err = model.UpdateOption(option.Key, option.Value.(string))
 	if err != nil {
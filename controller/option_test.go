@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsMaskS3Credentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	common.OptionMapRWMutex.Lock()
+	original := common.OptionMap
+	common.OptionMap = map[string]string{
+		"file_setting.s3_bucket":     "files",
+		"file_setting.s3_access_key": "AKIAEXAMPLE",
+		"file_setting.s3_secret_key": "secret-value",
+	}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = original
+		common.OptionMapRWMutex.Unlock()
+	})
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/option/", nil)
+	GetOptions(c)
+	var listResp struct {
+		Data []model.Option `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listResp))
+	listed := make(map[string]string)
+	for _, option := range listResp.Data {
+		listed[option.Key] = option.Value
+	}
+	require.Equal(t, "files", listed["file_setting.s3_bucket"])
+	require.NotContains(t, listed, "file_setting.s3_access_key")
+	require.NotContains(t, listed, "file_setting.s3_secret_key")
+
+	effective := maskedOptions()
+	require.Equal(t, "files", effective["file_setting.s3_bucket"])
+	require.Equal(t, "******", effective["file_setting.s3_access_key"])
+	require.Equal(t, "******", effective["file_setting.s3_secret_key"])
+}
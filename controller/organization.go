@@ -0,0 +1,433 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type organizationQuotaRequest struct {
+	Quota int `json:"quota"` // 正数增加，负数扣减
+}
+
+type organizationMemberRequest struct {
+	UserId int `json:"user_id"`
+	Role   int `json:"role"`
+}
+
+type organizationSelfMemberRequest struct {
+	Id          int    `json:"id"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	DisplayName string `json:"display_name"`
+	Role        int    `json:"role"`
+	Status      int    `json:"status"`
+}
+
+type organizationSelfTokenRequest struct {
+	Id     int `json:"id"`
+	Status int `json:"status"`
+}
+
+func getUsageRange(c *gin.Context) (int64, int64) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return startTimestamp, endTimestamp
+}
+
+func GetOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetOrganizations(strings.TrimSpace(c.Query("keyword")), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	org, err := model.GetOrganizationById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func AddOrganization(c *gin.Context) {
+	org := model.Organization{}
+	if err := c.ShouldBindJSON(&org); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org.Id = 0
+	org.UsedQuota = 0
+	if org.Quota < 0 {
+		common.ApiErrorMsg(c, "额度不能为负数")
+		return
+	}
+	if err := org.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := org.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func UpdateOrganization(c *gin.Context) {
+	input := model.Organization{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org, err := model.GetOrganizationById(input.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org.Name = input.Name
+	org.Description = input.Description
+	org.Status = input.Status
+	org.Groups = input.Groups
+	if err := org.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := org.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteOrganizationById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// AdjustOrganizationQuota 调整组织额度池
+func AdjustOrganizationQuota(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := organizationQuotaRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetOrganizationById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var err error
+	if req.Quota >= 0 {
+		err = model.IncreaseOrganizationQuota(id, req.Quota)
+	} else {
+		err = model.DecreaseOrganizationQuota(id, -req.Quota)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org, err := model.GetOrganizationById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	listOrganizationMembers(c, id)
+}
+
+// SetOrganizationMember 将用户加入组织或修改其组织角色，用户原有的个人额度保持不变但不再使用
+func SetOrganizationMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := organizationMemberRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetOrganizationById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(req.UserId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.OrganizationId != 0 && user.OrganizationId != id {
+		common.ApiErrorMsg(c, "该用户已属于其他组织，请先将其移出")
+		return
+	}
+	if err := model.SetUserOrganization(user.Id, id, req.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func RemoveOrganizationMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	if _, err := model.GetOrganizationMember(id, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.SetUserOrganization(userId, 0, 0); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationUsage(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	respondOrganizationUsage(c, id)
+}
+
+// GetOrganizationsUsage 按组织汇总消费，用于对各组织分别出账
+func GetOrganizationsUsage(c *gin.Context) {
+	startTimestamp, endTimestamp := getUsageRange(c)
+	usages, err := model.GetOrganizationsUsage(startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, usages)
+}
+
+func listOrganizationMembers(c *gin.Context, organizationId int) {
+	pageInfo := common.GetPageQuery(c)
+	users, total, err := model.GetOrganizationMembers(organizationId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(users)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func respondOrganizationUsage(c *gin.Context, organizationId int) {
+	startTimestamp, endTimestamp := getUsageRange(c)
+	byModel, byMember, err := model.GetOrganizationUsage(organizationId, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"models":  byModel,
+		"members": byMember,
+	})
+}
+
+// GetSelfOrganization 当前用户所属组织的信息与额度池余额
+func GetSelfOrganization(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.OrganizationId == 0 {
+		common.ApiSuccess(c, nil)
+		return
+	}
+	org, err := model.GetOrganizationById(user.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization": org,
+		"role":         user.OrganizationRole,
+	})
+}
+
+func GetSelfOrganizationMembers(c *gin.Context) {
+	listOrganizationMembers(c, c.GetInt("organization_id"))
+}
+
+// AddSelfOrganizationMember 组织管理员创建成员账号，新账号直接使用组织额度池
+func AddSelfOrganizationMember(c *gin.Context) {
+	req := organizationSelfMemberRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user := model.User{
+		Username:    strings.TrimSpace(req.Username),
+		Password:    req.Password,
+		DisplayName: strings.TrimSpace(req.DisplayName),
+		Role:        common.RoleCommonUser,
+	}
+	if user.Username == "" || user.Password == "" {
+		common.ApiErrorMsg(c, "用户名和密码不能为空")
+		return
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = user.Username
+	}
+	if err := common.Validate.Struct(&user); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := user.Insert(0); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.SetUserOrganization(user.Id, c.GetInt("organization_id"), req.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"id": user.Id})
+}
+
+// getManageableMember 组织管理员只能管理本组织内的普通用户，且不能管理自己
+func getManageableMember(c *gin.Context, userId int) (*model.User, error) {
+	if userId == c.GetInt("id") {
+		return nil, errors.New("不能修改自己的组织成员信息")
+	}
+	user, err := model.GetOrganizationMember(c.GetInt("organization_id"), userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("成员不存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Role >= common.RoleAdminUser {
+		return nil, errors.New("无权管理系统管理员")
+	}
+	return user, nil
+}
+
+func UpdateSelfOrganizationMember(c *gin.Context) {
+	req := organizationSelfMemberRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := getManageableMember(c, req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Role != 0 && req.Role != user.OrganizationRole {
+		if err := model.SetUserOrganization(user.Id, user.OrganizationId, req.Role); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	switch req.Status {
+	case common.UserStatusEnabled:
+		err = model.EnableUser(user.Id)
+	case common.UserStatusDisabled:
+		err = model.DisableUser(user.Id)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// RemoveSelfOrganizationMember 将成员移出组织，账号保留并回到使用个人额度
+func RemoveSelfOrganizationMember(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("id"))
+	user, err := getManageableMember(c, userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.SetUserOrganization(user.Id, 0, 0); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetSelfOrganizationTokens(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	tokens, total, err := model.GetOrganizationTokens(c.GetInt("organization_id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, token := range tokens {
+		token.Clean()
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(tokens)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// UpdateSelfOrganizationToken 组织管理员启用或禁用成员令牌
+func UpdateSelfOrganizationToken(c *gin.Context) {
+	req := organizationSelfTokenRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Status != common.TokenStatusEnabled && req.Status != common.TokenStatusDisabled {
+		common.ApiErrorMsg(c, "只能启用或禁用令牌")
+		return
+	}
+	token, err := model.GetOrganizationToken(c.GetInt("organization_id"), req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Status == common.TokenStatusEnabled {
+		if token.Status == common.TokenStatusExpired && token.ExpiredTime <= common.GetTimestamp() && token.ExpiredTime != -1 {
+			common.ApiErrorMsg(c, "令牌已过期，无法启用")
+			return
+		}
+		if token.Status == common.TokenStatusExhausted && token.RemainQuota <= 0 && !token.UnlimitedQuota {
+			common.ApiErrorMsg(c, "令牌额度已用尽，无法启用")
+			return
+		}
+	}
+	token.Status = req.Status
+	if err := token.SelectUpdate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	result := *token
+	result.Clean()
+	common.ApiSuccess(c, result)
+}
+
+func DeleteSelfOrganizationToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	token, err := model.GetOrganizationToken(c.GetInt("organization_id"), id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := token.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetSelfOrganizationUsage(c *gin.Context) {
+	respondOrganizationUsage(c, c.GetInt("organization_id"))
+}
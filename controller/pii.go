@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPIIRedactionStats 返回进程启动以来各分组、各规则的脱敏次数
+func GetPIIRedactionStats(c *gin.Context) {
+	common.ApiSuccess(c, service.GetPIIRedactionStats())
+}
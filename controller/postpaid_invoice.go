@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func respondPostpaidInvoices(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	invoices, total, err := model.GetPostpaidInvoices(userId, c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, invoice := range invoices {
+		invoice.DisplayAmounts = service.QuotaCurrencyAmounts(int64(invoice.Amount))
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfPostpaidInvoices(c *gin.Context) {
+	respondPostpaidInvoices(c, c.GetInt("id"))
+}
+
+func GetPostpaidInvoices(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	respondPostpaidInvoices(c, userId)
+}
+
+// SettlePostpaidInvoice 管理员确认收款后结清账单，不会自动恢复已停用的用户
+func SettlePostpaidInvoice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的账单 ID")
+		return
+	}
+	invoice, err := model.SettlePostpaidInvoice(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, invoice)
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetQuotaGrants(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	grants, total, err := model.GetQuotaGrants(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(grants)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func CreateQuotaGrant(c *gin.Context) {
+	grant := model.QuotaGrant{}
+	if err := c.ShouldBindJSON(&grant); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	grant.Id = 0
+	if err := grant.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := grant.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, grant)
+}
+
+func UpdateQuotaGrant(c *gin.Context) {
+	input := model.QuotaGrant{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	old, err := model.GetQuotaGrantById(input.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := input.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	input.CreatedAt = old.CreatedAt
+	if err := input.Update(old); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, input)
+}
+
+func DeleteQuotaGrant(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteQuotaGrantById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetQuotaGrantRecords(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	grantId, _ := strconv.Atoi(c.Query("grant_id"))
+	records, total, err := model.GetQuotaGrantRecords(grantId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(records)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RunQuotaGrant 管理员手动执行一次发放，不影响计划的周期发放
+func RunQuotaGrant(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	grant, err := model.GetQuotaGrantById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	period := fmt.Sprintf("manual %s", time.Now().Format("2006-01-02 15:04:05"))
+	record, err := service.RunQuotaGrant(c.Request.Context(), grant, period)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, record)
+}
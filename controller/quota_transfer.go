@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type quotaTransferRequest struct {
+	ToUsername string `json:"to_username"`
+	Quota      int    `json:"quota"`
+	Remark     string `json:"remark"`
+}
+
+type tokenQuotaMoveRequest struct {
+	UserId      int `json:"user_id"`
+	FromTokenId int `json:"from_token_id"`
+	ToTokenId   int `json:"to_token_id"`
+	Quota       int `json:"quota"`
+}
+
+// canTransferQuota 组织成员使用组织额度池，后付费用户可透支，二者都不能转账
+func canTransferQuota(user *model.User) error {
+	if user.Status != common.UserStatusEnabled {
+		return errors.New("用户已被封禁")
+	}
+	if user.OrganizationId != 0 {
+		return errors.New("组织成员不能转账")
+	}
+	if user.BillingMode == common.UserBillingModePostpaid {
+		return errors.New("后付费用户不能转账")
+	}
+	return nil
+}
+
+// checkTransferLimits 校验单笔限额，每日限额在 model.TransferUserQuota 的事务中校验
+func checkTransferLimits(quota int, setting *operation_setting.QuotaTransferSetting) error {
+	if quota < setting.MinQuota || quota <= 0 {
+		return fmt.Errorf("单笔转账额度最少为 %s", logger.LogQuota(max(setting.MinQuota, 1)))
+	}
+	if setting.MaxQuota > 0 && quota > setting.MaxQuota {
+		return fmt.Errorf("单笔转账额度最多为 %s", logger.LogQuota(setting.MaxQuota))
+	}
+	return nil
+}
+
+// TransferSelfQuota 用户将自己的部分额度转给另一个用户，手续费由转出方额外支付
+func TransferSelfQuota(c *gin.Context) {
+	setting := operation_setting.GetQuotaTransferSetting()
+	if !setting.Enabled {
+		common.ApiErrorMsg(c, "转账功能未开启")
+		return
+	}
+	req := quotaTransferRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req.ToUsername = strings.TrimSpace(req.ToUsername)
+	req.Remark = strings.TrimSpace(req.Remark)
+	if len(req.Remark) > 255 {
+		common.ApiErrorMsg(c, "备注不能超过 255 个字符")
+		return
+	}
+	userId := c.GetInt("id")
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := canTransferQuota(user); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recipient, err := model.GetTransferRecipient(req.ToUsername)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		common.ApiErrorMsg(c, "收款用户不存在")
+		return
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if recipient.Id == user.Id {
+		common.ApiErrorMsg(c, "不能转账给自己")
+		return
+	}
+	if err := canTransferQuota(recipient); err != nil {
+		common.ApiErrorMsg(c, "收款用户无法接收转账")
+		return
+	}
+	if err := checkTransferLimits(req.Quota, setting); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	fee := setting.CalculateFee(req.Quota)
+	now := time.Now()
+	transfer, err := model.TransferUserQuota(user.Id, recipient.Id, req.Quota, fee, req.Remark, model.QuotaTransferDailyLimit{
+		Since:      time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Unix(),
+		CountLimit: setting.DailyCountLimit,
+		QuotaLimit: setting.DailyQuotaLimit,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if system_setting.GetAuditLogSettings().Enabled {
+		service.RecordAuditLog(&model.AuditLog{
+			UserId:     user.Id,
+			Username:   user.Username,
+			Ip:         c.ClientIP(),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Entity:     "quota_transfer",
+			EntityId:   strconv.Itoa(transfer.Id),
+			Action:     model.AuditActionCreate,
+			StatusCode: 200,
+			Success:    true,
+		}, nil, map[string]any{
+			"from_user_id": transfer.FromUserId,
+			"to_user_id":   transfer.ToUserId,
+			"quota":        transfer.Quota,
+			"fee":          transfer.Fee,
+		})
+	}
+	common.ApiSuccess(c, transfer)
+}
+
+func GetSelfQuotaTransfers(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	transfers, total, err := model.GetQuotaTransfers(c.GetInt("id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(transfers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetQuotaTransfers(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	transfers, total, err := model.GetQuotaTransfers(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(transfers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// MoveTokenQuota 管理员在同一用户的令牌之间调配已分配的额度，不改变用户余额
+func MoveTokenQuota(c *gin.Context) {
+	req := tokenQuotaMoveRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	from, to, err := model.MoveTokenQuota(req.UserId, req.FromTokenId, req.ToTokenId, req.Quota)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	from.Clean()
+	to.Clean()
+	common.ApiSuccess(c, gin.H{
+		"from": from,
+		"to":   to,
+	})
+}
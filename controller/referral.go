@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSelfReferral 当前用户的邀请返佣汇总
+func GetSelfReferral(c *gin.Context) {
+	summary, err := model.GetReferralSummary(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, summary)
+}
+
+func GetSelfReferralInvitees(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	referrals, total, err := model.GetReferrals(c.GetInt("id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(referrals)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfReferralCommissions(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	commissions, total, err := model.GetReferralCommissions(c.GetInt("id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(commissions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetReferrals 管理员查看邀请关系，可按 inviter_id 筛选
+func GetReferrals(c *gin.Context) {
+	inviterId, _ := strconv.Atoi(c.Query("inviter_id"))
+	pageInfo := common.GetPageQuery(c)
+	referrals, total, err := model.GetReferrals(inviterId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(referrals)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetReferralCommissions 管理员查看返佣记录，可按 inviter_id 筛选
+func GetReferralCommissions(c *gin.Context) {
+	inviterId, _ := strconv.Atoi(c.Query("inviter_id"))
+	pageInfo := common.GetPageQuery(c)
+	commissions, total, err := model.GetReferralCommissions(inviterId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(commissions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetReferralRates(c *gin.Context) {
+	rates, err := model.GetReferralRates()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, rates)
+}
+
+type SetReferralRateRequest struct {
+	UserId int     `json:"user_id"`
+	Rate   float64 `json:"rate"`
+}
+
+// SetReferralRate 为指定邀请人单独设置返佣比例
+func SetReferralRate(c *gin.Context) {
+	var req SetReferralRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserId == 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := model.SetReferralRate(req.UserId, req.Rate); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func DeleteReferralRate(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.DeleteReferralRate(userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
@@ -29,12 +31,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 func relayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
 	var err *types.NewAPIError
 	switch info.RelayMode {
-	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits:
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		err = relay.ImageHelper(c, info)
 	case relayconstant.RelayModeAudioSpeech:
 		fallthrough
@@ -89,6 +93,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		if newAPIError != nil {
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
 			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
+			if relay.FinishInterruptedStream(c, newAPIError) || relay.FinishCommittedResponse(c, relayFormat, newAPIError) {
+				return
+			}
 			switch relayFormat {
 			case types.RelayFormatOpenAIRealtime:
 				helper.WssError(c, ws, newAPIError.ToOpenAIError())
@@ -123,10 +130,11 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
+	needModeration := service.ShouldModerateRequest(relayInfo)
 	needCountToken := constant.CountToken
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needModeration || needCountToken {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
@@ -141,12 +149,23 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	if needModeration && meta != nil {
+		if newAPIError = service.ModerateRelayRequest(c, relayInfo, meta.CombineText); newAPIError != nil {
+			return
+		}
+	}
+
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
 		return
 	}
 
+	tokens, newAPIError = service.ApplyContextLimit(c, relayInfo, request, meta, tokens)
+	if newAPIError != nil {
+		return
+	}
+
 	relayInfo.SetEstimatePromptTokens(tokens)
 
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
@@ -160,8 +179,15 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
 	} else {
-		newAPIError = service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo)
+		// 先原子占用免费额度，被覆盖的部分不再预扣，余额、预算与订阅检查照常进行
+		preConsumedQuota := service.ReserveFreeTier(relayInfo, priceData.QuotaToPreConsume)
+		// 结算时预算预占已替换为实际消费，未结算的在请求结束时退回
+		defer service.ReleaseBudgets(relayInfo)
+		_, billingSpan := tracing.Start(c.Request.Context(), "billing.pre_consume")
+		newAPIError = service.PreConsumeBilling(c, preConsumedQuota, relayInfo)
+		billingSpan.End()
 		if newAPIError != nil {
+			service.ReleaseFreeTier(relayInfo)
 			return
 		}
 	}
@@ -170,8 +196,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		// Only return quota if downstream failed and quota was actually pre-consumed
 		if newAPIError != nil {
 			newAPIError = service.NormalizeViolationFeeError(newAPIError)
-			if relayInfo.FinalPreConsumedQuota != 0 {
-				service.ReturnPreConsumedQuota(c, relayInfo)
+			// 已中断的流式尝试按实际用量结算，不再退还预扣费
+			if !relay.SettleInterruptedStream(c, relayInfo) {
+				if relayInfo.FinalPreConsumedQuota != 0 {
+					service.ReturnPreConsumedQuota(c, relayInfo)
+				}
+				service.ReleaseFreeTier(relayInfo)
 			}
 			service.ChargeViolationFeeIfNeeded(c, relayInfo, newAPIError)
 		}
@@ -184,49 +214,92 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		Retry:      common.GetPointer(0),
 	}
 
-	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
-		channel, channelErr := getChannel(c, relayInfo, retryParam)
-		if channelErr != nil {
-			logger.LogError(c, channelErr.Error())
-			newAPIError = channelErr
-			break
-		}
-
-		addUsedChannel(c, channel.Id)
-		requestBody, bodyErr := common.GetRequestBody(c)
-		if bodyErr != nil {
-			// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
-			if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
-				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
-			} else {
-				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	queueStart := time.Now()
+	retryTimes := relayRetryTimes(relayInfo)
+	raced := false
+	for {
+		for ; retryParam.GetRetry() <= retryTimes; retryParam.IncreaseRetry() {
+			if !raced {
+				raced = true
+				if channels := selectRaceChannels(c, relayInfo, relayFormat, retryParam); channels != nil {
+					relayInfo, newAPIError = relayRace(c, relayInfo, channels)
+					if newAPIError == nil {
+						service.NotifyRelayQueue(relayInfo.OriginModelName)
+						return
+					}
+					// 竞速的渠道均失败时按普通流程重试
+					retryTimes = relayRetryTimes(relayInfo)
+					if !shouldRetry(c, newAPIError, retryTimes-retryParam.GetRetry()) {
+						break
+					}
+					continue
+				}
+			}
+			channel, channelErr := getChannel(c, relayInfo, retryParam)
+			if channelErr != nil {
+				logger.LogError(c, channelErr.Error())
+				newAPIError = channelErr
+				break
 			}
-			break
-		}
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
-		}
+			addUsedChannel(c, channel.Id)
+			requestBody, bodyErr := common.GetRequestBody(c)
+			if bodyErr != nil {
+				// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
+				if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
+					newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+				} else {
+					newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+				}
+				break
+			}
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+
+			attemptStart := time.Now()
+			requestCtx := c.Request.Context()
+			attemptCtx, attemptSpan := tracing.Start(requestCtx, "adaptor",
+				attribute.Int("newapi.channel_id", channel.Id),
+				attribute.Int("newapi.channel_type", channel.Type),
+				attribute.Int("newapi.retry", retryParam.GetRetry()),
+			)
+			c.Request = c.Request.WithContext(attemptCtx)
+			switch relayFormat {
+			case types.RelayFormatOpenAIRealtime:
+				newAPIError = relay.WssHelper(c, relayInfo)
+			case types.RelayFormatClaude:
+				newAPIError = relay.ClaudeHelper(c, relayInfo)
+			case types.RelayFormatGemini:
+				newAPIError = geminiRelayHandler(c, relayInfo)
+			default:
+				newAPIError = relayHandler(c, relayInfo)
+			}
+			if newAPIError != nil {
+				attemptSpan.SetStatus(codes.Error, newAPIError.Error())
+			}
+			attemptSpan.End()
+			c.Request = c.Request.WithContext(requestCtx)
+			observeRelayAttempt(relayInfo, channel.Id, newAPIError, attemptStart)
 
-		if newAPIError == nil {
-			return
-		}
+			if newAPIError == nil {
+				service.NotifyRelayQueue(relayInfo.OriginModelName)
+				return
+			}
 
-		newAPIError = service.NormalizeViolationFeeError(newAPIError)
+			newAPIError = service.NormalizeViolationFeeError(newAPIError)
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+			processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 
-		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
+			// 失败渠道单独配置了重试次数时以其为准
+			retryTimes = relayRetryTimes(relayInfo)
+			if !shouldRetry(c, newAPIError, retryTimes-retryParam.GetRetry()) {
+				break
+			}
+		}
+		// 所有渠道均被上游限流时排队等待，出队后重新选择渠道
+		if !waitInRelayQueue(c, relayInfo, relayFormat, newAPIError, queueStart) {
 			break
 		}
+		retryParam.SetRetry(0)
 	}
 
 	useChannel := c.GetStringSlice("use_channel")
@@ -236,6 +309,45 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 }
 
+// relayRetryTimes 渠道或模型配置了重试次数时使用该值，否则使用全局设置
+func relayRetryTimes(info *relaycommon.RelayInfo) int {
+	if policy := info.TimeoutPolicy(); policy.MaxRetries != nil {
+		return *policy.MaxRetries
+	}
+	return common.RetryTimes
+}
+
+func observeRelayAttempt(info *relaycommon.RelayInfo, channelId int, apiErr *types.NewAPIError, start time.Time) {
+	statusCode := 0
+	if apiErr != nil {
+		statusCode = apiErr.StatusCode
+	}
+	metrics.ObserveRelay(info.OriginModelName, channelId, statusCode, time.Since(start))
+	service.ObserveCanaryAttempt(info.OriginModelName, channelId, apiErr != nil, time.Since(start))
+}
+
+func waitInRelayQueue(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat, apiErr *types.NewAPIError, queueStart time.Time) bool {
+	setting := operation_setting.GetRelayQueueSetting()
+	if !setting.Enabled || apiErr == nil || apiErr.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	if relayFormat == types.RelayFormatOpenAIRealtime || c.Writer.Written() {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	remaining := time.Duration(setting.MaxWaitSeconds)*time.Second - time.Since(queueStart)
+	if remaining <= 0 {
+		return false
+	}
+	if err := service.WaitInRelayQueue(c.Request.Context(), info.OriginModelName, info.UsingGroup, remaining); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("relay queue wait failed: %s", err.Error()))
+		return false
+	}
+	return true
+}
+
 var upgrader = websocket.Upgrader{
 	Subprotocols: []string{"realtime"}, // WS 握手支持的协议，如果有使用 Sec-WebSocket-Protocol，则必须在此声明对应的 Protocol TODO add other protocol
 	CheckOrigin: func(r *http.Request) bool {
@@ -294,6 +406,10 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 
 	info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, info)
 
+	var capabilityErr *model.ChannelCapabilityError
+	if errors.As(err, &capabilityErr) {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("分组 %s 下模型 %s %s（retry）", selectGroup, info.OriginModelName, err.Error()), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
 	if err != nil {
 		return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, info.OriginModelName, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
@@ -305,6 +421,7 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 	if newAPIError != nil {
 		return nil, newAPIError
 	}
+	helper.ApplyPricingRule(info, channel.Id)
 	return channel, nil
 }
 
@@ -327,6 +444,18 @@ func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) b
 	if _, ok := c.Get("specific_channel_id"); ok {
 		return false
 	}
+	// 上游因能力缺失拒绝时，该渠道已被登记排除，换用其他渠道重试
+	if common.GetContextKeyBool(c, constant.ContextKeyCapabilityMismatch) {
+		return true
+	}
+	if rule := service.MatchChannelDisableRule(c.GetInt("channel_type"), openaiErr); rule != nil {
+		switch rule.Action {
+		case operation_setting.ChannelDisableRuleActionRetry:
+			return true
+		case operation_setting.ChannelDisableRuleActionIgnore:
+			return false
+		}
+	}
 	code := openaiErr.StatusCode
 	if code >= 200 && code < 300 {
 		return false
@@ -342,10 +471,17 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	if service.ShouldDisableChannel(channelError.ChannelType, err) && channelError.AutoBan {
+		if rule := service.MatchChannelDisableRule(channelError.ChannelType, err); rule != nil &&
+			rule.Action == operation_setting.ChannelDisableRuleActionDisable && channelError.IsMultiKey {
+			// 规则要求禁用整个渠道，而不仅是当前使用的 key
+			channelError.UsingKey = ""
+		}
 		gopool.Go(func() {
-			service.DisableChannel(channelError, err.ErrorWithStatusCode())
+			service.DisableChannelByError(channelError, err)
 		})
 	}
+	common.SetContextKey(c, constant.ContextKeyCapabilityMismatch,
+		service.DetectChannelCapabilityMismatch(c, channelError.ChannelId, c.GetString("original_model"), err))
 
 	if constant.ErrorLogEnabled && types.IsRecordErrorLog(err) {
 		// 保存错误日志到mysql中
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+
+	"github.com/gin-gonic/gin"
+)
+
+type relayRaceEntrant struct {
+	ctx     *gin.Context
+	info    *relaycommon.RelayInfo
+	channel *model.Channel
+	err     *types.NewAPIError
+}
+
+// selectRaceChannels 请求允许竞速时返回参与竞速的渠道，首个为已选中的渠道；可用渠道不足两个时返回 nil
+func selectRaceChannels(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat, retryParam *service.RetryParam) []*model.Channel {
+	if relayFormat != types.RelayFormatOpenAI || info.RelayMode != relayconstant.RelayModeChatCompletions || info.ChannelMeta != nil {
+		return nil
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return nil
+	}
+	group := info.UsingGroup
+	if autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup); autoGroup != "" {
+		group = autoGroup
+	}
+	setting := operation_setting.GetRelayRaceSetting()
+	if !setting.ShouldRace(group, info.OriginModelName, common.GetContextKeyBool(c, constant.ContextKeyTokenRelayRace)) {
+		return nil
+	}
+	first, apiErr := getChannel(c, info, retryParam)
+	if apiErr != nil {
+		return nil
+	}
+	channels := []*model.Channel{first}
+	fanOut := setting.GetFanOut()
+	// 同优先级的渠道不足时依次尝试更低优先级
+	for attempt := 0; attempt < fanOut*3 && len(channels) < fanOut; attempt++ {
+		channel, err := model.GetRandomSatisfiedChannel(group, info.OriginModelName, attempt/fanOut, service.GetRequiredCapabilities(c))
+		if err != nil || channel == nil {
+			continue
+		}
+		if !slices.ContainsFunc(channels, func(item *model.Channel) bool { return item.Id == channel.Id }) {
+			channels = append(channels, channel)
+		}
+	}
+	if len(channels) < 2 {
+		return nil
+	}
+	return channels
+}
+
+func cloneRaceRelayInfo(info *relaycommon.RelayInfo) *relaycommon.RelayInfo {
+	cp := *info
+	cp.RequestConversionChain = slices.Clone(info.RequestConversionChain)
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		claudeConvertInfo.ToolBlocks = maps.Clone(info.ClaudeConvertInfo.ToolBlocks)
+		cp.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		cp.ResponsesUsageInfo = &relaycommon.ResponsesUsageInfo{BuiltInTools: maps.Clone(info.ResponsesUsageInfo.BuiltInTools)}
+	}
+	// 胜出前不能向客户端输出任何内容
+	cp.DisablePing = true
+	return &cp
+}
+
+// relayRace 同时向多个渠道发送请求，采用最先返回的响应。返回胜出者的 RelayInfo，全部失败时返回原 RelayInfo 与其中一个错误
+func relayRace(c *gin.Context, info *relaycommon.RelayInfo, channels []*model.Channel) (*relaycommon.RelayInfo, *types.NewAPIError) {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return info, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	for _, channel := range channels {
+		addUsedChannel(c, channel.Id)
+	}
+	race := service.NewRelayRace()
+	defer race.Close()
+	entrants := make([]*relayRaceEntrant, 0, len(channels))
+	for i, channel := range channels {
+		entrant := &relayRaceEntrant{ctx: race.Enter(c, body), info: cloneRaceRelayInfo(info), channel: channel}
+		if i > 0 {
+			// 首个渠道已由分发中间件写入上下文
+			if entrant.err = middleware.SetupContextForSelectedChannel(entrant.ctx, channel, info.OriginModelName); entrant.err == nil {
+				helper.ApplyPricingRule(entrant.info, channel.Id)
+			}
+		}
+		entrants = append(entrants, entrant)
+	}
+
+	var wg sync.WaitGroup
+	for _, entrant := range entrants {
+		if entrant.err != nil {
+			continue
+		}
+		wg.Add(1)
+		gopool.Go(func() {
+			defer wg.Done()
+			start := time.Now()
+			entrant.err = relayHandler(entrant.ctx, entrant.info)
+			if entrant.ctx.Request.Context().Err() != nil {
+				// 落败被取消的请求不计入渠道错误
+				return
+			}
+			observeRelayAttempt(entrant.info, entrant.channel.Id, entrant.err, start)
+			if entrant.err == nil {
+				return
+			}
+			entrant.err = service.NormalizeViolationFeeError(entrant.err)
+			processChannelError(entrant.ctx, *types.NewChannelError(entrant.channel.Id, entrant.channel.Type, entrant.channel.Name, entrant.channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(entrant.ctx, constant.ContextKeyChannelKey), entrant.channel.GetAutoBan()), entrant.err)
+		})
+	}
+	wg.Wait()
+
+	winner := race.Winner()
+	if winner < 0 {
+		// 后续重试重新随机选择渠道
+		info.ChannelMeta = entrants[0].info.ChannelMeta
+		for _, entrant := range entrants {
+			if entrant.err != nil {
+				return info, entrant.err
+			}
+		}
+		return info, types.NewError(fmt.Errorf("relay race finished without response"), types.ErrorCodeBadResponse)
+	}
+
+	entrant := entrants[winner]
+	logger.LogInfo(c, fmt.Sprintf("relay race won by channel #%d among %d channels", entrant.channel.Id, len(entrants)))
+	for key, value := range entrant.ctx.Keys {
+		if key == common.KeyBodyStorage || key == common.KeyRequestBody || key == string(constant.ContextKeyRelayRaceEntrant) {
+			continue
+		}
+		c.Set(key, value)
+	}
+	// 胜出者的 writer 已直接输出到客户端，流式换渠道等包装也随之保留
+	c.Writer = entrant.ctx.Writer
+	return entrant.info, entrant.err
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func responseNotFound(c *gin.Context, responseId string) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": types.OpenAIError{
+			Message: "Response with id '" + responseId + "' not found.",
+			Type:    "invalid_request_error",
+			Param:   "response_id",
+		},
+	})
+}
+
+func getStoredResponse(c *gin.Context) (*model.StoredResponse, bool) {
+	responseId := c.Param("id")
+	record, err := model.GetStoredResponse(c.GetInt("id"), responseId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseNotFound(c, responseId)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": types.OpenAIError{Message: err.Error(), Type: "server_error"},
+			})
+		}
+		return nil, false
+	}
+	return record, true
+}
+
+// RetrieveResponse 返回网关侧保存的 Responses 对象
+func RetrieveResponse(c *gin.Context) {
+	record, ok := getStoredResponse(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(record.Output))
+}
+
+func ListResponseInputItems(c *gin.Context) {
+	record, ok := getStoredResponse(c)
+	if !ok {
+		return
+	}
+	items, err := service.NormalizeResponsesInput([]byte(record.Input))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": types.OpenAIError{Message: err.Error(), Type: "server_error"},
+		})
+		return
+	}
+	data := make([]any, 0, len(items))
+	for _, item := range items {
+		var v any
+		if err := common.Unmarshal(item, &v); err == nil {
+			data = append(data, v)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": false,
+	})
+}
+
+func DeleteResponse(c *gin.Context) {
+	responseId := c.Param("id")
+	affected, err := model.DeleteStoredResponse(c.GetInt("id"), responseId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": types.OpenAIError{Message: err.Error(), Type: "server_error"},
+		})
+		return
+	}
+	if affected == 0 {
+		responseNotFound(c, responseId)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      responseId,
+		"object":  "response",
+		"deleted": true,
+	})
+}
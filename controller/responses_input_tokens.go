@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponsesInputTokens 兼容 OpenAI /v1/responses/input_tokens，按计费时相同的方式本地统计输入 token 数，不选择渠道也不计费
+func ResponsesInputTokens(c *gin.Context) {
+	request := &dto.OpenAIResponsesRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		tokenizeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.Model == "" {
+		tokenizeError(c, http.StatusBadRequest, "model is required")
+		return
+	}
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		tokenModelLimit, _ := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
+		limits, _ := tokenModelLimit.(map[string]bool)
+		if _, ok := limits[ratio_setting.FormatMatchingModelName(request.Model)]; !ok {
+			tokenizeError(c, http.StatusForbidden, "该令牌无权访问模型 "+request.Model)
+			return
+		}
+	}
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, request.Model)
+
+	info := relaycommon.GenRelayInfoResponses(c, request)
+	inputTokens, err := service.EstimateRequestToken(c, request.GetTokenCountMeta(), info)
+	if err != nil {
+		tokenizeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":       "response.input_tokens",
+		"input_tokens": inputTokens,
+	})
+}
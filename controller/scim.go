@@ -0,0 +1,757 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SCIM 2.0（RFC 7643 / RFC 7644）用户同步接口，SCIM 组对应网关的用户分组
+
+const (
+	scimSchemaUser      = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup     = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaList      = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaError     = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSchemaSPC       = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimMaxPageSize     = 200
+	scimDefaultPageSize = 100
+)
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type ScimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+type ScimUserResource struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	ExternalId  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *ScimName    `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []ScimEmail  `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Groups      []ScimMember `json:"groups,omitempty"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimGroupResource struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []ScimMember `json:"members"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type scimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+func scimRespond(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", "application/scim+json")
+	if body == nil {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, body)
+}
+
+func scimError(c *gin.Context, status int, scimType string, detail string) {
+	body := gin.H{
+		"schemas": []string{scimSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimRespond(c, status, body)
+}
+
+func scimTime(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+var scimFilterPattern = regexp.MustCompile(`^\s*([A-Za-z][\w.]*)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseScimFilter 只支持身份提供方常用的 attr eq "value" 形式，返回小写属性名
+func parseScimFilter(filter string) (string, string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", fmt.Errorf("unsupported filter: %s", filter)
+	}
+	value, err := strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid filter value: %s", match[2])
+	}
+	return strings.ToLower(match[1]), value, nil
+}
+
+// scimPage 解析从 1 开始的 startIndex 与 count
+func scimPage(c *gin.Context) (int, int) {
+	startIndex, _ := strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count < 0 {
+		count = scimDefaultPageSize
+	}
+	if count > scimMaxPageSize {
+		count = scimMaxPageSize
+	}
+	return startIndex, count
+}
+
+func GetScimServiceProviderConfig(c *gin.Context) {
+	scimRespond(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimSchemaSPC},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxPageSize},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication using the SCIM bearer token configured in system settings",
+			"primary":     true,
+		}},
+	})
+}
+
+func toScimUserResource(detail *model.ScimUserDetail) *ScimUserResource {
+	active := detail.Status == common.UserStatusEnabled
+	res := &ScimUserResource{
+		Schemas:     []string{scimSchemaUser},
+		Id:          strconv.Itoa(detail.UserId),
+		ExternalId:  detail.ExternalId,
+		UserName:    detail.UserName,
+		DisplayName: detail.DisplayName,
+		Active:      &active,
+		Meta: &ScimMeta{
+			ResourceType: "User",
+			Created:      scimTime(detail.CreatedTime),
+			LastModified: scimTime(detail.UpdatedTime),
+		},
+	}
+	if detail.DisplayName != "" {
+		res.Name = &ScimName{Formatted: detail.DisplayName}
+	}
+	if detail.Email != "" {
+		res.Emails = []ScimEmail{{Value: detail.Email, Type: "work", Primary: true}}
+	}
+	if detail.Group != "" {
+		res.Groups = []ScimMember{{Value: detail.Group, Display: detail.Group}}
+	}
+	return res
+}
+
+func (res *ScimUserResource) displayName() string {
+	name := res.DisplayName
+	if name == "" && res.Name != nil {
+		name = res.Name.Formatted
+		if name == "" {
+			name = strings.TrimSpace(res.Name.GivenName + " " + res.Name.FamilyName)
+		}
+	}
+	if name == "" {
+		name = res.UserName
+	}
+	if runes := []rune(name); len(runes) > 20 {
+		name = string(runes[:20])
+	}
+	return name
+}
+
+func (res *ScimUserResource) email() string {
+	for _, email := range res.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(res.Emails) > 0 {
+		return res.Emails[0].Value
+	}
+	if strings.Contains(res.UserName, "@") {
+		return res.UserName
+	}
+	return ""
+}
+
+func (res *ScimUserResource) isActive() bool {
+	return res.Active == nil || *res.Active
+}
+
+func getScimUserDetail(c *gin.Context) (*model.ScimUserDetail, bool) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	detail, err := model.GetScimUser(userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return nil, false
+	}
+	return detail, true
+}
+
+func GetScimUsers(c *gin.Context) {
+	attr, value, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	startIndex, count := scimPage(c)
+	users, total, err := model.SearchScimUsers(attr, value, startIndex-1, count)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	resources := make([]*ScimUserResource, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, toScimUserResource(user))
+	}
+	scimRespond(c, http.StatusOK, &scimListResponse{
+		Schemas:      []string{scimSchemaList},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func GetScimUser(c *gin.Context) {
+	detail, ok := getScimUserDetail(c)
+	if !ok {
+		return
+	}
+	scimRespond(c, http.StatusOK, toScimUserResource(detail))
+}
+
+func CreateScimUser(c *gin.Context) {
+	res := &ScimUserResource{}
+	if err := json.NewDecoder(c.Request.Body).Decode(res); err != nil || res.UserName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	if model.IsScimUserNameTaken(res.UserName, 0) {
+		scimError(c, http.StatusConflict, "uniqueness", "userName already exists")
+		return
+	}
+	user := &model.User{
+		Username:    res.UserName,
+		DisplayName: res.displayName(),
+		Email:       res.email(),
+		Status:      common.UserStatusEnabled,
+		Group:       system_setting.GetSCIMSettings().DefaultGroup,
+	}
+	if !res.isActive() {
+		user.Status = common.UserStatusDisabled
+	}
+	scimUser := &model.ScimUser{UserName: res.UserName, ExternalId: res.ExternalId}
+	if err := model.CreateScimUser(user, scimUser); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	detail, err := model.GetScimUser(user.Id)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimRespond(c, http.StatusCreated, toScimUserResource(detail))
+}
+
+// saveScimUser 把完整的用户资源写回本地账户，PUT 与 PATCH 共用
+func saveScimUser(c *gin.Context, detail *model.ScimUserDetail, res *ScimUserResource) {
+	if res.UserName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	if res.UserName != detail.UserName && model.IsScimUserNameTaken(res.UserName, detail.UserId) {
+		scimError(c, http.StatusConflict, "uniqueness", "userName already exists")
+		return
+	}
+	err := model.UpdateScimUser(&model.ScimUser{UserId: detail.UserId, UserName: res.UserName, ExternalId: res.ExternalId})
+	if err == nil {
+		err = model.UpdateScimUserProfile(detail.UserId, res.displayName(), res.email(), res.isActive())
+	}
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	detail, err = model.GetScimUser(detail.UserId)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimRespond(c, http.StatusOK, toScimUserResource(detail))
+}
+
+func ReplaceScimUser(c *gin.Context) {
+	detail, ok := getScimUserDetail(c)
+	if !ok {
+		return
+	}
+	res := &ScimUserResource{}
+	if err := json.NewDecoder(c.Request.Body).Decode(res); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	saveScimUser(c, detail, res)
+}
+
+func PatchScimUser(c *gin.Context) {
+	detail, ok := getScimUserDetail(c)
+	if !ok {
+		return
+	}
+	var req ScimPatchRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	res := toScimUserResource(detail)
+	for _, op := range req.Operations {
+		if err := applyScimUserOperation(res, op); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	saveScimUser(c, detail, res)
+}
+
+// applyScimUserOperation 支持带 path 的单属性修改，以及不带 path、value 为属性对象的批量修改
+func applyScimUserOperation(res *ScimUserResource, op ScimPatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		return setScimUserAttribute(res, op.Path, nil)
+	default:
+		return fmt.Errorf("unsupported patch op: %s", op.Op)
+	}
+	if op.Path != "" {
+		return setScimUserAttribute(res, op.Path, op.Value)
+	}
+	attrs := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(op.Value, &attrs); err != nil {
+		return err
+	}
+	for path, value := range attrs {
+		if err := setScimUserAttribute(res, path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setScimUserAttribute value 为 nil 时清除属性
+func setScimUserAttribute(res *ScimUserResource, path string, value json.RawMessage) error {
+	str := func() (string, error) {
+		var s string
+		if value == nil {
+			return "", nil
+		}
+		err := json.Unmarshal(value, &s)
+		return s, err
+	}
+	var err error
+	switch lower := strings.ToLower(path); {
+	case lower == "active":
+		active := false
+		if value != nil {
+			// 部分身份提供方以字符串 "True" / "False" 传递布尔值
+			var s string
+			if json.Unmarshal(value, &s) == nil {
+				active, err = strconv.ParseBool(s)
+			} else {
+				err = json.Unmarshal(value, &active)
+			}
+		}
+		res.Active = &active
+	case lower == "username":
+		res.UserName, err = str()
+	case lower == "externalid":
+		res.ExternalId, err = str()
+	case lower == "displayname":
+		res.DisplayName, err = str()
+	case lower == "name":
+		res.Name = &ScimName{}
+		if value != nil {
+			err = json.Unmarshal(value, res.Name)
+		}
+		res.DisplayName = ""
+	case strings.HasPrefix(lower, "name."):
+		if res.Name == nil {
+			res.Name = &ScimName{}
+		}
+		var s string
+		if s, err = str(); err == nil {
+			switch lower {
+			case "name.formatted":
+				res.Name.Formatted = s
+				res.DisplayName = ""
+			case "name.givenname":
+				res.Name.GivenName = s
+			case "name.familyname":
+				res.Name.FamilyName = s
+			}
+		}
+	case lower == "emails":
+		res.Emails = nil
+		if value != nil {
+			err = json.Unmarshal(value, &res.Emails)
+		}
+	case strings.HasPrefix(lower, "emails["):
+		// 例如 emails[type eq "work"].value，网关只保存一个邮箱
+		var s string
+		if s, err = str(); err == nil {
+			res.Emails = nil
+			if s != "" {
+				res.Emails = []ScimEmail{{Value: s, Type: "work", Primary: true}}
+			}
+		}
+	default:
+		// 不支持的属性忽略，避免身份提供方同步扩展属性时整体失败
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for %s", path)
+	}
+	return nil
+}
+
+// DeleteScimUser 删除账户并禁用令牌
+func DeleteScimUser(c *gin.Context) {
+	detail, ok := getScimUserDetail(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteScimUser(detail.UserId); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimRespond(c, http.StatusNoContent, nil)
+}
+
+// resolveScimGroup 把 SCIM 组名映射为网关分组，分组必须已存在
+func resolveScimGroup(displayName string) (string, bool) {
+	group := displayName
+	if mapping := system_setting.GetSCIMSettings().GroupMapping; mapping != "" {
+		groups := make(map[string]string)
+		if err := json.Unmarshal([]byte(mapping), &groups); err == nil {
+			if mapped, ok := groups[displayName]; ok {
+				group = mapped
+			}
+		}
+	}
+	return group, ratio_setting.ContainsGroupRatio(group)
+}
+
+func toScimGroupResource(group string) (*ScimGroupResource, error) {
+	users, err := model.GetScimUsersByGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	res := &ScimGroupResource{
+		Schemas:     []string{scimSchemaGroup},
+		Id:          group,
+		DisplayName: group,
+		Members:     make([]ScimMember, 0, len(users)),
+		Meta:        &ScimMeta{ResourceType: "Group"},
+	}
+	for _, user := range users {
+		res.Members = append(res.Members, ScimMember{Value: strconv.Itoa(user.UserId), Display: user.UserName})
+	}
+	return res, nil
+}
+
+func GetScimGroups(c *gin.Context) {
+	attr, value, err := parseScimFilter(c.Query("filter"))
+	if err != nil || (attr != "" && attr != "displayname") {
+		scimError(c, http.StatusBadRequest, "invalidFilter", "only displayName eq filter is supported")
+		return
+	}
+	var groups []string
+	if attr == "" {
+		for group := range ratio_setting.GetGroupRatioCopy() {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+	} else if group, ok := resolveScimGroup(value); ok {
+		groups = append(groups, group)
+	}
+	startIndex, count := scimPage(c)
+	total := len(groups)
+	if startIndex-1 < len(groups) {
+		groups = groups[startIndex-1:]
+	} else {
+		groups = nil
+	}
+	if len(groups) > count {
+		groups = groups[:count]
+	}
+	resources := make([]*ScimGroupResource, 0, len(groups))
+	for _, group := range groups {
+		res, err := toScimGroupResource(group)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		resources = append(resources, res)
+	}
+	scimRespond(c, http.StatusOK, &scimListResponse{
+		Schemas:      []string{scimSchemaList},
+		TotalResults: int64(total),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func GetScimGroup(c *gin.Context) {
+	group := c.Param("id")
+	if !ratio_setting.ContainsGroupRatio(group) {
+		scimError(c, http.StatusNotFound, "", "group not found")
+		return
+	}
+	res, err := toScimGroupResource(group)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimRespond(c, http.StatusOK, res)
+}
+
+// CreateScimGroup 分组由网关配置维护，这里只把 SCIM 组关联到已存在的分组
+func CreateScimGroup(c *gin.Context) {
+	req := &ScimGroupResource{}
+	if err := json.NewDecoder(c.Request.Body).Decode(req); err != nil || req.DisplayName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	group, ok := resolveScimGroup(req.DisplayName)
+	if !ok {
+		scimError(c, http.StatusBadRequest, "invalidValue", fmt.Sprintf("group %s is not configured on the gateway", group))
+		return
+	}
+	if err := setScimGroupMembers(group, req.Members, false); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	res, err := toScimGroupResource(group)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimRespond(c, http.StatusCreated, res)
+}
+
+func ReplaceScimGroup(c *gin.Context) {
+	group := c.Param("id")
+	if !ratio_setting.ContainsGroupRatio(group) {
+		scimError(c, http.StatusNotFound, "", "group not found")
+		return
+	}
+	req := &ScimGroupResource{}
+	if err := json.NewDecoder(c.Request.Body).Decode(req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if err := setScimGroupMembers(group, req.Members, true); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	GetScimGroup(c)
+}
+
+func PatchScimGroup(c *gin.Context) {
+	group := c.Param("id")
+	if !ratio_setting.ContainsGroupRatio(group) {
+		scimError(c, http.StatusNotFound, "", "group not found")
+		return
+	}
+	var req ScimPatchRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	for _, op := range req.Operations {
+		if err := applyScimGroupOperation(group, op); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	scimRespond(c, http.StatusNoContent, nil)
+}
+
+var scimMemberPathPattern = regexp.MustCompile(`^members\[value eq "([^"]+)"\]$`)
+
+func applyScimGroupOperation(group string, op ScimPatchOperation) error {
+	path := strings.TrimSpace(op.Path)
+	var members []ScimMember
+	if match := scimMemberPathPattern.FindStringSubmatch(path); match != nil {
+		// Azure AD 移除成员时把成员 id 放在 path 中
+		members = []ScimMember{{Value: match[1]}}
+		path = "members"
+	} else if len(op.Value) > 0 {
+		if path == "" {
+			// 不带 path 时 value 为 {"members": [...]}，其它属性（如 displayName）忽略
+			var attrs struct {
+				Members []ScimMember `json:"members"`
+			}
+			if err := json.Unmarshal(op.Value, &attrs); err != nil {
+				return err
+			}
+			members = attrs.Members
+			path = "members"
+		} else if strings.EqualFold(path, "members") {
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return err
+			}
+		}
+	}
+	if !strings.EqualFold(path, "members") {
+		return nil
+	}
+	switch strings.ToLower(op.Op) {
+	case "add":
+		return setScimGroupMembers(group, members, false)
+	case "replace":
+		return setScimGroupMembers(group, members, true)
+	case "remove":
+		if members == nil {
+			// 未指定成员时移除全部
+			return setScimGroupMembers(group, nil, true)
+		}
+		return removeScimGroupMembers(group, members)
+	default:
+		return fmt.Errorf("unsupported patch op: %s", op.Op)
+	}
+}
+
+// setScimGroupMembers 把成员移入分组，replace 为 true 时不在列表中的现有成员回到默认分组
+func setScimGroupMembers(group string, members []ScimMember, replace bool) error {
+	keep := make(map[int]bool, len(members))
+	for _, member := range members {
+		userId, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return fmt.Errorf("invalid member %s", member.Value)
+		}
+		detail, err := model.GetScimUser(userId)
+		if err != nil {
+			return fmt.Errorf("member %s not found", member.Value)
+		}
+		keep[userId] = true
+		if detail.Group != group {
+			if err = model.UpdateScimUserGroup(userId, group); err != nil {
+				return err
+			}
+		}
+	}
+	if !replace {
+		return nil
+	}
+	current, err := model.GetScimUsersByGroup(group)
+	if err != nil {
+		return err
+	}
+	for _, user := range current {
+		if !keep[user.UserId] {
+			if err = model.UpdateScimUserGroup(user.UserId, system_setting.GetSCIMSettings().DefaultGroup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func removeScimGroupMembers(group string, members []ScimMember) error {
+	for _, member := range members {
+		userId, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return fmt.Errorf("invalid member %s", member.Value)
+		}
+		detail, err := model.GetScimUser(userId)
+		if err != nil || detail.Group != group {
+			continue
+		}
+		if err = model.UpdateScimUserGroup(userId, system_setting.GetSCIMSettings().DefaultGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteScimGroup 分组本身保留，只把其中的 SCIM 用户移回默认分组
+func DeleteScimGroup(c *gin.Context) {
+	group := c.Param("id")
+	if !ratio_setting.ContainsGroupRatio(group) {
+		scimError(c, http.StatusNotFound, "", "group not found")
+		return
+	}
+	if err := setScimGroupMembers(group, nil, true); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimRespond(c, http.StatusNoContent, nil)
+}
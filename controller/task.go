@@ -17,6 +17,9 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
@@ -27,6 +30,9 @@ func UpdateTaskBulk() {
 	//imageModel := "midjourney"
 	for {
 		time.Sleep(time.Duration(15) * time.Second)
+		if !model.IsLeader() {
+			continue
+		}
 		common.SysLog("任务进度轮询开始")
 		ctx := context.TODO()
 		allTasks := model.GetAllUnFinishSyncTasks(constant.TaskQueryLimit)
@@ -84,6 +90,44 @@ func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][
 	}
 }
 
+// TaskCallback 接收上游异步任务回调，校验签名后立即查询并更新该任务，不必等待下一轮轮询
+func TaskCallback(c *gin.Context) {
+	platform := constant.TaskPlatform(c.Param("platform"))
+	if !service.VerifyTaskCallbackSign(platform, c.Query("sign")) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	adaptor, ok := relay.GetTaskAdaptor(platform).(channel.TaskCallbackAdaptor)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	taskId, err := adaptor.ParseTaskCallback(body)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("invalid task callback from platform %s: %s", platform, err.Error()))
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	task, exist, err := model.GetByPlatformTaskId(platform, taskId)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !exist {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if task.Progress != "100%" {
+		UpdateTaskByPlatform(platform, map[int][]string{task.ChannelId: {task.TaskID}}, map[string]*model.Task{task.TaskID: task})
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 func UpdateSunoTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
 	for channelId, taskIds := range taskChannelM {
 		err := updateSunoTaskAll(ctx, channelId, taskIds, taskM)
@@ -102,14 +146,9 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 	channel, err := model.CacheGetChannel(channelId)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("CacheGetChannel: %v", err))
-		err = model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
-			"status":      "FAILURE",
-			"progress":    "100%",
-		})
-		if err != nil {
-			common.SysLog(fmt.Sprintf("UpdateMidjourneyTask error2: %v", err))
-		}
+		service.FailTasks(ctx, lo.FilterMap(taskIds, func(taskId string, _ int) (*model.Task, bool) {
+			return taskM[taskId], taskM[taskId] != nil
+		}), fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId))
 		return err
 	}
 	adaptor := relay.GetTaskAdaptor(constant.TaskPlatformSuno)
@@ -147,41 +186,25 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 
 	for _, responseItem := range responseItems.Data {
 		task := taskM[responseItem.TaskID]
-		if !checkTaskNeedUpdate(task, responseItem) {
+		if task == nil || !checkTaskNeedUpdate(task, responseItem) {
 			continue
 		}
 
-		task.Status = lo.If(model.TaskStatus(responseItem.Status) != "", model.TaskStatus(responseItem.Status)).Else(task.Status)
-		task.FailReason = lo.If(responseItem.FailReason != "", responseItem.FailReason).Else(task.FailReason)
 		task.SubmitTime = lo.If(responseItem.SubmitTime != 0, responseItem.SubmitTime).Else(task.SubmitTime)
 		task.StartTime = lo.If(responseItem.StartTime != 0, responseItem.StartTime).Else(task.StartTime)
 		task.FinishTime = lo.If(responseItem.FinishTime != 0, responseItem.FinishTime).Else(task.FinishTime)
-		if responseItem.FailReason != "" || task.Status == model.TaskStatusFailure {
-			logger.LogInfo(ctx, task.TaskID+" 构建失败，"+task.FailReason)
-			task.Progress = "100%"
-			//err = model.CacheUpdateUserQuota(task.UserId) ?
-			if err != nil {
-				logger.LogError(ctx, "error update user quota cache: "+err.Error())
-			} else {
-				quota := task.Quota
-				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
-					if err != nil {
-						logger.LogError(ctx, "fail to increase user quota: "+err.Error())
-					}
-					logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, logger.LogQuota(quota))
-					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-				}
-			}
-		}
-		if responseItem.Status == model.TaskStatusSuccess {
-			task.Progress = "100%"
-		}
 		task.Data = responseItem.Data
 
-		err = task.Update()
-		if err != nil {
-			common.SysLog("UpdateMidjourneyTask task error: " + err.Error())
+		taskResult := &relaycommon.TaskInfo{
+			TaskID: responseItem.TaskID,
+			Status: lo.If(responseItem.Status != "", responseItem.Status).Else(string(task.Status)),
+			Reason: responseItem.FailReason,
+		}
+		if responseItem.FailReason != "" {
+			taskResult.Status = model.TaskStatusFailure
+		}
+		if err = service.ApplyTaskResult(ctx, task, taskResult); err != nil {
+			common.SysLog("UpdateSunoTask task error: " + err.Error())
 		}
 	}
 	return nil
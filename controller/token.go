@@ -1,13 +1,18 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -145,6 +150,23 @@ func AddToken(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
 	}
+	if len(strings.TrimSpace(token.Project)) > model.ProjectMaxLength {
+		common.ApiErrorMsg(c, "项目标识长度不能超过 64 个字符")
+		return
+	}
+	scopes, err := normalizeTokenScopes(token.Scopes)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !constant.IsValidContextTruncation(token.ContextTruncation) {
+		common.ApiErrorMsg(c, "未知的上下文截断策略: "+token.ContextTruncation)
+		return
+	}
+	if err := validateTokenIpLists(&token); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	// 非无限额度时，检查额度值是否超出有效范围
 	if !token.UnlimitedQuota {
 		if token.RemainQuota < 0 {
@@ -175,14 +197,30 @@ func AddToken(c *gin.Context) {
 		ModelLimitsEnabled: token.ModelLimitsEnabled,
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
+		DenyIps:            token.DenyIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		MaxConcurrency:     token.MaxConcurrency,
+		Project:            strings.TrimSpace(token.Project),
+		Scopes:             scopes,
+		ContextTruncation:  token.ContextTruncation,
+		RelayRace:          token.RelayRace,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.EmitWebhookEvent(cleanToken.UserId, model.WebhookEventTokenCreated, map[string]any{
+		"id":              cleanToken.Id,
+		"name":            cleanToken.Name,
+		"group":           cleanToken.Group,
+		"project":         cleanToken.Project,
+		"expired_time":    cleanToken.ExpiredTime,
+		"remain_quota":    cleanToken.RemainQuota,
+		"unlimited_quota": cleanToken.UnlimitedQuota,
+		"created_time":    cleanToken.CreatedTime,
+	})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -205,6 +243,75 @@ func DeleteToken(c *gin.Context) {
 	return
 }
 
+type rotateTokenRequest struct {
+	OverlapHours *int `json:"overlap_hours"`
+}
+
+// RotateToken 为令牌更换密钥，保留额度与限制，旧密钥在重叠期内仍可使用
+func RotateToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	var req rotateTokenRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+	}
+	setting := operation_setting.GetTokenRotationSetting()
+	overlapHours := setting.DefaultOverlapHours
+	if req.OverlapHours != nil {
+		overlapHours = *req.OverlapHours
+	}
+	if overlapHours < 0 || overlapHours > setting.MaxOverlapHours {
+		common.ApiErrorMsg(c, fmt.Sprintf("重叠时长需在 0 到 %d 小时之间", setting.MaxOverlapHours))
+		return
+	}
+	token, err := model.GetTokenByIds(id, userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = token.RotateKey(int64(overlapHours) * 3600); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"id":                   token.Id,
+		"key":                  token.Key,
+		"rotated_time":         token.RotatedTime,
+		"previous_key_expires": token.PreviousKeyExpires,
+	})
+}
+
+// normalizeTokenScopes 校验并去重令牌的接口类别
+func normalizeTokenScopes(raw string) (string, error) {
+	scopes := make([]string, 0)
+	for _, scope := range strings.Split(raw, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || slices.Contains(scopes, scope) {
+			continue
+		}
+		if !constant.IsValidTokenScope(scope) {
+			return "", fmt.Errorf("未知的令牌范围: %s", scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	return strings.Join(scopes, ","), nil
+}
+
+func validateTokenIpLists(token *model.Token) error {
+	for _, list := range []*string{token.AllowIps, token.DenyIps} {
+		if list == nil {
+			continue
+		}
+		if err := common.ValidateIpList(*list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func UpdateToken(c *gin.Context) {
 	userId := c.GetInt("id")
 	statusOnly := c.Query("status_only")
@@ -218,6 +325,23 @@ func UpdateToken(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
 	}
+	if len(strings.TrimSpace(token.Project)) > model.ProjectMaxLength {
+		common.ApiErrorMsg(c, "项目标识长度不能超过 64 个字符")
+		return
+	}
+	scopes, err := normalizeTokenScopes(token.Scopes)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !constant.IsValidContextTruncation(token.ContextTruncation) {
+		common.ApiErrorMsg(c, "未知的上下文截断策略: "+token.ContextTruncation)
+		return
+	}
+	if err := validateTokenIpLists(&token); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	if !token.UnlimitedQuota {
 		if token.RemainQuota < 0 {
 			common.ApiErrorI18n(c, i18n.MsgTokenQuotaNegative)
@@ -255,8 +379,14 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimitsEnabled = token.ModelLimitsEnabled
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
+		cleanToken.DenyIps = token.DenyIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.MaxConcurrency = token.MaxConcurrency
+		cleanToken.Project = strings.TrimSpace(token.Project)
+		cleanToken.Scopes = scopes
+		cleanToken.ContextTruncation = token.ContextTruncation
+		cleanToken.RelayRace = token.RelayRace
 	}
 	err = cleanToken.Update()
 	if err != nil {
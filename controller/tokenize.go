@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tokenizeRequest struct {
+	dto.GeneralOpenAIRequest
+	Text string `json:"text,omitempty"`
+}
+
+func tokenizeError(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+		},
+	})
+}
+
+// Tokenize 按计费时相同的方式统计输入 token 数并估算输入部分的额度，不选择渠道也不计费。
+// 请求体与 /v1/chat/completions 相同，也可只传 text 或 input 统计纯文本
+func Tokenize(c *gin.Context) {
+	request := &tokenizeRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		tokenizeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.Model == "" {
+		tokenizeError(c, http.StatusBadRequest, "model is required")
+		return
+	}
+	if request.Text != "" && request.Input == nil {
+		request.Input = request.Text
+	}
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		tokenModelLimit, _ := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
+		limits, _ := tokenModelLimit.(map[string]bool)
+		if _, ok := limits[ratio_setting.FormatMatchingModelName(request.Model)]; !ok {
+			tokenizeError(c, http.StatusForbidden, "该令牌无权访问模型 "+request.Model)
+			return
+		}
+	}
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, request.Model)
+
+	info := relaycommon.GenRelayInfoOpenAI(c, &request.GeneralOpenAIRequest)
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	if len(request.Messages) == 0 {
+		// 纯文本不计入消息格式的额外 token
+		info.RelayFormat = types.RelayFormatEmbedding
+		info.RelayMode = relayconstant.RelayModeEmbeddings
+	}
+	meta := request.GetTokenCountMeta()
+	promptTokens, err := service.EstimateRequestToken(c, meta, info)
+	if err != nil {
+		tokenizeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := gin.H{
+		"model":         request.Model,
+		"prompt_tokens": promptTokens,
+	}
+	if meta.MaxTokens > 0 {
+		result["max_tokens"] = meta.MaxTokens
+	}
+	if priceData, err := helper.ModelPriceHelper(c, info, promptTokens, meta); err == nil {
+		// 仅估算输入部分，按次计费的模型即为单次价格
+		quota := priceData.ModelPrice * common.QuotaPerUnit * priceData.GroupRatioInfo.GroupRatio
+		if !priceData.UsePrice {
+			quota = float64(promptTokens) * priceData.ModelRatio * priceData.GroupRatioInfo.GroupRatio
+		}
+		result["estimated_quota"] = int(quota)
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -56,8 +56,10 @@ func GetTopUpInfo(c *gin.Context) {
 		"pay_methods":         payMethods,
 		"min_topup":           operation_setting.MinTopUp,
 		"stripe_min_topup":    setting.StripeMinTopUp,
+		"stripe_packages":     setting.StripeQuotaPackages,
 		"amount_options":      operation_setting.GetPaymentSetting().AmountOptions,
 		"discount":            operation_setting.GetPaymentSetting().AmountDiscount,
+		"currency_packages":   getCurrencyPackages(),
 	}
 	common.ApiSuccess(c, data)
 }
@@ -65,6 +67,7 @@ func GetTopUpInfo(c *gin.Context) {
 type EpayRequest struct {
 	Amount        int64  `json:"amount"`
 	PaymentMethod string `json:"payment_method"`
+	CouponCode    string `json:"coupon_code"`
 }
 
 type AmountRequest struct {
@@ -110,11 +113,25 @@ func getPayMoney(amount int64, group string) float64 {
 	}
 	dDiscount := decimal.NewFromFloat(discount)
 
+	// 在线支付以人民币结算，配置了人民币价格的套餐直接使用套餐价
+	if price, ok := operation_setting.GetCurrencySetting().GetPackagePrice(amount, "CNY"); ok {
+		return decimal.NewFromFloat(price).Mul(dTopupGroupRatio).InexactFloat64()
+	}
+
 	payMoney := dAmount.Mul(dPrice).Mul(dTopupGroupRatio).Mul(dDiscount)
 
 	return payMoney.InexactFloat64()
 }
 
+// getCurrencyPackages 未启用多币种时不展示按币种定价的套餐
+func getCurrencyPackages() []operation_setting.CurrencyPackage {
+	currencySetting := operation_setting.GetCurrencySetting()
+	if !currencySetting.Enabled {
+		return []operation_setting.CurrencyPackage{}
+	}
+	return currencySetting.Packages
+}
+
 func getMinTopup() int64 {
 	minTopup := operation_setting.MinTopUp
 	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
@@ -192,6 +209,10 @@ func RequestEpay(c *gin.Context) {
 		CreateTime:    time.Now().Unix(),
 		Status:        "pending",
 	}
+	if err = topUp.AttachCoupon(req.CouponCode); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
 	err = topUp.Insert()
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
@@ -306,6 +327,9 @@ func EpayNotify(c *gin.Context) {
 			}
 			log.Printf("易支付回调更新用户成功 %v", topUp)
 			model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", logger.LogQuota(quotaToAdd), topUp.Money))
+			if err = model.ApplyTopUpRewards(topUp, quotaToAdd); err != nil {
+				log.Printf("易支付回调发放充值奖励失败: %v", err)
+			}
 		}
 	} else {
 		log.Printf("易支付异常回调: %v", verifyInfo)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -41,12 +42,103 @@ type StripePayRequest struct {
 	// CancelURL is the optional custom URL to redirect when payment is canceled.
 	// If empty, defaults to the server's console topup page.
 	CancelURL string `json:"cancel_url,omitempty"`
+	// PackageId selects a fixed-price quota package instead of Amount.
+	PackageId string `json:"package_id,omitempty"`
+	// CouponCode is the optional top-up coupon to apply when the order completes.
+	CouponCode string `json:"coupon_code,omitempty"`
+	// Currency is the charge currency (USD or EUR) for per-currency packages. Defaults to USD.
+	Currency string `json:"currency,omitempty"`
+}
+
+// StripeQuotaPackage 固定价格的额度套餐
+type StripeQuotaPackage struct {
+	Id       string  `json:"id"`
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`    // 支付金额，单位为货币主单位
+	Currency string  `json:"currency"` // 为空时使用 usd
+	Quota    int64   `json:"quota"`    // 到账额度
+	PriceId  string  `json:"price_id"` // 可选，使用 Stripe 后台创建的价格，为空时按 Price 和 Currency 生成
+}
+
+func getStripeQuotaPackages() ([]StripeQuotaPackage, error) {
+	var packages []StripeQuotaPackage
+	if err := common.UnmarshalJsonStr(setting.StripeQuotaPackages, &packages); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+func getStripeQuotaPackage(id string) (*StripeQuotaPackage, error) {
+	packages, err := getStripeQuotaPackages()
+	if err != nil {
+		return nil, err
+	}
+	for i := range packages {
+		if packages[i].Id == id {
+			return &packages[i], nil
+		}
+	}
+	return nil, errors.New("套餐不存在")
+}
+
+// ValidateStripeQuotaPackages 校验套餐配置
+func ValidateStripeQuotaPackages(value string) error {
+	var packages []StripeQuotaPackage
+	if err := common.UnmarshalJsonStr(value, &packages); err != nil {
+		return err
+	}
+	ids := make(map[string]bool, len(packages))
+	for _, pkg := range packages {
+		if pkg.Id == "" || ids[pkg.Id] {
+			return fmt.Errorf("套餐 id 不能为空且不能重复: %q", pkg.Id)
+		}
+		ids[pkg.Id] = true
+		if pkg.Quota <= 0 {
+			return fmt.Errorf("套餐 %s 的额度必须大于 0", pkg.Id)
+		}
+		if pkg.PriceId == "" && pkg.Price <= 0 {
+			return fmt.Errorf("套餐 %s 需要配置 price 或 price_id", pkg.Id)
+		}
+	}
+	return nil
+}
+
+func (pkg *StripeQuotaPackage) lineItem() *stripe.CheckoutSessionLineItemParams {
+	if pkg.PriceId != "" {
+		return &stripe.CheckoutSessionLineItemParams{
+			Price:    stripe.String(pkg.PriceId),
+			Quantity: stripe.Int64(1),
+		}
+	}
+	currency := strings.ToLower(pkg.Currency)
+	if currency == "" {
+		currency = "usd"
+	}
+	return &stripe.CheckoutSessionLineItemParams{
+		PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+			Currency: stripe.String(currency),
+			ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+				Name: stripe.String(pkg.Name),
+			},
+			UnitAmount: stripe.Int64(int64(math.Round(pkg.Price * 100))),
+		},
+		Quantity: stripe.Int64(1),
+	}
 }
 
 type StripeAdaptor struct {
 }
 
 func (*StripeAdaptor) RequestAmount(c *gin.Context, req *StripePayRequest) {
+	if req.PackageId != "" {
+		pkg, err := getStripeQuotaPackage(req.PackageId)
+		if err != nil {
+			c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"message": "success", "data": strconv.FormatFloat(pkg.Price, 'f', 2, 64)})
+		return
+	}
 	if req.Amount < getStripeMinTopup() {
 		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getStripeMinTopup())})
 		return
@@ -57,7 +149,7 @@ func (*StripeAdaptor) RequestAmount(c *gin.Context, req *StripePayRequest) {
 		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
 		return
 	}
-	payMoney := getStripePayMoney(float64(req.Amount), group)
+	payMoney, _ := getStripePayMoney(float64(req.Amount), group, req.Currency)
 	if payMoney <= 0.01 {
 		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
 		return
@@ -70,11 +162,19 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 		c.JSON(200, gin.H{"message": "error", "data": "不支持的支付渠道"})
 		return
 	}
-	if req.Amount < getStripeMinTopup() {
+	var pkg *StripeQuotaPackage
+	if req.PackageId != "" {
+		var err error
+		pkg, err = getStripeQuotaPackage(req.PackageId)
+		if err != nil {
+			c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+			return
+		}
+	} else if req.Amount < getStripeMinTopup() {
 		c.JSON(200, gin.H{"message": fmt.Sprintf("充值数量不能小于 %d", getStripeMinTopup()), "data": 10})
 		return
 	}
-	if req.Amount > 10000 {
+	if pkg == nil && req.Amount > 10000 {
 		c.JSON(200, gin.H{"message": "充值数量不能大于 10000", "data": 10})
 		return
 	}
@@ -96,13 +196,6 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 	reference := fmt.Sprintf("new-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
 
-	payLink, err := genStripeLink(referenceId, user.StripeCustomer, user.Email, req.Amount, req.SuccessURL, req.CancelURL)
-	if err != nil {
-		log.Println("获取Stripe Checkout支付链接失败", err)
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
-		return
-	}
-
 	topUp := &model.TopUp{
 		UserId:        id,
 		Amount:        req.Amount,
@@ -112,6 +205,46 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
 	}
+	// 配置了支付币种价格的多币种套餐按套餐价收款
+	currency := stripeChargeCurrency(req.Currency)
+	packagePrice, hasPackagePrice := getStripePayMoney(float64(req.Amount), user.Group, currency)
+	if pkg != nil {
+		topUp.Amount = pkg.Quota
+		topUp.Money = pkg.Price
+		topUp.Quota = pkg.Quota
+	} else if hasPackagePrice {
+		topUp.Money = packagePrice
+	}
+	if err := topUp.AttachCoupon(req.CouponCode); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+
+	lineItem := &stripe.CheckoutSessionLineItemParams{
+		Price:    stripe.String(setting.StripePriceId),
+		Quantity: stripe.Int64(req.Amount),
+	}
+	if pkg != nil {
+		lineItem = pkg.lineItem()
+	} else if hasPackagePrice {
+		lineItem = &stripe.CheckoutSessionLineItemParams{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency: stripe.String(strings.ToLower(currency)),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name: stripe.String(fmt.Sprintf("Top up %d", req.Amount)),
+				},
+				UnitAmount: stripe.Int64(int64(math.Round(packagePrice * 100))),
+			},
+			Quantity: stripe.Int64(1),
+		}
+	}
+	payLink, err := genStripeLink(referenceId, user.StripeCustomer, user.Email, lineItem, req.SuccessURL, req.CancelURL)
+	if err != nil {
+		log.Println("获取Stripe Checkout支付链接失败", err)
+		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		return
+	}
+
 	err = topUp.Insert()
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
@@ -170,6 +303,8 @@ func StripeWebhook(c *gin.Context) {
 		sessionCompleted(event)
 	case stripe.EventTypeCheckoutSessionExpired:
 		sessionExpired(event)
+	case stripe.EventTypeChargeRefunded:
+		chargeRefunded(event)
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
@@ -202,7 +337,7 @@ func sessionCompleted(event stripe.Event) {
 		return
 	}
 
-	err := model.Recharge(referenceId, customerId)
+	err := model.Recharge(referenceId, customerId, event.GetObjectValue("payment_intent"))
 	if err != nil {
 		log.Println(err.Error(), referenceId)
 		return
@@ -256,6 +391,25 @@ func sessionExpired(event stripe.Event) {
 	log.Println("充值订单已过期", referenceId)
 }
 
+// chargeRefunded 按退款金额占支付金额的比例扣回额度
+func chargeRefunded(event stripe.Event) {
+	paymentIntent := event.GetObjectValue("payment_intent")
+	amount, _ := strconv.ParseFloat(event.GetObjectValue("amount"), 64)
+	refunded, _ := strconv.ParseFloat(event.GetObjectValue("amount_refunded"), 64)
+	if paymentIntent == "" || amount <= 0 {
+		log.Println("错误的Stripe退款事件:", paymentIntent)
+		return
+	}
+	LockOrder(paymentIntent)
+	defer UnlockOrder(paymentIntent)
+	deducted, err := model.RefundTopUp(paymentIntent, refunded/amount)
+	if err != nil {
+		log.Println("处理Stripe退款失败", paymentIntent, ", err:", err.Error())
+		return
+	}
+	log.Printf("Stripe退款：%s, %.2f/%.2f, 扣回额度 %d", paymentIntent, refunded/100, amount/100, deducted)
+}
+
 // genStripeLink generates a Stripe Checkout session URL for payment.
 // It creates a new checkout session with the specified parameters and returns the payment URL.
 //
@@ -263,12 +417,12 @@ func sessionExpired(event stripe.Event) {
 //   - referenceId: unique reference identifier for the transaction
 //   - customerId: existing Stripe customer ID (empty string if new customer)
 //   - email: customer email address for new customer creation
-//   - amount: quantity of units to purchase
+//   - lineItem: the item to purchase, either unit top-up or a quota package
 //   - successURL: custom URL to redirect after successful payment (empty for default)
 //   - cancelURL: custom URL to redirect when payment is canceled (empty for default)
 //
 // Returns the checkout session URL or an error if the session creation fails.
-func genStripeLink(referenceId string, customerId string, email string, amount int64, successURL string, cancelURL string) (string, error) {
+func genStripeLink(referenceId string, customerId string, email string, lineItem *stripe.CheckoutSessionLineItemParams, successURL string, cancelURL string) (string, error) {
 	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
 		return "", fmt.Errorf("无效的Stripe API密钥")
 	}
@@ -284,15 +438,10 @@ func genStripeLink(referenceId string, customerId string, email string, amount i
 	}
 
 	params := &stripe.CheckoutSessionParams{
-		ClientReferenceID: stripe.String(referenceId),
-		SuccessURL:        stripe.String(successURL),
-		CancelURL:         stripe.String(cancelURL),
-		LineItems: []*stripe.CheckoutSessionLineItemParams{
-			{
-				Price:    stripe.String(setting.StripePriceId),
-				Quantity: stripe.Int64(amount),
-			},
-		},
+		ClientReferenceID:   stripe.String(referenceId),
+		SuccessURL:          stripe.String(successURL),
+		CancelURL:           stripe.String(cancelURL),
+		LineItems:           []*stripe.CheckoutSessionLineItemParams{lineItem},
 		Mode:                stripe.String(string(stripe.CheckoutSessionModePayment)),
 		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
 	}
@@ -324,7 +473,16 @@ func GetChargedAmount(count float64, user model.User) float64 {
 	return count * topUpGroupRatio
 }
 
-func getStripePayMoney(amount float64, group string) float64 {
+// stripeChargeCurrency 多币种套餐的 Stripe 支付币种，仅支持 USD 与 EUR
+func stripeChargeCurrency(currency string) string {
+	if strings.ToUpper(currency) == "EUR" {
+		return "EUR"
+	}
+	return "USD"
+}
+
+// getStripePayMoney 返回支付金额，命中配置了支付币种价格的多币种套餐时按套餐价计算并返回 true
+func getStripePayMoney(amount float64, group string, currency string) (float64, bool) {
 	originalAmount := amount
 	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
 		amount = amount / common.QuotaPerUnit
@@ -334,6 +492,9 @@ func getStripePayMoney(amount float64, group string) float64 {
 	if topupGroupRatio == 0 {
 		topupGroupRatio = 1
 	}
+	if price, ok := operation_setting.GetCurrencySetting().GetPackagePrice(int64(originalAmount), stripeChargeCurrency(currency)); ok {
+		return price * topupGroupRatio, true
+	}
 	// apply optional preset discount by the original request amount (if configured), default 1.0
 	discount := 1.0
 	if ds, ok := operation_setting.GetPaymentSetting().AmountDiscount[int(originalAmount)]; ok {
@@ -342,7 +503,7 @@ func getStripePayMoney(amount float64, group string) float64 {
 		}
 	}
 	payMoney := amount * setting.StripeUnitPrice * topupGroupRatio * discount
-	return payMoney
+	return payMoney, false
 }
 
 func getStripeMinTopup() int64 {
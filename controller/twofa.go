@@ -8,6 +8,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -486,6 +487,111 @@ func Verify2FALogin(c *gin.Context) {
 	setupLogin(user, c)
 }
 
+// getPending2FAUser 获取已通过密码验证、等待两步验证的用户
+func getPending2FAUser(c *gin.Context) (*model.User, bool) {
+	userId, ok := sessions.Default(c).Get("pending_user_id").(int)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "会话已过期，请重新登录",
+		})
+		return nil, false
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+func twoFARecoveryKey(userId int) string {
+	return fmt.Sprintf("2fa_recovery_%d", userId)
+}
+
+// Send2FARecoveryEmail 无法使用认证器和备用码时，向注册邮箱发送恢复验证码
+func Send2FARecoveryEmail(c *gin.Context) {
+	if !system_setting.GetTwoFASettings().EmailRecoveryEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启邮箱恢复两步验证，请联系管理员重置",
+		})
+		return
+	}
+	user, ok := getPending2FAUser(c)
+	if !ok {
+		return
+	}
+	if user.Email == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "账户未绑定邮箱，请联系管理员重置两步验证",
+		})
+		return
+	}
+	code := common.GenerateVerificationCode(6)
+	common.RegisterVerificationCodeWithKey(twoFARecoveryKey(user.Id), code, common.TwoFARecoveryPurpose)
+	subject := fmt.Sprintf("%s两步验证恢复", common.SystemName)
+	content := fmt.Sprintf("<p>您好，你正在通过邮箱恢复%s账户的两步验证。</p>"+
+		"<p>您的恢复验证码为: <strong>%s</strong></p>"+
+		"<p>验证码 %d 分钟内有效，验证通过后两步验证将被关闭。如果不是本人操作，请立即修改密码。</p>", common.SystemName, code, common.VerificationValidMinutes)
+	if err := common.SendEmail(subject, user.Email, content); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "恢复验证码已发送到账户绑定的邮箱",
+	})
+}
+
+// Verify2FARecovery 校验邮箱恢复验证码，通过后关闭两步验证并完成登录
+func Verify2FARecovery(c *gin.Context) {
+	if !system_setting.GetTwoFASettings().EmailRecoveryEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启邮箱恢复两步验证，请联系管理员重置",
+		})
+		return
+	}
+	var req Verify2FARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "参数错误",
+		})
+		return
+	}
+	user, ok := getPending2FAUser(c)
+	if !ok {
+		return
+	}
+	key := twoFARecoveryKey(user.Id)
+	if !common.VerifyCodeWithKey(key, req.Code, common.TwoFARecoveryPurpose) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "恢复验证码错误或已过期",
+		})
+		return
+	}
+	common.DeleteKey(key, common.TwoFARecoveryPurpose)
+	if err := model.DisableTwoFA(user.Id); err != nil && !errors.Is(err, model.ErrTwoFANotEnabled) {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(user.Id, model.LogTypeSystem, "通过邮箱恢复关闭两步验证")
+
+	session := sessions.Default(c)
+	session.Delete("pending_username")
+	session.Delete("pending_user_id")
+	session.Save()
+
+	setupLogin(user, c)
+}
+
 // Admin2FAStats 管理员获取2FA统计信息
 func Admin2FAStats(c *gin.Context) {
 	stats, err := model.GetTwoFAStats()
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUsageEventInfo 返回 Avro Schema 以及本节点丢弃、发送失败的事件数
+func GetUsageEventInfo(c *gin.Context) {
+	dropped, failed := service.UsageEventStats()
+	common.ApiSuccess(c, gin.H{
+		"avro_schema": service.UsageEventAvroSchema,
+		"dropped":     dropped,
+		"failed":      failed,
+	})
+}
+
+// TestUsageEventPublish 按当前配置发送一条示例事件，用于检查连接与权限
+func TestUsageEventPublish(c *gin.Context) {
+	if err := service.TestUsageEventPublish(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
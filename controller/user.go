@@ -17,6 +17,8 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/QuantumNous/new-api/constant"
 
@@ -58,6 +60,10 @@ func Login(c *gin.Context) {
 		})
 		return
 	}
+	if user.LdapDn != "" && system_setting.GetLDAPSettings().DisablePasswordLogin {
+		common.ApiErrorI18n(c, i18n.MsgUserLdapPasswordLoginDisabled)
+		return
+	}
 
 	// 检查是否启用2FA
 	if model.IsTwoFAEnabled(user.Id) {
@@ -107,6 +113,8 @@ func setupLogin(user *model.User, c *gin.Context) {
 			"role":         user.Role,
 			"status":       user.Status,
 			"group":        user.Group,
+			// 角色要求两步验证但尚未启用时，前端需引导用户先完成设置
+			"require_2fa_setup": system_setting.GetTwoFASettings().IsRequired(user.Role) && !model.IsTwoFAEnabled(user.Id),
 		},
 	})
 }
@@ -378,6 +386,7 @@ func GetSelf(c *gin.Context) {
 
 	// 计算用户权限信息
 	permissions := calculateUserPermissions(userRole)
+	permissions["admin_permissions"] = model.GetUserPermissions(user.Id, userRole)
 
 	// 获取用户设置并提取sidebar_modules
 	userSetting := user.GetSetting()
@@ -407,8 +416,25 @@ func GetSelf(c *gin.Context) {
 		"linux_do_id":       user.LinuxDOId,
 		"setting":           user.Setting,
 		"stripe_customer":   user.StripeCustomer,
+		"billing_mode":      user.BillingMode,
+		"credit_limit":      user.CreditLimit,
 		"sidebar_modules":   userSetting.SidebarModules, // 正确提取sidebar_modules字段
 		"permissions":       permissions,                // 新增权限字段
+		"organization_id":   user.OrganizationId,
+		"organization_role": user.OrganizationRole,
+	}
+	// 组织成员显示组织额度池的余额
+	quota := user.Quota
+	if user.OrganizationId != 0 {
+		if orgQuota, err := model.GetUserQuota(user.Id, true); err == nil {
+			quota = orgQuota
+			responseData["quota"] = quota
+		}
+	}
+	// 开启多币种展示时同时返回各币种金额
+	if amounts := service.QuotaCurrencyAmounts(int64(quota)); amounts != nil {
+		responseData["quota_amounts"] = amounts
+		responseData["used_quota_amounts"] = service.QuotaCurrencyAmounts(int64(user.UsedQuota))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -523,6 +549,9 @@ func GetUserModels(c *gin.Context) {
 	var models []string
 	for group := range groups {
 		for _, g := range model.GetGroupEnabledModels(group) {
+			if !operation_setting.IsModelAllowedForGroup(user.Group, g) {
+				continue
+			}
 			if !common.StringsContains(models, g) {
 				models = append(models, g)
 			}
@@ -564,6 +593,30 @@ func UpdateUser(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgUserCannotCreateHigherLevel)
 		return
 	}
+	// 未提交计费模式时保持原设置
+	switch updatedUser.BillingMode {
+	case "":
+		updatedUser.BillingMode = originUser.BillingMode
+		updatedUser.CreditLimit = originUser.CreditLimit
+	case common.UserBillingModePrepaid:
+		updatedUser.CreditLimit = 0
+	case common.UserBillingModePostpaid:
+		if updatedUser.CreditLimit < 0 {
+			common.ApiErrorMsg(c, "信用额度不能为负数")
+			return
+		}
+	default:
+		common.ApiErrorMsg(c, "无效的计费模式")
+		return
+	}
+	if err := common.ValidateIpList(updatedUser.AllowIps); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := common.ValidateIpList(updatedUser.DenyIps); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
@@ -573,7 +626,10 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 	if originUser.Quota != updatedUser.Quota {
-		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
+		model.RecordQuotaLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)), updatedUser.Quota-originUser.Quota)
+	}
+	if originUser.BillingMode != updatedUser.BillingMode || originUser.CreditLimit != updatedUser.CreditLimit {
+		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将计费模式修改为 %s，信用额度 %s", updatedUser.BillingMode, logger.LogQuota(updatedUser.CreditLimit)))
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -869,6 +925,12 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = common.RoleCommonUser
+		// 降级后清除自定义管理员角色，再次提升时恢复默认权限
+		user.AdminRoleId = 0
+		if err := model.SetUserAdminRole(user.Id, 0); err != nil {
+			common.ApiError(c, err)
+			return
+		}
 	}
 
 	if err := user.Update(false); err != nil {
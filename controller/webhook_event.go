@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type webhookEndpointRequest struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Url     string `json:"url"`
+	Secret  string `json:"secret"`
+	Events  string `json:"events"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// checkWebhookEndpoint 校验推送地址，渠道事件只允许拥有渠道读取权限的管理员订阅
+func checkWebhookEndpoint(c *gin.Context, endpoint *model.WebhookEndpoint) bool {
+	if err := endpoint.Validate(); err != nil {
+		common.ApiError(c, err)
+		return false
+	}
+	if endpoint.Subscribes(model.WebhookEventChannelStatusChanged) &&
+		!common.HasPermissions(model.GetUserPermissions(c.GetInt("id"), c.GetInt("role")), common.PermissionChannelsRead) {
+		common.ApiErrorMsg(c, "无权订阅渠道状态事件")
+		return false
+	}
+	return true
+}
+
+func GetSelfWebhookEndpoints(c *gin.Context) {
+	endpoints, err := model.GetWebhookEndpointsByUserId(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"enabled":     operation_setting.GetWebhookEventSetting().Enabled,
+		"event_types": model.WebhookEventTypes,
+		"endpoints":   endpoints,
+	})
+}
+
+func CreateSelfWebhookEndpoint(c *gin.Context) {
+	setting := operation_setting.GetWebhookEventSetting()
+	if !setting.Enabled {
+		common.ApiErrorMsg(c, "管理员未开启事件推送")
+		return
+	}
+	var req webhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	userId := c.GetInt("id")
+	count, err := model.CountWebhookEndpointsByUserId(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if setting.MaxEndpointsPerUser > 0 && count >= int64(setting.MaxEndpointsPerUser) {
+		common.ApiErrorMsg(c, "推送地址数量已达上限")
+		return
+	}
+	endpoint := &model.WebhookEndpoint{
+		UserId:  userId,
+		Name:    req.Name,
+		Url:     req.Url,
+		Secret:  req.Secret,
+		Events:  req.Events,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if endpoint.Secret == "" {
+		endpoint.Secret = "whsec_" + common.GetRandomString(32)
+	}
+	if !checkWebhookEndpoint(c, endpoint) {
+		return
+	}
+	if err = endpoint.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateWebhookEndpointCache()
+	common.ApiSuccess(c, endpoint)
+}
+
+func UpdateSelfWebhookEndpoint(c *gin.Context) {
+	var req webhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	endpoint, err := model.GetUserWebhookEndpointById(req.Id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "推送地址不存在")
+		return
+	}
+	endpoint.Name = req.Name
+	endpoint.Url = req.Url
+	endpoint.Events = req.Events
+	if req.Secret != "" {
+		endpoint.Secret = req.Secret
+	}
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+	if !checkWebhookEndpoint(c, endpoint) {
+		return
+	}
+	if err = endpoint.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateWebhookEndpointCache()
+	common.ApiSuccess(c, endpoint)
+}
+
+func DeleteSelfWebhookEndpoint(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.DeleteUserWebhookEndpoint(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateWebhookEndpointCache()
+	common.ApiSuccess(c, nil)
+}
+
+func GetSelfWebhookEvents(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	endpointId, _ := strconv.Atoi(c.Query("endpoint_id"))
+	events, total, err := model.GetUserWebhookEvents(c.GetInt("id"), endpointId, c.Query("type"), c.Query("status"),
+		pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(events)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RedeliverSelfWebhookEvent 立即重新投递一条记录，返回本次投递的结果
+func RedeliverSelfWebhookEvent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	event, err := model.GetUserWebhookEventById(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "投递记录不存在")
+		return
+	}
+	event, err = service.RedeliverWebhookEvent(event)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, event)
+}
@@ -7,6 +7,13 @@ type ChannelSettings struct {
 	PassThroughBodyEnabled bool   `json:"pass_through_body_enabled,omitempty"`
 	SystemPrompt           string `json:"system_prompt,omitempty"`
 	SystemPromptOverride   bool   `json:"system_prompt_override,omitempty"`
+	// 上游不支持 response_format 时，改为提示词约束并在网关侧校验 JSON 输出
+	StructuredOutputEmulation bool `json:"structured_output_emulation,omitempty"`
+	// 超时（秒）与重试次数，未配置时使用模型或全局设置
+	ConnectTimeout    int  `json:"connect_timeout,omitempty"`
+	RequestTimeout    int  `json:"request_timeout,omitempty"`
+	StreamIdleTimeout int  `json:"stream_idle_timeout,omitempty"`
+	MaxRetries        *int `json:"max_retries,omitempty"`
 }
 
 type VertexKeyType string
@@ -23,14 +30,44 @@ const (
 	AwsKeyTypeApiKey AwsKeyType = "api_key"
 )
 
+type UpstreamModelSyncMode string
+
+const (
+	UpstreamModelSyncModeOff        UpstreamModelSyncMode = ""            // 不同步（默认）
+	UpstreamModelSyncModeAddOnly    UpstreamModelSyncMode = "add_only"    // 仅添加上游新增模型
+	UpstreamModelSyncModeRemoveOnly UpstreamModelSyncMode = "remove_only" // 仅移除上游已下线模型
+	UpstreamModelSyncModeFull       UpstreamModelSyncMode = "full"        // 与上游保持一致
+)
+
 type ChannelOtherSettings struct {
-	AzureResponsesVersion string        `json:"azure_responses_version,omitempty"`
-	VertexKeyType         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
-	OpenRouterEnterprise  *bool         `json:"openrouter_enterprise,omitempty"`
-	AllowServiceTier      bool          `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
-	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
-	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
-	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	AzureResponsesVersion string                     `json:"azure_responses_version,omitempty"`
+	VertexKeyType         VertexKeyType              `json:"vertex_key_type,omitempty"` // "json" or "api_key"
+	OpenRouterEnterprise  *bool                      `json:"openrouter_enterprise,omitempty"`
+	AllowServiceTier      bool                       `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
+	DisableStore          bool                       `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
+	AllowSafetyIdentifier bool                       `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
+	AwsKeyType            AwsKeyType                 `json:"aws_key_type,omitempty"`
+	UpstreamModelSyncMode UpstreamModelSyncMode      `json:"upstream_model_sync_mode,omitempty"` // 上游模型列表自动同步策略
+	AzureDeployments      map[string]AzureDeployment `json:"azure_deployments,omitempty"`        // Azure 模型名 → 部署，未配置的模型沿用模型名作为部署名
+	CostRatio             float64                    `json:"cost_ratio,omitempty"`               // 渠道实际成本相对模型定价的比例，用于上游账单对账，未配置时为 1
+}
+
+// AzureDeployment Azure OpenAI 部署信息，ApiVersion 为空时使用渠道默认 API 版本
+type AzureDeployment struct {
+	Deployment string `json:"deployment"`
+	ApiVersion string `json:"api_version,omitempty"`
+}
+
+// GetAzureDeployment 返回模型对应的 Azure 部署配置
+func (s *ChannelOtherSettings) GetAzureDeployment(modelName string) (AzureDeployment, bool) {
+	if s == nil {
+		return AzureDeployment{}, false
+	}
+	deployment, ok := s.AzureDeployments[modelName]
+	if !ok || deployment.Deployment == "" {
+		return AzureDeployment{}, false
+	}
+	return deployment, true
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
@@ -13,6 +13,16 @@ const (
 	NotifyTypeQuotaExceed   = "quota_exceed"
 	NotifyTypeChannelUpdate = "channel_update"
 	NotifyTypeChannelTest   = "channel_test"
+	NotifyTypeCreditLimit   = "credit_limit"
+	NotifyTypeInvoice       = "invoice"
+	NotifyTypeBudget        = "budget"
+	NotifyTypeTokenLocation = "token_location"
+	NotifyTypeTokenRotation = "token_rotation"
+	NotifyTypeTokenExpiry   = "token_expiry"
+	NotifyTypeAuditLog      = "audit_log"
+	NotifyTypeModeration    = "moderation"
+	NotifyTypeQuotaGrant    = "quota_grant"
+	NotifyTypeLogExport     = "log_export"
 )
 
 func NewNotify(t string, title string, content string, values []interface{}) Notify {
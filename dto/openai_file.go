@@ -0,0 +1,21 @@
+package dto
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+	FilePurposeFineTune    = "fine-tune"
+	FilePurposeAssistants  = "assistants"
+	FilePurposeVision      = "vision"
+	FilePurposeUserData    = "user_data"
+)
+
+// OpenAIFile OpenAI Files API 返回的文件对象
+type OpenAIFile struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"`
+}
@@ -61,6 +61,8 @@ const (
 // User related messages
 const (
 	MsgUserPasswordLoginDisabled      = "user.password_login_disabled"
+	MsgUserLdapPasswordLoginDisabled  = "user.ldap_password_login_disabled"
+	MsgUserLdapLoginDisabled          = "user.ldap_login_disabled"
 	MsgUserRegisterDisabled           = "user.register_disabled"
 	MsgUserPasswordRegisterDisabled   = "user.password_register_disabled"
 	MsgUserUsernameOrPasswordEmpty    = "user.username_or_password_empty"
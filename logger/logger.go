@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -30,11 +32,25 @@ const maxLogCount = 1000000
 var logCount int
 var setupLogLock sync.Mutex
 var setupLogWorking bool
+var syslogWriter io.Writer
 
 func SetupLogger() {
 	defer func() {
 		setupLogWorking = false
 	}()
+	if common.LogOutput == common.LogOutputSyslog {
+		if syslogWriter != nil {
+			return
+		}
+		writer, err := newSyslogWriter()
+		if err != nil {
+			log.Fatal("failed to connect to syslog: " + err.Error())
+		}
+		syslogWriter = writer
+		gin.DefaultWriter = writer
+		gin.DefaultErrorWriter = writer
+		return
+	}
 	if *common.LogDir != "" {
 		ok := setupLogLock.TryLock()
 		if !ok {
@@ -49,8 +65,13 @@ func SetupLogger() {
 		if err != nil {
 			log.Fatal("failed to open log file")
 		}
-		gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
-		gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
+		if common.LogOutput == common.LogOutputFile {
+			gin.DefaultWriter = fd
+			gin.DefaultErrorWriter = fd
+		} else {
+			gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
+			gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
+		}
 	}
 }
 
@@ -67,7 +88,7 @@ func LogError(ctx context.Context, msg string) {
 }
 
 func LogDebug(ctx context.Context, msg string, args ...any) {
-	if common.DebugEnabled {
+	if common.DebugEnabled || common.LogLevelEnabled(slog.LevelDebug) {
 		if len(args) > 0 {
 			msg = fmt.Sprintf(msg, args...)
 		}
@@ -75,17 +96,59 @@ func LogDebug(ctx context.Context, msg string, args ...any) {
 	}
 }
 
+// contextLogAttrs 从请求上下文中提取关联字段
+func contextLogAttrs(ctx context.Context, id any) []slog.Attr {
+	attrs := []slog.Attr{slog.Any("request_id", id)}
+	c, ok := ctx.(*gin.Context)
+	if !ok {
+		return attrs
+	}
+	if userId := c.GetInt("id"); userId != 0 {
+		attrs = append(attrs, slog.Int("user_id", userId))
+	}
+	if tokenId := c.GetInt("token_id"); tokenId != 0 {
+		attrs = append(attrs, slog.Int("token_id", tokenId))
+	}
+	if channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId); channelId != 0 {
+		attrs = append(attrs, slog.Int("channel_id", channelId))
+	}
+	if modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel); modelName != "" {
+		attrs = append(attrs, slog.String("model", modelName))
+	}
+	return attrs
+}
+
+func slogLevel(level string) slog.Level {
+	switch level {
+	case loggerDebug:
+		return slog.LevelDebug
+	case loggerWarn:
+		return slog.LevelWarn
+	case loggerError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
 func logHelper(ctx context.Context, level string, msg string) {
-	writer := gin.DefaultErrorWriter
-	if level == loggerINFO {
-		writer = gin.DefaultWriter
+	if !common.LogLevelEnabled(slogLevel(level)) && level != loggerDebug {
+		return
 	}
 	id := ctx.Value(common.RequestIdKey)
 	if id == nil {
 		id = "SYSTEM"
 	}
-	now := time.Now()
-	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
+	if common.IsJSONLog() {
+		common.LogJSON(slogLevel(level), msg, contextLogAttrs(ctx, id)...)
+	} else {
+		writer := gin.DefaultErrorWriter
+		if level == loggerINFO {
+			writer = gin.DefaultWriter
+		}
+		now := time.Now()
+		_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
+	}
 	logCount++ // we don't need accurate count, so no lock here
 	if logCount > maxLogCount && !setupLogWorking {
 		logCount = 0
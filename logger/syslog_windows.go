@@ -0,0 +1,12 @@
+//go:build windows
+
+package logger
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslogWriter() (io.Writer, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
@@ -2,13 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -19,8 +25,12 @@ import (
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/pkg/autotls"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/router"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/logarchive"
+	"github.com/QuantumNous/new-api/service/logexport"
 	_ "github.com/QuantumNous/new-api/setting/performance_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 
@@ -40,6 +50,11 @@ var buildFS embed.FS
 var indexPage []byte
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
+	}
+
 	startTime := time.Now()
 
 	err := InitResources()
@@ -63,7 +78,7 @@ func main() {
 		}
 	}()
 
-	if common.RedisEnabled {
+	if common.RDB != nil {
 		// for compatibility with old versions
 		common.MemoryCacheEnabled = true
 	}
@@ -91,6 +106,8 @@ func main() {
 
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
+	model.StartConfigSync()
+	model.StartCacheInvalidationBus()
 
 	// 数据看板
 	go model.UpdateQuotaData()
@@ -105,12 +122,56 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
+	go controller.AutomaticallySyncChannelModels()
+
 	// Codex credential auto-refresh check every 10 minutes, refresh when expires within 1 day
 	service.StartCodexCredentialAutoRefreshTask()
 
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Stored /v1/responses objects cleanup
+	service.StartStoredResponseCleanupTask()
+
+	// Usage analytics hourly/daily rollup and log retention
+	service.StartUsageAnalyticsTask()
+
+	// Archive old logs to object storage
+	logarchive.StartLogArchiveTask()
+
+	// Clean up expired user log export files
+	logexport.StartLogExportCleanupTask()
+
+	// Clean up expired upstream body captures
+	service.StartBodyCaptureCleanupTask()
+
+	// Issue monthly invoices for postpaid users
+	service.StartPostpaidInvoiceTask()
+
+	// Sync LDAP users' groups and roles from the directory
+	service.StartLdapSyncTask()
+
+	// Rotate token keys by group policy and remind owners of expiring tokens
+	service.StartTokenRotationTask()
+
+	// Evaluate canary channels and promote or disable them
+	service.StartCanaryEvaluationTask()
+
+	// Run scheduled quota grants
+	service.StartQuotaGrantTask()
+
+	// Refresh exchange rates for multi-currency display
+	service.StartExchangeRateTask()
+
+	// Retry failed webhook event deliveries and clean up old delivery records
+	service.StartWebhookEventTask()
+
+	// Publish relay usage events to Kafka or NATS from every node
+	service.StartUsageEventPublisher()
+
+	// Pre-create upcoming monthly partitions when the logs table is partitioned
+	service.StartLogPartitionTask()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -140,6 +201,12 @@ func main() {
 
 	// Initialize HTTP server
 	server := gin.New()
+	if len(constant.TrustedProxies) > 0 {
+		if err := server.SetTrustedProxies(constant.TrustedProxies); err != nil {
+			common.FatalLog("invalid TRUSTED_PROXIES: " + err.Error())
+		}
+	}
+	server.TrustedPlatform = constant.TrustedPlatform
 	server.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
 		common.SysLog(fmt.Sprintf("panic detected: %v", err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -171,6 +238,10 @@ func main() {
 
 	// 设置路由
 	router.SetRouter(server, buildFS, indexPage)
+
+	// Batch API 调度，批处理请求通过路由重放以复用分发与计费
+	service.StartBatchTask(server)
+
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
@@ -179,10 +250,141 @@ func main() {
 	// Log startup success message
 	common.LogStartupSuccess(startTime, port)
 
-	err = server.Run(":" + port)
+	httpServer := &http.Server{Addr: ":" + port, Handler: server}
+	servers := []*http.Server{httpServer}
+	tlsManager, err := newTLSManager()
 	if err != nil {
-		common.FatalLog("failed to start HTTP server: " + err.Error())
+		common.FatalLog("failed to configure TLS: " + err.Error())
+	}
+	if tlsManager != nil {
+		tlsPort := common.GetEnvOrDefaultString("TLS_PORT", "443")
+		httpsServer := &http.Server{Addr: ":" + tlsPort, Handler: server, TLSConfig: tlsManager.TLSConfig()}
+		// HTTP 端口继续响应 ACME 验证，其余请求默认重定向到 HTTPS
+		if common.GetEnvOrDefaultBool("TLS_REDIRECT_HTTP", true) {
+			httpServer.Handler = tlsManager.HTTPHandler(autotls.RedirectHandler(tlsPort))
+		} else {
+			httpServer.Handler = tlsManager.HTTPHandler(server)
+		}
+		tlsManager.Start()
+		go func() {
+			if err := httpsServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				common.FatalLog("failed to start HTTPS server: " + err.Error())
+			}
+		}()
+		common.SysLog("HTTPS enabled on port " + tlsPort)
+		servers = append(servers, httpsServer)
+	}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			common.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	common.SysLog(fmt.Sprintf("received %s, shutting down", sig))
+	shutdownServer(servers...)
+}
+
+// newTLSManager 配置了 TLS_DOMAINS 时启用内置 HTTPS，证书通过 ACME 自动申请与续期
+func newTLSManager() (*autotls.Manager, error) {
+	var domains []string
+	for _, domain := range strings.Split(os.Getenv("TLS_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		return nil, nil
+	}
+	config := autotls.Config{
+		Domains:            domains,
+		Email:              os.Getenv("TLS_ACME_EMAIL"),
+		CacheDir:           common.GetEnvOrDefaultString("TLS_CACHE_DIR", "data/certs"),
+		DirectoryURL:       os.Getenv("TLS_ACME_DIRECTORY"),
+		Challenge:          os.Getenv("TLS_ACME_CHALLENGE"),
+		PropagationTimeout: time.Duration(common.GetEnvOrDefault("TLS_DNS_PROPAGATION_TIMEOUT", 120)) * time.Second,
+	}
+	if config.Challenge == autotls.ChallengeDNS01 {
+		var err error
+		switch provider := os.Getenv("TLS_DNS_PROVIDER"); provider {
+		case "cloudflare":
+			config.DNSProvider, err = autotls.NewCloudflareProvider(os.Getenv("CLOUDFLARE_API_TOKEN"))
+		case "exec":
+			config.DNSProvider, err = autotls.NewExecProvider(os.Getenv("TLS_DNS_EXEC"))
+		default:
+			err = fmt.Errorf("unknown TLS_DNS_PROVIDER: %s", provider)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return autotls.New(config)
+}
+
+// shutdownServer 停止接收新请求，等待进行中的请求（包括流式响应）结束，再写入缓冲中的计费、日志与通知
+func shutdownServer(servers ...*http.Server) {
+	common.ShuttingDown.Store(true)
+	for _, httpServer := range servers {
+		httpServer.SetKeepAlivesEnabled(false)
 	}
+	// 健康检查已返回 503，等待负载均衡摘除本节点后再关闭监听
+	if delay := common.GetEnvOrDefault("SHUTDOWN_DELAY", 0); delay > 0 {
+		common.SysLog(fmt.Sprintf("waiting %ds for load balancers to deregister this node", delay))
+		time.Sleep(time.Duration(delay) * time.Second)
+	}
+
+	drainTimeout := time.Duration(common.GetEnvOrDefault("SHUTDOWN_DRAIN_TIMEOUT", 60)) * time.Second
+	common.SysLog(fmt.Sprintf("draining in-flight requests, timeout %s", drainTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	drained := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-drained:
+				return
+			case <-ticker.C:
+				common.SysLog(fmt.Sprintf("draining: %d relay requests in flight", middleware.GetStats().ActiveConnections))
+			}
+		}
+	}()
+	var timedOut atomic.Bool
+	var wg sync.WaitGroup
+	for _, httpServer := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				timedOut.Store(true)
+				_ = httpServer.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	close(drained)
+	if timedOut.Load() {
+		common.SysError(fmt.Sprintf("drain timeout reached with %d relay requests in flight, closed remaining connections", middleware.GetStats().ActiveConnections))
+	} else {
+		common.SysLog("all in-flight requests finished")
+	}
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer flushCancel()
+	model.FlushBatchUpdates()
+	if common.DataExportEnabled {
+		model.SaveQuotaDataCache()
+	}
+	// 批量写入的日志还会投递到 ClickHouse，需先于 ClickHouse 写入
+	model.FlushLogBatch(flushCtx)
+	model.FlushClickHouseLogs(flushCtx)
+	service.FlushUsageEvents(flushCtx)
+	service.FlushTagDisableNotifies()
+	tracing.Shutdown()
+	common.SysLog("pending writes flushed, shutdown complete")
 }
 
 func InjectUmamiAnalytics() {
@@ -272,12 +474,32 @@ func InitResources() error {
 		return err
 	}
 
+	// Initialize read replicas
+	err = model.InitReplicas()
+	if err != nil {
+		return err
+	}
+
+	// Initialize ClickHouse log storage
+	err = model.InitClickHouse()
+	if err != nil {
+		return err
+	}
+
+	model.InitLogBatchWriter()
+
 	// Initialize Redis
 	err = common.InitRedisClient()
 	if err != nil {
 		return err
 	}
 
+	// Elect the node that runs background jobs
+	err = model.StartLeaderElection()
+	if err != nil {
+		return err
+	}
+
 	// 启动系统监控
 	common.StartSystemMonitor()
 
@@ -301,3 +523,58 @@ func InitResources() error {
 
 	return nil
 }
+
+// runMigrateCommand 处理 new-api migrate <status|up [n]|down [n]>，只连接数据库，不启动服务
+func runMigrateCommand(args []string) {
+	_ = godotenv.Load(".env")
+	common.InitEnv()
+	if err := model.OpenDatabases(); err != nil {
+		common.FatalLog("failed to connect database: " + err.Error())
+	}
+	defer model.CloseDB()
+
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	steps := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid migration steps %q", args[1])
+		}
+		steps = n
+	}
+
+	switch action {
+	case "status":
+		statuses, unknown, err := model.GetMigrationStatuses()
+		if err != nil {
+			log.Fatalf("failed to load migration status: %v", err)
+		}
+		for _, status := range statuses {
+			appliedAt := ""
+			if status.AppliedAt > 0 {
+				appliedAt = time.Unix(status.AppliedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-28s %-5s %-8s %s\n", status.Version, status.Name, status.Target, status.State, appliedAt)
+		}
+		for _, record := range unknown {
+			fmt.Printf("%4d  %-28s %-5s %-8s %s\n", record.Version, record.Name, "?", "unknown", time.Unix(record.AppliedAt, 0).Format(time.RFC3339))
+		}
+	case "up":
+		count, err := model.MigrateUp(steps)
+		fmt.Printf("%d migrations applied\n", count)
+		if err != nil {
+			log.Fatalf("migration failed: %v", err)
+		}
+	case "down":
+		count, err := model.MigrateDown(max(steps, 1))
+		fmt.Printf("%d migrations reverted\n", count)
+		if err != nil {
+			log.Fatalf("rollback failed: %v", err)
+		}
+	default:
+		log.Fatalf("unknown migrate action %q, expected status, up or down", action)
+	}
+}
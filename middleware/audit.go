@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditContextKey      = "audit_recording"
+	auditMaxBodyBytes    = 64 << 10
+	auditMaxMessageBytes = 512
+)
+
+// auditResponseWriter 记录响应内容，用于判断操作是否成功
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	buffer bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.buffer.Len()+len(data) <= auditMaxBodyBytes {
+		w.buffer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	if w.buffer.Len()+len(s) <= auditMaxBodyBytes {
+		w.buffer.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func isAuditedMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// auditEntity 由路由路径得到实体类型与操作，如 /api/channel/:id -> channel
+func auditEntity(c *gin.Context) string {
+	path := strings.TrimPrefix(c.FullPath(), "/api/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+func auditEntityId(c *gin.Context, entity string, body map[string]any) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	field := "id"
+	if entity == "option" {
+		field = "key"
+	}
+	switch v := body[field].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	if id := c.Query("id"); id != "" {
+		return id
+	}
+	return ""
+}
+
+func auditAction(method string, entityId string) string {
+	switch {
+	case method == http.MethodDelete:
+		return model.AuditActionDelete
+	case method == http.MethodPost && entityId == "":
+		return model.AuditActionCreate
+	default:
+		return model.AuditActionUpdate
+	}
+}
+
+// auditAdminRequest 记录管理接口的变更操作，嵌套的鉴权中间件只记录一次
+func auditAdminRequest(c *gin.Context, userId int, username string) {
+	if _, recording := c.Get(auditContextKey); recording || !system_setting.GetAuditLogSettings().Enabled {
+		c.Next()
+		return
+	}
+	c.Set(auditContextKey, true)
+
+	var body map[string]any
+	if strings.HasPrefix(c.ContentType(), "application/json") && c.Request.Body != nil {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, auditMaxBodyBytes+1))
+		rest := c.Request.Body
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), rest))
+		if err == nil && len(data) <= auditMaxBodyBytes {
+			_ = common.Unmarshal(data, &body)
+		}
+	}
+
+	entity := auditEntity(c)
+	entityId := auditEntityId(c, entity, body)
+	before := service.LoadAuditSnapshot(entity, entityId)
+
+	writer := &auditResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+
+	var response struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	_ = common.Unmarshal(writer.buffer.Bytes(), &response)
+	if len(response.Message) > auditMaxMessageBytes {
+		response.Message = response.Message[:auditMaxMessageBytes]
+	}
+
+	after := body
+	if entityId != "" && service.HasAuditSnapshotLoader(entity) {
+		after = service.LoadAuditSnapshot(entity, entityId)
+	}
+	service.RecordAuditLog(&model.AuditLog{
+		UserId:     userId,
+		Username:   username,
+		Ip:         c.ClientIP(),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Entity:     entity,
+		EntityId:   entityId,
+		Action:     auditAction(c.Request.Method, entityId),
+		StatusCode: writer.Status(),
+		Success:    writer.Status() < http.StatusBadRequest && response.Success,
+		Message:    response.Message,
+	}, before, after)
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-contrib/sessions"
@@ -30,7 +32,7 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+func authHelper(c *gin.Context, minRole int, permissions ...string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -125,6 +127,26 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	// 强制启用两步验证的角色在完成设置前只能访问个人信息与两步验证接口
+	if system_setting.GetTwoFASettings().IsRequired(role.(int)) && !isTwoFASetupPath(c.FullPath()) && !model.IsTwoFAEnabled(id.(int)) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员要求启用两步验证，请先在个人设置中完成设置",
+			"data": gin.H{
+				"require_2fa_setup": true,
+			},
+		})
+		c.Abort()
+		return
+	}
+	if len(permissions) > 0 && !common.HasPermissions(model.GetUserPermissions(id.(int), role.(int)), permissions...) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作，缺少权限 " + strings.Join(permissions, ", "),
+		})
+		c.Abort()
+		return
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
@@ -132,9 +154,17 @@ func authHelper(c *gin.Context, minRole int) {
 	c.Set("user_group", session.Get("group"))
 	c.Set("use_access_token", useAccessToken)
 
+	if minRole >= common.RoleAdminUser && isAuditedMethod(c.Request.Method) {
+		auditAdminRequest(c, id.(int), username.(string))
+		return
+	}
 	c.Next()
 }
 
+func isTwoFASetupPath(path string) bool {
+	return path == "/api/user/self" || strings.HasPrefix(path, "/api/user/2fa/")
+}
+
 func TryUserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
@@ -164,6 +194,49 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// OrganizationAdminAuth 要求当前登录用户是所在组织的管理员，需在 UserAuth 之后使用
+func OrganizationAdminAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, err := model.GetUserById(c.GetInt("id"), false)
+		if err != nil || user.OrganizationId == 0 || user.OrganizationRole != model.OrganizationRoleAdmin {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，需要组织管理员权限",
+			})
+			c.Abort()
+			return
+		}
+		c.Set("organization_id", user.OrganizationId)
+		c.Next()
+	}
+}
+
+// PermissionAuth 要求管理员身份并拥有全部指定权限
+func PermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleAdminUser, permissions...)
+	}
+}
+
+// ScimAuth 校验身份提供方调用 SCIM 接口时携带的 Bearer Token
+func ScimAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		settings := system_setting.GetSCIMSettings()
+		token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if !settings.Enabled || settings.Secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(settings.Secret)) != 1 {
+			c.Header("Content-Type", "application/scim+json")
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+				"status":  strconv.Itoa(http.StatusUnauthorized),
+				"detail":  "invalid or missing bearer token",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func WssAuth(c *gin.Context) {
 
 }
@@ -236,20 +309,15 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
-		allowIps := token.GetIpLimits()
-		if len(allowIps) > 0 {
-			clientIp := c.ClientIP()
-			logger.LogDebug(c, "Token has IP restrictions, checking client IP %s", clientIp)
-			ip := net.ParseIP(clientIp)
-			if ip == nil {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "无法解析客户端 IP 地址")
-				return
-			}
-			if common.IsIpInCIDRList(ip, allowIps) == false {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中", types.ErrorCodeAccessDenied)
-				return
-			}
-			logger.LogDebug(c, "Client IP %s passed the token IP restrictions check", clientIp)
+		clientIp := c.ClientIP()
+		ip := net.ParseIP(clientIp)
+		if !checkNetworkRestrictions(c, ip, clientIp, token, token.GetIpDenies(), token.GetIpLimits(), "令牌") {
+			return
+		}
+
+		if scope := tokenScopeForPath(c.Request.URL.Path); scope != "" && !token.HasScope(scope) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌无权访问 %s 类接口，允许的范围：%s", scope, strings.Join(token.GetScopes(), ", ")), types.ErrorCodeAccessDenied)
+			return
 		}
 
 		userCache, err := model.GetUserCache(token.UserId)
@@ -263,6 +331,11 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
+		if !checkNetworkRestrictions(c, ip, clientIp, token, common.ParseIpList(userCache.DenyIps), common.ParseIpList(userCache.AllowIps), "用户") {
+			return
+		}
+		service.TrackTokenLocation(token.UserId, token.Id, token.Name, clientIp)
+
 		userCache.WriteContext(c)
 
 		userGroup := userCache.Group
@@ -282,16 +355,54 @@ func TokenAuth() func(c *gin.Context) {
 			}
 			userGroup = tokenGroup
 		}
+		if userCache.OrganizationId != 0 {
+			org, err := model.GetOrganizationCached(userCache.OrganizationId)
+			if err != nil {
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if org.Status != common.UserStatusEnabled {
+				abortWithOpenAiMessage(c, http.StatusForbidden, "所属组织已被停用")
+				return
+			}
+			if !org.AllowsGroup(userGroup) {
+				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("所属组织无权访问 %s 分组", userGroup))
+				return
+			}
+		}
 		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
 
 		err = SetupContextForToken(c, token, parts...)
 		if err != nil {
 			return
 		}
+		setupCLIClientContext(c)
 		c.Next()
 	}
 }
 
+// checkNetworkRestrictions 按拒绝列表优先、白名单其次的顺序校验客户端 IP，拒绝时记录日志并中止请求
+func checkNetworkRestrictions(c *gin.Context, ip net.IP, clientIp string, token *model.Token, denyIps []string, allowIps []string, owner string) bool {
+	if len(denyIps) == 0 && len(allowIps) == 0 {
+		return true
+	}
+	logger.LogDebug(c, "%s has IP restrictions, checking client IP %s", owner, clientIp)
+	var reason string
+	switch {
+	case ip == nil:
+		reason = "无法解析客户端 IP 地址"
+	case common.IsIpInCIDRList(ip, denyIps):
+		reason = fmt.Sprintf("您的 IP %s 在%s禁止访问的列表中", clientIp, owner)
+	case len(allowIps) > 0 && !common.IsIpInCIDRList(ip, allowIps):
+		reason = fmt.Sprintf("您的 IP %s 不在%s允许访问的列表中", clientIp, owner)
+	default:
+		return true
+	}
+	service.RecordNetworkRejection(token.UserId, token.Id, token.Name, clientIp, reason)
+	abortWithOpenAiMessage(c, http.StatusForbidden, reason, types.ErrorCodeAccessDenied)
+	return false
+}
+
 func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) error {
 	if token == nil {
 		return fmt.Errorf("token is nil")
@@ -312,6 +423,19 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenMaxConcurrency, token.MaxConcurrency)
+	common.SetContextKey(c, constant.ContextKeyTokenContextTruncation, token.ContextTruncation)
+	common.SetContextKey(c, constant.ContextKeyTokenRelayRace, token.RelayRace)
+	// 请求头中的项目标识优先于令牌默认项目
+	project := token.Project
+	if header := strings.TrimSpace(c.Request.Header.Get("X-Project-Id")); header != "" {
+		if len(header) > model.ProjectMaxLength {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, fmt.Sprintf("X-Project-Id 长度不能超过 %d 个字符", model.ProjectMaxLength))
+			return fmt.Errorf("X-Project-Id too long")
+		}
+		project = header
+	}
+	common.SetContextKey(c, constant.ContextKeyProject, project)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
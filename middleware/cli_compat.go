@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	cliClientClaudeCode = "claude-code"
+	cliClientCodex      = "codex"
+)
+
+// detectCLIClient 按请求头识别命令行客户端：Claude Code 的 User-Agent 为 claude-cli/x.y.z，
+// Codex CLI 通过 originator 头（codex_cli_rs、codex_exec 等）或同名 User-Agent 标识自己
+func detectCLIClient(c *gin.Context) string {
+	userAgent := c.Request.Header.Get("User-Agent")
+	switch {
+	case strings.HasPrefix(userAgent, "claude-cli/"):
+		return cliClientClaudeCode
+	case strings.HasPrefix(c.Request.Header.Get("originator"), "codex"), strings.HasPrefix(userAgent, "codex"):
+		return cliClientCodex
+	}
+	return ""
+}
+
+func setupCLIClientContext(c *gin.Context) {
+	if !operation_setting.GetCLICompatSetting().Enabled {
+		return
+	}
+	if client := detectCLIClient(c); client != "" {
+		common.SetContextKey(c, constant.ContextKeyCLIClient, client)
+	}
+}
+
+// useClaudeErrorFormat Anthropic SDK 与 Claude Code 只能解析 {"type":"error","error":{...}} 格式的错误
+func useClaudeErrorFormat(c *gin.Context) bool {
+	setting := operation_setting.GetCLICompatSetting()
+	return setting.Enabled && setting.ClaudeErrorFormat && strings.HasPrefix(c.Request.URL.Path, "/v1/messages")
+}
+
+func claudeErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusPaymentRequired, http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return "api_error"
+	}
+	return "invalid_request_error"
+}
+
+func writeClaudeErrorMessage(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{
+		"type": "error",
+		"error": types.ClaudeError{
+			Type:    claudeErrorType(statusCode),
+			Message: common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+		},
+	})
+}
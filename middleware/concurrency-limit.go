@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	TokenConcurrencyCountMark = "TCRL"
+	// Redis 中每个进行中的请求是有序集合中的一项，分值为租约到期时间，请求进行中定期续期，
+	// 节点异常退出后未续期的项在租约到期后不再计数
+	tokenConcurrencyLease = 30 * time.Second
+)
+
+var (
+	tokenConcurrencyMutex  sync.Mutex
+	tokenConcurrencyCounts = make(map[int]int)
+)
+
+// 清理已过期的项后按剩余数量判断是否占用
+var tokenConcurrencyAcquireScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[1])
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[4])
+redis.call("PEXPIRE", KEYS[1], ARGV[5])
+return 1
+`)
+
+func tokenConcurrencyKey(tokenId int) string {
+	return fmt.Sprintf("rateLimit:%s:%d", TokenConcurrencyCountMark, tokenId)
+}
+
+// acquireTokenConcurrency 占用一个并发名额，返回的 release 为 nil 表示已达上限；
+// Redis 可能在请求过程中降级或恢复，release 固定使用占用时的后端
+func acquireTokenConcurrency(tokenId int, limit int, useRedis bool) (release func(), err error) {
+	if useRedis {
+		return acquireRedisTokenConcurrency(tokenId, limit)
+	}
+	tokenConcurrencyMutex.Lock()
+	defer tokenConcurrencyMutex.Unlock()
+	if tokenConcurrencyCounts[tokenId] >= limit {
+		return nil, nil
+	}
+	tokenConcurrencyCounts[tokenId]++
+	return func() {
+		tokenConcurrencyMutex.Lock()
+		defer tokenConcurrencyMutex.Unlock()
+		if tokenConcurrencyCounts[tokenId] <= 1 {
+			delete(tokenConcurrencyCounts, tokenId)
+			return
+		}
+		tokenConcurrencyCounts[tokenId]--
+	}, nil
+}
+
+func acquireRedisTokenConcurrency(tokenId int, limit int) (func(), error) {
+	ctx := context.Background()
+	key := tokenConcurrencyKey(tokenId)
+	member := common.GetUUID()
+	now := time.Now()
+	acquired, err := tokenConcurrencyAcquireScript.Run(ctx, common.RDB, []string{key},
+		now.UnixMilli(), limit, now.Add(tokenConcurrencyLease).UnixMilli(), member, tokenConcurrencyLease.Milliseconds()).Int()
+	if err != nil {
+		return nil, err
+	}
+	if acquired != 1 {
+		return nil, nil
+	}
+	stop := make(chan struct{})
+	gopool.Go(func() {
+		// 租约期内续期三次，单次失败不会使名额失效
+		ticker := time.NewTicker(tokenConcurrencyLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				expiresAt := float64(time.Now().Add(tokenConcurrencyLease).UnixMilli())
+				common.RDB.ZAddXX(ctx, key, &redis.Z{Score: expiresAt, Member: member})
+				common.RDB.PExpire(ctx, key, tokenConcurrencyLease)
+			}
+		}
+	})
+	return func() {
+		close(stop)
+		common.RDB.ZRem(ctx, key, member)
+	}, nil
+}
+
+// TokenConcurrencyLimit 限制单个令牌同时进行中的请求数，超限时返回 429 与 Retry-After
+func TokenConcurrencyLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenId := c.GetInt("token_id")
+		group := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
+		if group == "" {
+			group = common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+		}
+		limit := operation_setting.GetTokenMaxConcurrency(common.GetContextKeyInt(c, constant.ContextKeyTokenMaxConcurrency), group)
+		if limit <= 0 || tokenId == 0 {
+			c.Next()
+			return
+		}
+		release, err := acquireTokenConcurrency(tokenId, limit, common.RedisEnabled.Load())
+		if err != nil {
+			// 计数服务异常时不阻断请求
+			common.SysError("token concurrency limit check failed: " + err.Error())
+			c.Next()
+			return
+		}
+		if release == nil {
+			retryAfter := operation_setting.GetConcurrencySetting().RetryAfterSeconds
+			if retryAfter <= 0 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, "该令牌的并发请求数已达上限 "+strconv.Itoa(limit))
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
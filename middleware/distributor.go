@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -73,6 +74,11 @@ func Distribute() func(c *gin.Context) {
 				}
 			}
 
+			if modelRequest.Model != "" && !operation_setting.IsModelAllowedForGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup), modelRequest.Model) {
+				abortWithModelNotFound(c, modelRequest.Model)
+				return
+			}
+
 			if shouldSelectChannel {
 				if modelRequest.Model == "" {
 					abortWithOpenAiMessage(c, http.StatusBadRequest, "未指定模型名称，模型名称不能为空")
@@ -98,9 +104,31 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
+				if rewritten, rule := service.ResolveModelRewrite(modelRequest.Model, usingGroup); rule != nil {
+					common.SetContextKey(c, constant.ContextKeyRequestedModel, modelRequest.Model)
+					modelRequest.Model = rewritten
+				}
+
+				if routed, ok := service.ResolveVirtualModel(c, modelRequest.Model, usingGroup); ok {
+					if common.GetContextKeyString(c, constant.ContextKeyRequestedModel) == "" {
+						common.SetContextKey(c, constant.ContextKeyRequestedModel, modelRequest.Model)
+					}
+					modelRequest.Model = routed
+				}
+
+				// 改写与虚拟模型可能指向其他模型，按最终模型重新检查分组的模型白名单
+				if requested := common.GetContextKeyString(c, constant.ContextKeyRequestedModel); requested != "" &&
+					!operation_setting.IsModelAllowedForGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup), modelRequest.Model) {
+					abortWithModelNotFound(c, requested)
+					return
+				}
+
+				required := service.DetectRequiredCapabilities(c, modelRequest.Model)
+
 				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
 					preferred, err := model.CacheGetChannel(preferredChannelID)
-					if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled {
+					if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled &&
+						len(model.MissingChannelCapabilities(preferred, modelRequest.Model, required)) == 0 {
 						if usingGroup == "auto" {
 							userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
 							autoGroups := service.GetUserAutoGroup(userGroup)
@@ -128,6 +156,11 @@ func Distribute() func(c *gin.Context) {
 						TokenGroup: usingGroup,
 						Retry:      common.GetPointer(0),
 					})
+					var capabilityErr *model.ChannelCapabilityError
+					if errors.As(err, &capabilityErr) {
+						abortWithOpenAiMessage(c, http.StatusBadRequest, fmt.Sprintf("分组 %s 下模型 %s %s", usingGroup, modelRequest.Model, err.Error()), types.ErrorCodeInvalidRequest)
+						return
+					}
 					if err != nil {
 						showGroup := usingGroup
 						if usingGroup == "auto" {
@@ -296,6 +329,12 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 				modelRequest.Model = req.Model
 			}
 		}
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
+		// variations 仅支持 dall-e-2，model 参数可省略
+		if req, err := getModelFromRequest(c); err == nil && req.Model != "" {
+			modelRequest.Model = req.Model
+		}
+		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, "dall-e-2")
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		relayMode := relayconstant.RelayModeAudioSpeech
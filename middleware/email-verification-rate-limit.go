@@ -71,7 +71,7 @@ func memoryEmailVerificationRateLimiter(c *gin.Context) {
 
 func EmailVerificationRateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if common.RedisEnabled {
+		if common.RedisEnabled.Load() {
 			redisEmailVerificationRateLimiter(c)
 		} else {
 			inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
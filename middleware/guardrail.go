@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Guardrail 在转发前将分组或令牌配置的强制提示词写入请求体
+func Guardrail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+		rules := operation_setting.GetGuardrailSetting().ResolveRules(group, c.GetInt("token_id"))
+		if len(rules) == 0 || !strings.HasPrefix(c.ContentType(), "application/json") {
+			c.Next()
+			return
+		}
+		body, err := common.GetRequestBody(c)
+		if err != nil || len(body) == 0 {
+			c.Next()
+			return
+		}
+		newBody, applied, err := service.ApplyGuardrails(c.Request.URL.Path, body, rules, service.GuardrailVars{
+			Username:  common.GetContextKeyString(c, constant.ContextKeyUserName),
+			UserId:    c.GetInt("id"),
+			Group:     group,
+			TokenName: c.GetString("token_name"),
+			Model:     common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		})
+		if err != nil {
+			// 请求体无法解析时交由后续处理返回参数错误
+			logger.LogWarn(c, "guardrail skipped: "+err.Error())
+			c.Next()
+			return
+		}
+		if applied {
+			if err = common.ReplaceRequestBody(c, newBody); err != nil {
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, "guardrail failed: "+err.Error())
+				return
+			}
+			common.SetContextKey(c, constant.ContextKeyGuardrailApplied, true)
+		}
+		c.Next()
+	}
+}
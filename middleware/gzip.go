@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"compress/gzip"
+	"fmt"
 	"io"
 	"net/http"
 
-	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+
 	"github.com/andybalholm/brotli"
 	"github.com/gin-gonic/gin"
 )
@@ -28,11 +31,16 @@ func DecompressRequestMiddleware() gin.HandlerFunc {
 			c.Next()
 			return
 		}
-		maxMB := constant.MaxRequestBodyMB
-		if maxMB <= 0 {
-			maxMB = 32
-		}
+		maxMB := requestBodyLimitMB(c.Request.URL.Path)
 		maxBytes := int64(maxMB) << 20
+		// 未压缩且声明的长度已超限时直接拒绝，不读取请求体
+		if c.GetHeader("Content-Encoding") == "" && c.Request.ContentLength > maxBytes {
+			abortWithOpenAiMessage(c, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("request body of %d bytes exceeds the limit of %d MB for this endpoint", c.Request.ContentLength, maxMB),
+				types.ErrorCodeReadRequestBodyFailed)
+			return
+		}
+		c.Set(common.KeyRequestBodyLimit, maxBytes)
 
 		origBody := c.Request.Body
 		wrapMaxBytes := func(body io.ReadCloser) io.ReadCloser {
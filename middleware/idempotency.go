@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyRedisPrefix    = "idempotency:"
+	idempotencyPendingTimeout = 10 * time.Minute
+)
+
+type idempotencyEntry struct {
+	Pending     bool   `json:"pending,omitempty"`
+	RequestHash string `json:"request_hash"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+	expiresAt   time.Time
+}
+
+var (
+	idempotencyMutex   sync.Mutex
+	idempotencyEntries = make(map[string]*idempotencyEntry)
+)
+
+// idempotencyResponseWriter 记录响应内容，超过大小上限后停止记录
+type idempotencyResponseWriter struct {
+	gin.ResponseWriter
+	buffer   bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *idempotencyResponseWriter) record(n int, write func()) {
+	if w.overflow {
+		return
+	}
+	if w.limit > 0 && w.buffer.Len()+n > w.limit {
+		w.overflow = true
+		w.buffer.Reset()
+		return
+	}
+	write()
+}
+
+func (w *idempotencyResponseWriter) Write(data []byte) (int, error) {
+	w.record(len(data), func() { w.buffer.Write(data) })
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyResponseWriter) WriteString(s string) (int, error) {
+	w.record(len(s), func() { w.buffer.WriteString(s) })
+	return w.ResponseWriter.WriteString(s)
+}
+
+// reserveIdempotencyKey 查询已保存的响应，未命中时占位，防止相同请求并发打到上游
+func reserveIdempotencyKey(key string, requestHash string) (*idempotencyEntry, bool, error) {
+	pending := &idempotencyEntry{Pending: true, RequestHash: requestHash}
+	if common.RedisEnabled.Load() {
+		ctx := context.Background()
+		data, err := common.Marshal(pending)
+		if err != nil {
+			return nil, false, err
+		}
+		ok, err := common.RDB.SetNX(ctx, idempotencyRedisPrefix+key, string(data), idempotencyPendingTimeout).Result()
+		if err != nil || ok {
+			return nil, ok, err
+		}
+		value, err := common.RDB.Get(ctx, idempotencyRedisPrefix+key).Result()
+		if errors.Is(err, redis.Nil) {
+			// 占位恰好过期，本次不做去重
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		existing := &idempotencyEntry{}
+		if err := common.UnmarshalJsonStr(value, existing); err != nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+
+	idempotencyMutex.Lock()
+	defer idempotencyMutex.Unlock()
+	now := time.Now()
+	if existing, ok := idempotencyEntries[key]; ok {
+		if existing.expiresAt.After(now) {
+			return existing, false, nil
+		}
+		delete(idempotencyEntries, key)
+	}
+	if limit := operation_setting.GetIdempotencySetting().MaxMemoryEntries; limit > 0 && len(idempotencyEntries) >= limit {
+		for k, entry := range idempotencyEntries {
+			if !entry.expiresAt.After(now) {
+				delete(idempotencyEntries, k)
+			}
+		}
+		if len(idempotencyEntries) >= limit {
+			return nil, false, nil
+		}
+	}
+	pending.expiresAt = now.Add(idempotencyPendingTimeout)
+	idempotencyEntries[key] = pending
+	return nil, true, nil
+}
+
+func saveIdempotencyEntry(key string, entry *idempotencyEntry, ttl time.Duration) error {
+	if common.RedisEnabled.Load() {
+		data, err := common.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return common.RDB.Set(context.Background(), idempotencyRedisPrefix+key, string(data), ttl).Err()
+	}
+	idempotencyMutex.Lock()
+	defer idempotencyMutex.Unlock()
+	entry.expiresAt = time.Now().Add(ttl)
+	idempotencyEntries[key] = entry
+	return nil
+}
+
+func releaseIdempotencyKey(key string) {
+	if common.RedisEnabled.Load() {
+		common.RDB.Del(context.Background(), idempotencyRedisPrefix+key)
+		return
+	}
+	idempotencyMutex.Lock()
+	defer idempotencyMutex.Unlock()
+	delete(idempotencyEntries, key)
+}
+
+// IdempotentRequest 相同的 Idempotency-Key（或开启 hash_body 时相同的请求体）在有效期内直接返回已保存的响应，
+// 不再请求上游也不重复计费；仅保存成功的非流式响应
+func IdempotentRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetIdempotencySetting()
+		idempotencyKey := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if !setting.Enabled || (idempotencyKey == "" && !setting.HashBody) {
+			c.Next()
+			return
+		}
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			c.Next()
+			return
+		}
+		requestHash := hex.EncodeToString(common.Sha256Raw(body))
+		if idempotencyKey == "" {
+			idempotencyKey = requestHash
+		}
+		// 按令牌隔离，避免不同用户的相同 key 互相命中
+		key := hex.EncodeToString(common.Sha256Raw([]byte(strconv.Itoa(c.GetInt("token_id")) + "|" + c.Request.URL.Path + "|" + idempotencyKey)))
+		ttl := time.Duration(setting.TTLSeconds) * time.Second
+		if ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+
+		existing, reserved, err := reserveIdempotencyKey(key, requestHash)
+		if err != nil {
+			common.SysError("idempotency check failed: " + err.Error())
+			c.Next()
+			return
+		}
+		if existing != nil {
+			if existing.RequestHash != requestHash {
+				abortWithOpenAiMessage(c, http.StatusUnprocessableEntity, "Idempotency-Key 已被用于不同的请求")
+				return
+			}
+			if existing.Pending {
+				abortWithOpenAiMessage(c, http.StatusConflict, "相同 Idempotency-Key 的请求正在处理中")
+				return
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+			c.Abort()
+			return
+		}
+		if !reserved {
+			c.Next()
+			return
+		}
+
+		writer := &idempotencyResponseWriter{ResponseWriter: c.Writer, limit: setting.MaxResponseBytes}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		contentType := writer.Header().Get("Content-Type")
+		if writer.overflow || status < 200 || status >= 300 || strings.HasPrefix(contentType, "text/event-stream") {
+			releaseIdempotencyKey(key)
+			return
+		}
+		entry := &idempotencyEntry{
+			RequestHash: requestHash,
+			StatusCode:  status,
+			ContentType: contentType,
+			Body:        writer.buffer.Bytes(),
+		}
+		if err := saveIdempotencyEntry(key, entry, ttl); err != nil {
+			common.SysError("idempotency save failed: " + err.Error())
+			releaseIdempotencyKey(key)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,6 +15,9 @@ func SetUpLogger(server *gin.Engine) {
 		if param.Keys != nil {
 			requestID = param.Keys[common.RequestIdKey].(string)
 		}
+		if common.IsJSONLog() {
+			return formatJSONAccessLog(param, requestID)
+		}
 		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %7s %s\n",
 			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
 			requestID,
@@ -24,3 +29,32 @@ func SetUpLogger(server *gin.Engine) {
 		)
 	}))
 }
+
+func formatJSONAccessLog(param gin.LogFormatterParams, requestID string) string {
+	entry := map[string]any{
+		"time":       param.TimeStamp.Format(time.RFC3339Nano),
+		"level":      "INFO",
+		"msg":        "access",
+		"request_id": requestID,
+		"status":     param.StatusCode,
+		"latency_ms": param.Latency.Milliseconds(),
+		"client_ip":  param.ClientIP,
+		"method":     param.Method,
+		"path":       param.Path,
+	}
+	for key, field := range map[string]string{
+		"id":                                     "user_id",
+		"token_id":                               "token_id",
+		string(constant.ContextKeyChannelId):     "channel_id",
+		string(constant.ContextKeyOriginalModel): "model",
+	} {
+		if value, ok := param.Keys[key]; ok && value != nil {
+			entry[field] = value
+		}
+	}
+	data, err := common.Marshal(entry)
+	if err != nil {
+		return ""
+	}
+	return string(data) + "\n"
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParamPolicy 在转发前按分组或用户策略收敛或拒绝超出限制的采样参数
+func ParamPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+		policy, ok := operation_setting.GetParamPolicySetting().ResolvePolicy(group, c.GetInt("id"))
+		if !ok || !strings.HasPrefix(c.ContentType(), "application/json") {
+			c.Next()
+			return
+		}
+		body, err := common.GetRequestBody(c)
+		if err != nil || len(body) == 0 {
+			c.Next()
+			return
+		}
+		newBody, adjustments, err := service.ApplyParamPolicy(c.Request.URL.Path, body, policy)
+		if err != nil {
+			var violation *service.ParamPolicyViolation
+			if errors.As(err, &violation) {
+				abortWithOpenAiMessage(c, http.StatusBadRequest, violation.Error())
+				return
+			}
+			logger.LogWarn(c, "param policy skipped: "+err.Error())
+			c.Next()
+			return
+		}
+		if len(adjustments) > 0 {
+			if err = common.ReplaceRequestBody(c, newBody); err != nil {
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, "param policy failed: "+err.Error())
+				return
+			}
+			common.SetContextKey(c, constant.ContextKeyParamPolicyAdjustments, adjustments)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// piiRestoreWriter 将响应中的占位符还原为原始内容。
+// 流式响应中被拆分到多个事件里的占位符无法还原
+type piiRestoreWriter struct {
+	gin.ResponseWriter
+	replacer *strings.Replacer
+}
+
+func (w *piiRestoreWriter) dropContentLength() {
+	if !w.Written() {
+		w.Header().Del("Content-Length")
+	}
+}
+
+func (w *piiRestoreWriter) WriteHeader(code int) {
+	w.dropContentLength()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *piiRestoreWriter) Write(data []byte) (int, error) {
+	w.dropContentLength()
+	if _, err := w.ResponseWriter.WriteString(w.replacer.Replace(string(data))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *piiRestoreWriter) WriteString(s string) (int, error) {
+	w.dropContentLength()
+	if _, err := w.ResponseWriter.WriteString(w.replacer.Replace(s)); err != nil {
+		return 0, err
+	}
+	return len(s), nil
+}
+
+// PIIRedaction 按分组策略在转发前将请求中的个人信息替换为占位符，可选在响应中还原
+func PIIRedaction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+		rules, restore := operation_setting.GetPIISetting().ResolvePolicy(group)
+		if len(rules) == 0 || !strings.HasPrefix(c.ContentType(), "application/json") {
+			c.Next()
+			return
+		}
+		// 开启脱敏后无法完成脱敏的请求直接拒绝，避免原文转发到上游
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "pii redaction failed: "+err.Error())
+			return
+		}
+		if len(body) == 0 {
+			c.Next()
+			return
+		}
+		redactor := service.NewPIIRedactor(rules)
+		redacted, err := redactor.RedactJSON(body)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "pii redaction failed: "+err.Error())
+			return
+		}
+		if !redactor.HasRedactions() {
+			c.Next()
+			return
+		}
+		if err = common.ReplaceRequestBody(c, redacted); err != nil {
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, "pii redaction failed: "+err.Error())
+			return
+		}
+
+		counts := redactor.Counts()
+		common.SetContextKey(c, constant.ContextKeyPIIRedactions, counts)
+		service.RecordPIIRedactions(group, counts)
+
+		if restore {
+			c.Writer = &piiRestoreWriter{ResponseWriter: c.Writer, replacer: redactor.Restorer()}
+		}
+		c.Next()
+	}
+}
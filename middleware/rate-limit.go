@@ -74,14 +74,13 @@ func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark s
 }
 
 func rateLimitFactory(maxRequestNum int, duration int64, mark string) func(c *gin.Context) {
-	if common.RedisEnabled {
-		return func(c *gin.Context) {
+	// It's safe to call multi times.
+	inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+	// Redis 降级时 RedisEnabled 会在运行中变化，因此每次请求时判断
+	return func(c *gin.Context) {
+		if common.RedisEnabled.Load() {
 			redisRateLimiter(c, maxRequestNum, duration, mark)
-		}
-	} else {
-		// It's safe to call multi times.
-		inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
-		return func(c *gin.Context) {
+		} else {
 			memoryRateLimiter(c, maxRequestNum, duration, mark)
 		}
 	}
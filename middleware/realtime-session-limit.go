@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RealtimeSessionCountMark = "RTSC"
+
+var (
+	realtimeSessionMutex  sync.Mutex
+	realtimeSessionCounts = make(map[int]int)
+)
+
+// realtimeSessionTTL 计数键的过期时间，防止节点异常退出导致计数无法释放
+func realtimeSessionTTL() time.Duration {
+	minutes := operation_setting.GetRealtimeSetting().MaxSessionMinutes
+	if minutes <= 0 {
+		minutes = 24 * 60
+	}
+	return time.Duration(minutes+5) * time.Minute
+}
+
+func acquireRealtimeSession(tokenId int, limit int) (bool, error) {
+	if common.RedisEnabled.Load() {
+		ctx := context.Background()
+		key := fmt.Sprintf("rateLimit:%s:%d", RealtimeSessionCountMark, tokenId)
+		count, err := common.RDB.Incr(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+		common.RDB.Expire(ctx, key, realtimeSessionTTL())
+		if count > int64(limit) {
+			common.RDB.Decr(ctx, key)
+			return false, nil
+		}
+		return true, nil
+	}
+	realtimeSessionMutex.Lock()
+	defer realtimeSessionMutex.Unlock()
+	if realtimeSessionCounts[tokenId] >= limit {
+		return false, nil
+	}
+	realtimeSessionCounts[tokenId]++
+	return true, nil
+}
+
+func releaseRealtimeSession(tokenId int) {
+	if common.RedisEnabled.Load() {
+		key := fmt.Sprintf("rateLimit:%s:%d", RealtimeSessionCountMark, tokenId)
+		common.RDB.Decr(context.Background(), key)
+		return
+	}
+	realtimeSessionMutex.Lock()
+	defer realtimeSessionMutex.Unlock()
+	if realtimeSessionCounts[tokenId] <= 1 {
+		delete(realtimeSessionCounts, tokenId)
+		return
+	}
+	realtimeSessionCounts[tokenId]--
+}
+
+// RealtimeSessionLimit 限制单个令牌同时建立的 Realtime 会话数，在升级 WebSocket 之前拒绝
+func RealtimeSessionLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := operation_setting.GetRealtimeSetting().MaxConcurrentSessionsPerToken
+		tokenId := c.GetInt("token_id")
+		if limit <= 0 || tokenId == 0 {
+			c.Next()
+			return
+		}
+		ok, err := acquireRealtimeSession(tokenId, limit)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, "realtime session limit check failed: "+err.Error())
+			return
+		}
+		if !ok {
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, "该令牌的 Realtime 并发会话数已达上限 "+strconv.Itoa(limit))
+			return
+		}
+		defer releaseRealtimeSession(tokenId)
+		c.Next()
+	}
+}
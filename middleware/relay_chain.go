@@ -0,0 +1,20 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// RelayMiddlewares 令牌鉴权之后、转发之前的中间件，OpenAI 兼容、Gemini 原生路由与管理员模拟请求共用，保证限流、事件与策略一致
+func RelayMiddlewares() []gin.HandlerFunc {
+	handlers := []gin.HandlerFunc{
+		TokenConcurrencyLimit(),
+		RequestCompletedEvent(),
+		UsageEventPublish(),
+	}
+	handlers = append(handlers, TraceStage("distribute", Distribute())...)
+	return append(handlers,
+		UsageRateLimit(),
+		PIIRedaction(),
+		Guardrail(),
+		ParamPolicy(),
+		RelayTransform(),
+	)
+}
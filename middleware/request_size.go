@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// requestSizeClass 按路径判断接口类别，未匹配的转发接口按 JSON 文本请求处理
+func requestSizeClass(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/v1/audio/"):
+		return operation_setting.RequestSizeClassAudio
+	case strings.HasPrefix(path, "/v1/images/"), strings.Contains(path, "/mj/"):
+		return operation_setting.RequestSizeClassImage
+	case strings.HasPrefix(path, "/v1/files"), strings.HasPrefix(path, "/v1/uploads"), strings.HasPrefix(path, "/v1/batches"),
+		strings.HasPrefix(path, "/v1/video"), strings.HasPrefix(path, "/kling/"), strings.HasPrefix(path, "/jimeng/"),
+		strings.HasPrefix(path, "/suno/"):
+		return operation_setting.RequestSizeClassFile
+	}
+	return operation_setting.RequestSizeClassText
+}
+
+// requestBodyLimitMB 返回该路径的请求体上限，类别未单独配置时使用 MAX_REQUEST_BODY_MB
+func requestBodyLimitMB(path string) int {
+	if limit := operation_setting.GetRequestSizeSetting().LimitMB(requestSizeClass(path)); limit > 0 {
+		return limit
+	}
+	if constant.MaxRequestBodyMB > 0 {
+		return constant.MaxRequestBodyMB
+	}
+	return 32
+}
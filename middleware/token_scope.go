@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+)
+
+// tokenScopeForPath 根据请求路径判断接口类别，返回空字符串表示该接口不受令牌范围限制（如模型列表）
+func tokenScopeForPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/dashboard/"), strings.HasPrefix(path, "/v1/dashboard/"), strings.HasPrefix(path, "/api/usage/token"),
+		strings.HasPrefix(path, "/mcp"):
+		return constant.TokenScopeDashboard
+	case strings.HasPrefix(path, "/v1/chat/completions"), strings.HasPrefix(path, "/v1/completions"),
+		strings.HasPrefix(path, "/v1/messages"), strings.HasPrefix(path, "/v1/responses"), strings.HasPrefix(path, "/v1/edits"):
+		return constant.TokenScopeChat
+	case strings.HasSuffix(path, "/embeddings"):
+		return constant.TokenScopeEmbeddings
+	case strings.HasPrefix(path, "/v1/images/"), strings.Contains(path, "/mj/"):
+		return constant.TokenScopeImages
+	case strings.HasPrefix(path, "/v1/audio/"):
+		return constant.TokenScopeAudio
+	case strings.HasPrefix(path, "/v1/rerank"):
+		return constant.TokenScopeRerank
+	case strings.HasPrefix(path, "/v1/moderations"):
+		return constant.TokenScopeModerations
+	case strings.HasPrefix(path, "/v1/realtime"):
+		return constant.TokenScopeRealtime
+	case strings.HasPrefix(path, "/v1/video"), strings.HasPrefix(path, "/kling/"), strings.HasPrefix(path, "/jimeng"), strings.HasPrefix(path, "/suno/"):
+		return constant.TokenScopeVideo
+	case strings.HasPrefix(path, "/v1/files"), strings.HasPrefix(path, "/v1/batches"):
+		return constant.TokenScopeFiles
+	case strings.HasPrefix(path, "/v1beta/models/"), strings.HasPrefix(path, "/v1/models/"):
+		// Gemini 原生接口通过动作后缀区分，GET 查询单个模型不受限制
+		if strings.HasSuffix(path, ":embedContent") || strings.HasSuffix(path, ":batchEmbedContents") {
+			return constant.TokenScopeEmbeddings
+		}
+		if strings.Contains(path, ":") {
+			return constant.TokenScopeChat
+		}
+	}
+	return ""
+}
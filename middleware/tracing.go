@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracingStageSpanKey = "tracing_stage_span"
+
+// Tracing 为中继请求创建入口 span，后续各阶段的 span 都挂在其下
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tracing.Enabled() {
+			c.Next()
+			return
+		}
+		ctx, span := tracing.StartServer(c.Request, c.Request.Method+" "+c.FullPath())
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", status),
+			attribute.Int("newapi.user_id", c.GetInt("id")),
+			attribute.Int("newapi.token_id", c.GetInt("token_id")),
+			attribute.String("newapi.model", common.GetContextKeyString(c, constant.ContextKeyOriginalModel)),
+			attribute.String("newapi.group", common.GetContextKeyString(c, constant.ContextKeyUsingGroup)),
+		)
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
+
+// TraceStage 用 span 包裹一个中间件，span 在该中间件放行到下一个处理函数时结束
+func TraceStage(name string, handler gin.HandlerFunc) []gin.HandlerFunc {
+	start := func(c *gin.Context) {
+		if !tracing.Enabled() {
+			c.Next()
+			return
+		}
+		_, span := tracing.Start(c.Request.Context(), name)
+		c.Set(tracingStageSpanKey, span)
+		defer span.End()
+		c.Next()
+		if c.IsAborted() {
+			span.SetStatus(codes.Error, "aborted")
+		}
+	}
+	end := func(c *gin.Context) {
+		if span, ok := c.Get(tracingStageSpanKey); ok && span != nil {
+			span.(trace.Span).End()
+			c.Set(tracingStageSpanKey, nil)
+		}
+		c.Next()
+	}
+	return []gin.HandlerFunc{start, handler, end}
+}
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// transformResponseWriter 缓冲非流式响应，待 post_response 转换器处理后再写出。
+// 检测到 SSE 响应时切换为直接透传
+type transformResponseWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	status    int
+	streaming bool
+}
+
+func (w *transformResponseWriter) detectStreaming() {
+	if w.streaming || w.body.Len() > 0 {
+		return
+	}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+	}
+}
+
+func (w *transformResponseWriter) WriteHeader(code int) {
+	if w.streaming {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *transformResponseWriter) WriteHeaderNow() {
+	w.detectStreaming()
+	if w.streaming {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *transformResponseWriter) Write(data []byte) (int, error) {
+	w.detectStreaming()
+	if w.streaming {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *transformResponseWriter) WriteString(s string) (int, error) {
+	w.detectStreaming()
+	if w.streaming {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.body.WriteString(s)
+}
+
+func (w *transformResponseWriter) Flush() {
+	w.detectStreaming()
+	if w.streaming {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *transformResponseWriter) Status() int {
+	if !w.streaming && w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *transformResponseWriter) Written() bool {
+	return w.streaming && w.ResponseWriter.Written() || w.status != 0 || w.body.Len() > 0
+}
+
+func (w *transformResponseWriter) Size() int {
+	if w.streaming {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+func transformMeta(c *gin.Context) service.TransformMeta {
+	return service.TransformMeta{
+		RequestId: c.GetString(common.RequestIdKey),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		UserId:    c.GetInt("id"),
+		Username:  common.GetContextKeyString(c, constant.ContextKeyUserName),
+		Group:     common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		TokenId:   c.GetInt("token_id"),
+		TokenName: c.GetString("token_name"),
+		Model:     common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+	}
+}
+
+func abortWithTransformError(c *gin.Context, err error) {
+	var abortErr *service.TransformAbortError
+	if errors.As(err, &abortErr) {
+		abortWithOpenAiMessage(c, abortErr.StatusCode, abortErr.Message)
+		return
+	}
+	logger.LogError(c, err.Error())
+	abortWithOpenAiMessage(c, http.StatusBadGateway, "请求转换失败")
+}
+
+// runRequestTransformHooks 执行请求阶段的转换器，请求体有变化时替换缓存
+func runRequestTransformHooks(c *gin.Context, stage string, hooks []operation_setting.TransformHookConfig) bool {
+	tc := &service.TransformContext{
+		Stage:  stage,
+		Meta:   transformMeta(c),
+		Header: c.Request.Header,
+	}
+	var original []byte
+	if c.Request.Body != nil && c.Request.ContentLength != 0 {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "读取请求体失败")
+			return false
+		}
+		original = body
+		tc.Body = body
+	}
+	before := c.Request.Header.Clone()
+	if err := service.RunTransformHooks(c, hooks, tc); err != nil {
+		abortWithTransformError(c, err)
+		return false
+	}
+	if stage == operation_setting.TransformStagePreRelay {
+		// 上游请求头由渠道适配器重新构建，这里记录转换器改动过的请求头，转发时再附加
+		changed := map[string]any{}
+		for key := range c.Request.Header {
+			if value := c.Request.Header.Get(key); value != before.Get(key) {
+				changed[key] = value
+			}
+		}
+		if len(changed) > 0 {
+			common.SetContextKey(c, constant.ContextKeyTransformHeaders, changed)
+		}
+	}
+	if original != nil && !bytes.Equal(original, tc.Body) {
+		if err := common.ReplaceRequestBody(c, tc.Body); err != nil {
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, "请求转换失败")
+			return false
+		}
+	}
+	return true
+}
+
+// PreAuthTransform 在鉴权前执行 pre_auth 阶段的转换器，此时分组与模型尚不可知
+func PreAuthTransform() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hooks := operation_setting.GetTransformHookSetting().StageHooks(operation_setting.TransformStagePreAuth, "", "")
+		if len(hooks) > 0 && !runRequestTransformHooks(c, operation_setting.TransformStagePreAuth, hooks) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RelayTransform 选择渠道后执行 pre_relay 转换器，并挂载 post_response 与 post_billing 转换器
+func RelayTransform() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetTransformHookSetting()
+		if !setting.Enabled {
+			c.Next()
+			return
+		}
+		group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+		modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+		if hooks := setting.StageHooks(operation_setting.TransformStagePreRelay, group, modelName); len(hooks) > 0 {
+			if !runRequestTransformHooks(c, operation_setting.TransformStagePreRelay, hooks) {
+				return
+			}
+		}
+
+		var writer *transformResponseWriter
+		responseHooks := setting.StageHooks(operation_setting.TransformStagePostResponse, group, modelName)
+		if len(responseHooks) > 0 {
+			writer = &transformResponseWriter{ResponseWriter: c.Writer}
+			c.Writer = writer
+		}
+
+		c.Next()
+
+		if writer != nil {
+			c.Writer = writer.ResponseWriter
+			if !writer.streaming {
+				flushTransformedResponse(c, writer, responseHooks)
+			}
+		}
+
+		billingHooks := setting.StageHooks(operation_setting.TransformStagePostBilling, group, modelName)
+		if len(billingHooks) == 0 {
+			return
+		}
+		tc := &service.TransformContext{
+			Stage:      operation_setting.TransformStagePostBilling,
+			Meta:       transformMeta(c),
+			Header:     c.Writer.Header().Clone(),
+			StatusCode: c.Writer.Status(),
+		}
+		tc.Meta.Quota = common.GetContextKeyInt(c, constant.ContextKeyConsumedQuota)
+		tc.Meta.Tokens = common.GetContextKeyInt(c, constant.ContextKeyConsumedTokens)
+		gopool.Go(func() {
+			if err := service.RunTransformHooks(nil, billingHooks, tc); err != nil {
+				common.SysError(err.Error())
+			}
+		})
+	}
+}
+
+func flushTransformedResponse(c *gin.Context, writer *transformResponseWriter, hooks []operation_setting.TransformHookConfig) {
+	status := writer.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	tc := &service.TransformContext{
+		Stage:      operation_setting.TransformStagePostResponse,
+		Meta:       transformMeta(c),
+		Header:     c.Writer.Header(),
+		Body:       writer.body.Bytes(),
+		StatusCode: status,
+	}
+	if err := service.RunTransformHooks(c, hooks, tc); err != nil {
+		c.Writer.Header().Del("Content-Length")
+		abortWithTransformError(c, err)
+		return
+	}
+	if writer.status == 0 && writer.body.Len() == 0 {
+		return
+	}
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.WriteHeader(status)
+	if _, err := c.Writer.Write(tc.Body); err != nil {
+		logger.LogWarn(c, "write transformed response failed: "+err.Error())
+	}
+}
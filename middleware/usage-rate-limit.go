@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	UsageTPMCountMark = "TPM"
+	UsageRPDCountMark = "RPD"
+	usageTPMWindow    = time.Minute
+)
+
+type usageRateLimitScope struct {
+	key string
+	tpm int
+	rpd int
+}
+
+type usageTokenEntry struct {
+	at     time.Time
+	tokens int
+}
+
+var (
+	usageRateLimitMutex sync.Mutex
+	usageTokenWindows   = make(map[string][]usageTokenEntry)
+	usageDailyDay       string
+	usageDailyCounts    = make(map[string]int)
+)
+
+func usageToday(now time.Time) string {
+	return now.Format("20060102")
+}
+
+// usageDailyReset 距离本地时间次日零点的时长
+func usageDailyReset(now time.Time) time.Duration {
+	year, month, day := now.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
+
+// getUsageTokens 返回窗口内已消耗的 token 数，以及最早一条记录移出窗口的剩余时间
+func getUsageTokens(ctx context.Context, scope string, now time.Time) (int, time.Duration, error) {
+	windowStart := now.Add(-usageTPMWindow)
+	if common.RedisEnabled.Load() {
+		key := fmt.Sprintf("rateLimit:%s:%s", UsageTPMCountMark, scope)
+		common.RDB.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(windowStart.UnixMilli(), 10))
+		entries, err := common.RDB.ZRangeWithScores(ctx, key, 0, -1).Result()
+		if err != nil {
+			return 0, 0, err
+		}
+		used := 0
+		for _, entry := range entries {
+			member, _ := entry.Member.(string)
+			tokens, _ := strconv.Atoi(strings.SplitN(member, ":", 2)[0])
+			used += tokens
+		}
+		if len(entries) == 0 {
+			return used, 0, nil
+		}
+		return used, time.UnixMilli(int64(entries[0].Score)).Sub(windowStart), nil
+	}
+
+	usageRateLimitMutex.Lock()
+	defer usageRateLimitMutex.Unlock()
+	entries := usageTokenWindows[scope]
+	i := 0
+	for i < len(entries) && !entries[i].at.After(windowStart) {
+		i++
+	}
+	entries = entries[i:]
+	if len(entries) == 0 {
+		delete(usageTokenWindows, scope)
+		return 0, 0, nil
+	}
+	usageTokenWindows[scope] = entries
+	used := 0
+	for _, entry := range entries {
+		used += entry.tokens
+	}
+	return used, entries[0].at.Sub(windowStart), nil
+}
+
+func recordUsageTokens(ctx context.Context, scope string, tokens int, now time.Time) error {
+	if common.RedisEnabled.Load() {
+		key := fmt.Sprintf("rateLimit:%s:%s", UsageTPMCountMark, scope)
+		pipe := common.RDB.TxPipeline()
+		pipe.ZAdd(ctx, key, &redis.Z{
+			Score:  float64(now.UnixMilli()),
+			Member: strconv.Itoa(tokens) + ":" + common.GetUUID(),
+		})
+		pipe.Expire(ctx, key, 2*usageTPMWindow)
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+	usageRateLimitMutex.Lock()
+	defer usageRateLimitMutex.Unlock()
+	usageTokenWindows[scope] = append(usageTokenWindows[scope], usageTokenEntry{at: now, tokens: tokens})
+	return nil
+}
+
+func getUsageRequests(ctx context.Context, scope string, now time.Time) (int, error) {
+	if common.RedisEnabled.Load() {
+		key := fmt.Sprintf("rateLimit:%s:%s:%s", UsageRPDCountMark, scope, usageToday(now))
+		count, err := common.RDB.Get(ctx, key).Int()
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return count, err
+	}
+	usageRateLimitMutex.Lock()
+	defer usageRateLimitMutex.Unlock()
+	if usageDailyDay != usageToday(now) {
+		return 0, nil
+	}
+	return usageDailyCounts[scope], nil
+}
+
+func incrUsageRequests(ctx context.Context, scope string, now time.Time) error {
+	if common.RedisEnabled.Load() {
+		key := fmt.Sprintf("rateLimit:%s:%s:%s", UsageRPDCountMark, scope, usageToday(now))
+		pipe := common.RDB.TxPipeline()
+		pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, usageDailyReset(now)+time.Hour)
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+	usageRateLimitMutex.Lock()
+	defer usageRateLimitMutex.Unlock()
+	if today := usageToday(now); usageDailyDay != today {
+		usageDailyDay = today
+		usageDailyCounts = make(map[string]int)
+	}
+	usageDailyCounts[scope]++
+	return nil
+}
+
+func getUsageRateLimitScopes(c *gin.Context, setting *operation_setting.UsageRateLimitSetting) []usageRateLimitScope {
+	scopes := make([]usageRateLimitScope, 0, 3)
+	if tokenId := c.GetInt("token_id"); tokenId != 0 && (setting.TokenTPM > 0 || setting.TokenRPD > 0) {
+		scopes = append(scopes, usageRateLimitScope{key: "token:" + strconv.Itoa(tokenId), tpm: setting.TokenTPM, rpd: setting.TokenRPD})
+	}
+	userId := c.GetInt("id")
+	if userId == 0 {
+		return scopes
+	}
+	if setting.UserTPM > 0 || setting.UserRPD > 0 {
+		scopes = append(scopes, usageRateLimitScope{key: "user:" + strconv.Itoa(userId), tpm: setting.UserTPM, rpd: setting.UserRPD})
+	}
+	modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	if modelTPM, modelRPD := setting.ModelTPM[modelName], setting.ModelRPD[modelName]; modelName != "" && (modelTPM > 0 || modelRPD > 0) {
+		scopes = append(scopes, usageRateLimitScope{key: "user:" + strconv.Itoa(userId) + ":model:" + modelName, tpm: modelTPM, rpd: modelRPD})
+	}
+	return scopes
+}
+
+func formatRateLimitReset(d time.Duration) string {
+	if d < time.Second {
+		d = time.Second
+	}
+	return d.Round(time.Second).String()
+}
+
+func abortWithRateLimitExceeded(c *gin.Context, limitType string, message string, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second)/time.Second)+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": gin.H{
+			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			"type":    limitType,
+			"param":   nil,
+			"code":    types.ErrorCodeRateLimitExceeded,
+		},
+	})
+	c.Abort()
+}
+
+// UsageRateLimit 按令牌、用户、模型限制 TPM 与每日请求数，并返回 OpenAI 风格的 x-ratelimit-* 响应头；
+// 实际消耗的 token 在请求结束后计入窗口
+func UsageRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetUsageRateLimitSetting()
+		if !setting.Enabled {
+			c.Next()
+			return
+		}
+		scopes := getUsageRateLimitScopes(c, setting)
+		if len(scopes) == 0 {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		now := time.Now()
+
+		// 对外展示剩余量最少的一项
+		requestLimit, requestRemaining := 0, -1
+		tokenLimit, tokenRemaining := 0, -1
+		var tokenReset time.Duration
+		for _, scope := range scopes {
+			if scope.rpd > 0 {
+				count, err := getUsageRequests(ctx, scope.key, now)
+				if err != nil {
+					common.SysError("usage rate limit check failed: " + err.Error())
+					c.Next()
+					return
+				}
+				if count >= scope.rpd {
+					abortWithRateLimitExceeded(c, "requests", fmt.Sprintf("已达到每日请求数上限 %d，请明天再试", scope.rpd), usageDailyReset(now))
+					return
+				}
+				if remaining := scope.rpd - count - 1; requestRemaining < 0 || remaining < requestRemaining {
+					requestLimit, requestRemaining = scope.rpd, remaining
+				}
+			}
+			if scope.tpm > 0 {
+				used, reset, err := getUsageTokens(ctx, scope.key, now)
+				if err != nil {
+					common.SysError("usage rate limit check failed: " + err.Error())
+					c.Next()
+					return
+				}
+				if used >= scope.tpm {
+					abortWithRateLimitExceeded(c, "tokens", fmt.Sprintf("已达到每分钟 token 数上限 %d（当前 %d），请在 %s 后重试", scope.tpm, used, formatRateLimitReset(reset)), reset)
+					return
+				}
+				if remaining := scope.tpm - used; tokenRemaining < 0 || remaining < tokenRemaining {
+					tokenLimit, tokenRemaining, tokenReset = scope.tpm, remaining, reset
+				}
+			}
+		}
+		for _, scope := range scopes {
+			if scope.rpd > 0 {
+				if err := incrUsageRequests(ctx, scope.key, now); err != nil {
+					common.SysError("usage rate limit record failed: " + err.Error())
+				}
+			}
+		}
+		if requestRemaining >= 0 {
+			c.Header("x-ratelimit-limit-requests", strconv.Itoa(requestLimit))
+			c.Header("x-ratelimit-remaining-requests", strconv.Itoa(requestRemaining))
+			c.Header("x-ratelimit-reset-requests", formatRateLimitReset(usageDailyReset(now)))
+		}
+		if tokenRemaining >= 0 {
+			c.Header("x-ratelimit-limit-tokens", strconv.Itoa(tokenLimit))
+			c.Header("x-ratelimit-remaining-tokens", strconv.Itoa(tokenRemaining))
+			c.Header("x-ratelimit-reset-tokens", formatRateLimitReset(tokenReset))
+		}
+
+		c.Next()
+
+		tokens := common.GetContextKeyInt(c, constant.ContextKeyConsumedTokens)
+		if tokens <= 0 {
+			return
+		}
+		now = time.Now()
+		for _, scope := range scopes {
+			if scope.tpm > 0 {
+				if err := recordUsageTokens(context.Background(), scope.key, tokens, now); err != nil {
+					common.SysError("usage rate limit record failed: " + err.Error())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageEventPublish 请求结束后将已记账的用量发布到消息队列，未产生消费日志的请求不发布
+func UsageEventPublish() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		c.Next()
+
+		if !operation_setting.GetUsageEventSetting().Enabled {
+			return
+		}
+		if _, ok := common.GetContextKey(c, constant.ContextKeyConsumedQuota); !ok {
+			return
+		}
+		service.PublishUsageEvent(&service.UsageEvent{
+			RequestId:        c.GetString(common.RequestIdKey),
+			Timestamp:        time.Now().UnixMilli(),
+			UserId:           c.GetInt("id"),
+			Username:         common.GetContextKeyString(c, constant.ContextKeyUserName),
+			TokenId:          c.GetInt("token_id"),
+			TokenName:        c.GetString("token_name"),
+			ChannelId:        common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+			Model:            common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+			Group:            common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+			Project:          common.GetContextKeyString(c, constant.ContextKeyProject),
+			PromptTokens:     common.GetContextKeyInt(c, constant.ContextKeyConsumedPrompt),
+			CompletionTokens: common.GetContextKeyInt(c, constant.ContextKeyConsumedOutput),
+			Quota:            common.GetContextKeyInt(c, constant.ContextKeyConsumedQuota),
+			LatencyMs:        time.Since(startTime).Milliseconds(),
+			StatusCode:       c.Writer.Status(),
+		})
+	}
+}
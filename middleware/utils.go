@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
@@ -15,17 +16,40 @@ func abortWithOpenAiMessage(c *gin.Context, statusCode int, message string, code
 		codeStr = string(code[0])
 	}
 	userId := c.GetInt("id")
-	c.JSON(statusCode, gin.H{
-		"error": gin.H{
-			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
-			"type":    "new_api_error",
-			"code":    codeStr,
-		},
-	})
+	if useClaudeErrorFormat(c) {
+		writeClaudeErrorMessage(c, statusCode, message)
+	} else {
+		c.JSON(statusCode, gin.H{
+			"error": gin.H{
+				"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+				"type":    "new_api_error",
+				"code":    codeStr,
+			},
+		})
+	}
 	c.Abort()
 	logger.LogError(c.Request.Context(), fmt.Sprintf("user %d | %s", userId, message))
 }
 
+// abortWithModelNotFound 与 OpenAI 一致的模型不存在/无权访问错误
+func abortWithModelNotFound(c *gin.Context, modelName string) {
+	message := fmt.Sprintf("The model `%s` does not exist or you do not have access to it.", modelName)
+	if useClaudeErrorFormat(c) {
+		writeClaudeErrorMessage(c, http.StatusNotFound, message)
+	} else {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+				"type":    "invalid_request_error",
+				"param":   "model",
+				"code":    types.ErrorCodeModelNotFound,
+			},
+		})
+	}
+	c.Abort()
+	logger.LogError(c.Request.Context(), fmt.Sprintf("user %d | %s", c.GetInt("id"), message))
+}
+
 func abortWithMidjourneyMessage(c *gin.Context, statusCode int, code int, description string) {
 	c.JSON(statusCode, gin.H{
 		"description": description,
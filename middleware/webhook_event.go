@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestCompletedEvent 请求结束后向订阅了 request.completed 的推送地址发送用量摘要
+func RequestCompletedEvent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		c.Next()
+
+		userId := c.GetInt("id")
+		if !service.HasWebhookSubscription(userId, model.WebhookEventRequestCompleted) {
+			return
+		}
+		data := map[string]any{
+			"request_id":   c.GetString(common.RequestIdKey),
+			"path":         c.Request.URL.Path,
+			"status_code":  c.Writer.Status(),
+			"user_id":      userId,
+			"token_id":     c.GetInt("token_id"),
+			"token_name":   c.GetString("token_name"),
+			"group":        common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+			"project":      common.GetContextKeyString(c, constant.ContextKeyProject),
+			"model":        common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+			"channel_id":   common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+			"quota":        common.GetContextKeyInt(c, constant.ContextKeyConsumedQuota),
+			"tokens":       common.GetContextKeyInt(c, constant.ContextKeyConsumedTokens),
+			"duration_ms":  time.Since(startTime).Milliseconds(),
+			"completed_at": time.Now().Unix(),
+		}
+		gopool.Go(func() {
+			service.EmitWebhookEvent(userId, model.WebhookEventRequestCompleted, data)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -103,21 +104,23 @@ func getChannelQuery(group string, model string, retry int) (*gorm.DB, error) {
 	return channelQuery, nil
 }
 
-func GetChannel(group string, model string, retry int) (*Channel, error) {
+func GetChannel(group string, model string, retry int, required *RequiredCapabilities) (*Channel, error) {
 	var abilities []Ability
 
 	var err error = nil
-	channelQuery, err := getChannelQuery(group, model, retry)
-	if err != nil {
-		return nil, err
-	}
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("weight DESC").Find(&abilities).Error
+	if required.IsEmpty() {
+		channelQuery, err := getChannelQuery(group, model, retry)
+		if err != nil {
+			return nil, err
+		}
+		if err = channelQuery.Order("weight DESC").Find(&abilities).Error; err != nil {
+			return nil, err
+		}
 	} else {
-		err = channelQuery.Order("weight DESC").Find(&abilities).Error
-	}
-	if err != nil {
-		return nil, err
+		abilities, err = getCapableAbilities(group, model, retry, required)
+		if err != nil {
+			return nil, err
+		}
 	}
 	channel := Channel{}
 	if len(abilities) > 0 {
@@ -143,6 +146,76 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	return &channel, err
 }
 
+// getCapableAbilities 与内存缓存一致，先在所有优先级中按能力筛选，再按重试次数选择优先级
+func getCapableAbilities(group string, model string, retry int, required *RequiredCapabilities) ([]Ability, error) {
+	var abilities []Ability
+	err := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).Order("weight DESC").Find(&abilities).Error
+	if err != nil || len(abilities) == 0 {
+		return nil, err
+	}
+	ids := make([]int, 0, len(abilities))
+	for _, ability_ := range abilities {
+		ids = append(ids, ability_.ChannelId)
+	}
+	var recorded int64
+	if err := DB.Model(&ChannelCapability{}).Where("channel_id IN ?", ids).Count(&recorded).Error; err != nil {
+		return nil, err
+	}
+	if recorded > 0 {
+		var candidates []*Channel
+		if err := DB.Where("id IN ?", ids).Find(&candidates).Error; err != nil {
+			return nil, err
+		}
+		capable, err := filterCapableChannels(candidates, model, required)
+		if err != nil {
+			return nil, err
+		}
+		capableIds := make(map[int]bool, len(capable))
+		for _, candidate := range capable {
+			capableIds[candidate.Id] = true
+		}
+		filtered := abilities[:0]
+		for _, ability_ := range abilities {
+			if capableIds[ability_.ChannelId] {
+				filtered = append(filtered, ability_)
+			}
+		}
+		abilities = filtered
+	}
+
+	priorityOf := func(ability_ Ability) int64 {
+		if ability_.Priority == nil {
+			return 0
+		}
+		return *ability_.Priority
+	}
+	uniquePriorities := make(map[int64]bool)
+	for _, ability_ := range abilities {
+		uniquePriorities[priorityOf(ability_)] = true
+	}
+	if len(uniquePriorities) == 0 {
+		return nil, nil
+	}
+	priorities := make([]int64, 0, len(uniquePriorities))
+	for priority := range uniquePriorities {
+		priorities = append(priorities, priority)
+	}
+	sort.Slice(priorities, func(i, j int) bool {
+		return priorities[i] > priorities[j]
+	})
+	if retry >= len(priorities) {
+		retry = len(priorities) - 1
+	}
+	targetPriority := priorities[retry]
+	result := make([]Ability, 0, len(abilities))
+	for _, ability_ := range abilities {
+		if priorityOf(ability_) == targetPriority {
+			result = append(result, ability_)
+		}
+	}
+	return result, nil
+}
+
 func (channel *Channel) AddAbilities(tx *gorm.DB) error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestGetChannelFallsBackToCapableLowerPriority(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:ability_capability?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	originalDB, originalLogDB := DB, LOG_DB
+	originalMemoryCache, originalRedis := common.MemoryCacheEnabled, common.RedisEnabled.Load()
+	DB, LOG_DB = db, db
+	common.MemoryCacheEnabled = false
+	common.RedisEnabled.Store(false)
+	initCol()
+	t.Cleanup(func() {
+		DB, LOG_DB = originalDB, originalLogDB
+		common.MemoryCacheEnabled = originalMemoryCache
+		common.RedisEnabled.Store(originalRedis)
+	})
+	require.NoError(t, db.AutoMigrate(&Channel{}, &Ability{}, &ChannelCapability{}))
+
+	high, low := int64(10), int64(0)
+	require.NoError(t, db.Create(&Channel{Id: 1, Name: "high", Key: "k1", Status: common.ChannelStatusEnabled, Models: "gpt-4o", Group: "default", Priority: &high}).Error)
+	require.NoError(t, db.Create(&Channel{Id: 2, Name: "low", Key: "k2", Status: common.ChannelStatusEnabled, Models: "gpt-4o", Group: "default", Priority: &low}).Error)
+	require.NoError(t, db.Create(&Ability{Group: "default", Model: "gpt-4o", ChannelId: 1, Enabled: true, Priority: &high}).Error)
+	require.NoError(t, db.Create(&Ability{Group: "default", Model: "gpt-4o", ChannelId: 2, Enabled: true, Priority: &low}).Error)
+	noVision := false
+	require.NoError(t, db.Create(&ChannelCapability{ChannelId: 1, ModelName: ChannelCapabilityAllModels, Vision: &noVision}).Error)
+
+	channel, err := GetChannel("default", "gpt-4o", 0, &RequiredCapabilities{Vision: true})
+	require.NoError(t, err)
+	require.NotNil(t, channel)
+	require.Equal(t, 2, channel.Id)
+
+	channel, err = GetChannel("default", "gpt-4o", 0, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, channel.Id)
+}
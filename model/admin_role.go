@@ -0,0 +1,127 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// AdminRole 自定义管理员角色，Permissions 为逗号分隔的权限列表
+type AdminRole struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	Permissions string `json:"permissions" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func (role *AdminRole) GetPermissions() []string {
+	permissions := make([]string, 0)
+	for _, p := range strings.Split(role.Permissions, ",") {
+		p = strings.TrimSpace(p)
+		if common.IsValidPermission(p) {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+func (role *AdminRole) SetPermissions(permissions []string) {
+	role.Permissions = strings.Join(permissions, ",")
+}
+
+func GetAllAdminRoles() (roles []*AdminRole, err error) {
+	err = DB.Order("id").Find(&roles).Error
+	return roles, err
+}
+
+func GetAdminRoleById(id int) (*AdminRole, error) {
+	role := &AdminRole{}
+	err := DB.First(role, "id = ?", id).Error
+	return role, err
+}
+
+func IsAdminRoleNameTaken(name string, excludeId int) bool {
+	var count int64
+	DB.Model(&AdminRole{}).Where("name = ? AND id <> ?", name, excludeId).Count(&count)
+	return count > 0
+}
+
+func (role *AdminRole) Insert() error {
+	now := common.GetTimestamp()
+	role.CreatedTime = now
+	role.UpdatedTime = now
+	return DB.Create(role).Error
+}
+
+func (role *AdminRole) Update() error {
+	role.UpdatedTime = common.GetTimestamp()
+	if err := DB.Model(role).Select("name", "description", "permissions", "updated_time").Updates(role).Error; err != nil {
+		return err
+	}
+	invalidateUserPermissions()
+	return nil
+}
+
+// DeleteAdminRoleById 仍有用户使用的角色不允许删除，避免这些管理员回落到默认权限
+func DeleteAdminRoleById(id int) error {
+	var count int64
+	if err := DB.Model(&User{}).Where("admin_role_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该角色仍被用户使用，无法删除")
+	}
+	if err := DB.Delete(&AdminRole{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	invalidateUserPermissions()
+	return nil
+}
+
+// SetUserAdminRole 为用户分配自定义管理员角色，roleId 为 0 表示使用默认管理员权限
+func SetUserAdminRole(userId int, roleId int) error {
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("admin_role_id", roleId).Error; err != nil {
+		return err
+	}
+	invalidateUserPermissions(userId)
+	return nil
+}
+
+// GetUserPermissions 计算用户拥有的管理权限：超级管理员拥有全部权限，
+// 未分配角色的管理员使用默认权限，普通用户没有管理权限。管理员的权限在本节点缓存
+func GetUserPermissions(userId int, role int) []string {
+	switch {
+	case role >= common.RoleRootUser:
+		return common.AllPermissions
+	case role >= common.RoleAdminUser:
+		if permissions, ok := getUserPermissionsCache(userId); ok {
+			return permissions
+		}
+		permissions, err := loadUserPermissions(userId)
+		if err != nil {
+			return nil
+		}
+		setUserPermissionsCache(userId, permissions)
+		return permissions
+	default:
+		return nil
+	}
+}
+
+func loadUserPermissions(userId int) ([]string, error) {
+	var roleId int
+	if err := DB.Model(&User{}).Where("id = ?", userId).Select("admin_role_id").Scan(&roleId).Error; err != nil {
+		return nil, err
+	}
+	if roleId == 0 {
+		return common.DefaultAdminPermissions, nil
+	}
+	adminRole, err := GetAdminRoleById(roleId)
+	if err != nil {
+		return nil, err
+	}
+	return adminRole.GetPermissions(), nil
+}
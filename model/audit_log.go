@@ -0,0 +1,83 @@
+package model
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+var ErrAuditLogAppendOnly = errors.New("audit log is append-only")
+
+// AuditLog 管理接口的变更记录，只允许追加，不提供修改与删除
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Username   string `json:"username" gorm:"type:varchar(64);default:''"`
+	Ip         string `json:"ip" gorm:"type:varchar(64);default:''"`
+	Method     string `json:"method" gorm:"size:16"`
+	Path       string `json:"path" gorm:"type:varchar(255)"`
+	Entity     string `json:"entity" gorm:"type:varchar(64);index"`
+	EntityId   string `json:"entity_id" gorm:"type:varchar(128);index"`
+	Action     string `json:"action" gorm:"type:varchar(16);index"`
+	Before     string `json:"before" gorm:"type:text"`
+	After      string `json:"after" gorm:"type:text"`
+	Diff       string `json:"diff" gorm:"type:text"` // 发生变化的字段，{"字段": {"before": 旧值, "after": 新值}}
+	StatusCode int    `json:"status_code"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message" gorm:"type:text"`
+}
+
+func (*AuditLog) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+func (*AuditLog) BeforeDelete(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+func CreateAuditLog(log *AuditLog) error {
+	return LOG_DB.Create(log).Error
+}
+
+type AuditLogQuery struct {
+	UserId         int
+	Entity         string
+	EntityId       string
+	Action         string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func GetAuditLogs(query AuditLogQuery, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	tx := LOG_DB.Model(&AuditLog{})
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.Entity != "" {
+		tx = tx.Where("entity = ?", query.Entity)
+	}
+	if query.EntityId != "" {
+		tx = tx.Where("entity_id = ?", query.EntityId)
+	}
+	if query.Action != "" {
+		tx = tx.Where("action = ?", query.Action)
+	}
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
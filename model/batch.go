@@ -0,0 +1,323 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BatchRequestStatusPending   = "pending"
+	BatchRequestStatusRunning   = "running" // 已被调度领取，执行结果尚未保存
+	BatchRequestStatusCompleted = "completed"
+	BatchRequestStatusFailed    = "failed"
+	BatchRequestStatusCancelled = "cancelled"
+	BatchRequestStatusExpired   = "expired"
+)
+
+// Batch OpenAI Batch API 兼容的批处理任务
+type Batch struct {
+	Id                int    `json:"id"`
+	BatchId           string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId            int    `json:"user_id" gorm:"index"`
+	TokenId           int    `json:"token_id" gorm:"index"`
+	SpecificChannelId int    `json:"specific_channel_id"`
+	ClientIp          string `json:"client_ip" gorm:"type:varchar(64)"` // 提交者的客户端 IP，执行时沿用
+	Endpoint          string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId       string `json:"input_file_id" gorm:"type:varchar(128)"`
+	CompletionWindow  string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status            string `json:"status" gorm:"type:varchar(20);index"`
+	Metadata          string `json:"metadata" gorm:"type:text"`
+	Errors            string `json:"errors" gorm:"type:text"`
+	TotalCount        int    `json:"total_count"`
+	CompletedCount    int    `json:"completed_count"`
+	FailedCount       int    `json:"failed_count"`
+	InputTokens       int    `json:"input_tokens"`
+	OutputTokens      int    `json:"output_tokens"`
+	TotalTokens       int    `json:"total_tokens"`
+	CreatedAt         int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt      int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt         int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt      int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt       int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt          int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt         int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt      int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt       int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+// BatchRequest 批处理中的单行请求及其执行结果
+type BatchRequest struct {
+	Id         int    `json:"id"`
+	BatchId    int    `json:"batch_id" gorm:"index:idx_batch_request_batch_line,priority:1"`
+	Line       int    `json:"line" gorm:"index:idx_batch_request_batch_line,priority:2"`
+	CustomId   string `json:"custom_id" gorm:"type:varchar(191)"`
+	Url        string `json:"url" gorm:"type:varchar(64)"`
+	Body       string `json:"body" gorm:"type:text"`
+	Status     string `json:"status" gorm:"type:varchar(20);index"`
+	StatusCode int    `json:"status_code"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64)"`
+	Response   string `json:"response" gorm:"type:text"`
+	Error      string `json:"error" gorm:"type:text"`
+	UpdatedAt  int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func optionalTimestamp(ts int64) *int64 {
+	if ts == 0 {
+		return nil
+	}
+	return &ts
+}
+
+func (b *Batch) OutputFileId() string {
+	return b.BatchId + "_output"
+}
+
+func (b *Batch) ErrorFileId() string {
+	return b.BatchId + "_error"
+}
+
+func (b *Batch) IsFinished() bool {
+	switch b.Status {
+	case dto.BatchStatusCompleted, dto.BatchStatusFailed, dto.BatchStatusExpired, dto.BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (b *Batch) ToOpenAIBatch() *dto.OpenAIBatch {
+	openAIBatch := &dto.OpenAIBatch{
+		ID:               b.BatchId,
+		Object:           "batch",
+		Endpoint:         b.Endpoint,
+		InputFileID:      b.InputFileId,
+		CompletionWindow: b.CompletionWindow,
+		Status:           b.Status,
+		CreatedAt:        b.CreatedAt,
+		InProgressAt:     optionalTimestamp(b.InProgressAt),
+		ExpiresAt:        optionalTimestamp(b.ExpiresAt),
+		FinalizingAt:     optionalTimestamp(b.FinalizingAt),
+		CompletedAt:      optionalTimestamp(b.CompletedAt),
+		FailedAt:         optionalTimestamp(b.FailedAt),
+		ExpiredAt:        optionalTimestamp(b.ExpiredAt),
+		CancellingAt:     optionalTimestamp(b.CancellingAt),
+		CancelledAt:      optionalTimestamp(b.CancelledAt),
+		RequestCounts: dto.BatchRequestCounts{
+			Total:     b.TotalCount,
+			Completed: b.CompletedCount,
+			Failed:    b.FailedCount,
+		},
+		Usage: dto.BatchUsage{
+			InputTokens:  b.InputTokens,
+			OutputTokens: b.OutputTokens,
+			TotalTokens:  b.TotalTokens,
+		},
+	}
+	if b.Metadata != "" {
+		_ = common.UnmarshalJsonStr(b.Metadata, &openAIBatch.Metadata)
+	}
+	if b.Errors != "" {
+		errs := &dto.BatchErrors{}
+		if err := common.UnmarshalJsonStr(b.Errors, errs); err == nil {
+			openAIBatch.Errors = errs
+		}
+	}
+	if b.IsFinished() {
+		if b.CompletedCount > 0 {
+			id := b.OutputFileId()
+			openAIBatch.OutputFileID = &id
+		}
+		if b.FailedCount > 0 {
+			id := b.ErrorFileId()
+			openAIBatch.ErrorFileID = &id
+		}
+	}
+	return openAIBatch
+}
+
+// CreateBatch 在同一事务中写入批处理及其全部请求行
+func CreateBatch(batch *Batch, requests []*BatchRequest) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+		for _, request := range requests {
+			request.BatchId = batch.Id
+		}
+		return tx.CreateInBatches(requests, 100).Error
+	})
+}
+
+func GetBatchByBatchId(userId int, batchId string) (*Batch, error) {
+	batch := &Batch{}
+	err := DB.Where("user_id = ? AND batch_id = ?", userId, batchId).First(batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func GetBatchById(id int) (*Batch, error) {
+	batch := &Batch{}
+	err := DB.First(batch, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func GetBatchStatus(id int) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("id = ?", id).Select("status").Scan(&status).Error
+	return status, err
+}
+
+// GetUserBatches 按创建时间倒序分页，afterId 为上一页最后一个 batch_id
+func GetUserBatches(userId int, afterId string, limit int) ([]*Batch, error) {
+	query := DB.Where("user_id = ?", userId)
+	if afterId != "" {
+		after := &Batch{}
+		if err := DB.Select("id").Where("user_id = ? AND batch_id = ?", userId, afterId).First(after).Error; err != nil {
+			return nil, err
+		}
+		query = query.Where("id < ?", after.Id)
+	}
+	var batches []*Batch
+	err := query.Order("id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func GetUnfinishedBatches() ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status IN ?", []string{dto.BatchStatusValidating, dto.BatchStatusInProgress, dto.BatchStatusFinalizing, dto.BatchStatusCancelling}).
+		Order("id asc").Find(&batches).Error
+	return batches, err
+}
+
+// TransitionBatchStatus 仅当批处理仍处于 fromStatuses 之一时更新，避免覆盖并发的取消等状态变更
+func TransitionBatchStatus(id int, fromStatuses []string, fields map[string]any) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? AND status IN ?", id, fromStatuses).Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CancelBatch 仅在批处理尚未结束时将其置为 cancelling
+func CancelBatch(batch *Batch) error {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).
+		Where("id = ? AND status IN ?", batch.Id, []string{dto.BatchStatusValidating, dto.BatchStatusInProgress}).
+		Updates(map[string]any{"status": dto.BatchStatusCancelling, "cancelling_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("batch is not cancellable in status " + batch.Status)
+	}
+	batch.Status = dto.BatchStatusCancelling
+	batch.CancellingAt = now
+	return nil
+}
+
+func GetPendingBatchRequests(batchId int, limit int) ([]*BatchRequest, error) {
+	var requests []*BatchRequest
+	err := DB.Where("batch_id = ? AND status = ?", batchId, BatchRequestStatusPending).
+		Order("line asc").Limit(limit).Find(&requests).Error
+	return requests, err
+}
+
+// ClaimBatchRequest 执行前领取请求，只有仍为 pending 时才能领取成功，保证每行最多执行一次
+func ClaimBatchRequest(request *BatchRequest) (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&BatchRequest{}).Where("id = ? AND status = ?", request.Id, BatchRequestStatusPending).
+		Updates(map[string]any{"status": BatchRequestStatusRunning, "updated_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	request.Status = BatchRequestStatusRunning
+	request.UpdatedAt = now
+	return true, nil
+}
+
+// CountRunningBatchRequests 统计已领取但尚未保存结果的请求
+func CountRunningBatchRequests(batchId int) (int64, error) {
+	var count int64
+	err := DB.Model(&BatchRequest{}).Where("batch_id = ? AND status = ?", batchId, BatchRequestStatusRunning).Count(&count).Error
+	return count, err
+}
+
+// FailStaleBatchRequests 领取后超过 before 仍未保存结果的请求（如进程中断）标记为失败，不再重新执行以免重复计费
+func FailStaleBatchRequests(batchId int, before int64, message string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&BatchRequest{}).
+			Where("batch_id = ? AND status = ? AND updated_at < ?", batchId, BatchRequestStatusRunning, before).
+			Updates(map[string]any{"status": BatchRequestStatusFailed, "error": message, "updated_at": common.GetTimestamp()})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&Batch{}).Where("id = ?", batchId).
+			Update("failed_count", gorm.Expr("failed_count + ?", result.RowsAffected)).Error
+	})
+}
+
+// GetBatchResultRequests 按行号分页读取已完成或失败的请求，用于生成输出/错误文件
+func GetBatchResultRequests(batchId int, succeeded bool, afterLine int, limit int) ([]*BatchRequest, error) {
+	query := DB.Where("batch_id = ? AND line > ?", batchId, afterLine)
+	if succeeded {
+		query = query.Where("status = ?", BatchRequestStatusCompleted)
+	} else {
+		query = query.Where("status NOT IN ?", []string{BatchRequestStatusCompleted, BatchRequestStatusPending, BatchRequestStatusRunning})
+	}
+	var requests []*BatchRequest
+	err := query.Order("line asc").Limit(limit).Find(&requests).Error
+	return requests, err
+}
+
+// FinishBatchRequest 保存已领取请求的结果并累加批处理计数与用量
+func FinishBatchRequest(request *BatchRequest, usage dto.BatchUsage) error {
+	request.UpdatedAt = common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&BatchRequest{}).Where("id = ? AND status = ?", request.Id, BatchRequestStatusRunning).Updates(map[string]any{
+			"status":      request.Status,
+			"status_code": request.StatusCode,
+			"request_id":  request.RequestId,
+			"response":    request.Response,
+			"error":       request.Error,
+			"updated_at":  request.UpdatedAt,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		// 已被判定为中断而计入失败时不再重复计数
+		if result.RowsAffected == 0 {
+			return errors.New("batch request is no longer running")
+		}
+		counter := "completed_count"
+		if request.Status != BatchRequestStatusCompleted {
+			counter = "failed_count"
+		}
+		return tx.Model(&Batch{}).Where("id = ?", request.BatchId).Updates(map[string]any{
+			counter:         gorm.Expr(counter+" + ?", 1),
+			"input_tokens":  gorm.Expr("input_tokens + ?", usage.InputTokens),
+			"output_tokens": gorm.Expr("output_tokens + ?", usage.OutputTokens),
+			"total_tokens":  gorm.Expr("total_tokens + ?", usage.TotalTokens),
+		}).Error
+	})
+}
+
+// CloseBatchPendingRequests 将剩余未执行的请求标记为取消或过期，计入失败数
+func CloseBatchPendingRequests(batchId int, status string, message string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&BatchRequest{}).Where("batch_id = ? AND status = ?", batchId, BatchRequestStatusPending).
+			Updates(map[string]any{"status": status, "error": message, "updated_at": common.GetTimestamp()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		return tx.Model(&Batch{}).Where("id = ?", batchId).
+			Update("failed_count", gorm.Expr("failed_count + ?", result.RowsAffected)).Error
+	})
+}
@@ -0,0 +1,207 @@
+package model
+
+import (
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// BillingPeriod 已锁定的账期，锁定后账单从快照读取，不再随价格或日志变化
+type BillingPeriod struct {
+	Id             int    `json:"id"`
+	Period         string `json:"period" gorm:"size:7;uniqueIndex"`
+	StartTime      int64  `json:"start_time" gorm:"bigint"`
+	EndTime        int64  `json:"end_time" gorm:"bigint"`
+	StatementCount int    `json:"statement_count"`
+	FinalizedBy    int    `json:"finalized_by"`
+	FinalizedAt    int64  `json:"finalized_at" gorm:"bigint"`
+}
+
+// BillingStatement 锁定账期时保存的用户账单快照
+type BillingStatement struct {
+	Id         int    `json:"id"`
+	UserId     int    `json:"user_id" gorm:"uniqueIndex:idx_billing_statement_user_period,priority:1"`
+	Period     string `json:"period" gorm:"size:7;uniqueIndex:idx_billing_statement_user_period,priority:2;index"`
+	UsageQuota int64  `json:"usage_quota"`
+	TopUpQuota int64  `json:"topup_quota"`
+	Content    string `json:"-" gorm:"type:text"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint"`
+}
+
+// StatementUsage 账期内按模型汇总的消费
+type StatementUsage struct {
+	ModelName        string `json:"model_name"`
+	Requests         int    `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+}
+
+// StatementTopUp 账期内的充值记录，来源为在线支付订单或兑换码
+type StatementTopUp struct {
+	Source        string  `json:"source"`
+	Reference     string  `json:"reference"`
+	PaymentMethod string  `json:"payment_method,omitempty"`
+	Money         float64 `json:"money"`
+	Quota         int64   `json:"quota"`
+	RefundedQuota int64   `json:"refunded_quota"`
+	Status        string  `json:"status,omitempty"`
+	Time          int64   `json:"time"`
+}
+
+// StatementAdjustment 管理员调整额度、退款扣回等额度变动
+type StatementAdjustment struct {
+	Type    int    `json:"type"`
+	Content string `json:"content"`
+	Quota   int64  `json:"quota"`
+	Time    int64  `json:"time" gorm:"column:created_at"`
+}
+
+func GetStatementUsage(userId int, start int64, end int64) (usage []*StatementUsage, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("model_name, count(*) as requests, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(quota) as quota").
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at < ?", userId, LogTypeConsume, start, end).
+		Group("model_name").
+		Order("quota desc").
+		Scan(&usage).Error
+	return usage, err
+}
+
+// GetChannelUsageByModel 按模型汇总渠道在 [start, end) 内的消费日志，用于与上游账单对账
+func GetChannelUsageByModel(channelId int, start int64, end int64) (usage []*StatementUsage, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("model_name, count(*) as requests, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(quota) as quota").
+		Where("channel_id = ? AND type = ? AND created_at >= ? AND created_at < ?", channelId, LogTypeConsume, start, end).
+		Group("model_name").
+		Order("quota desc").
+		Scan(&usage).Error
+	return usage, err
+}
+
+func GetStatementTopUps(userId int, start int64, end int64) ([]*StatementTopUp, error) {
+	var topUps []*TopUp
+	err := DB.Where("user_id = ? AND status IN ? AND complete_time >= ? AND complete_time < ?", userId,
+		[]string{common.TopUpStatusSuccess, common.TopUpStatusRefunded, common.TopUpStatusPartiallyRefunded}, start, end).
+		Order("complete_time asc").Find(&topUps).Error
+	if err != nil {
+		return nil, err
+	}
+	var redemptions []*Redemption
+	err = DB.Where("used_user_id = ? AND redeemed_time >= ? AND redeemed_time < ?", userId, start, end).
+		Order("redeemed_time asc").Find(&redemptions).Error
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*StatementTopUp, 0, len(topUps)+len(redemptions))
+	for _, topUp := range topUps {
+		items = append(items, &StatementTopUp{
+			Source:        "topup",
+			Reference:     topUp.TradeNo,
+			PaymentMethod: topUp.PaymentMethod,
+			Money:         topUp.Money,
+			Quota:         int64(topUp.creditedQuota()),
+			RefundedQuota: topUp.RefundedQuota,
+			Status:        topUp.Status,
+			Time:          topUp.CompleteTime,
+		})
+	}
+	for _, redemption := range redemptions {
+		items = append(items, &StatementTopUp{
+			Source:    "redemption",
+			Reference: redemption.Name,
+			Quota:     int64(redemption.Quota),
+			Time:      redemption.RedeemedTime,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Time < items[j].Time
+	})
+	return items, nil
+}
+
+// GetStatementAdjustments 管理员额度调整与充值退款扣回的日志
+func GetStatementAdjustments(userId int, start int64, end int64) (adjustments []*StatementAdjustment, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("type, content, quota, created_at").
+		Where("user_id = ? AND created_at >= ? AND created_at < ? AND ((type = ? AND quota <> 0) OR (type = ? AND quota < 0))",
+			userId, start, end, LogTypeManage, LogTypeTopup).
+		Order("created_at asc").
+		Scan(&adjustments).Error
+	return adjustments, err
+}
+
+// GetBillingUserIds 账期内有消费、充值或额度调整的用户
+func GetBillingUserIds(start int64, end int64) ([]int, error) {
+	seen := make(map[int]struct{})
+	var ids []int
+	if err := LOG_DB.Model(&Log{}).Where("created_at >= ? AND created_at < ? AND type IN ?", start, end,
+		[]int{LogTypeConsume, LogTypeManage, LogTypeTopup}).Distinct().Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+	ids = nil
+	if err := DB.Model(&TopUp{}).Where("complete_time >= ? AND complete_time < ?", start, end).Distinct().Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+	ids = nil
+	if err := DB.Model(&Redemption{}).Where("redeemed_time >= ? AND redeemed_time < ?", start, end).Distinct().Pluck("used_user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+	userIds := make([]int, 0, len(seen))
+	for id := range seen {
+		if id > 0 {
+			userIds = append(userIds, id)
+		}
+	}
+	sort.Ints(userIds)
+	return userIds, nil
+}
+
+func GetBillingPeriod(period string) (*BillingPeriod, error) {
+	billingPeriod := &BillingPeriod{}
+	err := DB.Where("period = ?", period).First(billingPeriod).Error
+	if err != nil {
+		return nil, err
+	}
+	return billingPeriod, nil
+}
+
+func GetBillingPeriods(startIdx int, num int) (periods []*BillingPeriod, total int64, err error) {
+	if err = DB.Model(&BillingPeriod{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("period desc").Limit(num).Offset(startIdx).Find(&periods).Error
+	return periods, total, err
+}
+
+func GetBillingStatement(userId int, period string) (*BillingStatement, error) {
+	statement := &BillingStatement{}
+	err := DB.Where("user_id = ? AND period = ?", userId, period).First(statement).Error
+	if err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// FinalizeBillingPeriod 保存账期与全部账单快照，账期唯一索引保证只能锁定一次
+func FinalizeBillingPeriod(billingPeriod *BillingPeriod, statements []*BillingStatement) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(billingPeriod).Error; err != nil {
+			return err
+		}
+		if len(statements) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(statements, 100).Error
+	})
+}
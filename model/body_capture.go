@@ -0,0 +1,110 @@
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// BodyCapture 调试用的上游请求/响应完整记录，内容压缩后加密保存
+type BodyCapture struct {
+	Id         int    `json:"id"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64);index"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	TokenId    int    `json:"token_id" gorm:"index"`
+	ChannelId  int    `json:"channel_id" gorm:"index"`
+	ModelName  string `json:"model_name" gorm:"size:128;default:''"`
+	Method     string `json:"method" gorm:"size:16"`
+	Url        string `json:"url" gorm:"type:text"`
+	StatusCode int    `json:"status_code"`
+	IsStream   bool   `json:"is_stream"`
+	Duration   int64  `json:"duration"` // 毫秒
+	Truncated  bool   `json:"truncated"`
+	Error      string `json:"error" gorm:"type:text"`
+	Payload    []byte `json:"-"`
+}
+
+// BodyCapturePayload 加密保存的请求/响应内容
+type BodyCapturePayload struct {
+	RequestHeaders  map[string][]string `json:"request_headers"`
+	RequestBody     string              `json:"request_body"`
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	ResponseBody    string              `json:"response_body"`
+}
+
+func (capture *BodyCapture) SetPayload(payload *BodyCapturePayload) error {
+	data, err := common.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	capture.Payload, err = common.EncryptWithSecret(buffer.Bytes())
+	return err
+}
+
+func (capture *BodyCapture) GetPayload() (*BodyCapturePayload, error) {
+	data, err := common.DecryptWithSecret(capture.Payload)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err = io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	payload := &BodyCapturePayload{}
+	err = common.Unmarshal(data, payload)
+	return payload, err
+}
+
+func CreateBodyCapture(capture *BodyCapture) error {
+	return LOG_DB.Create(capture).Error
+}
+
+func GetBodyCaptureById(id int) (*BodyCapture, error) {
+	var capture BodyCapture
+	err := LOG_DB.First(&capture, id).Error
+	return &capture, err
+}
+
+// GetBodyCaptures 返回记录列表，不包含加密内容
+func GetBodyCaptures(requestId string, channelId int, tokenId int, startIdx int, num int) (captures []*BodyCapture, total int64, err error) {
+	tx := LOG_DB.Model(&BodyCapture{})
+	if requestId != "" {
+		tx = tx.Where("request_id = ?", requestId)
+	}
+	if channelId != 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if tokenId != 0 {
+		tx = tx.Where("token_id = ?", tokenId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("payload").Order("id desc").Limit(num).Offset(startIdx).Find(&captures).Error
+	return captures, total, err
+}
+
+func DeleteBodyCapture(id int) error {
+	return LOG_DB.Delete(&BodyCapture{}, id).Error
+}
+
+func DeleteBodyCapturesBefore(timestamp int64) (int64, error) {
+	result := LOG_DB.Where("created_at < ?", timestamp).Delete(&BodyCapture{})
+	return result.RowsAffected, result.Error
+}
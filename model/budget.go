@@ -0,0 +1,289 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BudgetScopeUser  = "user"
+	BudgetScopeToken = "token"
+	BudgetScopeGroup = "group"
+)
+
+const budgetCacheTTL = 30 * time.Second
+
+var errBudgetExceeded = errors.New("budget hard limit exceeded")
+
+type budgetCacheEntry struct {
+	budgets   []*Budget
+	expiresAt time.Time
+}
+
+// budgetCache 转发链路按用户缓存预算配置，已消费额度以数据库为准
+var budgetCache sync.Map
+
+// Budget 按自然月统计的消费预算。达到软限额的提醒比例时通知用户，达到硬限额后拒绝请求，
+// 跨月后自动清零
+type Budget struct {
+	Id              int    `json:"id"`
+	UserId          int    `json:"user_id" gorm:"index"`
+	Scope           string `json:"scope" gorm:"size:16"`
+	TokenId         int    `json:"token_id" gorm:"default:0"`
+	Group           string `json:"group" gorm:"size:64;default:''"`
+	SoftLimit       int    `json:"soft_limit" gorm:"default:0"`
+	HardLimit       int    `json:"hard_limit" gorm:"default:0"`              // 0 表示不限制
+	AlertThresholds string `json:"alert_thresholds" gorm:"type:varchar(64)"` // 软限额的提醒百分比，JSON 数组
+	Period          string `json:"period" gorm:"size:7"`
+	Spent           int    `json:"spent" gorm:"default:0"`
+	Notified        int    `json:"notified" gorm:"default:0"` // 本月已提醒的最高百分比
+	CreatedAt       int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt       int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// Thresholds 解析提醒百分比，未设置时使用 50/80/90
+func (budget *Budget) Thresholds() []int {
+	var thresholds []int
+	if budget.AlertThresholds != "" {
+		if err := common.UnmarshalJsonStr(budget.AlertThresholds, &thresholds); err == nil {
+			return thresholds
+		}
+	}
+	return []int{50, 80, 90}
+}
+
+// Matches 判断预算是否作用于本次请求
+func (budget *Budget) Matches(tokenId int, group string) bool {
+	switch budget.Scope {
+	case BudgetScopeToken:
+		return budget.TokenId == tokenId
+	case BudgetScopeGroup:
+		return budget.Group == group
+	default:
+		return true
+	}
+}
+
+func (budget *Budget) Validate() error {
+	switch budget.Scope {
+	case BudgetScopeUser:
+		budget.TokenId = 0
+		budget.Group = ""
+	case BudgetScopeToken:
+		if budget.TokenId == 0 {
+			return errors.New("请选择令牌")
+		}
+		budget.Group = ""
+	case BudgetScopeGroup:
+		budget.Group = strings.TrimSpace(budget.Group)
+		if budget.Group == "" {
+			return errors.New("请填写分组")
+		}
+		budget.TokenId = 0
+	default:
+		return errors.New("无效的预算范围")
+	}
+	if budget.SoftLimit < 0 || budget.HardLimit < 0 {
+		return errors.New("预算额度不能为负数")
+	}
+	if budget.SoftLimit == 0 && budget.HardLimit == 0 {
+		return errors.New("请至少设置软限额或硬限额")
+	}
+	if budget.AlertThresholds != "" {
+		var thresholds []int
+		if err := common.UnmarshalJsonStr(budget.AlertThresholds, &thresholds); err != nil {
+			return errors.New("提醒比例应为 JSON 数组，例如 [50,80,90]")
+		}
+		for _, threshold := range thresholds {
+			if threshold <= 0 || threshold > 100 {
+				return errors.New("提醒比例应在 1 到 100 之间")
+			}
+		}
+	}
+	return nil
+}
+
+// ResetIfStale 预算的账期不是当前月时视为已清零，持久化的清零在下次累计时完成
+func (budget *Budget) ResetIfStale(period string) {
+	if budget.Period != period {
+		budget.Period = period
+		budget.Spent = 0
+		budget.Notified = 0
+	}
+}
+
+func GetUserBudgets(userId int) (budgets []*Budget, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id asc").Find(&budgets).Error
+	return budgets, err
+}
+
+// GetUserBudgetsCached 转发链路使用的预算配置，在本节点缓存 30 秒，修改后立即失效；返回值为共享数据，调用方不可修改
+func GetUserBudgetsCached(userId int) ([]*Budget, error) {
+	if entry, ok := budgetCache.Load(userId); ok {
+		cached := entry.(budgetCacheEntry)
+		if time.Now().Before(cached.expiresAt) {
+			recordCacheLookup(CacheBudget, true)
+			return cached.budgets, nil
+		}
+	}
+	recordCacheLookup(CacheBudget, false)
+	budgets, err := GetUserBudgets(userId)
+	if err != nil {
+		return nil, err
+	}
+	budgetCache.Store(userId, budgetCacheEntry{budgets: budgets, expiresAt: time.Now().Add(budgetCacheTTL)})
+	return budgets, nil
+}
+
+func invalidateBudgetCache(userId int) {
+	budgetCache.Delete(userId)
+	PublishCacheInvalidation(CacheBudget, strconv.Itoa(userId))
+}
+
+// GetBudgets 管理员查询，userId 为 0 时查询全部用户
+func GetBudgets(userId int, startIdx int, num int) (budgets []*Budget, total int64, err error) {
+	tx := DB.Model(&Budget{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&budgets).Error
+	return budgets, total, err
+}
+
+func GetBudgetByIds(id int, userId int) (*Budget, error) {
+	budget := &Budget{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(budget).Error
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (budget *Budget) Insert(period string) error {
+	now := common.GetTimestamp()
+	budget.Period = period
+	budget.Spent = 0
+	budget.Notified = 0
+	budget.CreatedAt = now
+	budget.UpdatedAt = now
+	err := DB.Create(budget).Error
+	invalidateBudgetCache(budget.UserId)
+	return err
+}
+
+// Update 只更新用户可修改的字段，修改限额后重新计算提醒进度
+func (budget *Budget) Update() error {
+	budget.Notified = 0
+	budget.UpdatedAt = common.GetTimestamp()
+	defer invalidateBudgetCache(budget.UserId)
+	return DB.Model(budget).Updates(map[string]interface{}{
+		"scope":            budget.Scope,
+		"token_id":         budget.TokenId,
+		"group":            budget.Group,
+		"soft_limit":       budget.SoftLimit,
+		"hard_limit":       budget.HardLimit,
+		"alert_thresholds": budget.AlertThresholds,
+		"notified":         budget.Notified,
+		"updated_at":       budget.UpdatedAt,
+	}).Error
+}
+
+func DeleteBudget(id int, userId int) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&Budget{})
+	invalidateBudgetCache(userId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddBudgetSpent 累计本月消费并返回更新后的预算，跨月的预算先清零再累计
+func AddBudgetSpent(ids []int, quota int, period string) (budgets []*Budget, err error) {
+	if len(ids) == 0 || quota == 0 {
+		return nil, nil
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Budget{}).Where("id IN ? AND period <> ?", ids, period).
+			Updates(map[string]interface{}{"period": period, "spent": 0, "notified": 0}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Budget{}).Where("id IN ?", ids).
+			Update("spent", gorm.Expr("spent + ?", quota)).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Find(&budgets).Error
+	})
+	return budgets, err
+}
+
+// ReserveBudgetSpent 预扣费时在命中的预算上原子地预占额度，任一预算超出硬限额时不做修改并返回该预算
+func ReserveBudgetSpent(ids []int, quota int, period string) (exceeded *Budget, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Budget{}).Where("id IN ? AND period <> ?", ids, period).
+			Updates(map[string]interface{}{"period": period, "spent": 0, "notified": 0}).Error
+		if err != nil {
+			return err
+		}
+		if quota == 0 {
+			// 不预占时只检查是否已用尽，避免依赖未修改行的影响行数
+			var found []*Budget
+			if err := tx.Where("id IN ? AND hard_limit > 0 AND spent >= hard_limit", ids).Limit(1).Find(&found).Error; err != nil {
+				return err
+			}
+			if len(found) > 0 {
+				exceeded = found[0]
+				return errBudgetExceeded
+			}
+			return nil
+		}
+		for _, id := range ids {
+			result := tx.Model(&Budget{}).Where("id = ? AND (hard_limit = 0 OR (spent < hard_limit AND spent + ? <= hard_limit))", id, quota).
+				Update("spent", gorm.Expr("spent + ?", quota))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				exceeded = &Budget{}
+				if err := tx.First(exceeded, "id = ?", id).Error; err != nil {
+					return err
+				}
+				return errBudgetExceeded
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBudgetExceeded) {
+		return exceeded, nil
+	}
+	return nil, err
+}
+
+// ReleaseBudgetSpent 退回预占的额度，已跨月清零的预算不再扣减
+func ReleaseBudgetSpent(ids []int, quota int, period string) error {
+	if len(ids) == 0 || quota <= 0 {
+		return nil
+	}
+	return DB.Model(&Budget{}).Where("id IN ? AND period = ? AND spent >= ?", ids, period, quota).
+		Update("spent", gorm.Expr("spent - ?", quota)).Error
+}
+
+// MarkBudgetNotified 提醒进度只增不减，返回 false 表示其他请求已发送过该提醒
+func MarkBudgetNotified(id int, threshold int) (bool, error) {
+	result := DB.Model(&Budget{}).Where("id = ? AND notified < ?", id, threshold).Update("notified", threshold)
+	return result.RowsAffected > 0, result.Error
+}
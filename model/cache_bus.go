@@ -0,0 +1,268 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 缓存失效广播：令牌与用户缓存保存在 Redis 中由各实例共享，渠道与组织缓存保存在各实例内存中。
+// 修改渠道状态或组织后通过 Redis 发布受影响的键，其他实例只失效或重新加载这些条目，
+// 不必等待 SYNC_FREQUENCY 或缓存过期。未配置 Redis 时仍按原有的定时同步与过期时间刷新
+
+const (
+	CacheChannel          = "channel"
+	CacheOrganization     = "organization"
+	CacheToken            = "token"
+	CacheUser             = "user"
+	CacheUserPermissions  = "user_permissions"
+	CacheBudget           = "budget"
+	CacheUserOrganization = "user_organization"
+
+	cacheRedisChannel = "new-api:cache:invalidate"
+)
+
+type cacheInvalidation struct {
+	Cache  string   `json:"cache"`
+	Keys   []string `json:"keys"`
+	Node   string   `json:"node"`
+	SentAt int64    `json:"sent_at"` // 毫秒
+}
+
+type cacheCounters struct {
+	hits          atomic.Int64
+	misses        atomic.Int64
+	sent          atomic.Int64
+	received      atomic.Int64
+	lastReceived  atomic.Int64
+	totalLagMs    atomic.Int64
+	maxLagMs      atomic.Int64
+	invalidations atomic.Int64 // 实际失效的条目数
+}
+
+var (
+	cacheBusOnce         sync.Once
+	cacheInvalidatorLock sync.RWMutex
+	cacheInvalidators    = make(map[string]func(keys []string) int)
+	cacheCounterMap      sync.Map // name -> *cacheCounters
+	channelCacheSyncedAt atomic.Int64
+)
+
+func init() {
+	RegisterCacheInvalidator(CacheChannel, invalidateChannelCacheEntries)
+	RegisterCacheInvalidator(CacheOrganization, func(keys []string) int {
+		for _, key := range keys {
+			if id, err := strconv.Atoi(key); err == nil {
+				organizationCache.Delete(id)
+			}
+		}
+		return len(keys)
+	})
+	RegisterCacheInvalidator(CacheUserPermissions, invalidateUserPermissionsEntries)
+	RegisterCacheInvalidator(CacheUserOrganization, func(keys []string) int {
+		for _, key := range keys {
+			if id, err := strconv.Atoi(key); err == nil {
+				userOrganizationCache.Delete(id)
+			}
+		}
+		return len(keys)
+	})
+	RegisterCacheInvalidator(CacheBudget, func(keys []string) int {
+		for _, key := range keys {
+			if id, err := strconv.Atoi(key); err == nil {
+				budgetCache.Delete(id)
+			}
+		}
+		return len(keys)
+	})
+}
+
+func cacheStats(name string) *cacheCounters {
+	if counters, ok := cacheCounterMap.Load(name); ok {
+		return counters.(*cacheCounters)
+	}
+	counters, _ := cacheCounterMap.LoadOrStore(name, &cacheCounters{})
+	return counters.(*cacheCounters)
+}
+
+func recordCacheLookup(name string, hit bool) {
+	if hit {
+		cacheStats(name).hits.Add(1)
+	} else {
+		cacheStats(name).misses.Add(1)
+	}
+}
+
+// RegisterCacheInvalidator 注册本实例内存缓存的失效处理，返回实际失效的条目数
+func RegisterCacheInvalidator(name string, invalidate func(keys []string) int) {
+	cacheInvalidatorLock.Lock()
+	defer cacheInvalidatorLock.Unlock()
+	cacheInvalidators[name] = invalidate
+}
+
+// StartCacheInvalidationBus 订阅其他实例发布的缓存失效，需在 Redis 初始化之后调用
+func StartCacheInvalidationBus() {
+	if common.RDB == nil {
+		return
+	}
+	cacheBusOnce.Do(func() {
+		gopool.Go(func() {
+			pubsub := common.RDB.Subscribe(context.Background(), cacheRedisChannel)
+			defer pubsub.Close()
+			for msg := range pubsub.Channel() {
+				var message cacheInvalidation
+				if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil || message.Node == InstanceId() {
+					continue
+				}
+				applyCacheInvalidation(message)
+			}
+		})
+		common.SysLog("cache invalidation bus enabled")
+	})
+}
+
+func applyCacheInvalidation(message cacheInvalidation) {
+	cacheInvalidatorLock.RLock()
+	invalidate := cacheInvalidators[message.Cache]
+	cacheInvalidatorLock.RUnlock()
+	if invalidate == nil {
+		return
+	}
+	counters := cacheStats(message.Cache)
+	counters.invalidations.Add(int64(invalidate(message.Keys)))
+	counters.received.Add(1)
+	now := time.Now().UnixMilli()
+	counters.lastReceived.Store(now)
+	if message.SentAt <= 0 {
+		return
+	}
+	lag := max(now-message.SentAt, 0)
+	counters.totalLagMs.Add(lag)
+	for {
+		current := counters.maxLagMs.Load()
+		if lag <= current || counters.maxLagMs.CompareAndSwap(current, lag) {
+			break
+		}
+	}
+}
+
+// PublishCacheInvalidation 本实例已更新自己的缓存后调用，通知其他实例失效这些键
+func PublishCacheInvalidation(cache string, keys ...string) {
+	if common.RDB == nil || len(keys) == 0 {
+		return
+	}
+	payload, _ := json.Marshal(cacheInvalidation{Cache: cache, Keys: keys, Node: InstanceId(), SentAt: time.Now().UnixMilli()})
+	cacheStats(cache).sent.Add(1)
+	gopool.Go(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := common.RDB.Publish(ctx, cacheRedisChannel, payload).Err(); err != nil {
+			common.SysError("failed to publish cache invalidation: " + err.Error())
+		}
+	})
+}
+
+// invalidateChannelCacheEntries 按渠道 id 从数据库重新加载并替换缓存条目，分组、模型或优先级变化以及重新启用时重建整个缓存
+func invalidateChannelCacheEntries(keys []string) int {
+	if !common.MemoryCacheEnabled {
+		return 0
+	}
+	count := 0
+	for _, key := range keys {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			continue
+		}
+		channel, err := GetChannelById(id, true)
+		if err != nil || !replaceCachedChannel(channel) {
+			InitChannelCache()
+			return len(keys)
+		}
+		count++
+	}
+	return count
+}
+
+func replaceCachedChannel(channel *Channel) bool {
+	channelSyncLock.Lock()
+	cached, ok := channelsIDM[channel.Id]
+	if !ok || cached.Group != channel.Group || cached.Models != channel.Models || cached.GetPriority() != channel.GetPriority() ||
+		(cached.Status != channel.Status && channel.Status == common.ChannelStatusEnabled) {
+		channelSyncLock.Unlock()
+		return false
+	}
+	if channel.ChannelInfo.IsMultiKey {
+		channel.Keys = channel.GetKeys()
+		channel.ChannelInfo.MultiKeyPollingIndex = cached.ChannelInfo.MultiKeyPollingIndex
+	}
+	channelsIDM[channel.Id] = channel
+	statusChanged := cached.Status != channel.Status
+	channelSyncLock.Unlock()
+	if statusChanged {
+		// 从分组索引中移除已禁用的渠道
+		CacheUpdateChannelStatus(channel.Id, channel.Status)
+	}
+	return true
+}
+
+type CacheStats struct {
+	Name     string  `json:"name"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRate  float64 `json:"hit_rate"`
+	Sent     int64   `json:"invalidations_sent"`
+	Received int64   `json:"invalidations_received"`
+	// Invalidated 收到广播后实际失效的条目数
+	Invalidated    int64   `json:"invalidated_entries"`
+	LastReceivedAt int64   `json:"last_received_at"`
+	AvgLagMillis   float64 `json:"avg_lag_ms"`
+	MaxLagMillis   int64   `json:"max_lag_ms"`
+	// StalenessSeconds 距离上次全量同步的时间，仅渠道缓存
+	StalenessSeconds int64 `json:"staleness_seconds,omitempty"`
+}
+
+func GetCacheStats() []CacheStats {
+	names := []string{CacheChannel, CacheOrganization, CacheToken, CacheUser}
+	cacheCounterMap.Range(func(key, _ any) bool {
+		if name := key.(string); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+		return true
+	})
+	slices.Sort(names[4:])
+	stats := make([]CacheStats, 0, len(names))
+	for _, name := range names {
+		counters := cacheStats(name)
+		stat := CacheStats{
+			Name:           name,
+			Hits:           counters.hits.Load(),
+			Misses:         counters.misses.Load(),
+			Sent:           counters.sent.Load(),
+			Received:       counters.received.Load(),
+			Invalidated:    counters.invalidations.Load(),
+			LastReceivedAt: counters.lastReceived.Load(),
+			MaxLagMillis:   counters.maxLagMs.Load(),
+		}
+		if total := stat.Hits + stat.Misses; total > 0 {
+			stat.HitRate = float64(stat.Hits) / float64(total)
+		}
+		if stat.Received > 0 {
+			stat.AvgLagMillis = float64(counters.totalLagMs.Load()) / float64(stat.Received)
+		}
+		if name == CacheChannel && common.MemoryCacheEnabled {
+			if syncedAt := channelCacheSyncedAt.Load(); syncedAt > 0 {
+				stat.StalenessSeconds = time.Now().Unix() - syncedAt
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -48,6 +49,7 @@ type Channel struct {
 	ParamOverride     *string `json:"param_override" gorm:"type:text"`
 	HeaderOverride    *string `json:"header_override" gorm:"type:text"`
 	Remark            *string `json:"remark" gorm:"type:varchar(255)" validate:"max=255"`
+	CanaryPercent     *int    `json:"canary_percent" gorm:"default:0"` // 灰度渠道分得的请求百分比，0 表示正常渠道
 	// add after v0.8.5
 	ChannelInfo ChannelInfo `json:"channel_info" gorm:"type:json"`
 
@@ -275,6 +277,13 @@ func GetAllChannels(startIdx int, num int, selectAll bool, idSort bool) ([]*Chan
 	return channels, err
 }
 
+// GetChannelsForMetrics 仅查询指标展示需要的字段
+func GetChannelsForMetrics() ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Select("id", "name", "type", "status", "response_time").Find(&channels).Error
+	return channels, err
+}
+
 func GetChannelsByTag(tag string, idSort bool, selectAll bool) ([]*Channel, error) {
 	var channels []*Channel
 	order := "priority desc"
@@ -289,6 +298,18 @@ func GetChannelsByTag(tag string, idSort bool, selectAll bool) ([]*Channel, erro
 	return channels, err
 }
 
+// GetEnabledCanaryChannels 返回启用中的灰度渠道
+func GetEnabledCanaryChannels() ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Where("status = ? AND canary_percent > 0", common.ChannelStatusEnabled).Omit("key").Find(&channels).Error
+	return channels, err
+}
+
+// PromoteCanaryChannel 灰度评估通过后转为正常渠道
+func PromoteCanaryChannel(id int) error {
+	return DB.Model(&Channel{}).Where("id = ?", id).Update("canary_percent", 0).Error
+}
+
 func SearchChannels(keyword string, group string, model string, idSort bool) ([]*Channel, error) {
 	var channels []*Channel
 	modelsCol := "`models`"
@@ -402,6 +423,10 @@ func BatchDeleteChannels(ids []int) error {
 			tx.Rollback()
 			return err
 		}
+		if err := tx.Where("channel_id in (?)", chunk).Delete(&ChannelCapability{}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 	return tx.Commit().Error
 }
@@ -420,6 +445,13 @@ func (channel *Channel) GetWeight() int {
 	return int(*channel.Weight)
 }
 
+func (channel *Channel) GetCanaryPercent() int {
+	if channel.CanaryPercent == nil {
+		return 0
+	}
+	return *channel.CanaryPercent
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -531,7 +563,10 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
-	return err
+	if err != nil {
+		return err
+	}
+	return DeleteChannelCapabilitiesByChannelId(channel.Id)
 }
 
 var channelStatusLock sync.Mutex
@@ -574,6 +609,13 @@ func handlerMultiKeyUpdate(channel *Channel, usingKey string, status int, reason
 	keys := channel.GetKeys()
 	if len(keys) == 0 {
 		channel.Status = status
+	} else if usingKey == "" {
+		// 未指定 key 时更新整个渠道状态
+		channel.Status = status
+		info := channel.GetOtherInfo()
+		info["status_reason"] = reason
+		info["status_time"] = common.GetTimestamp()
+		channel.SetOtherInfo(info)
 	} else {
 		var keyIndex int
 		for i, key := range keys {
@@ -676,6 +718,7 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			return false
 		}
 	}
+	PublishCacheInvalidation(CacheChannel, strconv.Itoa(channelId))
 	return true
 }
 
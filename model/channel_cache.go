@@ -82,9 +82,17 @@ func InitChannelCache() {
 	}
 	channelsIDM = newChannelId2channel
 	channelSyncLock.Unlock()
+	loadChannelCapabilities()
+	channelCacheSyncedAt.Store(time.Now().Unix())
 	common.SysLog("channels synced from database")
 }
 
+// RefreshChannelCache 渠道变更后重新加载本实例的缓存并通知其他实例
+func RefreshChannelCache() {
+	InitChannelCache()
+	NotifyConfigChanged(ConfigScopeChannels)
+}
+
 func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
@@ -93,10 +101,11 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+// GetRandomSatisfiedChannel 按优先级与权重选择渠道，required 不为空时排除缺少所需能力的渠道
+func GetRandomSatisfiedChannel(group string, model string, retry int, required *RequiredCapabilities) (*Channel, error) {
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetChannel(group, model, retry)
+		return GetChannel(group, model, retry, required)
 	}
 
 	channelSyncLock.RLock()
@@ -115,6 +124,23 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, nil
 	}
 
+	if !required.IsEmpty() {
+		candidates := make([]*Channel, 0, len(channels))
+		for _, channelId := range channels {
+			if channel, ok := channelsIDM[channelId]; ok {
+				candidates = append(candidates, channel)
+			}
+		}
+		capable, err := filterCapableChannels(candidates, model, required)
+		if err != nil {
+			return nil, err
+		}
+		channels = make([]int, 0, len(capable))
+		for _, channel := range capable {
+			channels = append(channels, channel.Id)
+		}
+	}
+
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
 			return channel, nil
@@ -142,12 +168,10 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	targetPriority := int64(sortedUniquePriorities[retry])
 
 	// get the priority for the given retry number
-	var sumWeight = 0
 	var targetChannels []*Channel
 	for _, channelId := range channels {
 		if channel, ok := channelsIDM[channelId]; ok {
 			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
 				targetChannels = append(targetChannels, channel)
 			}
 		} else {
@@ -159,6 +183,12 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
 	}
 
+	targetChannels = selectCanaryTraffic(targetChannels)
+	var sumWeight = 0
+	for _, channel := range targetChannels {
+		sumWeight += channel.GetWeight()
+	}
+
 	// smoothing factor and adjustment
 	smoothingFactor := 1
 	smoothingAdjustment := 0
@@ -198,6 +228,7 @@ func CacheGetChannel(id int) (*Channel, error) {
 	defer channelSyncLock.RUnlock()
 
 	c, ok := channelsIDM[id]
+	recordCacheLookup(CacheChannel, ok)
 	if !ok {
 		return nil, fmt.Errorf("渠道# %d，已不存在", id)
 	}
@@ -263,3 +294,25 @@ func CacheUpdateChannel(channel *Channel) {
 	channelsIDM[channel.Id] = channel
 	println("after :", channelsIDM[channel.Id].ChannelInfo.MultiKeyPollingIndex)
 }
+
+// selectCanaryTraffic 灰度渠道按百分比分流：命中时只使用该灰度渠道，否则只在正常渠道中按权重选择
+func selectCanaryTraffic(channels []*Channel) []*Channel {
+	stable := make([]*Channel, 0, len(channels))
+	roll := rand.Intn(100)
+	for _, channel := range channels {
+		percent := channel.GetCanaryPercent()
+		if percent <= 0 {
+			stable = append(stable, channel)
+			continue
+		}
+		if roll < percent {
+			return []*Channel{channel}
+		}
+		roll -= percent
+	}
+	if len(stable) == 0 {
+		// 只有灰度渠道时不做限制
+		return channels
+	}
+	return stable
+}
@@ -0,0 +1,302 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ChannelCapabilitySourceAdmin = "admin"
+	ChannelCapabilitySourceAuto  = "auto"
+
+	// ChannelCapabilityAllModels 对渠道下所有模型生效的记录
+	ChannelCapabilityAllModels = "*"
+)
+
+const (
+	CapabilityVision     = "vision"
+	CapabilityTools      = "tools"
+	CapabilityJSONSchema = "json_schema"
+	CapabilityAudio      = "audio"
+	CapabilityStreaming  = "streaming"
+	CapabilityContext    = "max_context"
+)
+
+// ChannelCapability 渠道在某个模型上的能力，字段为空表示未知，按支持处理
+type ChannelCapability struct {
+	Id         int    `json:"id"`
+	ChannelId  int    `json:"channel_id" gorm:"uniqueIndex:uk_channel_capability,priority:1"`
+	ModelName  string `json:"model_name" gorm:"size:128;uniqueIndex:uk_channel_capability,priority:2"`
+	Vision     *bool  `json:"vision"`
+	Tools      *bool  `json:"tools"`
+	JSONSchema *bool  `json:"json_schema" gorm:"column:json_schema"`
+	Audio      *bool  `json:"audio"`
+	Streaming  *bool  `json:"streaming"`
+	MaxContext int    `json:"max_context"`                       // 最大上下文 tokens，0 表示未知
+	Source     string `json:"source" gorm:"type:varchar(16)"`    // admin 或 auto
+	Reason     string `json:"reason,omitempty" gorm:"type:text"` // 自动识别时记录的上游错误
+	UpdatedAt  int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// RequiredCapabilities 请求需要渠道具备的能力
+type RequiredCapabilities struct {
+	Vision        bool `json:"vision,omitempty"`
+	Tools         bool `json:"tools,omitempty"`
+	JSONSchema    bool `json:"json_schema,omitempty"`
+	Audio         bool `json:"audio,omitempty"`
+	Streaming     bool `json:"streaming,omitempty"`
+	ContextTokens int  `json:"context_tokens,omitempty"` // 估算的输入与最大输出 tokens 之和
+}
+
+func (r *RequiredCapabilities) IsEmpty() bool {
+	return r == nil || (!r.Vision && !r.Tools && !r.JSONSchema && !r.Audio && !r.Streaming && r.ContextTokens == 0)
+}
+
+// ChannelCapabilityError 分组下所有渠道都缺少请求需要的能力
+type ChannelCapabilityError struct {
+	Missing []string
+}
+
+func (e *ChannelCapabilityError) Error() string {
+	return "没有支持 " + strings.Join(e.Missing, ", ") + " 的可用渠道"
+}
+
+var (
+	channelCapabilities     map[int]map[string]*ChannelCapability
+	channelCapabilitiesLock sync.RWMutex
+)
+
+// merge 用 other 中已知的字段覆盖当前记录
+func (c *ChannelCapability) merge(other *ChannelCapability) {
+	if other.Vision != nil {
+		c.Vision = other.Vision
+	}
+	if other.Tools != nil {
+		c.Tools = other.Tools
+	}
+	if other.JSONSchema != nil {
+		c.JSONSchema = other.JSONSchema
+	}
+	if other.Audio != nil {
+		c.Audio = other.Audio
+	}
+	if other.Streaming != nil {
+		c.Streaming = other.Streaming
+	}
+	if other.MaxContext > 0 {
+		c.MaxContext = other.MaxContext
+	}
+}
+
+// Missing 返回渠道明确不支持的能力，jsonSchemaEmulated 为渠道开启了结构化输出模拟
+func (c *ChannelCapability) Missing(required *RequiredCapabilities, jsonSchemaEmulated bool) []string {
+	var missing []string
+	unsupported := func(flag *bool) bool {
+		return flag != nil && !*flag
+	}
+	if required.Vision && unsupported(c.Vision) {
+		missing = append(missing, CapabilityVision)
+	}
+	if required.Tools && unsupported(c.Tools) {
+		missing = append(missing, CapabilityTools)
+	}
+	if required.JSONSchema && unsupported(c.JSONSchema) && !jsonSchemaEmulated {
+		missing = append(missing, CapabilityJSONSchema)
+	}
+	if required.Audio && unsupported(c.Audio) {
+		missing = append(missing, CapabilityAudio)
+	}
+	if required.Streaming && unsupported(c.Streaming) {
+		missing = append(missing, CapabilityStreaming)
+	}
+	if required.ContextTokens > 0 && c.MaxContext > 0 && required.ContextTokens > c.MaxContext {
+		missing = append(missing, CapabilityContext)
+	}
+	return missing
+}
+
+func loadChannelCapabilities() {
+	var capabilities []*ChannelCapability
+	if err := DB.Find(&capabilities).Error; err != nil {
+		common.SysError("failed to load channel capabilities: " + err.Error())
+		return
+	}
+	registry := make(map[int]map[string]*ChannelCapability)
+	for _, capability := range capabilities {
+		if registry[capability.ChannelId] == nil {
+			registry[capability.ChannelId] = make(map[string]*ChannelCapability)
+		}
+		registry[capability.ChannelId][capability.ModelName] = capability
+	}
+	channelCapabilitiesLock.Lock()
+	channelCapabilities = registry
+	channelCapabilitiesLock.Unlock()
+}
+
+func getChannelCapabilityRecords(channelId int) map[string]*ChannelCapability {
+	if !common.MemoryCacheEnabled {
+		var capabilities []*ChannelCapability
+		DB.Where("channel_id = ?", channelId).Find(&capabilities)
+		records := make(map[string]*ChannelCapability, len(capabilities))
+		for _, capability := range capabilities {
+			records[capability.ModelName] = capability
+		}
+		return records
+	}
+	channelCapabilitiesLock.RLock()
+	defer channelCapabilitiesLock.RUnlock()
+	return channelCapabilities[channelId]
+}
+
+// GetEffectiveChannelCapability 合并渠道级（*）与模型级记录，模型级优先
+func GetEffectiveChannelCapability(channelId int, modelName string) *ChannelCapability {
+	records := getChannelCapabilityRecords(channelId)
+	effective := &ChannelCapability{ChannelId: channelId, ModelName: modelName}
+	if len(records) == 0 {
+		return effective
+	}
+	if all, ok := records[ChannelCapabilityAllModels]; ok {
+		effective.merge(all)
+	}
+	record, ok := records[modelName]
+	if !ok {
+		record, ok = records[ratio_setting.FormatMatchingModelName(modelName)]
+	}
+	if ok {
+		effective.merge(record)
+	}
+	return effective
+}
+
+// MissingChannelCapabilities 返回渠道在该模型上缺少的能力，为空表示可以处理该请求
+func MissingChannelCapabilities(channel *Channel, modelName string, required *RequiredCapabilities) []string {
+	if required.IsEmpty() {
+		return nil
+	}
+	capability := GetEffectiveChannelCapability(channel.Id, modelName)
+	// 仅在确实缺少 json_schema 时才解析渠道设置
+	emulated := required.JSONSchema && capability.JSONSchema != nil && !*capability.JSONSchema &&
+		channel.GetSetting().StructuredOutputEmulation
+	return capability.Missing(required, emulated)
+}
+
+// filterCapableChannels 排除缺少所需能力的渠道，全部被排除时返回 ChannelCapabilityError
+func filterCapableChannels(channels []*Channel, modelName string, required *RequiredCapabilities) ([]*Channel, error) {
+	if required.IsEmpty() || len(channels) == 0 {
+		return channels, nil
+	}
+	capable := make([]*Channel, 0, len(channels))
+	missingSet := make(map[string]bool)
+	var missing []string
+	for _, channel := range channels {
+		channelMissing := MissingChannelCapabilities(channel, modelName, required)
+		if len(channelMissing) == 0 {
+			capable = append(capable, channel)
+			continue
+		}
+		for _, name := range channelMissing {
+			if !missingSet[name] {
+				missingSet[name] = true
+				missing = append(missing, name)
+			}
+		}
+	}
+	if len(capable) == 0 {
+		return nil, &ChannelCapabilityError{Missing: missing}
+	}
+	return capable, nil
+}
+
+func GetChannelCapabilities(channelId int) ([]*ChannelCapability, error) {
+	var capabilities []*ChannelCapability
+	err := DB.Where("channel_id = ?", channelId).Order("model_name asc").Find(&capabilities).Error
+	return capabilities, err
+}
+
+// SaveChannelCapability 管理员设置渠道能力，覆盖该模型已有的记录（包括自动识别的结果）
+func SaveChannelCapability(capability *ChannelCapability) error {
+	if capability.ChannelId <= 0 {
+		return errors.New("无效的渠道 Id")
+	}
+	if capability.ModelName == "" {
+		capability.ModelName = ChannelCapabilityAllModels
+	}
+	capability.Source = ChannelCapabilitySourceAdmin
+	capability.Reason = ""
+	capability.UpdatedAt = common.GetTimestamp()
+	existing := &ChannelCapability{}
+	err := DB.Where("channel_id = ? AND model_name = ?", capability.ChannelId, capability.ModelName).First(existing).Error
+	if err == nil {
+		capability.Id = existing.Id
+		err = DB.Select("*").Save(capability).Error
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		capability.Id = 0
+		err = DB.Create(capability).Error
+	}
+	if err != nil {
+		return err
+	}
+	refreshChannelCapabilities()
+	return nil
+}
+
+func DeleteChannelCapability(channelId int, id int) error {
+	result := DB.Where("id = ? AND channel_id = ?", id, channelId).Delete(&ChannelCapability{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("能力记录不存在")
+	}
+	refreshChannelCapabilities()
+	return nil
+}
+
+// RecordDetectedChannelCapability 记录从上游错误中识别出的能力缺失，管理员设置过的记录不会被覆盖
+func RecordDetectedChannelCapability(channelId int, modelName string, detected *ChannelCapability, reason string) (bool, error) {
+	existing := &ChannelCapability{}
+	err := DB.Where("channel_id = ? AND model_name = ?", channelId, modelName).First(existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	if err == nil && existing.Source == ChannelCapabilitySourceAdmin {
+		return false, nil
+	}
+	if err != nil {
+		existing = &ChannelCapability{ChannelId: channelId, ModelName: modelName}
+	}
+	existing.merge(detected)
+	existing.Source = ChannelCapabilitySourceAuto
+	existing.Reason = reason
+	existing.UpdatedAt = common.GetTimestamp()
+	if existing.Id == 0 {
+		err = DB.Create(existing).Error
+	} else {
+		err = DB.Select("*").Save(existing).Error
+	}
+	if err != nil {
+		return false, err
+	}
+	common.SysLog(fmt.Sprintf("channel #%d model %s capability detected: %s", channelId, modelName, reason))
+	refreshChannelCapabilities()
+	return true, nil
+}
+
+// refreshChannelCapabilities 重新加载本实例的能力缓存并通知其他实例
+func refreshChannelCapabilities() {
+	if common.MemoryCacheEnabled {
+		loadChannelCapabilities()
+	}
+	NotifyConfigChanged(ConfigScopeChannels)
+}
+
+func DeleteChannelCapabilitiesByChannelId(channelId int) error {
+	return DB.Where("channel_id = ?", channelId).Delete(&ChannelCapability{}).Error
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	ChannelStatusTriggerAutoDisable = "auto_disable"
+	ChannelStatusTriggerAutoEnable  = "auto_enable"
+	ChannelStatusTriggerManual      = "manual"
+	ChannelStatusTriggerTag         = "tag"
+	ChannelStatusTriggerMultiKey    = "multi_key"
+)
+
+// ChannelStatusHistory 渠道状态变更记录
+type ChannelStatusHistory struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"index:idx_channel_status_history_channel_time,priority:1"`
+	FromStatus   int    `json:"from_status"`
+	ToStatus     int    `json:"to_status" gorm:"index"`
+	KeyIndex     int    `json:"key_index" gorm:"default:-1"` // -1 表示整个渠道
+	TriggerType  string `json:"trigger_type" gorm:"type:varchar(32);index"`
+	OperatorId   int    `json:"operator_id"`
+	OperatorName string `json:"operator_name" gorm:"type:varchar(64)"`
+	Reason       string `json:"reason" gorm:"type:text"`
+	ErrorPayload string `json:"error_payload" gorm:"type:text"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index:idx_channel_status_history_channel_time,priority:2"`
+}
+
+type ChannelStatusHistoryFilter struct {
+	TriggerType    string
+	ToStatus       int
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func RecordChannelStatusHistory(history *ChannelStatusHistory) {
+	if history.CreatedAt == 0 {
+		history.CreatedAt = common.GetTimestamp()
+	}
+	if err := DB.Create(history).Error; err != nil {
+		common.SysError("failed to record channel status history: " + err.Error())
+	}
+}
+
+func GetChannelStatusHistory(channelId int, filter ChannelStatusHistoryFilter, startIdx int, num int) (histories []*ChannelStatusHistory, total int64, err error) {
+	query := DB.Model(&ChannelStatusHistory{}).Where("channel_id = ?", channelId)
+	if filter.TriggerType != "" {
+		query = query.Where("trigger_type = ?", filter.TriggerType)
+	}
+	if filter.ToStatus != 0 {
+		query = query.Where("to_status = ?", filter.ToStatus)
+	}
+	if filter.StartTimestamp != 0 {
+		query = query.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		query = query.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&histories).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return histories, total, nil
+}
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// 配置热更新：修改选项或渠道后递增 config_versions 中对应范围的版本号，配置了 Redis 时同时发布通知。
+// 每个实例收到通知或每 CONFIG_SYNC_INTERVAL 秒轮询到版本变化时立即重新加载，
+// 不必等待 SYNC_FREQUENCY 的全量同步，也不需要重启
+
+const (
+	ConfigScopeOptions  = "options"
+	ConfigScopeChannels = "channels"
+
+	configRedisChannel = "new-api:config"
+)
+
+// ConfigVersion 每个配置范围一行，版本号只增不减
+type ConfigVersion struct {
+	Scope     string `json:"scope" gorm:"primaryKey;size:32"`
+	Version   int64  `json:"version"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"` // 毫秒
+}
+
+type configChangeMessage struct {
+	Scope   string `json:"scope"`
+	Version int64  `json:"version"`
+	Node    string `json:"node"`
+}
+
+var (
+	configSyncOnce     sync.Once
+	configSyncLock     sync.Mutex
+	configVersions     = make(map[string]int64)
+	configSyncWake     = make(chan struct{}, 1)
+	configSyncInterval time.Duration
+	configReloads      atomic.Int64
+	configLastReload   atomic.Int64
+	configLastSource   atomic.Value
+	configLastError    atomic.Value
+)
+
+var instanceId = sync.OnceValue(func() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), common.GetRandomString(8))
+})
+
+// InstanceId 当前进程的实例标识，用于选主与配置广播
+func InstanceId() string {
+	return instanceId()
+}
+
+// StartConfigSync 开始监听配置变更，需在选项与渠道缓存首次加载之后调用
+func StartConfigSync() {
+	configSyncOnce.Do(func() {
+		configSyncInterval = time.Duration(max(common.GetEnvOrDefault("CONFIG_SYNC_INTERVAL", 3), 1)) * time.Second
+		// 启动时已经全量加载，只记录当前版本
+		versions, err := latestConfigVersions()
+		if err != nil {
+			common.SysError("failed to load config versions: " + err.Error())
+		}
+		configSyncLock.Lock()
+		for scope, version := range versions {
+			configVersions[scope] = version
+		}
+		configSyncLock.Unlock()
+		if common.RDB != nil {
+			gopool.Go(subscribeConfigChanges)
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(configSyncInterval)
+			defer ticker.Stop()
+			for {
+				source := "poll"
+				select {
+				case <-ticker.C:
+				case <-configSyncWake:
+					source = "broadcast"
+				}
+				checkConfigVersions(source)
+			}
+		})
+		common.SysLog(fmt.Sprintf("config sync enabled, broadcast=%s, interval=%s", configBroadcastBackend(), configSyncInterval))
+	})
+}
+
+func configBroadcastBackend() string {
+	if common.RDB != nil {
+		return "redis"
+	}
+	return "db"
+}
+
+func subscribeConfigChanges() {
+	pubsub := common.RDB.Subscribe(context.Background(), configRedisChannel)
+	defer pubsub.Close()
+	// 断线后 go-redis 会自动重新订阅，期间的变更由轮询兜底
+	for msg := range pubsub.Channel() {
+		var change configChangeMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &change); err != nil || change.Node == InstanceId() {
+			continue
+		}
+		select {
+		case configSyncWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func latestConfigVersions() (map[string]int64, error) {
+	var rows []ConfigVersion
+	if err := DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	versions := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		versions[row.Scope] = row.Version
+	}
+	return versions, nil
+}
+
+func checkConfigVersions(source string) {
+	versions, err := latestConfigVersions()
+	if err != nil {
+		configLastError.Store(err.Error())
+		common.SysError("failed to check config versions: " + err.Error())
+		return
+	}
+	configLastError.Store("")
+	configSyncLock.Lock()
+	defer configSyncLock.Unlock()
+	for scope, version := range versions {
+		if version <= configVersions[scope] {
+			continue
+		}
+		common.SysLog(fmt.Sprintf("config %s changed to version %d, reloading (%s)", scope, version, source))
+		reloadConfigScope(scope)
+		configVersions[scope] = version
+		configReloads.Add(1)
+		configLastReload.Store(time.Now().Unix())
+		configLastSource.Store(source)
+	}
+}
+
+func reloadConfigScope(scope string) {
+	switch scope {
+	case ConfigScopeOptions:
+		loadOptionsFromDatabase()
+	case ConfigScopeChannels:
+		if common.MemoryCacheEnabled {
+			InitChannelCache()
+		}
+	}
+	// 倍率、分组与渠道模型都会影响定价
+	InvalidatePricing()
+}
+
+// NotifyConfigChanged 本实例已应用变更后调用，通知其他实例重新加载该范围的配置
+func NotifyConfigChanged(scope string) {
+	version, err := bumpConfigVersion(scope)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to bump config version of %s: %s", scope, err.Error()))
+		return
+	}
+	configSyncLock.Lock()
+	// 中间没有其他实例的变更时无需本实例再加载一次
+	if configVersions[scope] == version-1 {
+		configVersions[scope] = version
+	}
+	configSyncLock.Unlock()
+	if common.RDB == nil {
+		return
+	}
+	payload, _ := json.Marshal(configChangeMessage{Scope: scope, Version: version, Node: InstanceId()})
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err = common.RDB.Publish(ctx, configRedisChannel, payload).Err(); err != nil {
+		common.SysError("failed to publish config change: " + err.Error())
+	}
+}
+
+// bumpConfigVersion 原子递增版本号，记录不存在时插入，并发插入失败的一方重试递增
+func bumpConfigVersion(scope string) (int64, error) {
+	if err := incrementConfigVersion(DB, scope); err != nil {
+		if err = incrementConfigVersion(DB, scope); err != nil {
+			return 0, err
+		}
+	}
+	var row ConfigVersion
+	if err := DB.Where("scope = ?", scope).First(&row).Error; err != nil {
+		return 0, err
+	}
+	return row.Version, nil
+}
+
+func incrementConfigVersion(db *gorm.DB, scope string) error {
+	now := time.Now().UnixMilli()
+	result := db.Model(&ConfigVersion{}).Where("scope = ?", scope).
+		Updates(map[string]any{"version": gorm.Expr("version + 1"), "updated_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return db.Create(&ConfigVersion{Scope: scope, Version: 1, UpdatedAt: now}).Error
+}
+
+type ConfigSyncStatus struct {
+	NodeId         string           `json:"node_id"`
+	Broadcast      string           `json:"broadcast"`
+	IntervalSecond int              `json:"interval_seconds"`
+	Versions       map[string]int64 `json:"versions"`        // 本实例已应用的版本
+	LatestVersions map[string]int64 `json:"latest_versions"` // 数据库中的最新版本
+	InSync         bool             `json:"in_sync"`
+	Reloads        int64            `json:"reloads"`
+	LastReloadAt   int64            `json:"last_reload_at"`
+	LastSource     string           `json:"last_source,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+}
+
+func GetConfigSyncStatus() ConfigSyncStatus {
+	status := ConfigSyncStatus{
+		NodeId:         InstanceId(),
+		Broadcast:      configBroadcastBackend(),
+		IntervalSecond: int(configSyncInterval / time.Second),
+		Versions:       make(map[string]int64),
+		Reloads:        configReloads.Load(),
+		LastReloadAt:   configLastReload.Load(),
+	}
+	status.LastSource, _ = configLastSource.Load().(string)
+	status.LastError, _ = configLastError.Load().(string)
+	configSyncLock.Lock()
+	for scope, version := range configVersions {
+		status.Versions[scope] = version
+	}
+	configSyncLock.Unlock()
+	latest, err := latestConfigVersions()
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+	status.LatestVersions = latest
+	status.InSync = true
+	for scope, version := range latest {
+		if status.Versions[scope] < version {
+			status.InSync = false
+		}
+	}
+	return status
+}
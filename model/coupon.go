@@ -0,0 +1,303 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CouponBonusTypePercent = "percent"
+	CouponBonusTypeFixed   = "fixed"
+)
+
+// Coupon 充值优惠券，下单时填写，订单完成后按比例或固定额度赠送。
+// 同一个券码可被多个用户使用，由 TotalLimit 和 PerUserLimit 控制次数
+type Coupon struct {
+	Id           int            `json:"id"`
+	Code         string         `json:"code" gorm:"type:varchar(32);uniqueIndex"`
+	Name         string         `json:"name" gorm:"index"`
+	Status       int            `json:"status" gorm:"default:1"`
+	BonusType    string         `json:"bonus_type" gorm:"type:varchar(16)"`
+	BonusValue   float64        `json:"bonus_value"`                     // percent 为百分比，fixed 为赠送额度
+	MaxBonus     int            `json:"max_bonus" gorm:"default:0"`      // 按比例赠送时的封顶额度，0 表示不限
+	MinTopUp     int            `json:"min_topup" gorm:"default:0"`      // 单笔充值到账额度的最低要求
+	PerUserLimit int            `json:"per_user_limit" gorm:"default:1"` // 每位用户可用次数，0 表示不限
+	TotalLimit   int            `json:"total_limit" gorm:"default:0"`    // 总可用次数，0 表示不限
+	UsedCount    int            `json:"used_count" gorm:"default:0"`
+	NewUserOnly  bool           `json:"new_user_only" gorm:"default:false"` // 仅限从未成功充值过的用户
+	ExpiredTime  int64          `json:"expired_time" gorm:"bigint"`         // 过期时间，0 表示不过期
+	CreatedTime  int64          `json:"created_time" gorm:"bigint"`
+	Count        int            `json:"count" gorm:"-:all"` // only for api request
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// CouponUsage 优惠券的使用记录
+type CouponUsage struct {
+	Id          int    `json:"id"`
+	CouponId    int    `json:"coupon_id" gorm:"index"`
+	CouponName  string `json:"coupon_name" gorm:"index"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TopUpId     int    `json:"topup_id" gorm:"index"`
+	TradeNo     string `json:"trade_no" gorm:"type:varchar(255)"`
+	TopUpQuota  int    `json:"topup_quota"`
+	BonusQuota  int    `json:"bonus_quota"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// CouponReport 按优惠券名称（同一批次）汇总的使用情况
+type CouponReport struct {
+	Name       string `json:"name"`
+	Coupons    int64  `json:"coupons"`
+	UsedCount  int64  `json:"used_count"`
+	Users      int64  `json:"users"`
+	TopUpQuota int64  `json:"topup_quota"`
+	BonusQuota int64  `json:"bonus_quota"`
+}
+
+func (coupon *Coupon) Validate() error {
+	if utf8.RuneCountInString(coupon.Name) == 0 || utf8.RuneCountInString(coupon.Name) > 20 {
+		return errors.New("优惠券名称长度必须在 1 到 20 之间")
+	}
+	switch coupon.BonusType {
+	case CouponBonusTypePercent:
+		if coupon.BonusValue <= 0 || coupon.BonusValue > 1000 {
+			return errors.New("赠送比例必须在 0 到 1000 之间")
+		}
+	case CouponBonusTypeFixed:
+		if coupon.BonusValue < 1 {
+			return errors.New("赠送额度必须大于 0")
+		}
+	default:
+		return errors.New("无效的优惠类型")
+	}
+	if coupon.MaxBonus < 0 || coupon.MinTopUp < 0 || coupon.PerUserLimit < 0 || coupon.TotalLimit < 0 {
+		return errors.New("限制条件不能为负数")
+	}
+	if coupon.ExpiredTime != 0 && coupon.ExpiredTime < common.GetTimestamp() {
+		return errors.New("过期时间不能早于当前时间")
+	}
+	return nil
+}
+
+// Bonus 计算充值到账 quota 时可获得的赠送额度
+func (coupon *Coupon) Bonus(quota float64) int {
+	if coupon.BonusType == CouponBonusTypeFixed {
+		return int(coupon.BonusValue)
+	}
+	bonus := int(quota * coupon.BonusValue / 100)
+	if coupon.MaxBonus > 0 {
+		bonus = min(bonus, coupon.MaxBonus)
+	}
+	return bonus
+}
+
+// check 校验用户本次充值能否使用该优惠券，topUpId 为当前订单，判断新用户时排除
+func (coupon *Coupon) check(tx *gorm.DB, userId int, quota float64, topUpId int) error {
+	if coupon.Status != common.CouponStatusEnabled {
+		return errors.New("该优惠券已停用")
+	}
+	if coupon.ExpiredTime != 0 && coupon.ExpiredTime < common.GetTimestamp() {
+		return errors.New("该优惠券已过期")
+	}
+	if coupon.TotalLimit > 0 && coupon.UsedCount >= coupon.TotalLimit {
+		return errors.New("该优惠券已被领完")
+	}
+	if coupon.MinTopUp > 0 && quota < float64(coupon.MinTopUp) {
+		return fmt.Errorf("充值额度需达到 %s 才能使用该优惠券", logger.FormatQuota(coupon.MinTopUp))
+	}
+	if coupon.PerUserLimit > 0 {
+		var used int64
+		if err := tx.Model(&CouponUsage{}).Where("coupon_id = ? AND user_id = ?", coupon.Id, userId).Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(coupon.PerUserLimit) {
+			return errors.New("已达到该优惠券的使用次数上限")
+		}
+	}
+	if coupon.NewUserOnly {
+		var paid int64
+		err := tx.Model(&TopUp{}).Where("user_id = ? AND id <> ? AND status IN ?", userId, topUpId,
+			[]string{common.TopUpStatusSuccess, common.TopUpStatusRefunded, common.TopUpStatusPartiallyRefunded}).Count(&paid).Error
+		if err != nil {
+			return err
+		}
+		if paid > 0 {
+			return errors.New("该优惠券仅限首次充值使用")
+		}
+	}
+	return nil
+}
+
+// AttachCoupon 下单时校验优惠券并记录到订单，赠送额度在订单完成时发放
+func (topUp *TopUp) AttachCoupon(code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil
+	}
+	coupon, err := GetCouponByCode(code)
+	if err != nil {
+		return errors.New("无效的优惠券")
+	}
+	if err = coupon.check(DB, topUp.UserId, topUp.creditedQuota(), topUp.Id); err != nil {
+		return err
+	}
+	topUp.CouponId = coupon.Id
+	return nil
+}
+
+// redeemTopUpCoupon 在充值事务内发放优惠券赠送额度。优惠券在下单后失效时照常完成充值，只是不再赠送
+func redeemTopUpCoupon(tx *gorm.DB, topUp *TopUp, quota int) (int, error) {
+	if topUp.CouponId == 0 || quota <= 0 {
+		return 0, nil
+	}
+	coupon := &Coupon{}
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", topUp.CouponId).First(coupon).Error; err != nil {
+		common.SysLog(fmt.Sprintf("coupon %d of top-up %s not found", topUp.CouponId, topUp.TradeNo))
+		return 0, nil
+	}
+	if err := coupon.check(tx, topUp.UserId, float64(quota), topUp.Id); err != nil {
+		common.SysLog(fmt.Sprintf("coupon %d not applied to top-up %s: %s", coupon.Id, topUp.TradeNo, err.Error()))
+		return 0, nil
+	}
+	bonus := coupon.Bonus(float64(quota))
+	if bonus <= 0 {
+		return 0, nil
+	}
+	// 条件更新避免并发订单超出总次数
+	result := tx.Model(&Coupon{}).Where("id = ? AND (total_limit = 0 OR used_count < total_limit)", coupon.Id).
+		Update("used_count", gorm.Expr("used_count + ?", 1))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, nil
+	}
+	usage := &CouponUsage{
+		CouponId:    coupon.Id,
+		CouponName:  coupon.Name,
+		UserId:      topUp.UserId,
+		TopUpId:     topUp.Id,
+		TradeNo:     topUp.TradeNo,
+		TopUpQuota:  quota,
+		BonusQuota:  bonus,
+		CreatedTime: common.GetTimestamp(),
+	}
+	if err := tx.Create(usage).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(&TopUp{}).Where("id = ?", topUp.Id).Update("bonus_quota", bonus).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", bonus)).Error; err != nil {
+		return 0, err
+	}
+	topUp.BonusQuota = int64(bonus)
+	return bonus, nil
+}
+
+func recordCouponBonusLog(topUp *TopUp, bonus int) {
+	if bonus > 0 {
+		RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("订单 %s 使用优惠券，赠送额度: %v", topUp.TradeNo, logger.FormatQuota(bonus)))
+	}
+}
+
+func GetCouponByCode(code string) (*Coupon, error) {
+	coupon := &Coupon{}
+	err := DB.Where("code = ?", code).First(coupon).Error
+	return coupon, err
+}
+
+func GetCouponById(id int) (*Coupon, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	coupon := &Coupon{}
+	err := DB.First(coupon, "id = ?", id).Error
+	return coupon, err
+}
+
+// SearchCoupons keyword 为空时返回全部，否则按 ID、券码或名称前缀匹配
+func SearchCoupons(keyword string, startIdx int, num int) (coupons []*Coupon, total int64, err error) {
+	query := DB.Model(&Coupon{})
+	if keyword != "" {
+		if id, err := strconv.Atoi(keyword); err == nil {
+			query = query.Where("id = ? OR code = ? OR name LIKE ?", id, keyword, keyword+"%")
+		} else {
+			query = query.Where("code = ? OR name LIKE ?", keyword, keyword+"%")
+		}
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&coupons).Error
+	return coupons, total, err
+}
+
+func (coupon *Coupon) Insert() error {
+	return DB.Create(coupon).Error
+}
+
+func (coupon *Coupon) Update() error {
+	return DB.Model(coupon).Select("name", "status", "bonus_type", "bonus_value", "max_bonus", "min_top_up",
+		"per_user_limit", "total_limit", "new_user_only", "expired_time").Updates(coupon).Error
+}
+
+func DeleteCouponById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	return DB.Delete(&Coupon{}, "id = ?", id).Error
+}
+
+// GetCouponUsages couponId、userId 为 0 时不作为筛选条件
+func GetCouponUsages(couponId int, userId int, startIdx int, num int) (usages []*CouponUsage, total int64, err error) {
+	query := DB.Model(&CouponUsage{})
+	if couponId != 0 {
+		query = query.Where("coupon_id = ?", couponId)
+	}
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&usages).Error
+	return usages, total, err
+}
+
+// GetCouponReports 按优惠券名称汇总发放数量、使用次数、使用人数与赠送额度
+func GetCouponReports() ([]*CouponReport, error) {
+	var reports []*CouponReport
+	err := DB.Model(&Coupon{}).Select("name, count(*) as coupons, sum(used_count) as used_count").
+		Group("name").Order("name").Scan(&reports).Error
+	if err != nil {
+		return nil, err
+	}
+	var usages []*CouponReport
+	err = DB.Model(&CouponUsage{}).
+		Select("coupon_name as name, count(distinct user_id) as users, sum(top_up_quota) as top_up_quota, sum(bonus_quota) as bonus_quota").
+		Group("coupon_name").Scan(&usages).Error
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*CouponReport, len(usages))
+	for _, usage := range usages {
+		byName[usage.Name] = usage
+	}
+	for _, report := range reports {
+		if usage, ok := byName[report.Name]; ok {
+			report.Users = usage.Users
+			report.TopUpQuota = usage.TopUpQuota
+			report.BonusQuota = usage.BonusQuota
+		}
+	}
+	return reports, nil
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"strings"
 	"time"
+
+	"github.com/QuantumNous/new-api/common"
 )
 
 // CustomOAuthProvider stores configuration for custom OAuth providers
@@ -25,9 +27,17 @@ type CustomOAuthProvider struct {
 	DisplayNameField  string `json:"display_name_field" gorm:"type:varchar(128);default:'name'"`          // Display name field path
 	EmailField        string `json:"email_field" gorm:"type:varchar(128);default:'email'"`                // Email field path
 
+	// Group mapping: GroupField points to a claim (string or array), GroupMapping is a JSON object
+	// mapping claim values to new-api groups, applied when the user is provisioned
+	GroupField   string `json:"group_field" gorm:"type:varchar(128)"`
+	GroupMapping string `json:"group_mapping" gorm:"type:text"`
+
 	// Advanced options
-	WellKnown string `json:"well_known" gorm:"type:varchar(512)"` // OIDC discovery endpoint (optional)
-	AuthStyle int    `json:"auth_style" gorm:"default:0"`         // 0=auto, 1=params, 2=header (Basic Auth)
+	WellKnown     string `json:"well_known" gorm:"type:varchar(512)"` // OIDC discovery endpoint (optional)
+	Issuer        string `json:"issuer" gorm:"type:varchar(512)"`     // OIDC issuer, discovery falls back to {issuer}/.well-known/openid-configuration
+	AuthStyle     int    `json:"auth_style" gorm:"default:0"`         // 0=auto, 1=params, 2=header (Basic Auth)
+	UsePKCE       bool   `json:"use_pkce" gorm:"default:false"`       // Send an S256 code challenge with the authorization request
+	AutoProvision bool   `json:"auto_provision" gorm:"default:false"` // Create accounts on first login even when registration is disabled
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -153,6 +163,29 @@ func validateCustomOAuthProvider(provider *CustomOAuthProvider) error {
 	if provider.Scopes == "" {
 		provider.Scopes = "openid profile email"
 	}
+	if provider.GroupMapping != "" {
+		var mapping map[string]string
+		if err := common.UnmarshalJsonStr(provider.GroupMapping, &mapping); err != nil {
+			return errors.New("group mapping must be a JSON object of claim value to group")
+		}
+	}
 
 	return nil
 }
+
+// MapGroup returns the group mapped from the first claim value that has a mapping, or "" if none matches
+func (provider *CustomOAuthProvider) MapGroup(values []string) string {
+	if provider.GroupMapping == "" || len(values) == 0 {
+		return ""
+	}
+	var mapping map[string]string
+	if err := common.UnmarshalJsonStr(provider.GroupMapping, &mapping); err != nil {
+		return ""
+	}
+	for _, value := range values {
+		if group, ok := mapping[value]; ok && group != "" {
+			return group
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
+var ErrFileQuotaExceeded = errors.New("file storage quota exceeded")
+
+// File 通过 /v1/files 上传的文件元数据，文件内容保存在存储后端中
+type File struct {
+	Id         int    `json:"id"`
+	FileId     string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Filename   string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose    string `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes      int64  `json:"bytes"`
+	Storage    string `json:"storage" gorm:"type:varchar(16)"` // 写入时使用的存储后端
+	StorageKey string `json:"storage_key" gorm:"type:varchar(255)"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (f *File) ToOpenAIFile() *dto.OpenAIFile {
+	return &dto.OpenAIFile{
+		ID:        f.FileId,
+		Object:    "file",
+		Bytes:     f.Bytes,
+		CreatedAt: f.CreatedAt,
+		Filename:  f.Filename,
+		Purpose:   f.Purpose,
+		Status:    "processed",
+	}
+}
+
+func CreateFile(file *File) error {
+	return DB.Create(file).Error
+}
+
+// ReserveFile 锁定用户记录后检查存储空间并写入文件记录，并发上传时不会超出 limitBytes；
+// 文件内容写入失败时调用方需删除该记录
+func ReserveFile(file *File, limitBytes int64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id").First(&User{}, file.UserId).Error; err != nil {
+			return err
+		}
+		var used int64
+		if err := tx.Model(&File{}).Where("user_id = ?", file.UserId).Select("COALESCE(SUM(bytes), 0)").Scan(&used).Error; err != nil {
+			return err
+		}
+		if used+file.Bytes > limitBytes {
+			return ErrFileQuotaExceeded
+		}
+		return tx.Create(file).Error
+	})
+}
+
+func GetUserFile(userId int, fileId string) (*File, error) {
+	file := &File{}
+	err := DB.Where("user_id = ? AND file_id = ?", userId, fileId).First(file).Error
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// GetUserFiles 按创建时间倒序分页，afterId 为上一页最后一个 file_id
+func GetUserFiles(userId int, purpose string, afterId string, limit int) ([]*File, error) {
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if afterId != "" {
+		after := &File{}
+		if err := DB.Select("id").Where("user_id = ? AND file_id = ?", userId, afterId).First(after).Error; err != nil {
+			return nil, err
+		}
+		query = query.Where("id < ?", after.Id)
+	}
+	var files []*File
+	err := query.Order("id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func DeleteFile(id int) error {
+	return DB.Where("id = ?", id).Delete(&File{}).Error
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// FreeTierUsage 用户每天各模型已使用的免费额度
+type FreeTierUsage struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"uniqueIndex:idx_free_tier_usage,priority:1"`
+	ModelName string `json:"model_name" gorm:"size:128;uniqueIndex:idx_free_tier_usage,priority:2"`
+	Day       string `json:"day" gorm:"size:10;uniqueIndex:idx_free_tier_usage,priority:3;index"`
+	Requests  int    `json:"requests" gorm:"default:0"`
+	Tokens    int    `json:"tokens" gorm:"default:0"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// GetFreeTierUsage 未使用过时返回零值记录
+func GetFreeTierUsage(userId int, modelName string, day string) (*FreeTierUsage, error) {
+	usage := &FreeTierUsage{}
+	err := DB.Where("user_id = ? AND model_name = ? AND day = ?", userId, modelName, day).First(usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &FreeTierUsage{UserId: userId, ModelName: modelName, Day: day}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func getOrCreateFreeTierUsage(userId int, modelName string, day string) (*FreeTierUsage, error) {
+	usage, err := GetFreeTierUsage(userId, modelName, day)
+	if err != nil || usage.Id != 0 {
+		return usage, err
+	}
+	usage.UpdatedAt = common.GetTimestamp()
+	if err = DB.Create(usage).Error; err != nil {
+		// 并发请求可能已创建同一天的记录
+		return GetFreeTierUsage(userId, modelName, day)
+	}
+	return usage, nil
+}
+
+// ConsumeFreeTierRequest 次数未用完时占用一次免费额度
+func ConsumeFreeTierRequest(userId int, modelName string, day string, limit int, tokens int) (bool, error) {
+	usage, err := getOrCreateFreeTierUsage(userId, modelName, day)
+	if err != nil {
+		return false, err
+	}
+	result := DB.Model(&FreeTierUsage{}).Where("id = ? AND requests < ?", usage.Id, limit).Updates(map[string]interface{}{
+		"requests":   gorm.Expr("requests + ?", 1),
+		"tokens":     gorm.Expr("tokens + ?", tokens),
+		"updated_at": common.GetTimestamp(),
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ConsumeFreeTierTokens 用剩余的免费 token 抵扣本次请求，返回实际抵扣的 token 数；requests 为计入的请求次数
+func ConsumeFreeTierTokens(userId int, modelName string, day string, limit int, tokens int, requests int) (int, error) {
+	for i := 0; i < 3; i++ {
+		usage, err := getOrCreateFreeTierUsage(userId, modelName, day)
+		if err != nil {
+			return 0, err
+		}
+		covered := min(tokens, limit-usage.Tokens)
+		if covered <= 0 {
+			return 0, nil
+		}
+		// 以当前用量为条件更新，避免并发请求重复抵扣
+		result := DB.Model(&FreeTierUsage{}).Where("id = ? AND tokens = ?", usage.Id, usage.Tokens).Updates(map[string]interface{}{
+			"requests":   gorm.Expr("requests + ?", requests),
+			"tokens":     gorm.Expr("tokens + ?", covered),
+			"updated_at": common.GetTimestamp(),
+		})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return covered, nil
+		}
+	}
+	return 0, nil
+}
+
+// AdjustFreeTierUsage 按增量修正已占用的免费额度，用于结算时校正或失败时释放预占，结果不会小于 0
+func AdjustFreeTierUsage(userId int, modelName string, day string, requests int, tokens int) error {
+	return DB.Model(&FreeTierUsage{}).
+		Where("user_id = ? AND model_name = ? AND day = ? AND requests + ? >= 0 AND tokens + ? >= 0", userId, modelName, day, requests, tokens).
+		Updates(map[string]interface{}{
+			"requests":   gorm.Expr("requests + ?", requests),
+			"tokens":     gorm.Expr("tokens + ?", tokens),
+			"updated_at": common.GetTimestamp(),
+		}).Error
+}
+
+// GetFreeTierUsages 查询 [startDay, endDay] 内的免费额度使用记录
+func GetFreeTierUsages(userId int, startDay string, endDay string) (usages []*FreeTierUsage, err error) {
+	err = DB.Where("user_id = ? AND day >= ? AND day <= ?", userId, startDay, endDay).
+		Order("day desc, model_name asc").Find(&usages).Error
+	return usages, err
+}
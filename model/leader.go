@@ -0,0 +1,205 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-redis/redis/v8"
+)
+
+// 多实例部署时通过选主保证渠道测试、定时任务等后台作业只在一个实例上执行。
+// LEADER_ELECTION 为 redis 或 db 时，主节点（NODE_TYPE 不为 slave）竞争同一个租约，持有租约的节点为 leader；
+// 未开启时每个主节点都视为 leader，与单实例部署的行为一致
+
+const (
+	LeaderBackendRedis = "redis"
+	LeaderBackendDB    = "db"
+
+	leaderLeaseName = "background_jobs"
+	leaderRedisKey  = "new-api:leader:" + leaderLeaseName
+)
+
+// LeaderLease 数据库选主使用的租约，过期后其他节点可以接管
+type LeaderLease struct {
+	Name      string `json:"name" gorm:"primaryKey;size:64"`
+	Holder    string `json:"holder" gorm:"size:128"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint"` // 毫秒
+}
+
+// 键不存在时获取，持有者为自己时续期
+var leaderRedisScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if holder == false then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+if holder == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var leaderResignScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+var (
+	leaderOnce    sync.Once
+	leaderBackend string
+	leaderNodeId  string
+	leaderTTL     time.Duration
+	leaderActive  atomic.Bool
+	leaderSince   atomic.Int64
+	leaderChanges atomic.Int64
+)
+
+// IsLeader 当前节点是否负责执行后台作业
+func IsLeader() bool {
+	if leaderBackend == "" {
+		return common.IsMasterNode
+	}
+	return leaderActive.Load()
+}
+
+// StartLeaderElection 按 LEADER_ELECTION 开始竞选，需在数据库与 Redis 初始化之后调用
+func StartLeaderElection() error {
+	backend := os.Getenv("LEADER_ELECTION")
+	switch backend {
+	case "", "off":
+		return nil
+	case LeaderBackendRedis:
+		if common.RDB == nil {
+			return fmt.Errorf("LEADER_ELECTION=redis requires Redis")
+		}
+	case LeaderBackendDB:
+	default:
+		return fmt.Errorf("unknown LEADER_ELECTION backend: %s", backend)
+	}
+	leaderOnce.Do(func() {
+		leaderBackend = backend
+		leaderNodeId = InstanceId()
+		leaderTTL = time.Duration(max(common.GetEnvOrDefault("LEADER_LEASE_SECONDS", 15), 3)) * time.Second
+		common.SysLog(fmt.Sprintf("leader election enabled, backend=%s, node=%s", leaderBackend, leaderNodeId))
+		if !common.IsMasterNode {
+			return
+		}
+		renewLeaderLease()
+		gopool.Go(func() {
+			// 租约期内续期三次，单次失败不会丢失租约
+			ticker := time.NewTicker(leaderTTL / 3)
+			defer ticker.Stop()
+			for range ticker.C {
+				renewLeaderLease()
+			}
+		})
+	})
+	return nil
+}
+
+func renewLeaderLease() {
+	ctx, cancel := context.WithTimeout(context.Background(), leaderTTL/3)
+	defer cancel()
+	var acquired bool
+	var err error
+	if leaderBackend == LeaderBackendRedis {
+		acquired, err = acquireRedisLeaderLease(ctx)
+	} else {
+		acquired, err = acquireDBLeaderLease(ctx)
+	}
+	if err != nil {
+		common.SysError("failed to renew leader lease: " + err.Error())
+	}
+	setLeader(acquired && err == nil)
+}
+
+func setLeader(leader bool) {
+	if leaderActive.Swap(leader) == leader {
+		return
+	}
+	leaderChanges.Add(1)
+	if leader {
+		leaderSince.Store(time.Now().Unix())
+		common.SysLog("this node is now the leader and runs background jobs")
+	} else {
+		leaderSince.Store(0)
+		common.SysLog("this node is no longer the leader")
+	}
+}
+
+func acquireRedisLeaderLease(ctx context.Context) (bool, error) {
+	result, err := leaderRedisScript.Run(ctx, common.RDB, []string{leaderRedisKey}, leaderNodeId, leaderTTL.Milliseconds()).Int()
+	return result == 1, err
+}
+
+// acquireDBLeaderLease 租约由自己持有或已过期时更新为自己，记录不存在时插入，并发插入只有一个节点成功
+func acquireDBLeaderLease(ctx context.Context) (bool, error) {
+	now := time.Now().UnixMilli()
+	db := DB.WithContext(ctx)
+	result := db.Model(&LeaderLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", leaderLeaseName, leaderNodeId, now).
+		Updates(map[string]any{"holder": leaderNodeId, "expires_at": now + leaderTTL.Milliseconds()})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	var count int64
+	if err := db.Model(&LeaderLease{}).Where("name = ?", leaderLeaseName).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	err := db.Create(&LeaderLease{Name: leaderLeaseName, Holder: leaderNodeId, ExpiresAt: now + leaderTTL.Milliseconds()}).Error
+	return err == nil, nil
+}
+
+// ResignLeader 退出时主动释放租约，其他节点无需等待过期即可接管
+func ResignLeader() {
+	if leaderBackend == "" || !leaderActive.Load() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var err error
+	if leaderBackend == LeaderBackendRedis {
+		err = leaderResignScript.Run(ctx, common.RDB, []string{leaderRedisKey}, leaderNodeId).Err()
+	} else {
+		err = DB.WithContext(ctx).Model(&LeaderLease{}).Where("name = ? AND holder = ?", leaderLeaseName, leaderNodeId).
+			Update("expires_at", 0).Error
+	}
+	if err != nil {
+		common.SysError("failed to resign leader lease: " + err.Error())
+	}
+	setLeader(false)
+}
+
+type LeaderStatus struct {
+	Backend     string `json:"backend"`
+	NodeId      string `json:"node_id"`
+	Leader      bool   `json:"leader"`
+	LeaderSince int64  `json:"leader_since"`
+	Changes     int64  `json:"changes"`
+}
+
+func GetLeaderStatus() LeaderStatus {
+	return LeaderStatus{
+		Backend:     leaderBackend,
+		NodeId:      leaderNodeId,
+		Leader:      IsLeader(),
+		LeaderSince: leaderSince.Load(),
+		Changes:     leaderChanges.Load(),
+	}
+}
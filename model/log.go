@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/metrics"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -35,6 +37,7 @@ type Log struct {
 	ChannelName      string `json:"channel_name" gorm:"->"`
 	TokenId          int    `json:"token_id" gorm:"default:0;index"`
 	Group            string `json:"group" gorm:"index"`
+	Project          string `json:"project" gorm:"size:64;index;default:''"`
 	Ip               string `json:"ip" gorm:"index;default:''"`
 	RequestId        string `json:"request_id,omitempty" gorm:"type:varchar(64);index:idx_logs_request_id;default:''"`
 	Other            string `json:"other"`
@@ -69,18 +72,23 @@ func formatUserLogs(logs []*Log) {
 func GetLogByKey(key string) (logs []*Log, err error) {
 	if os.Getenv("LOG_SQL_DSN") != "" {
 		var tk Token
-		if err = DB.Model(&Token{}).Where(logKeyCol+"=?", strings.TrimPrefix(key, "sk-")).First(&tk).Error; err != nil {
+		if err = readDB().Model(&Token{}).Where(logKeyCol+"=?", strings.TrimPrefix(key, "sk-")).First(&tk).Error; err != nil {
 			return nil, err
 		}
-		err = LOG_DB.Model(&Log{}).Where("token_id=?", tk.Id).Find(&logs).Error
+		err = readLogDB().Model(&Log{}).Where("token_id=?", tk.Id).Find(&logs).Error
 	} else {
-		err = LOG_DB.Joins("left join tokens on tokens.id = logs.token_id").Where("tokens.key = ?", strings.TrimPrefix(key, "sk-")).Find(&logs).Error
+		err = readLogDB().Joins("left join tokens on tokens.id = logs.token_id").Where("tokens.key = ?", strings.TrimPrefix(key, "sk-")).Find(&logs).Error
 	}
 	formatUserLogs(logs)
 	return logs, err
 }
 
 func RecordLog(userId int, logType int, content string) {
+	RecordQuotaLog(userId, logType, content, 0)
+}
+
+// RecordQuotaLog 记录日志并保存额度变动，供账单统计调整项
+func RecordQuotaLog(userId int, logType int, content string, quota int) {
 	if logType == LogTypeConsume && !common.LogConsumeEnabled {
 		return
 	}
@@ -91,6 +99,7 @@ func RecordLog(userId int, logType int, content string) {
 		CreatedAt: common.GetTimestamp(),
 		Type:      logType,
 		Content:   content,
+		Quota:     quota,
 	}
 	err := LOG_DB.Create(log).Error
 	if err != nil {
@@ -98,6 +107,24 @@ func RecordLog(userId int, logType int, content string) {
 	}
 }
 
+// RecordNetworkRejectLog 记录因 IP 限制被拒绝的令牌请求，始终保存来源 IP 便于排查
+func RecordNetworkRejectLog(userId int, tokenId int, tokenName string, ip string, content string) {
+	username, _ := GetUsernameById(userId, false)
+	log := &Log{
+		UserId:    userId,
+		Username:  username,
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeError,
+		Content:   content,
+		TokenName: tokenName,
+		TokenId:   tokenId,
+		Ip:        ip,
+	}
+	if err := saveRequestLog(log); err != nil {
+		common.SysLog("failed to record log: " + err.Error())
+	}
+}
+
 func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string, tokenName string, content string, tokenId int, useTimeSeconds int,
 	isStream bool, group string, other map[string]interface{}) {
 	logger.LogInfo(c, fmt.Sprintf("record error log: userId=%d, channelId=%d, modelName=%s, tokenName=%s, content=%s", userId, channelId, modelName, tokenName, content))
@@ -127,6 +154,7 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 		UseTime:          useTimeSeconds,
 		IsStream:         isStream,
 		Group:            group,
+		Project:          common.GetContextKeyString(c, constant.ContextKeyProject),
 		Ip: func() string {
 			if needRecordIp {
 				return c.ClientIP()
@@ -136,7 +164,7 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 		RequestId: requestId,
 		Other:     otherStr,
 	}
-	err := LOG_DB.Create(log).Error
+	err := saveRequestLog(log)
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
 	}
@@ -158,6 +186,15 @@ type RecordConsumeLogParams struct {
 }
 
 func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams) {
+	// 累计本次请求实际消耗的 token 与额度，供 TPM 限流、计费后转换器和用量事件在请求结束后使用
+	if c != nil {
+		consumed := common.GetContextKeyInt(c, constant.ContextKeyConsumedTokens)
+		common.SetContextKey(c, constant.ContextKeyConsumedTokens, consumed+params.PromptTokens+params.CompletionTokens)
+		common.SetContextKey(c, constant.ContextKeyConsumedQuota, common.GetContextKeyInt(c, constant.ContextKeyConsumedQuota)+params.Quota)
+		common.SetContextKey(c, constant.ContextKeyConsumedPrompt, common.GetContextKeyInt(c, constant.ContextKeyConsumedPrompt)+params.PromptTokens)
+		common.SetContextKey(c, constant.ContextKeyConsumedOutput, common.GetContextKeyInt(c, constant.ContextKeyConsumedOutput)+params.CompletionTokens)
+	}
+	metrics.AddConsumption(params.ModelName, params.Group, params.Quota, params.PromptTokens, params.CompletionTokens)
 	if !common.LogConsumeEnabled {
 		return
 	}
@@ -188,6 +225,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		UseTime:          params.UseTimeSeconds,
 		IsStream:         params.IsStream,
 		Group:            params.Group,
+		Project:          common.GetContextKeyString(c, constant.ContextKeyProject),
 		Ip: func() string {
 			if needRecordIp {
 				return c.ClientIP()
@@ -197,7 +235,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		RequestId: requestId,
 		Other:     otherStr,
 	}
-	err := LOG_DB.Create(log).Error
+	err := saveRequestLog(log)
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
 	}
@@ -209,11 +247,19 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 }
 
 func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, group string, requestId string) (logs []*Log, total int64, err error) {
+	if clickHouseServesLogs(logType) {
+		logs, total, err = getClickHouseLogs(clickHouseLogFilter{Type: logType, Start: startTimestamp, End: endTimestamp, ModelName: modelName,
+			Username: username, TokenName: tokenName, Channel: channel, Group: group, RequestId: requestId}, startIdx, num)
+		if err != nil {
+			return nil, 0, err
+		}
+		return logs, total, fillLogChannelNames(logs)
+	}
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
-		tx = LOG_DB
+		tx = readLogDB()
 	} else {
-		tx = LOG_DB.Where("logs.type = ?", logType)
+		tx = readLogDB().Where("logs.type = ?", logType)
 	}
 
 	if modelName != "" {
@@ -248,7 +294,10 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 	if err != nil {
 		return nil, 0, err
 	}
+	return logs, total, fillLogChannelNames(logs)
+}
 
+func fillLogChannelNames(logs []*Log) error {
 	channelIds := types.NewSet[int]()
 	for _, log := range logs {
 		if log.ChannelId != 0 {
@@ -261,8 +310,8 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 			Id   int    `gorm:"column:id"`
 			Name string `gorm:"column:name"`
 		}
-		if err = DB.Table("channels").Select("id, name").Where("id IN ?", channelIds.Items()).Find(&channels).Error; err != nil {
-			return logs, total, err
+		if err := readDB().Table("channels").Select("id, name").Where("id IN ?", channelIds.Items()).Find(&channels).Error; err != nil {
+			return err
 		}
 		channelMap := make(map[int]string, len(channels))
 		for _, channel := range channels {
@@ -272,16 +321,24 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 			logs[i].ChannelName = channelMap[logs[i].ChannelId]
 		}
 	}
-
-	return logs, total, err
+	return nil
 }
 
 func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, group string, requestId string) (logs []*Log, total int64, err error) {
+	if clickHouseServesLogs(logType) {
+		logs, total, err = getClickHouseLogs(clickHouseLogFilter{UserId: userId, Type: logType, Start: startTimestamp, End: endTimestamp,
+			ModelName: modelName, TokenName: tokenName, Group: group, RequestId: requestId}, startIdx, num)
+		if err != nil {
+			return nil, 0, err
+		}
+		formatUserLogs(logs)
+		return logs, total, nil
+	}
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
-		tx = LOG_DB.Where("logs.user_id = ?", userId)
+		tx = readLogDB().Where("logs.user_id = ?", userId)
 	} else {
-		tx = LOG_DB.Where("logs.user_id = ? and logs.type = ?", userId, logType)
+		tx = readLogDB().Where("logs.user_id = ? and logs.type = ?", userId, logType)
 	}
 
 	if modelName != "" {
@@ -316,12 +373,12 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 }
 
 func SearchAllLogs(keyword string) (logs []*Log, err error) {
-	err = LOG_DB.Where("type = ? or content LIKE ?", keyword, keyword+"%").Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
+	err = readLogDB().Where("type = ? or content LIKE ?", keyword, keyword+"%").Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
 	return logs, err
 }
 
 func SearchUserLogs(userId int, keyword string) (logs []*Log, err error) {
-	err = LOG_DB.Where("user_id = ? and type = ?", userId, keyword).Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
+	err = readLogDB().Where("user_id = ? and type = ?", userId, keyword).Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
 	formatUserLogs(logs)
 	return logs, err
 }
@@ -333,10 +390,19 @@ type Stat struct {
 }
 
 func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, group string) (stat Stat) {
-	tx := LOG_DB.Table("logs").Select("sum(quota) quota")
+	if clickHouseClient != nil {
+		stat, err := sumClickHouseUsedQuota(clickHouseLogFilter{Start: startTimestamp, End: endTimestamp, ModelName: modelName,
+			Username: username, TokenName: tokenName, Channel: channel, Group: group})
+		if err != nil {
+			common.SysError("failed to query ClickHouse log stat: " + err.Error())
+		}
+		return stat
+	}
+	db := readLogDB()
+	tx := db.Table("logs").Select("sum(quota) quota")
 
 	// 为rpm和tpm创建单独的查询
-	rpmTpmQuery := LOG_DB.Table("logs").Select("count(*) rpm, sum(prompt_tokens) + sum(completion_tokens) tpm")
+	rpmTpmQuery := db.Table("logs").Select("count(*) rpm, sum(prompt_tokens) + sum(completion_tokens) tpm")
 
 	if username != "" {
 		tx = tx.Where("username = ?", username)
@@ -379,7 +445,7 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 }
 
 func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string) (token int) {
-	tx := LOG_DB.Table("logs").Select("ifnull(sum(prompt_tokens),0) + ifnull(sum(completion_tokens),0)")
+	tx := readLogDB().Table("logs").Select("ifnull(sum(prompt_tokens),0) + ifnull(sum(completion_tokens),0)")
 	if username != "" {
 		tx = tx.Where("username = ?", username)
 	}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"gorm.io/gorm/clause"
+)
+
+// LogArchive 已导出到对象存储的日志归档文件，每个文件包含一段连续 id 的日志
+type LogArchive struct {
+	Id        int    `json:"id"`
+	Storage   string `json:"storage" gorm:"size:16"`
+	ObjectKey string `json:"object_key" gorm:"size:255;uniqueIndex"`
+	StartId   int    `json:"start_id"`
+	EndId     int    `json:"end_id" gorm:"index"`
+	StartTime int64  `json:"start_time" gorm:"bigint;index"`
+	EndTime   int64  `json:"end_time" gorm:"bigint;index"`
+	RowCount  int    `json:"row_count"`
+	Size      int64  `json:"size"`
+	Purged    bool   `json:"purged"` // 日志是否已从数据库删除
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+func CreateLogArchive(archive *LogArchive) error {
+	return LOG_DB.Create(archive).Error
+}
+
+// GetLastArchivedLogId 返回已归档的最大日志 id，没有归档时返回 0
+func GetLastArchivedLogId() (int, error) {
+	var endId int
+	err := LOG_DB.Model(&LogArchive{}).Select("COALESCE(MAX(end_id), 0)").Scan(&endId).Error
+	return endId, err
+}
+
+func GetLatestLogArchive() (*LogArchive, error) {
+	var archive LogArchive
+	err := LOG_DB.Order("id desc").First(&archive).Error
+	return &archive, err
+}
+
+func GetLogArchiveById(id int) (*LogArchive, error) {
+	var archive LogArchive
+	err := LOG_DB.First(&archive, id).Error
+	return &archive, err
+}
+
+// GetLogArchives 返回与时间范围有交集的归档，时间为 0 表示不限
+func GetLogArchives(startTimestamp int64, endTimestamp int64, startIdx int, num int) (archives []*LogArchive, total int64, err error) {
+	tx := LOG_DB.Model(&LogArchive{})
+	if startTimestamp != 0 {
+		tx = tx.Where("end_time >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("start_time <= ?", endTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if num > 0 {
+		tx = tx.Limit(num).Offset(startIdx)
+	}
+	err = tx.Order("start_id asc").Find(&archives).Error
+	return archives, total, err
+}
+
+// GetExpiredLogArchives 返回日志时间早于 timestamp 的归档
+func GetExpiredLogArchives(timestamp int64, limit int) (archives []*LogArchive, err error) {
+	err = LOG_DB.Where("end_time < ?", timestamp).Order("id asc").Limit(limit).Find(&archives).Error
+	return archives, err
+}
+
+func DeleteLogArchive(id int) error {
+	return LOG_DB.Delete(&LogArchive{}, id).Error
+}
+
+// GetLogsForArchive 按 id 顺序返回 id 大于 afterId 且早于 beforeTimestamp 的日志
+func GetLogsForArchive(afterId int, beforeTimestamp int64, limit int) (logs []*Log, err error) {
+	err = LOG_DB.Where("id > ? AND created_at < ?", afterId, beforeTimestamp).Order("id asc").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// DeleteArchivedLogs 删除已归档的日志，条件与 GetLogsForArchive 一致，保证只删除写入归档的记录
+func DeleteArchivedLogs(startId int, endId int, beforeTimestamp int64) (int64, error) {
+	result := LOG_DB.Where("id >= ? AND id <= ? AND created_at < ?", startId, endId, beforeTimestamp).Delete(&Log{})
+	return result.RowsAffected, result.Error
+}
+
+func UpdateLogArchivePurged(id int, purged bool) error {
+	return LOG_DB.Model(&LogArchive{}).Where("id = ?", id).Update("purged", purged).Error
+}
+
+// RestoreLogs 把归档中的日志写回数据库，已存在的 id 跳过
+func RestoreLogs(logs []*Log) (int64, error) {
+	var total int64
+	for i := 0; i < len(logs); i += 500 {
+		end := i + 500
+		if end > len(logs) {
+			end = len(logs)
+		}
+		result := LOG_DB.Clauses(clause.OnConflict{DoNothing: true}).Create(logs[i:end])
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+	}
+	return total, nil
+}
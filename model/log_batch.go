@@ -0,0 +1,156 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 消费与错误日志先进入有界队列，由后台按批写入数据库，请求路径上不再等待数据库写入。
+// 队列已满时改为同步写入，不丢弃日志；退出前由 FlushLogBatch 写入队列中剩余的日志
+
+var (
+	logBatchQueue   chan *Log
+	logBatchFlushes = make(chan chan struct{})
+	logBatchWritten atomic.Int64
+	logBatchSync    atomic.Int64
+	logBatchFailed  atomic.Int64
+)
+
+// InitLogBatchWriter 需在日志数据库与 ClickHouse 初始化之后调用，未开启 LOG_BATCH_ENABLED 时保持逐条同步写入
+func InitLogBatchWriter() {
+	if !common.GetEnvOrDefaultBool("LOG_BATCH_ENABLED", false) {
+		return
+	}
+	logBatchQueue = make(chan *Log, max(common.GetEnvOrDefault("LOG_BATCH_QUEUE_SIZE", 10000), 1))
+	batchSize := max(common.GetEnvOrDefault("LOG_BATCH_SIZE", 200), 1)
+	interval := time.Duration(max(common.GetEnvOrDefault("LOG_BATCH_FLUSH_INTERVAL", 1), 1)) * time.Second
+	gopool.Go(func() {
+		runLogBatchWriter(batchSize, interval)
+	})
+	common.SysLog(fmt.Sprintf("batched log writer enabled, batch_size=%d, interval=%s", batchSize, interval))
+}
+
+// enqueueRequestLog 队列已满或未启用批量写入时返回 false
+func enqueueRequestLog(log *Log) bool {
+	if logBatchQueue == nil {
+		return false
+	}
+	select {
+	case logBatchQueue <- log:
+		return true
+	default:
+		logBatchSync.Add(1)
+		return false
+	}
+}
+
+func runLogBatchWriter(batchSize int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	batch := make([]*Log, 0, batchSize)
+	for {
+		select {
+		case log := <-logBatchQueue:
+			batch = append(batch, log)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case done := <-logBatchFlushes:
+			drainLogBatchQueue(batch, batchSize)
+			batch = make([]*Log, 0, batchSize)
+			close(done)
+			continue
+		}
+		writeLogBatch(batch)
+		batch = make([]*Log, 0, batchSize)
+	}
+}
+
+// drainLogBatchQueue 写入当前批次与队列中剩余的全部日志
+func drainLogBatchQueue(batch []*Log, batchSize int) {
+	for {
+		select {
+		case log := <-logBatchQueue:
+			batch = append(batch, log)
+			if len(batch) < batchSize {
+				continue
+			}
+		default:
+		}
+		if len(batch) == 0 {
+			return
+		}
+		writeLogBatch(batch)
+		if len(batch) < batchSize {
+			return
+		}
+		batch = make([]*Log, 0, batchSize)
+	}
+}
+
+func writeLogBatch(batch []*Log) {
+	if err := LOG_DB.CreateInBatches(batch, len(batch)).Error; err != nil {
+		// 整批失败时逐条写入，避免个别异常日志导致整批丢失
+		common.SysError(fmt.Sprintf("failed to write %d logs in batch, retrying one by one: %s", len(batch), err.Error()))
+		for _, log := range batch {
+			log.Id = 0
+			if err = LOG_DB.Create(log).Error; err != nil {
+				logBatchFailed.Add(1)
+				common.SysError("failed to record log: " + err.Error())
+				continue
+			}
+			logBatchWritten.Add(1)
+			enqueueClickHouseLog(log)
+		}
+		return
+	}
+	logBatchWritten.Add(int64(len(batch)))
+	for _, log := range batch {
+		enqueueClickHouseLog(log)
+	}
+}
+
+// FlushLogBatch 退出前写入队列中的日志，ctx 结束时不再等待
+func FlushLogBatch(ctx context.Context) {
+	if logBatchQueue == nil {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case logBatchFlushes <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+type LogBatchStats struct {
+	Enabled bool  `json:"enabled"`
+	Queued  int   `json:"queued"`
+	Written int64 `json:"written"`
+	Sync    int64 `json:"sync"`   // 队列已满时同步写入的日志数
+	Failed  int64 `json:"failed"` // 逐条重试后仍写入失败的日志数
+}
+
+func GetLogBatchStats() LogBatchStats {
+	return LogBatchStats{
+		Enabled: logBatchQueue != nil,
+		Queued:  len(logBatchQueue),
+		Written: logBatchWritten.Load(),
+		Sync:    logBatchSync.Load(),
+		Failed:  logBatchFailed.Load(),
+	}
+}
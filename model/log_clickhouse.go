@@ -0,0 +1,554 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/clickhouse"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 配置 CLICKHOUSE_DSN 后，请求日志（消费与错误）批量异步写入 ClickHouse 的 logs 表，
+// 用量分析与日志额度统计改为查询 ClickHouse。开启 CLICKHOUSE_LOG_ONLY 后请求日志不再写入数据库，
+// 日志列表中的请求日志也从 ClickHouse 读取，其余类型的日志与业务数据仍保存在数据库中
+
+const clickHouseLogTable = "logs"
+
+var (
+	clickHouseClient  *clickhouse.Client
+	clickHouseLogOnly bool
+	clickHouseQueue   chan *clickHouseLogRow
+	clickHouseFlushes = make(chan chan struct{})
+	clickHouseLogSeq  atomic.Int64
+	clickHouseWritten atomic.Int64
+	clickHouseDropped atomic.Int64
+	clickHouseFailed  atomic.Int64
+)
+
+type clickHouseLogRow struct {
+	Id               int    `json:"id"`
+	UserId           int    `json:"user_id"`
+	CreatedAt        int64  `json:"created_at"`
+	Type             int    `json:"type"`
+	Content          string `json:"content"`
+	Username         string `json:"username"`
+	TokenName        string `json:"token_name"`
+	ModelName        string `json:"model_name"`
+	Quota            int    `json:"quota"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	UseTime          int    `json:"use_time"`
+	IsStream         bool   `json:"is_stream"`
+	ChannelId        int    `json:"channel_id"`
+	TokenId          int    `json:"token_id"`
+	Group            string `json:"group"`
+	Project          string `json:"project"`
+	Ip               string `json:"ip"`
+	RequestId        string `json:"request_id"`
+	Other            string `json:"other"`
+}
+
+func newClickHouseLogRow(log *Log) *clickHouseLogRow {
+	return &clickHouseLogRow{
+		Id:               log.Id,
+		UserId:           log.UserId,
+		CreatedAt:        log.CreatedAt,
+		Type:             log.Type,
+		Content:          log.Content,
+		Username:         log.Username,
+		TokenName:        log.TokenName,
+		ModelName:        log.ModelName,
+		Quota:            log.Quota,
+		PromptTokens:     log.PromptTokens,
+		CompletionTokens: log.CompletionTokens,
+		UseTime:          log.UseTime,
+		IsStream:         log.IsStream,
+		ChannelId:        log.ChannelId,
+		TokenId:          log.TokenId,
+		Group:            log.Group,
+		Project:          log.Project,
+		Ip:               log.Ip,
+		RequestId:        log.RequestId,
+		Other:            log.Other,
+	}
+}
+
+func (row *clickHouseLogRow) toLog() *Log {
+	return &Log{
+		Id:               row.Id,
+		UserId:           row.UserId,
+		CreatedAt:        row.CreatedAt,
+		Type:             row.Type,
+		Content:          row.Content,
+		Username:         row.Username,
+		TokenName:        row.TokenName,
+		ModelName:        row.ModelName,
+		Quota:            row.Quota,
+		PromptTokens:     row.PromptTokens,
+		CompletionTokens: row.CompletionTokens,
+		UseTime:          row.UseTime,
+		IsStream:         row.IsStream,
+		ChannelId:        row.ChannelId,
+		TokenId:          row.TokenId,
+		Group:            row.Group,
+		Project:          row.Project,
+		Ip:               row.Ip,
+		RequestId:        row.RequestId,
+		Other:            row.Other,
+	}
+}
+
+func clickHouseLogSchema() string {
+	ttl := ""
+	if days := common.GetEnvOrDefault("CLICKHOUSE_LOG_TTL_DAYS", 0); days > 0 {
+		ttl = fmt.Sprintf("\nTTL toDateTime(created_at) + INTERVAL %d DAY", days)
+	}
+	return `CREATE TABLE IF NOT EXISTS ` + clickHouseLogTable + ` (
+	id Int64,
+	user_id Int64,
+	created_at Int64,
+	type Int32,
+	content String,
+	username String,
+	token_name String,
+	model_name LowCardinality(String),
+	quota Int64,
+	prompt_tokens Int64,
+	completion_tokens Int64,
+	use_time Int64,
+	is_stream Bool,
+	channel_id Int64,
+	token_id Int64,
+	` + "`group`" + ` LowCardinality(String),
+	project String,
+	ip String,
+	request_id String,
+	other String
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(toDateTime(created_at))
+ORDER BY (type, created_at, user_id)` + ttl
+}
+
+// InitClickHouse 未配置 CLICKHOUSE_DSN 时不做任何事；配置后连接失败将阻止启动
+func InitClickHouse() error {
+	dsn := common.GetEnvOrDefaultString("CLICKHOUSE_DSN", "")
+	if dsn == "" {
+		return nil
+	}
+	client, err := clickhouse.NewClient(clickhouse.Config{DSN: dsn})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err = client.Ping(ctx); err != nil {
+		return err
+	}
+	if err = client.Exec(ctx, clickHouseLogSchema(), nil); err != nil {
+		return fmt.Errorf("create clickhouse log table: %w", err)
+	}
+	clickHouseClient = client
+	clickHouseLogOnly = common.GetEnvOrDefaultBool("CLICKHOUSE_LOG_ONLY", false)
+	clickHouseQueue = make(chan *clickHouseLogRow, max(common.GetEnvOrDefault("CLICKHOUSE_QUEUE_SIZE", 100000), 1))
+	batchSize := max(common.GetEnvOrDefault("CLICKHOUSE_BATCH_SIZE", 1000), 1)
+	interval := time.Duration(max(common.GetEnvOrDefault("CLICKHOUSE_FLUSH_INTERVAL", 2), 1)) * time.Second
+	gopool.Go(func() {
+		runClickHouseLogWriter(batchSize, interval)
+	})
+	common.SysLog(fmt.Sprintf("ClickHouse log storage enabled, database=%s, log_only=%t", client.Database(), clickHouseLogOnly))
+	return nil
+}
+
+func ClickHouseEnabled() bool {
+	return clickHouseClient != nil
+}
+
+type ClickHouseLogStats struct {
+	Enabled bool  `json:"enabled"`
+	LogOnly bool  `json:"log_only"`
+	Queued  int   `json:"queued"`
+	Written int64 `json:"written"`
+	Dropped int64 `json:"dropped"` // 队列已满被丢弃的日志数
+	Failed  int64 `json:"failed"`  // 重试后仍写入失败的日志数
+}
+
+func GetClickHouseLogStats() ClickHouseLogStats {
+	return ClickHouseLogStats{
+		Enabled: clickHouseClient != nil,
+		LogOnly: clickHouseLogOnly,
+		Queued:  len(clickHouseQueue),
+		Written: clickHouseWritten.Load(),
+		Dropped: clickHouseDropped.Load(),
+		Failed:  clickHouseFailed.Load(),
+	}
+}
+
+// nextClickHouseLogId 仅写入 ClickHouse 时生成日志 ID：毫秒时间戳乘 1000 加序号，按时间递增
+func nextClickHouseLogId() int {
+	return int(time.Now().UnixMilli()*1000 + clickHouseLogSeq.Add(1)%1000)
+}
+
+// saveRequestLog 保存消费与错误日志，启用批量写入时写入数据库后再投递到 ClickHouse 写入队列
+func saveRequestLog(log *Log) error {
+	if clickHouseClient != nil && clickHouseLogOnly {
+		log.Id = nextClickHouseLogId()
+		enqueueClickHouseLog(log)
+		return nil
+	}
+	if enqueueRequestLog(log) {
+		return nil
+	}
+	err := LOG_DB.Create(log).Error
+	enqueueClickHouseLog(log)
+	return err
+}
+
+// enqueueClickHouseLog 启用 ClickHouse 时投递到写入队列，队列已满时丢弃
+func enqueueClickHouseLog(log *Log) {
+	if clickHouseClient == nil {
+		return
+	}
+	select {
+	case clickHouseQueue <- newClickHouseLogRow(log):
+	default:
+		clickHouseDropped.Add(1)
+	}
+}
+
+func runClickHouseLogWriter(batchSize int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	batch := make([]any, 0, batchSize)
+	for {
+		select {
+		case row := <-clickHouseQueue:
+			batch = append(batch, row)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case done := <-clickHouseFlushes:
+			drainClickHouseQueue(batch, batchSize)
+			batch = make([]any, 0, batchSize)
+			close(done)
+			continue
+		}
+		flushClickHouseLogs(batch)
+		batch = make([]any, 0, batchSize)
+	}
+}
+
+// drainClickHouseQueue 写入当前批次与队列中剩余的全部日志
+func drainClickHouseQueue(batch []any, batchSize int) {
+	for {
+		select {
+		case row := <-clickHouseQueue:
+			batch = append(batch, row)
+			if len(batch) < batchSize {
+				continue
+			}
+		default:
+		}
+		if len(batch) == 0 {
+			return
+		}
+		flushClickHouseLogs(batch)
+		if len(batch) < batchSize {
+			return
+		}
+		batch = make([]any, 0, batchSize)
+	}
+}
+
+// FlushClickHouseLogs 退出前写入队列中的日志，ctx 结束时不再等待
+func FlushClickHouseLogs(ctx context.Context) {
+	if clickHouseClient == nil {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case clickHouseFlushes <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func flushClickHouseLogs(batch []any) {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = clickHouseClient.Insert(ctx, clickHouseLogTable, batch)
+		cancel()
+		if err == nil {
+			clickHouseWritten.Add(int64(len(batch)))
+			return
+		}
+	}
+	clickHouseFailed.Add(int64(len(batch)))
+	common.SysError(fmt.Sprintf("failed to write %d logs to ClickHouse: %s", len(batch), err.Error()))
+}
+
+// clickHouseServesLogs 仅写入 ClickHouse 时，请求日志与全部类型的列表从 ClickHouse 读取
+func clickHouseServesLogs(logType int) bool {
+	return clickHouseClient != nil && clickHouseLogOnly &&
+		(logType == LogTypeUnknown || logType == LogTypeConsume || logType == LogTypeError)
+}
+
+// clickHouseConditions 拼接 WHERE 条件，参数通过 {name:Type} 占位符传递
+type clickHouseConditions struct {
+	conds  []string
+	params map[string]any
+}
+
+func (q *clickHouseConditions) add(cond string, name string, value any) {
+	q.conds = append(q.conds, cond)
+	q.params[name] = value
+}
+
+func (q *clickHouseConditions) where() string {
+	if len(q.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+type clickHouseLogFilter struct {
+	UserId    int
+	Type      int
+	Start     int64
+	End       int64
+	ModelName string
+	Username  string
+	TokenName string
+	Channel   int
+	Group     string
+	RequestId string
+}
+
+func (f clickHouseLogFilter) conditions() *clickHouseConditions {
+	q := &clickHouseConditions{params: map[string]any{}}
+	if f.UserId != 0 {
+		q.add("user_id = {user_id:Int64}", "user_id", f.UserId)
+	}
+	if f.Type != LogTypeUnknown {
+		q.add("type = {type:Int32}", "type", f.Type)
+	}
+	if f.Start != 0 {
+		q.add("created_at >= {start:Int64}", "start", f.Start)
+	}
+	if f.End != 0 {
+		q.add("created_at <= {end:Int64}", "end", f.End)
+	}
+	if f.ModelName != "" {
+		q.add("model_name LIKE {model_name:String}", "model_name", f.ModelName)
+	}
+	if f.Username != "" {
+		q.add("username = {username:String}", "username", f.Username)
+	}
+	if f.TokenName != "" {
+		q.add("token_name = {token_name:String}", "token_name", f.TokenName)
+	}
+	if f.Channel != 0 {
+		q.add("channel_id = {channel:Int64}", "channel", f.Channel)
+	}
+	if f.Group != "" {
+		q.add("`group` = {group:String}", "group", f.Group)
+	}
+	if f.RequestId != "" {
+		q.add("request_id = {request_id:String}", "request_id", f.RequestId)
+	}
+	return q
+}
+
+func getClickHouseLogs(filter clickHouseLogFilter, startIdx int, num int) (logs []*Log, total int64, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	q := filter.conditions()
+	err = clickHouseClient.Query(ctx, "SELECT count() AS total FROM "+clickHouseLogTable+q.where(), q.params, func(row []byte) error {
+		var result struct {
+			Total int64 `json:"total"`
+		}
+		err := common.Unmarshal(row, &result)
+		total = result.Total
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	query := fmt.Sprintf("SELECT * FROM %s%s ORDER BY created_at DESC, id DESC LIMIT %d OFFSET %d", clickHouseLogTable, q.where(), num, startIdx)
+	err = clickHouseClient.Query(ctx, query, q.params, func(row []byte) error {
+		var result clickHouseLogRow
+		if err := common.Unmarshal(row, &result); err != nil {
+			return err
+		}
+		logs = append(logs, result.toLog())
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+func sumClickHouseUsedQuota(filter clickHouseLogFilter) (stat Stat, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	filter.Type = LogTypeConsume
+	start, end := filter.Start, filter.End
+	filter.Start, filter.End = 0, 0
+	q := filter.conditions()
+	// rpm 与 tpm 只统计最近 60 秒，不受时间范围限制
+	q.params["recent"] = time.Now().Add(-60 * time.Second).Unix()
+	period := "1"
+	if start != 0 || end != 0 {
+		q.params["start"], q.params["end"] = start, end
+		period = "created_at >= {start:Int64}"
+		if end != 0 {
+			period += " AND created_at <= {end:Int64}"
+		}
+		q.conds = append(q.conds, "("+period+" OR created_at >= {recent:Int64})")
+	}
+	query := fmt.Sprintf(`SELECT
+	sumIf(quota, %s) AS period_quota,
+	countIf(created_at >= {recent:Int64}) AS recent_requests,
+	sumIf(prompt_tokens + completion_tokens, created_at >= {recent:Int64}) AS recent_tokens
+FROM %s%s`, period, clickHouseLogTable, q.where())
+	err = clickHouseClient.Query(ctx, query, q.params, func(row []byte) error {
+		var result struct {
+			Quota    int `json:"period_quota"`
+			Requests int `json:"recent_requests"`
+			Tokens   int `json:"recent_tokens"`
+		}
+		err := common.Unmarshal(row, &result)
+		stat = Stat{Quota: result.Quota, Rpm: result.Requests, Tpm: result.Tokens}
+		return err
+	})
+	return stat, err
+}
+
+// queryClickHouseUsageStats 直接从原始日志按小时或天聚合，与汇总表的结果格式一致；
+// 天的边界按本地时区当前的偏移计算
+func queryClickHouseUsageStats(filter UsageStatFilter) ([]*UsageStat, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	q := &clickHouseConditions{
+		conds:  []string{fmt.Sprintf("type IN (%d, %d)", LogTypeConsume, LogTypeError)},
+		params: map[string]any{"bucket_size": 3600, "bucket_offset": 0},
+	}
+	if filter.Period == UsageStatPeriodDay {
+		_, offset := time.Now().Zone()
+		q.params["bucket_size"] = 86400
+		q.params["bucket_offset"] = offset
+	}
+	if filter.Start > 0 {
+		q.add("created_at >= {start:Int64}", "start", filter.Start)
+	}
+	if filter.End > 0 {
+		q.add("created_at < {end:Int64}", "end", filter.End)
+	}
+	if filter.UserId != 0 {
+		q.add("user_id = {user_id:Int64}", "user_id", filter.UserId)
+	}
+	if filter.TokenId != 0 {
+		q.add("token_id = {token_id:Int64}", "token_id", filter.TokenId)
+	}
+	if filter.ChannelId != 0 {
+		q.add("channel_id = {channel_id:Int64}", "channel_id", filter.ChannelId)
+	}
+	if filter.ModelName != "" {
+		q.add("model_name = {model_name:String}", "model_name", filter.ModelName)
+	}
+	if filter.Project != "" {
+		q.add("project = {project:String}", "project", filter.Project)
+	}
+	bounds := make([]string, len(UsageLatencyBounds))
+	for i, bound := range UsageLatencyBounds {
+		bounds[i] = fmt.Sprint(bound)
+	}
+	query := fmt.Sprintf(`SELECT
+	intDiv(created_at + {bucket_offset:Int64}, {bucket_size:Int64}) * {bucket_size:Int64} - {bucket_offset:Int64} AS bucket_start,
+	user_id, token_id, channel_id, model_name, project,
+	arrayFirstIndex(b -> use_time <= b, [%s]) AS latency_bucket,
+	count() AS total_requests,
+	countIf(type = %d) AS total_errors,
+	sum(prompt_tokens) AS total_prompt_tokens,
+	sum(completion_tokens) AS total_completion_tokens,
+	sum(quota) AS total_quota,
+	sum(use_time) AS total_use_time
+FROM %s%s
+GROUP BY bucket_start, user_id, token_id, channel_id, model_name, project, latency_bucket
+ORDER BY bucket_start`, strings.Join(bounds, ", "), LogTypeError, clickHouseLogTable, q.where())
+
+	var list []*UsageStat
+	stats := make(map[string]*UsageStat)
+	err := clickHouseClient.Query(ctx, query, q.params, func(row []byte) error {
+		var result struct {
+			BucketStart      int64  `json:"bucket_start"`
+			UserId           int    `json:"user_id"`
+			TokenId          int    `json:"token_id"`
+			ChannelId        int    `json:"channel_id"`
+			ModelName        string `json:"model_name"`
+			Project          string `json:"project"`
+			LatencyBucket    int    `json:"latency_bucket"`
+			Requests         int    `json:"total_requests"`
+			Errors           int    `json:"total_errors"`
+			PromptTokens     int    `json:"total_prompt_tokens"`
+			CompletionTokens int    `json:"total_completion_tokens"`
+			Quota            int    `json:"total_quota"`
+			TotalUseTime     int64  `json:"total_use_time"`
+		}
+		if err := common.Unmarshal(row, &result); err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%d|%s", result.BucketStart, usageStatKey(result.UserId, result.TokenId, result.ChannelId, result.ModelName, result.Project))
+		stat, ok := stats[key]
+		if !ok {
+			stat = &UsageStat{
+				Period:      filter.Period,
+				BucketStart: result.BucketStart,
+				UserId:      result.UserId,
+				TokenId:     result.TokenId,
+				ChannelId:   result.ChannelId,
+				ModelName:   result.ModelName,
+				Project:     result.Project,
+			}
+			stats[key] = stat
+			list = append(list, stat)
+		}
+		stat.Requests += result.Requests
+		stat.Errors += result.Errors
+		stat.PromptTokens += result.PromptTokens
+		stat.CompletionTokens += result.CompletionTokens
+		stat.Quota += result.Quota
+		stat.TotalUseTime += result.TotalUseTime
+		// arrayFirstIndex 从 1 开始，超出全部上限时为 0
+		bucket := len(UsageLatencyBounds)
+		if result.LatencyBucket > 0 {
+			bucket = result.LatencyBucket - 1
+		}
+		stat.Latency()[bucket] += result.Requests
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, stat := range list {
+		stat.encodeLatency()
+	}
+	return list, nil
+}
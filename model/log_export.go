@@ -0,0 +1,173 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	LogExportStatusPending    = "pending"
+	LogExportStatusProcessing = "processing"
+	LogExportStatusCompleted  = "completed"
+	LogExportStatusFailed     = "failed"
+	LogExportStatusExpired    = "expired"
+)
+
+const (
+	LogExportFormatCSV   = "csv"
+	LogExportFormatJSONL = "jsonl"
+)
+
+// LogExport 用户自助导出使用日志的异步任务，生成的文件保存在存储后端中
+type LogExport struct {
+	Id             int    `json:"-"`
+	ExportId       string `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId         int    `json:"-" gorm:"index"`
+	Format         string `json:"format" gorm:"type:varchar(16)"`
+	Status         string `json:"status" gorm:"type:varchar(20);index"`
+	LogType        int    `json:"type"`
+	StartTimestamp int64  `json:"start_timestamp" gorm:"bigint"`
+	EndTimestamp   int64  `json:"end_timestamp" gorm:"bigint"`
+	ModelName      string `json:"model_name" gorm:"type:varchar(128)"`
+	TokenName      string `json:"token_name" gorm:"type:varchar(128)"`
+	Rows           int    `json:"rows"`
+	Bytes          int64  `json:"bytes"`
+	Truncated      bool   `json:"truncated"` // 达到行数或大小上限，只导出了部分日志
+	Error          string `json:"error,omitempty" gorm:"type:text"`
+	Storage        string `json:"-" gorm:"type:varchar(16)"`
+	StorageKey     string `json:"-" gorm:"type:varchar(255)"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	CompletedAt    int64  `json:"completed_at" gorm:"bigint"`
+	ExpiresAt      int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (e *LogExport) Filename() string {
+	return e.ExportId + "." + e.Format
+}
+
+func CreateLogExport(export *LogExport) error {
+	return DB.Create(export).Error
+}
+
+func GetUserLogExport(userId int, exportId string) (*LogExport, error) {
+	export := &LogExport{}
+	err := DB.Where("user_id = ? AND export_id = ?", userId, exportId).First(export).Error
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func GetLogExportByExportId(exportId string) (*LogExport, error) {
+	export := &LogExport{}
+	err := DB.Where("export_id = ?", exportId).First(export).Error
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func GetUserLogExports(userId int, limit int) ([]*LogExport, error) {
+	var exports []*LogExport
+	err := DB.Where("user_id = ?", userId).Order("id desc").Limit(limit).Find(&exports).Error
+	return exports, err
+}
+
+// CountUserActiveLogExports 返回用户排队中与生成中的导出数量
+func CountUserActiveLogExports(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&LogExport{}).
+		Where("user_id = ? AND status IN ?", userId, []string{LogExportStatusPending, LogExportStatusProcessing}).
+		Count(&count).Error
+	return count, err
+}
+
+// UpdateLogExportStatus 仅当任务仍处于 fromStatus 时更新，返回是否更新成功，避免多个实例重复处理
+func UpdateLogExportStatus(export *LogExport, fromStatus string) (bool, error) {
+	result := DB.Model(&LogExport{}).Where("id = ? AND status = ?", export.Id, fromStatus).
+		Select("status", "rows", "bytes", "truncated", "error", "storage", "storage_key", "completed_at", "expires_at").
+		Updates(export)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetExpiredLogExports 返回已过期但文件尚未清理的导出
+func GetExpiredLogExports(now int64, limit int) ([]*LogExport, error) {
+	var exports []*LogExport
+	err := DB.Where("status = ? AND expires_at > 0 AND expires_at <= ?", LogExportStatusCompleted, now).
+		Limit(limit).Find(&exports).Error
+	return exports, err
+}
+
+// FailStaleLogExports 把创建早于 before 仍未完成的导出置为失败，通常是生成过程中实例重启所致
+func FailStaleLogExports(before int64, reason string) (int64, error) {
+	result := DB.Model(&LogExport{}).
+		Where("status IN ? AND created_at < ?", []string{LogExportStatusPending, LogExportStatusProcessing}, before).
+		Updates(map[string]any{"status": LogExportStatusFailed, "error": reason, "completed_at": common.GetTimestamp()})
+	return result.RowsAffected, result.Error
+}
+
+// IterateUserLogs 按 id 倒序分批读取用户日志，fn 返回 false 时停止，日志已按用户可见字段格式化
+func IterateUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string,
+	batchSize int, fn func(logs []*Log) (bool, error)) error {
+	if clickHouseServesLogs(logType) {
+		filter := clickHouseLogFilter{UserId: userId, Type: logType, Start: startTimestamp, End: endTimestamp,
+			ModelName: modelName, TokenName: tokenName}
+		for offset := 0; ; offset += batchSize {
+			logs, _, err := getClickHouseLogs(filter, offset, batchSize)
+			if err != nil {
+				return err
+			}
+			if len(logs) == 0 {
+				return nil
+			}
+			formatUserLogs(logs)
+			if next, err := fn(logs); err != nil || !next {
+				return err
+			}
+			if len(logs) < batchSize {
+				return nil
+			}
+		}
+	}
+	lastId := 0
+	for {
+		tx := readLogDB().Where("logs.user_id = ?", userId)
+		if logType != LogTypeUnknown {
+			tx = tx.Where("logs.type = ?", logType)
+		}
+		if modelName != "" {
+			tx = tx.Where("logs.model_name like ?", modelName)
+		}
+		if tokenName != "" {
+			tx = tx.Where("logs.token_name = ?", tokenName)
+		}
+		if startTimestamp != 0 {
+			tx = tx.Where("logs.created_at >= ?", startTimestamp)
+		}
+		if endTimestamp != 0 {
+			tx = tx.Where("logs.created_at <= ?", endTimestamp)
+		}
+		if lastId != 0 {
+			tx = tx.Where("logs.id < ?", lastId)
+		}
+		var logs []*Log
+		if err := tx.Order("logs.id desc").Limit(batchSize).Find(&logs).Error; err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		// formatUserLogs 会改写 id，需先记录游标
+		lastId = logs[len(logs)-1].Id
+		formatUserLogs(logs)
+		if next, err := fn(logs); err != nil || !next {
+			return err
+		}
+		if len(logs) < batchSize {
+			return nil
+		}
+	}
+}
+
+func MarkLogExportExpired(id int) error {
+	return DB.Model(&LogExport{}).Where("id = ?", id).Update("status", LogExportStatusExpired).Error
+}
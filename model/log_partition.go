@@ -0,0 +1,207 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// PostgreSQL 下日志表按 created_at 分月的范围分区。迁移时原表整体作为 MINVALUE 到下月初的历史分区挂载，
+// 不复制数据；之后每月一个分区，另有默认分区兜底
+
+var postgresLogIndexes = []struct {
+	name string
+	def  string
+}{
+	{name: "idx_logs_user_created_at", def: "(user_id, created_at DESC)"},
+	{name: "idx_logs_token_created_at", def: "(token_id, created_at DESC)"},
+	{name: "idx_logs_channel_created_at", def: "(channel_id, created_at DESC)"},
+	{name: "idx_logs_created_at_brin", def: "USING brin (created_at)"},
+}
+
+func createPostgresLogIndexes(db *gorm.DB) error {
+	for _, index := range postgresLogIndexes {
+		if err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON logs %s", index.name, index.def)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropPostgresLogIndexes(db *gorm.DB) error {
+	for _, index := range postgresLogIndexes {
+		if err := db.Exec("DROP INDEX IF EXISTS " + index.name).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logPartitionApplies(db *gorm.DB) bool {
+	return isPostgresDB(db) && common.GetEnvOrDefaultBool("LOG_PARTITION_ENABLED", false)
+}
+
+func isLogTablePartitioned(db *gorm.DB) bool {
+	var count int64
+	db.Raw(`SELECT count(*) FROM pg_partitioned_table pt JOIN pg_class c ON c.oid = pt.partrelid
+		WHERE c.relname = 'logs' AND c.relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = current_schema())`).Scan(&count)
+	return count > 0
+}
+
+type postgresIndex struct {
+	Name      string
+	Def       string
+	IsPrimary bool
+}
+
+func postgresTableIndexes(db *gorm.DB, table string) ([]postgresIndex, error) {
+	var indexes []postgresIndex
+	err := db.Raw(`SELECT i.relname AS name, pg_get_indexdef(i.oid) AS def, ix.indisprimary AS is_primary
+		FROM pg_index ix JOIN pg_class i ON i.oid = ix.indexrelid JOIN pg_class t ON t.oid = ix.indrelid
+		WHERE t.relname = ? AND t.relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = current_schema()) AND (ix.indisprimary OR NOT ix.indisunique)`, table).Scan(&indexes).Error
+	return indexes, err
+}
+
+// swapLogTable 将 logs 改名为 renamed 并把其索引名加上后缀，返回原有的非主键索引定义，
+// 用于在新建的 logs 上以原索引名重建
+func swapLogTable(tx *gorm.DB, renamed string) ([]string, string, error) {
+	indexes, err := postgresTableIndexes(tx, "logs")
+	if err != nil {
+		return nil, "", err
+	}
+	var sequence string
+	if err = tx.Raw("SELECT coalesce(pg_get_serial_sequence('logs', 'id'), '')").Scan(&sequence).Error; err != nil {
+		return nil, "", err
+	}
+	if err = tx.Exec("ALTER TABLE logs RENAME TO " + renamed).Error; err != nil {
+		return nil, "", err
+	}
+	var defs []string
+	for _, index := range indexes {
+		if !index.IsPrimary {
+			defs = append(defs, index.Def)
+		}
+		if err = tx.Exec(fmt.Sprintf(`ALTER INDEX "%s" RENAME TO "%s_%s"`, index.Name, index.Name, renamed)).Error; err != nil {
+			return nil, "", err
+		}
+	}
+	return defs, sequence, nil
+}
+
+func restoreLogIndexes(tx *gorm.DB, defs []string, sequence string) error {
+	for _, def := range defs {
+		if err := tx.Exec(def).Error; err != nil {
+			return err
+		}
+	}
+	if sequence != "" {
+		return tx.Exec("ALTER SEQUENCE " + sequence + " OWNED BY logs.id").Error
+	}
+	return nil
+}
+
+func partitionPostgresLogs(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if isLogTablePartitioned(tx) {
+			return nil
+		}
+		// 分区键不能为空，且主键必须包含分区键
+		if err := tx.Exec("UPDATE logs SET created_at = 0 WHERE created_at IS NULL").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("ALTER TABLE logs ALTER COLUMN created_at SET NOT NULL").Error; err != nil {
+			return err
+		}
+		defs, sequence, err := swapLogTable(tx, "logs_legacy")
+		if err != nil {
+			return err
+		}
+		boundary := logPartitionMonth(time.Now(), 1).Unix()
+		for _, statement := range []string{
+			"CREATE TABLE logs (LIKE logs_legacy INCLUDING DEFAULTS) PARTITION BY RANGE (created_at)",
+			"ALTER TABLE logs ADD PRIMARY KEY (id, created_at)",
+		} {
+			if err = tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		if err = restoreLogIndexes(tx, defs, sequence); err != nil {
+			return err
+		}
+		for _, statement := range []string{
+			fmt.Sprintf("ALTER TABLE logs ATTACH PARTITION logs_legacy FOR VALUES FROM (MINVALUE) TO (%d)", boundary),
+			"CREATE TABLE logs_default PARTITION OF logs DEFAULT",
+		} {
+			if err = tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return ensureLogPartitions(tx, 1)
+	})
+}
+
+// unpartitionPostgresLogs 将数据复制回普通表，日志量大时耗时较长
+func unpartitionPostgresLogs(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if !isLogTablePartitioned(tx) {
+			return nil
+		}
+		defs, sequence, err := swapLogTable(tx, "logs_partitioned")
+		if err != nil {
+			return err
+		}
+		for _, statement := range []string{
+			"CREATE TABLE logs (LIKE logs_partitioned INCLUDING DEFAULTS)",
+			"ALTER TABLE logs ADD PRIMARY KEY (id)",
+			"INSERT INTO logs SELECT * FROM logs_partitioned",
+		} {
+			if err = tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		if err = restoreLogIndexes(tx, defs, sequence); err != nil {
+			return err
+		}
+		return tx.Exec("DROP TABLE logs_partitioned").Error
+	})
+}
+
+// logPartitionMonth 返回 UTC 下相对 t 偏移 offset 个月的月初
+func logPartitionMonth(t time.Time, offset int) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+time.Month(offset), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ensureLogPartitions 创建从 from 个月后到 LOG_PARTITION_MONTHS_AHEAD 个月后的分区
+func ensureLogPartitions(db *gorm.DB, from int) error {
+	ahead := max(common.GetEnvOrDefault("LOG_PARTITION_MONTHS_AHEAD", 3), 1)
+	now := time.Now()
+	for i := from; i <= ahead; i++ {
+		start, end := logPartitionMonth(now, i), logPartitionMonth(now, i+1)
+		name := fmt.Sprintf("logs_p%04d%02d", start.Year(), int(start.Month()))
+		var exists bool
+		if err := db.Raw("SELECT to_regclass(?) IS NOT NULL", name).Scan(&exists).Error; err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		err := db.Exec(fmt.Sprintf("CREATE TABLE %s PARTITION OF logs FOR VALUES FROM (%d) TO (%d)", name, start.Unix(), end.Unix())).Error
+		// 当月可能已被迁移时挂载的历史分区覆盖
+		if err != nil && i > 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureLogPartitions 日志表已分区时预先创建后续月份的分区
+func EnsureLogPartitions() error {
+	if LOG_DB == nil || !isPostgresDB(LOG_DB) || !isLogTablePartitioned(LOG_DB) {
+		return nil
+	}
+	return ensureLogPartitions(LOG_DB, 0)
+}
@@ -174,7 +174,8 @@ func chooseDB(envName string, isLog bool) (*gorm.DB, error) {
 	})
 }
 
-func InitDB() (err error) {
+// openDB 连接主库并设置连接池，不执行迁移
+func openDB() (err error) {
 	db, err := chooseDB("SQL_DSN", false)
 	if err == nil {
 		if common.DebugEnabled {
@@ -194,23 +195,14 @@ func InitDB() (err error) {
 		sqlDB.SetMaxIdleConns(common.GetEnvOrDefault("SQL_MAX_IDLE_CONNS", 100))
 		sqlDB.SetMaxOpenConns(common.GetEnvOrDefault("SQL_MAX_OPEN_CONNS", 1000))
 		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(common.GetEnvOrDefault("SQL_MAX_LIFETIME", 60)))
-
-		if !common.IsMasterNode {
-			return nil
-		}
-		if common.UsingMySQL {
-			//_, _ = sqlDB.Exec("ALTER TABLE channels MODIFY model_mapping TEXT;") // TODO: delete this line when most users have upgraded
-		}
-		common.SysLog("database migration started")
-		err = migrateDB()
-		return err
 	} else {
 		common.FatalLog(err)
 	}
 	return err
 }
 
-func InitLogDB() (err error) {
+// openLogDB 连接日志库，未设置 LOG_SQL_DSN 时与主库共用连接
+func openLogDB() (err error) {
 	if os.Getenv("LOG_SQL_DSN") == "" {
 		LOG_DB = DB
 		return
@@ -234,24 +226,37 @@ func InitLogDB() (err error) {
 		sqlDB.SetMaxIdleConns(common.GetEnvOrDefault("SQL_MAX_IDLE_CONNS", 100))
 		sqlDB.SetMaxOpenConns(common.GetEnvOrDefault("SQL_MAX_OPEN_CONNS", 1000))
 		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(common.GetEnvOrDefault("SQL_MAX_LIFETIME", 60)))
-
-		if !common.IsMasterNode {
-			return nil
-		}
-		common.SysLog("database migration started")
-		err = migrateLOGDB()
-		return err
 	} else {
 		common.FatalLog(err)
 	}
 	return err
 }
 
-func migrateDB() error {
-	// Migrate price_amount column from float/double to decimal for existing tables
-	migrateSubscriptionPlanPriceAmount()
+// OpenDatabases 只建立主库与日志库连接，供 migrate 子命令使用
+func OpenDatabases() error {
+	if err := openDB(); err != nil {
+		return err
+	}
+	return openLogDB()
+}
+
+func InitDB() (err error) {
+	if err = openDB(); err != nil {
+		return err
+	}
+	return prepareSchema(migrationTargetMain)
+}
 
-	err := DB.AutoMigrate(
+func InitLogDB() (err error) {
+	if err = openLogDB(); err != nil {
+		return err
+	}
+	return prepareSchema(migrationTargetLog)
+}
+
+// schemaModels 主库中由 GORM 维护的表，SubscriptionPlan 在 SQLite 下单独建表，不在此列表中
+func schemaModels() []any {
+	return []any{
 		&Channel{},
 		&Token{},
 		&User{},
@@ -262,6 +267,14 @@ func migrateDB() error {
 		&Log{},
 		&Midjourney{},
 		&TopUp{},
+		&Coupon{},
+		&CouponUsage{},
+		&Referral{},
+		&ReferralCommission{},
+		&ReferralRate{},
+		&ScimUser{},
+		&AdminRole{},
+		&TokenLocation{},
 		&QuotaData{},
 		&Task{},
 		&Model{},
@@ -276,7 +289,40 @@ func migrateDB() error {
 		&SubscriptionPreConsumeRecord{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
-	)
+		&ChannelStatusHistory{},
+		&ChannelCapability{},
+		&Batch{},
+		&BatchRequest{},
+		&StoredResponse{},
+		&File{},
+		&LogExport{},
+		&BillingPeriod{},
+		&BillingStatement{},
+		&PostpaidInvoice{},
+		&Budget{},
+		&FreeTierUsage{},
+		&Organization{},
+		&QuotaTransfer{},
+		&QuotaGrant{},
+		&QuotaGrantRecord{},
+		&WebhookEndpoint{},
+		&WebhookEvent{},
+		&ReplicaHeartbeat{},
+		&LeaderLease{},
+		&ConfigVersion{},
+	}
+}
+
+// logSchemaModels 日志库中的表
+func logSchemaModels() []any {
+	return []any{&Log{}, &UsageStat{}, &LogArchive{}, &BodyCapture{}, &AuditLog{}, &ReplicaHeartbeat{}}
+}
+
+func migrateDB() error {
+	// Migrate price_amount column from float/double to decimal for existing tables
+	migrateSubscriptionPlanPriceAmount()
+
+	err := DB.AutoMigrate(schemaModels()...)
 	if err != nil {
 		return err
 	}
@@ -296,46 +342,18 @@ func migrateDBFast() error {
 
 	var wg sync.WaitGroup
 
-	migrations := []struct {
-		model interface{}
-		name  string
-	}{
-		{&Channel{}, "Channel"},
-		{&Token{}, "Token"},
-		{&User{}, "User"},
-		{&PasskeyCredential{}, "PasskeyCredential"},
-		{&Option{}, "Option"},
-		{&Redemption{}, "Redemption"},
-		{&Ability{}, "Ability"},
-		{&Log{}, "Log"},
-		{&Midjourney{}, "Midjourney"},
-		{&TopUp{}, "TopUp"},
-		{&QuotaData{}, "QuotaData"},
-		{&Task{}, "Task"},
-		{&Model{}, "Model"},
-		{&Vendor{}, "Vendor"},
-		{&PrefillGroup{}, "PrefillGroup"},
-		{&Setup{}, "Setup"},
-		{&TwoFA{}, "TwoFA"},
-		{&TwoFABackupCode{}, "TwoFABackupCode"},
-		{&Checkin{}, "Checkin"},
-		{&SubscriptionOrder{}, "SubscriptionOrder"},
-		{&UserSubscription{}, "UserSubscription"},
-		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
-		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
-		{&UserOAuthBinding{}, "UserOAuthBinding"},
-	}
+	migrations := schemaModels()
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
 
 	for _, m := range migrations {
 		wg.Add(1)
-		go func(model interface{}, name string) {
+		go func(model interface{}) {
 			defer wg.Done()
 			if err := DB.AutoMigrate(model); err != nil {
-				errChan <- fmt.Errorf("failed to migrate %s: %v", name, err)
+				errChan <- fmt.Errorf("failed to migrate %T: %v", model, err)
 			}
-		}(m.model, m.name)
+		}(m)
 	}
 
 	// Wait for all migrations to complete
@@ -363,7 +381,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(logSchemaModels()...); err != nil {
 		return err
 	}
 	return nil
@@ -512,6 +530,7 @@ func closeDB(db *gorm.DB) error {
 }
 
 func CloseDB() error {
+	ResignLeader()
 	if LOG_DB != DB {
 		err := closeDB(LOG_DB)
 		if err != nil {
@@ -157,6 +157,16 @@ func (midjourney *Midjourney) Update() error {
 	return err
 }
 
+// UpdateUnfinished 仅在任务尚未结束时保存，返回是否写入。
+// 多个实例同时更新同一任务时，只有第一个把任务置为结束状态的更新生效
+func (midjourney *Midjourney) UpdateUnfinished() (bool, error) {
+	result := DB.Model(&Midjourney{}).
+		Where("id = ? AND progress <> ?", midjourney.Id, "100%").
+		Select("*").Omit("id").
+		Updates(midjourney)
+	return result.RowsAffected > 0, result.Error
+}
+
 func MjBulkUpdate(mjIds []string, params map[string]any) error {
 	return DB.Model(&Midjourney{}).
 		Where("mj_id in (?)", mjIds).
@@ -0,0 +1,404 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 版本化迁移：每个版本在目标库执行一次，执行记录保存在目标库的 schema_migrations 表中。
+// 启动时不会按模型自动同步表结构，新增表或字段都必须在 migrations 末尾追加新版本，已发布的版本不要修改；
+// 启动前的一致性检查发现缺少表或字段时拒绝启动
+
+const (
+	migrationTargetMain = "main"
+	migrationTargetLog  = "log"
+)
+
+const (
+	MigrationStateApplied = "applied"
+	MigrationStatePending = "pending"
+	MigrationStateSkipped = "skipped" // 当前数据库不适用
+)
+
+var errPendingMigrations = errors.New("database has pending migrations")
+
+type Migration struct {
+	Version int
+	Name    string
+	Target  string
+	// Applies 为空表示总是适用，不适用的版本既不执行也不算作待执行
+	Applies func(db *gorm.DB) bool
+	Up      func(db *gorm.DB) error
+	// Down 为空表示不可回滚
+	Down func(db *gorm.DB) error
+}
+
+type SchemaMigration struct {
+	Version   int    `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string `json:"name" gorm:"size:128"`
+	AppliedAt int64  `json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Target:  migrationTargetMain,
+		Up: func(*gorm.DB) error {
+			return migrateDB()
+		},
+	},
+	{
+		Version: 2,
+		Name:    "log_baseline",
+		Target:  migrationTargetLog,
+		Up: func(*gorm.DB) error {
+			return migrateLOGDB()
+		},
+	},
+	{
+		Version: 3,
+		Name:    "postgres_log_indexes",
+		Target:  migrationTargetLog,
+		Applies: isPostgresDB,
+		Up:      createPostgresLogIndexes,
+		Down:    dropPostgresLogIndexes,
+	},
+	{
+		Version: 4,
+		Name:    "postgres_log_partitions",
+		Target:  migrationTargetLog,
+		Applies: logPartitionApplies,
+		Up:      partitionPostgresLogs,
+		Down:    unpartitionPostgresLogs,
+	},
+	{
+		Version: 5,
+		Name:    "replica_heartbeats",
+		Target:  migrationTargetMain,
+		Up:      createReplicaHeartbeatTable,
+		Down:    dropReplicaHeartbeatTable,
+	},
+	{
+		Version: 6,
+		Name:    "log_replica_heartbeats",
+		Target:  migrationTargetLog,
+		// 日志与主库共用时已由版本 5 创建
+		Applies: func(db *gorm.DB) bool { return db != DB },
+		Up:      createReplicaHeartbeatTable,
+		Down:    dropReplicaHeartbeatTable,
+	},
+	{
+		Version: 7,
+		Name:    "leader_leases",
+		Target:  migrationTargetMain,
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&LeaderLease{})
+		},
+		Down: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&LeaderLease{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "config_versions",
+		Target:  migrationTargetMain,
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&ConfigVersion{})
+		},
+		Down: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&ConfigVersion{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "log_exports",
+		Target:  migrationTargetMain,
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&LogExport{})
+		},
+		Down: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&LogExport{})
+		},
+	},
+	{
+		Version: 10,
+		Name:    "channel_capabilities",
+		Target:  migrationTargetMain,
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&ChannelCapability{})
+		},
+		Down: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&ChannelCapability{})
+		},
+	},
+}
+
+func createReplicaHeartbeatTable(db *gorm.DB) error {
+	return db.AutoMigrate(&ReplicaHeartbeat{})
+}
+
+func dropReplicaHeartbeatTable(db *gorm.DB) error {
+	return db.Migrator().DropTable(&ReplicaHeartbeat{})
+}
+
+func isPostgresDB(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres"
+}
+
+func migrationDB(target string) *gorm.DB {
+	if target == migrationTargetLog && LOG_DB != nil {
+		return LOG_DB
+	}
+	return DB
+}
+
+func (m Migration) applies() bool {
+	return m.Applies == nil || m.Applies(migrationDB(m.Target))
+}
+
+// appliedMigrations 读取目标库的执行记录，必要时创建记录表
+func appliedMigrations(db *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+type MigrationStatus struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Target    string `json:"target"`
+	State     string `json:"state"`
+	AppliedAt int64  `json:"applied_at"`
+}
+
+// GetMigrationStatuses 返回全部已知版本的状态，以及数据库中存在但当前程序不认识的版本
+func GetMigrationStatuses() ([]MigrationStatus, []SchemaMigration, error) {
+	known := make(map[int]bool, len(migrations))
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	var unknown []SchemaMigration
+	checked := map[*gorm.DB]bool{}
+	for _, target := range []string{migrationTargetMain, migrationTargetLog} {
+		db := migrationDB(target)
+		applied, err := appliedMigrations(db)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, m := range migrations {
+			if m.Target != target {
+				continue
+			}
+			known[m.Version] = true
+			status := MigrationStatus{Version: m.Version, Name: m.Name, Target: m.Target, State: MigrationStatePending}
+			if record, ok := applied[m.Version]; ok {
+				status.State = MigrationStateApplied
+				status.AppliedAt = record.AppliedAt
+			} else if !m.applies() {
+				status.State = MigrationStateSkipped
+			}
+			statuses = append(statuses, status)
+		}
+		if checked[db] {
+			continue
+		}
+		checked[db] = true
+		for _, record := range applied {
+			unknown = append(unknown, record)
+		}
+	}
+	filtered := unknown[:0]
+	for _, record := range unknown {
+		if !known[record.Version] {
+			filtered = append(filtered, record)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, filtered, nil
+}
+
+func runMigrationUp(m Migration) error {
+	db := migrationDB(m.Target)
+	common.SysLog(fmt.Sprintf("applying migration %d %s", m.Version, m.Name))
+	if err := m.Up(db); err != nil {
+		return fmt.Errorf("migration %d %s failed: %w", m.Version, m.Name, err)
+	}
+	return db.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: common.GetTimestamp()}).Error
+}
+
+// migrateUp 按版本顺序执行待执行的迁移，target 为空表示全部目标库，steps 不大于 0 表示全部执行
+func migrateUp(target string, steps int) (int, error) {
+	appliedByDB := map[*gorm.DB]map[int]SchemaMigration{}
+	count := 0
+	for _, m := range migrations {
+		if target != "" && m.Target != target {
+			continue
+		}
+		if steps > 0 && count >= steps {
+			break
+		}
+		db := migrationDB(m.Target)
+		applied, ok := appliedByDB[db]
+		if !ok {
+			var err error
+			if applied, err = appliedMigrations(db); err != nil {
+				return count, err
+			}
+			appliedByDB[db] = applied
+		}
+		if _, done := applied[m.Version]; done || !m.applies() {
+			continue
+		}
+		if err := runMigrationUp(m); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func MigrateUp(steps int) (int, error) {
+	return migrateUp("", steps)
+}
+
+// MigrateDown 按版本倒序回滚最近执行的 steps 个迁移，遇到不可回滚的版本时停止
+func MigrateDown(steps int) (int, error) {
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		db := migrationDB(m.Target)
+		applied, err := appliedMigrations(db)
+		if err != nil {
+			return count, err
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return count, fmt.Errorf("migration %d %s is irreversible", m.Version, m.Name)
+		}
+		common.SysLog(fmt.Sprintf("reverting migration %d %s", m.Version, m.Name))
+		if err = m.Down(db); err != nil {
+			return count, fmt.Errorf("reverting migration %d %s failed: %w", m.Version, m.Name, err)
+		}
+		if err = db.Delete(&SchemaMigration{}, m.Version).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// CheckSchemaDrift 检查目标库与当前程序是否一致：不存在未知版本与待执行版本，且模型对应的表和字段齐全
+func CheckSchemaDrift(target string) error {
+	db := migrationDB(target)
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	known := make(map[int]bool, len(migrations))
+	var pending []string
+	for _, m := range migrations {
+		known[m.Version] = true
+		if _, ok := applied[m.Version]; m.Target == target && !ok && m.applies() {
+			pending = append(pending, fmt.Sprintf("%d %s", m.Version, m.Name))
+		}
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("database has migration %d which is unknown to this version, upgrade the program or roll back the database", version)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %s", errPendingMigrations, strings.Join(pending, ", "))
+	}
+
+	models := logSchemaModels()
+	if target == migrationTargetMain {
+		models = append(schemaModels(), &SubscriptionPlan{})
+	}
+	var problems []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err = stmt.Parse(model); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+		if !db.Migrator().HasTable(table) {
+			problems = append(problems, "missing table "+table)
+			continue
+		}
+		columnTypes, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			return err
+		}
+		columns := make(map[string]bool, len(columnTypes))
+		for _, columnType := range columnTypes {
+			columns[strings.ToLower(columnType.Name())] = true
+		}
+		for _, name := range stmt.Schema.DBNames {
+			if field := stmt.Schema.FieldsByDBName[name]; field.IgnoreMigration {
+				continue
+			}
+			if !columns[strings.ToLower(name)] {
+				problems = append(problems, fmt.Sprintf("missing column %s.%s", table, name))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		if len(problems) > 10 {
+			problems = append(problems[:10], fmt.Sprintf("and %d more", len(problems)-10))
+		}
+		return fmt.Errorf("database schema drift: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// prepareSchema 启动时由主节点执行迁移，所有节点在启动前检查结构一致性，
+// 从节点会等待主节点完成迁移
+func prepareSchema(target string) error {
+	if common.IsMasterNode && common.GetEnvOrDefaultBool("AUTO_MIGRATE", true) {
+		common.SysLog("database migration started")
+		count, err := migrateUp(target, 0)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("database migrated, %d migrations applied", count))
+		}
+	}
+	if common.GetEnvOrDefaultBool("SKIP_SCHEMA_CHECK", false) {
+		return nil
+	}
+	deadline := time.Now().Add(time.Duration(common.GetEnvOrDefault("SCHEMA_CHECK_WAIT", 60)) * time.Second)
+	for {
+		err := CheckSchemaDrift(target)
+		if err == nil {
+			return nil
+		}
+		if common.IsMasterNode || !errors.Is(err, errPendingMigrations) || time.Now().After(deadline) {
+			return fmt.Errorf("%w (run \"new-api migrate up\" or set SKIP_SCHEMA_CHECK=true to bypass)", err)
+		}
+		common.SysLog("waiting for master node to apply migrations: " + err.Error())
+		time.Sleep(5 * time.Second)
+	}
+}
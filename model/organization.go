@@ -0,0 +1,385 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OrganizationRoleMember = 1
+	OrganizationRoleAdmin  = 10
+)
+
+const organizationCacheTTL = 30 * time.Second
+
+// Organization 组织（租户）。成员共用组织的额度池，组织可限制成员能使用的分组（即可见的渠道）
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"size:64;uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255);default:''"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	Quota       int    `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	Groups      string `json:"groups" gorm:"type:varchar(255);default:''"` // 成员可使用的分组，逗号分隔，为空不限制
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt   int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// OrganizationUsage 组织在一段时间内的用量汇总
+type OrganizationUsage struct {
+	OrganizationId   int    `json:"organization_id"`
+	Name             string `json:"name,omitempty"`
+	ModelName        string `json:"model_name,omitempty"`
+	Username         string `json:"username,omitempty"`
+	Requests         int64  `json:"requests"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+type organizationCacheEntry struct {
+	organization *Organization
+	expiresAt    time.Time
+}
+
+var organizationCache sync.Map
+
+type userOrganizationCacheEntry struct {
+	organizationId int
+	expiresAt      time.Time
+}
+
+// userOrganizationCache 未启用 Redis 时缓存用户所属组织，避免每次额度操作都查询用户表
+var userOrganizationCache sync.Map
+
+func (org *Organization) GetGroups() []string {
+	groups := make([]string, 0)
+	for _, group := range strings.Split(org.Groups, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// AllowsGroup 判断组织成员能否使用该分组
+func (org *Organization) AllowsGroup(group string) bool {
+	groups := org.GetGroups()
+	if len(groups) == 0 {
+		return true
+	}
+	for _, allowed := range groups {
+		if allowed == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (org *Organization) Validate() error {
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" {
+		return errors.New("组织名称不能为空")
+	}
+	if len(org.Name) > 64 {
+		return errors.New("组织名称不能超过 64 个字符")
+	}
+	org.Groups = strings.Join(org.GetGroups(), ",")
+	if org.Status != common.UserStatusEnabled && org.Status != common.UserStatusDisabled {
+		org.Status = common.UserStatusEnabled
+	}
+	return nil
+}
+
+func (org *Organization) Insert() error {
+	now := common.GetTimestamp()
+	org.CreatedAt = now
+	org.UpdatedAt = now
+	return DB.Create(org).Error
+}
+
+// Update 更新组织资料，额度只能通过 IncreaseOrganizationQuota 调整
+func (org *Organization) Update() error {
+	org.UpdatedAt = common.GetTimestamp()
+	err := DB.Model(org).Select("name", "description", "status", "groups", "updated_at").Updates(org).Error
+	organizationCache.Delete(org.Id)
+	PublishCacheInvalidation(CacheOrganization, strconv.Itoa(org.Id))
+	return err
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	org := Organization{}
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+// GetOrganizationCached 转发链路使用的组织信息，在本节点缓存 30 秒
+func GetOrganizationCached(id int) (*Organization, error) {
+	if entry, ok := organizationCache.Load(id); ok {
+		cached := entry.(organizationCacheEntry)
+		if time.Now().Before(cached.expiresAt) {
+			recordCacheLookup(CacheOrganization, true)
+			return cached.organization, nil
+		}
+	}
+	recordCacheLookup(CacheOrganization, false)
+	org, err := GetOrganizationById(id)
+	if err != nil {
+		return nil, err
+	}
+	organizationCache.Store(id, organizationCacheEntry{organization: org, expiresAt: time.Now().Add(organizationCacheTTL)})
+	return org, nil
+}
+
+func GetOrganizations(keyword string, startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	tx := DB.Model(&Organization{})
+	if keyword != "" {
+		tx = tx.Where("name LIKE ?", "%"+keyword+"%")
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+// DeleteOrganizationById 删除组织并解除全部成员关系，成员回到使用个人额度
+func DeleteOrganizationById(id int) error {
+	var memberIds []int
+	if err := DB.Model(&User{}).Where("organization_id = ?", id).Pluck("id", &memberIds).Error; err != nil {
+		return err
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("organization_id = ?", id).
+			Updates(map[string]any{"organization_id": 0, "organization_role": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return err
+	}
+	organizationCache.Delete(id)
+	PublishCacheInvalidation(CacheOrganization, strconv.Itoa(id))
+	invalidateUserOrganization(memberIds...)
+	for _, memberId := range memberIds {
+		_ = invalidateUserCache(memberId)
+	}
+	return nil
+}
+
+func IncreaseOrganizationQuota(id int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Model(&Organization{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+}
+
+func DecreaseOrganizationQuota(id int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Model(&Organization{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
+}
+
+func GetOrganizationQuota(id int) (quota int, err error) {
+	err = DB.Model(&Organization{}).Where("id = ?", id).Select("quota").Find(&quota).Error
+	return quota, err
+}
+
+// UpdateOrganizationUsedQuota 记录组织的累计消耗，与成员个人的 used_quota 同时更新
+func UpdateOrganizationUsedQuota(id int, quota int) error {
+	return DB.Model(&Organization{}).Where("id = ?", id).Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+}
+
+// getUserOrganizationId 返回用户所属组织，优先读取 Redis 用户缓存，未启用 Redis 时使用本节点缓存
+func getUserOrganizationId(userId int) int {
+	if common.RedisEnabled.Load() {
+		if cache, err := cacheGetUserBase(userId); err == nil {
+			return cache.OrganizationId
+		}
+	}
+	if entry, ok := userOrganizationCache.Load(userId); ok {
+		cached := entry.(userOrganizationCacheEntry)
+		if time.Now().Before(cached.expiresAt) {
+			recordCacheLookup(CacheUserOrganization, true)
+			return cached.organizationId
+		}
+	}
+	recordCacheLookup(CacheUserOrganization, false)
+	var organizationId int
+	if err := DB.Model(&User{}).Where("id = ?", userId).Select("organization_id").Find(&organizationId).Error; err != nil {
+		return 0
+	}
+	userOrganizationCache.Store(userId, userOrganizationCacheEntry{organizationId: organizationId, expiresAt: time.Now().Add(organizationCacheTTL)})
+	return organizationId
+}
+
+// invalidateUserOrganization 成员关系变化后失效各节点缓存的用户所属组织
+func invalidateUserOrganization(userIds ...int) {
+	if len(userIds) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(userIds))
+	for _, userId := range userIds {
+		userOrganizationCache.Delete(userId)
+		keys = append(keys, strconv.Itoa(userId))
+	}
+	PublishCacheInvalidation(CacheUserOrganization, keys...)
+}
+
+// SetUserOrganization 设置用户所属组织与组织角色，organizationId 为 0 时移出组织
+func SetUserOrganization(userId int, organizationId int, role int) error {
+	if organizationId == 0 {
+		role = 0
+	} else if role != OrganizationRoleAdmin {
+		role = OrganizationRoleMember
+	}
+	err := DB.Model(&User{}).Where("id = ?", userId).
+		Updates(map[string]any{"organization_id": organizationId, "organization_role": role}).Error
+	if err != nil {
+		return err
+	}
+	invalidateUserOrganization(userId)
+	return invalidateUserCache(userId)
+}
+
+func GetOrganizationMembers(organizationId int, startIdx int, num int) (users []*User, total int64, err error) {
+	tx := DB.Model(&User{}).Where("organization_id = ?", organizationId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("password", "access_token").Order("id asc").Limit(num).Offset(startIdx).Find(&users).Error
+	return users, total, err
+}
+
+// GetOrganizationMember 查询组织内的成员，不属于该组织时返回 gorm.ErrRecordNotFound
+func GetOrganizationMember(organizationId int, userId int) (*User, error) {
+	user := User{}
+	err := DB.Omit("password", "access_token").First(&user, "id = ? AND organization_id = ?", userId, organizationId).Error
+	return &user, err
+}
+
+func GetOrganizationTokens(organizationId int, startIdx int, num int) (tokens []*Token, total int64, err error) {
+	tx := DB.Model(&Token{}).Where("user_id IN (?)", DB.Model(&User{}).Select("id").Where("organization_id = ?", organizationId))
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, total, err
+}
+
+// GetOrganizationToken 查询组织成员的令牌，不属于该组织时返回 gorm.ErrRecordNotFound
+func GetOrganizationToken(organizationId int, tokenId int) (*Token, error) {
+	token := Token{}
+	err := DB.Where("id = ? AND user_id IN (?)", tokenId, DB.Model(&User{}).Select("id").Where("organization_id = ?", organizationId)).First(&token).Error
+	return &token, err
+}
+
+// GetOrganizationUsage 按模型与成员汇总组织的消费日志
+func GetOrganizationUsage(organizationId int, startTimestamp int64, endTimestamp int64) (byModel []*OrganizationUsage, byMember []*OrganizationUsage, err error) {
+	var memberIds []int
+	if err = DB.Model(&User{}).Where("organization_id = ?", organizationId).Pluck("id", &memberIds).Error; err != nil {
+		return nil, nil, err
+	}
+	byModel, byMember = []*OrganizationUsage{}, []*OrganizationUsage{}
+	if len(memberIds) == 0 {
+		return byModel, byMember, nil
+	}
+	query := func(column string) *gorm.DB {
+		tx := LOG_DB.Table("logs").
+			Select(column+", count(*) as requests, sum(quota) as quota, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens").
+			Where("type = ? AND user_id IN ?", LogTypeConsume, memberIds)
+		if startTimestamp != 0 {
+			tx = tx.Where("created_at >= ?", startTimestamp)
+		}
+		if endTimestamp != 0 {
+			tx = tx.Where("created_at <= ?", endTimestamp)
+		}
+		return tx.Group(column).Order("quota desc")
+	}
+	if err = query("model_name").Scan(&byModel).Error; err != nil {
+		return nil, nil, err
+	}
+	if err = query("username").Scan(&byMember).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, usage := range append(byModel, byMember...) {
+		usage.OrganizationId = organizationId
+	}
+	return byModel, byMember, nil
+}
+
+// GetOrganizationsUsage 按组织汇总消费日志，用于跨组织的账单对比，成员按当前所属组织归类
+func GetOrganizationsUsage(startTimestamp int64, endTimestamp int64) ([]*OrganizationUsage, error) {
+	var members []struct {
+		Id             int
+		OrganizationId int
+	}
+	if err := DB.Model(&User{}).Select("id, organization_id").Where("organization_id <> 0").Scan(&members).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*OrganizationUsage, 0)
+	if len(members) == 0 {
+		return result, nil
+	}
+	userOrganization := make(map[int]int, len(members))
+	memberIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userOrganization[member.Id] = member.OrganizationId
+		memberIds = append(memberIds, member.Id)
+	}
+	var rows []struct {
+		UserId           int
+		Requests         int64
+		Quota            int64
+		PromptTokens     int64
+		CompletionTokens int64
+	}
+	tx := LOG_DB.Table("logs").
+		Select("user_id, count(*) as requests, sum(quota) as quota, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens").
+		Where("type = ? AND user_id IN ?", LogTypeConsume, memberIds)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if err := tx.Group("user_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	usages := make(map[int]*OrganizationUsage)
+	for _, row := range rows {
+		organizationId := userOrganization[row.UserId]
+		usage, ok := usages[organizationId]
+		if !ok {
+			usage = &OrganizationUsage{OrganizationId: organizationId}
+			usages[organizationId] = usage
+			result = append(result, usage)
+		}
+		usage.Requests += row.Requests
+		usage.Quota += row.Quota
+		usage.PromptTokens += row.PromptTokens
+		usage.CompletionTokens += row.CompletionTokens
+	}
+	var orgs []*Organization
+	if err := DB.Select("id, name").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	for _, org := range orgs {
+		if usage, ok := usages[org.Id]; ok {
+			usage.Name = org.Name
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+)
+
+const (
+	PostpaidInvoiceStatusUnpaid = "unpaid"
+	PostpaidInvoiceStatusPaid   = "paid"
+)
+
+// PostpaidInvoice 后付费用户的月末账单，金额为出账时尚未开票的欠费额度
+type PostpaidInvoice struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"uniqueIndex:idx_postpaid_invoice_user_period,priority:1"`
+	Period    string `json:"period" gorm:"size:7;uniqueIndex:idx_postpaid_invoice_user_period,priority:2;index"`
+	Amount    int    `json:"amount"`
+	Status    string `json:"status" gorm:"size:16;index"`
+	DueTime   int64  `json:"due_time" gorm:"bigint"`
+	PaidTime  int64  `json:"paid_time" gorm:"bigint"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+
+	DisplayAmounts map[string]float64 `json:"display_amounts,omitempty" gorm:"-"` // 开启多币种展示时各币种的金额
+}
+
+// GetPostpaidDebtors 余额为负的后付费用户
+func GetPostpaidDebtors() (users []*User, err error) {
+	err = DB.Select("id, username, email, quota, credit_limit, setting").
+		Where("billing_mode = ? AND quota < 0", common.UserBillingModePostpaid).
+		Find(&users).Error
+	return users, err
+}
+
+// GetUnpaidInvoiceAmount 用户未结清账单的总额
+func GetUnpaidInvoiceAmount(userId int) (amount int, err error) {
+	err = DB.Model(&PostpaidInvoice{}).Select("COALESCE(sum(amount), 0)").
+		Where("user_id = ? AND status = ?", userId, PostpaidInvoiceStatusUnpaid).
+		Scan(&amount).Error
+	return amount, err
+}
+
+func CreatePostpaidInvoice(invoice *PostpaidInvoice) error {
+	return DB.Create(invoice).Error
+}
+
+func GetPostpaidInvoiceById(id int) (*PostpaidInvoice, error) {
+	invoice := &PostpaidInvoice{}
+	err := DB.First(invoice, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// GetPostpaidInvoices userId 为 0 时查询全部用户
+func GetPostpaidInvoices(userId int, status string, startIdx int, num int) (invoices []*PostpaidInvoice, total int64, err error) {
+	tx := DB.Model(&PostpaidInvoice{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&invoices).Error
+	return invoices, total, err
+}
+
+// SettlePostpaidInvoice 确认收到线下付款，标记账单已付并把账单金额加回用户余额
+func SettlePostpaidInvoice(id int) (*PostpaidInvoice, error) {
+	invoice, err := GetPostpaidInvoiceById(id)
+	if err != nil {
+		return nil, err
+	}
+	now := common.GetTimestamp()
+	result := DB.Model(&PostpaidInvoice{}).
+		Where("id = ? AND status = ?", id, PostpaidInvoiceStatusUnpaid).
+		Updates(map[string]interface{}{"status": PostpaidInvoiceStatusPaid, "paid_time": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("账单已结清")
+	}
+	if err := IncreaseUserQuota(invoice.UserId, invoice.Amount, true); err != nil {
+		return nil, err
+	}
+	invoice.Status = PostpaidInvoiceStatusPaid
+	invoice.PaidTime = now
+	RecordQuotaLog(invoice.UserId, LogTypeManage, fmt.Sprintf("后付费账单 %s 已结清，恢复额度 %s", invoice.Period, logger.LogQuota(invoice.Amount)), invoice.Amount)
+	return invoice, nil
+}
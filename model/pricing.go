@@ -307,6 +307,13 @@ func updatePricing() {
 	lastGetPricingTime = time.Now()
 }
 
+// InvalidatePricing 使定价缓存失效，下次读取时重新计算
+func InvalidatePricing() {
+	updatePricingLock.Lock()
+	defer updatePricingLock.Unlock()
+	lastGetPricingTime = time.Time{}
+}
+
 // GetSupportedEndpointMap 返回全局端点到路径的映射
 func GetSupportedEndpointMap() map[string]common.EndpointInfo {
 	return supportedEndpointMap
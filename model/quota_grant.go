@@ -0,0 +1,364 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	QuotaGrantTargetUser  = "user"
+	QuotaGrantTargetGroup = "group"
+	QuotaGrantTargetToken = "token"
+
+	QuotaGrantActionAdd   = "add"   // 在现有额度上增加
+	QuotaGrantActionReset = "reset" // 将额度重置为固定值
+
+	QuotaGrantScheduleDaily   = "daily"
+	QuotaGrantScheduleWeekly  = "weekly"
+	QuotaGrantScheduleMonthly = "monthly"
+)
+
+const quotaGrantBatchSize = 200
+
+// QuotaGrant 周期性发放额度的计划，例如每月 1 日给某分组发放额度、每周重置某令牌的剩余额度
+type QuotaGrant struct {
+	Id         int    `json:"id"`
+	Name       string `json:"name" gorm:"type:varchar(64);default:''"`
+	Target     string `json:"target" gorm:"type:varchar(16)"`
+	UserId     int    `json:"user_id" gorm:"default:0"`
+	Group      string `json:"group" gorm:"type:varchar(64);default:''"`
+	TokenId    int    `json:"token_id" gorm:"default:0"`
+	Action     string `json:"action" gorm:"type:varchar(16)"`
+	Quota      int    `json:"quota"`
+	Schedule   string `json:"schedule" gorm:"type:varchar(16)"`
+	Weekday    int    `json:"weekday" gorm:"default:0"`      // 每周发放时的星期，0 表示周日
+	DayOfMonth int    `json:"day_of_month" gorm:"default:1"` // 每月发放的日期，超过当月天数时在月末发放
+	Hour       int    `json:"hour" gorm:"default:0"`
+	Notify     bool   `json:"notify" gorm:"default:true"` // 发放后通知获得额度的用户
+	Enabled    bool   `json:"enabled" gorm:"default:true"`
+	LastPeriod string `json:"last_period" gorm:"type:varchar(32);default:''"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt  int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// QuotaGrantRecord 每个周期的发放记录，(grant_id, period) 唯一，先插入记录再发放以保证同一周期只执行一次
+type QuotaGrantRecord struct {
+	Id        int    `json:"id"`
+	GrantId   int    `json:"grant_id" gorm:"uniqueIndex:idx_quota_grant_period"`
+	Period    string `json:"period" gorm:"type:varchar(32);uniqueIndex:idx_quota_grant_period"`
+	Affected  int    `json:"affected" gorm:"default:0"`
+	Quota     int64  `json:"quota" gorm:"default:0"` // 实际增加的额度合计，重置时为重置后的额度合计
+	Success   bool   `json:"success"`
+	Message   string `json:"message" gorm:"type:varchar(255);default:''"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// QuotaGrantRecipient 一次发放中获得额度的用户，用于发送通知
+type QuotaGrantRecipient struct {
+	UserId    int
+	TokenName string
+	Quota     int
+}
+
+var ErrQuotaGrantPeriodClaimed = errors.New("该周期已发放")
+
+func (grant *QuotaGrant) Validate() error {
+	grant.Name = strings.TrimSpace(grant.Name)
+	switch grant.Target {
+	case QuotaGrantTargetUser:
+		if grant.UserId == 0 {
+			return errors.New("请指定用户")
+		}
+	case QuotaGrantTargetGroup:
+		if grant.Group == "" {
+			return errors.New("请指定分组")
+		}
+	case QuotaGrantTargetToken:
+		if grant.TokenId == 0 {
+			return errors.New("请指定令牌")
+		}
+		token, err := GetTokenById(grant.TokenId)
+		if err != nil {
+			return errors.New("令牌不存在")
+		}
+		if token.UnlimitedQuota {
+			return errors.New("无限额度令牌不能设置额度发放")
+		}
+	default:
+		return errors.New("无效的发放对象")
+	}
+	if grant.Action != QuotaGrantActionAdd && grant.Action != QuotaGrantActionReset {
+		return errors.New("无效的发放方式")
+	}
+	if grant.Quota <= 0 {
+		return errors.New("发放额度必须大于 0")
+	}
+	switch grant.Schedule {
+	case QuotaGrantScheduleDaily:
+	case QuotaGrantScheduleWeekly:
+		if grant.Weekday < 0 || grant.Weekday > 6 {
+			return errors.New("星期必须在 0-6 之间")
+		}
+	case QuotaGrantScheduleMonthly:
+		if grant.DayOfMonth < 1 || grant.DayOfMonth > 31 {
+			return errors.New("日期必须在 1-31 之间")
+		}
+	default:
+		return errors.New("无效的发放周期")
+	}
+	if grant.Hour < 0 || grant.Hour > 23 {
+		return errors.New("小时必须在 0-23 之间")
+	}
+	return nil
+}
+
+// CurrentPeriod 返回 now 所在周期的开始时间与周期标识，停机错过的多个周期只会补发最近的一次
+func (grant *QuotaGrant) CurrentPeriod(now time.Time) (time.Time, string) {
+	var start time.Time
+	switch grant.Schedule {
+	case QuotaGrantScheduleWeekly:
+		day := time.Date(now.Year(), now.Month(), now.Day(), grant.Hour, 0, 0, 0, now.Location())
+		day = day.AddDate(0, 0, -((int(day.Weekday()) - grant.Weekday + 7) % 7))
+		if day.After(now) {
+			day = day.AddDate(0, 0, -7)
+		}
+		start = day
+	case QuotaGrantScheduleMonthly:
+		start = monthlyGrantTime(now.Year(), now.Month(), grant.DayOfMonth, grant.Hour, now.Location())
+		if start.After(now) {
+			prev := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+			start = monthlyGrantTime(prev.Year(), prev.Month(), grant.DayOfMonth, grant.Hour, now.Location())
+		}
+	default:
+		start = time.Date(now.Year(), now.Month(), now.Day(), grant.Hour, 0, 0, 0, now.Location())
+		if start.After(now) {
+			start = start.AddDate(0, 0, -1)
+		}
+	}
+	return start, start.Format("2006-01-02 15:04")
+}
+
+func monthlyGrantTime(year int, month time.Month, day int, hour int, loc *time.Location) time.Time {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	return time.Date(year, month, min(day, lastDay), hour, 0, 0, 0, loc)
+}
+
+func (grant *QuotaGrant) Insert() error {
+	now := common.GetTimestamp()
+	grant.CreatedAt = now
+	grant.UpdatedAt = now
+	// 创建时出现的当前周期视为已过去，从下一个周期开始发放
+	_, grant.LastPeriod = grant.CurrentPeriod(time.Now())
+	return DB.Create(grant).Error
+}
+
+// Update 更新发放计划，周期设置变化时同样从下一个周期开始发放
+func (grant *QuotaGrant) Update(old *QuotaGrant) error {
+	grant.UpdatedAt = common.GetTimestamp()
+	grant.LastPeriod = old.LastPeriod
+	if grant.Schedule != old.Schedule || grant.Weekday != old.Weekday || grant.DayOfMonth != old.DayOfMonth || grant.Hour != old.Hour {
+		_, grant.LastPeriod = grant.CurrentPeriod(time.Now())
+	}
+	return DB.Model(grant).Select("name", "target", "user_id", "group", "token_id", "action", "quota",
+		"schedule", "weekday", "day_of_month", "hour", "notify", "enabled", "last_period", "updated_at").Updates(grant).Error
+}
+
+func GetQuotaGrantById(id int) (*QuotaGrant, error) {
+	grant := QuotaGrant{}
+	err := DB.First(&grant, "id = ?", id).Error
+	return &grant, err
+}
+
+func GetQuotaGrants(startIdx int, num int) (grants []*QuotaGrant, total int64, err error) {
+	if err = DB.Model(&QuotaGrant{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&grants).Error
+	return grants, total, err
+}
+
+func GetEnabledQuotaGrants() (grants []*QuotaGrant, err error) {
+	err = DB.Where("enabled = ?", true).Order("id").Find(&grants).Error
+	return grants, err
+}
+
+// DeleteQuotaGrantById 删除发放计划，保留历史发放记录
+func DeleteQuotaGrantById(id int) error {
+	return DB.Delete(&QuotaGrant{}, "id = ?", id).Error
+}
+
+func GetQuotaGrantRecords(grantId int, startIdx int, num int) (records []*QuotaGrantRecord, total int64, err error) {
+	tx := DB.Model(&QuotaGrantRecord{})
+	if grantId != 0 {
+		tx = tx.Where("grant_id = ?", grantId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&records).Error
+	return records, total, err
+}
+
+// ClaimQuotaGrantPeriod 插入周期记录，记录已存在时说明该周期已由其他节点或之前的运行发放
+func ClaimQuotaGrantPeriod(grantId int, period string) (*QuotaGrantRecord, error) {
+	var count int64
+	if err := DB.Model(&QuotaGrantRecord{}).Where("grant_id = ? AND period = ?", grantId, period).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrQuotaGrantPeriodClaimed
+	}
+	record := &QuotaGrantRecord{
+		GrantId:   grantId,
+		Period:    period,
+		CreatedAt: common.GetTimestamp(),
+	}
+	if err := DB.Create(record).Error; err != nil {
+		// 并发插入时由唯一索引拦截
+		return nil, ErrQuotaGrantPeriodClaimed
+	}
+	return record, nil
+}
+
+// FinishQuotaGrantPeriod 写入发放结果并更新计划最近一次发放的周期
+func FinishQuotaGrantPeriod(record *QuotaGrantRecord, affected int, quota int64, runErr error) error {
+	record.Affected = affected
+	record.Quota = quota
+	record.Success = runErr == nil
+	record.Message = ""
+	if runErr != nil {
+		record.Message = runErr.Error()
+		if len(record.Message) > 255 {
+			record.Message = record.Message[:255]
+		}
+	}
+	err := DB.Model(record).Select("affected", "quota", "success", "message").Updates(record).Error
+	if err != nil {
+		return err
+	}
+	return DB.Model(&QuotaGrant{}).Where("id = ?", record.GrantId).Update("last_period", record.Period).Error
+}
+
+// ExecuteQuotaGrant 按计划发放一次额度，返回获得额度的用户
+func ExecuteQuotaGrant(grant *QuotaGrant) ([]QuotaGrantRecipient, int64, error) {
+	switch grant.Target {
+	case QuotaGrantTargetUser:
+		recipients, total, err := grantUsersQuota(grant, []int{grant.UserId})
+		if err == nil && len(recipients) == 0 {
+			err = errors.New("用户不存在、已被禁用或属于组织")
+		}
+		return recipients, total, err
+	case QuotaGrantTargetGroup:
+		return grantGroupQuota(grant)
+	case QuotaGrantTargetToken:
+		return grantTokenQuota(grant)
+	}
+	return nil, 0, errors.New("无效的发放对象")
+}
+
+func grantGroupQuota(grant *QuotaGrant) ([]QuotaGrantRecipient, int64, error) {
+	var recipients []QuotaGrantRecipient
+	var total int64
+	lastId := 0
+	for {
+		var ids []int
+		err := DB.Model(&User{}).Where(commonGroupCol+" = ? AND id > ?", grant.Group, lastId).
+			Order("id").Limit(quotaGrantBatchSize).Pluck("id", &ids).Error
+		if err != nil {
+			return recipients, total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		lastId = ids[len(ids)-1]
+		batch, batchTotal, err := grantUsersQuota(grant, ids)
+		recipients = append(recipients, batch...)
+		total += batchTotal
+		if err != nil {
+			return recipients, total, err
+		}
+		if len(ids) < quotaGrantBatchSize {
+			break
+		}
+	}
+	return recipients, total, nil
+}
+
+// grantUsersQuota 给启用状态的个人用户发放额度，组织成员使用组织额度池，不参与发放
+func grantUsersQuota(grant *QuotaGrant, ids []int) ([]QuotaGrantRecipient, int64, error) {
+	var users []*User
+	err := DB.Select("id", "quota").Where("id IN ? AND status = ? AND organization_id = 0", ids, common.UserStatusEnabled).
+		Find(&users).Error
+	if err != nil || len(users) == 0 {
+		return nil, 0, err
+	}
+	userIds := make([]int, 0, len(users))
+	for _, user := range users {
+		userIds = append(userIds, user.Id)
+	}
+	tx := DB.Model(&User{}).Where("id IN ?", userIds)
+	if grant.Action == QuotaGrantActionReset {
+		err = tx.Update("quota", grant.Quota).Error
+	} else {
+		err = tx.Update("quota", gorm.Expr("quota + ?", grant.Quota)).Error
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	recipients := make([]QuotaGrantRecipient, 0, len(users))
+	var total int64
+	for _, user := range users {
+		_ = invalidateUserCache(user.Id)
+		delta := grant.Quota
+		content := fmt.Sprintf("额度发放计划「%s」发放 %s", grant.Name, logger.LogQuota(grant.Quota))
+		if grant.Action == QuotaGrantActionReset {
+			delta = grant.Quota - user.Quota
+			content = fmt.Sprintf("额度发放计划「%s」将额度重置为 %s", grant.Name, logger.LogQuota(grant.Quota))
+		}
+		RecordQuotaLog(user.Id, LogTypeManage, content, delta)
+		recipients = append(recipients, QuotaGrantRecipient{UserId: user.Id, Quota: grant.Quota})
+		total += int64(grant.Quota)
+	}
+	return recipients, total, nil
+}
+
+// grantTokenQuota 增加或重置令牌剩余额度，额度耗尽的令牌会重新启用
+func grantTokenQuota(grant *QuotaGrant) ([]QuotaGrantRecipient, int64, error) {
+	token, err := GetTokenById(grant.TokenId)
+	if err != nil {
+		return nil, 0, errors.New("令牌不存在")
+	}
+	if token.UnlimitedQuota {
+		return nil, 0, errors.New("无限额度令牌不能发放额度")
+	}
+	updates := map[string]interface{}{"remain_quota": gorm.Expr("remain_quota + ?", grant.Quota)}
+	content := fmt.Sprintf("额度发放计划「%s」为令牌 %s 增加 %s 额度", grant.Name, token.Name, logger.LogQuota(grant.Quota))
+	if grant.Action == QuotaGrantActionReset {
+		updates["remain_quota"] = grant.Quota
+		content = fmt.Sprintf("额度发放计划「%s」将令牌 %s 的剩余额度重置为 %s", grant.Name, token.Name, logger.LogQuota(grant.Quota))
+	}
+	if token.Status == common.TokenStatusExhausted {
+		updates["status"] = common.TokenStatusEnabled
+	}
+	if err = DB.Model(&Token{}).Where("id = ?", token.Id).Updates(updates).Error; err != nil {
+		return nil, 0, err
+	}
+	if common.RedisEnabled.Load() {
+		key := token.Key
+		gopool.Go(func() {
+			if err := cacheDeleteToken(key); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+		})
+	}
+	RecordLog(token.UserId, LogTypeManage, content)
+	return []QuotaGrantRecipient{{UserId: token.UserId, TokenName: token.Name, Quota: grant.Quota}}, int64(grant.Quota), nil
+}
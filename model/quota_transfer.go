@@ -0,0 +1,193 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// QuotaTransfer 用户之间的转账记录，也用于统计每日转出限额
+type QuotaTransfer struct {
+	Id         int    `json:"id"`
+	FromUserId int    `json:"from_user_id" gorm:"index"`
+	ToUserId   int    `json:"to_user_id" gorm:"index"`
+	Quota      int    `json:"quota"`
+	Fee        int    `json:"fee" gorm:"default:0"`
+	Remark     string `json:"remark" gorm:"type:varchar(255);default:''"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// QuotaTransferView 返回给用户的转账记录，附带对方的用户名
+type QuotaTransferView struct {
+	QuotaTransfer
+	FromUsername string `json:"from_username"`
+	ToUsername   string `json:"to_username"`
+}
+
+var ErrTransferInsufficientQuota = errors.New("额度不足，无法完成转账")
+
+// QuotaTransferDailyLimit 转出方自 Since 起的次数与额度上限，0 表示不限制
+type QuotaTransferDailyLimit struct {
+	Since      int64
+	CountLimit int
+	QuotaLimit int
+}
+
+// TransferUserQuota 从 fromId 转出 quota 给 toId，转出方额外支付 fee，两边在同一事务中更新；
+// 每日限额在锁定转出方后于同一事务内校验，避免并发转账绕过限额
+func TransferUserQuota(fromId int, toId int, quota int, fee int, remark string, limit QuotaTransferDailyLimit) (*QuotaTransfer, error) {
+	if quota <= 0 || fee < 0 {
+		return nil, errors.New("转账额度必须大于 0")
+	}
+	transfer := &QuotaTransfer{
+		FromUserId: fromId,
+		ToUserId:   toId,
+		Quota:      quota,
+		Fee:        fee,
+		Remark:     remark,
+		CreatedAt:  common.GetTimestamp(),
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if limit.CountLimit > 0 || limit.QuotaLimit > 0 {
+			if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id").First(&User{}, fromId).Error; err != nil {
+				return err
+			}
+			count, total, err := getUserTransferStatsSince(tx, fromId, limit.Since)
+			if err != nil {
+				return err
+			}
+			if limit.CountLimit > 0 && count >= int64(limit.CountLimit) {
+				return fmt.Errorf("今日转账次数已达上限 %d 次", limit.CountLimit)
+			}
+			if limit.QuotaLimit > 0 && total+int64(quota) > int64(limit.QuotaLimit) {
+				return fmt.Errorf("今日累计转账额度不能超过 %s", logger.LogQuota(limit.QuotaLimit))
+			}
+		}
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", fromId, quota+fee).
+			Update("quota", gorm.Expr("quota - ?", quota+fee))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTransferInsufficientQuota
+		}
+		if err := tx.Model(&User{}).Where("id = ?", toId).Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+			return err
+		}
+		return tx.Create(transfer).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	_ = invalidateUserCache(fromId)
+	_ = invalidateUserCache(toId)
+
+	toUsername, _ := GetUsernameById(toId, false)
+	fromUsername, _ := GetUsernameById(fromId, false)
+	content := fmt.Sprintf("转账给用户 %s %s", toUsername, logger.LogQuota(quota))
+	if fee > 0 {
+		content += fmt.Sprintf("，手续费 %s", logger.LogQuota(fee))
+	}
+	RecordQuotaLog(fromId, LogTypeManage, content, -(quota + fee))
+	RecordQuotaLog(toId, LogTypeManage, fmt.Sprintf("收到用户 %s 转账 %s", fromUsername, logger.LogQuota(quota)), quota)
+	return transfer, nil
+}
+
+// GetTransferRecipient 按用户名查找收款用户
+func GetTransferRecipient(username string) (*User, error) {
+	user := User{}
+	err := DB.Omit("password", "access_token").Where("username = ?", username).First(&user).Error
+	return &user, err
+}
+
+// getUserTransferStatsSince 统计用户自 since 起的转出次数与额度（不含手续费）
+func getUserTransferStatsSince(tx *gorm.DB, userId int, since int64) (count int64, quota int64, err error) {
+	var stat struct {
+		Count int64
+		Quota int64
+	}
+	err = tx.Model(&QuotaTransfer{}).Select("count(*) as count, coalesce(sum(quota), 0) as quota").
+		Where("from_user_id = ? AND created_at >= ?", userId, since).Scan(&stat).Error
+	return stat.Count, stat.Quota, err
+}
+
+// GetQuotaTransfers 查询转账记录，userId 不为 0 时只返回该用户转出或收到的记录
+func GetQuotaTransfers(userId int, startIdx int, num int) (views []*QuotaTransferView, total int64, err error) {
+	tx := DB.Model(&QuotaTransfer{})
+	if userId != 0 {
+		tx = tx.Where("from_user_id = ? OR to_user_id = ?", userId, userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var transfers []*QuotaTransfer
+	if err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&transfers).Error; err != nil {
+		return nil, 0, err
+	}
+	views = make([]*QuotaTransferView, 0, len(transfers))
+	for _, transfer := range transfers {
+		fromUsername, _ := GetUsernameById(transfer.FromUserId, false)
+		toUsername, _ := GetUsernameById(transfer.ToUserId, false)
+		views = append(views, &QuotaTransferView{
+			QuotaTransfer: *transfer,
+			FromUsername:  fromUsername,
+			ToUsername:    toUsername,
+		})
+	}
+	return views, total, nil
+}
+
+// MoveTokenQuota 在同一用户的两个令牌之间调配剩余额度，无限额度令牌不参与调配
+func MoveTokenQuota(userId int, fromTokenId int, toTokenId int, quota int) (from *Token, to *Token, err error) {
+	if quota <= 0 {
+		return nil, nil, errors.New("调配额度必须大于 0")
+	}
+	if fromTokenId == toTokenId {
+		return nil, nil, errors.New("转出与转入令牌不能相同")
+	}
+	from, err = GetTokenByIds(fromTokenId, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err = GetTokenByIds(toTokenId, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if from.UnlimitedQuota || to.UnlimitedQuota {
+		return nil, nil, errors.New("无限额度令牌不能调配额度")
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Token{}).Where("id = ? AND remain_quota >= ?", from.Id, quota).
+			Update("remain_quota", gorm.Expr("remain_quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("转出令牌剩余额度不足")
+		}
+		return tx.Model(&Token{}).Where("id = ?", to.Id).Update("remain_quota", gorm.Expr("remain_quota + ?", quota)).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if common.RedisEnabled.Load() {
+		fromKey, toKey := from.Key, to.Key
+		gopool.Go(func() {
+			if err := cacheDecrTokenQuota(fromKey, int64(quota)); err != nil {
+				common.SysLog("failed to decrease token quota: " + err.Error())
+			}
+			if err := cacheIncrTokenQuota(toKey, int64(quota)); err != nil {
+				common.SysLog("failed to increase token quota: " + err.Error())
+			}
+		})
+	}
+	from.RemainQuota -= quota
+	to.RemainQuota += quota
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("管理员将令牌 %s 的 %s 额度调配至令牌 %s", from.Name, logger.LogQuota(quota), to.Name))
+	return from, to, nil
+}
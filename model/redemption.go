@@ -31,7 +31,7 @@ type Redemption struct {
 
 func GetAllRedemptions(startIdx int, num int) (redemptions []*Redemption, total int64, err error) {
 	// 开始事务
-	tx := DB.Begin()
+	tx := readDB().Begin()
 	if tx.Error != nil {
 		return nil, 0, tx.Error
 	}
@@ -64,7 +64,7 @@ func GetAllRedemptions(startIdx int, num int) (redemptions []*Redemption, total
 }
 
 func SearchRedemptions(keyword string, startIdx int, num int) (redemptions []*Redemption, total int64, err error) {
-	tx := DB.Begin()
+	tx := readDB().Begin()
 	if tx.Error != nil {
 		return nil, 0, tx.Error
 	}
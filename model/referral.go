@@ -0,0 +1,246 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+// Referral 邀请关系，注册时使用邀请码建立。早于本表的邀请关系在被邀请用户首次充值时根据 inviter_id 补建
+type Referral struct {
+	Id              int   `json:"id"`
+	InviterId       int   `json:"inviter_id" gorm:"index"`
+	InviteeId       int   `json:"invitee_id" gorm:"uniqueIndex"`
+	TopUpCount      int   `json:"topup_count" gorm:"default:0"` // 已返佣的充值笔数
+	TotalTopUp      int64 `json:"total_topup" gorm:"default:0"`
+	TotalCommission int64 `json:"total_commission" gorm:"default:0"`
+	CreatedTime     int64 `json:"created_time" gorm:"bigint"`
+}
+
+// ReferralCommission 被邀请用户每笔充值产生的返佣
+type ReferralCommission struct {
+	Id                 int     `json:"id"`
+	ReferralId         int     `json:"referral_id" gorm:"index"`
+	InviterId          int     `json:"inviter_id" gorm:"index"`
+	InviteeId          int     `json:"invitee_id" gorm:"index"`
+	TopUpId            int     `json:"topup_id" gorm:"index"`
+	TradeNo            string  `json:"trade_no" gorm:"type:varchar(255)"`
+	TopUpQuota         int     `json:"topup_quota"`
+	Rate               float64 `json:"rate"`
+	Commission         int     `json:"commission"`
+	RefundedCommission int     `json:"refunded_commission" gorm:"default:0"` // 充值退款后扣回的返佣
+	CreatedTime        int64   `json:"created_time" gorm:"bigint;index"`
+}
+
+// ReferralRate 管理员为个别邀请人设置的返佣百分比，优先于默认配置
+type ReferralRate struct {
+	UserId    int     `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Rate      float64 `json:"rate"`
+	UpdatedAt int64   `json:"updated_at" gorm:"bigint"`
+}
+
+// ReferralSummary 邀请人的返佣汇总
+type ReferralSummary struct {
+	Invitees        int64   `json:"invitees"`
+	TotalTopUp      int64   `json:"total_topup"`
+	TotalCommission int64   `json:"total_commission"`
+	Rate            float64 `json:"rate"`
+}
+
+func createReferral(inviterId int, inviteeId int) {
+	referral := &Referral{InviterId: inviterId, InviteeId: inviteeId, CreatedTime: common.GetTimestamp()}
+	if err := DB.Create(referral).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to create referral of user %d: %s", inviteeId, err.Error()))
+	}
+}
+
+// GetReferralRate 返回邀请人当前适用的返佣百分比
+func GetReferralRate(inviterId int) float64 {
+	return getReferralRate(DB, inviterId)
+}
+
+func getReferralRate(tx *gorm.DB, inviterId int) float64 {
+	rate := &ReferralRate{}
+	if err := tx.Where("user_id = ?", inviterId).First(rate).Error; err == nil {
+		return rate.Rate
+	}
+	return operation_setting.GetReferralSetting().CommissionRate
+}
+
+func getOrCreateReferral(tx *gorm.DB, inviteeId int) (*Referral, error) {
+	referral := &Referral{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("invitee_id = ?", inviteeId).First(referral).Error
+	if err == nil {
+		return referral, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	var inviterId int
+	if err = tx.Model(&User{}).Where("id = ?", inviteeId).Select("inviter_id").Scan(&inviterId).Error; err != nil {
+		return nil, err
+	}
+	if inviterId == 0 {
+		return nil, nil
+	}
+	referral = &Referral{InviterId: inviterId, InviteeId: inviteeId, CreatedTime: common.GetTimestamp()}
+	if err = tx.Create(referral).Error; err != nil {
+		return nil, err
+	}
+	return referral, nil
+}
+
+// creditReferralCommission 在充值事务内按比例给邀请人返佣，返佣计入邀请额度，返回邀请人与返佣额度
+func creditReferralCommission(tx *gorm.DB, topUp *TopUp, quota int) (int, int, error) {
+	setting := operation_setting.GetReferralSetting()
+	if !setting.Enabled || quota <= 0 {
+		return 0, 0, nil
+	}
+	referral, err := getOrCreateReferral(tx, topUp.UserId)
+	if err != nil || referral == nil {
+		return 0, 0, err
+	}
+	if setting.MaxTopUps > 0 && referral.TopUpCount >= setting.MaxTopUps {
+		return 0, 0, nil
+	}
+	if setting.ValidDays > 0 && common.GetTimestamp()-referral.CreatedTime > int64(setting.ValidDays)*86400 {
+		return 0, 0, nil
+	}
+	rate := getReferralRate(tx, referral.InviterId)
+	commission := int(float64(quota) * rate / 100)
+	if commission <= 0 {
+		return 0, 0, nil
+	}
+	record := &ReferralCommission{
+		ReferralId:  referral.Id,
+		InviterId:   referral.InviterId,
+		InviteeId:   referral.InviteeId,
+		TopUpId:     topUp.Id,
+		TradeNo:     topUp.TradeNo,
+		TopUpQuota:  quota,
+		Rate:        rate,
+		Commission:  commission,
+		CreatedTime: common.GetTimestamp(),
+	}
+	if err = tx.Create(record).Error; err != nil {
+		return 0, 0, err
+	}
+	err = tx.Model(&Referral{}).Where("id = ?", referral.Id).Updates(map[string]interface{}{
+		"top_up_count":     gorm.Expr("top_up_count + ?", 1),
+		"total_top_up":     gorm.Expr("total_top_up + ?", quota),
+		"total_commission": gorm.Expr("total_commission + ?", commission),
+	}).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	err = tx.Model(&User{}).Where("id = ?", referral.InviterId).Updates(map[string]interface{}{
+		"aff_quota":   gorm.Expr("aff_quota + ?", commission),
+		"aff_history": gorm.Expr("aff_history + ?", commission),
+	}).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	return referral.InviterId, commission, nil
+}
+
+// reverseReferralCommission 充值退款时按退款比例扣回返佣，多次部分退款只扣新增部分
+func reverseReferralCommission(tx *gorm.DB, topUpId int, refundRatio float64) (int, int, error) {
+	record := &ReferralCommission{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("top_up_id = ?", topUpId).First(record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	deducted := int(float64(record.Commission)*refundRatio) - record.RefundedCommission
+	if deducted <= 0 {
+		return 0, 0, nil
+	}
+	if err = tx.Model(record).Update("refunded_commission", record.RefundedCommission+deducted).Error; err != nil {
+		return 0, 0, err
+	}
+	err = tx.Model(&Referral{}).Where("id = ?", record.ReferralId).
+		Update("total_commission", gorm.Expr("total_commission - ?", deducted)).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	// 邀请额度可能已被转出，允许变为负数
+	err = tx.Model(&User{}).Where("id = ?", record.InviterId).Updates(map[string]interface{}{
+		"aff_quota":   gorm.Expr("aff_quota - ?", deducted),
+		"aff_history": gorm.Expr("aff_history - ?", deducted),
+	}).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	return record.InviterId, deducted, nil
+}
+
+func GetReferralSummary(inviterId int) (*ReferralSummary, error) {
+	summary := &ReferralSummary{}
+	err := DB.Model(&Referral{}).Where("inviter_id = ?", inviterId).
+		Select("count(*) as invitees, coalesce(sum(total_top_up), 0) as total_top_up, coalesce(sum(total_commission), 0) as total_commission").
+		Scan(summary).Error
+	if err != nil {
+		return nil, err
+	}
+	summary.Rate = GetReferralRate(inviterId)
+	return summary, nil
+}
+
+// GetReferrals inviterId 为 0 时返回所有邀请关系
+func GetReferrals(inviterId int, startIdx int, num int) (referrals []*Referral, total int64, err error) {
+	query := DB.Model(&Referral{})
+	if inviterId != 0 {
+		query = query.Where("inviter_id = ?", inviterId)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&referrals).Error
+	return referrals, total, err
+}
+
+// GetReferralCommissions inviterId 为 0 时返回所有返佣记录
+func GetReferralCommissions(inviterId int, startIdx int, num int) (commissions []*ReferralCommission, total int64, err error) {
+	query := DB.Model(&ReferralCommission{})
+	if inviterId != 0 {
+		query = query.Where("inviter_id = ?", inviterId)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&commissions).Error
+	return commissions, total, err
+}
+
+func GetReferralRates() (rates []*ReferralRate, err error) {
+	err = DB.Order("user_id").Find(&rates).Error
+	return rates, err
+}
+
+func SetReferralRate(userId int, rate float64) error {
+	if rate < 0 || rate > 100 {
+		return errors.New("返佣比例必须在 0 到 100 之间")
+	}
+	if _, err := GetUserById(userId, false); err != nil {
+		return errors.New("用户不存在")
+	}
+	return DB.Save(&ReferralRate{UserId: userId, Rate: rate, UpdatedAt: common.GetTimestamp()}).Error
+}
+
+// DeleteReferralRate 删除单独设置，恢复使用默认返佣比例
+func DeleteReferralRate(userId int) error {
+	return DB.Delete(&ReferralRate{}, "user_id = ?", userId).Error
+}
+
+func recordReferralCommissionLog(inviterId int, commission int) {
+	if commission > 0 {
+		RecordLog(inviterId, LogTypeSystem, fmt.Sprintf("邀请用户充值返佣 %s", logger.LogQuota(commission)))
+	}
+}
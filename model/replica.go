@@ -0,0 +1,212 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// 只读副本：配置 SQL_REPLICA_DSN（日志库为 LOG_SQL_REPLICA_DSN）后，日志查询、用量分析与后台列表从副本读取，
+// 写入与额度操作始终使用主库。各节点检查时向主库写入心跳，副本读到该心跳所用的时间即复制延迟，
+// 副本不可用或延迟超过 REPLICA_MAX_LAG 秒时读取自动回退到主库
+
+// ReplicaHeartbeat 复制延迟检测用的心跳，只有一行
+type ReplicaHeartbeat struct {
+	Id          int   `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	HeartbeatAt int64 `json:"heartbeat_at" gorm:"bigint"` // 毫秒
+}
+
+type dbReplica struct {
+	name    string
+	db      *gorm.DB
+	primary func() *gorm.DB
+
+	healthy   atomic.Bool
+	lag       atomic.Int64
+	fallbacks atomic.Int64
+	lastError atomic.Value
+}
+
+// 等待副本读到心跳时的轮询间隔
+const replicaPollInterval = 50 * time.Millisecond
+
+var (
+	replicaOnce sync.Once
+	mainReplica *dbReplica
+	logReplica  *dbReplica
+)
+
+// readDB 返回后台查询使用的主库连接，副本可用时为副本
+func readDB() *gorm.DB {
+	if mainReplica != nil && mainReplica.healthy.Load() {
+		return mainReplica.db
+	}
+	return DB
+}
+
+func readLogDB() *gorm.DB {
+	if logReplica != nil && logReplica.healthy.Load() {
+		return logReplica.db
+	}
+	return LOG_DB
+}
+
+func openReplica(envName string, isLog bool) (*gorm.DB, error) {
+	db, err := chooseDB(envName, isLog)
+	if err != nil {
+		return nil, err
+	}
+	if common.DebugEnabled {
+		db = db.Debug()
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxIdleConns(common.GetEnvOrDefault("SQL_MAX_IDLE_CONNS", 100))
+	sqlDB.SetMaxOpenConns(common.GetEnvOrDefault("SQL_MAX_OPEN_CONNS", 1000))
+	sqlDB.SetConnMaxLifetime(time.Second * time.Duration(common.GetEnvOrDefault("SQL_MAX_LIFETIME", 60)))
+	return db, nil
+}
+
+// InitReplicas 连接只读副本并开始健康检查，需在主库与日志库迁移完成后调用
+func InitReplicas() error {
+	if os.Getenv("SQL_REPLICA_DSN") != "" {
+		db, err := openReplica("SQL_REPLICA_DSN", false)
+		if err != nil {
+			return fmt.Errorf("failed to connect database replica: %w", err)
+		}
+		mainReplica = &dbReplica{name: "main", db: db, primary: func() *gorm.DB { return DB }}
+	}
+	if LOG_DB == DB {
+		// 日志与主库共用时也共用副本
+		logReplica = mainReplica
+	} else if os.Getenv("LOG_SQL_REPLICA_DSN") != "" {
+		db, err := openReplica("LOG_SQL_REPLICA_DSN", true)
+		if err != nil {
+			return fmt.Errorf("failed to connect log database replica: %w", err)
+		}
+		logReplica = &dbReplica{name: "log", db: db, primary: func() *gorm.DB { return LOG_DB }}
+	}
+	replicas := activeReplicas()
+	if len(replicas) == 0 {
+		return nil
+	}
+	replicaOnce.Do(func() {
+		interval := time.Duration(max(common.GetEnvOrDefault("REPLICA_CHECK_INTERVAL", 5), 1)) * time.Second
+		maxLag := time.Duration(max(common.GetEnvOrDefault("REPLICA_MAX_LAG", 10), 1)) * time.Second
+		if interval >= maxLag {
+			// 检查间隔不小于最大延迟时，副本恢复后要等到下一次检查才会重新启用
+			common.SysError(fmt.Sprintf("REPLICA_CHECK_INTERVAL %s should be less than REPLICA_MAX_LAG %s, using %s", interval, maxLag, maxLag/2))
+			interval = maxLag / 2
+		}
+		for _, replica := range replicas {
+			replica.check(maxLag)
+			common.SysLog(fmt.Sprintf("database replica %s enabled, healthy=%t", replica.name, replica.healthy.Load()))
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				for _, replica := range replicas {
+					replica.check(maxLag)
+				}
+			}
+		})
+	})
+	return nil
+}
+
+func activeReplicas() []*dbReplica {
+	var replicas []*dbReplica
+	if mainReplica != nil {
+		replicas = append(replicas, mainReplica)
+	}
+	if logReplica != nil && logReplica != mainReplica {
+		replicas = append(replicas, logReplica)
+	}
+	return replicas
+}
+
+// check 测量复制延迟，副本不可用或延迟超过 maxLag 时读取回退到主库
+func (r *dbReplica) check(maxLag time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxLag+3*time.Second)
+	defer cancel()
+	err := r.measure(ctx, maxLag)
+	if err == nil && time.Duration(r.lag.Load())*time.Millisecond > maxLag {
+		err = fmt.Errorf("replication lag %dms exceeds %s", r.lag.Load(), maxLag)
+	}
+	if err != nil {
+		r.lastError.Store(err.Error())
+		if r.healthy.Swap(false) {
+			r.fallbacks.Add(1)
+			common.SysError(fmt.Sprintf("database replica %s unavailable, reading from primary: %s", r.name, err.Error()))
+		}
+		return
+	}
+	r.lastError.Store("")
+	if !r.healthy.Swap(true) {
+		common.SysLog(fmt.Sprintf("database replica %s is healthy, routing reads to replica", r.name))
+	}
+}
+
+// measure 写入本次检查的心跳后轮询副本，直到副本读到该心跳，经过的时间即复制延迟；
+// 超过 maxLag 仍未读到时按已等待的时间记录
+func (r *dbReplica) measure(ctx context.Context, maxLag time.Duration) error {
+	writtenAt := time.Now().UnixMilli()
+	if err := r.primary().WithContext(ctx).Save(&ReplicaHeartbeat{Id: 1, HeartbeatAt: writtenAt}).Error; err != nil {
+		return fmt.Errorf("write heartbeat: %w", err)
+	}
+	ticker := time.NewTicker(replicaPollInterval)
+	defer ticker.Stop()
+	for {
+		var replica ReplicaHeartbeat
+		if err := r.db.WithContext(ctx).First(&replica, 1).Error; err != nil {
+			return fmt.Errorf("read replica heartbeat: %w", err)
+		}
+		// 其他节点可能已写入更新的心跳，同样说明副本已追上本次写入
+		lag := time.Now().UnixMilli() - writtenAt
+		if replica.HeartbeatAt >= writtenAt || lag > maxLag.Milliseconds() {
+			r.lag.Store(lag)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("read replica heartbeat: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+type ReplicaStats struct {
+	Name      string `json:"name"`
+	Healthy   bool   `json:"healthy"`
+	LagMillis int64  `json:"lag_ms"`
+	Fallbacks int64  `json:"fallbacks"` // 回退到主库的次数
+	LastError string `json:"last_error,omitempty"`
+}
+
+// GetReplicaStats 返回已配置副本的状态，未配置时为空
+func GetReplicaStats() []ReplicaStats {
+	replicas := activeReplicas()
+	stats := make([]ReplicaStats, 0, len(replicas))
+	for _, replica := range replicas {
+		lastError, _ := replica.lastError.Load().(string)
+		stats = append(stats, ReplicaStats{
+			Name:      replica.name,
+			Healthy:   replica.healthy.Load(),
+			LagMillis: replica.lag.Load(),
+			Fallbacks: replica.fallbacks.Load(),
+			LastError: lastError,
+		})
+	}
+	return stats
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// ScimUser 身份提供方通过 SCIM 同步的用户，记录 SCIM 侧的 userName 与 externalId。
+// 本地用户名长度有限，SCIM userName 常为邮箱，因此单独保存
+type ScimUser struct {
+	UserId      int    `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	UserName    string `json:"user_name" gorm:"type:varchar(255);uniqueIndex"`
+	ExternalId  string `json:"external_id" gorm:"type:varchar(255);index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// ScimUserDetail SCIM 用户及其本地账户信息
+type ScimUserDetail struct {
+	ScimUser
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Status      int    `json:"status"`
+	Group       string `json:"group"`
+}
+
+func scimUserDetailQuery() *gorm.DB {
+	return DB.Table("scim_users").
+		Select("scim_users.*, users.display_name, users.email, users.status, users." + commonGroupCol + " as " + commonGroupCol).
+		Joins("JOIN users ON users.id = scim_users.user_id AND users.deleted_at IS NULL")
+}
+
+func GetScimUser(userId int) (*ScimUserDetail, error) {
+	detail := &ScimUserDetail{}
+	err := scimUserDetailQuery().Where("scim_users.user_id = ?", userId).Take(detail).Error
+	return detail, err
+}
+
+// SearchScimUsers attr 支持 userName 与 externalId 的精确匹配，为空时返回全部
+func SearchScimUsers(attr string, value string, startIdx int, num int) (users []*ScimUserDetail, total int64, err error) {
+	query := scimUserDetailQuery()
+	switch attr {
+	case "":
+	case "username":
+		query = query.Where("scim_users.user_name = ?", value)
+	case "externalid":
+		query = query.Where("scim_users.external_id = ?", value)
+	default:
+		return nil, 0, fmt.Errorf("unsupported filter attribute %s", attr)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("scim_users.user_id").Limit(num).Offset(startIdx).Find(&users).Error
+	return users, total, err
+}
+
+// GetScimUsersByGroup 返回分组内由 SCIM 管理的用户，作为 SCIM 组成员
+func GetScimUsersByGroup(group string) (users []*ScimUserDetail, err error) {
+	err = scimUserDetailQuery().Where("users."+commonGroupCol+" = ?", group).
+		Order("scim_users.user_id").Find(&users).Error
+	return users, err
+}
+
+func IsScimUserNameTaken(userName string, excludeUserId int) bool {
+	var count int64
+	DB.Model(&ScimUser{}).Where("user_name = ? AND user_id <> ?", userName, excludeUserId).Count(&count)
+	return count > 0
+}
+
+// CreateScimUser 创建本地账户并记录 SCIM 信息，本地用户名过长或已被占用时自动生成
+func CreateScimUser(user *User, scimUser *ScimUser) error {
+	if exist, err := CheckUserExistOrDeleted(user.Username, ""); user.Username == "" || len(user.Username) > 20 || err != nil || exist {
+		user.Username = "scim_" + common.GetRandomString(8)
+	}
+	if user.Email != "" && IsEmailAlreadyTaken(user.Email) {
+		user.Email = ""
+	}
+	user.Password = common.GetRandomString(16)
+	user.Role = common.RoleCommonUser
+	if err := user.Insert(0); err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	scimUser.UserId = user.Id
+	scimUser.CreatedTime = now
+	scimUser.UpdatedTime = now
+	if err := DB.Create(scimUser).Error; err != nil {
+		_ = HardDeleteUserById(user.Id)
+		return err
+	}
+	return nil
+}
+
+func UpdateScimUser(scimUser *ScimUser) error {
+	scimUser.UpdatedTime = common.GetTimestamp()
+	return DB.Model(scimUser).Select("user_name", "external_id", "updated_time").Updates(scimUser).Error
+}
+
+// UpdateScimUserProfile 写入身份提供方同步的资料，停用时同时禁用该用户的全部令牌
+func UpdateScimUserProfile(userId int, displayName string, email string, active bool) error {
+	status := common.UserStatusEnabled
+	if !active {
+		status = common.UserStatusDisabled
+	}
+	updates := map[string]interface{}{
+		"display_name": displayName,
+		"status":       status,
+	}
+	if email != "" && DB.Unscoped().Where("email = ? AND id <> ?", email, userId).Find(&User{}).RowsAffected == 0 {
+		updates["email"] = email
+	}
+	if err := DB.Model(&User{}).Where("id = ?", userId).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := invalidateUserCache(userId); err != nil {
+		return err
+	}
+	if !active {
+		return DisableUserTokens(userId)
+	}
+	return nil
+}
+
+// UpdateScimUserGroup 按 SCIM 组成员变化调整用户分组
+func UpdateScimUserGroup(userId int, group string) error {
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("group", group).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+// DeleteScimUser 删除本地账户并禁用其令牌
+func DeleteScimUser(userId int) error {
+	if err := DisableUserTokens(userId); err != nil {
+		return err
+	}
+	if err := DB.Delete(&ScimUser{}, "user_id = ?", userId).Error; err != nil {
+		return err
+	}
+	return DeleteUserById(userId)
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+// StoredResponse 网关侧保存的 /v1/responses 对象，每轮只保存本轮输入，历史通过 previous_response_id 回溯
+type StoredResponse struct {
+	Id                 int    `json:"id"`
+	ResponseId         string `json:"response_id" gorm:"type:varchar(191);uniqueIndex"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	Model              string `json:"model" gorm:"type:varchar(128)"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(191)"`
+	Input              string `json:"input" gorm:"type:text"`  // 本轮输入条目，JSON 数组
+	Output             string `json:"output" gorm:"type:text"` // 完整响应对象
+	CreatedAt          int64  `json:"created_at" gorm:"bigint"`
+	ExpiresAt          int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func SaveStoredResponse(response *StoredResponse) error {
+	if response.CreatedAt == 0 {
+		response.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(response).Error
+}
+
+func GetStoredResponse(userId int, responseId string) (*StoredResponse, error) {
+	response := &StoredResponse{}
+	err := DB.Where("user_id = ? AND response_id = ? AND (expires_at = 0 OR expires_at > ?)", userId, responseId, common.GetTimestamp()).
+		First(response).Error
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func DeleteStoredResponse(userId int, responseId string) (int64, error) {
+	result := DB.Where("user_id = ? AND response_id = ?", userId, responseId).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
+
+func DeleteExpiredStoredResponses(limit int) (int64, error) {
+	now := common.GetTimestamp()
+	var ids []int
+	if err := DB.Model(&StoredResponse{}).Where("expires_at > 0 AND expires_at <= ?", now).
+		Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := DB.Where("id IN ?", ids).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
@@ -89,7 +89,7 @@ func getSubscriptionPlanCache() *cachex.HybridCache[SubscriptionPlan] {
 			Namespace: cachex.Namespace(subscriptionPlanCacheNamespace),
 			Redis:     common.RDB,
 			RedisEnabled: func() bool {
-				return common.RedisEnabled && common.RDB != nil
+				return common.RedisEnabled.Load() && common.RDB != nil
 			},
 			RedisCodec: cachex.JSONCodec[SubscriptionPlan]{},
 			Memory: func() *hot.HotCache[string, SubscriptionPlan] {
@@ -110,7 +110,7 @@ func getSubscriptionPlanInfoCache() *cachex.HybridCache[SubscriptionPlanInfo] {
 			Namespace: cachex.Namespace(subscriptionPlanInfoCacheNamespace),
 			Redis:     common.RDB,
 			RedisEnabled: func() bool {
-				return common.RedisEnabled && common.RDB != nil
+				return common.RedisEnabled.Load() && common.RDB != nil
 			},
 			RedisCodec: cachex.JSONCodec[SubscriptionPlanInfo]{},
 			Memory: func() *hot.HotCache[string, SubscriptionPlanInfo] {
@@ -268,6 +268,19 @@ func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	return task, exist, err
 }
 
+func GetByPlatformTaskId(platform constant.TaskPlatform, taskId string) (*Task, bool, error) {
+	if taskId == "" {
+		return nil, false, nil
+	}
+	var task *Task
+	err := DB.Where("platform = ? and task_id = ?", platform, taskId).First(&task).Error
+	exist, err := RecordExist(err)
+	if err != nil {
+		return nil, false, err
+	}
+	return task, exist, err
+}
+
 func GetByTaskId(userId int, taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -313,6 +326,16 @@ func (Task *Task) Update() error {
 	return err
 }
 
+// UpdateUnfinished 仅在任务尚未结束时保存，返回是否写入。
+// 轮询、回调或多个实例同时更新同一任务时，只有第一个把任务置为结束状态的更新生效
+func (t *Task) UpdateUnfinished() (bool, error) {
+	result := DB.Model(&Task{}).
+		Where("id = ? AND progress <> ? AND status NOT IN (?)", t.ID, "100%", []string{TaskStatusFailure, TaskStatusSuccess}).
+		Select("*").Omit("id").
+		Updates(t)
+	return result.RowsAffected > 0, result.Error
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
@@ -10,6 +10,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// ProjectMaxLength 项目标识的最大长度
+const ProjectMaxLength = 64
+
 type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index"`
@@ -24,9 +27,19 @@ type Token struct {
 	ModelLimitsEnabled bool           `json:"model_limits_enabled"`
 	ModelLimits        string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
+	DenyIps            *string        `json:"deny_ips" gorm:"default:''"`  // 拒绝访问的 IP/CIDR，优先于白名单
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`                            // 跨分组重试，仅auto分组有效
+	MaxConcurrency     int            `json:"max_concurrent_requests" gorm:"default:0"`     // 最大并发请求数，0 表示使用分组配置
+	Project            string         `json:"project" gorm:"size:64;default:''"`            // 默认归属项目，可被请求头 X-Project-Id 覆盖
+	Scopes             string         `json:"scopes" gorm:"type:varchar(255);default:''"`   // 逗号分隔的接口类别，为空表示不限制
+	ContextTruncation  string         `json:"context_truncation" gorm:"size:16;default:''"` // 超出上下文窗口时的截断策略，为空表示拒绝请求
+	RelayRace          bool           `json:"relay_race"`                                   // 竞速模式，需管理员允许该分组与模型
+	PreviousKey        string         `json:"-" gorm:"type:char(48);index"`                 // 轮换前的密钥，重叠期内仍可使用
+	PreviousKeyExpires int64          `json:"previous_key_expires" gorm:"bigint;default:0"`
+	RotatedTime        int64          `json:"rotated_time" gorm:"bigint;default:0"`
+	ExpiryNotifiedAt   int64          `json:"-" gorm:"bigint;default:0"` // 已提醒过的到期时间，避免重复提醒
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -35,31 +48,23 @@ func (token *Token) Clean() {
 }
 
 func (token *Token) GetIpLimits() []string {
-	// delete empty spaces
-	//split with \n
-	ipLimits := make([]string, 0)
 	if token.AllowIps == nil {
-		return ipLimits
-	}
-	cleanIps := strings.ReplaceAll(*token.AllowIps, " ", "")
-	if cleanIps == "" {
-		return ipLimits
-	}
-	ips := strings.Split(cleanIps, "\n")
-	for _, ip := range ips {
-		ip = strings.TrimSpace(ip)
-		ip = strings.ReplaceAll(ip, ",", "")
-		if ip != "" {
-			ipLimits = append(ipLimits, ip)
-		}
+		return []string{}
+	}
+	return common.ParseIpList(*token.AllowIps)
+}
+
+func (token *Token) GetIpDenies() []string {
+	if token.DenyIps == nil {
+		return []string{}
 	}
-	return ipLimits
+	return common.ParseIpList(*token.DenyIps)
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
 	var tokens []*Token
 	var err error
-	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	err = readDB().Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
 	return tokens, err
 }
 
@@ -67,7 +72,7 @@ func SearchUserTokens(userId int, keyword string, token string) (tokens []*Token
 	if token != "" {
 		token = strings.Trim(token, "sk-")
 	}
-	err = DB.Where("user_id = ?", userId).Where("name LIKE ?", "%"+keyword+"%").Where(commonKeyCol+" LIKE ?", "%"+token+"%").Find(&tokens).Error
+	err = readDB().Where("user_id = ?", userId).Where("name LIKE ?", "%"+keyword+"%").Where(commonKeyCol+" LIKE ?", "%"+token+"%").Find(&tokens).Error
 	return tokens, err
 }
 
@@ -88,7 +93,7 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			return token, errors.New("该令牌状态不可用")
 		}
 		if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
-			if !common.RedisEnabled {
+			if !common.RedisEnabled.Load() {
 				token.Status = common.TokenStatusExpired
 				err := token.SelectUpdate()
 				if err != nil {
@@ -98,7 +103,7 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			return token, errors.New("该令牌已过期")
 		}
 		if !token.UnlimitedQuota && token.RemainQuota <= 0 {
-			if !common.RedisEnabled {
+			if !common.RedisEnabled.Load() {
 				// in this case, we can make sure the token is exhausted
 				token.Status = common.TokenStatusExhausted
 				err := token.SelectUpdate()
@@ -158,7 +163,7 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 			})
 		}
 	}()
-	if !fromDB && common.RedisEnabled {
+	if !fromDB && common.RedisEnabled.Load() {
 		// Try Redis first
 		token, err := cacheGetTokenByKey(key)
 		if err == nil {
@@ -168,6 +173,10 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	}
 	fromDB = true
 	err = DB.Where(commonKeyCol+" = ?", key).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 轮换重叠期内旧密钥仍可使用，返回的令牌携带当前密钥以保证额度缓存一致
+		err = DB.Where("previous_key = ? AND previous_key_expires > ?", key, common.GetTimestamp()).First(&token).Error
+	}
 	return token, err
 }
 
@@ -190,7 +199,7 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "deny_ips", "group", "cross_group_retry", "max_concurrency", "project", "scopes", "context_truncation", "relay_race").Updates(token).Error
 	return err
 }
 
@@ -224,6 +233,30 @@ func (token *Token) Delete() (err error) {
 	return err
 }
 
+// DisableUserTokens 禁用用户的全部可用令牌并清除缓存
+func DisableUserTokens(userId int) error {
+	var tokens []*Token
+	if err := DB.Where("user_id = ? AND status = ?", userId, common.TokenStatusEnabled).Find(&tokens).Error; err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	err := DB.Model(&Token{}).Where("user_id = ? AND status = ?", userId, common.TokenStatusEnabled).
+		Update("status", common.TokenStatusDisabled).Error
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled.Load() {
+		for _, token := range tokens {
+			if err := cacheDeleteToken(token.Key); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
 func (token *Token) IsModelLimitsEnabled() bool {
 	return token.ModelLimitsEnabled
 }
@@ -235,6 +268,31 @@ func (token *Token) GetModelLimits() []string {
 	return strings.Split(token.ModelLimits, ",")
 }
 
+func (token *Token) GetScopes() []string {
+	scopes := make([]string, 0)
+	for _, scope := range strings.Split(token.Scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// HasScope 令牌未配置范围时允许访问全部接口类别
+func (token *Token) HasScope(scope string) bool {
+	scopes := token.GetScopes()
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 func (token *Token) GetModelLimitsMap() map[string]bool {
 	limits := token.GetModelLimits()
 	limitsMap := make(map[string]bool)
@@ -271,7 +329,7 @@ func IncreaseTokenQuota(id int, key string, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
-	if common.RedisEnabled {
+	if common.RedisEnabled.Load() {
 		gopool.Go(func() {
 			err := cacheIncrTokenQuota(key, int64(quota))
 			if err != nil {
@@ -301,7 +359,7 @@ func DecreaseTokenQuota(id int, key string, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
-	if common.RedisEnabled {
+	if common.RedisEnabled.Load() {
 		gopool.Go(func() {
 			err := cacheDecrTokenQuota(key, int64(quota))
 			if err != nil {
@@ -357,7 +415,7 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 		return 0, err
 	}
 
-	if common.RedisEnabled {
+	if common.RedisEnabled.Load() {
 		gopool.Go(func() {
 			for _, t := range tokens {
 				_ = cacheDeleteToken(t.Key)
@@ -367,3 +425,63 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 
 	return len(tokens), nil
 }
+
+// RotateKey 为令牌生成新的密钥，旧密钥在 overlapSeconds 秒内仍可使用，令牌的 id、额度与限制保持不变
+func (token *Token) RotateKey(overlapSeconds int64) error {
+	newKey, err := common.GenerateKey()
+	if err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	oldKey := token.Key
+	previousKey, previousExpires := "", int64(0)
+	if overlapSeconds > 0 {
+		previousKey, previousExpires = oldKey, now+overlapSeconds
+	}
+	result := DB.Model(&Token{}).Where("id = ? AND "+commonKeyCol+" = ?", token.Id, oldKey).Updates(map[string]interface{}{
+		"key":                  newKey,
+		"previous_key":         previousKey,
+		"previous_key_expires": previousExpires,
+		"rotated_time":         now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("令牌已被修改，请刷新后重试")
+	}
+	token.Key = newKey
+	token.PreviousKey = previousKey
+	token.PreviousKeyExpires = previousExpires
+	token.RotatedTime = now
+	if common.RedisEnabled.Load() {
+		gopool.Go(func() {
+			if err := cacheDeleteToken(oldKey); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+		})
+	}
+	return nil
+}
+
+// GetTokensDueForRotation 返回指定用户分组中距上次轮换超过 before 时间点的可用令牌
+func GetTokensDueForRotation(group string, before int64, afterId int, limit int) (tokens []*Token, err error) {
+	err = DB.Table("tokens").Select("tokens.*").
+		Joins("JOIN users ON users.id = tokens.user_id AND users.deleted_at IS NULL").
+		Where("users."+commonGroupCol+" = ? AND tokens.status = ? AND tokens.deleted_at IS NULL AND tokens.id > ?", group, common.TokenStatusEnabled, afterId).
+		Where("(tokens.rotated_time = 0 AND tokens.created_time < ?) OR (tokens.rotated_time > 0 AND tokens.rotated_time < ?)", before, before).
+		Order("tokens.id").Limit(limit).Find(&tokens).Error
+	return tokens, err
+}
+
+// GetTokensExpiringBefore 返回将在 before 之前到期且尚未提醒过的可用令牌
+func GetTokensExpiringBefore(before int64, limit int) (tokens []*Token, err error) {
+	err = DB.Where("status = ? AND expired_time > ? AND expired_time <= ? AND expiry_notified_at <> expired_time",
+		common.TokenStatusEnabled, common.GetTimestamp(), before).
+		Order("expired_time").Limit(limit).Find(&tokens).Error
+	return tokens, err
+}
+
+func MarkTokenExpiryNotified(tokenId int, expiredTime int64) error {
+	return DB.Model(&Token{}).Where("id = ?", tokenId).Update("expiry_notified_at", expiredTime).Error
+}
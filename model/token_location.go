@@ -0,0 +1,48 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// TokenLocation 令牌使用过的国家与 ASN，用于发现令牌在新的网络环境下被使用
+type TokenLocation struct {
+	Id        int    `json:"id"`
+	TokenId   int    `json:"token_id" gorm:"uniqueIndex:idx_token_location"`
+	Country   string `json:"country" gorm:"type:varchar(8);uniqueIndex:idx_token_location"`
+	Asn       string `json:"asn" gorm:"type:varchar(32);uniqueIndex:idx_token_location"`
+	LastIp    string `json:"last_ip" gorm:"type:varchar(64)"`
+	FirstSeen int64  `json:"first_seen" gorm:"bigint"`
+	LastSeen  int64  `json:"last_seen" gorm:"bigint"`
+}
+
+// RecordTokenLocation 记录令牌的使用位置，返回该位置是否首次出现以及令牌此前是否已有位置记录
+func RecordTokenLocation(tokenId int, country string, asn string, ip string) (isNew bool, hadHistory bool, err error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&TokenLocation{}).
+		Where("token_id = ? AND country = ? AND asn = ?", tokenId, country, asn).
+		Updates(map[string]interface{}{"last_ip": ip, "last_seen": now})
+	if result.Error != nil {
+		return false, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return false, true, nil
+	}
+	var count int64
+	if err = DB.Model(&TokenLocation{}).Where("token_id = ?", tokenId).Count(&count).Error; err != nil {
+		return false, false, err
+	}
+	location := &TokenLocation{TokenId: tokenId, Country: country, Asn: asn, LastIp: ip, FirstSeen: now, LastSeen: now}
+	// 并发请求可能同时插入同一位置，冲突时视为已存在
+	result = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(location)
+	if result.Error != nil {
+		return false, false, result.Error
+	}
+	return result.RowsAffected > 0, count > 0, nil
+}
+
+func GetTokenLocations(tokenId int) (locations []*TokenLocation, err error) {
+	err = DB.Where("token_id = ?", tokenId).Order("last_seen desc").Find(&locations).Error
+	return locations, err
+}
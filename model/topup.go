@@ -21,6 +21,61 @@ type TopUp struct {
 	CreateTime    int64   `json:"create_time"`
 	CompleteTime  int64   `json:"complete_time"`
 	Status        string  `json:"status"`
+	Quota         int64   `json:"quota"`                                     // 套餐固定充值额度，0 表示按支付金额换算
+	PaymentId     string  `json:"payment_id" gorm:"type:varchar(255);index"` // 支付平台的交易号，用于匹配退款
+	RefundedQuota int64   `json:"refunded_quota"`
+	CouponId      int     `json:"coupon_id" gorm:"default:0"`
+	BonusQuota    int64   `json:"bonus_quota"` // 优惠券赠送的额度
+}
+
+// creditedQuota 订单实际到账的额度
+func (topUp *TopUp) creditedQuota() float64 {
+	if topUp.Quota > 0 {
+		return float64(topUp.Quota)
+	}
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return topUp.Money * common.QuotaPerUnit
+	case "creem":
+		return float64(topUp.Amount)
+	default:
+		return float64(topUp.Amount) * common.QuotaPerUnit
+	}
+}
+
+// topUpRewards 订单完成时发放的优惠券赠送额度与邀请返佣
+type topUpRewards struct {
+	bonus      int
+	inviterId  int
+	commission int
+}
+
+func applyTopUpRewards(tx *gorm.DB, topUp *TopUp, quota int) (rewards topUpRewards, err error) {
+	if rewards.bonus, err = redeemTopUpCoupon(tx, topUp, quota); err != nil {
+		return rewards, err
+	}
+	rewards.inviterId, rewards.commission, err = creditReferralCommission(tx, topUp, quota)
+	return rewards, err
+}
+
+func (rewards topUpRewards) record(topUp *TopUp) {
+	recordCouponBonusLog(topUp, rewards.bonus)
+	recordReferralCommissionLog(rewards.inviterId, rewards.commission)
+}
+
+// ApplyTopUpRewards 供不在事务中完成充值的支付方式在订单完成后发放优惠券赠送与邀请返佣
+func ApplyTopUpRewards(topUp *TopUp, quota int) error {
+	var rewards topUpRewards
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rewards, err = applyTopUpRewards(tx, topUp, quota)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	rewards.record(topUp)
+	return nil
 }
 
 func (topUp *TopUp) Insert() error {
@@ -55,12 +110,13 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	return topUp
 }
 
-func Recharge(referenceId string, customerId string) (err error) {
+func Recharge(referenceId string, customerId string, paymentId string) (err error) {
 	if referenceId == "" {
 		return errors.New("未提供支付单号")
 	}
 
 	var quota float64
+	var rewards topUpRewards
 	topUp := &TopUp{}
 
 	refCol := "`trade_no`"
@@ -80,18 +136,20 @@ func Recharge(referenceId string, customerId string) (err error) {
 
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
+		topUp.PaymentId = paymentId
 		err = tx.Save(topUp).Error
 		if err != nil {
 			return err
 		}
 
-		quota = topUp.Money * common.QuotaPerUnit
+		quota = topUp.creditedQuota()
 		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
 		if err != nil {
 			return err
 		}
 
-		return nil
+		rewards, err = applyTopUpRewards(tx, topUp, int(quota))
+		return err
 	})
 
 	if err != nil {
@@ -100,6 +158,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
+	rewards.record(topUp)
 
 	return nil
 }
@@ -249,9 +308,10 @@ func ManualCompleteTopUp(tradeNo string) error {
 	var userId int
 	var quotaToAdd int
 	var payMoney float64
+	var rewards topUpRewards
+	topUp := &TopUp{}
 
 	err := DB.Transaction(func(tx *gorm.DB) error {
-		topUp := &TopUp{}
 		// 行级锁，避免并发补单
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
 			return errors.New("充值订单不存在")
@@ -269,7 +329,10 @@ func ManualCompleteTopUp(tradeNo string) error {
 		// 计算应充值额度：
 		// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
 		// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
-		if topUp.PaymentMethod == "stripe" {
+		// - 额度套餐订单：直接使用套餐额度
+		if topUp.Quota > 0 {
+			quotaToAdd = int(topUp.Quota)
+		} else if topUp.PaymentMethod == "stripe" {
 			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
 			quotaToAdd = int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
 		} else {
@@ -295,7 +358,9 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 		userId = topUp.UserId
 		payMoney = topUp.Money
-		return nil
+		var err error
+		rewards, err = applyTopUpRewards(tx, topUp, quotaToAdd)
+		return err
 	})
 
 	if err != nil {
@@ -304,6 +369,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 	// 事务外记录日志，避免阻塞
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
+	rewards.record(topUp)
 	return nil
 }
 func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
@@ -312,6 +378,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	var quota int64
+	var rewards topUpRewards
 	topUp := &TopUp{}
 
 	refCol := "`trade_no`"
@@ -364,7 +431,8 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return err
 		}
 
-		return nil
+		rewards, err = applyTopUpRewards(tx, topUp, int(quota))
+		return err
 	})
 
 	if err != nil {
@@ -373,6 +441,57 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
+	rewards.record(topUp)
 
 	return nil
 }
+
+// RefundTopUp 按退款比例扣回额度，多次部分退款时只扣除新增的部分，返回本次扣回的额度
+func RefundTopUp(paymentId string, refundRatio float64) (deducted int64, err error) {
+	if paymentId == "" {
+		return 0, errors.New("未提供支付交易号")
+	}
+	refundRatio = min(refundRatio, 1)
+	topUp := &TopUp{}
+	var inviterId, reversed int
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where("payment_id = ?", paymentId).First(topUp).Error
+		if err != nil {
+			return errors.New("充值订单不存在")
+		}
+		if topUp.Status != common.TopUpStatusSuccess && topUp.Status != common.TopUpStatusPartiallyRefunded {
+			return errors.New("充值订单状态错误")
+		}
+		// 优惠券赠送的额度按同样比例扣回
+		target := int64((topUp.creditedQuota() + float64(topUp.BonusQuota)) * refundRatio)
+		deducted = target - topUp.RefundedQuota
+		if deducted <= 0 {
+			return nil
+		}
+		topUp.RefundedQuota = target
+		if refundRatio >= 1 {
+			topUp.Status = common.TopUpStatusRefunded
+		} else {
+			topUp.Status = common.TopUpStatusPartiallyRefunded
+		}
+		if err := tx.Save(topUp).Error; err != nil {
+			return err
+		}
+		// 用户已消耗的额度无法收回，余额可能变为负数
+		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", deducted)).Error; err != nil {
+			return err
+		}
+		inviterId, reversed, err = reverseReferralCommission(tx, topUp.Id, refundRatio)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if deducted > 0 {
+		RecordQuotaLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("充值订单 %s 退款，扣回额度: %v", topUp.TradeNo, logger.FormatQuota(int(deducted))), -int(deducted))
+	}
+	if reversed > 0 {
+		RecordLog(inviterId, LogTypeSystem, fmt.Sprintf("被邀请用户充值退款，扣回返佣 %s", logger.LogQuota(reversed)))
+	}
+	return deducted, nil
+}
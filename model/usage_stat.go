@@ -0,0 +1,271 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+)
+
+const (
+	UsageStatPeriodHour = "hour"
+	UsageStatPeriodDay  = "day"
+)
+
+// UsageLatencyBounds 延迟直方图各桶上限（秒），最后一个桶统计超出上限的请求
+var UsageLatencyBounds = []int{0, 1, 2, 3, 5, 8, 13, 21, 34, 60, 120, 300}
+
+// UsageStat 按小时/天汇总的用量，维度为用户、令牌、渠道、模型、项目
+type UsageStat struct {
+	Id               int    `json:"id"`
+	Period           string `json:"period" gorm:"size:8;index:idx_usage_stat_bucket,priority:1"`
+	BucketStart      int64  `json:"bucket_start" gorm:"bigint;index:idx_usage_stat_bucket,priority:2"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	ChannelId        int    `json:"channel_id" gorm:"index"`
+	ModelName        string `json:"model_name" gorm:"size:128;index;default:''"`
+	Project          string `json:"project" gorm:"size:64;index;default:''"`
+	Requests         int    `json:"requests" gorm:"default:0"`
+	Errors           int    `json:"errors" gorm:"default:0"`
+	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
+	Quota            int    `json:"quota" gorm:"default:0"`
+	TotalUseTime     int64  `json:"total_use_time" gorm:"default:0"`
+	LatencyBuckets   string `json:"-" gorm:"type:text"`
+
+	latency []int
+}
+
+type UsageStatFilter struct {
+	Period    string
+	Start     int64
+	End       int64
+	UserId    int
+	TokenId   int
+	ChannelId int
+	ModelName string
+	Project   string
+}
+
+func usageStatKey(userId, tokenId, channelId int, modelName string, project string) string {
+	return fmt.Sprintf("%d|%d|%d|%s|%s", userId, tokenId, channelId, modelName, project)
+}
+
+func usageLatencyBucket(useTime int) int {
+	for i, bound := range UsageLatencyBounds {
+		if useTime <= bound {
+			return i
+		}
+	}
+	return len(UsageLatencyBounds)
+}
+
+// Latency 返回延迟直方图
+func (s *UsageStat) Latency() []int {
+	if s.latency == nil {
+		s.latency = make([]int, len(UsageLatencyBounds)+1)
+		if s.LatencyBuckets != "" {
+			var buckets []int
+			if err := common.UnmarshalJsonStr(s.LatencyBuckets, &buckets); err == nil {
+				copy(s.latency, buckets)
+			}
+		}
+	}
+	return s.latency
+}
+
+// Merge 累加另一条汇总记录
+func (s *UsageStat) Merge(other *UsageStat) {
+	s.Requests += other.Requests
+	s.Errors += other.Errors
+	s.PromptTokens += other.PromptTokens
+	s.CompletionTokens += other.CompletionTokens
+	s.Quota += other.Quota
+	s.TotalUseTime += other.TotalUseTime
+	latency := s.Latency()
+	for i, n := range other.Latency() {
+		latency[i] += n
+	}
+}
+
+func (s *UsageStat) encodeLatency() {
+	data, err := common.Marshal(s.Latency())
+	if err == nil {
+		s.LatencyBuckets = string(data)
+	}
+}
+
+func saveUsageStats(period string, start int64, end int64, stats map[string]*UsageStat) error {
+	list := make([]*UsageStat, 0, len(stats))
+	for _, stat := range stats {
+		stat.encodeLatency()
+		list = append(list, stat)
+	}
+	return LOG_DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("period = ? AND bucket_start >= ? AND bucket_start < ?", period, start, end).Delete(&UsageStat{}).Error; err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(list, 100).Error
+	})
+}
+
+// RollupUsageStatsHour 从原始日志汇总 [start, start+3600) 内的消费与错误记录，重复执行会覆盖该小时的结果
+func RollupUsageStatsHour(start int64) error {
+	end := start + 3600
+	rows, err := LOG_DB.Model(&Log{}).
+		Select("user_id, token_id, channel_id, model_name, project, type, prompt_tokens, completion_tokens, quota, use_time").
+		Where("created_at >= ? AND created_at < ? AND type IN ?", start, end, []int{LogTypeConsume, LogTypeError}).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]*UsageStat)
+	for rows.Next() {
+		var userId, tokenId, channelId, logType, promptTokens, completionTokens, quota, useTime int
+		var modelName, project string
+		if err := rows.Scan(&userId, &tokenId, &channelId, &modelName, &project, &logType, &promptTokens, &completionTokens, &quota, &useTime); err != nil {
+			return err
+		}
+		key := usageStatKey(userId, tokenId, channelId, modelName, project)
+		stat, ok := stats[key]
+		if !ok {
+			stat = &UsageStat{
+				Period:      UsageStatPeriodHour,
+				BucketStart: start,
+				UserId:      userId,
+				TokenId:     tokenId,
+				ChannelId:   channelId,
+				ModelName:   modelName,
+				Project:     project,
+			}
+			stats[key] = stat
+		}
+		stat.Requests++
+		if logType == LogTypeError {
+			stat.Errors++
+		}
+		stat.PromptTokens += promptTokens
+		stat.CompletionTokens += completionTokens
+		stat.Quota += quota
+		stat.TotalUseTime += int64(useTime)
+		stat.Latency()[usageLatencyBucket(useTime)]++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return saveUsageStats(UsageStatPeriodHour, start, end, stats)
+}
+
+// RollupUsageStatsDay 合并 [start, end) 内的小时汇总为一条日汇总
+func RollupUsageStatsDay(start int64, end int64) error {
+	// 从主库读取，避免副本延迟漏掉刚写入的小时汇总
+	hourly, err := queryUsageStats(LOG_DB, UsageStatFilter{Period: UsageStatPeriodHour, Start: start, End: end})
+	if err != nil {
+		return err
+	}
+	stats := make(map[string]*UsageStat)
+	for _, hour := range hourly {
+		key := usageStatKey(hour.UserId, hour.TokenId, hour.ChannelId, hour.ModelName, hour.Project)
+		stat, ok := stats[key]
+		if !ok {
+			stat = &UsageStat{
+				Period:      UsageStatPeriodDay,
+				BucketStart: start,
+				UserId:      hour.UserId,
+				TokenId:     hour.TokenId,
+				ChannelId:   hour.ChannelId,
+				ModelName:   hour.ModelName,
+				Project:     hour.Project,
+			}
+			stats[key] = stat
+		}
+		stat.Merge(hour)
+	}
+	return saveUsageStats(UsageStatPeriodDay, start, end, stats)
+}
+
+func GetLatestUsageStatBucket(period string) (int64, error) {
+	var latest int64
+	err := LOG_DB.Model(&UsageStat{}).Where("period = ?", period).Select("COALESCE(MAX(bucket_start), 0)").Scan(&latest).Error
+	return latest, err
+}
+
+// QueryUsageStats 启用 ClickHouse 时直接从 ClickHouse 聚合，否则读取汇总表，副本可用时从副本读取
+func QueryUsageStats(filter UsageStatFilter) ([]*UsageStat, error) {
+	if clickHouseClient != nil {
+		return queryClickHouseUsageStats(filter)
+	}
+	return queryUsageStats(readLogDB(), filter)
+}
+
+func queryUsageStats(db *gorm.DB, filter UsageStatFilter) ([]*UsageStat, error) {
+	tx := db.Where("period = ?", filter.Period)
+	if filter.Start > 0 {
+		tx = tx.Where("bucket_start >= ?", filter.Start)
+	}
+	if filter.End > 0 {
+		tx = tx.Where("bucket_start < ?", filter.End)
+	}
+	if filter.UserId != 0 {
+		tx = tx.Where("user_id = ?", filter.UserId)
+	}
+	if filter.TokenId != 0 {
+		tx = tx.Where("token_id = ?", filter.TokenId)
+	}
+	if filter.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", filter.ChannelId)
+	}
+	if filter.ModelName != "" {
+		tx = tx.Where("model_name = ?", filter.ModelName)
+	}
+	if filter.Project != "" {
+		tx = tx.Where("project = ?", filter.Project)
+	}
+	var stats []*UsageStat
+	err := tx.Order("bucket_start asc").Find(&stats).Error
+	return stats, err
+}
+
+func DeleteUsageStatsBefore(period string, targetTimestamp int64) (int64, error) {
+	result := LOG_DB.Where("period = ? AND bucket_start < ?", period, targetTimestamp).Delete(&UsageStat{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteRolledUpLogs 删除已汇总的消费与错误日志，其他类型日志不受影响
+func DeleteRolledUpLogs(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	var total int64 = 0
+	for {
+		if nil != ctx.Err() {
+			return total, ctx.Err()
+		}
+		result := LOG_DB.Where("created_at < ? AND type IN ?", targetTimestamp, []int{LogTypeConsume, LogTypeError}).Limit(limit).Delete(&Log{})
+		if nil != result.Error {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(limit) {
+			break
+		}
+	}
+	return total, nil
+}
+
+// SummarizeLogUsage 直接从原始日志按用户与模型汇总 [start, end) 内的消费与错误记录，用于补齐尚未汇总的最近时段
+func SummarizeLogUsage(start int64, end int64) ([]*UsageStat, error) {
+	var stats []*UsageStat
+	err := readLogDB().Model(&Log{}).
+		Select("user_id, model_name, COUNT(*) AS requests, "+
+			"COALESCE(SUM(CASE WHEN type = ? THEN 1 ELSE 0 END), 0) AS errors, "+
+			"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, "+
+			"COALESCE(SUM(quota), 0) AS quota, COALESCE(SUM(use_time), 0) AS total_use_time", LogTypeError).
+		Where("created_at >= ? AND created_at < ? AND type IN ?", start, end, []int{LogTypeConsume, LogTypeError}).
+		Group("user_id, model_name").
+		Scan(&stats).Error
+	return stats, err
+}
@@ -23,12 +23,14 @@ type User struct {
 	Password         string         `json:"password" gorm:"not null;" validate:"min=8,max=20"`
 	OriginalPassword string         `json:"original_password" gorm:"-:all"` // this field is only for Password change verification, don't save it to database!
 	DisplayName      string         `json:"display_name" gorm:"index" validate:"max=20"`
-	Role             int            `json:"role" gorm:"type:int;default:1"`   // admin, common
-	Status           int            `json:"status" gorm:"type:int;default:1"` // enabled, disabled
+	Role             int            `json:"role" gorm:"type:int;default:1"`                // admin, common
+	AdminRoleId      int            `json:"admin_role_id" gorm:"type:int;default:0;index"` // 自定义管理员角色，0 表示默认管理员权限
+	Status           int            `json:"status" gorm:"type:int;default:1"`              // enabled, disabled
 	Email            string         `json:"email" gorm:"index" validate:"max=50"`
 	GitHubId         string         `json:"github_id" gorm:"column:github_id;index"`
 	DiscordId        string         `json:"discord_id" gorm:"column:discord_id;index"`
 	OidcId           string         `json:"oidc_id" gorm:"column:oidc_id;index"`
+	LdapDn           string         `json:"ldap_dn" gorm:"column:ldap_dn;type:varchar(255);index"`
 	WeChatId         string         `json:"wechat_id" gorm:"column:wechat_id;index"`
 	TelegramId       string         `json:"telegram_id" gorm:"column:telegram_id;index"`
 	VerificationCode string         `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
@@ -47,6 +49,12 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	BillingMode      string         `json:"billing_mode" gorm:"type:varchar(16);default:'prepaid'"`
+	CreditLimit      int            `json:"credit_limit" gorm:"type:int;default:0"` // 后付费用户允许透支的额度
+	AllowIps         string         `json:"allow_ips" gorm:"type:text"`             // 用户全部令牌允许访问的 IP/CIDR，为空不限制
+	DenyIps          string         `json:"deny_ips" gorm:"type:text"`              // 用户全部令牌拒绝访问的 IP/CIDR
+	OrganizationId   int            `json:"organization_id" gorm:"type:int;default:0;index"`
+	OrganizationRole int            `json:"organization_role" gorm:"type:int;default:0"` // 组织内角色，0 表示不属于任何组织
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -58,6 +66,13 @@ func (user *User) ToBaseUser() *UserBase {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+		AllowIps: user.AllowIps,
+		DenyIps:  user.DenyIps,
+		// 组织成员的额度与分组限制由组织决定
+		OrganizationId: user.OrganizationId,
+	}
+	if user.BillingMode == common.UserBillingModePostpaid {
+		cache.CreditLimit = user.CreditLimit
 	}
 	return cache
 }
@@ -187,7 +202,7 @@ func GetMaxUserId() int {
 
 func GetAllUsers(pageInfo *common.PageInfo) (users []*User, total int64, err error) {
 	// Start transaction
-	tx := DB.Begin()
+	tx := readDB().Begin()
 	if tx.Error != nil {
 		return nil, 0, tx.Error
 	}
@@ -225,7 +240,7 @@ func SearchUsers(keyword string, group string, startIdx int, num int) ([]*User,
 	var err error
 
 	// 开始事务
-	tx := DB.Begin()
+	tx := readDB().Begin()
 	if tx.Error != nil {
 		return nil, 0, tx.Error
 	}
@@ -425,6 +440,7 @@ func (user *User) Insert(inviterId int) error {
 			RecordLog(inviterId, LogTypeSystem, fmt.Sprintf("邀请用户赠送 %s", logger.LogQuota(common.QuotaForInviter)))
 			_ = inviteUser(inviterId)
 		}
+		createReferral(inviterId, user.Id)
 	}
 	return nil
 }
@@ -463,6 +479,10 @@ func (user *User) Edit(updatePassword bool) error {
 		"group":        newUser.Group,
 		"quota":        newUser.Quota,
 		"remark":       newUser.Remark,
+		"billing_mode": newUser.BillingMode,
+		"credit_limit": newUser.CreditLimit,
+		"allow_ips":    newUser.AllowIps,
+		"deny_ips":     newUser.DenyIps,
 	}
 	if updatePassword {
 		updates["password"] = newUser.Password
@@ -564,6 +584,14 @@ func (user *User) FillUserByOidcId() error {
 	return nil
 }
 
+func (user *User) FillUserByLdapDn() error {
+	if user.LdapDn == "" {
+		return errors.New("ldap dn 为空！")
+	}
+	DB.Where(User{LdapDn: user.LdapDn}).First(user)
+	return nil
+}
+
 func (user *User) FillUserByWeChatId() error {
 	if user.WeChatId == "" {
 		return errors.New("WeChat id 为空！")
@@ -603,6 +631,30 @@ func IsOidcIdAlreadyTaken(oidcId string) bool {
 	return DB.Where("oidc_id = ?", oidcId).Find(&User{}).RowsAffected == 1
 }
 
+func IsLdapDnAlreadyTaken(ldapDn string) bool {
+	return DB.Unscoped().Where("ldap_dn = ?", ldapDn).Find(&User{}).RowsAffected == 1
+}
+
+// GetLdapUsers 按 id 分批返回 LDAP 来源的未删除用户，供定期同步使用
+func GetLdapUsers(afterId int, limit int) (users []*User, err error) {
+	err = DB.Select("id", "username", "ldap_dn", "role", "status").
+		Where("ldap_dn <> '' AND id > ?", afterId).
+		Order("id").Limit(limit).Find(&users).Error
+	return users, err
+}
+
+// UpdateLdapUserRoleAndStatus 写入目录同步得到的角色与状态并清除用户缓存
+func UpdateLdapUserRoleAndStatus(id int, role int, status int) error {
+	err := DB.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"role":   role,
+		"status": status,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(id)
+}
+
 func IsTelegramIdAlreadyTaken(telegramId string) bool {
 	return DB.Unscoped().Where("telegram_id = ?", telegramId).Find(&User{}).RowsAffected == 1
 }
@@ -644,7 +696,7 @@ func IsAdmin(userId int) bool {
 //			})
 //		}
 //	}()
-//	if !fromDB && common.RedisEnabled {
+//	if !fromDB && common.RedisEnabled.Load() {
 //		// Try Redis first
 //		status, err := getUserStatusCache(id)
 //		if err == nil {
@@ -675,7 +727,11 @@ func ValidateAccessToken(token string) (user *User) {
 }
 
 // GetUserQuota gets quota from Redis first, falls back to DB if needed
+// 组织成员返回组织额度池的余额
 func GetUserQuota(id int, fromDB bool) (quota int, err error) {
+	if organizationId := getUserOrganizationId(id); organizationId != 0 {
+		return GetOrganizationQuota(organizationId)
+	}
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
 		if shouldUpdateRedis(fromDB, err) {
@@ -686,7 +742,7 @@ func GetUserQuota(id int, fromDB bool) (quota int, err error) {
 			})
 		}
 	}()
-	if !fromDB && common.RedisEnabled {
+	if !fromDB && common.RedisEnabled.Load() {
 		quota, err := getUserQuotaCache(id)
 		if err == nil {
 			return quota, nil
@@ -724,7 +780,7 @@ func GetUserGroup(id int, fromDB bool) (group string, err error) {
 			})
 		}
 	}()
-	if !fromDB && common.RedisEnabled {
+	if !fromDB && common.RedisEnabled.Load() {
 		group, err := getUserGroupCache(id)
 		if err == nil {
 			return group, nil
@@ -753,7 +809,7 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 			})
 		}
 	}()
-	if !fromDB && common.RedisEnabled {
+	if !fromDB && common.RedisEnabled.Load() {
 		setting, err := getUserSettingCache(id)
 		if err == nil {
 			return setting, nil
@@ -771,10 +827,14 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 	return userBase.GetSetting(), nil
 }
 
+// IncreaseUserQuota 组织成员的额度变动作用于组织额度池
 func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	if organizationId := getUserOrganizationId(id); organizationId != 0 {
+		return IncreaseOrganizationQuota(organizationId, quota)
+	}
 	gopool.Go(func() {
 		err := cacheIncrUserQuota(id, int64(quota))
 		if err != nil {
@@ -800,6 +860,9 @@ func DecreaseUserQuota(id int, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	if organizationId := getUserOrganizationId(id); organizationId != 0 {
+		return DecreaseOrganizationQuota(organizationId, quota)
+	}
 	gopool.Go(func() {
 		err := cacheDecrUserQuota(id, int64(quota))
 		if err != nil {
@@ -832,6 +895,22 @@ func DeltaUpdateUserQuota(id int, delta int) (err error) {
 	}
 }
 
+// DisableUser 停用用户并清除缓存，使后续请求立即被拒绝
+func DisableUser(id int) error {
+	if err := DB.Model(&User{}).Where("id = ?", id).Update("status", common.UserStatusDisabled).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(id)
+}
+
+// EnableUser 启用用户并清除缓存
+func EnableUser(id int) error {
+	if err := DB.Model(&User{}).Where("id = ?", id).Update("status", common.UserStatusEnabled).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(id)
+}
+
 //func GetRootUserEmail() (email string) {
 //	DB.Model(&User{}).Where("role = ?", common.RoleRootUser).Select("email").Find(&email)
 //	return email
@@ -843,6 +922,11 @@ func GetRootUser() (user *User) {
 }
 
 func UpdateUserUsedQuotaAndRequestCount(id int, quota int) {
+	if organizationId := getUserOrganizationId(id); organizationId != 0 {
+		if err := UpdateOrganizationUsedQuota(organizationId, quota); err != nil {
+			common.SysLog("failed to update organization used quota: " + err.Error())
+		}
+	}
 	if common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeUsedQuota, id, quota)
 		addNewRecord(BatchUpdateTypeRequestCount, id, 1)
@@ -899,7 +983,7 @@ func GetUsernameById(id int, fromDB bool) (username string, err error) {
 			})
 		}
 	}()
-	if !fromDB && common.RedisEnabled {
+	if !fromDB && common.RedisEnabled.Load() {
 		username, err := getUserNameCache(id)
 		if err == nil {
 			return username, nil
@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -22,15 +24,24 @@ type UserBase struct {
 	Status   int    `json:"status"`
 	Username string `json:"username"`
 	Setting  string `json:"setting"`
+	// CreditLimit 后付费用户的信用额度，预付费用户为 0
+	CreditLimit int `json:"credit_limit"`
+	// AllowIps/DenyIps 作用于用户全部令牌的网络限制
+	AllowIps string `json:"allow_ips"`
+	DenyIps  string `json:"deny_ips"`
+	// OrganizationId 所属组织，0 表示不属于任何组织
+	OrganizationId int `json:"organization_id"`
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
 	common.SetContextKey(c, constant.ContextKeyUserGroup, user.Group)
 	common.SetContextKey(c, constant.ContextKeyUserQuota, user.Quota)
+	common.SetContextKey(c, constant.ContextKeyUserCreditLimit, user.CreditLimit)
 	common.SetContextKey(c, constant.ContextKeyUserStatus, user.Status)
 	common.SetContextKey(c, constant.ContextKeyUserEmail, user.Email)
 	common.SetContextKey(c, constant.ContextKeyUserName, user.Username)
 	common.SetContextKey(c, constant.ContextKeyUserSetting, user.GetSetting())
+	common.SetContextKey(c, constant.ContextKeyUserOrganizationId, user.OrganizationId)
 }
 
 func (user *UserBase) GetSetting() dto.UserSetting {
@@ -51,7 +62,7 @@ func getUserCacheKey(userId int) string {
 
 // invalidateUserCache clears user cache
 func invalidateUserCache(userId int) error {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil
 	}
 	return common.RedisDelKey(getUserCacheKey(userId))
@@ -59,7 +70,7 @@ func invalidateUserCache(userId int) error {
 
 // updateUserCache updates all user cache fields using hash
 func updateUserCache(user User) error {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil
 	}
 
@@ -107,18 +118,23 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+		AllowIps: user.AllowIps,
+		DenyIps:  user.DenyIps,
+		// 组织成员的额度与分组限制由组织决定
+		OrganizationId: user.OrganizationId,
 	}
 
 	return userCache, nil
 }
 
 func cacheGetUserBase(userId int) (*UserBase, error) {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil, fmt.Errorf("redis is not enabled")
 	}
 	var userCache UserBase
 	// Try getting from Redis first
 	err := common.RedisHGetObj(getUserCacheKey(userId), &userCache)
+	recordCacheLookup(CacheUser, err == nil)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +143,7 @@ func cacheGetUserBase(userId int) (*UserBase, error) {
 
 // Add atomic quota operations using hash fields
 func cacheIncrUserQuota(userId int, delta int64) error {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil
 	}
 	return common.RedisHIncrBy(getUserCacheKey(userId), "Quota", delta)
@@ -180,7 +196,7 @@ func getUserSettingCache(userId int) (dto.UserSetting, error) {
 
 // New functions for individual field updates
 func updateUserStatusCache(userId int, status bool) error {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil
 	}
 	statusInt := common.UserStatusEnabled
@@ -191,14 +207,14 @@ func updateUserStatusCache(userId int, status bool) error {
 }
 
 func updateUserQuotaCache(userId int, quota int) error {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil
 	}
 	return common.RedisHSetField(getUserCacheKey(userId), "Quota", fmt.Sprintf("%d", quota))
 }
 
 func updateUserGroupCache(userId int, group string) error {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil
 	}
 	return common.RedisHSetField(getUserCacheKey(userId), "Group", group)
@@ -209,14 +225,14 @@ func UpdateUserGroupCache(userId int, group string) error {
 }
 
 func updateUserNameCache(userId int, username string) error {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil
 	}
 	return common.RedisHSetField(getUserCacheKey(userId), "Username", username)
 }
 
 func updateUserSettingCache(userId int, setting string) error {
-	if !common.RedisEnabled {
+	if !common.RedisEnabled.Load() {
 		return nil
 	}
 	return common.RedisHSetField(getUserCacheKey(userId), "Setting", setting)
@@ -231,3 +247,65 @@ func GetUserLanguage(userId int) string {
 	}
 	return userCache.GetSetting().Language
 }
+
+// userPermissionsCacheTTL 管理员权限在本节点的缓存时间，修改或分配角色时会主动失效
+const userPermissionsCacheTTL = 60 * time.Second
+
+// userPermissionsAllKey 失效全部用户的权限缓存，编辑或删除角色时使用
+const userPermissionsAllKey = "*"
+
+type userPermissionsCacheEntry struct {
+	permissions []string
+	expiresAt   time.Time
+}
+
+var userPermissionsCache sync.Map
+
+func getUserPermissionsCache(userId int) ([]string, bool) {
+	entry, ok := userPermissionsCache.Load(userId)
+	if ok {
+		cached := entry.(userPermissionsCacheEntry)
+		if time.Now().Before(cached.expiresAt) {
+			recordCacheLookup(CacheUserPermissions, true)
+			return cached.permissions, true
+		}
+	}
+	recordCacheLookup(CacheUserPermissions, false)
+	return nil, false
+}
+
+func setUserPermissionsCache(userId int, permissions []string) {
+	userPermissionsCache.Store(userId, userPermissionsCacheEntry{permissions: permissions, expiresAt: time.Now().Add(userPermissionsCacheTTL)})
+}
+
+func invalidateUserPermissionsEntries(keys []string) int {
+	count := 0
+	for _, key := range keys {
+		if key == userPermissionsAllKey {
+			userPermissionsCache.Range(func(k, _ any) bool {
+				userPermissionsCache.Delete(k)
+				count++
+				return true
+			})
+			continue
+		}
+		if id, err := strconv.Atoi(key); err == nil {
+			userPermissionsCache.Delete(id)
+			count++
+		}
+	}
+	return count
+}
+
+// invalidateUserPermissions 失效本节点与其他实例的权限缓存，userIds 为空表示全部用户
+func invalidateUserPermissions(userIds ...int) {
+	keys := []string{userPermissionsAllKey}
+	if len(userIds) > 0 {
+		keys = make([]string, 0, len(userIds))
+		for _, id := range userIds {
+			keys = append(keys, strconv.Itoa(id))
+		}
+	}
+	invalidateUserPermissionsEntries(keys)
+	PublishCacheInvalidation(CacheUserPermissions, keys...)
+}
@@ -39,6 +39,13 @@ func InitBatchUpdater() {
 	})
 }
 
+// FlushBatchUpdates 退出前写入尚未批量更新的额度与计数
+func FlushBatchUpdates() {
+	if common.BatchUpdateEnabled {
+		batchUpdate()
+	}
+}
+
 func addNewRecord(type_ int, id int, value int) {
 	batchUpdateLocks[type_].Lock()
 	defer batchUpdateLocks[type_].Unlock()
@@ -108,5 +115,5 @@ func RecordExist(err error) (bool, error) {
 }
 
 func shouldUpdateRedis(fromDB bool, err error) bool {
-	return common.RedisEnabled && fromDB && err == nil
+	return common.RedisEnabled.Load() && fromDB && err == nil
 }
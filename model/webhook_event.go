@@ -0,0 +1,214 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	WebhookEventRequestCompleted     = "request.completed"
+	WebhookEventQuotaLow             = "quota.low"
+	WebhookEventTokenCreated         = "token.created"
+	WebhookEventChannelStatusChanged = "channel.status_changed"
+
+	WebhookDeliveryPending = "pending"
+	WebhookDeliverySuccess = "success"
+	WebhookDeliveryFailed  = "failed" // 已达到最大重试次数
+)
+
+var WebhookEventTypes = []string{
+	WebhookEventRequestCompleted,
+	WebhookEventQuotaLow,
+	WebhookEventTokenCreated,
+	WebhookEventChannelStatusChanged,
+}
+
+// WebhookEndpoint 用户配置的事件推送地址，Events 为逗号分隔的订阅事件类型
+type WebhookEndpoint struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Name      string `json:"name" gorm:"type:varchar(64);default:''"`
+	Url       string `json:"url" gorm:"type:varchar(512)"`
+	Secret    string `json:"secret" gorm:"type:varchar(128);default:''"`
+	Events    string `json:"events" gorm:"type:varchar(255);default:''"`
+	Enabled   bool   `json:"enabled" gorm:"default:true"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// WebhookEvent 每次投递的记录，失败后按 next_retry_at 重试，也可由用户手动重新投递
+type WebhookEvent struct {
+	Id           int    `json:"id"`
+	EventId      string `json:"event_id" gorm:"type:varchar(64);uniqueIndex"`
+	EndpointId   int    `json:"endpoint_id" gorm:"index"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Type         string `json:"type" gorm:"type:varchar(64);index"`
+	Payload      string `json:"payload" gorm:"type:text"`
+	Status       string `json:"status" gorm:"type:varchar(16);index"`
+	Attempts     int    `json:"attempts" gorm:"default:0"`
+	ResponseCode int    `json:"response_code" gorm:"default:0"`
+	LastError    string `json:"last_error" gorm:"type:varchar(512);default:''"`
+	NextRetryAt  int64  `json:"next_retry_at" gorm:"bigint;index"`
+	DeliveredAt  int64  `json:"delivered_at" gorm:"bigint;default:0"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func IsValidWebhookEventType(eventType string) bool {
+	for _, t := range WebhookEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *WebhookEndpoint) EventList() []string {
+	var events []string
+	for _, event := range strings.Split(e.Events, ",") {
+		if event = strings.TrimSpace(event); event != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+	for _, event := range e.EventList() {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *WebhookEndpoint) Validate() error {
+	e.Name = strings.TrimSpace(e.Name)
+	e.Url = strings.TrimSpace(e.Url)
+	if len(e.Name) > 64 {
+		return errors.New("名称不能超过 64 个字符")
+	}
+	parsed, err := url.Parse(e.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("无效的推送地址")
+	}
+	if len(e.Url) > 512 {
+		return errors.New("推送地址不能超过 512 个字符")
+	}
+	events := e.EventList()
+	if len(events) == 0 {
+		return errors.New("至少订阅一种事件")
+	}
+	for _, event := range events {
+		if !IsValidWebhookEventType(event) {
+			return fmt.Errorf("不支持的事件类型：%s", event)
+		}
+	}
+	e.Events = strings.Join(events, ",")
+	return nil
+}
+
+func (e *WebhookEndpoint) Insert() error {
+	now := common.GetTimestamp()
+	e.CreatedAt = now
+	e.UpdatedAt = now
+	return DB.Create(e).Error
+}
+
+func (e *WebhookEndpoint) Update() error {
+	e.UpdatedAt = common.GetTimestamp()
+	return DB.Model(e).Select("name", "url", "secret", "events", "enabled", "updated_at").Updates(e).Error
+}
+
+func GetWebhookEndpointsByUserId(userId int) (endpoints []*WebhookEndpoint, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&endpoints).Error
+	return endpoints, err
+}
+
+func GetUserWebhookEndpointById(id int, userId int) (*WebhookEndpoint, error) {
+	var endpoint WebhookEndpoint
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&endpoint).Error
+	return &endpoint, err
+}
+
+func GetWebhookEndpointById(id int) (*WebhookEndpoint, error) {
+	var endpoint WebhookEndpoint
+	err := DB.First(&endpoint, id).Error
+	return &endpoint, err
+}
+
+func CountWebhookEndpointsByUserId(userId int) (count int64, err error) {
+	err = DB.Model(&WebhookEndpoint{}).Where("user_id = ?", userId).Count(&count).Error
+	return count, err
+}
+
+func GetEnabledWebhookEndpoints() (endpoints []*WebhookEndpoint, err error) {
+	err = DB.Where("enabled = ?", true).Find(&endpoints).Error
+	return endpoints, err
+}
+
+func DeleteUserWebhookEndpoint(id int, userId int) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&WebhookEndpoint{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("推送地址不存在")
+	}
+	return DB.Where("endpoint_id = ?", id).Delete(&WebhookEvent{}).Error
+}
+
+func (e *WebhookEvent) Insert() error {
+	return DB.Create(e).Error
+}
+
+// SaveWebhookDeliveryResult 保存一次投递的结果
+func SaveWebhookDeliveryResult(event *WebhookEvent) error {
+	return DB.Model(&WebhookEvent{}).Where("id = ?", event.Id).Updates(map[string]any{
+		"status":        event.Status,
+		"attempts":      event.Attempts,
+		"response_code": event.ResponseCode,
+		"last_error":    event.LastError,
+		"next_retry_at": event.NextRetryAt,
+		"delivered_at":  event.DeliveredAt,
+	}).Error
+}
+
+func GetUserWebhookEvents(userId int, endpointId int, eventType string, status string, startIdx int, num int) (events []*WebhookEvent, total int64, err error) {
+	tx := DB.Model(&WebhookEvent{}).Where("user_id = ?", userId)
+	if endpointId != 0 {
+		tx = tx.Where("endpoint_id = ?", endpointId)
+	}
+	if eventType != "" {
+		tx = tx.Where("type = ?", eventType)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&events).Error
+	return events, total, err
+}
+
+func GetUserWebhookEventById(id int, userId int) (*WebhookEvent, error) {
+	var event WebhookEvent
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&event).Error
+	return &event, err
+}
+
+// GetDueWebhookEvents 返回待重试的投递记录
+func GetDueWebhookEvents(now int64, limit int) (events []*WebhookEvent, err error) {
+	err = DB.Where("status = ? AND next_retry_at > 0 AND next_retry_at <= ?", WebhookDeliveryPending, now).
+		Order("next_retry_at asc").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func DeleteWebhookEventsBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&WebhookEvent{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,118 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+const discoveryCacheTTL = time.Hour
+
+// OIDCDiscovery is the subset of the OpenID Provider Metadata we use
+type OIDCDiscovery struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	UserInfoEndpoint              string   `json:"userinfo_endpoint"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+type cachedDiscovery struct {
+	doc       *OIDCDiscovery
+	expiresAt time.Time
+}
+
+var discoveryCache sync.Map
+
+// DiscoveryURL returns the discovery document URL, preferring an explicit well-known URL over the issuer
+func DiscoveryURL(issuer string, wellKnown string) string {
+	if wellKnown != "" {
+		return wellKnown
+	}
+	if issuer == "" {
+		return ""
+	}
+	return strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+}
+
+// FetchDiscovery loads an OIDC discovery document, caching it for an hour
+func FetchDiscovery(ctx context.Context, discoveryURL string) (*OIDCDiscovery, error) {
+	if cached, ok := discoveryCache.Load(discoveryURL); ok {
+		entry := cached.(cachedDiscovery)
+		if time.Now().Before(entry.expiresAt) {
+			return entry.doc, nil
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	client := http.Client{
+		Timeout: 10 * time.Second,
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery document returned status %d", res.StatusCode)
+	}
+	doc := &OIDCDiscovery{}
+	if err = json.NewDecoder(res.Body).Decode(doc); err != nil {
+		return nil, err
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document is missing authorization or token endpoint")
+	}
+	discoveryCache.Store(discoveryURL, cachedDiscovery{doc: doc, expiresAt: time.Now().Add(discoveryCacheTTL)})
+	return doc, nil
+}
+
+// ApplyDiscovery fills the endpoints left empty from the provider's discovery document, if one is configured
+func ApplyDiscovery(ctx context.Context, config *model.CustomOAuthProvider) error {
+	discoveryURL := DiscoveryURL(config.Issuer, config.WellKnown)
+	if discoveryURL == "" {
+		return nil
+	}
+	if config.AuthorizationEndpoint != "" && config.TokenEndpoint != "" && config.UserInfoEndpoint != "" {
+		return nil
+	}
+	doc, err := FetchDiscovery(ctx, discoveryURL)
+	if err != nil {
+		return err
+	}
+	if config.AuthorizationEndpoint == "" {
+		config.AuthorizationEndpoint = doc.AuthorizationEndpoint
+	}
+	if config.TokenEndpoint == "" {
+		config.TokenEndpoint = doc.TokenEndpoint
+	}
+	if config.UserInfoEndpoint == "" {
+		config.UserInfoEndpoint = doc.UserInfoEndpoint
+	}
+	if config.Issuer == "" {
+		config.Issuer = doc.Issuer
+	}
+	return nil
+}
+
+// GeneratePKCE returns a random code verifier and its S256 code challenge (RFC 7636)
+func GeneratePKCE() (verifier string, challenge string, err error) {
+	verifier, err = common.GenerateRandomCharsKey(64)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/tidwall/gjson"
 )
@@ -26,6 +27,9 @@ const (
 	AuthStyleInHeader   = 2 // Send as Basic Auth header
 )
 
+// PKCEVerifierSessionKey stores the PKCE code verifier between the state request and the callback
+const PKCEVerifierSessionKey = "oauth_code_verifier"
+
 // GenericOAuthProvider implements OAuth for custom/generic OAuth providers
 type GenericOAuthProvider struct {
 	config *model.CustomOAuthProvider
@@ -60,6 +64,14 @@ func (p *GenericOAuthProvider) ExchangeToken(ctx context.Context, code string, c
 	values.Set("grant_type", "authorization_code")
 	values.Set("code", code)
 	values.Set("redirect_uri", redirectUri)
+	if p.config.UsePKCE {
+		verifier, _ := sessions.Default(c).Get(PKCEVerifierSessionKey).(string)
+		if verifier == "" {
+			logger.LogError(ctx, fmt.Sprintf("[OAuth-Generic-%s] ExchangeToken failed: missing PKCE code verifier", p.config.Slug))
+			return nil, NewOAuthError(i18n.MsgOAuthStateInvalid, nil)
+		}
+		values.Set("code_verifier", verifier)
+	}
 
 	// Determine auth style
 	authStyle := p.config.AuthStyle
@@ -207,6 +219,17 @@ func (p *GenericOAuthProvider) GetUserInfo(ctx context.Context, token *OAuthToke
 	username := gjson.Get(bodyStr, p.config.UsernameField).String()
 	displayName := gjson.Get(bodyStr, p.config.DisplayNameField).String()
 	email := gjson.Get(bodyStr, p.config.EmailField).String()
+	var groups []string
+	if p.config.GroupField != "" {
+		result := gjson.Get(bodyStr, p.config.GroupField)
+		if result.IsArray() {
+			for _, item := range result.Array() {
+				groups = append(groups, item.String())
+			}
+		} else if result.Exists() {
+			groups = append(groups, result.String())
+		}
+	}
 
 	// If user ID field returns a number, convert it
 	if userId == "" {
@@ -224,14 +247,15 @@ func (p *GenericOAuthProvider) GetUserInfo(ctx context.Context, token *OAuthToke
 		return nil, NewOAuthError(i18n.MsgOAuthUserInfoEmpty, map[string]any{"Provider": p.config.Name})
 	}
 
-	logger.LogDebug(ctx, "[OAuth-Generic-%s] GetUserInfo success: id=%s, username=%s, name=%s, email=%s",
-		p.config.Slug, userId, username, displayName, email)
+	logger.LogDebug(ctx, "[OAuth-Generic-%s] GetUserInfo success: id=%s, username=%s, name=%s, email=%s, groups=%v",
+		p.config.Slug, userId, username, displayName, email, groups)
 
 	return &OAuthUser{
 		ProviderUserID: userId,
 		Username:       username,
 		DisplayName:    displayName,
 		Email:          email,
+		Groups:         groups,
 	}, nil
 }
 
@@ -20,6 +20,8 @@ type OAuthUser struct {
 	DisplayName string
 	// Email is the email from the OAuth provider
 	Email string
+	// Groups are the values of the configured group claim (custom providers only)
+	Groups []string
 	// Extra contains any additional provider-specific data
 	Extra map[string]any
 }
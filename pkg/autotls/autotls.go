@@ -0,0 +1,132 @@
+package autotls
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// 内置 HTTPS：通过 ACME 自动申请与续期证书，按 SNI 为多个域名选择证书。
+// HTTP-01 直接使用 autocert（同时支持 TLS-ALPN-01），DNS-01 由本包完成签发流程，可申请通配符证书
+
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+type Config struct {
+	Domains []string
+	Email   string
+	// CacheDir 保存账户密钥与证书，重启后无需重新申请
+	CacheDir string
+	// DirectoryURL 为空时使用 Let's Encrypt 正式环境
+	DirectoryURL string
+	Challenge    string
+	// DNSProvider 仅 DNS-01 使用
+	DNSProvider DNSProvider
+	// PropagationTimeout 等待 TXT 记录生效的最长时间
+	PropagationTimeout time.Duration
+}
+
+type Manager struct {
+	autocert *autocert.Manager
+	dns      *dnsManager
+}
+
+func New(config Config) (*Manager, error) {
+	if len(config.Domains) == 0 {
+		return nil, errors.New("autotls: no domains configured")
+	}
+	for i, domain := range config.Domains {
+		config.Domains[i] = normalizeName(domain)
+	}
+	if config.CacheDir == "" {
+		return nil, errors.New("autotls: cache dir is empty")
+	}
+	if config.DirectoryURL == "" {
+		config.DirectoryURL = acme.LetsEncryptURL
+	}
+	switch config.Challenge {
+	case "", ChallengeHTTP01:
+		for _, domain := range config.Domains {
+			if strings.HasPrefix(domain, "*.") {
+				return nil, fmt.Errorf("autotls: wildcard domain %s requires dns-01", domain)
+			}
+		}
+		return &Manager{autocert: &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(config.CacheDir),
+			HostPolicy: autocert.HostWhitelist(config.Domains...),
+			Email:      config.Email,
+			Client:     &acme.Client{DirectoryURL: config.DirectoryURL},
+		}}, nil
+	case ChallengeDNS01:
+		if config.DNSProvider == nil {
+			return nil, errors.New("autotls: dns-01 requires a dns provider")
+		}
+		if config.PropagationTimeout <= 0 {
+			config.PropagationTimeout = 2 * time.Minute
+		}
+		return &Manager{dns: newDNSManager(config)}, nil
+	default:
+		return nil, fmt.Errorf("autotls: unknown challenge type %s", config.Challenge)
+	}
+}
+
+// Start DNS-01 模式下在后台申请缺失的证书并定期续期，HTTP-01 模式在握手时按需申请
+func (m *Manager) Start() {
+	if m.dns != nil {
+		m.dns.start()
+	}
+}
+
+func (m *Manager) TLSConfig() *tls.Config {
+	var config *tls.Config
+	if m.autocert != nil {
+		config = m.autocert.TLSConfig()
+	} else {
+		config = &tls.Config{
+			GetCertificate: m.dns.getCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+	}
+	config.MinVersion = tls.VersionTLS12
+	return config
+}
+
+// HTTPHandler 在 HTTP 端口上响应 HTTP-01 验证请求，其余请求交给 fallback
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	if m.autocert != nil {
+		return m.autocert.HTTPHandler(fallback)
+	}
+	return fallback
+}
+
+// RedirectHandler 将 HTTP 请求重定向到指定端口上的 HTTPS
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
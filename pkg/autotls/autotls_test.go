@@ -0,0 +1,69 @@
+package autotls
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := New(Config{Domains: []string{"Example.COM."}, CacheDir: dir})
+	require.NoError(t, err)
+	require.NotNil(t, manager.autocert)
+	require.Equal(t, uint16(tls.VersionTLS12), manager.TLSConfig().MinVersion)
+
+	manager, err = New(Config{Domains: []string{"*.example.com"}, CacheDir: dir, Challenge: ChallengeDNS01, DNSProvider: &fakeDNSProvider{}})
+	require.NoError(t, err)
+	require.NotNil(t, manager.dns)
+	require.Equal(t, []string{"h2", "http/1.1"}, manager.TLSConfig().NextProtos)
+
+	for _, config := range []Config{
+		{CacheDir: dir},
+		{Domains: []string{"example.com"}},
+		{Domains: []string{"*.example.com"}, CacheDir: dir},
+		{Domains: []string{"example.com"}, CacheDir: dir, Challenge: ChallengeDNS01},
+		{Domains: []string{"example.com"}, CacheDir: dir, Challenge: "tls-alpn-01"},
+	} {
+		_, err = New(config)
+		require.Error(t, err, config)
+	}
+}
+
+func TestDNSManager_Match(t *testing.T) {
+	m := &dnsManager{config: Config{Domains: []string{"example.com", "*.example.com", "*.api.example.org"}}}
+	require.Equal(t, "example.com", m.match(""))
+	require.Equal(t, "example.com", m.match("example.com"))
+	require.Equal(t, "*.example.com", m.match("www.example.com"))
+	require.Equal(t, "*.api.example.org", m.match("v1.api.example.org"))
+	require.Equal(t, "", m.match("a.b.example.com"))
+	require.Equal(t, "", m.match("api.example.org"))
+	require.Equal(t, "", m.match("example.net"))
+}
+
+func TestCertCacheName(t *testing.T) {
+	require.Equal(t, "example.com+dns01", certCacheName("example.com"))
+	require.Equal(t, "_wildcard.example.com+dns01", certCacheName("*.example.com"))
+}
+
+func TestRedirectHandler(t *testing.T) {
+	for _, tc := range []struct {
+		port   string
+		method string
+		target string
+		code   int
+		want   string
+	}{
+		{"443", http.MethodGet, "http://example.com:8080/a?b=1", http.StatusMovedPermanently, "https://example.com/a?b=1"},
+		{"", http.MethodHead, "http://example.com/", http.StatusMovedPermanently, "https://example.com/"},
+		{"8443", http.MethodPost, "http://example.com/v1/chat", http.StatusPermanentRedirect, "https://example.com:8443/v1/chat"},
+	} {
+		recorder := httptest.NewRecorder()
+		RedirectHandler(tc.port).ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.target, nil))
+		require.Equal(t, tc.code, recorder.Code)
+		require.Equal(t, tc.want, recorder.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,310 @@
+package autotls
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	accountKeyName = "acme_dns01_account+key"
+	// 剩余有效期不足该时长时续期
+	renewBefore   = 30 * 24 * time.Hour
+	renewInterval = 12 * time.Hour
+)
+
+type dnsManager struct {
+	config Config
+	cache  autocert.Cache
+	client *acme.Client
+
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate // 配置的域名 -> 证书
+
+	registerLock sync.Mutex
+	registered   bool
+}
+
+func newDNSManager(config Config) *dnsManager {
+	return &dnsManager{
+		config: config,
+		cache:  autocert.DirCache(config.CacheDir),
+		client: &acme.Client{DirectoryURL: config.DirectoryURL},
+		certs:  make(map[string]*tls.Certificate),
+	}
+}
+
+func (m *dnsManager) start() {
+	go func() {
+		m.renewAll()
+		ticker := time.NewTicker(renewInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.renewAll()
+		}
+	}()
+}
+
+// match 返回覆盖 name 的已配置域名，通配符只匹配一级子域名；SNI 为空时使用第一个域名
+func (m *dnsManager) match(name string) string {
+	if name == "" {
+		return m.config.Domains[0]
+	}
+	if slices.Contains(m.config.Domains, name) {
+		return name
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		wildcard := "*" + name[i:]
+		if slices.Contains(m.config.Domains, wildcard) {
+			return wildcard
+		}
+	}
+	return ""
+}
+
+func (m *dnsManager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := normalizeName(hello.ServerName)
+	domain := m.match(name)
+	if domain == "" {
+		return nil, fmt.Errorf("autotls: host %q not configured", name)
+	}
+	m.mu.RLock()
+	cert := m.certs[domain]
+	m.mu.RUnlock()
+	if cert == nil {
+		return nil, fmt.Errorf("autotls: certificate for %s is not ready", domain)
+	}
+	return cert, nil
+}
+
+func (m *dnsManager) renewAll() {
+	for _, domain := range m.config.Domains {
+		m.mu.RLock()
+		cert := m.certs[domain]
+		m.mu.RUnlock()
+		if cert == nil {
+			// 优先使用缓存中的证书
+			cert, _ = m.loadCert(domain)
+		}
+		if cert != nil && time.Until(cert.Leaf.NotAfter) > renewBefore {
+			m.setCert(domain, cert)
+			continue
+		}
+		common.SysLog("autotls: requesting certificate for " + domain)
+		ctx, cancel := context.WithTimeout(context.Background(), m.config.PropagationTimeout+5*time.Minute)
+		issued, err := m.obtain(ctx, domain)
+		cancel()
+		if err != nil {
+			common.SysError(fmt.Sprintf("autotls: failed to obtain certificate for %s: %s", domain, err.Error()))
+			if cert != nil {
+				// 续期失败时继续使用尚未过期的旧证书
+				m.setCert(domain, cert)
+			}
+			continue
+		}
+		m.setCert(domain, issued)
+		common.SysLog(fmt.Sprintf("autotls: certificate for %s issued, expires at %s", domain, issued.Leaf.NotAfter.Format(time.RFC3339)))
+	}
+}
+
+func (m *dnsManager) setCert(domain string, cert *tls.Certificate) {
+	m.mu.Lock()
+	m.certs[domain] = cert
+	m.mu.Unlock()
+}
+
+func certCacheName(domain string) string {
+	return strings.Replace(domain, "*", "_wildcard", 1) + "+dns01"
+}
+
+func (m *dnsManager) loadCert(domain string) (*tls.Certificate, error) {
+	data, err := m.cache.Get(context.Background(), certCacheName(domain))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// register 注册成功前每次申请都会重试
+func (m *dnsManager) register(ctx context.Context) error {
+	m.registerLock.Lock()
+	defer m.registerLock.Unlock()
+	if m.registered {
+		return nil
+	}
+	key, err := m.accountKey(ctx)
+	if err != nil {
+		return err
+	}
+	m.client.Key = key
+	account := &acme.Account{}
+	if m.config.Email != "" {
+		account.Contact = []string{"mailto:" + m.config.Email}
+	}
+	if _, err = m.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return err
+	}
+	m.registered = true
+	return nil
+}
+
+func (m *dnsManager) accountKey(ctx context.Context) (crypto.Signer, error) {
+	data, err := m.cache.Get(ctx, accountKeyName)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("autotls: invalid account key")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.cache.Put(ctx, accountKeyName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (m *dnsManager) obtain(ctx context.Context, domain string) (*tls.Certificate, error) {
+	if err := m.register(ctx); err != nil {
+		return nil, fmt.Errorf("register account: %w", err)
+	}
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return nil, err
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err = m.authorize(ctx, authzURL); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = m.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	if err != nil {
+		return nil, err
+	}
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	_ = pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, b := range der {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: b})
+	}
+	if err = m.cache.Put(ctx, certCacheName(domain), buf.Bytes()); err != nil {
+		common.SysError("autotls: failed to cache certificate: " + err.Error())
+	}
+	return &tls.Certificate{Certificate: der, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// authorize 写入 _acme-challenge TXT 记录并等待生效后通知 CA 验证，结束后删除记录
+func (m *dnsManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == ChallengeDNS01 {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+	value, err := m.client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+	// 通配符域名的验证记录位于其父域名下
+	fqdn := "_acme-challenge." + authz.Identifier.Value
+	if err = m.config.DNSProvider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("present %s: %w", fqdn, err)
+	}
+	defer func() {
+		if err := m.config.DNSProvider.CleanUp(context.Background(), fqdn, value); err != nil {
+			common.SysError(fmt.Sprintf("autotls: failed to clean up %s: %s", fqdn, err.Error()))
+		}
+	}()
+	waitPropagation(ctx, fqdn, value, m.config.PropagationTimeout)
+	if _, err = m.client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = m.client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// waitPropagation 轮询本机解析结果直到出现 TXT 记录，超时后仍交给 CA 验证
+func waitPropagation(ctx context.Context, fqdn string, value string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		records, _ := net.DefaultResolver.LookupTXT(ctx, fqdn)
+		if slices.Contains(records, value) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			common.SysLog(fmt.Sprintf("autotls: txt record %s not visible after %s, continuing", fqdn, timeout))
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package autotls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type dnsCall struct {
+	action string
+	fqdn   string
+	value  string
+}
+
+// fakeDNSProvider 记录 TXT 记录的创建与删除
+type fakeDNSProvider struct {
+	mu         sync.Mutex
+	calls      []dnsCall
+	presentErr error
+}
+
+func (p *fakeDNSProvider) Present(ctx context.Context, fqdn string, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, dnsCall{"present", fqdn, value})
+	return p.presentErr
+}
+
+func (p *fakeDNSProvider) CleanUp(ctx context.Context, fqdn string, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, dnsCall{"cleanup", fqdn, value})
+	return nil
+}
+
+func (p *fakeDNSProvider) snapshot() []dnsCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]dnsCall(nil), p.calls...)
+}
+
+// fakeACME 只实现 DNS-01 签发流程用到的 RFC 8555 接口，不校验请求签名
+type fakeACME struct {
+	t        *testing.T
+	server   *httptest.Server
+	caKey    *ecdsa.PrivateKey
+	caCert   *x509.Certificate
+	validFor time.Duration
+
+	mu        sync.Mutex
+	identity  string
+	wildcard  bool
+	accepted  bool
+	orders    int
+	issuedDER []byte
+}
+
+func newFakeACME(t *testing.T) *fakeACME {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake acme ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	a := &fakeACME{t: t, caKey: caKey, caCert: caCert, validFor: 90 * 24 * time.Hour}
+	a.server = httptest.NewServer(http.HandlerFunc(a.handle))
+	t.Cleanup(a.server.Close)
+	return a
+}
+
+func (a *fakeACME) url(path string) string {
+	return a.server.URL + path
+}
+
+func (a *fakeACME) reply(w http.ResponseWriter, status int, location string, body any) {
+	if location != "" {
+		w.Header().Set("Location", location)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (a *fakeACME) payload(r *http.Request, v any) {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	require.NoError(a.t, json.NewDecoder(r.Body).Decode(&jws))
+	if jws.Payload == "" || v == nil {
+		return
+	}
+	data, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	require.NoError(a.t, err)
+	require.NoError(a.t, json.Unmarshal(data, v))
+}
+
+func (a *fakeACME) order(status string) map[string]any {
+	order := map[string]any{
+		"status":         status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": a.identity}},
+		"authorizations": []string{a.url("/authz")},
+		"finalize":       a.url("/finalize"),
+	}
+	if status == "valid" {
+		order["certificate"] = a.url("/cert")
+	}
+	return order
+}
+
+func (a *fakeACME) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", "nonce")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch r.URL.Path {
+	case "/directory":
+		a.reply(w, http.StatusOK, "", map[string]any{
+			"newNonce":   a.url("/nonce"),
+			"newAccount": a.url("/account"),
+			"newOrder":   a.url("/order"),
+			"revokeCert": a.url("/revoke"),
+			"keyChange":  a.url("/key-change"),
+			"meta":       map[string]any{"termsOfService": a.url("/tos")},
+		})
+	case "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case "/account":
+		a.payload(r, nil)
+		a.reply(w, http.StatusCreated, a.url("/account/1"), map[string]any{"status": "valid"})
+	case "/order":
+		var req struct {
+			Identifiers []struct {
+				Value string `json:"value"`
+			} `json:"identifiers"`
+		}
+		a.payload(r, &req)
+		require.Len(a.t, req.Identifiers, 1)
+		a.orders++
+		a.accepted = false
+		a.identity = req.Identifiers[0].Value
+		a.wildcard = strings.HasPrefix(a.identity, "*.")
+		a.reply(w, http.StatusCreated, a.url("/order/1"), a.order("pending"))
+	case "/order/1":
+		a.payload(r, nil)
+		status := "pending"
+		if a.accepted {
+			status = "ready"
+		}
+		if a.issuedDER != nil {
+			status = "valid"
+		}
+		a.reply(w, http.StatusOK, a.url("/order/1"), a.order(status))
+	case "/authz":
+		a.payload(r, nil)
+		status := "pending"
+		if a.accepted {
+			status = "valid"
+		}
+		a.reply(w, http.StatusOK, "", map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": strings.TrimPrefix(a.identity, "*.")},
+			"wildcard":   a.wildcard,
+			"challenges": []map[string]string{
+				{"type": "http-01", "url": a.url("/challenge/http"), "token": "http-token", "status": "pending"},
+				{"type": ChallengeDNS01, "url": a.url("/challenge/dns"), "token": "dns-token", "status": status},
+			},
+		})
+	case "/challenge/dns":
+		a.payload(r, nil)
+		a.accepted = true
+		a.reply(w, http.StatusOK, "", map[string]string{"type": ChallengeDNS01, "url": a.url("/challenge/dns"), "token": "dns-token", "status": "valid"})
+	case "/finalize":
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		a.payload(r, &req)
+		der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+		require.NoError(a.t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(a.t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(a.validFor),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		a.issuedDER, err = x509.CreateCertificate(rand.Reader, template, a.caCert, csr.PublicKey, a.caKey)
+		require.NoError(a.t, err)
+		a.reply(w, http.StatusOK, a.url("/order/1"), a.order("valid"))
+	case "/cert":
+		a.payload(r, nil)
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: a.issuedDER})
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: a.caCert.Raw})
+		a.issuedDER = nil
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *fakeACME) orderCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.orders
+}
+
+func newTestDNSManager(t *testing.T, acme *fakeACME, provider DNSProvider, domains ...string) *dnsManager {
+	manager, err := New(Config{
+		Domains:            domains,
+		Email:              "admin@example.test",
+		CacheDir:           t.TempDir(),
+		DirectoryURL:       acme.url("/directory"),
+		Challenge:          ChallengeDNS01,
+		DNSProvider:        provider,
+		PropagationTimeout: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	return manager.dns
+}
+
+func TestDNSManager_Obtain(t *testing.T) {
+	acme := newFakeACME(t)
+	provider := &fakeDNSProvider{}
+	m := newTestDNSManager(t, acme, provider, "*.Example.test.")
+
+	cert, err := m.obtain(context.Background(), "*.example.test")
+	require.NoError(t, err)
+	require.Equal(t, []string{"*.example.test"}, cert.Leaf.DNSNames)
+	require.Len(t, cert.Certificate, 2)
+
+	// 通配符域名的验证记录写在父域名下，验证结束后删除同一条记录
+	value, err := m.client.DNS01ChallengeRecord("dns-token")
+	require.NoError(t, err)
+	require.Equal(t, []dnsCall{
+		{"present", "_acme-challenge.example.test", value},
+		{"cleanup", "_acme-challenge.example.test", value},
+	}, provider.snapshot())
+
+	cached, err := m.loadCert("*.example.test")
+	require.NoError(t, err)
+	require.Equal(t, cert.Leaf.SerialNumber, cached.Leaf.SerialNumber)
+
+	// 账户密钥写入缓存后复用
+	key, err := m.accountKey(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, m.client.Key.Public(), key.Public())
+}
+
+func TestDNSManager_RenewAll(t *testing.T) {
+	acme := newFakeACME(t)
+	provider := &fakeDNSProvider{}
+	m := newTestDNSManager(t, acme, provider, "example.test", "*.example.test")
+
+	_, err := m.getCertificate(&tls.ClientHelloInfo{ServerName: "example.test"})
+	require.ErrorContains(t, err, "not ready")
+
+	m.renewAll()
+	require.Equal(t, 2, acme.orderCount())
+	for _, name := range []string{"example.test", "API.example.test", ""} {
+		cert, err := m.getCertificate(&tls.ClientHelloInfo{ServerName: name})
+		require.NoError(t, err, name)
+		require.NotNil(t, cert, name)
+	}
+	_, err = m.getCertificate(&tls.ClientHelloInfo{ServerName: "a.b.example.test"})
+	require.ErrorContains(t, err, "not configured")
+
+	// 剩余有效期充足时不再申请
+	m.renewAll()
+	require.Equal(t, 2, acme.orderCount())
+
+	// 重启后优先使用缓存中的证书
+	restarted := newDNSManager(m.config)
+	restarted.renewAll()
+	require.Equal(t, 2, acme.orderCount())
+	_, err = restarted.getCertificate(&tls.ClientHelloInfo{ServerName: "example.test"})
+	require.NoError(t, err)
+}
+
+func TestDNSManager_RenewFailureKeepsOldCert(t *testing.T) {
+	acme := newFakeACME(t)
+	acme.validFor = 10 * 24 * time.Hour
+	provider := &fakeDNSProvider{}
+	m := newTestDNSManager(t, acme, provider, "example.test")
+
+	m.renewAll()
+	old, err := m.getCertificate(&tls.ClientHelloInfo{ServerName: "example.test"})
+	require.NoError(t, err)
+
+	provider.mu.Lock()
+	provider.presentErr = errors.New("dns api unavailable")
+	provider.mu.Unlock()
+	m.renewAll()
+	require.Equal(t, 2, acme.orderCount())
+	current, err := m.getCertificate(&tls.ClientHelloInfo{ServerName: "example.test"})
+	require.NoError(t, err)
+	require.Same(t, old, current)
+}
@@ -0,0 +1,156 @@
+package autotls
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DNSProvider 在 DNS 上创建与删除 DNS-01 验证使用的 TXT 记录，fqdn 不带末尾的点
+type DNSProvider interface {
+	Present(ctx context.Context, fqdn string, value string) error
+	CleanUp(ctx context.Context, fqdn string, value string) error
+}
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// CloudflareProvider 使用具有 Zone.DNS 编辑权限的 API Token 管理记录
+type CloudflareProvider struct {
+	token string
+	http  *http.Client
+}
+
+func NewCloudflareProvider(token string) (*CloudflareProvider, error) {
+	if token == "" {
+		return nil, errors.New("autotls: cloudflare api token is empty")
+	}
+	return &CloudflareProvider{token: token, http: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+type cloudflareRecord struct {
+	Id string `json:"id"`
+}
+
+func (p *CloudflareProvider) do(ctx context.Context, method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cloudflareAPI+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %w", err)
+	}
+	defer resp.Body.Close()
+	var response cloudflareResponse
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&response); err != nil {
+		return fmt.Errorf("cloudflare: status %d: %w", resp.StatusCode, err)
+	}
+	if !response.Success {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			messages = append(messages, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("cloudflare: status %d: %s", resp.StatusCode, strings.Join(messages, "; "))
+	}
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+	return nil
+}
+
+// zoneId 从记录名逐级向上查找所属的 zone
+func (p *CloudflareProvider) zoneId(ctx context.Context, fqdn string) (string, error) {
+	for name := fqdn; strings.Contains(name, "."); name = name[strings.IndexByte(name, '.')+1:] {
+		var zones []cloudflareRecord
+		if err := p.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(name), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].Id, nil
+		}
+	}
+	return "", fmt.Errorf("cloudflare: no zone found for %s", fqdn)
+}
+
+func (p *CloudflareProvider) Present(ctx context.Context, fqdn string, value string) error {
+	zone, err := p.zoneId(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	record := map[string]any{"type": "TXT", "name": fqdn, "content": value, "ttl": 120}
+	return p.do(ctx, http.MethodPost, "/zones/"+zone+"/dns_records", record, nil)
+}
+
+func (p *CloudflareProvider) CleanUp(ctx context.Context, fqdn string, value string) error {
+	zone, err := p.zoneId(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"type": {"TXT"}, "name": {fqdn}, "content": {value}}
+	var records []cloudflareRecord
+	if err = p.do(ctx, http.MethodGet, "/zones/"+zone+"/dns_records?"+query.Encode(), nil, &records); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err = p.do(ctx, http.MethodDelete, "/zones/"+zone+"/dns_records/"+record.Id, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecProvider 调用外部脚本管理记录，参数依次为 present 或 cleanup、记录名与记录值，
+// 用于对接未内置的 DNS 服务商
+type ExecProvider struct {
+	command string
+}
+
+func NewExecProvider(command string) (*ExecProvider, error) {
+	if command == "" {
+		return nil, errors.New("autotls: exec command is empty")
+	}
+	return &ExecProvider{command: command}, nil
+}
+
+func (p *ExecProvider) run(ctx context.Context, action string, fqdn string, value string) error {
+	output, err := exec.CommandContext(ctx, p.command, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", p.command, action, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (p *ExecProvider) Present(ctx context.Context, fqdn string, value string) error {
+	return p.run(ctx, "present", fqdn, value)
+}
+
+func (p *ExecProvider) CleanUp(ctx context.Context, fqdn string, value string) error {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
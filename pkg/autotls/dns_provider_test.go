@@ -0,0 +1,138 @@
+package autotls
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rewriteTransport 将发往 Cloudflare API 的请求转到测试服务器
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+type cloudflareCall struct {
+	method string
+	path   string
+	body   map[string]any
+}
+
+func newTestCloudflare(t *testing.T, zone string) (*CloudflareProvider, func() []cloudflareCall) {
+	var mu sync.Mutex
+	var calls []cloudflareCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer cf-token", r.Header.Get("Authorization"))
+		call := cloudflareCall{method: r.Method, path: r.URL.RequestURI()}
+		_ = json.NewDecoder(r.Body).Decode(&call.body)
+		mu.Lock()
+		calls = append(calls, call)
+		mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/client/v4")
+		var result any = map[string]any{}
+		switch {
+		case path == "/zones":
+			zones := []map[string]string{}
+			if r.URL.Query().Get("name") == zone {
+				zones = append(zones, map[string]string{"id": "zone-1"})
+			}
+			result = zones
+		case path == "/zones/zone-1/dns_records" && r.Method == http.MethodGet:
+			result = []map[string]string{{"id": "rec-1"}, {"id": "rec-2"}}
+		case path == "/zones/zone-1/dns_records/rec-2" && r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "result": result})
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewCloudflareProvider("cf-token")
+	require.NoError(t, err)
+	target, _ := url.Parse(server.URL)
+	provider.http = &http.Client{Transport: &rewriteTransport{target: target}}
+	return provider, func() []cloudflareCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]cloudflareCall(nil), calls...)
+	}
+}
+
+func TestCloudflareProvider_Present(t *testing.T) {
+	provider, calls := newTestCloudflare(t, "example.com")
+	require.NoError(t, provider.Present(context.Background(), "_acme-challenge.www.example.com", "txt-value"))
+
+	got := calls()
+	require.Len(t, got, 4)
+	// 逐级向上查找所属 zone
+	require.Equal(t, "/client/v4/zones?name=_acme-challenge.www.example.com", got[0].path)
+	require.Equal(t, "/client/v4/zones?name=www.example.com", got[1].path)
+	require.Equal(t, "/client/v4/zones?name=example.com", got[2].path)
+	require.Equal(t, http.MethodPost, got[3].method)
+	require.Equal(t, "/client/v4/zones/zone-1/dns_records", got[3].path)
+	require.Equal(t, map[string]any{"type": "TXT", "name": "_acme-challenge.www.example.com", "content": "txt-value", "ttl": float64(120)}, got[3].body)
+}
+
+func TestCloudflareProvider_CleanUp(t *testing.T) {
+	provider, calls := newTestCloudflare(t, "example.com")
+	err := provider.CleanUp(context.Background(), "_acme-challenge.example.com", "a b&c")
+	require.EqualError(t, err, "cloudflare: status 403: 10000 Authentication error")
+
+	got := calls()
+	require.Len(t, got, 5)
+	query, err := url.ParseQuery(strings.SplitN(got[2].path, "?", 2)[1])
+	require.NoError(t, err)
+	require.Equal(t, "a b&c", query.Get("content"))
+	require.Equal(t, "TXT", query.Get("type"))
+	require.Equal(t, http.MethodDelete, got[3].method)
+	require.Equal(t, "/client/v4/zones/zone-1/dns_records/rec-1", got[3].path)
+	require.Equal(t, "/client/v4/zones/zone-1/dns_records/rec-2", got[4].path)
+}
+
+func TestCloudflareProvider_NoZone(t *testing.T) {
+	provider, _ := newTestCloudflare(t, "example.com")
+	err := provider.Present(context.Background(), "_acme-challenge.example.org", "v")
+	require.EqualError(t, err, "cloudflare: no zone found for _acme-challenge.example.org")
+
+	_, err = NewCloudflareProvider("")
+	require.Error(t, err)
+}
+
+func TestExecProvider(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "dns-hook.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n[ \"$3\" = \"fail\" ] && { echo boom; exit 1; }\necho \"$1 $2 $3\" >> "+output+"\n"), 0o755))
+
+	provider, err := NewExecProvider(script)
+	require.NoError(t, err)
+	require.NoError(t, provider.Present(context.Background(), "_acme-challenge.example.com", "v1"))
+	require.NoError(t, provider.CleanUp(context.Background(), "_acme-challenge.example.com", "v1"))
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	require.Equal(t, "present _acme-challenge.example.com v1\ncleanup _acme-challenge.example.com v1\n", string(data))
+
+	err = provider.Present(context.Background(), "_acme-challenge.example.com", "fail")
+	require.ErrorContains(t, err, "present")
+	require.ErrorContains(t, err, "boom")
+
+	_, err = NewExecProvider("")
+	require.Error(t, err)
+}
@@ -21,7 +21,7 @@ type HybridCacheConfig[V any] struct {
 	Namespace Namespace
 
 	// Redis is used when RedisEnabled returns true (or RedisEnabled is nil) and Redis is not nil.
-	Redis        *redis.Client
+	Redis        redis.UniversalClient
 	RedisCodec   ValueCodec[V]
 	RedisEnabled func() bool
 
@@ -33,7 +33,7 @@ type HybridCacheConfig[V any] struct {
 type HybridCache[V any] struct {
 	ns Namespace
 
-	redis        *redis.Client
+	redis        redis.UniversalClient
 	redisCodec   ValueCodec[V]
 	redisEnabled func() bool
 
@@ -139,11 +139,32 @@ func (c *HybridCache[V]) Keys() ([]string, error) {
 func (c *HybridCache[V]) scanKeys(match string) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultRedisScanTimeout)
 	defer cancel()
+	return ScanKeys(ctx, c.redis, match)
+}
+
+// ScanKeys 返回匹配的全部键，集群模式下 SCAN 只作用于单个节点，需要逐个扫描主节点
+func ScanKeys(ctx context.Context, client redis.UniversalClient, match string) ([]string, error) {
+	cluster, ok := client.(*redis.ClusterClient)
+	if !ok {
+		return scanNodeKeys(ctx, client, match)
+	}
+	var mu sync.Mutex
+	keys := make([]string, 0, 1024)
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		k, err := scanNodeKeys(ctx, node, match)
+		mu.Lock()
+		keys = append(keys, k...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
 
+func scanNodeKeys(ctx context.Context, client redis.UniversalClient, match string) ([]string, error) {
 	var cursor uint64
 	keys := make([]string, 0, 1024)
 	for {
-		k, next, err := c.redis.Scan(ctx, cursor, match, 1000).Result()
+		k, next, err := client.Scan(ctx, cursor, match, 1000).Result()
 		if err != nil {
 			return keys, err
 		}
@@ -0,0 +1,174 @@
+package clickhouse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 通过 ClickHouse 的 HTTP 接口执行语句，只覆盖建表、JSONEachRow 写入与查询
+
+// 查询结果单行的上限
+const maxRowSize = 16 << 20
+
+type Config struct {
+	// DSN 形如 http(s)://user:password@host:8123/database，数据库为空时使用 default
+	DSN     string
+	Timeout time.Duration
+}
+
+type Client struct {
+	endpoint string
+	database string
+	username string
+	password string
+	http     *http.Client
+}
+
+func NewClient(config Config) (*Client, error) {
+	u, err := url.Parse(config.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: invalid dsn: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("clickhouse: dsn scheme must be http or https")
+	}
+	if u.Host == "" {
+		return nil, errors.New("clickhouse: dsn host is empty")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	client := &Client{
+		endpoint: u.Scheme + "://" + u.Host + "/",
+		database: strings.Trim(u.Path, "/"),
+		http:     &http.Client{Timeout: config.Timeout},
+	}
+	if client.database == "" {
+		client.database = "default"
+	}
+	if u.User != nil {
+		client.username = u.User.Username()
+		client.password, _ = u.User.Password()
+	}
+	return client, nil
+}
+
+func (c *Client) Database() string {
+	return c.database
+}
+
+// do 发送请求，settings 与 params 作为 URL 参数，params 对应语句中的 {name:Type} 占位符
+func (c *Client) do(ctx context.Context, query string, body io.Reader, settings map[string]string, params map[string]any) (*http.Response, error) {
+	values := url.Values{}
+	values.Set("database", c.database)
+	for key, value := range settings {
+		values.Set(key, value)
+	}
+	for key, value := range params {
+		values.Set("param_"+key, fmt.Sprint(value))
+	}
+	if body == nil {
+		body = strings.NewReader(query)
+	} else {
+		values.Set("query", query)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"?"+values.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.Header.Set("X-ClickHouse-User", c.username)
+		req.Header.Set("X-ClickHouse-Key", c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("clickhouse: status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Exec(ctx, "SELECT 1", nil)
+}
+
+func (c *Client) Exec(ctx context.Context, query string, params map[string]any) error {
+	resp, err := c.do(ctx, query, nil, nil, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Insert 以 JSONEachRow 格式写入，使用服务端异步写入并等待落盘确认
+func (c *Client) Insert(ctx context.Context, table string, rows []any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return fmt.Errorf("clickhouse: encode row: %w", err)
+		}
+	}
+	settings := map[string]string{
+		"async_insert":          "1",
+		"wait_for_async_insert": "1",
+	}
+	resp, err := c.do(ctx, "INSERT INTO "+table+" FORMAT JSONEachRow", &buf, settings, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Query 以 JSONEachRow 格式读取结果，每行调用一次 scan
+func (c *Client) Query(ctx context.Context, query string, params map[string]any, scan func(row []byte) error) error {
+	settings := map[string]string{
+		"default_format": "JSONEachRow",
+		// 64 位整数默认以字符串输出
+		"output_format_json_quote_64bit_integers": "0",
+	}
+	resp, err := c.do(ctx, query, nil, settings, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRowSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		// 查询中途出错时服务端仍返回 200，错误信息追加在结果末尾
+		if line[0] != '{' {
+			return fmt.Errorf("clickhouse: %s", line)
+		}
+		if err = scan(line); err != nil {
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("clickhouse: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package clickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type capturedRequest struct {
+	query  url.Values
+	header http.Header
+	body   string
+}
+
+// newTestServer 记录收到的请求并返回固定的状态码与响应体
+func newTestServer(t *testing.T, status int, response string) (*Client, *capturedRequest) {
+	captured := &capturedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		body, _ := io.ReadAll(r.Body)
+		captured.query = r.URL.Query()
+		captured.header = r.Header.Clone()
+		captured.body = string(body)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	u, _ := url.Parse(server.URL)
+	u.User = url.UserPassword("reader", "p@ss:word")
+	u.Path = "/analytics"
+	client, err := NewClient(Config{DSN: u.String()})
+	require.NoError(t, err)
+	return client, captured
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient(Config{DSN: "https://ch.example.com:8443"})
+	require.NoError(t, err)
+	require.Equal(t, "default", client.Database())
+	require.Equal(t, "https://ch.example.com:8443/", client.endpoint)
+	require.Empty(t, client.username)
+
+	for _, dsn := range []string{"tcp://ch.example.com:9000", "http://", "://bad"} {
+		_, err = NewClient(Config{DSN: dsn})
+		require.Error(t, err, dsn)
+	}
+}
+
+func TestExec(t *testing.T) {
+	client, captured := newTestServer(t, http.StatusOK, "")
+	require.NoError(t, client.Exec(context.Background(), "ALTER TABLE logs DELETE WHERE user_id = {user_id:Int64}", map[string]any{"user_id": 42}))
+
+	require.Equal(t, "ALTER TABLE logs DELETE WHERE user_id = {user_id:Int64}", captured.body)
+	require.Equal(t, "analytics", captured.query.Get("database"))
+	require.Equal(t, "42", captured.query.Get("param_user_id"))
+	require.False(t, captured.query.Has("query"))
+	require.Equal(t, "reader", captured.header.Get("X-ClickHouse-User"))
+	require.Equal(t, "p@ss:word", captured.header.Get("X-ClickHouse-Key"))
+}
+
+// 参数值只通过 URL 参数传递，不会拼进语句
+func TestParamsEscaping(t *testing.T) {
+	client, captured := newTestServer(t, http.StatusOK, "")
+	value := "a' OR 1=1 --\\&database=system&param_x=1\n中文"
+	require.NoError(t, client.Exec(context.Background(), "SELECT * FROM logs WHERE username = {username:String}", map[string]any{"username": value}))
+
+	require.Equal(t, value, captured.query.Get("param_username"))
+	require.Equal(t, []string{"analytics"}, captured.query["database"])
+	require.False(t, captured.query.Has("param_x"))
+	require.NotContains(t, captured.body, "OR 1=1")
+}
+
+func TestInsert(t *testing.T) {
+	client, captured := newTestServer(t, http.StatusOK, "")
+	require.NoError(t, client.Insert(context.Background(), "logs", nil))
+	require.Nil(t, captured.query)
+
+	rows := []any{
+		map[string]any{"id": 1, "content": "line\n\"quoted\""},
+		struct {
+			Id int `json:"id"`
+		}{Id: 2},
+	}
+	require.NoError(t, client.Insert(context.Background(), "logs", rows))
+	require.Equal(t, "INSERT INTO logs FORMAT JSONEachRow", captured.query.Get("query"))
+	require.Equal(t, "1", captured.query.Get("async_insert"))
+	require.Equal(t, "1", captured.query.Get("wait_for_async_insert"))
+	require.Equal(t, "{\"content\":\"line\\n\\\"quoted\\\"\",\"id\":1}\n{\"id\":2}\n", captured.body)
+
+	err := client.Insert(context.Background(), "logs", []any{func() {}})
+	require.ErrorContains(t, err, "encode row")
+}
+
+func TestQuery(t *testing.T) {
+	client, captured := newTestServer(t, http.StatusOK, "{\"total\":1}\n\n{\"total\":2}\n")
+	var rows []string
+	err := client.Query(context.Background(), "SELECT count() AS total FROM logs", nil, func(row []byte) error {
+		rows = append(rows, string(row))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"total":1}`, `{"total":2}`}, rows)
+	require.Equal(t, "JSONEachRow", captured.query.Get("default_format"))
+	require.Equal(t, "0", captured.query.Get("output_format_json_quote_64bit_integers"))
+}
+
+func TestQuery_Errors(t *testing.T) {
+	// 查询中途出错时错误信息追加在结果末尾
+	client, _ := newTestServer(t, http.StatusOK, "{\"total\":1}\nCode: 241. DB::Exception: Memory limit exceeded\n")
+	count := 0
+	err := client.Query(context.Background(), "SELECT 1", nil, func(row []byte) error {
+		count++
+		return nil
+	})
+	require.EqualError(t, err, "clickhouse: Code: 241. DB::Exception: Memory limit exceeded")
+	require.Equal(t, 1, count)
+
+	client, _ = newTestServer(t, http.StatusBadRequest, "Code: 62. DB::Exception: Syntax error\n")
+	err = client.Query(context.Background(), "SELEC 1", nil, func(row []byte) error { return nil })
+	require.EqualError(t, err, "clickhouse: status 400: Code: 62. DB::Exception: Syntax error")
+
+	client, _ = newTestServer(t, http.StatusOK, "{}\n")
+	err = client.Query(context.Background(), "SELECT 1", nil, func(row []byte) error { return io.ErrUnexpectedEOF })
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,404 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const defaultMaxDepth = 10
+
+// Object 对象类型，字段按名称查找
+type Object struct {
+	Name   string
+	Fields map[string]*FieldDef
+}
+
+// FieldDef 字段定义，Type 为空表示标量字段
+type FieldDef struct {
+	Type       *Object
+	Permission string      // 读取该字段需要的权限，根查询字段必填，其余为空时不额外校验
+	Resolve    ResolveFunc // 为空时按 json 标签读取来源对象中的同名字段
+}
+
+type ResolveParams struct {
+	Context context.Context
+	Source  any
+	Args    Args
+}
+
+type ResolveFunc func(p ResolveParams) (any, error)
+
+// Schema 只读查询的入口，Authorize 判断当前调用者是否拥有字段要求的权限
+type Schema struct {
+	Query     *Object
+	Authorize func(ctx context.Context, permission string) bool
+	MaxDepth  int
+}
+
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+type Response struct {
+	Data   any      `json:"data"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// orderedMap 按查询中字段出现的顺序输出 JSON
+type orderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{values: map[string]any{}}
+}
+
+func (m *orderedMap) set(key string, value any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type execution struct {
+	ctx       context.Context
+	schema    *Schema
+	doc       *Document
+	variables map[string]any
+	errors    []*Error
+}
+
+func (e *execution) addError(path []any, format string, args ...any) {
+	e.errors = append(e.errors, &Error{Message: fmt.Sprintf(format, args...), Path: append([]any(nil), path...)})
+}
+
+// Execute 解析并执行查询，字段级错误写入 errors，对应字段返回 null
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	if op.Type != "query" {
+		return &Response{Errors: []*Error{{Message: fmt.Sprintf("graphql: %s operations are not supported", op.Type)}}}
+	}
+	variables := make(map[string]any, len(op.Variables))
+	for _, definition := range op.Variables {
+		if value, ok := req.Variables[definition.Name]; ok {
+			variables[definition.Name] = value
+		} else {
+			variables[definition.Name] = definition.Default
+		}
+	}
+	e := &execution{ctx: ctx, schema: s, doc: doc, variables: variables}
+	data := e.executeSelections(s.Query, nil, op.Selections, nil, 1)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, fmt.Errorf("graphql: operationName is required when the document has multiple operations")
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("graphql: unknown operation %q", name)
+}
+
+func (e *execution) resolveValue(value any) any {
+	switch v := value.(type) {
+	case Variable:
+		return e.variables[string(v)]
+	case EnumValue:
+		return string(v)
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = e.resolveValue(item)
+		}
+		return list
+	case map[string]any:
+		object := make(map[string]any, len(v))
+		for key, item := range v {
+			object[key] = e.resolveValue(item)
+		}
+		return object
+	}
+	return value
+}
+
+// included 处理 @skip 与 @include 指令
+func (e *execution) included(directives []*Directive) bool {
+	for _, directive := range directives {
+		condition, _ := e.resolveValue(directive.Arguments["if"]).(bool)
+		if directive.Name == "skip" && condition {
+			return false
+		}
+		if directive.Name == "include" && !condition {
+			return false
+		}
+	}
+	return true
+}
+
+// collectFields 展开片段并合并同名字段的子选择集
+func (e *execution) collectFields(object *Object, selections []Selection, fields *[]*Field, index map[string]*Field, visited map[string]bool) {
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *Field:
+			if !e.included(s.Directives) {
+				continue
+			}
+			if existing, ok := index[s.ResponseKey()]; ok {
+				merged := *existing
+				merged.Selections = append(append([]Selection(nil), existing.Selections...), s.Selections...)
+				*existing = merged
+				continue
+			}
+			field := *s
+			index[s.ResponseKey()] = &field
+			*fields = append(*fields, &field)
+		case *FragmentSpread:
+			fragment, ok := e.doc.Fragments[s.Name]
+			if !ok || visited[s.Name] || !e.included(s.Directives) {
+				continue
+			}
+			if fragment.TypeCondition != object.Name {
+				continue
+			}
+			visited[s.Name] = true
+			e.collectFields(object, fragment.Selections, fields, index, visited)
+			delete(visited, s.Name)
+		case *InlineFragment:
+			if !e.included(s.Directives) || (s.TypeCondition != "" && s.TypeCondition != object.Name) {
+				continue
+			}
+			e.collectFields(object, s.Selections, fields, index, visited)
+		}
+	}
+}
+
+func (e *execution) executeSelections(object *Object, source any, selections []Selection, path []any, depth int) *orderedMap {
+	maxDepth := e.schema.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxDepth
+	}
+	result := newOrderedMap()
+	if depth > maxDepth {
+		e.addError(path, "graphql: query exceeds max depth %d", maxDepth)
+		return result
+	}
+	var fields []*Field
+	e.collectFields(object, selections, &fields, map[string]*Field{}, map[string]bool{})
+	for _, field := range fields {
+		key := field.ResponseKey()
+		fieldPath := append(append([]any(nil), path...), key)
+		if field.Name == "__typename" {
+			result.set(key, object.Name)
+			continue
+		}
+		def, ok := object.Fields[field.Name]
+		if !ok {
+			e.addError(fieldPath, "graphql: cannot query field %q on type %q", field.Name, object.Name)
+			result.set(key, nil)
+			continue
+		}
+		// 根查询字段必须显式声明权限，避免新增字段时遗漏校验
+		if def.Permission == "" && object == e.schema.Query {
+			e.addError(fieldPath, "graphql: field %q does not declare a permission", field.Name)
+			result.set(key, nil)
+			continue
+		}
+		if def.Permission != "" && (e.schema.Authorize == nil || !e.schema.Authorize(e.ctx, def.Permission)) {
+			e.addError(fieldPath, "graphql: permission %s is required for field %q", def.Permission, field.Name)
+			result.set(key, nil)
+			continue
+		}
+		result.set(key, e.executeField(def, field, source, fieldPath, depth))
+	}
+	return result
+}
+
+func (e *execution) executeField(def *FieldDef, field *Field, source any, path []any, depth int) any {
+	args := make(Args, len(field.Arguments))
+	for name, value := range field.Arguments {
+		args[name] = e.resolveValue(value)
+	}
+	var value any
+	var err error
+	if def.Resolve != nil {
+		value, err = def.Resolve(ResolveParams{Context: e.ctx, Source: source, Args: args})
+	} else {
+		value = lookupField(source, field.Name)
+	}
+	if err != nil {
+		e.addError(path, "%s", err.Error())
+		return nil
+	}
+	if def.Type == nil {
+		if len(field.Selections) > 0 {
+			e.addError(path, "graphql: field %q is a scalar and cannot have a selection set", field.Name)
+			return nil
+		}
+		return value
+	}
+	if len(field.Selections) == 0 {
+		e.addError(path, "graphql: field %q of type %q must have a selection set", field.Name, def.Type.Name)
+		return nil
+	}
+	return e.completeObject(def.Type, value, field.Selections, path, depth+1)
+}
+
+func (e *execution) completeObject(object *Object, value any, selections []Selection, path []any, depth int) any {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || ((rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice) && rv.IsNil()) {
+		return nil
+	}
+	if rv.Kind() == reflect.Slice {
+		list := make([]any, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			list[i] = e.completeObject(object, rv.Index(i).Interface(), selections, append(append([]any(nil), path...), i), depth)
+		}
+		return list
+	}
+	return e.executeSelections(object, value, selections, path, depth)
+}
+
+// lookupField 读取 map 中的键或结构体中 json 标签与名称一致的字段
+func lookupField(source any, name string) any {
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		value := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !value.IsValid() {
+			return nil
+		}
+		return value.Interface()
+	case reflect.Struct:
+		return lookupStructField(rv, name)
+	}
+	return nil
+}
+
+func lookupStructField(rv reflect.Value, name string) any {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := rv.Field(i)
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if value := lookupStructField(embedded, name); value != nil {
+					return value
+				}
+			}
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == name || (tag == "" && field.Name == name) {
+			return rv.Field(i).Interface()
+		}
+	}
+	return nil
+}
+
+// Args 字段参数，数值可能来自查询字面量（int64/float64）或 JSON 变量（float64）
+type Args map[string]any
+
+func (a Args) Int(name string, def int) int {
+	switch v := a[name].(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return def
+}
+
+func (a Args) Int64(name string, def int64) int64 {
+	switch v := a[name].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case int:
+		return int64(v)
+	}
+	return def
+}
+
+func (a Args) String(name string, def string) string {
+	if v, ok := a[name].(string); ok {
+		return v
+	}
+	return def
+}
+
+func (a Args) Bool(name string, def bool) bool {
+	if v, ok := a[name].(bool); ok {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,159 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testUser struct {
+	Id    int    `json:"id"`
+	Name  string `json:"name"`
+	Quota int    `json:"quota"`
+}
+
+func newTestSchema(granted ...string) *Schema {
+	user := &Object{
+		Name: "User",
+		Fields: map[string]*FieldDef{
+			"id":    {},
+			"name":  {},
+			"quota": {Permission: "billing:manage"},
+		},
+	}
+	user.Fields["friend"] = &FieldDef{
+		Type: user,
+		Resolve: func(p ResolveParams) (any, error) {
+			return &testUser{Id: p.Source.(*testUser).Id + 1, Name: "friend"}, nil
+		},
+	}
+	return &Schema{
+		Query: &Object{
+			Name: "Query",
+			Fields: map[string]*FieldDef{
+				"user": {
+					Type:       user,
+					Permission: "users:manage",
+					Resolve: func(p ResolveParams) (any, error) {
+						return &testUser{Id: p.Args.Int("id", 0), Name: "alice", Quota: 100}, nil
+					},
+				},
+				"users": {
+					Type:       user,
+					Permission: "users:manage",
+					Resolve: func(p ResolveParams) (any, error) {
+						return []*testUser{{Id: 1, Name: "a"}, {Id: 2, Name: "b"}}, nil
+					},
+				},
+				"broken": {
+					Permission: "users:manage",
+					Resolve: func(p ResolveParams) (any, error) {
+						return nil, errors.New("resolver failed")
+					},
+				},
+				"undeclared": {
+					Resolve: func(p ResolveParams) (any, error) {
+						return "secret", nil
+					},
+				},
+			},
+		},
+		Authorize: func(ctx context.Context, permission string) bool {
+			for _, g := range granted {
+				if g == permission {
+					return true
+				}
+			}
+			return false
+		},
+		MaxDepth: 3,
+	}
+}
+
+func executeJSON(t *testing.T, schema *Schema, req Request) (string, []*Error) {
+	resp := schema.Execute(context.Background(), req)
+	data, err := json.Marshal(resp.Data)
+	require.NoError(t, err)
+	return string(data), resp.Errors
+}
+
+func TestExecute(t *testing.T) {
+	schema := newTestSchema("users:manage", "billing:manage")
+	data, errs := executeJSON(t, schema, Request{
+		Query:     `query ($id: Int) { u: user(id: $id) { name ...F __typename } users { id } } fragment F on User { id quota }`,
+		Variables: map[string]any{"id": float64(7)},
+	})
+	require.Empty(t, errs)
+	require.Equal(t, `{"u":{"name":"alice","id":7,"quota":100,"__typename":"User"},"users":[{"id":1},{"id":2}]}`, data)
+}
+
+func TestExecute_Directives(t *testing.T) {
+	schema := newTestSchema("users:manage")
+	data, errs := executeJSON(t, schema, Request{
+		Query:     `query ($hide: Boolean) { user(id: 1) { id name @skip(if: $hide) quota @include(if: false) } }`,
+		Variables: map[string]any{"hide": true},
+	})
+	require.Empty(t, errs)
+	require.Equal(t, `{"user":{"id":1}}`, data)
+}
+
+func TestExecute_PermissionDenied(t *testing.T) {
+	schema := newTestSchema("users:manage")
+	data, errs := executeJSON(t, schema, Request{Query: `{ user(id: 1) { id quota } }`})
+	require.Equal(t, `{"user":{"id":1,"quota":null}}`, data)
+	require.Len(t, errs, 1)
+	require.Equal(t, []any{"user", "quota"}, errs[0].Path)
+
+	data, errs = executeJSON(t, newTestSchema(), Request{Query: `{ user(id: 1) { id } }`})
+	require.Equal(t, `{"user":null}`, data)
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Message, "users:manage")
+}
+
+func TestExecute_RootFieldWithoutPermission(t *testing.T) {
+	schema := newTestSchema("users:manage")
+	data, errs := executeJSON(t, schema, Request{Query: `{ undeclared }`})
+	require.Equal(t, `{"undeclared":null}`, data)
+	require.Len(t, errs, 1)
+}
+
+func TestExecute_MaxDepth(t *testing.T) {
+	schema := newTestSchema("users:manage")
+	_, errs := executeJSON(t, schema, Request{Query: `{ user(id: 1) { friend { id } } }`})
+	require.Empty(t, errs)
+
+	data, errs := executeJSON(t, schema, Request{Query: `{ user(id: 1) { friend { friend { id } } } }`})
+	require.Equal(t, `{"user":{"friend":{"friend":{}}}}`, data)
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Message, "max depth")
+}
+
+func TestExecute_FragmentCycle(t *testing.T) {
+	schema := newTestSchema("users:manage")
+	data, errs := executeJSON(t, schema, Request{
+		Query: `{ user(id: 1) { ...A } } fragment A on User { id ...B } fragment B on User { name ...A }`,
+	})
+	require.Empty(t, errs)
+	require.Equal(t, `{"user":{"id":1,"name":"alice"}}`, data)
+}
+
+func TestExecute_Errors(t *testing.T) {
+	schema := newTestSchema("users:manage")
+	for _, req := range []Request{
+		{Query: `mutation { user { id } }`},
+		{Query: `query A { user { id } } query B { users { id } }`},
+		{Query: `query A { user { id } }`, OperationName: "B"},
+		{Query: `{ user(`},
+	} {
+		resp := schema.Execute(context.Background(), req)
+		require.Nil(t, resp.Data, req.Query)
+		require.Len(t, resp.Errors, 1, req.Query)
+	}
+
+	data, errs := executeJSON(t, schema, Request{Query: `{ broken missing user { id { x } } users }`})
+	require.Equal(t, `{"broken":null,"missing":null,"user":{"id":null},"users":null}`, data)
+	require.Len(t, errs, 4)
+}
@@ -0,0 +1,74 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# 列出渠道
+		query Channels($page: Int = 1, $ids: [Int!]) {
+			list: channels(page: $page, status: ENABLED, name: "a\"b中", weight: -1.5e2, tags: [1, 2], filter: {id: 3}) {
+				total
+				items @include(if: true) { ...ChannelFields }
+			}
+		}
+		fragment ChannelFields on Channel { id, name }
+	`)
+	require.NoError(t, err)
+	require.Len(t, doc.Operations, 1)
+	op := doc.Operations[0]
+	require.Equal(t, "query", op.Type)
+	require.Equal(t, "Channels", op.Name)
+	require.Len(t, op.Variables, 2)
+	require.Equal(t, int64(1), op.Variables[0].Default)
+
+	field := op.Selections[0].(*Field)
+	require.Equal(t, "list", field.ResponseKey())
+	require.Equal(t, "channels", field.Name)
+	require.Equal(t, Variable("page"), field.Arguments["page"])
+	require.Equal(t, EnumValue("ENABLED"), field.Arguments["status"])
+	require.Equal(t, "a\"b中", field.Arguments["name"])
+	require.Equal(t, -150.0, field.Arguments["weight"])
+	require.Equal(t, []any{int64(1), int64(2)}, field.Arguments["tags"])
+	require.Equal(t, map[string]any{"id": int64(3)}, field.Arguments["filter"])
+
+	items := field.Selections[1].(*Field)
+	require.Equal(t, "include", items.Directives[0].Name)
+	require.Equal(t, "ChannelFields", items.Selections[0].(*FragmentSpread).Name)
+	require.Equal(t, "Channel", doc.Fragments["ChannelFields"].TypeCondition)
+}
+
+func TestParse_Shorthand(t *testing.T) {
+	doc, err := Parse(`{ user(id: 1) { id ... on User { name } } }`)
+	require.NoError(t, err)
+	require.Equal(t, "query", doc.Operations[0].Type)
+	user := doc.Operations[0].Selections[0].(*Field)
+	require.Equal(t, "User", user.Selections[1].(*InlineFragment).TypeCondition)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`fragment F on User { id }`,
+		`{ }`,
+		`{ user(id: 1 }`,
+		`{ user { id }`,
+		`{ name: }`,
+		`{ user(name: "abc) { id } }`,
+		`{ user(name: "a\q") { id } }`,
+		`{ user(name: """block""") { id } }`,
+		`{ user(id: 1.) { id } }`,
+		`{ user(id: 1e) { id } }`,
+		`query ($id: Int = $other) { user(id: $id) { id } }`,
+		`{ user { ...F } } fragment F on User { id } fragment F on User { name }`,
+		`{ user { ...F } } fragment on on User { id }`,
+		`{ a.b }`,
+		`{ user % }`,
+	} {
+		_, err := Parse(src)
+		require.Error(t, err, src)
+	}
+}
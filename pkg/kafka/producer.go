@@ -0,0 +1,318 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Brokers  []string // 引导节点，host:port
+	ClientID string
+	Timeout  time.Duration
+	TLS      *tls.Config // 为空时使用明文连接
+	Username string      // 不为空时使用 SASL/PLAIN 认证
+	Password string
+	Acks     int16 // 0、1 或 -1（全部副本确认）
+}
+
+type broker struct {
+	conn          net.Conn
+	correlationID int32
+}
+
+type partition struct {
+	id     int32
+	leader int32
+}
+
+// Producer 同步发送消息，请求按顺序执行，可以并发调用
+type Producer struct {
+	config Config
+
+	mu         sync.Mutex
+	brokers    map[int32]*broker
+	addrs      map[int32]string
+	partitions map[string][]partition
+	next       map[string]int
+}
+
+func NewProducer(config Config) (*Producer, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("kafka: no brokers configured")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.ClientID == "" {
+		config.ClientID = "new-api"
+	}
+	return &Producer{
+		config:     config,
+		brokers:    map[int32]*broker{},
+		addrs:      map[int32]string{},
+		partitions: map[string][]partition{},
+		next:       map[string]int{},
+	}, nil
+}
+
+func (p *Producer) dial(addr string) (*broker, error) {
+	dialer := &net.Dialer{Timeout: p.config.Timeout}
+	var conn net.Conn
+	var err error
+	if p.config.TLS != nil {
+		tlsConfig := p.config.TLS.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := &broker{conn: conn}
+	if p.config.Username != "" {
+		if err = p.authenticate(b); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (p *Producer) authenticate(b *broker) error {
+	req := &encoder{}
+	req.string("PLAIN")
+	resp, err := p.roundTrip(b, apiSaslHandshake, 1, req.buf)
+	if err != nil {
+		return err
+	}
+	d := &decoder{buf: resp}
+	if code := d.int16(); code != 0 {
+		return &Error{Code: code}
+	}
+	req = &encoder{}
+	req.bytes([]byte("\x00" + p.config.Username + "\x00" + p.config.Password))
+	resp, err = p.roundTrip(b, apiSaslAuthenticate, 0, req.buf)
+	if err != nil {
+		return err
+	}
+	d = &decoder{buf: resp}
+	if code := d.int16(); code != 0 {
+		if message := d.string(); message != "" {
+			return fmt.Errorf("kafka: sasl authentication failed: %s", message)
+		}
+		return &Error{Code: code}
+	}
+	return d.err
+}
+
+// roundTrip 发送请求并读取对应响应，响应体不含 correlation id
+func (p *Producer) roundTrip(b *broker, apiKey int16, apiVersion int16, body []byte) ([]byte, error) {
+	b.correlationID++
+	header := &encoder{}
+	header.int32(0) // 占位，写入总长度
+	header.int16(apiKey)
+	header.int16(apiVersion)
+	header.int32(b.correlationID)
+	header.string(p.config.ClientID)
+	message := append(header.buf, body...)
+	binary.BigEndian.PutUint32(message, uint32(len(message)-4))
+
+	_ = b.conn.SetDeadline(time.Now().Add(p.config.Timeout))
+	if _, err := b.conn.Write(message); err != nil {
+		return nil, err
+	}
+	if apiKey == apiProduce && p.config.Acks == 0 {
+		return nil, nil
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(b.conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > maxResponseSize {
+		return nil, fmt.Errorf("kafka: invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(b.conn, resp); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != b.correlationID {
+		return nil, fmt.Errorf("kafka: unexpected correlation id %d", id)
+	}
+	return resp[4:], nil
+}
+
+func (p *Producer) closeBroker(id int32) {
+	if b, ok := p.brokers[id]; ok {
+		b.conn.Close()
+		delete(p.brokers, id)
+	}
+}
+
+// refreshMetadata 依次尝试引导节点，获取 topic 的分区与主副本
+func (p *Producer) refreshMetadata(topic string) error {
+	req := &encoder{}
+	req.int32(1)
+	req.string(topic)
+	var lastErr error
+	for _, addr := range p.config.Brokers {
+		b, err := p.dial(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := p.roundTrip(b, apiMetadata, 1, req.buf)
+		b.conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return p.parseMetadata(topic, resp)
+	}
+	return fmt.Errorf("kafka: failed to fetch metadata: %w", lastErr)
+}
+
+func (p *Producer) parseMetadata(topic string, resp []byte) error {
+	d := &decoder{buf: resp}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		if rack := d.int16(); rack > 0 {
+			d.take(int(rack))
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(int(port)))
+		if p.addrs[id] != addr {
+			p.closeBroker(id)
+			p.addrs[id] = addr
+		}
+	}
+	d.int32() // controller id
+	var partitions []partition
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			d.int16() // partition error code
+			id := d.int32()
+			leader := d.int32()
+			for k, r := 0, d.arrayLen(); k < r; k++ {
+				d.int32()
+			}
+			for k, r := 0, d.arrayLen(); k < r; k++ {
+				d.int32()
+			}
+			if name == topic && leader >= 0 {
+				partitions = append(partitions, partition{id: id, leader: leader})
+			}
+		}
+		if name == topic && code != 0 {
+			return &Error{Code: code}
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("kafka: topic %q has no available partitions", topic)
+	}
+	p.partitions[topic] = partitions
+	return nil
+}
+
+// Produce 将一批消息写入 topic 的同一个分区，分区在各批次之间轮询选择
+func (p *Producer) Produce(topic string, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = p.produce(topic, records); err == nil {
+			return nil
+		}
+		var kafkaErr *Error
+		if errors.As(err, &kafkaErr) && !kafkaErr.retriable() {
+			return err
+		}
+		delete(p.partitions, topic)
+	}
+	return err
+}
+
+func (p *Producer) produce(topic string, records []Record) error {
+	if len(p.partitions[topic]) == 0 {
+		if err := p.refreshMetadata(topic); err != nil {
+			return err
+		}
+	}
+	partitions := p.partitions[topic]
+	target := partitions[p.next[topic]%len(partitions)]
+	p.next[topic]++
+
+	b, ok := p.brokers[target.leader]
+	if !ok {
+		addr, known := p.addrs[target.leader]
+		if !known {
+			return &Error{Code: 5}
+		}
+		var err error
+		if b, err = p.dial(addr); err != nil {
+			return err
+		}
+		p.brokers[target.leader] = b
+	}
+
+	req := &encoder{}
+	req.nullableString(nil) // transactional id
+	req.int16(p.config.Acks)
+	req.int32(int32(p.config.Timeout / time.Millisecond))
+	req.int32(1)
+	req.string(topic)
+	req.int32(1)
+	req.int32(target.id)
+	req.bytes(encodeRecordBatch(records))
+	resp, err := p.roundTrip(b, apiProduce, 3, req.buf)
+	if err != nil {
+		p.closeBroker(target.leader)
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	d := &decoder{buf: resp}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code != 0 {
+				return &Error{Code: code}
+			}
+		}
+	}
+	return d.err
+}
+
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id := range p.brokers {
+		p.closeBroker(id)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type produced struct {
+	partition int32
+	acks      int16
+	records   []Record
+}
+
+// fakeBroker 单节点的 Kafka 服务端，响应元数据与生产请求
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+	host     string
+	port     int32
+
+	mu          sync.Mutex
+	partitions  int32
+	produceErrs []int16 // 依次作为生产请求的错误码返回
+	produced    []produced
+	metadata    int
+	saslUser    string
+	saslPass    string
+}
+
+func newFakeBroker(t *testing.T, partitions int32) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	b := &fakeBroker{t: t, listener: listener, host: host, port: int32(portNum), partitions: partitions}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		d := &decoder{buf: req}
+		apiKey := d.int16()
+		d.int16() // api version
+		correlationID := d.int32()
+		d.string() // client id
+		body, reply := b.handle(apiKey, d)
+		if !reply {
+			continue
+		}
+		resp := &encoder{}
+		resp.int32(int32(4 + len(body)))
+		resp.int32(correlationID)
+		resp.buf = append(resp.buf, body...)
+		if _, err := conn.Write(resp.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) handle(apiKey int16, d *decoder) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	resp := &encoder{}
+	switch apiKey {
+	case apiSaslHandshake:
+		if d.string() == "PLAIN" {
+			resp.int16(0)
+		} else {
+			resp.int16(33)
+		}
+		resp.int32(0)
+	case apiSaslAuthenticate:
+		if string(d.bytes()) == "\x00"+b.saslUser+"\x00"+b.saslPass {
+			resp.int16(0)
+		} else {
+			resp.int16(58)
+		}
+		resp.string("invalid credentials")
+		resp.bytes(nil)
+	case apiMetadata:
+		b.metadata++
+		d.int32()
+		topic := d.string()
+		resp.int32(1)
+		resp.int32(1) // node id
+		resp.string(b.host)
+		resp.int32(b.port)
+		resp.int16(-1) // rack
+		resp.int32(1)  // controller id
+		resp.int32(1)
+		resp.int16(0)
+		resp.string(topic)
+		resp.int8(0)
+		resp.int32(b.partitions)
+		for i := int32(0); i < b.partitions; i++ {
+			resp.int16(0)
+			resp.int32(i)
+			resp.int32(1) // leader
+			resp.int32(1)
+			resp.int32(1)
+			resp.int32(1)
+			resp.int32(1)
+		}
+	case apiProduce:
+		d.int16() // transactional id
+		acks := d.int16()
+		d.int32() // timeout
+		d.int32()
+		topic := d.string()
+		d.int32()
+		partition := d.int32()
+		records := decodeRecords(b.t, d.bytes())
+		code := int16(0)
+		if len(b.produceErrs) > 0 {
+			code, b.produceErrs = b.produceErrs[0], b.produceErrs[1:]
+		}
+		if code == 0 {
+			b.produced = append(b.produced, produced{partition: partition, acks: acks, records: records})
+		}
+		if acks == 0 {
+			return nil, false
+		}
+		resp.int32(1)
+		resp.string(topic)
+		resp.int32(1)
+		resp.int32(partition)
+		resp.int16(code)
+		resp.int64(0)
+		resp.int64(-1)
+		resp.int32(0) // throttle time
+	}
+	return resp.buf, true
+}
+
+func (b *fakeBroker) snapshot() ([]produced, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]produced(nil), b.produced...), b.metadata
+}
+
+func TestProducer(t *testing.T) {
+	broker := newFakeBroker(t, 2)
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, Timeout: time.Second, Acks: 1})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	records := []Record{{Key: []byte("k"), Value: []byte("v"), Timestamp: 1000}}
+	require.NoError(t, producer.Produce("logs", records))
+	require.NoError(t, producer.Produce("logs", records))
+	require.NoError(t, producer.Produce("logs", nil))
+
+	got, metadata := broker.snapshot()
+	require.Equal(t, 1, metadata)
+	require.Len(t, got, 2)
+	// 分区在批次之间轮询
+	require.Equal(t, int32(0), got[0].partition)
+	require.Equal(t, int32(1), got[1].partition)
+	require.Equal(t, int16(1), got[0].acks)
+	require.Equal(t, records, got[0].records)
+}
+
+func TestProducer_RetryAfterLeaderChange(t *testing.T) {
+	broker := newFakeBroker(t, 1)
+	broker.produceErrs = []int16{6}
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, Timeout: time.Second, Acks: -1})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	require.NoError(t, producer.Produce("logs", []Record{{Value: []byte("v")}}))
+	got, metadata := broker.snapshot()
+	require.Len(t, got, 1)
+	require.Equal(t, 2, metadata)
+}
+
+func TestProducer_NonRetriableError(t *testing.T) {
+	broker := newFakeBroker(t, 1)
+	broker.produceErrs = []int16{29}
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, Timeout: time.Second, Acks: 1})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	err = producer.Produce("logs", []Record{{Value: []byte("v")}})
+	require.Equal(t, &Error{Code: 29}, err)
+	_, metadata := broker.snapshot()
+	require.Equal(t, 1, metadata)
+}
+
+func TestProducer_NoAcks(t *testing.T) {
+	broker := newFakeBroker(t, 1)
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, Timeout: time.Second})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	require.NoError(t, producer.Produce("logs", []Record{{Value: []byte("v")}}))
+	require.Eventually(t, func() bool {
+		got, _ := broker.snapshot()
+		return len(got) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestProducer_SASL(t *testing.T) {
+	broker := newFakeBroker(t, 1)
+	broker.saslUser, broker.saslPass = "user", "pass"
+
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, Timeout: time.Second, Acks: 1, Username: "user", Password: "pass"})
+	require.NoError(t, err)
+	require.NoError(t, producer.Produce("logs", []Record{{Value: []byte("v")}}))
+	producer.Close()
+
+	producer, err = NewProducer(Config{Brokers: []string{broker.addr()}, Timeout: time.Second, Acks: 1, Username: "user", Password: "wrong"})
+	require.NoError(t, err)
+	err = producer.Produce("logs", []Record{{Value: []byte("v")}})
+	require.ErrorContains(t, err, "sasl authentication failed: invalid credentials")
+	producer.Close()
+}
+
+func TestNewProducer_NoBrokers(t *testing.T) {
+	_, err := NewProducer(Config{})
+	require.Error(t, err)
+}
@@ -0,0 +1,213 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Kafka 协议的最小实现，只覆盖生产消息用到的非 flexible 版本请求
+
+const (
+	apiProduce          int16 = 0
+	apiMetadata         int16 = 3
+	apiSaslHandshake    int16 = 17
+	apiSaslAuthenticate int16 = 36
+)
+
+// 单个响应报文的上限，防止异常长度导致大量内存分配
+const maxResponseSize = 16 << 20
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+var errShortResponse = errors.New("kafka: short response")
+
+// Error 服务器返回的错误码
+type Error struct {
+	Code int16
+}
+
+func (e *Error) Error() string {
+	if name, ok := errorNames[e.Code]; ok {
+		return fmt.Sprintf("kafka: %s (%d)", name, e.Code)
+	}
+	return fmt.Sprintf("kafka: error code %d", e.Code)
+}
+
+var errorNames = map[int16]string{
+	1:  "offset out of range",
+	2:  "corrupt message",
+	3:  "unknown topic or partition",
+	5:  "leader not available",
+	6:  "not leader for partition",
+	7:  "request timed out",
+	10: "message too large",
+	29: "topic authorization failed",
+	31: "cluster authorization failed",
+	33: "unsupported sasl mechanism",
+	58: "sasl authentication failed",
+}
+
+// retriable 分区主副本变化等情况，刷新元数据后可以重试
+func (e *Error) retriable() bool {
+	return e.Code == 3 || e.Code == 5 || e.Code == 6 || e.Code == 7
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8)   { e.buf = append(e.buf, byte(v)) }
+func (e *encoder) int16(v int16) { e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) }
+func (e *encoder) int32(v int32) { e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v)) }
+func (e *encoder) int64(v int64) { e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v)) }
+
+func (e *encoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) nullableString(v *string) {
+	if v == nil {
+		e.int16(-1)
+		return
+	}
+	e.string(*v)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) varint(v int64) { e.buf = binary.AppendVarint(e.buf, v) }
+
+func (e *encoder) varBytes(v []byte) {
+	if v == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errShortResponse
+		return nil
+	}
+	v := d.buf[:n]
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if v := d.take(1); v != nil {
+		return int8(v[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if v := d.take(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if v := d.take(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if v := d.take(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.buf) {
+		d.err = errShortResponse
+		return 0
+	}
+	return int(n)
+}
+
+// Record 一条待发送的消息，Key 为空时不设置消息键
+type Record struct {
+	Key       []byte
+	Value     []byte
+	Timestamp int64 // 毫秒
+}
+
+// encodeRecordBatch 按消息格式 v2（magic 2）编码，不压缩、不使用幂等生产者
+func encodeRecordBatch(records []Record) []byte {
+	firstTimestamp, maxTimestamp := records[0].Timestamp, records[0].Timestamp
+	for _, record := range records {
+		firstTimestamp = min(firstTimestamp, record.Timestamp)
+		maxTimestamp = max(maxTimestamp, record.Timestamp)
+	}
+
+	body := &encoder{}
+	body.int16(0) // attributes
+	body.int32(int32(len(records) - 1))
+	body.int64(firstTimestamp)
+	body.int64(maxTimestamp)
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(records)))
+	for i, record := range records {
+		r := &encoder{}
+		r.int8(0)
+		r.varint(record.Timestamp - firstTimestamp)
+		r.varint(int64(i))
+		r.varBytes(record.Key)
+		r.varBytes(record.Value)
+		r.varint(0) // headers
+		body.varint(int64(len(r.buf)))
+		body.buf = append(body.buf, r.buf...)
+	}
+
+	batch := &encoder{}
+	batch.int64(0)                                // base offset
+	batch.int32(int32(4 + 1 + 4 + len(body.buf))) // batch length
+	batch.int32(-1)                               // partition leader epoch
+	batch.int8(2)                                 // magic
+	batch.int32(int32(crc32.Checksum(body.buf, crc32c)))
+	batch.buf = append(batch.buf, body.buf...)
+	return batch.buf
+}
@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	e := &encoder{}
+	e.int8(-2)
+	e.int16(-300)
+	e.int32(70000)
+	e.int64(-1 << 40)
+	e.string("topic")
+	e.nullableString(nil)
+	e.bytes([]byte("value"))
+	e.bytes(nil)
+	e.int32(2)
+
+	d := &decoder{buf: e.buf}
+	require.Equal(t, int8(-2), d.int8())
+	require.Equal(t, int16(-300), d.int16())
+	require.Equal(t, int32(70000), d.int32())
+	require.Equal(t, int64(-1<<40), d.int64())
+	require.Equal(t, "topic", d.string())
+	require.Equal(t, "", d.string())
+	require.Equal(t, []byte("value"), d.bytes())
+	require.Empty(t, d.bytes())
+	// 数组长度超过剩余字节时视为截断
+	require.Equal(t, 0, d.arrayLen())
+	require.ErrorIs(t, d.err, errShortResponse)
+}
+
+func TestDecoder_Short(t *testing.T) {
+	d := &decoder{buf: []byte{0x00, 0x05, 'a'}}
+	require.Equal(t, "", d.string())
+	require.ErrorIs(t, d.err, errShortResponse)
+	// 出错后后续读取都返回零值
+	require.Equal(t, int32(0), d.int32())
+
+	d = &decoder{buf: []byte{0xff, 0xff, 0xff, 0xff}}
+	require.Equal(t, 0, d.arrayLen())
+	require.NoError(t, d.err)
+}
+
+func TestError(t *testing.T) {
+	require.Equal(t, "kafka: not leader for partition (6)", (&Error{Code: 6}).Error())
+	require.Equal(t, "kafka: error code 99", (&Error{Code: 99}).Error())
+	require.True(t, (&Error{Code: 6}).retriable())
+	require.False(t, (&Error{Code: 29}).retriable())
+}
+
+// decodeRecords 按消息格式 v2 解析 encodeRecordBatch 的输出
+func decodeRecords(t *testing.T, batch []byte) []Record {
+	d := &decoder{buf: batch}
+	require.Equal(t, int64(0), d.int64())
+	require.Equal(t, int(d.int32()), len(d.buf))
+	require.Equal(t, int32(-1), d.int32())
+	require.Equal(t, int8(2), d.int8())
+	crc := uint32(d.int32())
+	require.Equal(t, crc32.Checksum(d.buf, crc32c), crc)
+
+	require.Equal(t, int16(0), d.int16())
+	lastOffsetDelta := d.int32()
+	firstTimestamp := d.int64()
+	d.int64()
+	require.Equal(t, int64(-1), d.int64())
+	require.Equal(t, int16(-1), d.int16())
+	require.Equal(t, int32(-1), d.int32())
+	count := int(d.int32())
+	require.Equal(t, int(lastOffsetDelta)+1, count)
+
+	varint := func() int64 {
+		v, n := binary.Varint(d.buf)
+		require.Greater(t, n, 0)
+		d.buf = d.buf[n:]
+		return v
+	}
+	varBytes := func() []byte {
+		n := varint()
+		if n < 0 {
+			return nil
+		}
+		return d.take(int(n))
+	}
+	records := make([]Record, 0, count)
+	for i := 0; i < count; i++ {
+		length := varint()
+		before := len(d.buf)
+		require.Equal(t, int8(0), d.int8())
+		timestamp := firstTimestamp + varint()
+		require.Equal(t, int64(i), varint())
+		record := Record{Key: varBytes(), Value: varBytes(), Timestamp: timestamp}
+		require.Equal(t, int64(0), varint())
+		require.Equal(t, int(length), before-len(d.buf))
+		records = append(records, record)
+	}
+	require.NoError(t, d.err)
+	require.Empty(t, d.buf)
+	return records
+}
+
+func TestEncodeRecordBatch(t *testing.T) {
+	records := []Record{
+		{Key: []byte("k1"), Value: []byte("v1"), Timestamp: 2000},
+		{Value: []byte("v2"), Timestamp: 1000},
+		{Key: []byte("k3"), Value: []byte{}, Timestamp: 3000},
+	}
+	require.Equal(t, records, decodeRecords(t, encodeRecordBatch(records)))
+}
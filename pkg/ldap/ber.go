@@ -0,0 +1,217 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER 编码的最小实现，只覆盖 LDAP 协议用到的部分（RFC 4511 第 5.1 节）
+
+const (
+	classUniversal   byte = 0x00
+	classApplication byte = 0x40
+	classContext     byte = 0x80
+	flagConstructed  byte = 0x20
+)
+
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10
+	tagSet         = 0x11
+)
+
+// 单个响应报文的上限，防止异常长度导致大量内存分配
+const maxPacketSize = 16 << 20
+
+type packet struct {
+	class       byte
+	constructed bool
+	tag         int
+	value       []byte
+	children    []*packet
+}
+
+func newPrimitive(class byte, tag int, value []byte) *packet {
+	return &packet{class: class, tag: tag, value: value}
+}
+
+func newConstructed(class byte, tag int, children ...*packet) *packet {
+	return &packet{class: class, constructed: true, tag: tag, children: children}
+}
+
+func newSequence(children ...*packet) *packet {
+	return newConstructed(classUniversal, tagSequence, children...)
+}
+
+func newString(value string) *packet {
+	return newPrimitive(classUniversal, tagOctetString, []byte(value))
+}
+
+func newInteger(tag int, value int64) *packet {
+	return newPrimitive(classUniversal, tag, encodeInteger(value))
+}
+
+func newBoolean(value bool) *packet {
+	if value {
+		return newPrimitive(classUniversal, tagBoolean, []byte{0xff})
+	}
+	return newPrimitive(classUniversal, tagBoolean, []byte{0x00})
+}
+
+func (p *packet) append(children ...*packet) {
+	p.children = append(p.children, children...)
+}
+
+func (p *packet) bytes() []byte {
+	content := p.value
+	if p.constructed {
+		content = nil
+		for _, child := range p.children {
+			content = append(content, child.bytes()...)
+		}
+	}
+	header := p.class | byte(p.tag)
+	if p.constructed {
+		header |= flagConstructed
+	}
+	out := []byte{header}
+	out = append(out, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+func (p *packet) is(class byte, tag int) bool {
+	return p.class == class && p.tag == tag
+}
+
+func (p *packet) child(i int) (*packet, error) {
+	if i >= len(p.children) {
+		return nil, fmt.Errorf("ldap: malformed packet, missing element %d", i)
+	}
+	return p.children[i], nil
+}
+
+func (p *packet) str() string {
+	return string(p.value)
+}
+
+func (p *packet) integer() int64 {
+	return decodeInteger(p.value)
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var buf []byte
+	for v := n; v > 0; v >>= 8 {
+		buf = append([]byte{byte(v)}, buf...)
+	}
+	return append([]byte{0x80 | byte(len(buf))}, buf...)
+}
+
+func encodeInteger(v int64) []byte {
+	buf := []byte{byte(v)}
+	for {
+		next := v >> 8
+		// 已经可以用当前字节的最高位正确表示符号时停止
+		if (next == 0 && buf[0]&0x80 == 0) || (next == -1 && buf[0]&0x80 != 0) {
+			return buf
+		}
+		v = next
+		buf = append([]byte{byte(v)}, buf...)
+	}
+}
+
+func decodeInteger(b []byte) int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	var v int64
+	if b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// readPacket 从连接中读取一个完整的 TLV 并递归解析其子元素
+func readPacket(r io.Reader) (*packet, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, errors.New("ldap: unsupported BER length")
+		}
+		lenBytes := make([]byte, n)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, c := range lenBytes {
+			length = length<<8 | int(c)
+		}
+	}
+	if length > maxPacketSize {
+		return nil, errors.New("ldap: packet too large")
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parsePacket(header[0], content)
+}
+
+func parsePacket(header byte, content []byte) (*packet, error) {
+	if header&0x1f == 0x1f {
+		return nil, errors.New("ldap: unsupported BER tag")
+	}
+	p := &packet{
+		class:       header & 0xc0,
+		constructed: header&flagConstructed != 0,
+		tag:         int(header & 0x1f),
+	}
+	if !p.constructed {
+		p.value = content
+		return p, nil
+	}
+	for len(content) > 0 {
+		if len(content) < 2 {
+			return nil, errors.New("ldap: truncated BER element")
+		}
+		childHeader := content[0]
+		length := int(content[1])
+		offset := 2
+		if length&0x80 != 0 {
+			n := length & 0x7f
+			if n == 0 || n > 4 || len(content) < 2+n {
+				return nil, errors.New("ldap: invalid BER length")
+			}
+			length = 0
+			for _, c := range content[2 : 2+n] {
+				length = length<<8 | int(c)
+			}
+			offset += n
+		}
+		if length < 0 || len(content) < offset+length {
+			return nil, errors.New("ldap: truncated BER element")
+		}
+		child, err := parsePacket(childHeader, content[offset:offset+length])
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+		content = content[offset+length:]
+	}
+	return p, nil
+}
@@ -0,0 +1,81 @@
+package ldap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeInteger(t *testing.T) {
+	for _, tc := range []struct {
+		value int64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x00, 0x80}},
+		{256, []byte{0x01, 0x00}},
+		{-1, []byte{0xff}},
+		{-128, []byte{0x80}},
+		{-129, []byte{0xff, 0x7f}},
+	} {
+		require.Equal(t, tc.want, encodeInteger(tc.value), tc.value)
+		require.Equal(t, tc.value, decodeInteger(tc.want), tc.value)
+	}
+}
+
+func TestEncodeLength(t *testing.T) {
+	require.Equal(t, []byte{0x7f}, encodeLength(127))
+	require.Equal(t, []byte{0x81, 0x80}, encodeLength(128))
+	require.Equal(t, []byte{0x82, 0x01, 0x00}, encodeLength(256))
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	msg := newSequence(
+		newInteger(tagInteger, 42),
+		newConstructed(classApplication, appBindRequest,
+			newInteger(tagInteger, 3),
+			newString(long),
+			newPrimitive(classContext, 0, []byte("secret"))),
+		newBoolean(true),
+	)
+	p, err := readPacket(bytes.NewReader(msg.bytes()))
+	require.NoError(t, err)
+	require.True(t, p.is(classUniversal, tagSequence))
+	require.Len(t, p.children, 3)
+	require.Equal(t, int64(42), p.children[0].integer())
+
+	bind := p.children[1]
+	require.True(t, bind.is(classApplication, appBindRequest))
+	require.True(t, bind.constructed)
+	require.Equal(t, long, bind.children[1].str())
+	require.True(t, bind.children[2].is(classContext, 0))
+	require.Equal(t, "secret", bind.children[2].str())
+	require.Equal(t, []byte{0xff}, p.children[2].value)
+
+	_, err = p.child(3)
+	require.Error(t, err)
+}
+
+func TestReadPacket_Malformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":            {},
+		"truncated header": {0x30},
+		"indefinite":       {0x30, 0x80},
+		"long length":      {0x30, 0x85, 0x01, 0x00, 0x00, 0x00, 0x00},
+		"truncated length": {0x30, 0x82, 0x01},
+		"too large":        {0x04, 0x84, 0x7f, 0xff, 0xff, 0xff},
+		"truncated value":  {0x04, 0x05, 'a', 'b'},
+		"high tag":         {0x1f, 0x01, 0x00},
+		"truncated child":  {0x30, 0x03, 0x04, 0x05, 'a'},
+		"child one byte":   {0x30, 0x01, 0x04},
+		"child bad length": {0x30, 0x03, 0x04, 0x80, 0x00},
+		"child high tag":   {0x30, 0x02, 0x3f, 0x00},
+	} {
+		_, err := readPacket(bytes.NewReader(data))
+		require.Error(t, err, name)
+	}
+}
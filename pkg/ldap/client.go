@@ -0,0 +1,296 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	appBindRequest      = 0
+	appBindResponse     = 1
+	appUnbindRequest    = 2
+	appSearchRequest    = 3
+	appSearchEntry      = 4
+	appSearchDone       = 5
+	appSearchReference  = 19
+	appExtendedRequest  = 23
+	appExtendedResponse = 24
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+const (
+	ResultSuccess            = 0
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+)
+
+// Error 服务器返回的非成功结果
+type Error struct {
+	ResultCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.ResultCode)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.ResultCode, e.Message)
+}
+
+// IsResultCode 判断错误是否为指定结果码
+func IsResultCode(err error, code int) bool {
+	var ldapErr *Error
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == code
+}
+
+// Entry 搜索结果条目，属性名统一转为小写
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+func (e *Entry) GetAttributeValues(name string) []string {
+	return e.Attributes[strings.ToLower(name)]
+}
+
+func (e *Entry) GetAttributeValue(name string) string {
+	values := e.GetAttributeValues(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     string
+	Attributes []string
+	SizeLimit  int
+}
+
+// Conn 单个 LDAP 连接，请求按顺序同步执行，不可并发使用
+type Conn struct {
+	conn    net.Conn
+	host    string
+	msgID   int64
+	timeout time.Duration
+}
+
+// Dial 连接 ldap:// 或 ldaps:// 地址，未指定端口时使用 389 / 636
+func Dial(rawURL string, timeout time.Duration, tlsConfig *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	port := u.Port()
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+		conn, err = dialer.Dial("tcp", net.JoinHostPort(host, port))
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), withServerName(tlsConfig, host))
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, host: host, timeout: timeout}, nil
+}
+
+func withServerName(tlsConfig *tls.Config, host string) *tls.Config {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	return tlsConfig
+}
+
+// StartTLS 在明文连接上升级为 TLS（RFC 4511 第 4.14 节）
+func (c *Conn) StartTLS(tlsConfig *tls.Config) error {
+	op := newConstructed(classApplication, appExtendedRequest,
+		newPrimitive(classContext, 0, []byte(startTLSOID)))
+	resp, err := c.request(op, appExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if err = resultError(resp); err != nil {
+		return err
+	}
+	tlsConn := tls.Client(c.conn, withServerName(tlsConfig, c.host))
+	if err = tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	return nil
+}
+
+// Bind 简单认证。空密码在协议上是匿名绑定，调用方校验用户密码时必须先排除
+func (c *Conn) Bind(dn string, password string) error {
+	op := newConstructed(classApplication, appBindRequest,
+		newInteger(tagInteger, 3),
+		newString(dn),
+		newPrimitive(classContext, 0, []byte(password)))
+	resp, err := c.request(op, appBindResponse)
+	if err != nil {
+		return err
+	}
+	return resultError(resp)
+}
+
+func (c *Conn) Search(req *SearchRequest) ([]*Entry, error) {
+	filter, err := compileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attributes := newSequence()
+	for _, attr := range req.Attributes {
+		attributes.append(newString(attr))
+	}
+	op := newConstructed(classApplication, appSearchRequest,
+		newString(req.BaseDN),
+		newInteger(tagEnumerated, int64(req.Scope)),
+		newInteger(tagEnumerated, 0), // neverDerefAliases
+		newInteger(tagInteger, int64(req.SizeLimit)),
+		newInteger(tagInteger, int64(c.timeout/time.Second)),
+		newBoolean(false),
+		filter,
+		attributes)
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for {
+		resp, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.is(classApplication, appSearchEntry):
+			entry, err := parseEntry(resp)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case resp.is(classApplication, appSearchReference):
+			// 不跟随引用
+		case resp.is(classApplication, appSearchDone):
+			return entries, resultError(resp)
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response tag %d", resp.tag)
+		}
+	}
+}
+
+func (c *Conn) Close() error {
+	_, _ = c.send(newPrimitive(classApplication, appUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+func (c *Conn) send(op *packet) (int64, error) {
+	c.msgID++
+	msg := newSequence(newInteger(tagInteger, c.msgID), op)
+	if c.timeout > 0 {
+		_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	_, err := c.conn.Write(msg.bytes())
+	return c.msgID, err
+}
+
+func (c *Conn) receive(id int64) (*packet, error) {
+	for {
+		msg, err := readPacket(c.conn)
+		if err != nil {
+			return nil, err
+		}
+		if !msg.is(classUniversal, tagSequence) || len(msg.children) < 2 {
+			return nil, errors.New("ldap: malformed message")
+		}
+		// messageID 为 0 的是服务器主动发出的通知（如连接断开），其它编号的响应直接丢弃
+		switch msg.children[0].integer() {
+		case id:
+			return msg.children[1], nil
+		case 0:
+			return nil, resultError(msg.children[1])
+		}
+	}
+}
+
+func (c *Conn) request(op *packet, responseTag int) (*packet, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.receive(id)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.is(classApplication, responseTag) {
+		return nil, fmt.Errorf("ldap: unexpected response tag %d", resp.tag)
+	}
+	return resp, nil
+}
+
+// resultError 解析 LDAPResult，成功时返回 nil
+func resultError(resp *packet) error {
+	code, err := resp.child(0)
+	if err != nil {
+		return err
+	}
+	if code.integer() == ResultSuccess {
+		return nil
+	}
+	ldapErr := &Error{ResultCode: int(code.integer())}
+	if msg, err := resp.child(2); err == nil {
+		ldapErr.Message = msg.str()
+	}
+	return ldapErr
+}
+
+func parseEntry(resp *packet) (*Entry, error) {
+	dn, err := resp.child(0)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := resp.child(1)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{DN: dn.str(), Attributes: make(map[string][]string)}
+	for _, attr := range attrs.children {
+		if len(attr.children) < 2 {
+			continue
+		}
+		name := strings.ToLower(attr.children[0].str())
+		for _, value := range attr.children[1].children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.str())
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,117 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer 在 net.Pipe 的另一端逐个读取请求并按 handle 的返回写回响应
+func fakeServer(t *testing.T, handle func(id int64, op *packet) []*packet) *Conn {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	go func() {
+		for {
+			msg, err := readPacket(server)
+			if err != nil {
+				return
+			}
+			id := msg.children[0].integer()
+			for _, resp := range handle(id, msg.children[1]) {
+				if _, err = server.Write(resp.bytes()); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return &Conn{conn: client, host: "localhost", timeout: time.Second}
+}
+
+func ldapResult(tag int, code int64, message string) *packet {
+	return newConstructed(classApplication, tag,
+		newInteger(tagEnumerated, code), newString(""), newString(message))
+}
+
+func message(id int64, op *packet) *packet {
+	return newSequence(newInteger(tagInteger, id), op)
+}
+
+func TestBind(t *testing.T) {
+	conn := fakeServer(t, func(id int64, op *packet) []*packet {
+		if !op.is(classApplication, appBindRequest) {
+			return nil
+		}
+		if op.children[1].str() == "cn=admin" && op.children[2].str() == "secret" {
+			return []*packet{message(id, ldapResult(appBindResponse, ResultSuccess, ""))}
+		}
+		return []*packet{message(id, ldapResult(appBindResponse, ResultInvalidCredentials, "invalid credentials"))}
+	})
+	require.NoError(t, conn.Bind("cn=admin", "secret"))
+
+	err := conn.Bind("cn=admin", "wrong")
+	require.True(t, IsResultCode(err, ResultInvalidCredentials))
+	require.Equal(t, "ldap: result code 49: invalid credentials", err.Error())
+}
+
+func TestSearch(t *testing.T) {
+	conn := fakeServer(t, func(id int64, op *packet) []*packet {
+		entry := newConstructed(classApplication, appSearchEntry,
+			newString("uid=alice,dc=example"),
+			newSequence(
+				newSequence(newString("Mail"), newConstructed(classUniversal, tagSet, newString("a@example.com"), newString("b@example.com"))),
+				newSequence(newString("cn")),
+			))
+		return []*packet{
+			// 其它编号的响应应被忽略
+			message(id+100, ldapResult(appSearchDone, ResultSuccess, "")),
+			message(id, entry),
+			message(id, newConstructed(classApplication, appSearchReference, newString("ldap://other"))),
+			message(id, ldapResult(appSearchDone, ResultSuccess, "")),
+		}
+	})
+	entries, err := conn.Search(&SearchRequest{BaseDN: "dc=example", Scope: ScopeWholeSubtree, Filter: "(uid=alice)", Attributes: []string{"mail"}})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "uid=alice,dc=example", entries[0].DN)
+	require.Equal(t, []string{"a@example.com", "b@example.com"}, entries[0].GetAttributeValues("MAIL"))
+	require.Equal(t, "a@example.com", entries[0].GetAttributeValue("mail"))
+	require.Empty(t, entries[0].GetAttributeValue("cn"))
+
+	_, err = conn.Search(&SearchRequest{Filter: "(uid=alice"})
+	require.Error(t, err)
+}
+
+func TestSearch_ServerErrors(t *testing.T) {
+	conn := fakeServer(t, func(id int64, op *packet) []*packet {
+		return []*packet{message(id, ldapResult(appSearchDone, ResultNoSuchObject, ""))}
+	})
+	_, err := conn.Search(&SearchRequest{Filter: "(uid=a)"})
+	require.True(t, IsResultCode(err, ResultNoSuchObject))
+
+	// messageID 为 0 的断开通知
+	conn = fakeServer(t, func(id int64, op *packet) []*packet {
+		return []*packet{message(0, ldapResult(appExtendedResponse, 52, "unavailable"))}
+	})
+	err = conn.Bind("cn=admin", "secret")
+	require.True(t, IsResultCode(err, 52))
+
+	conn = fakeServer(t, func(id int64, op *packet) []*packet {
+		return []*packet{newSequence(newInteger(tagInteger, id))}
+	})
+	require.Error(t, conn.Bind("cn=admin", "secret"))
+
+	conn = fakeServer(t, func(id int64, op *packet) []*packet {
+		return []*packet{message(id, ldapResult(appSearchDone, ResultSuccess, ""))}
+	})
+	require.Error(t, conn.Bind("cn=admin", "secret"))
+}
+
+func TestDial_UnsupportedScheme(t *testing.T) {
+	_, err := Dial("http://localhost", time.Second, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// 过滤器选择项的上下文标签（RFC 4511 第 4.5.1 节）
+const (
+	filterAnd            = 0
+	filterOr             = 1
+	filterNot            = 2
+	filterEqualityMatch  = 3
+	filterSubstrings     = 4
+	filterGreaterOrEqual = 5
+	filterLessOrEqual    = 6
+	filterPresent        = 7
+	filterApproxMatch    = 8
+)
+
+// EscapeFilter 转义过滤器中的特殊字符，拼接用户输入前必须调用（RFC 4515 第 3 节）
+func EscapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// compileFilter 把字符串形式的过滤器编译为 BER，不支持 extensibleMatch
+func compileFilter(filter string) (*packet, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return nil, fmt.Errorf("ldap: empty filter")
+	}
+	if filter[0] != '(' {
+		filter = "(" + filter + ")"
+	}
+	p, pos, err := parseFilter(filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(filter) {
+		return nil, fmt.Errorf("ldap: unexpected trailing characters in filter at %d", pos)
+	}
+	return p, nil
+}
+
+func parseFilter(f string, pos int) (*packet, int, error) {
+	if pos >= len(f) || f[pos] != '(' {
+		return nil, pos, fmt.Errorf("ldap: expected '(' in filter at %d", pos)
+	}
+	pos++
+	if pos >= len(f) {
+		return nil, pos, fmt.Errorf("ldap: unexpected end of filter")
+	}
+	var p *packet
+	switch f[pos] {
+	case '&', '|':
+		tag := filterAnd
+		if f[pos] == '|' {
+			tag = filterOr
+		}
+		p = newConstructed(classContext, tag)
+		pos++
+		for pos < len(f) && f[pos] == '(' {
+			child, next, err := parseFilter(f, pos)
+			if err != nil {
+				return nil, next, err
+			}
+			p.append(child)
+			pos = next
+		}
+	case '!':
+		child, next, err := parseFilter(f, pos+1)
+		if err != nil {
+			return nil, next, err
+		}
+		p = newConstructed(classContext, filterNot, child)
+		pos = next
+	default:
+		end := strings.IndexByte(f[pos:], ')')
+		if end < 0 {
+			return nil, pos, fmt.Errorf("ldap: unterminated filter item")
+		}
+		item, err := parseFilterItem(f[pos : pos+end])
+		if err != nil {
+			return nil, pos, err
+		}
+		p = item
+		pos += end
+	}
+	if pos >= len(f) || f[pos] != ')' {
+		return nil, pos, fmt.Errorf("ldap: expected ')' in filter at %d", pos)
+	}
+	return p, pos + 1, nil
+}
+
+func parseFilterItem(item string) (*packet, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("ldap: invalid filter item %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	tag := filterEqualityMatch
+	switch attr[len(attr)-1] {
+	case '>':
+		tag = filterGreaterOrEqual
+	case '<':
+		tag = filterLessOrEqual
+	case '~':
+		tag = filterApproxMatch
+	}
+	if tag != filterEqualityMatch {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" || strings.ContainsAny(attr, "()&|!=") {
+		return nil, fmt.Errorf("ldap: invalid attribute in filter item %q", item)
+	}
+	if tag == filterEqualityMatch && value == "*" {
+		return newPrimitive(classContext, filterPresent, []byte(attr)), nil
+	}
+	if tag == filterEqualityMatch && strings.Contains(value, "*") {
+		return parseSubstrings(attr, value)
+	}
+	decoded, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return newConstructed(classContext, tag, newString(attr), newPrimitive(classUniversal, tagOctetString, decoded)), nil
+}
+
+func parseSubstrings(attr string, value string) (*packet, error) {
+	parts := strings.Split(value, "*")
+	subs := newSequence()
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		decoded, err := unescapeFilterValue(part)
+		if err != nil {
+			return nil, err
+		}
+		tag := 1 // any
+		if i == 0 {
+			tag = 0 // initial
+		} else if i == len(parts)-1 {
+			tag = 2 // final
+		}
+		subs.append(newPrimitive(classContext, tag, decoded))
+	}
+	return newConstructed(classContext, filterSubstrings, newString(attr), subs), nil
+}
+
+func unescapeFilterValue(value string) ([]byte, error) {
+	out := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			out = append(out, value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return nil, fmt.Errorf("ldap: invalid escape in filter value %q", value)
+		}
+		b, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return nil, fmt.Errorf("ldap: invalid escape in filter value %q", value)
+		}
+		out = append(out, b[0])
+		i += 2
+	}
+	return out, nil
+}
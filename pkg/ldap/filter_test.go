@@ -0,0 +1,76 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeFilter(t *testing.T) {
+	require.Equal(t, "alice", EscapeFilter("alice"))
+	require.Equal(t, `\2a\29\28uid=\2a`, EscapeFilter("*)(uid=*"))
+	require.Equal(t, `a\5cb\00c`, EscapeFilter("a\\b\x00c"))
+	require.Equal(t, "张三", EscapeFilter("张三"))
+}
+
+// 转义后的用户输入只能作为单个等值匹配的取值，不能改变过滤器结构
+func TestEscapeFilter_Injection(t *testing.T) {
+	for _, input := range []string{"*", "admin)(|(uid=*", "*)(objectClass=*", "x)(!(cn=y", "a\\2a", "\x00"} {
+		p, err := compileFilter("(&(objectClass=person)(uid=" + EscapeFilter(input) + "))")
+		require.NoError(t, err, input)
+		require.True(t, p.is(classContext, filterAnd), input)
+		require.Len(t, p.children, 2, input)
+		uid := p.children[1]
+		require.True(t, uid.is(classContext, filterEqualityMatch), input)
+		require.Equal(t, "uid", uid.children[0].str())
+		require.Equal(t, input, uid.children[1].str())
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	p, err := compileFilter("uid=alice")
+	require.NoError(t, err)
+	require.True(t, p.is(classContext, filterEqualityMatch))
+
+	p, err = compileFilter("(|(mail=*)(!(cn>=b))(sn<=c)(cn~=d))")
+	require.NoError(t, err)
+	require.True(t, p.is(classContext, filterOr))
+	require.Len(t, p.children, 4)
+	require.True(t, p.children[0].is(classContext, filterPresent))
+	require.Equal(t, "mail", p.children[0].str())
+	require.True(t, p.children[1].is(classContext, filterNot))
+	require.True(t, p.children[1].children[0].is(classContext, filterGreaterOrEqual))
+	require.True(t, p.children[2].is(classContext, filterLessOrEqual))
+	require.True(t, p.children[3].is(classContext, filterApproxMatch))
+
+	p, err = compileFilter("(cn=ab*c\\2a*d)")
+	require.NoError(t, err)
+	require.True(t, p.is(classContext, filterSubstrings))
+	subs := p.children[1].children
+	require.Len(t, subs, 3)
+	require.True(t, subs[0].is(classContext, 0))
+	require.Equal(t, "ab", subs[0].str())
+	require.True(t, subs[1].is(classContext, 1))
+	require.Equal(t, "c*", subs[1].str())
+	require.True(t, subs[2].is(classContext, 2))
+	require.Equal(t, "d", subs[2].str())
+}
+
+func TestCompileFilter_Invalid(t *testing.T) {
+	for _, filter := range []string{
+		"",
+		"(",
+		"(uid=a",
+		"(uid=a))",
+		"(=a)",
+		"(uid)",
+		"(u(id=a)",
+		"(uid=\\2)",
+		"(uid=\\zz)",
+		"(&(uid=a)",
+		"(!uid=a)",
+	} {
+		_, err := compileFilter(filter)
+		require.Error(t, err, filter)
+	}
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "newapi"
+
+// Registry 独立的指标注册表，/metrics 只输出这里注册的指标
+var Registry = prometheus.NewRegistry()
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_requests_total",
+		Help:      "Relay attempts by model, channel and result status.",
+	}, []string{"model", "channel", "status"})
+
+	relayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Relay attempt latency by model and channel.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"model", "channel"})
+
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Upstream errors by channel and error class.",
+	}, []string{"channel", "class"})
+
+	quotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_consumed_total",
+		Help:      "Quota consumed by model and group.",
+	}, []string{"model", "group"})
+
+	tokensConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_consumed_total",
+		Help:      "Tokens consumed by model and type.",
+	}, []string{"model", "type"})
+
+	webhookFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_failures_total",
+		Help:      "Failed webhook notifications.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayDuration,
+		upstreamErrors,
+		quotaConsumed,
+		tokensConsumed,
+		webhookFailures,
+	)
+}
+
+// ErrorClass 按上游状态码归类错误
+func ErrorClass(statusCode int) string {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limit"
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return "auth"
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		return "timeout"
+	case statusCode >= 500:
+		return "server_error"
+	case statusCode >= 400:
+		return "client_error"
+	default:
+		return "other"
+	}
+}
+
+// ObserveRelay 记录一次渠道请求，statusCode 为 0 表示成功
+func ObserveRelay(modelName string, channelId int, statusCode int, duration time.Duration) {
+	channel := strconv.Itoa(channelId)
+	status := "success"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+		upstreamErrors.WithLabelValues(channel, ErrorClass(statusCode)).Inc()
+	}
+	relayRequests.WithLabelValues(modelName, channel, status).Inc()
+	relayDuration.WithLabelValues(modelName, channel).Observe(duration.Seconds())
+}
+
+func AddConsumption(modelName string, group string, quota int, promptTokens int, completionTokens int) {
+	if quota > 0 {
+		quotaConsumed.WithLabelValues(modelName, group).Add(float64(quota))
+	}
+	if promptTokens > 0 {
+		tokensConsumed.WithLabelValues(modelName, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		tokensConsumed.WithLabelValues(modelName, "completion").Add(float64(completionTokens))
+	}
+}
+
+func IncWebhookFailure() {
+	webhookFailures.Inc()
+}
@@ -0,0 +1,266 @@
+package nats
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATS 客户端协议的最小实现，只支持发布消息
+
+// 服务器 INFO 行的上限
+const maxControlLine = 64 << 10
+
+type Options struct {
+	Name     string
+	Username string
+	Password string
+	Token    string
+	Timeout  time.Duration
+	TLS      *tls.Config // 为空时按服务器 INFO 中的 tls_required 决定是否升级
+}
+
+type serverInfo struct {
+	TLSRequired  bool  `json:"tls_required"`
+	AuthRequired bool  `json:"auth_required"`
+	MaxPayload   int64 `json:"max_payload"`
+}
+
+// Conn 单个 NATS 连接，Publish 可以并发调用
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	info    serverInfo
+
+	mu     sync.Mutex
+	writer *bufio.Writer
+	pongs  chan struct{}
+	err    error
+	closed chan struct{}
+}
+
+// Dial 连接 nats:// 或 tls:// 地址，未指定端口时使用 4222，地址中的用户信息优先于 Options
+func Dial(rawURL string, options Options) (*Conn, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "nats://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("nats: unsupported scheme %q", u.Scheme)
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			options.Username, options.Password = u.User.Username(), password
+		} else {
+			options.Token = u.User.Username()
+		}
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "4222"
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), options.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{conn: conn, reader: bufio.NewReaderSize(conn, maxControlLine), timeout: options.Timeout, pongs: make(chan struct{}, 8), closed: make(chan struct{})}
+	if err = c.handshake(u.Scheme == "tls", host, options); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *Conn) handshake(useTLS bool, host string, options Options) error {
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &c.info); err != nil {
+		return fmt.Errorf("nats: invalid server info: %w", err)
+	}
+	if useTLS || options.TLS != nil || c.info.TLSRequired {
+		tlsConfig := &tls.Config{}
+		if options.TLS != nil {
+			tlsConfig = options.TLS.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+		tlsConn := tls.Client(c.conn, tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			return err
+		}
+		c.conn = tlsConn
+		c.reader = bufio.NewReaderSize(tlsConn, maxControlLine)
+	}
+	c.writer = bufio.NewWriter(c.conn)
+
+	connect := map[string]any{
+		"verbose":  false,
+		"pedantic": false,
+		"lang":     "go",
+		"version":  "1.0.0",
+		"protocol": 1,
+		"name":     options.Name,
+	}
+	if options.Token != "" {
+		connect["auth_token"] = options.Token
+	} else if options.Username != "" {
+		connect["user"] = options.Username
+		connect["pass"] = options.Password
+	}
+	data, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.writer, "CONNECT %s\r\nPING\r\n", data)
+	if err = c.writer.Flush(); err != nil {
+		return err
+	}
+	// 认证失败时服务器返回 -ERR，成功时返回 PONG
+	for {
+		line, err = c.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.Trim(strings.TrimPrefix(line, "-ERR"), " '"))
+		}
+	}
+}
+
+func (c *Conn) readLine() (string, error) {
+	line, err := c.reader.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return "", errors.New("nats: control line too long")
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// readLoop 处理服务器的 PING 与错误，连接断开后记录错误
+func (c *Conn) readLoop() {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		switch {
+		case line == "PING":
+			c.mu.Lock()
+			_, err = c.writer.WriteString("PONG\r\n")
+			if err == nil {
+				err = c.writer.Flush()
+			}
+			c.mu.Unlock()
+			if err != nil {
+				c.fail(err)
+				return
+			}
+		case line == "PONG":
+			select {
+			case c.pongs <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			c.fail(fmt.Errorf("nats: %s", strings.Trim(strings.TrimPrefix(line, "-ERR"), " '")))
+			return
+		}
+	}
+}
+
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.closed)
+		c.conn.Close()
+	}
+}
+
+// Err 返回导致连接不可用的错误
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Publish 写入缓冲区，调用 Flush 后确保送达服务器
+func (c *Conn) Publish(subject string, data []byte) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("nats: invalid subject %q", subject)
+	}
+	if c.info.MaxPayload > 0 && int64(len(data)) > c.info.MaxPayload {
+		return errors.New("nats: maximum payload exceeded")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	fmt.Fprintf(c.writer, "PUB %s %d\r\n", subject, len(data))
+	c.writer.Write(data)
+	_, err := c.writer.WriteString("\r\n")
+	return err
+}
+
+// Flush 发送缓冲区并等待服务器 PONG，确认之前发布的消息已被处理
+func (c *Conn) Flush() error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.writer.WriteString("PING\r\n")
+	if err == nil {
+		err = c.writer.Flush()
+	}
+	c.mu.Unlock()
+	if err != nil {
+		c.fail(err)
+		return err
+	}
+	select {
+	case <-c.pongs:
+		return nil
+	case <-c.closed:
+		return c.Err()
+	case <-time.After(c.timeout):
+		return errors.New("nats: flush timeout")
+	}
+}
+
+func (c *Conn) Close() error {
+	c.fail(errors.New("nats: connection closed"))
+	return nil
+}
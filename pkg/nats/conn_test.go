@@ -0,0 +1,195 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	subject string
+	data    string
+}
+
+// fakeServer 单连接的 NATS 服务端，记录 CONNECT 参数与发布的消息
+type fakeServer struct {
+	listener net.Listener
+	info     string
+	token    string
+
+	mu         sync.Mutex
+	connect    map[string]any
+	messages   []message
+	gotPong    chan struct{}
+	pingClient bool   // 握手完成后主动向客户端发送一次 PING
+	serverErr  string // 不为空时在收到第一条消息后返回 -ERR
+}
+
+func newFakeServer(t *testing.T, info string) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeServer{listener: listener, info: info, gotPong: make(chan struct{}, 1)}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	write := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+	write("INFO " + s.info)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			var connect map[string]any
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &connect)
+			s.mu.Lock()
+			s.connect = connect
+			s.mu.Unlock()
+			if s.token != "" && connect["auth_token"] != s.token {
+				write("-ERR 'Authorization Violation'")
+				return
+			}
+		case line == "PING":
+			write("PONG")
+			if s.pingClient {
+				s.pingClient = false
+				write("PING")
+			}
+		case line == "PONG":
+			s.gotPong <- struct{}{}
+		case strings.HasPrefix(line, "PUB "):
+			fields := strings.Fields(line)
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err = io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, message{subject: fields[1], data: string(payload[:size])})
+			serverErr := s.serverErr
+			s.mu.Unlock()
+			if serverErr != "" {
+				write("-ERR '" + serverErr + "'")
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeServer) snapshot() (map[string]any, []message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connect, append([]message(nil), s.messages...)
+}
+
+func TestPublish(t *testing.T) {
+	server := newFakeServer(t, `{"max_payload":16}`)
+	conn, err := Dial(server.url(), Options{Name: "new-api", Username: "user", Password: "pass", Timeout: time.Second})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.Publish("logs.a", []byte("hello")))
+	require.NoError(t, conn.Publish("logs.b", []byte("line\r\nbreak")))
+	require.NoError(t, conn.Publish("logs.c", nil))
+	require.NoError(t, conn.Flush())
+
+	connect, messages := server.snapshot()
+	require.Equal(t, "new-api", connect["name"])
+	require.Equal(t, "user", connect["user"])
+	require.Equal(t, "pass", connect["pass"])
+	require.Equal(t, []message{{"logs.a", "hello"}, {"logs.b", "line\r\nbreak"}, {"logs.c", ""}}, messages)
+
+	require.Error(t, conn.Publish("", []byte("x")))
+	require.Error(t, conn.Publish("logs a", []byte("x")))
+	require.Error(t, conn.Publish("logs", []byte(strings.Repeat("x", 17))))
+}
+
+func TestDial_URLCredentials(t *testing.T) {
+	server := newFakeServer(t, `{"auth_required":true}`)
+	server.token = "secret"
+	addr := server.listener.Addr().String()
+
+	conn, err := Dial("secret@"+addr, Options{Username: "ignored", Password: "ignored", Timeout: time.Second})
+	require.NoError(t, err)
+	connect, _ := server.snapshot()
+	require.Equal(t, "secret", connect["auth_token"])
+	require.Nil(t, connect["user"])
+	conn.Close()
+
+	_, err = Dial("nats://wrong@"+addr, Options{Timeout: time.Second})
+	require.EqualError(t, err, "nats: Authorization Violation")
+}
+
+func TestDial_Invalid(t *testing.T) {
+	_, err := Dial("http://127.0.0.1:4222", Options{})
+	require.Error(t, err)
+
+	server := newFakeServer(t, `not json`)
+	_, err = Dial(server.url(), Options{Timeout: time.Second})
+	require.ErrorContains(t, err, "invalid server info")
+}
+
+func TestServerError(t *testing.T) {
+	server := newFakeServer(t, `{}`)
+	server.serverErr = "Permissions Violation"
+	conn, err := Dial(server.url(), Options{Timeout: time.Second})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.Publish("logs", []byte("x")))
+	require.EqualError(t, conn.Flush(), "nats: Permissions Violation")
+	require.EqualError(t, conn.Publish("logs", []byte("x")), "nats: Permissions Violation")
+}
+
+func TestServerPing(t *testing.T) {
+	server := newFakeServer(t, `{}`)
+	server.pingClient = true
+	conn, err := Dial(server.url(), Options{Timeout: time.Second})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	select {
+	case <-server.gotPong:
+	case <-time.After(time.Second):
+		t.Fatal("client did not answer server PING")
+	}
+	require.NoError(t, conn.Flush())
+}
+
+func TestClose(t *testing.T) {
+	server := newFakeServer(t, `{}`)
+	conn, err := Dial(server.url(), Options{Timeout: time.Second})
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	require.Error(t, conn.Err())
+	require.Error(t, conn.Flush())
+}
@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/QuantumNous/new-api"
+
+var (
+	reloadMutex sync.Mutex
+	applied     system_setting.TracingSetting
+	provider    *sdktrace.TracerProvider
+	enabled     atomic.Bool
+	propagator  = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+)
+
+func Enabled() bool {
+	return enabled.Load()
+}
+
+func sameSetting(a, b *system_setting.TracingSetting) bool {
+	return a.Enabled == b.Enabled && a.Endpoint == b.Endpoint && a.SampleRatio == b.SampleRatio &&
+		a.ServiceName == b.ServiceName && maps.Equal(a.Headers, b.Headers)
+}
+
+// Reload 按当前配置重建 exporter，配置未变化时不做处理
+func Reload() {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	setting := *system_setting.GetTracingSetting()
+	if sameSetting(&setting, &applied) && (provider != nil) == setting.Enabled {
+		return
+	}
+	applied = setting
+	applied.Headers = maps.Clone(setting.Headers)
+
+	old := provider
+	provider = nil
+	enabled.Store(false)
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	if old != nil {
+		go shutdown(old)
+	}
+	if !setting.Enabled || setting.Endpoint == "" {
+		return
+	}
+
+	endpoint, err := url.Parse(setting.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		common.SysError("invalid otlp endpoint: " + setting.Endpoint)
+		return
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/traces"
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint.String())}
+	if len(setting.Headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(setting.Headers))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		common.SysError("failed to create otlp trace exporter: " + err.Error())
+		return
+	}
+	serviceName := setting.ServiceName
+	if serviceName == "" {
+		serviceName = "new-api"
+	}
+	res := resource.NewSchemaless(
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(common.Version),
+	)
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(setting.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	enabled.Store(true)
+	common.SysLog("opentelemetry tracing enabled, exporting to " + setting.Endpoint)
+}
+
+func shutdown(p *sdktrace.TracerProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		common.SysError("failed to shutdown trace provider: " + err.Error())
+	}
+}
+
+// Shutdown 退出前导出缓冲中的 span
+func Shutdown() {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	if provider != nil {
+		shutdown(provider)
+		provider = nil
+		enabled.Store(false)
+	}
+}
+
+// Start 创建子 span，未启用追踪时返回空 span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !Enabled() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartServer 从请求头中提取上游 traceparent 并创建入口 span
+func StartServer(r *http.Request, name string) (context.Context, trace.Span) {
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// Inject 向发往上游的请求写入 traceparent
+func Inject(ctx context.Context, header http.Header) {
+	if !Enabled() {
+		return
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -7,9 +7,11 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -67,6 +69,14 @@ func AudioHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
 		return newAPIError
 	}
+	if pricePerMinute, ok := operation_setting.GetAudioPricePerMinute(info.OriginModelName); ok {
+		duration, err := service.GetAudioDurationSeconds(c)
+		if err == nil && duration > 0 {
+			service.PostAudioDurationConsumeQuota(c, info, usage.(*dto.Usage), pricePerMinute, duration)
+			return nil
+		}
+		logger.LogWarn(c, fmt.Sprintf("failed to get audio duration for per-minute billing, fallback to token billing: %v", err))
+	}
 	if usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0 {
 		service.PostAudioConsumeQuota(c, info, usage.(*dto.Usage), "")
 	} else {
@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"errors"
 	"io"
 	"net/http"
 
@@ -12,6 +13,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// ErrNotImplemented 适配器未实现对应接口，调用方可据此改用其他转换方式
+var ErrNotImplemented = errors.New("not implemented")
+
 type Adaptor interface {
 	// Init IsStream bool
 	Init(info *relaycommon.RelayInfo)
@@ -52,6 +56,13 @@ type TaskAdaptor interface {
 	ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error)
 }
 
+// TaskCallbackAdaptor 支持上游任务完成回调的异步任务适配器。
+// 回调只用于触发立即查询，任务结果仍以 FetchTask 的返回为准，避免伪造的回调改变任务状态
+type TaskCallbackAdaptor interface {
+	// ParseTaskCallback 从回调请求体中解析上游任务 ID
+	ParseTaskCallback(body []byte) (taskID string, err error)
+}
+
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
@@ -12,7 +12,9 @@ import (
 	"time"
 
 	common2 "github.com/QuantumNous/new-api/common"
+	appconstant "github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -23,6 +25,8 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Header) {
@@ -254,6 +258,13 @@ func processHeaderOverride(info *common.RelayInfo, c *gin.Context) (map[string]s
 
 		headerOverride[key] = value
 	}
+	if c != nil {
+		for key, value := range common2.GetContextKeyStringMap(c, appconstant.ContextKeyTransformHeaders) {
+			if str, ok := value.(string); ok {
+				headerOverride[key] = str
+			}
+		}
+	}
 	return headerOverride, nil
 }
 
@@ -354,7 +365,11 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 		targetHeader.Set(key, value)
 	}
 	targetHeader.Set("Content-Type", c.Request.Header.Get("Content-Type"))
-	targetConn, _, err := websocket.DefaultDialer.Dial(fullRequestURL, targetHeader)
+	dialer, err := service.NewProxyWebsocketDialer(info.ChannelSetting.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("new proxy dialer failed: %w", err)
+	}
+	targetConn, _, err := dialer.Dial(fullRequestURL, targetHeader)
 	if err != nil {
 		return nil, fmt.Errorf("dial failed to %s: %w", fullRequestURL, err)
 	}
@@ -463,6 +478,73 @@ func sendPingData(c *gin.Context, mutex *sync.Mutex) error {
 	}
 }
 
+// nonStreamKeepAliveEnabled 仅对返回 JSON 的对话类请求保活，空白字符会破坏音频、图片等二进制响应
+func nonStreamKeepAliveEnabled(info *common.RelayInfo) bool {
+	generalSettings := operation_setting.GetGeneralSetting()
+	if !generalSettings.PingIntervalEnabled || !generalSettings.NonStreamKeepAliveEnabled || info.DisablePing {
+		return false
+	}
+	switch info.RelayFormat {
+	case types.RelayFormatOpenAI, types.RelayFormatClaude, types.RelayFormatGemini, types.RelayFormatOpenAIResponses:
+		return true
+	}
+	return false
+}
+
+// startNonStreamKeepAlive 等待上游响应期间定期写出换行符，JSON 前的空白不影响客户端解析。
+// 返回的函数会等待写入协程退出，保证之后写出响应时不会并发写入
+func startNonStreamKeepAlive(c *gin.Context, interval time.Duration) func() {
+	if interval <= 0 {
+		interval = helper.DefaultPingInterval
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	gopool.Go(func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !c.Writer.Written() {
+					c.Header("Content-Type", "application/json")
+					c.Writer.WriteHeader(http.StatusOK)
+				}
+				if _, err := c.Writer.Write([]byte("\n")); err != nil {
+					logger.LogError(c, "non-stream keep-alive error: "+err.Error())
+					return
+				}
+				if err := helper.FlushWriter(c); err != nil {
+					return
+				}
+			case <-stop:
+				return
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}
+}
+
+// cancelOnCloseBody 关闭响应体时释放请求的超时 context
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
 func DoRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http.Response, error) {
 	return doRequest(c, req, info)
 }
@@ -478,6 +560,22 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		client = service.GetHttpClient()
 	}
 
+	req = service.WithRelayRaceContext(c, req)
+	policy := info.TimeoutPolicy()
+	if policy.ConnectTimeout > 0 {
+		req = req.WithContext(service.WithConnectTimeout(req.Context(), time.Duration(policy.ConnectTimeout)*time.Second))
+	}
+	cancelRequest := context.CancelFunc(func() {})
+	if policy.RequestTimeout > 0 {
+		// 单独配置了整体超时时不再受全局超时限制，超时计时持续到响应体读取完毕
+		customClient := *client
+		customClient.Timeout = 0
+		client = &customClient
+		var requestCtx context.Context
+		requestCtx, cancelRequest = context.WithTimeout(req.Context(), time.Duration(policy.RequestTimeout)*time.Second)
+		req = req.WithContext(requestCtx)
+	}
+
 	var stopPinger context.CancelFunc
 	if info.IsStream {
 		helper.SetEventStreamHeaders(c)
@@ -498,14 +596,40 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	if !info.IsStream && nonStreamKeepAliveEnabled(info) {
+		stopKeepAlive := startNonStreamKeepAlive(c, time.Duration(operation_setting.GetGeneralSetting().PingIntervalSeconds)*time.Second)
+		// 收到响应头后即停止，之后由适配器写出响应
+		defer stopKeepAlive()
+	}
+
+	ctx, span := tracing.Start(c.Request.Context(), "upstream",
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.Int("newapi.channel_id", info.ChannelId),
+	)
+	defer span.End()
+	tracing.Inject(ctx, req.Header)
+
+	capture := service.StartBodyCapture(c, info, req)
 	resp, err := client.Do(req)
+	capture.Finish(resp, err)
 	if err != nil {
+		cancelRequest()
+		span.SetStatus(codes.Error, err.Error())
 		logger.LogError(c, "do request failed: "+err.Error())
 		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
 	}
 	if resp == nil {
+		cancelRequest()
 		return nil, errors.New("resp is nil")
 	}
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancelRequest}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode == http.StatusOK && !service.ClaimRelayRace(c) {
+		// 竞速中其他渠道已先返回，丢弃本次响应，不进入计费
+		_ = resp.Body.Close()
+		return nil, types.NewError(errors.New("relay race lost"), types.ErrorCodeDoRequestFailed, types.ErrOptionWithSkipRetry())
+	}
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
@@ -31,6 +31,7 @@ type Adaptor struct {
 	AwsModelId string
 	AwsReq     any
 	IsNova     bool
+	IsConverse bool
 }
 
 func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
@@ -96,7 +97,7 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		if len(awsSecret) != 2 {
 			return "", errors.New("invalid aws api key, should be in format of <api-key>|<region>")
 		}
-		return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/converse", awsModelId, awsSecret[1]), nil
+		return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/converse", awsSecret[1], awsModelId), nil
 	} else {
 		a.ClientMode = ClientModeAKSK
 		return "", nil
@@ -122,6 +123,16 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 		return novaReq, nil
 	}
 
+	// Llama、Titan、Mistral 等模型通过 Converse API 统一转换
+	if awsModelId := getAwsModelID(request.Model); isConverseModel(awsModelId) {
+		converseReq, err := convertToConverseRequest(request, awsModelId)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert openai request to converse request")
+		}
+		a.IsConverse = true
+		return converseReq, nil
+	}
+
 	// 原有的Claude模型处理逻辑
 	claudeReq, err := claude.RequestOpenAI2ClaudeMessage(c, *request)
 	if err != nil {
@@ -142,11 +153,12 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
 	// TODO implement me
-	return nil, errors.New("not implemented")
+	return nil, channel.ErrNotImplemented
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
-	if a.ClientMode == ClientModeApiKey {
+	// Converse 流式响应为 AWS event stream 编码，API Key 模式同样通过 SDK 发起请求
+	if a.ClientMode == ClientModeApiKey && !a.IsConverse {
 		return channel.DoApiRequest(a, c, info, requestBody)
 	} else {
 		return doAwsClientRequest(c, info, a, requestBody)
@@ -154,7 +166,13 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
-	if a.ClientMode == ClientModeApiKey {
+	if a.IsConverse {
+		if info.IsStream {
+			err, usage = converseStreamHandler(c, info, a)
+		} else {
+			err, usage = converseHandler(c, info, a)
+		}
+	} else if a.ClientMode == ClientModeApiKey {
 		claudeAdaptor := claude.Adaptor{}
 		usage, err = claudeAdaptor.DoResponse(c, resp, info)
 	} else {
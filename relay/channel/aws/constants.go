@@ -25,6 +25,16 @@ var awsModelIDMap = map[string]string{
 	"nova-reel-v1:0":    "amazon.nova-reel-v1:0",
 	"nova-reel-v1:1":    "amazon.nova-reel-v1:1",
 	"nova-sonic-v1:0":   "amazon.nova-sonic-v1:0",
+	// Converse models
+	"llama3-8b-instruct":      "meta.llama3-8b-instruct-v1:0",
+	"llama3-70b-instruct":     "meta.llama3-70b-instruct-v1:0",
+	"llama3-1-8b-instruct":    "meta.llama3-1-8b-instruct-v1:0",
+	"llama3-1-70b-instruct":   "meta.llama3-1-70b-instruct-v1:0",
+	"llama3-3-70b-instruct":   "meta.llama3-3-70b-instruct-v1:0",
+	"titan-text-lite-v1":      "amazon.titan-text-lite-v1",
+	"titan-text-express-v1":   "amazon.titan-text-express-v1",
+	"titan-text-premier-v1:0": "amazon.titan-text-premier-v1:0",
+	"mistral-large-2402":      "mistral.mistral-large-2402-v1:0",
 }
 
 var awsModelCanCrossRegionMap = map[string]map[string]bool{
@@ -121,6 +131,16 @@ var awsModelCanCrossRegionMap = map[string]map[string]bool{
 		"eu":   true,
 		"apac": true,
 	},
+	// Llama 3.1 及以上仅支持通过跨区域推理配置调用
+	"meta.llama3-1-8b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama3-1-70b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama3-3-70b-instruct-v1:0": {
+		"us": true,
+	},
 }
 
 var awsRegionCrossModelPrefixMap = map[string]string{
@@ -135,3 +155,22 @@ var ChannelName = "aws"
 func isNovaModel(modelId string) bool {
 	return strings.Contains(modelId, "nova-")
 }
+
+// 走 Converse API 的模型 ID 前缀，未列出的模型按原有的 Claude 方式调用
+var awsConverseModelPrefixes = []string{
+	"meta.llama",
+	"amazon.titan-text",
+	"mistral.",
+	"cohere.command-r",
+	"ai21.jamba",
+}
+
+// 判断是否走 Converse API，兼容带跨区域前缀（如 us.）的模型 ID
+func isConverseModel(modelId string) bool {
+	for _, prefix := range awsConverseModelPrefixes {
+		if strings.HasPrefix(modelId, prefix) || strings.Contains(modelId, "."+prefix) {
+			return true
+		}
+	}
+	return false
+}
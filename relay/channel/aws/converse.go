@@ -0,0 +1,521 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	bedrockruntimeTypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// ConverseRequest Bedrock Converse API 请求体，字段与 Converse REST 接口保持一致，
+// 便于参数覆盖等通用逻辑直接作用于 JSON
+type ConverseRequest struct {
+	Messages        []ConverseMessage        `json:"messages"`
+	System          []ConverseContent        `json:"system,omitempty"`
+	InferenceConfig *ConverseInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *ConverseToolConfig      `json:"toolConfig,omitempty"`
+}
+
+type ConverseMessage struct {
+	Role    string            `json:"role"`
+	Content []ConverseContent `json:"content"`
+}
+
+type ConverseContent struct {
+	Text       string              `json:"text,omitempty"`
+	ToolUse    *ConverseToolUse    `json:"toolUse,omitempty"`
+	ToolResult *ConverseToolResult `json:"toolResult,omitempty"`
+}
+
+type ConverseToolUse struct {
+	ToolUseId string `json:"toolUseId"`
+	Name      string `json:"name"`
+	Input     any    `json:"input"`
+}
+
+type ConverseToolResult struct {
+	ToolUseId string            `json:"toolUseId"`
+	Content   []ConverseContent `json:"content"`
+}
+
+type ConverseInferenceConfig struct {
+	MaxTokens     int      `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          float64  `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type ConverseToolConfig struct {
+	Tools      []ConverseTool `json:"tools"`
+	ToolChoice map[string]any `json:"toolChoice,omitempty"`
+}
+
+type ConverseTool struct {
+	ToolSpec ConverseToolSpec `json:"toolSpec"`
+}
+
+type ConverseToolSpec struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	InputSchema ConverseInputSchema `json:"inputSchema"`
+}
+
+type ConverseInputSchema struct {
+	Json any `json:"json"`
+}
+
+// Titan 文本模型不支持 system 提示词，需要合并到首条用户消息
+func isTitanModel(modelId string) bool {
+	return strings.Contains(modelId, "titan-")
+}
+
+// convertToConverseRequest 将 OpenAI 对话请求转换为 Converse 格式，
+// Converse 要求 user/assistant 交替出现，相邻同角色消息会被合并
+func convertToConverseRequest(req *dto.GeneralOpenAIRequest, awsModelId string) (*ConverseRequest, error) {
+	converseReq := &ConverseRequest{}
+	var systemTexts []string
+	for _, msg := range req.Messages {
+		var role string
+		var contents []ConverseContent
+		switch msg.Role {
+		case "system", "developer":
+			if text := msg.StringContent(); text != "" {
+				systemTexts = append(systemTexts, text)
+			}
+			continue
+		case "tool":
+			role = "user"
+			contents = append(contents, ConverseContent{
+				ToolResult: &ConverseToolResult{
+					ToolUseId: msg.ToolCallId,
+					Content:   []ConverseContent{{Text: msg.StringContent()}},
+				},
+			})
+		case "assistant":
+			role = "assistant"
+			if text := msg.StringContent(); text != "" {
+				contents = append(contents, ConverseContent{Text: text})
+			}
+			for _, toolCall := range msg.ParseToolCalls() {
+				var input any = map[string]any{}
+				if toolCall.Function.Arguments != "" {
+					if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &input); err != nil {
+						return nil, fmt.Errorf("invalid tool call arguments: %w", err)
+					}
+				}
+				contents = append(contents, ConverseContent{
+					ToolUse: &ConverseToolUse{
+						ToolUseId: toolCall.ID,
+						Name:      toolCall.Function.Name,
+						Input:     input,
+					},
+				})
+			}
+		default:
+			role = "user"
+			if text := msg.StringContent(); text != "" {
+				contents = append(contents, ConverseContent{Text: text})
+			}
+		}
+		if len(contents) == 0 {
+			continue
+		}
+		last := len(converseReq.Messages) - 1
+		if last >= 0 && converseReq.Messages[last].Role == role {
+			converseReq.Messages[last].Content = append(converseReq.Messages[last].Content, contents...)
+		} else {
+			converseReq.Messages = append(converseReq.Messages, ConverseMessage{Role: role, Content: contents})
+		}
+	}
+	if len(converseReq.Messages) == 0 {
+		return nil, errors.New("messages is empty")
+	}
+
+	if len(systemTexts) > 0 {
+		systemText := strings.Join(systemTexts, "\n")
+		if isTitanModel(awsModelId) {
+			first := &converseReq.Messages[0]
+			if first.Role == "user" {
+				first.Content = append([]ConverseContent{{Text: systemText}}, first.Content...)
+			} else {
+				converseReq.Messages = append([]ConverseMessage{{Role: "user", Content: []ConverseContent{{Text: systemText}}}}, converseReq.Messages...)
+			}
+		} else {
+			converseReq.System = []ConverseContent{{Text: systemText}}
+		}
+	}
+
+	maxTokens := req.GetMaxTokens()
+	stopSequences := parseStopSequences(req.Stop)
+	if maxTokens != 0 || req.Temperature != nil || req.TopP != 0 || len(stopSequences) > 0 {
+		converseReq.InferenceConfig = &ConverseInferenceConfig{
+			MaxTokens:     int(maxTokens),
+			Temperature:   req.Temperature,
+			TopP:          req.TopP,
+			StopSequences: stopSequences,
+		}
+	}
+
+	toolChoice, toolsEnabled := convertConverseToolChoice(req.ToolChoice)
+	if len(req.Tools) > 0 && toolsEnabled {
+		toolConfig := &ConverseToolConfig{ToolChoice: toolChoice}
+		for _, tool := range req.Tools {
+			if tool.Type != "" && tool.Type != "function" {
+				continue
+			}
+			parameters := tool.Function.Parameters
+			if parameters == nil {
+				parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			toolConfig.Tools = append(toolConfig.Tools, ConverseTool{
+				ToolSpec: ConverseToolSpec{
+					Name:        tool.Function.Name,
+					Description: tool.Function.Description,
+					InputSchema: ConverseInputSchema{Json: parameters},
+				},
+			})
+		}
+		if len(toolConfig.Tools) > 0 {
+			converseReq.ToolConfig = toolConfig
+		}
+	}
+	return converseReq, nil
+}
+
+// convertConverseToolChoice 转换 tool_choice，返回 false 表示不应向上游发送工具定义
+func convertConverseToolChoice(toolChoice any) (map[string]any, bool) {
+	switch v := toolChoice.(type) {
+	case string:
+		switch v {
+		case "none":
+			return nil, false
+		case "required":
+			return map[string]any{"any": map[string]any{}}, true
+		case "auto":
+			return map[string]any{"auto": map[string]any{}}, true
+		}
+	case map[string]any:
+		if function, ok := v["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				return map[string]any{"tool": map[string]any{"name": name}}, true
+			}
+		}
+	}
+	return nil, true
+}
+
+func (r *ConverseRequest) toSdkMessages() []bedrockruntimeTypes.Message {
+	messages := make([]bedrockruntimeTypes.Message, 0, len(r.Messages))
+	for _, msg := range r.Messages {
+		messages = append(messages, bedrockruntimeTypes.Message{
+			Role:    bedrockruntimeTypes.ConversationRole(msg.Role),
+			Content: toSdkContentBlocks(msg.Content),
+		})
+	}
+	return messages
+}
+
+func toSdkContentBlocks(contents []ConverseContent) []bedrockruntimeTypes.ContentBlock {
+	blocks := make([]bedrockruntimeTypes.ContentBlock, 0, len(contents))
+	for _, content := range contents {
+		switch {
+		case content.ToolUse != nil:
+			blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberToolUse{
+				Value: bedrockruntimeTypes.ToolUseBlock{
+					ToolUseId: aws.String(content.ToolUse.ToolUseId),
+					Name:      aws.String(content.ToolUse.Name),
+					Input:     document.NewLazyDocument(content.ToolUse.Input),
+				},
+			})
+		case content.ToolResult != nil:
+			resultBlocks := make([]bedrockruntimeTypes.ToolResultContentBlock, 0, len(content.ToolResult.Content))
+			for _, result := range content.ToolResult.Content {
+				resultBlocks = append(resultBlocks, &bedrockruntimeTypes.ToolResultContentBlockMemberText{Value: result.Text})
+			}
+			blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberToolResult{
+				Value: bedrockruntimeTypes.ToolResultBlock{
+					ToolUseId: aws.String(content.ToolResult.ToolUseId),
+					Content:   resultBlocks,
+				},
+			})
+		default:
+			blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberText{Value: content.Text})
+		}
+	}
+	return blocks
+}
+
+func (r *ConverseRequest) toSdkSystem() []bedrockruntimeTypes.SystemContentBlock {
+	if len(r.System) == 0 {
+		return nil
+	}
+	system := make([]bedrockruntimeTypes.SystemContentBlock, 0, len(r.System))
+	for _, content := range r.System {
+		system = append(system, &bedrockruntimeTypes.SystemContentBlockMemberText{Value: content.Text})
+	}
+	return system
+}
+
+func (r *ConverseRequest) toSdkInferenceConfig() *bedrockruntimeTypes.InferenceConfiguration {
+	if r.InferenceConfig == nil {
+		return nil
+	}
+	config := &bedrockruntimeTypes.InferenceConfiguration{
+		StopSequences: r.InferenceConfig.StopSequences,
+	}
+	if r.InferenceConfig.MaxTokens > 0 {
+		config.MaxTokens = aws.Int32(int32(r.InferenceConfig.MaxTokens))
+	}
+	if r.InferenceConfig.Temperature != nil {
+		config.Temperature = aws.Float32(float32(*r.InferenceConfig.Temperature))
+	}
+	if r.InferenceConfig.TopP != 0 {
+		config.TopP = aws.Float32(float32(r.InferenceConfig.TopP))
+	}
+	return config
+}
+
+func (r *ConverseRequest) toSdkToolConfig() *bedrockruntimeTypes.ToolConfiguration {
+	if r.ToolConfig == nil || len(r.ToolConfig.Tools) == 0 {
+		return nil
+	}
+	config := &bedrockruntimeTypes.ToolConfiguration{}
+	for _, tool := range r.ToolConfig.Tools {
+		spec := bedrockruntimeTypes.ToolSpecification{
+			Name:        aws.String(tool.ToolSpec.Name),
+			InputSchema: &bedrockruntimeTypes.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(tool.ToolSpec.InputSchema.Json)},
+		}
+		if tool.ToolSpec.Description != "" {
+			spec.Description = aws.String(tool.ToolSpec.Description)
+		}
+		config.Tools = append(config.Tools, &bedrockruntimeTypes.ToolMemberToolSpec{Value: spec})
+	}
+	if _, ok := r.ToolConfig.ToolChoice["any"]; ok {
+		config.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAny{}
+	} else if tool, ok := r.ToolConfig.ToolChoice["tool"].(map[string]any); ok {
+		name, _ := tool["name"].(string)
+		config.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberTool{Value: bedrockruntimeTypes.SpecificToolChoice{Name: aws.String(name)}}
+	} else if _, ok := r.ToolConfig.ToolChoice["auto"]; ok {
+		config.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAuto{}
+	}
+	return config
+}
+
+func buildConverseAwsRequest(info *relaycommon.RelayInfo, a *Adaptor, awsModelId string, converseReq *ConverseRequest) {
+	if info.IsStream {
+		a.AwsReq = &bedrockruntime.ConverseStreamInput{
+			ModelId:         aws.String(awsModelId),
+			Messages:        converseReq.toSdkMessages(),
+			System:          converseReq.toSdkSystem(),
+			InferenceConfig: converseReq.toSdkInferenceConfig(),
+			ToolConfig:      converseReq.toSdkToolConfig(),
+		}
+		return
+	}
+	a.AwsReq = &bedrockruntime.ConverseInput{
+		ModelId:         aws.String(awsModelId),
+		Messages:        converseReq.toSdkMessages(),
+		System:          converseReq.toSdkSystem(),
+		InferenceConfig: converseReq.toSdkInferenceConfig(),
+		ToolConfig:      converseReq.toSdkToolConfig(),
+	}
+}
+
+func converseStopReason2OpenAI(reason bedrockruntimeTypes.StopReason) string {
+	switch reason {
+	case bedrockruntimeTypes.StopReasonMaxTokens:
+		return "length"
+	case bedrockruntimeTypes.StopReasonToolUse:
+		return "tool_calls"
+	case bedrockruntimeTypes.StopReasonContentFiltered, bedrockruntimeTypes.StopReasonGuardrailIntervened:
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func converseUsage2OpenAI(usage *bedrockruntimeTypes.TokenUsage) dto.Usage {
+	result := dto.Usage{}
+	if usage == nil {
+		return result
+	}
+	result.PromptTokens = int(aws.ToInt32(usage.InputTokens))
+	result.CompletionTokens = int(aws.ToInt32(usage.OutputTokens))
+	result.TotalTokens = int(aws.ToInt32(usage.TotalTokens))
+	if result.TotalTokens == 0 {
+		result.TotalTokens = result.PromptTokens + result.CompletionTokens
+	}
+	result.PromptTokensDetails.CachedTokens = int(aws.ToInt32(usage.CacheReadInputTokens))
+	return result
+}
+
+func converseHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	ctx, cancel := newAwsInvokeContext()
+	defer cancel()
+
+	awsResp, err := a.AwsClient.Converse(ctx, a.AwsReq.(*bedrockruntime.ConverseInput))
+	if err != nil {
+		statusCode := getAwsErrorStatusCode(err)
+		return types.NewOpenAIError(errors.Wrap(err, "Converse"), types.ErrorCodeAwsInvokeError, statusCode), nil
+	}
+
+	message := dto.Message{Role: "assistant"}
+	var responseText strings.Builder
+	var toolCalls []dto.ToolCallResponse
+	if output, ok := awsResp.Output.(*bedrockruntimeTypes.ConverseOutputMemberMessage); ok {
+		for _, block := range output.Value.Content {
+			switch v := block.(type) {
+			case *bedrockruntimeTypes.ContentBlockMemberText:
+				responseText.WriteString(v.Value)
+			case *bedrockruntimeTypes.ContentBlockMemberToolUse:
+				arguments := "{}"
+				if v.Value.Input != nil {
+					if data, err := v.Value.Input.MarshalSmithyDocument(); err == nil {
+						arguments = string(data)
+					}
+				}
+				toolCalls = append(toolCalls, dto.ToolCallResponse{
+					ID:   aws.ToString(v.Value.ToolUseId),
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name:      aws.ToString(v.Value.Name),
+						Arguments: arguments,
+					},
+				})
+			}
+		}
+	}
+	message.SetStringContent(responseText.String())
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+
+	usage := converseUsage2OpenAI(awsResp.Usage)
+	response := dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseStopReason2OpenAI(awsResp.StopReason),
+		}},
+		Usage: usage,
+	}
+
+	c.JSON(http.StatusOK, response)
+	return nil, &response.Usage
+}
+
+func converseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	ctx, cancel := newAwsInvokeContext()
+	defer cancel()
+
+	awsResp, err := a.AwsClient.ConverseStream(ctx, a.AwsReq.(*bedrockruntime.ConverseStreamInput))
+	if err != nil {
+		statusCode := getAwsErrorStatusCode(err)
+		return types.NewOpenAIError(errors.Wrap(err, "ConverseStream"), types.ErrorCodeAwsInvokeError, statusCode), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	helper.SetEventStreamHeaders(c)
+	responseId := helper.GetResponseID(c)
+	created := common.GetTimestamp()
+	model := info.UpstreamModelName
+	usage := &dto.Usage{}
+	var responseText strings.Builder
+	// Converse 按内容块编号，OpenAI 按工具调用编号
+	toolIndexes := make(map[int32]int)
+
+	sendChunk := func(delta dto.ChatCompletionsStreamResponseChoiceDelta) {
+		chunk := dto.ChatCompletionsStreamResponse{
+			Id:      responseId,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{Delta: delta}},
+		}
+		if err := helper.ObjectData(c, chunk); err != nil {
+			common.SysLog("send converse stream response failed: " + err.Error())
+		}
+	}
+
+	for event := range stream.Events() {
+		switch v := event.(type) {
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStart:
+			info.SetFirstResponseTime()
+			_ = helper.ObjectData(c, helper.GenerateStartEmptyResponse(responseId, created, model, nil))
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockStart:
+			start, ok := v.Value.Start.(*bedrockruntimeTypes.ContentBlockStartMemberToolUse)
+			if !ok {
+				continue
+			}
+			toolIndex := len(toolIndexes)
+			toolIndexes[aws.ToInt32(v.Value.ContentBlockIndex)] = toolIndex
+			toolCall := dto.ToolCallResponse{
+				ID:   aws.ToString(start.Value.ToolUseId),
+				Type: "function",
+				Function: dto.FunctionResponse{
+					Name: aws.ToString(start.Value.Name),
+				},
+			}
+			toolCall.SetIndex(toolIndex)
+			sendChunk(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{toolCall}})
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockDelta:
+			info.SetFirstResponseTime()
+			switch delta := v.Value.Delta.(type) {
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberText:
+				responseText.WriteString(delta.Value)
+				sendChunk(dto.ChatCompletionsStreamResponseChoiceDelta{Content: common.GetPointer(delta.Value)})
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberToolUse:
+				input := aws.ToString(delta.Value.Input)
+				responseText.WriteString(input)
+				toolCall := dto.ToolCallResponse{
+					Function: dto.FunctionResponse{Arguments: input},
+				}
+				toolCall.SetIndex(toolIndexes[aws.ToInt32(v.Value.ContentBlockIndex)])
+				sendChunk(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{toolCall}})
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberReasoningContent:
+				if text, ok := delta.Value.(*bedrockruntimeTypes.ReasoningContentBlockDeltaMemberText); ok {
+					responseText.WriteString(text.Value)
+					sendChunk(dto.ChatCompletionsStreamResponseChoiceDelta{ReasoningContent: common.GetPointer(text.Value)})
+				}
+			}
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStop:
+			stopResponse := helper.GenerateStopResponse(responseId, created, model, converseStopReason2OpenAI(v.Value.StopReason))
+			_ = helper.ObjectData(c, stopResponse)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMetadata:
+			*usage = converseUsage2OpenAI(v.Value.Usage)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockStop:
+		default:
+			return types.NewError(errors.New("nil or unknown response type"), types.ErrorCodeInvalidRequest), nil
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return types.NewOpenAIError(errors.Wrap(err, "ConverseStream"), types.ErrorCodeAwsInvokeError, getAwsErrorStatusCode(err)), nil
+	}
+
+	if usage.CompletionTokens == 0 {
+		usage = service.ResponseText2Usage(c, responseText.String(), info.UpstreamModelName, info.GetEstimatePromptTokens())
+	}
+	if info.ShouldIncludeUsage {
+		_ = helper.ObjectData(c, helper.GenerateFinalUsageResponse(responseId, created, model, *usage))
+	}
+	helper.Done(c)
+	return nil, usage
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 )
 
 type AwsClaudeRequest struct {
@@ -37,7 +38,7 @@ func formatRequest(requestBody io.Reader, requestHeader http.Header) (*AwsClaude
 	awsClaudeRequest.AnthropicVersion = "bedrock-2023-05-31"
 
 	// check header anthropic-beta
-	anthropicBetaValues := requestHeader.Get("anthropic-beta")
+	anthropicBetaValues := operation_setting.FilterAnthropicBeta(requestHeader.Get("anthropic-beta"))
 	if len(anthropicBetaValues) > 0 {
 		var tempArray []string
 		tempArray = strings.Split(anthropicBetaValues, ",")
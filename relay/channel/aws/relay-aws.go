@@ -107,7 +107,15 @@ func doAwsClientRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor,
 	requestHeader := http.Header{}
 	a.SetupRequestHeader(c, &requestHeader, info)
 
-	if isNovaModel(awsModelId) {
+	if a.IsConverse {
+		var converseReq *ConverseRequest
+		err = common.DecodeJson(requestBody, &converseReq)
+		if err != nil {
+			return nil, types.NewError(errors.Wrap(err, "decode converse request fail"), types.ErrorCodeBadRequestBody)
+		}
+		buildConverseAwsRequest(info, a, awsModelId, converseReq)
+		return nil, nil
+	} else if isNovaModel(awsModelId) {
 		var novaReq *NovaRequest
 		err = common.DecodeJson(requestBody, &novaReq)
 		if err != nil {
@@ -237,7 +237,7 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 				formatMessages = formatMessages[:len(formatMessages)-1]
 			}
 		}
-		if fmtMessage.Content == nil {
+		if fmtMessage.Content == nil && fmtMessage.ToolCalls == nil {
 			fmtMessage.SetStringContent("...")
 		}
 		formatMessages = append(formatMessages, fmtMessage)
@@ -325,10 +325,17 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 					claudeMediaMessage := dto.ClaudeMediaMessage{
 						Type: mediaMessage.Type,
 					}
-					if mediaMessage.Type == "text" {
+					if mediaMessage.Type == dto.ContentTypeText {
+						// Claude 不接受空的文本块
+						if mediaMessage.Text == "" {
+							continue
+						}
 						claudeMediaMessage.Text = common.GetPointer[string](mediaMessage.Text)
 					} else {
 						imageUrl := mediaMessage.GetImageMedia()
+						if mediaMessage.Type != dto.ContentTypeImageURL || imageUrl == nil {
+							continue
+						}
 						claudeMediaMessage.Type = "image"
 						claudeMediaMessage.Source = &dto.ClaudeMessageSource{
 							Type: "base64",
@@ -351,16 +358,12 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 				}
 				if message.ToolCalls != nil {
 					for _, toolCall := range message.ParseToolCalls() {
-						inputObj := make(map[string]any)
-						if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &inputObj); err != nil {
-							common.SysLog("tool call function arguments is not a map[string]any: " + fmt.Sprintf("%v", toolCall.Function.Arguments))
-							continue
-						}
+						// 丢弃工具调用会使后续的 tool_result 找不到对应的 tool_use，参数不完整时尽量补全
 						claudeMediaMessages = append(claudeMediaMessages, dto.ClaudeMediaMessage{
 							Type:  "tool_use",
 							Id:    toolCall.ID,
 							Name:  toolCall.Function.Name,
-							Input: inputObj,
+							Input: service.ParseToolArguments(toolCall.Function.Arguments),
 						})
 					}
 				}
@@ -380,7 +383,8 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 	return &claudeRequest, nil
 }
 
-func StreamResponseClaude2OpenAI(claudeResponse *dto.ClaudeResponse) *dto.ChatCompletionsStreamResponse {
+// StreamResponseClaude2OpenAI claudeInfo 用于把 tool_use 内容块的序号转换为 OpenAI 工具调用的 index
+func StreamResponseClaude2OpenAI(claudeResponse *dto.ClaudeResponse, claudeInfo *ClaudeResponseInfo) *dto.ChatCompletionsStreamResponse {
 	var response dto.ChatCompletionsStreamResponse
 	response.Object = "chat.completion.chunk"
 	response.Model = claudeResponse.Model
@@ -388,9 +392,13 @@ func StreamResponseClaude2OpenAI(claudeResponse *dto.ClaudeResponse) *dto.ChatCo
 	tools := make([]dto.ToolCallResponse, 0)
 	fcIdx := 0
 	if claudeResponse.Index != nil {
-		fcIdx = *claudeResponse.Index - 1
-		if fcIdx < 0 {
-			fcIdx = 0
+		if claudeInfo != nil {
+			fcIdx = claudeInfo.toolCallIndex(*claudeResponse.Index, claudeResponse)
+		} else {
+			fcIdx = *claudeResponse.Index - 1
+			if fcIdx < 0 {
+				fcIdx = 0
+			}
 		}
 	}
 	var choice dto.ChatCompletionsStreamResponseChoice
@@ -471,10 +479,9 @@ func ResponseClaude2OpenAI(claudeResponse *dto.ClaudeResponse) *dto.OpenAITextRe
 		Object:  "chat.completion",
 		Created: common.GetTimestamp(),
 	}
-	var responseText string
+	var responseText strings.Builder
 	var responseThinking string
 	if len(claudeResponse.Content) > 0 {
-		responseText = claudeResponse.Content[0].GetText()
 		if claudeResponse.Content[0].Thinking != nil {
 			responseThinking = *claudeResponse.Content[0].Thinking
 		}
@@ -501,7 +508,8 @@ func ResponseClaude2OpenAI(claudeResponse *dto.ClaudeResponse) *dto.OpenAITextRe
 				thinkingContent = *message.Thinking
 			}
 		case "text":
-			responseText = message.GetText()
+			// 联网搜索等场景会返回多个文本块
+			responseText.WriteString(message.GetText())
 		}
 	}
 	choice := dto.OpenAITextResponseChoice{
@@ -511,7 +519,7 @@ func ResponseClaude2OpenAI(claudeResponse *dto.ClaudeResponse) *dto.OpenAITextRe
 		},
 		FinishReason: stopReasonClaude2OpenAI(claudeResponse.StopReason),
 	}
-	choice.SetStringContent(responseText)
+	choice.SetStringContent(responseText.String())
 	if len(responseThinking) > 0 {
 		choice.ReasoningContent = responseThinking
 	}
@@ -532,6 +540,24 @@ type ClaudeResponseInfo struct {
 	ResponseText strings.Builder
 	Usage        *dto.Usage
 	Done         bool
+	// toolCallIndexes tool_use 内容块序号 -> OpenAI 工具调用 index
+	toolCallIndexes map[int]int
+}
+
+// toolCallIndex 工具调用按 tool_use 内容块出现的顺序从 0 开始编号，前面的文本与思考块不占用序号
+func (info *ClaudeResponseInfo) toolCallIndex(blockIndex int, claudeResponse *dto.ClaudeResponse) int {
+	if index, ok := info.toolCallIndexes[blockIndex]; ok {
+		return index
+	}
+	if claudeResponse.Type != "content_block_start" || claudeResponse.ContentBlock == nil || claudeResponse.ContentBlock.Type != "tool_use" {
+		return len(info.toolCallIndexes)
+	}
+	if info.toolCallIndexes == nil {
+		info.toolCallIndexes = make(map[int]int)
+	}
+	index := len(info.toolCallIndexes)
+	info.toolCallIndexes[blockIndex] = index
+	return index
 }
 
 func FormatClaudeResponseInfo(claudeResponse *dto.ClaudeResponse, oaiResponse *dto.ChatCompletionsStreamResponse, claudeInfo *ClaudeResponseInfo) bool {
@@ -631,7 +657,7 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		}
 		helper.ClaudeChunkData(c, claudeResponse, data)
 	} else if info.RelayFormat == types.RelayFormatOpenAI {
-		response := StreamResponseClaude2OpenAI(&claudeResponse)
+		response := StreamResponseClaude2OpenAI(&claudeResponse, claudeInfo)
 
 		if !FormatClaudeResponseInfo(&claudeResponse, response, claudeInfo) {
 			return nil
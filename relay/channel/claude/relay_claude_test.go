@@ -0,0 +1,96 @@
+package claude
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+func TestRequestOpenAI2ClaudeMessageToolCalls(t *testing.T) {
+	body := `{
+		"model": "claude-sonnet",
+		"messages": [
+			{"role": "user", "content": "weather?"},
+			{"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_a", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Par"}},
+				{"id": "call_b", "type": "function", "function": {"name": "get_time", "arguments": ""}}
+			]},
+			{"role": "tool", "tool_call_id": "call_a", "content": "sunny"},
+			{"role": "tool", "tool_call_id": "call_b", "content": "noon"}
+		]
+	}`
+	var request dto.GeneralOpenAIRequest
+	if err := common.UnmarshalJsonStr(body, &request); err != nil {
+		t.Fatal(err)
+	}
+	claudeRequest, err := RequestOpenAI2ClaudeMessage(nil, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claudeRequest.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(claudeRequest.Messages))
+	}
+
+	assistant, ok := claudeRequest.Messages[1].Content.([]dto.ClaudeMediaMessage)
+	if !ok || len(assistant) != 2 {
+		t.Fatalf("empty text should be dropped and both tool calls kept, got %+v", claudeRequest.Messages[1].Content)
+	}
+	if !reflect.DeepEqual(assistant[0].Input, map[string]any{"city": "Par"}) {
+		t.Fatalf("partial arguments should be repaired, got %+v", assistant[0].Input)
+	}
+	if !reflect.DeepEqual(assistant[1].Input, map[string]any{}) {
+		t.Fatalf("empty arguments should become an empty object, got %+v", assistant[1].Input)
+	}
+
+	results, ok := claudeRequest.Messages[2].Content.([]dto.ClaudeMediaMessage)
+	if !ok || len(results) != 2 || results[0].ToolUseId != "call_a" || results[1].ToolUseId != "call_b" {
+		t.Fatalf("tool results should be merged into one user message, got %+v", claudeRequest.Messages[2])
+	}
+}
+
+func TestStreamResponseClaude2OpenAIToolIndexes(t *testing.T) {
+	events := []string{
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_a","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_start","index":3,"content_block":{"type":"tool_use","id":"toolu_b","name":"get_time","input":{}}}`,
+		`{"type":"content_block_delta","index":3,"delta":{"type":"input_json_delta","partial_json":"{}"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+	}
+	claudeInfo := &ClaudeResponseInfo{}
+	var indexes []int
+	for _, event := range events {
+		var claudeResponse dto.ClaudeResponse
+		if err := common.UnmarshalJsonStr(event, &claudeResponse); err != nil {
+			t.Fatal(err)
+		}
+		response := StreamResponseClaude2OpenAI(&claudeResponse, claudeInfo)
+		if response == nil || len(response.Choices) == 0 {
+			continue
+		}
+		for _, toolCall := range response.Choices[0].Delta.ToolCalls {
+			indexes = append(indexes, *toolCall.Index)
+		}
+	}
+	if expected := []int{0, 0, 1, 1, 0}; !reflect.DeepEqual(indexes, expected) {
+		t.Fatalf("unexpected tool call indexes %v, expected %v", indexes, expected)
+	}
+}
+
+func TestResponseClaude2OpenAIMultipleTextBlocks(t *testing.T) {
+	body := `{"id":"msg_1","type":"message","role":"assistant","model":"claude","stop_reason":"end_turn","content":[
+		{"type":"text","text":"Paris is "},
+		{"type":"text","text":"sunny."}
+	]}`
+	var claudeResponse dto.ClaudeResponse
+	if err := common.UnmarshalJsonStr(body, &claudeResponse); err != nil {
+		t.Fatal(err)
+	}
+	response := ResponseClaude2OpenAI(&claudeResponse)
+	if got := response.Choices[0].Message.StringContent(); got != "Paris is sunny." {
+		t.Fatalf("text blocks should be concatenated, got %q", got)
+	}
+}
@@ -234,6 +234,11 @@ func cohereRerankHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 		usage.TotalTokens = cohereResp.Meta.BilledUnits.InputTokens + cohereResp.Meta.BilledUnits.OutputTokens
 	}
 
+	if !info.ReturnDocuments {
+		for i := range cohereResp.Results {
+			cohereResp.Results[i].Document = nil
+		}
+	}
 	var rerankResp dto.RerankResponse
 	rerankResp.Results = cohereResp.Results
 	rerankResp.Usage = usage
@@ -0,0 +1,6 @@
+package local
+
+// ModelList 本地部署的模型名称由用户自行填写
+var ModelList = []string{}
+
+var ChannelName = "local"
@@ -79,7 +79,8 @@ func openAIChatToOllamaChat(c *gin.Context, r *dto.GeneralOpenAIRequest) (*Ollam
 		}
 	}
 
-	if len(r.Tools) > 0 {
+	// Ollama 不支持 tool_choice，none 时直接不发送工具定义
+	if toolChoice, _ := r.ToolChoice.(string); len(r.Tools) > 0 && toolChoice != "none" {
 		tools := make([]OllamaTool, 0, len(r.Tools))
 		for _, t := range r.Tools {
 			tools = append(tools, OllamaTool{Type: "function", Function: OllamaToolFunction{Name: t.Function.Name, Description: t.Function.Description, Parameters: t.Function.Parameters}})
@@ -88,6 +89,8 @@ func openAIChatToOllamaChat(c *gin.Context, r *dto.GeneralOpenAIRequest) (*Ollam
 	}
 
 	chatReq.Messages = make([]OllamaChatMessage, 0, len(r.Messages))
+	// Ollama 工具结果按函数名关联，OpenAI 按 tool_call_id 关联
+	toolNameById := make(map[string]string)
 	for _, m := range r.Messages {
 		var textBuilder strings.Builder
 		var images []string
@@ -123,8 +126,12 @@ func openAIChatToOllamaChat(c *gin.Context, r *dto.GeneralOpenAIRequest) (*Ollam
 		if len(images) > 0 {
 			cm.Images = images
 		}
-		if m.Role == "tool" && m.Name != nil {
-			cm.ToolName = *m.Name
+		if m.Role == "tool" {
+			if m.Name != nil {
+				cm.ToolName = *m.Name
+			} else {
+				cm.ToolName = toolNameById[m.ToolCallId]
+			}
 		}
 		if m.ToolCalls != nil && len(m.ToolCalls) > 0 {
 			parsed := m.ParseToolCalls()
@@ -138,6 +145,9 @@ func openAIChatToOllamaChat(c *gin.Context, r *dto.GeneralOpenAIRequest) (*Ollam
 					if args == nil {
 						args = map[string]any{}
 					}
+					if tc.ID != "" {
+						toolNameById[tc.ID] = tc.Function.Name
+					}
 					oc := OllamaToolCall{}
 					oc.Function.Name = tc.Function.Name
 					oc.Function.Arguments = args
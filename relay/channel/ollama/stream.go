@@ -155,7 +155,9 @@ func ollamaStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 		usage.CompletionTokens = chunk.EvalCount
 		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 		finishReason := chunk.DoneReason
-		if finishReason == "" {
+		if toolCallIndex > 0 && (finishReason == "" || finishReason == "stop") {
+			finishReason = "tool_calls"
+		} else if finishReason == "" {
 			finishReason = "stop"
 		}
 		// emit stop delta
@@ -198,7 +200,21 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 		reasoningBuilder strings.Builder
 		lastChunk        ollamaChatStreamChunk
 		parsedAny        bool
+		toolCalls        []dto.ToolCallResponse
 	)
+	appendToolCalls := func(ck *ollamaChatStreamChunk) {
+		if ck.Message == nil {
+			return
+		}
+		for _, tc := range ck.Message.ToolCalls {
+			argBytes, _ := json.Marshal(tc.Function.Arguments)
+			toolCalls = append(toolCalls, dto.ToolCallResponse{
+				ID:       fmt.Sprintf("call_%d", len(toolCalls)),
+				Type:     "function",
+				Function: dto.FunctionResponse{Name: tc.Function.Name, Arguments: string(argBytes)},
+			})
+		}
+	}
 	for _, ln := range lines {
 		ln = strings.TrimSpace(ln)
 		if ln == "" {
@@ -213,6 +229,7 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 		}
 		parsedAny = true
 		lastChunk = ck
+		appendToolCalls(&ck)
 		if ck.Message != nil && len(ck.Message.Thinking) > 0 {
 			raw := strings.TrimSpace(string(ck.Message.Thinking))
 			if raw != "" && raw != "null" {
@@ -239,6 +256,7 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
 		}
 		lastChunk = single
+		appendToolCalls(&single)
 		if single.Message != nil {
 			if len(single.Message.Thinking) > 0 {
 				raw := strings.TrimSpace(string(single.Message.Thinking))
@@ -267,7 +285,9 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 	usage := &dto.Usage{PromptTokens: lastChunk.PromptEvalCount, CompletionTokens: lastChunk.EvalCount, TotalTokens: lastChunk.PromptEvalCount + lastChunk.EvalCount}
 	content := aggContent.String()
 	finishReason := lastChunk.DoneReason
-	if finishReason == "" {
+	if len(toolCalls) > 0 && (finishReason == "" || finishReason == "stop") {
+		finishReason = "tool_calls"
+	} else if finishReason == "" {
 		finishReason = "stop"
 	}
 
@@ -275,6 +295,9 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 	if rc := reasoningBuilder.String(); rc != "" {
 		msg.ReasoningContent = rc
 	}
+	if len(toolCalls) > 0 {
+		msg.SetToolCalls(toolCalls)
+	}
 	full := dto.OpenAITextResponse{
 		Id:      common.GetUUID(),
 		Model:   model,
@@ -21,6 +21,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel/lingyiwanwu"
 
 	//"github.com/QuantumNous/new-api/relay/channel/minimax"
+	"github.com/QuantumNous/new-api/relay/channel/local"
 	"github.com/QuantumNous/new-api/relay/channel/openrouter"
 	"github.com/QuantumNous/new-api/relay/channel/xinference"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
@@ -125,6 +126,10 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		if apiVersion == "" {
 			apiVersion = constant.AzureDefaultAPIVersion
 		}
+		deployment, hasDeployment := info.ChannelOtherSettings.GetAzureDeployment(info.UpstreamModelName)
+		if hasDeployment && deployment.ApiVersion != "" {
+			apiVersion = deployment.ApiVersion
+		}
 		// https://learn.microsoft.com/en-us/azure/cognitive-services/openai/chatgpt-quickstart?pivots=rest-api&tabs=command-line#rest-api
 		requestURL := strings.Split(info.RequestURLPath, "?")[0]
 		requestURL = fmt.Sprintf("%s?api-version=%s", requestURL, apiVersion)
@@ -154,8 +159,10 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		}
 
 		model_ := info.UpstreamModelName
-		// 2025年5月10日后创建的渠道不移除.
-		if info.ChannelCreateTime < constant.AzureNoRemoveDotTime {
+		if hasDeployment {
+			model_ = deployment.Deployment
+		} else if info.ChannelCreateTime < constant.AzureNoRemoveDotTime {
+			// 2025年5月10日后创建的渠道不移除.
 			model_ = strings.Replace(model_, ".", "", -1)
 		}
 		// https://github.com/songquanpeng/one-api/issues/67
@@ -190,6 +197,10 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, header *http.Header, info *
 	// 检查 Header Override 是否已设置 Authorization，如果已设置则跳过默认设置
 	// 这样可以避免在 Header Override 应用时被覆盖（虽然 Header Override 会在之后应用，但这里作为额外保护）
 	hasAuthOverride := false
+	// 本地渠道未配置密钥时不发送鉴权头
+	if info.ChannelType == constant.ChannelTypeLocal && info.ApiKey == "" {
+		hasAuthOverride = true
+	}
 	if len(info.HeadersOverride) > 0 {
 		for k := range info.HeadersOverride {
 			if strings.EqualFold(k, "Authorization") {
@@ -367,30 +378,11 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 		}
 		return bytes.NewReader(jsonData), nil
 	} else {
-		var requestBody bytes.Buffer
-		writer := multipart.NewWriter(&requestBody)
-
-		writer.WriteField("model", request.Model)
-
 		formData, err2 := common.ParseMultipartFormReusable(c)
 		if err2 != nil {
 			return nil, fmt.Errorf("error parsing multipart form: %w", err2)
 		}
 
-		// 打印类似 curl 命令格式的信息
-		logger.LogDebug(c.Request.Context(), fmt.Sprintf("--form 'model=\"%s\"'", request.Model))
-
-		// 遍历表单字段并打印输出
-		for key, values := range formData.Value {
-			if key == "model" {
-				continue
-			}
-			for _, value := range values {
-				writer.WriteField(key, value)
-				logger.LogDebug(c.Request.Context(), fmt.Sprintf("--form '%s=\"%s\"'", key, value))
-			}
-		}
-
 		// 从 formData 中获取文件
 		fileHeaders := formData.File["file"]
 		if len(fileHeaders) == 0 {
@@ -399,39 +391,67 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 
 		// 使用 formData 中的第一个文件
 		fileHeader := fileHeaders[0]
-		logger.LogDebug(c.Request.Context(), fmt.Sprintf("--form 'file=@\"%s\"' (size: %d bytes, content-type: %s)",
-			fileHeader.Filename, fileHeader.Size, fileHeader.Header.Get("Content-Type")))
-
 		file, err := fileHeader.Open()
 		if err != nil {
 			return nil, fmt.Errorf("error opening audio file: %v", err)
 		}
-		defer file.Close()
 
-		part, err := writer.CreateFormFile("file", fileHeader.Filename)
-		if err != nil {
-			return nil, errors.New("create form file failed")
-		}
-		if _, err := io.Copy(part, file); err != nil {
-			return nil, errors.New("copy file failed")
-		}
+		// 打印类似 curl 命令格式的信息
+		logger.LogDebug(c.Request.Context(), fmt.Sprintf("--form 'model=\"%s\"'", request.Model))
+		logger.LogDebug(c.Request.Context(), fmt.Sprintf("--form 'file=@\"%s\"' (size: %d bytes, content-type: %s)",
+			fileHeader.Filename, fileHeader.Size, fileHeader.Header.Get("Content-Type")))
+
+		// 边读取上传的文件边发往上游
+		return relaycommon.StreamMultipart(c, func(writer *multipart.Writer) error {
+			defer file.Close()
+			writer.WriteField("model", request.Model)
+			// 遍历表单字段并打印输出
+			for key, values := range formData.Value {
+				if key == "model" {
+					continue
+				}
+				for _, value := range values {
+					writer.WriteField(key, value)
+					logger.LogDebug(c.Request.Context(), fmt.Sprintf("--form '%s=\"%s\"'", key, value))
+				}
+			}
+			part, err := writer.CreateFormFile("file", fileHeader.Filename)
+			if err != nil {
+				return errors.New("create form file failed")
+			}
+			if _, err := io.Copy(part, file); err != nil {
+				return errors.New("copy file failed")
+			}
+			return nil
+		}), nil
+	}
+}
+
+// copyImageFormFile 按文件扩展名设置 Content-Type 后写入表单文件
+func copyImageFormFile(writer *multipart.Writer, fieldName string, fileHeader *multipart.FileHeader) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Create a form file with the appropriate content type
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, fieldName, fileHeader.Filename))
+	h.Set("Content-Type", detectImageMimeType(fileHeader.Filename))
 
-		// 关闭 multipart 编写器以设置分界线
-		writer.Close()
-		c.Request.Header.Set("Content-Type", writer.FormDataContentType())
-		logger.LogDebug(c.Request.Context(), fmt.Sprintf("--header 'Content-Type: %s'", writer.FormDataContentType()))
-		return &requestBody, nil
+	part, err := writer.CreatePart(h)
+	if err != nil {
+		return err
 	}
+	_, err = io.Copy(part, file)
+	return err
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
 	switch info.RelayMode {
-	case relayconstant.RelayModeImagesEdits:
+	case relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 
-		var requestBody bytes.Buffer
-		writer := multipart.NewWriter(&requestBody)
-
-		writer.WriteField("model", request.Model)
 		// 使用已解析的 multipart 表单，避免重复解析
 		mf := c.Request.MultipartForm
 		if mf == nil {
@@ -440,9 +460,37 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 			}
 			mf = c.Request.MultipartForm
 		}
+		if mf == nil || mf.File == nil {
+			return nil, errors.New("no multipart form data found")
+		}
+
+		// Check if "image" field exists in any form, including array notation
+		var imageFiles []*multipart.FileHeader
+		var exists bool
+
+		// First check for standard "image" field
+		if imageFiles, exists = mf.File["image"]; !exists || len(imageFiles) == 0 {
+			// If not found, check for "image[]" field
+			if imageFiles, exists = mf.File["image[]"]; !exists || len(imageFiles) == 0 {
+				// If still not found, iterate through all fields to find any that start with "image["
+				for fieldName, files := range mf.File {
+					if strings.HasPrefix(fieldName, "image[") && len(files) > 0 {
+						imageFiles = append(imageFiles, files...)
+					}
+				}
 
-		// 写入所有非文件字段
-		if mf != nil {
+				// If no image fields found at all
+				if len(imageFiles) == 0 {
+					return nil, errors.New("image is required")
+				}
+			}
+		}
+		maskFiles := mf.File["mask"]
+
+		// 边读取上传的图片边发往上游
+		return relaycommon.StreamMultipart(c, func(writer *multipart.Writer) error {
+			writer.WriteField("model", request.Model)
+			// 写入所有非文件字段
 			for key, values := range mf.Value {
 				if key == "model" {
 					continue
@@ -451,101 +499,27 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 					writer.WriteField(key, value)
 				}
 			}
-		}
 
-		if mf != nil && mf.File != nil {
-			// Check if "image" field exists in any form, including array notation
-			var imageFiles []*multipart.FileHeader
-			var exists bool
-
-			// First check for standard "image" field
-			if imageFiles, exists = mf.File["image"]; !exists || len(imageFiles) == 0 {
-				// If not found, check for "image[]" field
-				if imageFiles, exists = mf.File["image[]"]; !exists || len(imageFiles) == 0 {
-					// If still not found, iterate through all fields to find any that start with "image["
-					foundArrayImages := false
-					for fieldName, files := range mf.File {
-						if strings.HasPrefix(fieldName, "image[") && len(files) > 0 {
-							foundArrayImages = true
-							imageFiles = append(imageFiles, files...)
-						}
-					}
-
-					// If no image fields found at all
-					if !foundArrayImages && (len(imageFiles) == 0) {
-						return nil, errors.New("image is required")
-					}
-				}
+			// If multiple images, use image[] as the field name
+			fieldName := "image"
+			if len(imageFiles) > 1 {
+				fieldName = "image[]"
 			}
-
 			// Process all image files
 			for i, fileHeader := range imageFiles {
-				file, err := fileHeader.Open()
-				if err != nil {
-					return nil, fmt.Errorf("failed to open image file %d: %w", i, err)
+				if err := copyImageFormFile(writer, fieldName, fileHeader); err != nil {
+					return fmt.Errorf("copy file failed for image %d: %w", i, err)
 				}
-
-				// If multiple images, use image[] as the field name
-				fieldName := "image"
-				if len(imageFiles) > 1 {
-					fieldName = "image[]"
-				}
-
-				// Determine MIME type based on file extension
-				mimeType := detectImageMimeType(fileHeader.Filename)
-
-				// Create a form file with the appropriate content type
-				h := make(textproto.MIMEHeader)
-				h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, fieldName, fileHeader.Filename))
-				h.Set("Content-Type", mimeType)
-
-				part, err := writer.CreatePart(h)
-				if err != nil {
-					return nil, fmt.Errorf("create form part failed for image %d: %w", i, err)
-				}
-
-				if _, err := io.Copy(part, file); err != nil {
-					return nil, fmt.Errorf("copy file failed for image %d: %w", i, err)
-				}
-
-				// 复制完立即关闭，避免在循环内使用 defer 占用资源
-				_ = file.Close()
 			}
 
 			// Handle mask file if present
-			if maskFiles, exists := mf.File["mask"]; exists && len(maskFiles) > 0 {
-				maskFile, err := maskFiles[0].Open()
-				if err != nil {
-					return nil, errors.New("failed to open mask file")
+			if len(maskFiles) > 0 {
+				if err := copyImageFormFile(writer, "mask", maskFiles[0]); err != nil {
+					return fmt.Errorf("copy mask file failed: %w", err)
 				}
-				// 复制完立即关闭，避免在循环内使用 defer 占用资源
-
-				// Determine MIME type for mask file
-				mimeType := detectImageMimeType(maskFiles[0].Filename)
-
-				// Create a form file with the appropriate content type
-				h := make(textproto.MIMEHeader)
-				h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="mask"; filename="%s"`, maskFiles[0].Filename))
-				h.Set("Content-Type", mimeType)
-
-				maskPart, err := writer.CreatePart(h)
-				if err != nil {
-					return nil, errors.New("create form file failed for mask")
-				}
-
-				if _, err := io.Copy(maskPart, maskFile); err != nil {
-					return nil, errors.New("copy mask file failed")
-				}
-				_ = maskFile.Close()
 			}
-		} else {
-			return nil, errors.New("no multipart form data found")
-		}
-
-		// 关闭 multipart 编写器以设置分界线
-		writer.Close()
-		c.Request.Header.Set("Content-Type", writer.FormDataContentType())
-		return &requestBody, nil
+			return nil
+		}), nil
 
 	default:
 		return request, nil
@@ -594,7 +568,8 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
 	if info.RelayMode == relayconstant.RelayModeAudioTranscription ||
 		info.RelayMode == relayconstant.RelayModeAudioTranslation ||
-		info.RelayMode == relayconstant.RelayModeImagesEdits {
+		info.RelayMode == relayconstant.RelayModeImagesEdits ||
+		info.RelayMode == relayconstant.RelayModeImagesVariations {
 		return channel.DoFormRequest(a, c, info, requestBody)
 	} else if info.RelayMode == relayconstant.RelayModeRealtime {
 		return channel.DoWssRequest(a, c, info, requestBody)
@@ -613,7 +588,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		fallthrough
 	case relayconstant.RelayModeAudioTranscription:
 		err, usage = OpenaiSTTHandler(c, resp, info, a.ResponseFormat)
-	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits:
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		usage, err = OpenaiHandlerWithUsage(c, info, resp)
 	case relayconstant.RelayModeRerank:
 		usage, err = common_handler.RerankHandler(c, info, resp)
@@ -645,6 +620,8 @@ func (a *Adaptor) GetModelList() []string {
 	//	return minimax.ModelList
 	case constant.ChannelTypeXinference:
 		return xinference.ModelList
+	case constant.ChannelTypeLocal:
+		return local.ModelList
 	case constant.ChannelTypeOpenRouter:
 		return openrouter.ModelList
 	default:
@@ -662,6 +639,8 @@ func (a *Adaptor) GetChannelName() string {
 	//	return minimax.ChannelName
 	case constant.ChannelTypeXinference:
 		return xinference.ChannelName
+	case constant.ChannelTypeLocal:
+		return local.ChannelName
 	case constant.ChannelTypeOpenRouter:
 		return openrouter.ChannelName
 	default:
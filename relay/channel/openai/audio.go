@@ -100,6 +100,7 @@ func OpenaiTTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 			usage.CompletionTokens = estimatedTokens
 			usage.CompletionTokenDetails.AudioTokens = estimatedTokens
 		} else if duration > 0 {
+			common.SetContextKey(c, constant.ContextKeyAudioDurationSeconds, duration)
 			// 计算 token: ceil(duration) / 60.0 * 1000，即每分钟 1000 tokens
 			completionTokens := int(math.Round(math.Ceil(duration) / 60.0 * 1000))
 			usage.CompletionTokens = completionTokens
@@ -122,9 +123,15 @@ func OpenaiSTTHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	service.IOCopyBytesGracefully(c, resp, responseBody)
 
 	var responseData struct {
-		Usage *dto.Usage `json:"usage"`
+		Duration float64    `json:"duration"`
+		Usage    *dto.Usage `json:"usage"`
 	}
-	if err := common.Unmarshal(responseBody, &responseData); err == nil && responseData.Usage != nil {
+	err = common.Unmarshal(responseBody, &responseData)
+	if err == nil && responseData.Duration > 0 {
+		// verbose_json 返回的时长比本地解析更准确
+		common.SetContextKey(c, constant.ContextKeyAudioDurationSeconds, responseData.Duration)
+	}
+	if err == nil && responseData.Usage != nil {
 		if responseData.Usage.TotalTokens > 0 {
 			usage := responseData.Usage
 			if usage.PromptTokens == 0 {
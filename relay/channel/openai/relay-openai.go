@@ -1,10 +1,12 @@
 package openai
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -12,8 +14,10 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/relay/channel/openrouter"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/QuantumNous/new-api/types"
 
@@ -111,6 +115,10 @@ func OaiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Re
 
 	defer service.CloseResponseBodyGracefully(resp)
 
+	if canPassthroughStream(c, info) {
+		return oaiStreamPassthrough(c, info, resp)
+	}
+
 	model := info.UpstreamModelName
 	var responseId string
 	var createAt int64 = 0
@@ -193,6 +201,76 @@ func OaiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Re
 	return usage, nil
 }
 
+// canPassthroughStream 无需改写流式响应内容时直接转发上游数据
+func canPassthroughStream(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	return constant.StreamPassthroughEnabled &&
+		info.RelayFormat == types.RelayFormatOpenAI &&
+		// 客户端未要求返回用量时需要去掉上游被强制返回的用量块
+		info.ShouldIncludeUsage &&
+		!info.ChannelSetting.ForceFormat &&
+		!info.ChannelSetting.ThinkingToContent &&
+		// 音频模型的用量位于倒数第二个数据块
+		!strings.Contains(strings.ToLower(info.UpstreamModelName), "audio") &&
+		!service.ReasoningFormatEnabled(c)
+}
+
+// oaiStreamPassthrough 只保留最后一个数据块与估算用量所需的文本，不保存完整响应
+func oaiStreamPassthrough(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	var responseTextBuilder strings.Builder
+	var toolCount int
+	var lastStreamData []byte
+
+	helper.StreamPassthroughHandler(c, resp, info, func(data []byte) {
+		lastStreamData = append(lastStreamData[:0], data...)
+		collectStreamText(info.RelayMode, data, &responseTextBuilder, &toolCount)
+	})
+
+	model := info.UpstreamModelName
+	var responseId string
+	var createAt int64
+	var systemFingerprint string
+	var containStreamUsage bool
+	usage := &dto.Usage{}
+	lastData := string(lastStreamData)
+	if lastData != "" {
+		// 最后一个数据块已经转发
+		shouldSendLastResp := true
+		if err := handleLastResponse(lastData, &responseId, &createAt, &systemFingerprint, &model, &usage,
+			&containStreamUsage, info, &shouldSendLastResp); err != nil {
+			logger.LogError(c, fmt.Sprintf("error handling last response: %s, lastStreamData: [%s]", err.Error(), lastData))
+		}
+	}
+
+	if !containStreamUsage {
+		usage = service.ResponseText2Usage(c, responseTextBuilder.String(), info.UpstreamModelName, info.GetEstimatePromptTokens())
+		usage.CompletionTokens += toolCount * 7
+	}
+
+	applyUsagePostProcessing(info, usage, lastStreamData)
+
+	HandleFinalResponse(c, info, lastData, responseId, createAt, model, systemFingerprint, usage, containStreamUsage)
+
+	return usage, nil
+}
+
+// collectStreamText 逐块累计输出文本，上游未返回用量时用于估算
+func collectStreamText(relayMode int, data []byte, responseTextBuilder *strings.Builder, toolCount *int) {
+	switch relayMode {
+	case relayconstant.RelayModeChatCompletions:
+		var streamResponse dto.ChatCompletionsStreamResponse
+		if err := common.Unmarshal(data, &streamResponse); err == nil {
+			_ = ProcessStreamResponse(streamResponse, responseTextBuilder, toolCount)
+		}
+	case relayconstant.RelayModeCompletions:
+		var streamResponse dto.CompletionsStreamResponse
+		if err := common.Unmarshal(data, &streamResponse); err == nil {
+			for _, choice := range streamResponse.Choices {
+				responseTextBuilder.WriteString(choice.Text)
+			}
+		}
+	}
+}
+
 func OpenaiHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
 	defer service.CloseResponseBodyGracefully(resp)
 
@@ -518,12 +596,25 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 		}
 	})
 
+	// 超过最长会话时间后主动关闭客户端连接
+	var sessionTimeout <-chan time.Time
+	if maxMinutes := operation_setting.GetRealtimeSetting().MaxSessionMinutes; maxMinutes > 0 {
+		timer := time.NewTimer(time.Duration(maxMinutes) * time.Minute)
+		defer timer.Stop()
+		sessionTimeout = timer.C
+	}
+
 	select {
 	case <-clientClosed:
 	case <-targetClosed:
 	case err := <-errChan:
 		//return service.OpenAIErrorWrapper(err, "realtime_error", http.StatusInternalServerError), nil
 		logger.LogError(c, "realtime error: "+err.Error())
+	case <-sessionTimeout:
+		logger.LogInfo(c, "realtime session closed: max session duration exceeded")
+		_ = clientConn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "max session duration exceeded"),
+			time.Now().Add(time.Second))
 	case <-c.Done():
 	}
 
@@ -628,6 +719,42 @@ func applyUsagePostProcessing(info *relaycommon.RelayInfo, usage *dto.Usage, res
 			}
 		}
 	}
+
+	// OpenRouter 及 Claude 兼容上游会在 OpenAI 格式的 usage 中返回缓存写入 tokens，需按缓存创建倍率计费
+	if usage.PromptTokensDetails.CachedCreationTokens == 0 {
+		if cacheCreationTokens, ok := extractCacheCreationTokensFromBody(responseBody); ok {
+			usage.PromptTokensDetails.CachedCreationTokens = cacheCreationTokens
+		}
+	}
+}
+
+// extractCacheCreationTokensFromBody 提取缓存写入 tokens，兼容
+// usage.prompt_tokens_details.cache_write_tokens (OpenRouter) 与 usage.cache_creation_input_tokens
+func extractCacheCreationTokensFromBody(body []byte) (int, bool) {
+	if len(body) == 0 || (!bytes.Contains(body, []byte("cache_write_tokens")) && !bytes.Contains(body, []byte("cache_creation_input_tokens"))) {
+		return 0, false
+	}
+
+	var payload struct {
+		Usage struct {
+			PromptTokensDetails struct {
+				CacheWriteTokens *int `json:"cache_write_tokens"`
+			} `json:"prompt_tokens_details"`
+			CacheCreationInputTokens *int `json:"cache_creation_input_tokens"`
+		} `json:"usage"`
+	}
+
+	if err := common.Unmarshal(body, &payload); err != nil {
+		return 0, false
+	}
+
+	if payload.Usage.PromptTokensDetails.CacheWriteTokens != nil {
+		return *payload.Usage.PromptTokensDetails.CacheWriteTokens, true
+	}
+	if payload.Usage.CacheCreationInputTokens != nil {
+		return *payload.Usage.CacheCreationInputTokens, true
+	}
+	return 0, false
 }
 
 func extractCachedTokensFromBody(body []byte) (int, bool) {
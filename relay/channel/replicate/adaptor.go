@@ -518,7 +518,7 @@ func (a *Adaptor) ConvertAudioRequest(*gin.Context, *relaycommon.RelayInfo, dto.
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(*gin.Context, *relaycommon.RelayInfo, dto.OpenAIResponsesRequest) (any, error) {
-	return nil, errors.New("replicate adaptor: ConvertOpenAIResponsesRequest is not implemented")
+	return nil, fmt.Errorf("replicate adaptor: ConvertOpenAIResponsesRequest is %w", channel.ErrNotImplemented)
 }
 
 func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dto.ClaudeRequest) (any, error) {
@@ -2,6 +2,7 @@ package submodel
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 
@@ -62,7 +63,7 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	return nil, errors.New("submodel channel: endpoint not supported")
+	return nil, fmt.Errorf("submodel channel: endpoint %w", channel.ErrNotImplemented)
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
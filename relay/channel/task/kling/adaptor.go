@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -156,6 +157,9 @@ func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayIn
 	if body.Image == "" && body.ImageTail == "" {
 		c.Set("action", constant.TaskActionTextGenerate)
 	}
+	if body.CallbackUrl == "" {
+		body.CallbackUrl = service.TaskCallbackURL(constant.TaskPlatform(strconv.Itoa(info.ChannelType)))
+	}
 	data, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
@@ -368,6 +372,24 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	return taskInfo, nil
 }
 
+// ParseTaskCallback 回调请求体为任务对象本身，兼容包裹在 data 中的格式
+func (a *TaskAdaptor) ParseTaskCallback(body []byte) (string, error) {
+	var payload struct {
+		TaskId string `json:"task_id"`
+		Data   struct {
+			TaskId string `json:"task_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", errors.Wrap(err, "failed to unmarshal callback body")
+	}
+	taskID := defaultString(payload.TaskId, payload.Data.TaskId)
+	if taskID == "" {
+		return "", errors.New("task_id is required")
+	}
+	return taskID, nil
+}
+
 func isNewAPIRelay(apiKey string) bool {
 	return strings.HasPrefix(apiKey, "sk-")
 }
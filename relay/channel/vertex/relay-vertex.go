@@ -3,6 +3,10 @@ package vertex
 import "github.com/QuantumNous/new-api/common"
 
 func GetModelRegion(other string, localModelName string) string {
+	// 未配置区域时使用全局端点
+	if other == "" {
+		return "global"
+	}
 	// if other is json string
 	if common.IsJsonObject(other) {
 		m, err := common.StrToMap(other)
@@ -3,6 +3,7 @@ package vertex
 import (
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -10,13 +11,14 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/QuantumNous/new-api/common"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
 
-	"github.com/bytedance/gopkg/cache/asynccache"
 	"github.com/golang-jwt/jwt/v5"
 
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -28,39 +30,27 @@ type Credentials struct {
 	ClientID     string `json:"client_id"`
 }
 
-var Cache = asynccache.NewAsyncCache(asynccache.Options{
-	RefreshDuration: time.Minute * 35,
-	EnableExpire:    true,
-	ExpireDuration:  time.Minute * 30,
-	Fetcher: func(key string) (interface{}, error) {
-		return nil, errors.New("not found")
-	},
-})
+type cachedAccessToken struct {
+	token     string
+	expiresAt time.Time
+}
 
-func getAccessToken(a *Adaptor, info *relaycommon.RelayInfo) (string, error) {
-	var cacheKey string
-	if info.ChannelIsMultiKey {
-		cacheKey = fmt.Sprintf("access-token-%d-%d", info.ChannelId, info.ChannelMultiKeyIndex)
-	} else {
-		cacheKey = fmt.Sprintf("access-token-%d", info.ChannelId)
-	}
-	val, err := Cache.Get(cacheKey)
-	if err == nil {
-		return val.(string), nil
-	}
+// accessTokenRefreshAhead 令牌到期前提前刷新的时间，避免请求途中令牌失效
+const accessTokenRefreshAhead = 5 * time.Minute
 
-	signedJWT, err := createSignedJWT(a.AccountCredentials.ClientEmail, a.AccountCredentials.PrivateKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to create signed JWT: %w", err)
-	}
-	newToken, err := exchangeJwtForAccessToken(signedJWT, info)
-	if err != nil {
-		return "", fmt.Errorf("failed to exchange JWT for access token: %w", err)
-	}
-	if err := Cache.SetDefault(cacheKey, newToken); err {
-		return newToken, nil
-	}
-	return newToken, nil
+var (
+	accessTokenCache = make(map[string]cachedAccessToken)
+	accessTokenLock  sync.Mutex
+)
+
+// accessTokenCacheKey 按完整凭据的哈希区分缓存，未提供 private_key_id 的不同私钥也不会共用令牌
+func accessTokenCacheKey(creds Credentials) string {
+	data, _ := common.Marshal(creds)
+	return hex.EncodeToString(common.Sha256Raw(data))
+}
+
+func getAccessToken(a *Adaptor, info *relaycommon.RelayInfo) (string, error) {
+	return AcquireAccessToken(a.AccountCredentials, info.ChannelSetting.Proxy)
 }
 
 func createSignedJWT(email, privateKeyPEM string) (string, error) {
@@ -91,7 +81,7 @@ func createSignedJWT(email, privateKeyPEM string) (string, error) {
 		"iss":   email,
 		"scope": "https://www.googleapis.com/auth/cloud-platform",
 		"aud":   "https://www.googleapis.com/oauth2/v4/token",
-		"exp":   now.Add(time.Minute * 35).Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
 		"iat":   now.Unix(),
 	}
 
@@ -104,51 +94,38 @@ func createSignedJWT(email, privateKeyPEM string) (string, error) {
 	return signedToken, nil
 }
 
-func exchangeJwtForAccessToken(signedJWT string, info *relaycommon.RelayInfo) (string, error) {
-
-	authURL := "https://www.googleapis.com/oauth2/v4/token"
-	data := url.Values{}
-	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
-	data.Set("assertion", signedJWT)
-
-	var client *http.Client
-	var err error
-	if info.ChannelSetting.Proxy != "" {
-		client, err = service.NewProxyHttpClient(info.ChannelSetting.Proxy)
-		if err != nil {
-			return "", fmt.Errorf("new proxy http client failed: %w", err)
-		}
-	} else {
-		client = service.GetHttpClient()
-	}
-
-	resp, err := client.PostForm(authURL, data)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+// AcquireAccessToken 获取服务账号访问令牌，令牌在到期前复用缓存
+func AcquireAccessToken(creds Credentials, proxy string) (string, error) {
+	if creds.ClientEmail == "" || creds.PrivateKey == "" {
+		return "", errors.New("invalid service account credentials: client_email and private_key are required")
 	}
+	cacheKey := accessTokenCacheKey(creds)
 
-	if accessToken, ok := result["access_token"].(string); ok {
-		return accessToken, nil
+	accessTokenLock.Lock()
+	cached, ok := accessTokenCache[cacheKey]
+	accessTokenLock.Unlock()
+	if ok && time.Until(cached.expiresAt) > accessTokenRefreshAhead {
+		return cached.token, nil
 	}
 
-	return "", fmt.Errorf("failed to get access token: %v", result)
-}
-
-func AcquireAccessToken(creds Credentials, proxy string) (string, error) {
 	signedJWT, err := createSignedJWT(creds.ClientEmail, creds.PrivateKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to create signed JWT: %w", err)
 	}
-	return exchangeJwtForAccessTokenWithProxy(signedJWT, proxy)
+	token, expiresIn, err := exchangeJwtForAccessTokenWithProxy(signedJWT, proxy)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange JWT for access token: %w", err)
+	}
+	accessTokenLock.Lock()
+	accessTokenCache[cacheKey] = cachedAccessToken{
+		token:     token,
+		expiresAt: time.Now().Add(expiresIn),
+	}
+	accessTokenLock.Unlock()
+	return token, nil
 }
 
-func exchangeJwtForAccessTokenWithProxy(signedJWT string, proxy string) (string, error) {
+func exchangeJwtForAccessTokenWithProxy(signedJWT string, proxy string) (string, time.Duration, error) {
 	authURL := "https://www.googleapis.com/oauth2/v4/token"
 	data := url.Values{}
 	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
@@ -159,7 +136,7 @@ func exchangeJwtForAccessTokenWithProxy(signedJWT string, proxy string) (string,
 	if proxy != "" {
 		client, err = service.NewProxyHttpClient(proxy)
 		if err != nil {
-			return "", fmt.Errorf("new proxy http client failed: %w", err)
+			return "", 0, fmt.Errorf("new proxy http client failed: %w", err)
 		}
 	} else {
 		client = service.GetHttpClient()
@@ -167,17 +144,23 @@ func exchangeJwtForAccessTokenWithProxy(signedJWT string, proxy string) (string,
 
 	resp, err := client.PostForm(authURL, data)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	defer resp.Body.Close()
 
 	var result map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	if accessToken, ok := result["access_token"].(string); ok {
-		return accessToken, nil
+	accessToken, ok := result["access_token"].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("failed to get access token: %v", result)
+	}
+	// 服务账号令牌默认有效期为 1 小时
+	expiresIn := time.Hour
+	if seconds, ok := result["expires_in"].(float64); ok && seconds > 0 {
+		expiresIn = time.Duration(seconds) * time.Second
 	}
-	return "", fmt.Errorf("failed to get access token: %v", result)
+	return accessToken, expiresIn, nil
 }
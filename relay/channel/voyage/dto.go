@@ -0,0 +1,31 @@
+package voyage
+
+type VoyageRerankRequest struct {
+	Query           string `json:"query"`
+	Documents       []any  `json:"documents"`
+	Model           string `json:"model"`
+	TopK            int    `json:"top_k,omitempty"`
+	ReturnDocuments bool   `json:"return_documents,omitempty"`
+}
+
+type VoyageRerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+	Document       any     `json:"document,omitempty"`
+}
+
+type VoyageRerankResponse struct {
+	Object string               `json:"object"`
+	Data   []VoyageRerankResult `json:"data"`
+	Model  string               `json:"model"`
+	Usage  struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+type VoyageEmbeddingRequest struct {
+	Input           any    `json:"input"`
+	Model           string `json:"model"`
+	OutputDimension int    `json:"output_dimension,omitempty"`
+	EncodingFormat  string `json:"encoding_format,omitempty"`
+}
@@ -0,0 +1,75 @@
+package voyage
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func requestConvertRerank2Voyage(request dto.RerankRequest) *VoyageRerankRequest {
+	return &VoyageRerankRequest{
+		Query:           request.Query,
+		Documents:       request.Documents,
+		Model:           request.Model,
+		TopK:            request.TopN,
+		ReturnDocuments: request.GetReturnDocuments(),
+	}
+}
+
+func requestConvertEmbedding2Voyage(request dto.EmbeddingRequest) *VoyageEmbeddingRequest {
+	voyageRequest := &VoyageEmbeddingRequest{
+		Input:           request.Input,
+		Model:           request.Model,
+		OutputDimension: request.Dimensions,
+	}
+	// voyage 仅支持 base64，默认返回 float 数组
+	if request.EncodingFormat == "base64" {
+		voyageRequest.EncodingFormat = "base64"
+	}
+	return voyageRequest
+}
+
+// voyageRerankHandler 将 voyage 的 data 结构转换为 Jina/Cohere 兼容的 results 结构
+func voyageRerankHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	service.CloseResponseBodyGracefully(resp)
+
+	var voyageResp VoyageRerankResponse
+	if err := common.Unmarshal(responseBody, &voyageResp); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	results := make([]dto.RerankResponseResult, 0, len(voyageResp.Data))
+	for _, item := range voyageResp.Data {
+		result := dto.RerankResponseResult{
+			Index:          item.Index,
+			RelevanceScore: item.RelevanceScore,
+		}
+		if info.ReturnDocuments {
+			result.Document = item.Document
+		}
+		results = append(results, result)
+	}
+	usage := dto.Usage{
+		PromptTokens: voyageResp.Usage.TotalTokens,
+		TotalTokens:  voyageResp.Usage.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage.PromptTokens = info.GetEstimatePromptTokens()
+		usage.TotalTokens = info.GetEstimatePromptTokens()
+	}
+	c.JSON(http.StatusOK, dto.RerankResponse{
+		Results: results,
+		Usage:   usage,
+	})
+	return &usage, nil
+}
@@ -0,0 +1,30 @@
+package common
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// StreamMultipart 在后台写入发往上游的 multipart 请求体，上游边读边发，文件内容不会整体缓冲在内存中。
+// 请求结束时仍未被读取的写入会被中止
+func StreamMultipart(c *gin.Context, write func(writer *multipart.Writer) error) io.Reader {
+	reader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	stop := context.AfterFunc(c.Request.Context(), func() {
+		_ = reader.CloseWithError(context.Canceled)
+	})
+	gopool.Go(func() {
+		defer stop()
+		err := write(writer)
+		if err == nil {
+			err = writer.Close()
+		}
+		_ = pipeWriter.CloseWithError(err)
+	})
+	return reader
+}
@@ -23,7 +23,7 @@ type ConditionOperation struct {
 
 type ParamOperation struct {
 	Path       string               `json:"path"`
-	Mode       string               `json:"mode"` // delete, set, move, copy, prepend, append, trim_prefix, trim_suffix, ensure_prefix, ensure_suffix, trim_space, to_lower, to_upper, replace, regex_replace
+	Mode       string               `json:"mode"` // delete, set, move, copy, prepend, append, merge, max, min, trim_prefix, trim_suffix, ensure_prefix, ensure_suffix, trim_space, to_lower, to_upper, replace, regex_replace
 	Value      interface{}          `json:"value"`
 	KeepOrigin bool                 `json:"keep_origin"`
 	From       string               `json:"from,omitempty"`
@@ -354,6 +354,12 @@ func applyOperations(jsonStr string, operations []ParamOperation, conditionConte
 			result, err = modifyValue(result, opPath, op.Value, op.KeepOrigin, true)
 		case "append":
 			result, err = modifyValue(result, opPath, op.Value, op.KeepOrigin, false)
+		case "merge":
+			result, err = deepMergeValue(result, opPath, op.Value, op.KeepOrigin)
+		case "max":
+			result, err = clampNumberValue(result, opPath, op.Value, true)
+		case "min":
+			result, err = clampNumberValue(result, opPath, op.Value, false)
 		case "trim_prefix":
 			result, err = trimStringValue(result, opPath, op.Value, true)
 		case "trim_suffix":
@@ -568,6 +574,77 @@ func mergeObjects(jsonStr, path string, value interface{}, keepOrigin bool) (str
 	return sjson.Set(jsonStr, path, result)
 }
 
+// clampNumberValue 将数值限制在上限（max）或下限（min）内，字段不存在时不处理
+func clampNumberValue(jsonStr, path string, value interface{}, isMax bool) (string, error) {
+	current := gjson.Get(jsonStr, path)
+	if !current.Exists() {
+		return jsonStr, nil
+	}
+	boundBytes, err := common.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	bound := gjson.ParseBytes(boundBytes)
+	if current.Type != gjson.Number || bound.Type != gjson.Number {
+		return "", fmt.Errorf("clamp requires both values to be numbers, got %v and %v", current.Type, bound.Type)
+	}
+	if (isMax && current.Num > bound.Num) || (!isMax && current.Num < bound.Num) {
+		return sjson.SetRaw(jsonStr, path, bound.Raw)
+	}
+	return jsonStr, nil
+}
+
+func deepMergeMaps(dst, src map[string]interface{}, keepOrigin bool) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		switch {
+		case srcIsMap && dstIsMap:
+			deepMergeMaps(dstMap, srcMap, keepOrigin)
+		case keepOrigin && dst[k] != nil:
+		default:
+			dst[k] = v
+		}
+	}
+}
+
+// deepMergeValue 递归合并对象，路径不存在时直接写入；path 为空时合并到请求体根对象
+func deepMergeValue(jsonStr, path string, value interface{}, keepOrigin bool) (string, error) {
+	var patch map[string]interface{}
+	patchBytes, err := common.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	if err = common.Unmarshal(patchBytes, &patch); err != nil {
+		return "", fmt.Errorf("merge value must be an object: %v", err)
+	}
+
+	raw := jsonStr
+	if path != "" {
+		current := gjson.Get(jsonStr, path)
+		if !current.Exists() {
+			return sjson.SetRaw(jsonStr, path, string(patchBytes))
+		}
+		if !current.IsObject() {
+			return "", fmt.Errorf("merge target is not an object: %s", path)
+		}
+		raw = current.Raw
+	}
+	var target map[string]interface{}
+	if err = common.Unmarshal([]byte(raw), &target); err != nil {
+		return "", err
+	}
+	deepMergeMaps(target, patch, keepOrigin)
+	merged, err := common.Marshal(target)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return string(merged), nil
+	}
+	return sjson.SetRaw(jsonStr, path, string(merged))
+}
+
 // BuildParamOverrideContext 提供 ApplyParamOverride 可用的上下文信息。
 // 目前内置以下字段：
 //   - upstream_model/model：始终为通道映射后的上游模型名。
@@ -772,6 +772,118 @@ func TestApplyParamOverrideToUpper(t *testing.T) {
 	assertJSONEqual(t, `{"model":"GPT-4"}`, string(out))
 }
 
+func TestApplyParamOverrideMaxCapsValue(t *testing.T) {
+	// max example:
+	// {"operations":[{"path":"temperature","mode":"max","value":1}]}
+	input := []byte(`{"model":"gpt-4","temperature":1.8}`)
+	override := map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{
+				"path":  "temperature",
+				"mode":  "max",
+				"value": 1,
+			},
+		},
+	}
+
+	out, err := ApplyParamOverride(input, override, nil)
+	if err != nil {
+		t.Fatalf("ApplyParamOverride returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"gpt-4","temperature":1}`, string(out))
+}
+
+func TestApplyParamOverrideMinNoopAndMissing(t *testing.T) {
+	input := []byte(`{"max_tokens":512}`)
+	override := map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{
+				"path":  "max_tokens",
+				"mode":  "min",
+				"value": 16,
+			},
+			map[string]interface{}{
+				"path":  "temperature",
+				"mode":  "min",
+				"value": 0.1,
+			},
+		},
+	}
+
+	out, err := ApplyParamOverride(input, override, nil)
+	if err != nil {
+		t.Fatalf("ApplyParamOverride returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"max_tokens":512}`, string(out))
+}
+
+func TestApplyParamOverrideMaxRequiresNumber(t *testing.T) {
+	input := []byte(`{"temperature":"hot"}`)
+	override := map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{
+				"path":  "temperature",
+				"mode":  "max",
+				"value": 1,
+			},
+		},
+	}
+
+	if _, err := ApplyParamOverride(input, override, nil); err == nil {
+		t.Fatalf("expected error for non-numeric value")
+	}
+}
+
+func TestApplyParamOverrideMergeRootDeep(t *testing.T) {
+	// merge example:
+	// {"operations":[{"mode":"merge","value":{"generationConfig":{"topK":40}}}]}
+	input := []byte(`{"contents":[],"generationConfig":{"temperature":0.5}}`)
+	override := map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{
+				"mode": "merge",
+				"value": map[string]interface{}{
+					"generationConfig": map[string]interface{}{"topK": 40},
+					"safetySettings": []interface{}{
+						map[string]interface{}{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_NONE"},
+					},
+				},
+			},
+		},
+	}
+
+	out, err := ApplyParamOverride(input, override, nil)
+	if err != nil {
+		t.Fatalf("ApplyParamOverride returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"contents":[],"generationConfig":{"temperature":0.5,"topK":40},"safetySettings":[{"category":"HARM_CATEGORY_HARASSMENT","threshold":"BLOCK_NONE"}]}`, string(out))
+}
+
+func TestApplyParamOverrideMergeKeepOriginMissingPath(t *testing.T) {
+	input := []byte(`{"metadata":{"user":"a"}}`)
+	override := map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{
+				"path":        "metadata",
+				"mode":        "merge",
+				"keep_origin": true,
+				"value":       map[string]interface{}{"user": "b", "tenant": "acme"},
+			},
+			map[string]interface{}{
+				"path":  "provider",
+				"mode":  "merge",
+				"value": map[string]interface{}{"order": []interface{}{"openai"}},
+			},
+		},
+	}
+
+	out, err := ApplyParamOverride(input, override, nil)
+	if err != nil {
+		t.Fatalf("ApplyParamOverride returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"metadata":{"user":"a","tenant":"acme"},"provider":{"order":["openai"]}}`, string(out))
+}
+
 func assertJSONEqual(t *testing.T, want, got string) {
 	t.Helper()
 
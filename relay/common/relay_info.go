@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -37,6 +38,12 @@ type ClaudeConvertInfo struct {
 	Usage            *dto.Usage
 	FinishReason     string
 	Done             bool
+	// Started 已发送 message_start
+	Started bool
+	// ToolBlocks OpenAI 工具调用的 index 对应的 tool_use 内容块序号
+	ToolBlocks map[int]int
+	// ToolIndex 最近一个工具调用的 index
+	ToolIndex int
 }
 
 type RerankerInfo struct {
@@ -111,10 +118,18 @@ type RelayInfo struct {
 	UserSetting            dto.UserSetting
 	UserEmail              string
 	UserQuota              int
+	UserCreditLimit        int
+	BudgetIds              []int  // 本次请求命中的预算，消费后累计
+	BudgetReserved         int    // 预扣费时在命中的预算上预占的额度，结算时替换为实际消费
+	FreeTierRequest        bool   // 本次请求使用了按次的免费额度
+	FreeTierTokens         int    // 本次请求抵扣的免费 token 数
+	FreeTierDay            string // 预扣费时已预占免费额度的自然日，为空表示未预占
 	RelayFormat            types.RelayFormat
 	SendResponseCount      int
 	ReceivedResponseCount  int
-	FinalPreConsumedQuota  int // 最终预消耗的配额
+	StreamInterrupted      bool       // 上游流式响应异常中断（读取出错或超时）
+	PartialUsage           *dto.Usage // 请求失败前已产生上游费用的用量，重试成功时计入，最终失败时按此结算
+	FinalPreConsumedQuota  int        // 最终预消耗的配额
 	// BillingSource indicates whether this request is billed from wallet quota or subscription.
 	// "" or "wallet" => wallet; "subscription" => subscription
 	BillingSource string
@@ -297,6 +312,7 @@ var streamSupportedChannels = map[int]bool{
 	constant.ChannelTypeAli:        true,
 	constant.ChannelTypeSubmodel:   true,
 	constant.ChannelTypeCodex:      true,
+	constant.ChannelTypeLocal:      true,
 }
 
 func GenRelayInfoWs(c *gin.Context, ws *websocket.Conn) *RelayInfo {
@@ -425,12 +441,13 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 	info := &RelayInfo{
 		Request: request,
 
-		RequestId:  reqId,
-		UserId:     common.GetContextKeyInt(c, constant.ContextKeyUserId),
-		UsingGroup: common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
-		UserGroup:  common.GetContextKeyString(c, constant.ContextKeyUserGroup),
-		UserQuota:  common.GetContextKeyInt(c, constant.ContextKeyUserQuota),
-		UserEmail:  common.GetContextKeyString(c, constant.ContextKeyUserEmail),
+		RequestId:       reqId,
+		UserId:          common.GetContextKeyInt(c, constant.ContextKeyUserId),
+		UsingGroup:      common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		UserGroup:       common.GetContextKeyString(c, constant.ContextKeyUserGroup),
+		UserQuota:       common.GetContextKeyInt(c, constant.ContextKeyUserQuota),
+		UserCreditLimit: common.GetContextKeyInt(c, constant.ContextKeyUserCreditLimit),
+		UserEmail:       common.GetContextKeyString(c, constant.ContextKeyUserEmail),
 
 		OriginModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
 
@@ -465,6 +482,9 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		info.RequestURLPath = strings.TrimPrefix(info.RequestURLPath, "/pg")
 		info.RequestURLPath = "/v1" + info.RequestURLPath
 	}
+	if common.GetContextKeyBool(c, constant.ContextKeySkipTokenQuota) {
+		info.IsPlayground = true
+	}
 
 	userSetting, ok := common.GetContextKeyType[dto.UserSetting](c, constant.ContextKeyUserSetting)
 	if ok {
@@ -767,3 +787,17 @@ func RemoveGeminiDisabledFields(jsonData []byte) ([]byte, error) {
 	}
 	return jsonDataAfter, nil
 }
+
+// TimeoutPolicy 渠道配置优先于模型配置，仍未配置的项为零值，由调用方使用全局设置
+func (info *RelayInfo) TimeoutPolicy() operation_setting.RelayTimeoutPolicy {
+	policy := operation_setting.GetRelayTimeoutSetting().Resolve(info.OriginModelName)
+	if info.ChannelMeta == nil {
+		return policy
+	}
+	return policy.Override(operation_setting.RelayTimeoutPolicy{
+		ConnectTimeout:    info.ChannelSetting.ConnectTimeout,
+		RequestTimeout:    info.ChannelSetting.RequestTimeout,
+		StreamIdleTimeout: info.ChannelSetting.StreamIdleTimeout,
+		MaxRetries:        info.ChannelSetting.MaxRetries,
+	})
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/tracing"
+	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -29,6 +31,9 @@ import (
 
 func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types.NewAPIError) {
 	info.InitChannelMeta(c)
+	if info.RelayFormat == types.RelayFormatOpenAI && info.RelayMode == relayconstant.RelayModeChatCompletions {
+		service.SetupReasoningFormatter(c)
+	}
 
 	textReq, ok := info.Request.(*dto.GeneralOpenAIRequest)
 	if !ok {
@@ -69,6 +74,11 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 
 	info.ShouldIncludeUsage = includeUsage
 
+	semanticCacheQuery := prepareSemanticCache(c, info, request)
+	if semanticCacheQuery != nil && serveSemanticCacheHit(c, info, semanticCacheQuery) {
+		return nil
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
@@ -76,6 +86,11 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	adaptor.Init(info)
 
 	passThroughGlobal := model_setting.GetGlobalSettings().PassThroughRequestEnabled
+	if !passThroughGlobal && !info.ChannelSetting.PassThroughBodyEnabled {
+		if err := preprocessVisionInputs(c, info, request); err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+	}
 	if info.RelayMode == relayconstant.RelayModeChatCompletions &&
 		!passThroughGlobal &&
 		!info.ChannelSetting.PassThroughBodyEnabled &&
@@ -98,6 +113,8 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	}
 
 	var requestBody io.Reader
+	var jsonData []byte
+	var output *structuredOutput
 
 	if passThroughGlobal || info.ChannelSetting.PassThroughBodyEnabled {
 		body, err := common.GetRequestBody(c)
@@ -109,6 +126,10 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		}
 		requestBody = bytes.NewBuffer(body)
 	} else {
+		output, err = applyStructuredOutputEmulation(info, request)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
 		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
@@ -157,7 +178,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 			}
 		}
 
-		jsonData, err := common.Marshal(convertedRequest)
+		jsonData, err = common.Marshal(convertedRequest)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
 		}
@@ -181,10 +202,42 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		requestBody = bytes.NewBuffer(jsonData)
 	}
 
+	var usage *dto.Usage
+	if output != nil && !info.IsStream {
+		usage, newAPIError = doStructuredOutputRequest(c, info, adaptor, jsonData, output)
+	} else if semanticCacheQuery != nil {
+		originWriter := c.Writer
+		writer := &responseTeeWriter{ResponseWriter: originWriter}
+		c.Writer = writer
+		usage, newAPIError = doTextRequest(c, info, adaptor, requestBody)
+		c.Writer = originWriter
+		if newAPIError == nil && !info.IsStream {
+			storeSemanticCache(c, semanticCacheQuery, writer.buffer.Bytes())
+		}
+	} else {
+		usage, newAPIError = doTextRequest(c, info, adaptor, requestBody)
+	}
+	if newAPIError != nil {
+		return newAPIError
+	}
+
+	var containAudioTokens = usage.CompletionTokenDetails.AudioTokens > 0 || usage.PromptTokensDetails.AudioTokens > 0
+	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
+
+	if containAudioTokens && containsAudioRatios {
+		service.PostAudioConsumeQuota(c, info, usage, "")
+	} else {
+		postConsumeQuota(c, info, usage)
+	}
+	return nil
+}
+
+func doTextRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, requestBody io.Reader) (*dto.Usage, *types.NewAPIError) {
 	var httpResp *http.Response
+	prepareStreamFailover(c, info)
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
-		return types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
 	}
 
 	statusCodeMappingStr := c.GetString("status_code_mapping")
@@ -196,7 +249,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 			newApiErr := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
 			// reset status code 重置状态码
 			service.ResetStatusCode(newApiErr, statusCodeMappingStr)
-			return newApiErr
+			return nil, newApiErr
 		}
 	}
 
@@ -204,21 +257,22 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	if newApiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
-		return newApiErr
+		return nil, newApiErr
+	}
+	if newApiErr = handleStreamInterruption(c, info, usage); newApiErr != nil {
+		return nil, newApiErr
 	}
 
-	var containAudioTokens = usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0
-	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
-
-	if containAudioTokens && containsAudioRatios {
-		service.PostAudioConsumeQuota(c, info, usage.(*dto.Usage), "")
-	} else {
-		postConsumeQuota(c, info, usage.(*dto.Usage))
+	usageDto, _ := usage.(*dto.Usage)
+	if usageDto == nil {
+		usageDto = &dto.Usage{}
 	}
-	return nil
+	return withInterruptedUsage(c, usageDto), nil
 }
 
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent ...string) {
+	_, span := tracing.Start(ctx.Request.Context(), "billing.post_consume")
+	defer span.End()
 	originUsage := usage
 	if usage == nil {
 		usage = &dto.Usage{
@@ -254,155 +308,171 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	modelPrice := relayInfo.PriceData.ModelPrice
 	cachedCreationRatio := relayInfo.PriceData.CacheCreationRatio
 
-	// Convert values to decimal for precise calculation
-	dPromptTokens := decimal.NewFromInt(int64(promptTokens))
-	dCacheTokens := decimal.NewFromInt(int64(cacheTokens))
-	dImageTokens := decimal.NewFromInt(int64(imageTokens))
-	dAudioTokens := decimal.NewFromInt(int64(audioTokens))
-	dCompletionTokens := decimal.NewFromInt(int64(completionTokens))
-	dCachedCreationTokens := decimal.NewFromInt(int64(cachedCreationTokens))
-	dCompletionRatio := decimal.NewFromFloat(completionRatio)
-	dCacheRatio := decimal.NewFromFloat(cacheRatio)
-	dImageRatio := decimal.NewFromFloat(imageRatio)
-	dModelRatio := decimal.NewFromFloat(modelRatio)
-	dGroupRatio := decimal.NewFromFloat(groupRatio)
-	dModelPrice := decimal.NewFromFloat(modelPrice)
-	dCachedCreationRatio := decimal.NewFromFloat(cachedCreationRatio)
-	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-
-	ratio := dModelRatio.Mul(dGroupRatio)
-
-	// openai web search 工具计费
-	var dWebSearchQuota decimal.Decimal
-	var webSearchPrice float64
-	// response api 格式工具计费
-	if relayInfo.ResponsesUsageInfo != nil {
-		if webSearchTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview]; exists && webSearchTool.CallCount > 0 {
-			// 计算 web search 调用的配额 (配额 = 价格 * 调用次数 / 1000 * 分组倍率)
-			webSearchPrice = operation_setting.GetWebSearchPricePerThousand(modelName, webSearchTool.SearchContextSize)
+	isClaudeUsageSemantic := relayInfo.ChannelType == constant.ChannelTypeAnthropic
+	ratioIsZero := modelRatio == 0 || groupRatio == 0
+	claudeWebSearchCallCount := ctx.GetInt("claude_web_search_requests")
+	var (
+		dWebSearchQuota, dClaudeWebSearchQuota, dFileSearchQuota, dImageGenerationCallQuota, audioInputQuota decimal.Decimal
+		webSearchPrice, claudeWebSearchPrice, fileSearchPrice, imageGenerationCallPrice, audioInputPrice     float64
+	)
+
+	// 只按 token 与倍率计费的请求使用整数运算，其余情况使用 decimal
+	quota, integerQuota := 0, false
+	if isPlainTokenBilling(ctx, relayInfo, usage, claudeWebSearchCallCount) {
+		quota, integerQuota = service.CalcTokenQuota(service.TokenQuotaParams{
+			PromptTokens:         promptTokens,
+			CompletionTokens:     completionTokens,
+			CacheTokens:          cacheTokens,
+			CacheCreationTokens:  cachedCreationTokens,
+			ImageTokens:          imageTokens,
+			PromptIncludesCached: !isClaudeUsageSemantic,
+			ModelRatio:           modelRatio,
+			GroupRatio:           groupRatio,
+			CompletionRatio:      completionRatio,
+			CacheRatio:           cacheRatio,
+			CacheCreationRatio:   cachedCreationRatio,
+			ImageRatio:           imageRatio,
+		})
+	}
+	if !integerQuota {
+		// Convert values to decimal for precise calculation
+		dPromptTokens := decimal.NewFromInt(int64(promptTokens))
+		dCacheTokens := decimal.NewFromInt(int64(cacheTokens))
+		dImageTokens := decimal.NewFromInt(int64(imageTokens))
+		dAudioTokens := decimal.NewFromInt(int64(audioTokens))
+		dCompletionTokens := decimal.NewFromInt(int64(completionTokens))
+		dCachedCreationTokens := decimal.NewFromInt(int64(cachedCreationTokens))
+		dCompletionRatio := decimal.NewFromFloat(completionRatio)
+		dCacheRatio := decimal.NewFromFloat(cacheRatio)
+		dImageRatio := decimal.NewFromFloat(imageRatio)
+		dModelRatio := decimal.NewFromFloat(modelRatio)
+		dGroupRatio := decimal.NewFromFloat(groupRatio)
+		dModelPrice := decimal.NewFromFloat(modelPrice)
+		dCachedCreationRatio := decimal.NewFromFloat(cachedCreationRatio)
+		dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+
+		ratio := dModelRatio.Mul(dGroupRatio)
+
+		// openai web search 工具计费
+		// response api 格式工具计费
+		if relayInfo.ResponsesUsageInfo != nil {
+			if webSearchTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview]; exists && webSearchTool.CallCount > 0 {
+				// 计算 web search 调用的配额 (配额 = 价格 * 调用次数 / 1000 * 分组倍率)
+				webSearchPrice = operation_setting.GetWebSearchPricePerThousand(modelName, webSearchTool.SearchContextSize)
+				dWebSearchQuota = decimal.NewFromFloat(webSearchPrice).
+					Mul(decimal.NewFromInt(int64(webSearchTool.CallCount))).
+					Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit)
+				extraContent = append(extraContent, fmt.Sprintf("Web Search 调用 %d 次，上下文大小 %s，调用花费 %s",
+					webSearchTool.CallCount, webSearchTool.SearchContextSize, dWebSearchQuota.String()))
+			}
+		} else if strings.HasSuffix(modelName, "search-preview") {
+			// search-preview 模型不支持 response api
+			searchContextSize := ctx.GetString("chat_completion_web_search_context_size")
+			if searchContextSize == "" {
+				searchContextSize = "medium"
+			}
+			webSearchPrice = operation_setting.GetWebSearchPricePerThousand(modelName, searchContextSize)
 			dWebSearchQuota = decimal.NewFromFloat(webSearchPrice).
-				Mul(decimal.NewFromInt(int64(webSearchTool.CallCount))).
 				Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit)
-			extraContent = append(extraContent, fmt.Sprintf("Web Search 调用 %d 次，上下文大小 %s，调用花费 %s",
-				webSearchTool.CallCount, webSearchTool.SearchContextSize, dWebSearchQuota.String()))
+			extraContent = append(extraContent, fmt.Sprintf("Web Search 调用 1 次，上下文大小 %s，调用花费 %s",
+				searchContextSize, dWebSearchQuota.String()))
 		}
-	} else if strings.HasSuffix(modelName, "search-preview") {
-		// search-preview 模型不支持 response api
-		searchContextSize := ctx.GetString("chat_completion_web_search_context_size")
-		if searchContextSize == "" {
-			searchContextSize = "medium"
+		// claude web search tool 计费
+		if claudeWebSearchCallCount > 0 {
+			claudeWebSearchPrice = operation_setting.GetClaudeWebSearchPricePerThousand()
+			dClaudeWebSearchQuota = decimal.NewFromFloat(claudeWebSearchPrice).
+				Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit).Mul(decimal.NewFromInt(int64(claudeWebSearchCallCount)))
+			extraContent = append(extraContent, fmt.Sprintf("Claude Web Search 调用 %d 次，调用花费 %s",
+				claudeWebSearchCallCount, dClaudeWebSearchQuota.String()))
 		}
-		webSearchPrice = operation_setting.GetWebSearchPricePerThousand(modelName, searchContextSize)
-		dWebSearchQuota = decimal.NewFromFloat(webSearchPrice).
-			Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit)
-		extraContent = append(extraContent, fmt.Sprintf("Web Search 调用 1 次，上下文大小 %s，调用花费 %s",
-			searchContextSize, dWebSearchQuota.String()))
-	}
-	// claude web search tool 计费
-	var dClaudeWebSearchQuota decimal.Decimal
-	var claudeWebSearchPrice float64
-	claudeWebSearchCallCount := ctx.GetInt("claude_web_search_requests")
-	if claudeWebSearchCallCount > 0 {
-		claudeWebSearchPrice = operation_setting.GetClaudeWebSearchPricePerThousand()
-		dClaudeWebSearchQuota = decimal.NewFromFloat(claudeWebSearchPrice).
-			Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit).Mul(decimal.NewFromInt(int64(claudeWebSearchCallCount)))
-		extraContent = append(extraContent, fmt.Sprintf("Claude Web Search 调用 %d 次，调用花费 %s",
-			claudeWebSearchCallCount, dClaudeWebSearchQuota.String()))
-	}
-	// file search tool 计费
-	var dFileSearchQuota decimal.Decimal
-	var fileSearchPrice float64
-	if relayInfo.ResponsesUsageInfo != nil {
-		if fileSearchTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolFileSearch]; exists && fileSearchTool.CallCount > 0 {
-			fileSearchPrice = operation_setting.GetFileSearchPricePerThousand()
-			dFileSearchQuota = decimal.NewFromFloat(fileSearchPrice).
-				Mul(decimal.NewFromInt(int64(fileSearchTool.CallCount))).
-				Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit)
-			extraContent = append(extraContent, fmt.Sprintf("File Search 调用 %d 次，调用花费 %s",
-				fileSearchTool.CallCount, dFileSearchQuota.String()))
+		// file search tool 计费
+		if relayInfo.ResponsesUsageInfo != nil {
+			if fileSearchTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolFileSearch]; exists && fileSearchTool.CallCount > 0 {
+				fileSearchPrice = operation_setting.GetFileSearchPricePerThousand()
+				dFileSearchQuota = decimal.NewFromFloat(fileSearchPrice).
+					Mul(decimal.NewFromInt(int64(fileSearchTool.CallCount))).
+					Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit)
+				extraContent = append(extraContent, fmt.Sprintf("File Search 调用 %d 次，调用花费 %s",
+					fileSearchTool.CallCount, dFileSearchQuota.String()))
+			}
+		}
+		if ctx.GetBool("image_generation_call") {
+			imageGenerationCallPrice = operation_setting.GetGPTImage1PriceOnceCall(ctx.GetString("image_generation_call_quality"), ctx.GetString("image_generation_call_size"))
+			dImageGenerationCallQuota = decimal.NewFromFloat(imageGenerationCallPrice).Mul(dGroupRatio).Mul(dQuotaPerUnit)
+			extraContent = append(extraContent, fmt.Sprintf("Image Generation Call 花费 %s", dImageGenerationCallQuota.String()))
 		}
-	}
-	var dImageGenerationCallQuota decimal.Decimal
-	var imageGenerationCallPrice float64
-	if ctx.GetBool("image_generation_call") {
-		imageGenerationCallPrice = operation_setting.GetGPTImage1PriceOnceCall(ctx.GetString("image_generation_call_quality"), ctx.GetString("image_generation_call_size"))
-		dImageGenerationCallQuota = decimal.NewFromFloat(imageGenerationCallPrice).Mul(dGroupRatio).Mul(dQuotaPerUnit)
-		extraContent = append(extraContent, fmt.Sprintf("Image Generation Call 花费 %s", dImageGenerationCallQuota.String()))
-	}
-
-	var quotaCalculateDecimal decimal.Decimal
 
-	var audioInputQuota decimal.Decimal
-	var audioInputPrice float64
-	isClaudeUsageSemantic := relayInfo.ChannelType == constant.ChannelTypeAnthropic
-	if !relayInfo.PriceData.UsePrice {
-		baseTokens := dPromptTokens
-		// 减去 cached tokens
-		// Anthropic API 的 input_tokens 已经不包含缓存 tokens，不需要减去
-		// OpenAI/OpenRouter 等 API 的 prompt_tokens 包含缓存 tokens，需要减去
-		var cachedTokensWithRatio decimal.Decimal
-		if !dCacheTokens.IsZero() {
-			if !isClaudeUsageSemantic {
-				baseTokens = baseTokens.Sub(dCacheTokens)
+		var quotaCalculateDecimal decimal.Decimal
+
+		if !relayInfo.PriceData.UsePrice {
+			baseTokens := dPromptTokens
+			// 减去 cached tokens
+			// Anthropic API 的 input_tokens 已经不包含缓存 tokens，不需要减去
+			// OpenAI/OpenRouter 等 API 的 prompt_tokens 包含缓存 tokens，需要减去
+			var cachedTokensWithRatio decimal.Decimal
+			if !dCacheTokens.IsZero() {
+				if !isClaudeUsageSemantic {
+					baseTokens = baseTokens.Sub(dCacheTokens)
+				}
+				cachedTokensWithRatio = dCacheTokens.Mul(dCacheRatio)
 			}
-			cachedTokensWithRatio = dCacheTokens.Mul(dCacheRatio)
-		}
-		var dCachedCreationTokensWithRatio decimal.Decimal
-		if !dCachedCreationTokens.IsZero() {
-			if !isClaudeUsageSemantic {
-				baseTokens = baseTokens.Sub(dCachedCreationTokens)
+			var dCachedCreationTokensWithRatio decimal.Decimal
+			if !dCachedCreationTokens.IsZero() {
+				if !isClaudeUsageSemantic {
+					baseTokens = baseTokens.Sub(dCachedCreationTokens)
+				}
+				dCachedCreationTokensWithRatio = dCachedCreationTokens.Mul(dCachedCreationRatio)
 			}
-			dCachedCreationTokensWithRatio = dCachedCreationTokens.Mul(dCachedCreationRatio)
-		}
 
-		// 减去 image tokens
-		var imageTokensWithRatio decimal.Decimal
-		if !dImageTokens.IsZero() {
-			baseTokens = baseTokens.Sub(dImageTokens)
-			imageTokensWithRatio = dImageTokens.Mul(dImageRatio)
-		}
+			// 减去 image tokens
+			var imageTokensWithRatio decimal.Decimal
+			if !dImageTokens.IsZero() {
+				baseTokens = baseTokens.Sub(dImageTokens)
+				imageTokensWithRatio = dImageTokens.Mul(dImageRatio)
+			}
 
-		// 减去 Gemini audio tokens
-		if !dAudioTokens.IsZero() {
-			audioInputPrice = operation_setting.GetGeminiInputAudioPricePerMillionTokens(modelName)
-			if audioInputPrice > 0 {
-				// 重新计算 base tokens
-				baseTokens = baseTokens.Sub(dAudioTokens)
-				audioInputQuota = decimal.NewFromFloat(audioInputPrice).Div(decimal.NewFromInt(1000000)).Mul(dAudioTokens).Mul(dGroupRatio).Mul(dQuotaPerUnit)
-				extraContent = append(extraContent, fmt.Sprintf("Audio Input 花费 %s", audioInputQuota.String()))
+			// 减去 Gemini audio tokens
+			if !dAudioTokens.IsZero() {
+				audioInputPrice = operation_setting.GetGeminiInputAudioPricePerMillionTokens(modelName)
+				if audioInputPrice > 0 {
+					// 重新计算 base tokens
+					baseTokens = baseTokens.Sub(dAudioTokens)
+					audioInputQuota = decimal.NewFromFloat(audioInputPrice).Div(decimal.NewFromInt(1000000)).Mul(dAudioTokens).Mul(dGroupRatio).Mul(dQuotaPerUnit)
+					extraContent = append(extraContent, fmt.Sprintf("Audio Input 花费 %s", audioInputQuota.String()))
+				}
 			}
-		}
-		promptQuota := baseTokens.Add(cachedTokensWithRatio).
-			Add(imageTokensWithRatio).
-			Add(dCachedCreationTokensWithRatio)
+			promptQuota := baseTokens.Add(cachedTokensWithRatio).
+				Add(imageTokensWithRatio).
+				Add(dCachedCreationTokensWithRatio)
 
-		completionQuota := dCompletionTokens.Mul(dCompletionRatio)
+			completionQuota := dCompletionTokens.Mul(dCompletionRatio)
 
-		quotaCalculateDecimal = promptQuota.Add(completionQuota).Mul(ratio)
+			quotaCalculateDecimal = promptQuota.Add(completionQuota).Mul(ratio)
 
-		if !ratio.IsZero() && quotaCalculateDecimal.LessThanOrEqual(decimal.Zero) {
-			quotaCalculateDecimal = decimal.NewFromInt(1)
+			if !ratio.IsZero() && quotaCalculateDecimal.LessThanOrEqual(decimal.Zero) {
+				quotaCalculateDecimal = decimal.NewFromInt(1)
+			}
+		} else {
+			quotaCalculateDecimal = dModelPrice.Mul(dQuotaPerUnit).Mul(dGroupRatio)
 		}
-	} else {
-		quotaCalculateDecimal = dModelPrice.Mul(dQuotaPerUnit).Mul(dGroupRatio)
-	}
-	// 添加 responses tools call 调用的配额
-	quotaCalculateDecimal = quotaCalculateDecimal.Add(dWebSearchQuota)
-	quotaCalculateDecimal = quotaCalculateDecimal.Add(dFileSearchQuota)
-	// 添加 audio input 独立计费
-	quotaCalculateDecimal = quotaCalculateDecimal.Add(audioInputQuota)
-	// 添加 image generation call 计费
-	quotaCalculateDecimal = quotaCalculateDecimal.Add(dImageGenerationCallQuota)
-
-	if len(relayInfo.PriceData.OtherRatios) > 0 {
-		for key, otherRatio := range relayInfo.PriceData.OtherRatios {
-			dOtherRatio := decimal.NewFromFloat(otherRatio)
-			quotaCalculateDecimal = quotaCalculateDecimal.Mul(dOtherRatio)
-			extraContent = append(extraContent, fmt.Sprintf("其他倍率 %s: %f", key, otherRatio))
+		// 添加 responses tools call 调用的配额
+		quotaCalculateDecimal = quotaCalculateDecimal.Add(dWebSearchQuota)
+		quotaCalculateDecimal = quotaCalculateDecimal.Add(dFileSearchQuota)
+		// 添加 audio input 独立计费
+		quotaCalculateDecimal = quotaCalculateDecimal.Add(audioInputQuota)
+		// 添加 image generation call 计费
+		quotaCalculateDecimal = quotaCalculateDecimal.Add(dImageGenerationCallQuota)
+
+		if len(relayInfo.PriceData.OtherRatios) > 0 {
+			for key, otherRatio := range relayInfo.PriceData.OtherRatios {
+				dOtherRatio := decimal.NewFromFloat(otherRatio)
+				quotaCalculateDecimal = quotaCalculateDecimal.Mul(dOtherRatio)
+				extraContent = append(extraContent, fmt.Sprintf("其他倍率 %s: %f", key, otherRatio))
+			}
 		}
-	}
 
-	quota := int(quotaCalculateDecimal.Round(0).IntPart())
+		quota = int(quotaCalculateDecimal.Round(0).IntPart())
+	}
 	totalTokens := promptTokens + completionTokens
 
 	//var logContent string
@@ -415,10 +485,12 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		extraContent = append(extraContent, "上游没有返回计费信息，无法扣费（可能是上游超时）")
 		logger.LogError(ctx, fmt.Sprintf("total tokens is 0, cannot consume quota, userId %d, channelId %d, "+
 			"tokenId %d, model %s， pre-consumed quota %d", relayInfo.UserId, relayInfo.ChannelId, relayInfo.TokenId, modelName, relayInfo.FinalPreConsumedQuota))
+		service.ReleaseFreeTier(relayInfo)
 	} else {
-		if !ratio.IsZero() && quota == 0 {
+		if !ratioIsZero && quota == 0 {
 			quota = 1
 		}
+		quota = service.ApplyFreeTier(relayInfo, quota, totalTokens)
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
 	}
@@ -446,6 +518,8 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		if err != nil {
 			logger.LogError(ctx, "error consuming token remain quota: "+err.Error())
 		}
+	} else {
+		service.SettleBudgets(relayInfo, quota)
 	}
 
 	logModel := modelName
@@ -524,3 +598,21 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		Other:            other,
 	})
 }
+
+// isPlainTokenBilling 只按 token 与倍率计费，没有按次计价的工具调用、独立计价的音频输入或其他倍率
+func isPlainTokenBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, claudeWebSearchCallCount int) bool {
+	if relayInfo.PriceData.UsePrice || len(relayInfo.PriceData.OtherRatios) > 0 || usage.PromptTokensDetails.AudioTokens != 0 {
+		return false
+	}
+	if claudeWebSearchCallCount > 0 || ctx.GetBool("image_generation_call") || strings.HasSuffix(relayInfo.OriginModelName, "search-preview") {
+		return false
+	}
+	if relayInfo.ResponsesUsageInfo != nil {
+		for _, tool := range relayInfo.ResponsesUsageInfo.BuiltInTools {
+			if tool != nil && tool.CallCount > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -5,13 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -41,20 +44,53 @@ func EmbeddingHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 	}
 	adaptor.Init(info)
 
+	if request.Dimensions > 0 {
+		if ratio, ok := operation_setting.GetEmbeddingDimensionRatio(info.OriginModelName, request.Dimensions); ok {
+			info.PriceData.AddOtherRatio("dimensions", ratio)
+		}
+	}
+
+	var usage *dto.Usage
+	inputs, isArray := request.Input.([]any)
+	batchSize := operation_setting.GetEmbeddingMaxBatchSize(info.UpstreamModelName)
+	if isArray && batchSize > 0 && len(inputs) > batchSize {
+		usage, newAPIError = doSplitEmbeddingRequest(c, info, adaptor, request, inputs, batchSize)
+	} else {
+		usage, newAPIError = doEmbeddingRequest(c, info, adaptor, request)
+	}
+	if newAPIError != nil {
+		if usage != nil && usage.TotalTokens > 0 {
+			// 已成功的子请求产生了上游费用，记录下来由重试成功或最终失败时结算
+			if info.PartialUsage == nil {
+				info.PartialUsage = &dto.Usage{}
+			}
+			addUsage(info.PartialUsage, usage)
+		}
+		return newAPIError
+	}
+	if info.PartialUsage != nil {
+		addUsage(usage, info.PartialUsage)
+		info.PartialUsage = nil
+	}
+	postConsumeQuota(c, info, usage)
+	return nil
+}
+
+func doEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.EmbeddingRequest) (*dto.Usage, *types.NewAPIError) {
 	convertedRequest, err := adaptor.ConvertEmbeddingRequest(c, info, *request)
 	if err != nil {
-		return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 	}
 	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
 	jsonData, err := json.Marshal(convertedRequest)
 	if err != nil {
-		return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 	}
 
 	if len(info.ParamOverride) > 0 {
 		jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride, relaycommon.BuildParamOverrideContext(info))
 		if err != nil {
-			return types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
+			return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
 		}
 	}
 
@@ -63,17 +99,17 @@ func EmbeddingHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 	statusCodeMappingStr := c.GetString("status_code_mapping")
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
-		return types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
 	}
 
 	var httpResp *http.Response
 	if resp != nil {
 		httpResp = resp.(*http.Response)
 		if httpResp.StatusCode != http.StatusOK {
-			newAPIError = service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+			newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
 			// reset status code 重置状态码
 			service.ResetStatusCode(newAPIError, statusCodeMappingStr)
-			return newAPIError
+			return nil, newAPIError
 		}
 	}
 
@@ -81,8 +117,85 @@ func EmbeddingHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
-		return newAPIError
+		return nil, newAPIError
 	}
-	postConsumeQuota(c, info, usage.(*dto.Usage))
-	return nil
+	usageDto, _ := usage.(*dto.Usage)
+	if usageDto == nil {
+		usageDto = &dto.Usage{}
+	}
+	return usageDto, nil
+}
+
+type embeddingBatchItem struct {
+	Object    string          `json:"object"`
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"`
+}
+
+type embeddingBatchResponse struct {
+	Object string               `json:"object"`
+	Data   []embeddingBatchItem `json:"data"`
+	Model  string               `json:"model"`
+}
+
+// doSplitEmbeddingRequest 将超过上游条数限制的输入拆分为多个子请求依次发送，
+// 按原始顺序重新编号合并结果，usage 为各子请求之和；中途失败时同时返回已成功子请求的用量
+func doSplitEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.EmbeddingRequest, inputs []any, batchSize int) (*dto.Usage, *types.NewAPIError) {
+	originWriter := c.Writer
+	defer func() {
+		c.Writer = originWriter
+	}()
+
+	merged := embeddingBatchResponse{
+		Object: "list",
+		Data:   make([]embeddingBatchItem, 0, len(inputs)),
+	}
+	usage := &dto.Usage{}
+	for offset := 0; offset < len(inputs); offset += batchSize {
+		end := min(offset+batchSize, len(inputs))
+		subRequest := *request
+		subRequest.Input = inputs[offset:end]
+
+		writer := &responseBufferWriter{ResponseWriter: originWriter}
+		c.Writer = writer
+		subUsage, newAPIError := doEmbeddingRequest(c, info, adaptor, &subRequest)
+		if newAPIError != nil {
+			return usage, newAPIError
+		}
+
+		var subResponse embeddingBatchResponse
+		if err := common.Unmarshal(writer.buffer.Bytes(), &subResponse); err != nil {
+			addUsage(usage, subUsage)
+			return usage, types.NewOpenAIError(fmt.Errorf("failed to parse embedding sub-batch response: %w", err), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		if len(subResponse.Data) != end-offset {
+			addUsage(usage, subUsage)
+			return usage, types.NewOpenAIError(fmt.Errorf("embedding sub-batch returned %d items, expected %d", len(subResponse.Data), end-offset), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		// 部分上游不保证按输入顺序返回，先按子请求内的 index 排序
+		sort.SliceStable(subResponse.Data, func(i, j int) bool {
+			return subResponse.Data[i].Index < subResponse.Data[j].Index
+		})
+		for _, item := range subResponse.Data {
+			item.Index += offset
+			merged.Data = append(merged.Data, item)
+		}
+		if merged.Model == "" {
+			merged.Model = subResponse.Model
+		}
+		addUsage(usage, subUsage)
+	}
+
+	c.Writer = originWriter
+	c.Writer.Header().Del("Content-Length")
+	c.JSON(http.StatusOK, gin.H{
+		"object": merged.Object,
+		"data":   merged.Data,
+		"model":  merged.Model,
+		"usage": gin.H{
+			"prompt_tokens": usage.PromptTokens,
+			"total_tokens":  usage.TotalTokens,
+		},
+	})
+	return usage, nil
 }
@@ -2,8 +2,11 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -46,7 +49,16 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 }
 
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) (types.PriceData, error) {
-	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
+	pricing := ratio_setting.GetModelPricing(info.OriginModelName)
+	modelPrice, usePrice := pricing.ModelPrice, pricing.UsePrice
+
+	// 图片分档、rerank 按文档数等依赖请求参数的定价优先于模型固定价格
+	requestPriced := false
+	if price, ok := getRequestBasedPrice(info); ok {
+		modelPrice = price
+		usePrice = true
+		requestPriced = true
+	}
 
 	groupRatioInfo := HandleGroupRatio(c, info)
 
@@ -61,15 +73,17 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var audioRatio float64
 	var audioCompletionRatio float64
 	var freeModel bool
+	var baseModelRatio float64
+	baseModelPrice := modelPrice
+	pricingRule, hasPricingRule := ratio_setting.MatchPricingRule(info.OriginModelName, common.GetContextKeyInt(c, constant.ContextKeyChannelId), time.Now())
 	if !usePrice {
 		preConsumedTokens := common.Max(promptTokens, common.PreConsumedQuota)
 		if meta.MaxTokens != 0 {
 			preConsumedTokens += meta.MaxTokens
 		}
-		var success bool
-		var matchName string
-		modelRatio, success, matchName = ratio_setting.GetModelRatio(info.OriginModelName)
-		if !success {
+		modelRatio = pricing.ModelRatio
+		matchName := pricing.MatchName
+		if !pricing.RatioAvailable() {
 			acceptUnsetRatio := false
 			if info.UserSetting.AcceptUnsetRatioModel {
 				acceptUnsetRatio = true
@@ -78,21 +92,29 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 				return types.PriceData{}, fmt.Errorf("模型 %s 倍率或价格未配置，请联系管理员设置或开始自用模式；Model %s ratio or price not set, please set or start self-use mode", matchName, matchName)
 			}
 		}
-		completionRatio = ratio_setting.GetCompletionRatio(info.OriginModelName)
-		cacheRatio, _ = ratio_setting.GetCacheRatio(info.OriginModelName)
-		cacheCreationRatio, _ = ratio_setting.GetCreateCacheRatio(info.OriginModelName)
+		completionRatio = pricing.CompletionRatio
+		cacheRatio = pricing.CacheRatio
+		cacheCreationRatio = pricing.CreateCacheRatio
 		cacheCreationRatio5m = cacheCreationRatio
 		// 固定1h和5min缓存写入价格的比例
 		cacheCreationRatio1h = cacheCreationRatio * claudeCacheCreation1hMultiplier
-		imageRatio, _ = ratio_setting.GetImageRatio(info.OriginModelName)
-		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
-		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
+		imageRatio = pricing.ImageRatio
+		audioRatio = pricing.AudioRatio
+		audioCompletionRatio = pricing.AudioCompletionRatio
+		baseModelRatio = modelRatio
+		if hasPricingRule {
+			modelRatio *= pricingRule.Ratio
+		}
 		ratio := modelRatio * groupRatioInfo.GroupRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
-		if meta.ImagePriceRatio != 0 {
+		if meta.ImagePriceRatio != 0 && !requestPriced {
 			modelPrice = modelPrice * meta.ImagePriceRatio
 		}
+		baseModelPrice = modelPrice
+		if hasPricingRule {
+			modelPrice *= pricingRule.Ratio
+		}
 		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	}
 
@@ -130,6 +152,12 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheCreation5mRatio: cacheCreationRatio5m,
 		CacheCreation1hRatio: cacheCreationRatio1h,
 		QuotaToPreConsume:    preConsumedQuota,
+		BaseModelRatio:       baseModelRatio,
+		BaseModelPrice:       baseModelPrice,
+	}
+	if hasPricingRule {
+		priceData.PricingRule = pricingRule.Name
+		priceData.PricingRatio = pricingRule.Ratio
 	}
 
 	if common.DebugEnabled {
@@ -139,6 +167,45 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	return priceData, nil
 }
 
+// ApplyPricingRule 重试切换渠道后按实际服务的渠道重新匹配差异化定价规则
+func ApplyPricingRule(info *relaycommon.RelayInfo, channelId int) {
+	priceData := &info.PriceData
+	rule, ok := ratio_setting.MatchPricingRule(info.OriginModelName, channelId, time.Now())
+	if rule.Name == priceData.PricingRule && rule.Ratio == priceData.PricingRatio {
+		return
+	}
+	priceData.ModelRatio = priceData.BaseModelRatio
+	priceData.ModelPrice = priceData.BaseModelPrice
+	priceData.PricingRule = ""
+	priceData.PricingRatio = 0
+	if ok {
+		if priceData.UsePrice {
+			priceData.ModelPrice *= rule.Ratio
+		} else {
+			priceData.ModelRatio *= rule.Ratio
+		}
+		priceData.PricingRule = rule.Name
+		priceData.PricingRatio = rule.Ratio
+	}
+}
+
+// getRequestBasedPrice 根据请求参数计算本次请求的总价（美元）
+func getRequestBasedPrice(info *relaycommon.RelayInfo) (float64, bool) {
+	switch request := info.Request.(type) {
+	case *dto.ImageRequest:
+		// 按 尺寸/品质 单价 × 数量
+		if tierPrice, ok := ratio_setting.GetImageTierPrice(info.OriginModelName, request.Size, request.Quality); ok {
+			return tierPrice * float64(max(request.N, 1)), true
+		}
+	case *dto.RerankRequest:
+		// 按 每千文档单价 × 文档数
+		if documentPrice, ok := ratio_setting.GetRerankDocumentPrice(info.OriginModelName); ok {
+			return documentPrice * float64(len(request.Documents)) / 1000, true
+		}
+	}
+	return 0, false
+}
+
 // ModelPriceHelperPerCall 按次计费的 PriceHelper (MJ、Task)
 func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.PerCallPriceData {
 	groupRatioInfo := HandleGroupRatio(c, info)
@@ -153,12 +220,17 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 			modelPrice = defaultPrice
 		}
 	}
-	quota := int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	priceData := types.PerCallPriceData{
-		ModelPrice:     modelPrice,
-		Quota:          quota,
 		GroupRatioInfo: groupRatioInfo,
+		BaseModelPrice: modelPrice,
+	}
+	if rule, ok := ratio_setting.MatchPricingRule(info.OriginModelName, common.GetContextKeyInt(c, constant.ContextKeyChannelId), time.Now()); ok {
+		modelPrice *= rule.Ratio
+		priceData.PricingRule = rule.Name
+		priceData.PricingRatio = rule.Ratio
 	}
+	priceData.ModelPrice = modelPrice
+	priceData.Quota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	return priceData
 }
 
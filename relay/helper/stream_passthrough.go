@@ -0,0 +1,138 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	sseDataPrefix  = []byte("data:")
+	sseDoneMarker  = []byte("[DONE]")
+	sseEventSuffix = []byte("\n\n")
+)
+
+// StreamPassthroughHandler 将上游的 data 行原样写给客户端并逐条刷新，不做格式转换。
+// 读取与写出在同一协程中进行，客户端读取变慢时随之暂停读取上游；客户端断开或上游空闲超时时立即关闭上游响应体，取消上游请求。
+// dataHandler 在每条数据写出后调用，data 在下次读取后失效，需要保留时应自行复制。
+// 收到 [DONE] 时停止读取且不转发，由调用方写出结束标记
+func StreamPassthroughHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, dataHandler func(data []byte)) {
+	if resp == nil || resp.Body == nil || dataHandler == nil {
+		return
+	}
+
+	var closeOnce sync.Once
+	closeBody := func() {
+		closeOnce.Do(func() {
+			_ = resp.Body.Close()
+		})
+	}
+	defer closeBody()
+	stopOnDisconnect := context.AfterFunc(c.Request.Context(), closeBody)
+	defer stopOnDisconnect()
+
+	streamingTimeout := time.Duration(constant.StreamingTimeout) * time.Second
+	if idleTimeout := info.TimeoutPolicy().StreamIdleTimeout; idleTimeout > 0 {
+		streamingTimeout = time.Duration(idleTimeout) * time.Second
+	}
+	var timedOut atomic.Bool
+	idleTimer := time.AfterFunc(streamingTimeout, func() {
+		timedOut.Store(true)
+		closeBody()
+	})
+	defer idleTimer.Stop()
+
+	var writeMutex sync.Mutex
+	done := make(chan struct{})
+	defer close(done)
+	generalSettings := operation_setting.GetGeneralSetting()
+	if generalSettings.PingIntervalEnabled && !info.DisablePing {
+		pingInterval := time.Duration(generalSettings.PingIntervalSeconds) * time.Second
+		if pingInterval <= 0 {
+			pingInterval = DefaultPingInterval
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(pingInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					writeMutex.Lock()
+					err := PingData(c)
+					writeMutex.Unlock()
+					if err != nil {
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		})
+	}
+
+	SetEventStreamHeaders(c)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, InitialScannerBufferSize), getScannerBufferSize())
+	scanner.Split(bufio.ScanLines)
+
+	for scanner.Scan() {
+		idleTimer.Reset(streamingTimeout)
+		line := bytes.TrimSuffix(scanner.Bytes(), []byte{'\r'})
+		if bytes.HasPrefix(line, sseDoneMarker) {
+			break
+		}
+		if !bytes.HasPrefix(line, sseDataPrefix) {
+			continue
+		}
+		data := bytes.TrimLeft(line[len(sseDataPrefix):], " ")
+		if bytes.HasPrefix(data, sseDoneMarker) {
+			break
+		}
+		if len(data) == 0 {
+			continue
+		}
+		info.SetFirstResponseTime()
+		info.ReceivedResponseCount++
+
+		writeMutex.Lock()
+		_, err := c.Writer.Write(line)
+		if err == nil {
+			_, err = c.Writer.Write(sseEventSuffix)
+		}
+		if err == nil {
+			err = FlushWriter(c)
+		}
+		writeMutex.Unlock()
+		if err != nil {
+			logger.LogInfo(c, "client disconnected")
+			return
+		}
+		info.SendResponseCount++
+		dataHandler(data)
+	}
+
+	switch {
+	case timedOut.Load():
+		logger.LogError(c, "streaming timeout")
+		info.StreamInterrupted = true
+	case c.Request.Context().Err() != nil:
+		logger.LogInfo(c, "client disconnected")
+	case scanner.Err() != nil:
+		logger.LogError(c, "scanner error: "+scanner.Err().Error())
+		info.StreamInterrupted = true
+	default:
+		logger.LogInfo(c, "streaming finished")
+	}
+}
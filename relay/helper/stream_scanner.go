@@ -48,6 +48,9 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	}()
 
 	streamingTimeout := time.Duration(constant.StreamingTimeout) * time.Second
+	if idleTimeout := info.TimeoutPolicy().StreamIdleTimeout; idleTimeout > 0 {
+		streamingTimeout = time.Duration(idleTimeout) * time.Second
+	}
 
 	var (
 		stopChan   = make(chan bool, 3) // 增加缓冲区避免阻塞
@@ -253,6 +256,9 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		if err := scanner.Err(); err != nil {
 			if err != io.EOF {
 				logger.LogError(c, "scanner error: "+err.Error())
+				if c.Request.Context().Err() == nil {
+					info.StreamInterrupted = true
+				}
 			}
 		}
 	})
@@ -262,6 +268,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	case <-ticker.C:
 		// 超时处理逻辑
 		logger.LogError(c, "streaming timeout")
+		info.StreamInterrupted = true
 	case <-stopChan:
 		// 正常结束
 		logger.LogInfo(c, "streaming finished")
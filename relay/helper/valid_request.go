@@ -11,6 +11,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -71,10 +72,35 @@ func GetAndValidAudioRequest(c *gin.Context, relayMode int) (*dto.AudioRequest,
 		if audioRequest.ResponseFormat == "" {
 			audioRequest.ResponseFormat = "json"
 		}
+		if err := validAudioFileSize(c); err != nil {
+			return nil, err
+		}
 	}
 	return audioRequest, nil
 }
 
+// validAudioFileSize 校验转写/翻译请求上传的音频文件大小
+func validAudioFileSize(c *gin.Context) error {
+	maxSizeMB := operation_setting.GetAudioSetting().MaxFileSizeMB
+	if maxSizeMB <= 0 {
+		return nil
+	}
+	form, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		return fmt.Errorf("error parsing multipart form: %w", err)
+	}
+	fileHeaders := form.File["file"]
+	if len(fileHeaders) == 0 {
+		return errors.New("file is required")
+	}
+	for _, fileHeader := range fileHeaders {
+		if fileHeader.Size > int64(maxSizeMB)<<20 {
+			return fmt.Errorf("%w: audio file %s exceeds the maximum size of %d MB", common.ErrRequestBodyTooLarge, fileHeader.Filename, maxSizeMB)
+		}
+	}
+	return nil
+}
+
 func GetAndValidateRerankRequest(c *gin.Context) (*dto.RerankRequest, error) {
 	var rerankRequest *dto.RerankRequest
 	err := common.UnmarshalBodyReusable(c, &rerankRequest)
@@ -103,6 +129,9 @@ func GetAndValidateEmbeddingRequest(c *gin.Context, relayMode int) (*dto.Embeddi
 	if embeddingRequest.Input == nil {
 		return nil, fmt.Errorf("input is empty")
 	}
+	if embeddingRequest.Dimensions < 0 {
+		return nil, fmt.Errorf("dimensions must be a positive integer")
+	}
 	if relayMode == relayconstant.RelayModeModerations && embeddingRequest.Model == "" {
 		embeddingRequest.Model = "omni-moderation-latest"
 	}
@@ -142,6 +171,21 @@ func GetAndValidOpenAIImageRequest(c *gin.Context, relayMode int) (*dto.ImageReq
 	imageRequest := &dto.ImageRequest{}
 
 	switch relayMode {
+	case relayconstant.RelayModeImagesVariations:
+		if !strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+			return nil, errors.New("image variation request must be multipart/form-data")
+		}
+		if _, err := c.MultipartForm(); err != nil {
+			return nil, fmt.Errorf("failed to parse image variation form request: %w", err)
+		}
+		formData := c.Request.PostForm
+		imageRequest.Model = common.GetStringIfEmpty(formData.Get("model"), "dall-e-2")
+		imageRequest.N = uint(common.String2Int(formData.Get("n")))
+		imageRequest.Size = common.GetStringIfEmpty(formData.Get("size"), "1024x1024")
+		imageRequest.ResponseFormat = formData.Get("response_format")
+		if imageRequest.N == 0 {
+			imageRequest.N = 1
+		}
 	case relayconstant.RelayModeImagesEdits:
 		if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
 			_, err := c.MultipartForm()
@@ -60,7 +60,7 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 		relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
 
 		switch convertedRequest.(type) {
-		case *bytes.Buffer:
+		case io.Reader:
 			requestBody = convertedRequest.(io.Reader)
 		default:
 			jsonData, err := common.Marshal(convertedRequest)
@@ -121,8 +121,9 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 	}
 
 	quality := "standard"
-	if request.Quality == "hd" {
-		quality = "hd"
+	if request.Quality != "" {
+		// gpt-image 系列的 low/medium/high 等品质参与分档计费，按原值记录
+		quality = request.Quality
 	}
 
 	var logContent []string
@@ -112,7 +112,8 @@ func RelayMidjourneyNotify(c *gin.Context) *dto.MidjourneyResponse {
 	midjourneyTask.VideoUrls = string(videoUrlsStr)
 	midjourneyTask.Status = midjRequest.Status
 	midjourneyTask.FailReason = midjRequest.FailReason
-	err = midjourneyTask.Update()
+	// 与轮询任务并发更新时，只有先写入结束状态的一方退还失败任务的额度
+	err = service.SaveMidjourneyTask(c, midjourneyTask)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -196,12 +197,19 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		}
 	}
 
-	if userQuota-priceData.Quota < 0 {
+	if userQuota+info.UserCreditLimit-priceData.Quota < 0 {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
 		}
 	}
+	if apiErr := service.CheckBudgets(info, priceData.Quota); apiErr != nil {
+		return &dto.MidjourneyResponse{
+			Code:        4,
+			Description: string(apiErr.GetErrorCode()),
+		}
+	}
+	defer service.ReleaseBudgets(info)
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	baseURL := c.GetString("base_url")
 	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
@@ -209,8 +217,9 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 	if err != nil {
 		return &mjResp.Response
 	}
+	taskSaved := true
 	defer func() {
-		if mjResp.StatusCode == 200 && mjResp.Response.Code == 1 {
+		if taskSaved && mjResp.StatusCode == 200 && mjResp.Response.Code == 1 {
 			err := service.PostConsumeQuota(info, priceData.Quota, 0, true)
 			if err != nil {
 				common.SysLog("error consuming token remain quota: " + err.Error())
@@ -255,6 +264,9 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 	}
 	err = midjourneyTask.Insert()
 	if err != nil {
+		// 未保存的任务无法轮询状态与退还额度，不再扣费
+		common.SysError(fmt.Sprintf("insert midjourney task %s failed: %s", midjourneyTask.MjId, err.Error()))
+		taskSaved = false
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "insert_midjourney_task_failed")
 	}
 	c.Writer.WriteHeader(mjResp.StatusCode)
@@ -497,12 +509,21 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		}
 	}
 
-	if consumeQuota && userQuota-priceData.Quota < 0 {
+	if consumeQuota && userQuota+relayInfo.UserCreditLimit-priceData.Quota < 0 {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
 		}
 	}
+	if consumeQuota {
+		if apiErr := service.CheckBudgets(relayInfo, priceData.Quota); apiErr != nil {
+			return &dto.MidjourneyResponse{
+				Code:        4,
+				Description: string(apiErr.GetErrorCode()),
+			}
+		}
+		defer service.ReleaseBudgets(relayInfo)
+	}
 
 	midjResponseWithStatus, responseBody, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
 	if err != nil {
@@ -567,7 +588,16 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			common.SysLog("get_channel_null: " + err.Error())
 		}
 		if channel.GetAutoBan() && common.AutomaticDisableChannelEnabled {
-			model.UpdateChannelStatus(midjourneyTask.ChannelId, "", 2, "No available account instance")
+			if model.UpdateChannelStatus(midjourneyTask.ChannelId, "", 2, "No available account instance") {
+				service.RecordChannelStatusChange(&model.ChannelStatusHistory{
+					ChannelId:   midjourneyTask.ChannelId,
+					FromStatus:  channel.Status,
+					ToStatus:    2,
+					KeyIndex:    -1,
+					TriggerType: model.ChannelStatusTriggerAutoDisable,
+					Reason:      "No available account instance",
+				})
+			}
 		}
 	}
 	if midjResponse.Code != 1 && midjResponse.Code != 21 && midjResponse.Code != 22 {
@@ -605,6 +635,9 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 	}
 	err = midjourneyTask.Insert()
 	if err != nil {
+		// 未保存的任务无法轮询状态与退还额度，不再扣费
+		common.SysError(fmt.Sprintf("insert midjourney task %s failed: %s", midjourneyTask.MjId, err.Error()))
+		consumeQuota = false
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "insert_midjourney_task_failed",
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -158,6 +159,11 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		}
 	}
 
+	pricingRule, hasPricingRule := ratio_setting.MatchPricingRule(modelName, info.ChannelId, time.Now())
+	if hasPricingRule {
+		modelPrice *= pricingRule.Ratio
+	}
+
 	// 预扣
 	groupRatio := ratio_setting.GetGroupRatio(info.UsingGroup)
 	var ratio float64
@@ -184,10 +190,16 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		return
 	}
 	quota := int(ratio * common.QuotaPerUnit)
-	if userQuota-quota < 0 {
+	if userQuota+info.UserCreditLimit-quota < 0 {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
+	if apiErr := service.CheckBudgets(info, quota); apiErr != nil {
+		taskErr = service.TaskErrorWrapperLocal(apiErr.Err, string(apiErr.GetErrorCode()), http.StatusForbidden)
+		return
+	}
+	// 提交失败时退回预算预占，成功时已在结算中替换为实际消费
+	defer service.ReleaseBudgets(info)
 
 	// build body
 	requestBody, err := adaptor.BuildRequestBody(c, info)
@@ -248,6 +260,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 				if hasUserGroupRatio {
 					other["user_group_ratio"] = userGroupRatio
 				}
+				if hasPricingRule {
+					other["pricing_rule"] = pricingRule.Name
+					other["pricing_ratio"] = pricingRule.Ratio
+				}
 				model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
 					ChannelId: info.ChannelId,
 					ModelName: modelName,
@@ -413,18 +429,11 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 		ti, err2 := adaptor.ParseTaskResult(body)
 		if err2 == nil && ti != nil {
 			if ti.Status != "" {
-				originTask.Status = model.TaskStatus(ti.Status)
-			}
-			if ti.Progress != "" {
-				originTask.Progress = ti.Progress
-			}
-			if ti.Url != "" {
-				if strings.HasPrefix(ti.Url, "data:") {
-				} else {
-					originTask.FailReason = ti.Url
+				// 与轮询共用状态更新，任务在此结束时同样退款或结算
+				if err2 = service.ApplyTaskResult(c, originTask, ti); err2 != nil {
+					common.SysLog("update task error: " + err2.Error())
 				}
 			}
-			_ = originTask.Update()
 			var raw map[string]any
 			_ = json.Unmarshal(body, &raw)
 			format := "mp4"
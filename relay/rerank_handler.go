@@ -96,6 +96,6 @@ func RerankHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
 		return newAPIError
 	}
-	postConsumeQuota(c, info, usage.(*dto.Usage))
+	postConsumeQuota(c, info, usage.(*dto.Usage), fmt.Sprintf("文档数 %d", len(request.Documents)))
 	return nil
 }
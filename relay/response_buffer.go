@@ -0,0 +1,30 @@
+package relay
+
+import (
+	"bytes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseBufferWriter 缓存适配器写出的响应，由调用方处理（合并、校验等）后统一写回客户端
+type responseBufferWriter struct {
+	gin.ResponseWriter
+	buffer     bytes.Buffer
+	statusCode int
+}
+
+func (w *responseBufferWriter) WriteHeader(code int) {
+	w.statusCode = code
+}
+
+func (w *responseBufferWriter) WriteHeaderNow() {}
+
+func (w *responseBufferWriter) Flush() {}
+
+func (w *responseBufferWriter) Write(data []byte) (int, error) {
+	return w.buffer.Write(data)
+}
+
+func (w *responseBufferWriter) WriteString(s string) (int, error) {
+	return w.buffer.WriteString(s)
+}
@@ -2,6 +2,7 @@ package relay
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,11 +11,13 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	appconstant "github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -65,13 +68,28 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	// 记录展开前的本轮输入，用于网关侧保存
+	previousResponseId := request.PreviousResponseID
+	currentInput := request.Input
+	passThrough := model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled
+	if info.RelayMode == relayconstant.RelayModeResponses && !passThrough {
+		replayTokens, err := service.ResolvePreviousResponse(info.UserId, request)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		// 展开的历史上下文计入预估输入，上游未返回用量时同样计费；重试时先扣除上次计入的部分
+		previousReplayTokens := common.GetContextKeyInt(c, appconstant.ContextKeyResponsesReplayTokens)
+		info.SetEstimatePromptTokens(info.GetEstimatePromptTokens() - previousReplayTokens + replayTokens)
+		common.SetContextKey(c, appconstant.ContextKeyResponsesReplayTokens, replayTokens)
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
 	}
 	adaptor.Init(info)
 	var requestBody io.Reader
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+	if passThrough {
 		body, err := common.GetRequestBody(c)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
@@ -80,6 +98,16 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 	} else {
 		convertedRequest, err := adaptor.ConvertOpenAIResponsesRequest(c, info, *request)
 		if err != nil {
+			// 仅在上游不支持 Responses API 时转换为 chat/completions，其他转换错误直接返回
+			if errors.Is(err, channel.ErrNotImplemented) && info.RelayMode == relayconstant.RelayModeResponses && operation_setting.GetResponsesSetting().ChatFallbackEnabled {
+				usageDto, newAPIError := responsesViaChatCompletions(c, info, adaptor, request)
+				if newAPIError != nil {
+					return newAPIError
+				}
+				postConsumeQuota(c, info, usageDto)
+				service.StoreResponse(c, info.UserId, previousResponseId, currentInput, responsesReq.Store)
+				return nil
+			}
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 		}
 		relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
@@ -157,5 +185,6 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 	} else {
 		postConsumeQuota(c, info, usageDto)
 	}
+	service.StoreResponse(c, info.UserId, previousResponseId, currentInput, responsesReq.Store)
 	return nil
 }
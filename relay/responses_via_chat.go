@@ -0,0 +1,242 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/openaicompat"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responsesChatWriter 拦截适配器写出的 chat/completions 响应并转换为 Responses 格式，
+// 使任意支持 chat 的适配器都可以服务 /v1/responses
+type responsesChatWriter struct {
+	gin.ResponseWriter
+	stream     bool
+	converter  *openaicompat.ChatToResponsesStreamConverter
+	buffer     bytes.Buffer
+	statusCode int
+	started    bool
+}
+
+func newResponsesChatWriter(writer gin.ResponseWriter, stream bool, model string) *responsesChatWriter {
+	return &responsesChatWriter{
+		ResponseWriter: writer,
+		stream:         stream,
+		converter:      openaicompat.NewChatToResponsesStreamConverter("resp_"+common.GetUUID(), model, common.GetTimestamp()),
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (w *responsesChatWriter) WriteHeader(code int) {
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.statusCode = code
+}
+
+func (w *responsesChatWriter) WriteHeaderNow() {
+	if w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Flush 非流式时响应尚未转换，不能提前发送响应头
+func (w *responsesChatWriter) Flush() {
+	if w.stream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *responsesChatWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.stream {
+		if err := w.drainEvents(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *responsesChatWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responsesChatWriter) writeEvents(events []openaicompat.ResponsesStreamEvent) error {
+	for _, event := range events {
+		if _, err := w.ResponseWriter.WriteString("event: " + event.Type + "\ndata: " + string(event.Data) + "\n\n"); err != nil {
+			return err
+		}
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// drainEvents 处理缓冲区中完整的 SSE 事件块，未完整的部分留待下次写入
+func (w *responsesChatWriter) drainEvents() error {
+	for {
+		data := w.buffer.Bytes()
+		end := bytes.Index(data, []byte("\n\n"))
+		if end < 0 {
+			return nil
+		}
+		block := string(data[:end])
+		w.buffer.Next(end + 2)
+
+		for _, line := range strings.Split(block, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, ":") {
+				// 保活注释原样转发
+				if _, err := w.ResponseWriter.WriteString(line + "\n\n"); err != nil {
+					return err
+				}
+				continue
+			}
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if payload == "" || payload == "[DONE]" {
+				continue
+			}
+			chunk := &dto.ChatCompletionsStreamResponse{}
+			if err := common.UnmarshalJsonStr(payload, chunk); err != nil {
+				continue
+			}
+			events := make([]openaicompat.ResponsesStreamEvent, 0)
+			if !w.started {
+				w.started = true
+				events = append(events, w.converter.Start()...)
+			}
+			events = append(events, w.converter.HandleChunk(chunk)...)
+			if err := w.writeEvents(events); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// finish 写出收尾事件（流式）或完整转换后的响应（非流式），并记录最终响应对象
+func (w *responsesChatWriter) finish(c *gin.Context, usage *dto.Usage) error {
+	if w.stream {
+		if err := w.drainEvents(); err != nil {
+			return err
+		}
+		events := make([]openaicompat.ResponsesStreamEvent, 0)
+		if !w.started {
+			w.started = true
+			events = append(events, w.converter.Start()...)
+		}
+		events = append(events, w.converter.Finish(usage)...)
+		common.SetContextKey(c, constant.ContextKeyResponsesFinalResponse, w.converter.FinalResponse())
+		return w.writeEvents(events)
+	}
+
+	chatResponse := &dto.OpenAITextResponse{}
+	if err := common.Unmarshal(w.buffer.Bytes(), chatResponse); err != nil {
+		return fmt.Errorf("failed to parse chat completions response: %w", err)
+	}
+	response := openaicompat.ChatCompletionsResponseToResponsesResponse(chatResponse, w.converter.ResponseId, w.converter.CreatedAt, usage)
+	response["model"] = w.converter.Model
+	data, err := common.Marshal(response)
+	if err != nil {
+		return err
+	}
+	common.SetContextKey(c, constant.ContextKeyResponsesFinalResponse, data)
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, err = w.ResponseWriter.Write(data)
+	return err
+}
+
+// responsesViaChatCompletions 将 /v1/responses 请求转换为 chat/completions 发往不支持 Responses API 的上游
+func responsesViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.OpenAIResponsesRequest) (*dto.Usage, *types.NewAPIError) {
+	chatReq, err := openaicompat.ResponsesRequestToChatCompletionsRequest(request)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	info.AppendRequestConversion(types.RelayFormatOpenAI)
+
+	savedRelayMode := info.RelayMode
+	savedRequestURLPath := info.RequestURLPath
+	savedRelayFormat := info.RelayFormat
+	defer func() {
+		info.RelayMode = savedRelayMode
+		info.RequestURLPath = savedRequestURLPath
+		info.RelayFormat = savedRelayFormat
+	}()
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RequestURLPath = "/v1/chat/completions"
+	info.RelayFormat = types.RelayFormatOpenAI
+
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, chatReq)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride, relaycommon.BuildParamOverrideContext(info))
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
+		}
+	}
+
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		info.IsStream = info.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+		if httpResp.StatusCode != http.StatusOK {
+			newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+			service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+			return nil, newAPIError
+		}
+	}
+
+	originWriter := c.Writer
+	writer := newResponsesChatWriter(originWriter, info.IsStream, info.OriginModelName)
+	c.Writer = writer
+	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	c.Writer = originWriter
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return nil, newAPIError
+	}
+	usageDto, _ := usage.(*dto.Usage)
+	if usageDto == nil {
+		usageDto = &dto.Usage{}
+	}
+	if info.IsStream {
+		helper.SetEventStreamHeaders(c)
+	}
+	if err := writer.finish(c, usageDto); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	return usageDto, nil
+}
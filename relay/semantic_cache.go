@@ -0,0 +1,153 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const semanticCacheHeader = "X-Semantic-Cache"
+
+// responseTeeWriter 在正常写出响应的同时保留一份副本，用于写入语义缓存
+type responseTeeWriter struct {
+	gin.ResponseWriter
+	buffer bytes.Buffer
+}
+
+func (w *responseTeeWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseTeeWriter) WriteString(s string) (int, error) {
+	w.buffer.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// semanticCachePrompt 归一化消息文本，包含非文本内容（图片、音频等）时返回 false
+func semanticCachePrompt(request *dto.GeneralOpenAIRequest) (string, bool) {
+	var builder strings.Builder
+	for _, message := range request.Messages {
+		builder.WriteString(message.Role)
+		builder.WriteString(": ")
+		if message.IsStringContent() {
+			builder.WriteString(strings.Join(strings.Fields(message.StringContent()), " "))
+		} else {
+			for _, content := range message.ParseContent() {
+				if content.Type != dto.ContentTypeText {
+					return "", false
+				}
+				builder.WriteString(strings.Join(strings.Fields(content.Text), " "))
+			}
+		}
+		if len(message.ToolCalls) > 0 {
+			builder.Write(message.ToolCalls)
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String(), builder.Len() > 0
+}
+
+// semanticCachePartitionSeed 除消息以外的请求参数必须完全一致才能复用缓存
+func semanticCachePartitionSeed(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (string, error) {
+	params := *request
+	params.Messages = nil
+	params.Stream = false
+	params.StreamOptions = nil
+	params.User = ""
+	data, err := common.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	seed := info.OriginModelName + "|" + string(data)
+	if !operation_setting.GetSemanticCacheSetting().ShareAcrossUsers {
+		seed = strconv.Itoa(info.UserId) + "|" + seed
+	}
+	return seed, nil
+}
+
+// prepareSemanticCache 仅对启用的非流式 chat completions 请求生效；查询失败时视为未命中
+func prepareSemanticCache(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) *service.SemanticCacheQuery {
+	if info.RelayMode != relayconstant.RelayModeChatCompletions || request.Stream {
+		return nil
+	}
+	if !operation_setting.IsSemanticCacheEnabledFor(info.OriginModelName, info.UsingGroup) {
+		return nil
+	}
+	prompt, ok := semanticCachePrompt(request)
+	if !ok {
+		return nil
+	}
+	seed, err := semanticCachePartitionSeed(info, request)
+	if err != nil {
+		return nil
+	}
+	query, err := service.PrepareSemanticCacheQuery(c.Request.Context(), seed, prompt)
+	if err != nil {
+		logger.LogWarn(c, "semantic cache embedding failed: "+err.Error())
+		return nil
+	}
+	return query
+}
+
+// serveSemanticCacheHit 命中时直接返回缓存响应，返还预扣费并记录一条 0 额度的消费日志
+func serveSemanticCacheHit(c *gin.Context, info *relaycommon.RelayInfo, query *service.SemanticCacheQuery) bool {
+	response, similarity, ok := service.LookupSemanticCache(c.Request.Context(), query)
+	if !ok {
+		return false
+	}
+	c.Header(semanticCacheHeader, "hit")
+	c.Header(semanticCacheHeader+"-Similarity", strconv.FormatFloat(similarity, 'f', 4, 64))
+	c.Data(http.StatusOK, "application/json", response)
+
+	service.ReturnPreConsumedQuota(c, info)
+	var cached dto.OpenAITextResponse
+	_ = common.Unmarshal(response, &cached)
+	model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
+		ChannelId:        info.ChannelId,
+		PromptTokens:     cached.Usage.PromptTokens,
+		CompletionTokens: cached.Usage.CompletionTokens,
+		ModelName:        info.OriginModelName,
+		TokenName:        c.GetString("token_name"),
+		Quota:            0,
+		Content:          fmt.Sprintf("语义缓存命中，相似度 %.4f", similarity),
+		TokenId:          info.TokenId,
+		UseTimeSeconds:   int(time.Now().Unix() - info.StartTime.Unix()),
+		IsStream:         false,
+		Group:            info.UsingGroup,
+		Other: map[string]any{
+			"semantic_cache_hit":        true,
+			"semantic_cache_similarity": similarity,
+		},
+	})
+	return true
+}
+
+// storeSemanticCache 异步保存成功的响应
+func storeSemanticCache(c *gin.Context, query *service.SemanticCacheQuery, body []byte) {
+	var response dto.OpenAITextResponse
+	if err := common.Unmarshal(body, &response); err != nil || len(response.Choices) == 0 {
+		return
+	}
+	data := bytes.Clone(body)
+	ctx := c.Request.Context()
+	gopool.Go(func() {
+		service.StoreSemanticCache(context.WithoutCancel(ctx), query, data)
+	})
+}
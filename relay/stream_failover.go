@@ -0,0 +1,347 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamFailoverWriter 记录已发送给客户端的流式内容。上游中断后暂存收尾数据，
+// 换渠道重试时跳过客户端已收到的部分，只输出新增内容
+type streamFailoverWriter struct {
+	gin.ResponseWriter
+	info *relaycommon.RelayInfo
+
+	pending   []byte
+	held      bytes.Buffer
+	releasing bool
+
+	id        string
+	events    int
+	content   strings.Builder
+	reasoning strings.Builder
+	resumable bool
+	// 已中断的尝试消耗的用量，最终结算时一并计费
+	interruptedUsage dto.Usage
+
+	interrupted      bool
+	replaying        bool
+	contentMatched   int
+	reasoningMatched int
+	aborted          bool
+}
+
+func (w *streamFailoverWriter) Write(data []byte) (int, error) {
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.info.StreamInterrupted && !w.releasing {
+		w.held.Write(data)
+		return len(data), nil
+	}
+	if w.aborted {
+		return len(data), nil
+	}
+	w.pending = append(w.pending, data...)
+	for {
+		i := bytes.Index(w.pending, []byte("\n\n"))
+		if i < 0 {
+			break
+		}
+		event := string(w.pending[:i+2])
+		w.pending = w.pending[i+2:]
+		if err := w.writeEvent(event); err != nil {
+			return len(data), err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *streamFailoverWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *streamFailoverWriter) writeEvent(event string) error {
+	payload, isData := strings.CutPrefix(strings.TrimSpace(event), "data:")
+	payload = strings.TrimSpace(payload)
+	if !isData || !strings.HasPrefix(payload, "{") {
+		_, err := w.ResponseWriter.WriteString(event)
+		return err
+	}
+	var chunk dto.ChatCompletionsStreamResponse
+	if err := common.UnmarshalJsonStr(payload, &chunk); err != nil {
+		_, err := w.ResponseWriter.WriteString(event)
+		return err
+	}
+	if w.replaying {
+		keep, ok := w.replayChunk(&chunk)
+		if !ok {
+			return w.abort()
+		}
+		if !keep {
+			return nil
+		}
+		data, err := common.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		event = "data: " + string(data) + "\n\n"
+	}
+	w.record(&chunk)
+	_, err := w.ResponseWriter.WriteString(event)
+	return err
+}
+
+func (w *streamFailoverWriter) record(chunk *dto.ChatCompletionsStreamResponse) {
+	if w.id == "" {
+		w.id = chunk.Id
+	}
+	w.events++
+	if len(chunk.Choices) > 1 {
+		w.resumable = false
+	}
+	for _, choice := range chunk.Choices {
+		if len(choice.Delta.ToolCalls) > 0 {
+			w.resumable = false
+		}
+		w.content.WriteString(choice.Delta.GetContentString())
+		w.reasoning.WriteString(choice.Delta.GetReasoningContent())
+	}
+}
+
+// consumeReplay 从新响应的增量中去掉客户端已收到的部分，不一致时返回 false。
+// 要求新响应逐字节以已输出内容开头，只有 temperature 为 0 的请求才会进入重放
+func consumeReplay(delta string, emitted string, matched *int) (string, bool) {
+	remaining := emitted[*matched:]
+	if remaining == "" {
+		return delta, true
+	}
+	if strings.HasPrefix(remaining, delta) {
+		*matched += len(delta)
+		return "", true
+	}
+	if strings.HasPrefix(delta, remaining) {
+		*matched = len(emitted)
+		return delta[len(remaining):], true
+	}
+	return "", false
+}
+
+func (w *streamFailoverWriter) replayChunk(chunk *dto.ChatCompletionsStreamResponse) (keep bool, ok bool) {
+	if w.id != "" {
+		chunk.Id = w.id
+	}
+	if len(chunk.Choices) == 0 {
+		return true, true
+	}
+	if len(chunk.Choices) > 1 || len(chunk.Choices[0].Delta.ToolCalls) > 0 {
+		return false, false
+	}
+	delta := &chunk.Choices[0].Delta
+	content, ok := consumeReplay(delta.GetContentString(), w.content.String(), &w.contentMatched)
+	if !ok {
+		return false, false
+	}
+	reasoning, ok := consumeReplay(delta.GetReasoningContent(), w.reasoning.String(), &w.reasoningMatched)
+	if !ok {
+		return false, false
+	}
+	// 客户端已收到角色信息
+	delta.Role = ""
+	if delta.Content != nil {
+		delta.Content = &content
+	}
+	if delta.ReasoningContent != nil {
+		delta.ReasoningContent = &reasoning
+	} else if delta.Reasoning != nil {
+		delta.Reasoning = &reasoning
+	}
+	if content != "" || reasoning != "" {
+		w.replaying = false
+	}
+	return content != "" || reasoning != "" || chunk.Choices[0].FinishReason != nil || chunk.Usage != nil, true
+}
+
+func (w *streamFailoverWriter) abort() error {
+	w.aborted = true
+	return w.writeError("upstream stream was interrupted and the retried response does not match the content already sent")
+}
+
+func (w *streamFailoverWriter) writeError(message string) error {
+	data, err := common.Marshal(gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "new_api_error",
+			"code":    types.ErrorCodeBadResponse,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := w.ResponseWriter.WriteString("data: " + string(data) + "\n\ndata: [DONE]\n\n"); err != nil {
+		return err
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// release 确认不再切换渠道，把暂存的收尾数据正常写出
+func (w *streamFailoverWriter) release() {
+	w.releasing = true
+	data := w.held.Bytes()
+	w.held.Reset()
+	_, _ = w.Write(data)
+	w.ResponseWriter.Flush()
+}
+
+func (w *streamFailoverWriter) beginReplay() {
+	w.interrupted = false
+	w.releasing = false
+	w.held.Reset()
+	w.pending = nil
+	w.replaying = w.events > 0
+	w.contentMatched = 0
+	w.reasoningMatched = 0
+}
+
+// prepareStreamFailover 为流式 chat completions 请求安装记录器；切换渠道后进入重放
+func prepareStreamFailover(c *gin.Context, info *relaycommon.RelayInfo) {
+	info.StreamInterrupted = false
+	if !info.IsStream || info.RelayFormat != types.RelayFormatOpenAI || info.RelayMode != relayconstant.RelayModeChatCompletions {
+		return
+	}
+	if writer, ok := c.Writer.(*streamFailoverWriter); ok {
+		if writer.interrupted {
+			writer.beginReplay()
+		}
+		return
+	}
+	if !operation_setting.GetStreamFailoverSetting().Enabled {
+		return
+	}
+	c.Writer = &streamFailoverWriter{ResponseWriter: c.Writer, info: info, resumable: isDeterministicRequest(info)}
+}
+
+// isDeterministicRequest 只有 temperature 为 0 时换渠道后的输出才可能与已输出内容一致
+func isDeterministicRequest(info *relaycommon.RelayInfo) bool {
+	request, ok := info.Request.(*dto.GeneralOpenAIRequest)
+	return ok && request.Temperature != nil && *request.Temperature == 0
+}
+
+// handleStreamInterruption 上游中断时判断能否换渠道：未输出内容时直接重试，已输出内容时需开启续传且内容可续传
+func handleStreamInterruption(c *gin.Context, info *relaycommon.RelayInfo, usage any) *types.NewAPIError {
+	writer, ok := c.Writer.(*streamFailoverWriter)
+	if !ok || !info.StreamInterrupted {
+		return nil
+	}
+	if writer.aborted || (writer.events > 0 && !(operation_setting.GetStreamFailoverSetting().ResumeEnabled && writer.resumable)) {
+		writer.release()
+		return nil
+	}
+	writer.interrupted = true
+	if usage, ok := usage.(*dto.Usage); ok && usage != nil {
+		addUsage(&writer.interruptedUsage, usage)
+	}
+	failovers := common.GetContextKeyInt(c, constant.ContextKeyStreamFailovers) + 1
+	common.SetContextKey(c, constant.ContextKeyStreamFailovers, failovers)
+	logger.LogWarn(c, fmt.Sprintf("stream interrupted on channel #%d after %d chunks (%d chars sent), failover #%d", info.ChannelId, writer.events, writer.content.Len()+writer.reasoning.Len(), failovers))
+	return types.NewOpenAIError(errors.New("upstream stream interrupted"), types.ErrorCodeBadResponse, http.StatusBadGateway)
+}
+
+func addUsage(total *dto.Usage, usage *dto.Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+	total.PromptTokensDetails.CachedTokens += usage.PromptTokensDetails.CachedTokens
+	total.PromptTokensDetails.CachedCreationTokens += usage.PromptTokensDetails.CachedCreationTokens
+}
+
+// withInterruptedUsage 把此前中断尝试的用量计入最终成功的响应
+func withInterruptedUsage(c *gin.Context, usage *dto.Usage) *dto.Usage {
+	writer, ok := c.Writer.(*streamFailoverWriter)
+	if !ok || writer.interruptedUsage.TotalTokens == 0 && writer.interruptedUsage.PromptTokens == 0 {
+		return usage
+	}
+	total := writer.interruptedUsage
+	addUsage(&total, usage)
+	return &total
+}
+
+// SettleInterruptedStream 换渠道最终失败时按中断尝试或已完成部分的用量结算，返回 false 表示没有需要计费的用量
+func SettleInterruptedStream(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	if info.PartialUsage != nil {
+		usage := *info.PartialUsage
+		info.PartialUsage = nil
+		postConsumeQuota(c, info, &usage, "请求未全部完成，按已完成部分的用量计费")
+		return true
+	}
+	writer, ok := c.Writer.(*streamFailoverWriter)
+	if !ok || writer.interruptedUsage.TotalTokens == 0 && writer.interruptedUsage.PromptTokens == 0 {
+		return false
+	}
+	usage := writer.interruptedUsage
+	postConsumeQuota(c, info, &usage, "流式响应中断，按已消耗用量计费")
+	return true
+}
+
+// FinishInterruptedStream 换渠道最终失败且客户端已收到部分内容时，以 SSE 错误事件结束响应
+func FinishInterruptedStream(c *gin.Context, apiErr *types.NewAPIError) bool {
+	writer, ok := c.Writer.(*streamFailoverWriter)
+	if !ok {
+		return false
+	}
+	if writer.events == 0 {
+		// 尚未输出内容，恢复原始 writer 按普通错误返回
+		c.Writer = writer.ResponseWriter
+		return false
+	}
+	if !writer.aborted {
+		writer.aborted = true
+		_ = writer.writeError(apiErr.Error())
+	}
+	return true
+}
+
+// FinishCommittedResponse 保活已写出 200 响应头后才失败时状态码无法再修改，流式响应以携带上游状态码的
+// SSE 错误事件结束，非流式响应在已写出的空白之后写出同样携带状态码的错误 JSON
+func FinishCommittedResponse(c *gin.Context, relayFormat types.RelayFormat, apiErr *types.NewAPIError) bool {
+	// 实时会话升级为 WebSocket 后同样视为已写出，错误仍通过 WebSocket 返回
+	if relayFormat == types.RelayFormatOpenAIRealtime || !c.Writer.Written() {
+		return false
+	}
+	var payload gin.H
+	if relayFormat == types.RelayFormatClaude {
+		payload = gin.H{"type": "error", "error": apiErr.ToClaudeError(), "status_code": apiErr.StatusCode}
+	} else {
+		payload = gin.H{"error": apiErr.ToOpenAIError(), "status_code": apiErr.StatusCode}
+	}
+	data, err := common.Marshal(payload)
+	if err != nil {
+		return false
+	}
+	if !strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+		_, _ = c.Writer.Write(data)
+		return true
+	}
+	message := "data: " + string(data) + "\n\ndata: [DONE]\n\n"
+	if relayFormat == types.RelayFormatClaude {
+		message = "event: error\ndata: " + string(data) + "\n\n"
+	}
+	if _, err := c.Writer.WriteString(message); err == nil {
+		c.Writer.Flush()
+	}
+	return true
+}
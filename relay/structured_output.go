@@ -0,0 +1,238 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// structuredOutput 需要模拟的结构化输出要求，Schema 为空表示只要求合法 JSON（json_object）
+type structuredOutput struct {
+	Schema map[string]any
+}
+
+// applyStructuredOutputEmulation 渠道不支持 response_format 时，改为在系统提示词中注入 JSON 输出要求，
+// 并移除 response_format 避免上游报错。流式响应无法在转发前校验，strict 模式的流式请求直接拒绝
+func applyStructuredOutputEmulation(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*structuredOutput, error) {
+	if !info.ChannelSetting.StructuredOutputEmulation || request.ResponseFormat == nil {
+		return nil, nil
+	}
+	if request.ResponseFormat.Type != "json_schema" && request.ResponseFormat.Type != "json_object" {
+		return nil, nil
+	}
+
+	output := &structuredOutput{}
+	instruction := "You must respond with a single valid JSON value only, without markdown code fences or any other text."
+	if request.ResponseFormat.Type == "json_schema" && len(request.ResponseFormat.JsonSchema) > 0 {
+		var jsonSchema dto.FormatJsonSchema
+		if err := common.Unmarshal(request.ResponseFormat.JsonSchema, &jsonSchema); err == nil {
+			if request.Stream && string(bytes.TrimSpace(jsonSchema.Strict)) == "true" {
+				return nil, errors.New("strict json_schema with stream=true is not supported on this channel, the output cannot be validated before it is streamed")
+			}
+			if schema, ok := jsonSchema.Schema.(map[string]any); ok {
+				output.Schema = schema
+				schemaText, _ := common.Marshal(schema)
+				instruction = fmt.Sprintf("You must respond with a single JSON value that conforms to the following JSON schema, without markdown code fences or any other text.\nJSON schema:\n%s", string(schemaText))
+			}
+		}
+	}
+	request.ResponseFormat = nil
+
+	systemRole := request.GetSystemRoleName()
+	for i, message := range request.Messages {
+		if message.Role != systemRole {
+			continue
+		}
+		if message.IsStringContent() {
+			request.Messages[i].SetStringContent(message.StringContent() + "\n\n" + instruction)
+		} else {
+			contents := append(message.ParseContent(), dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: instruction,
+			})
+			request.Messages[i].SetMediaContent(contents)
+		}
+		return output, nil
+	}
+	request.Messages = append([]dto.Message{{Role: systemRole, Content: instruction}}, request.Messages...)
+	return output, nil
+}
+
+// doStructuredOutputRequest 发送非流式请求并校验输出，不符合要求时自动重试一次；
+// 两次请求的用量均计入账单
+func doStructuredOutputRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, jsonData []byte, output *structuredOutput) (*dto.Usage, *types.NewAPIError) {
+	originWriter := c.Writer
+	defer func() {
+		c.Writer = originWriter
+	}()
+
+	totalUsage := &dto.Usage{}
+	var writer *responseBufferWriter
+	for attempt := 0; attempt < 2; attempt++ {
+		writer = &responseBufferWriter{ResponseWriter: originWriter, statusCode: http.StatusOK}
+		c.Writer = writer
+		usage, newAPIError := doTextRequest(c, info, adaptor, bytes.NewBuffer(jsonData))
+		if newAPIError != nil {
+			return nil, newAPIError
+		}
+		totalUsage.PromptTokens += usage.PromptTokens
+		totalUsage.CompletionTokens += usage.CompletionTokens
+		totalUsage.TotalTokens += usage.TotalTokens
+		totalUsage.PromptTokensDetails.CachedTokens += usage.PromptTokensDetails.CachedTokens
+
+		// 上游仍以流式返回时无法校验，原样转发
+		if info.IsStream {
+			break
+		}
+		err := output.validateResponse(writer.buffer.Bytes())
+		if err == nil {
+			break
+		}
+		logger.LogWarn(c, fmt.Sprintf("structured output validation failed (attempt %d): %s", attempt+1, err.Error()))
+	}
+
+	c.Writer = originWriter
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.WriteHeader(writer.statusCode)
+	if _, err := c.Writer.Write(writer.buffer.Bytes()); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	return totalUsage, nil
+}
+
+func (o *structuredOutput) validateResponse(body []byte) error {
+	var response dto.OpenAITextResponse
+	if err := common.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("invalid chat completions response: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return errors.New("response has no choices")
+	}
+	content := strings.TrimSpace(response.Choices[0].Message.StringContent())
+	// 部分模型仍会包裹 markdown 代码块
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+
+	var value any
+	if err := common.UnmarshalJsonStr(strings.TrimSpace(content), &value); err != nil {
+		return fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	if o.Schema == nil {
+		return nil
+	}
+	return validateJSONSchema(value, o.Schema, "$")
+}
+
+// validateJSONSchema 校验常用的 JSON Schema 关键字：type、enum、properties、required、
+// additionalProperties、items，未识别的关键字忽略
+func validateJSONSchema(value any, schema map[string]any, path string) error {
+	if enum, ok := schema["enum"].([]any); ok {
+		matched := false
+		for _, candidate := range enum {
+			if fmt.Sprint(candidate) == fmt.Sprint(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value is not one of the allowed enum values", path)
+		}
+	}
+
+	if schemaType, ok := schema["type"]; ok {
+		var types []string
+		switch t := schemaType.(type) {
+		case string:
+			types = []string{t}
+		case []any:
+			for _, item := range t {
+				if s, ok := item.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		matched := len(types) == 0
+		for _, t := range types {
+			if jsonValueIsType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected type %s", path, strings.Join(types, "|"))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, item := range required {
+				name, _ := item.(string)
+				if _, exists := v[name]; name != "" && !exists {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+		for key, fieldValue := range v {
+			fieldSchema, ok := properties[key].(map[string]any)
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s: unexpected property %q", path, key)
+				}
+				continue
+			}
+			if err := validateJSONSchema(fieldValue, fieldSchema, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if itemSchema, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateJSONSchema(item, itemSchema, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func jsonValueIsType(value any, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	}
+	return true
+}
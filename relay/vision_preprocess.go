@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// preprocessVisionInputs 按图片预处理配置缩放 image_url 并按需转为 base64，在请求转换之前执行
+func preprocessVisionInputs(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) error {
+	visionSetting := operation_setting.GetVisionSetting()
+	if !visionSetting.Enabled {
+		return nil
+	}
+	maxLongEdge := operation_setting.GetVisionMaxLongEdge(info.UpstreamModelName)
+	jpegQuality := operation_setting.GetVisionJpegQuality()
+
+	for i, message := range request.Messages {
+		if message.IsStringContent() {
+			continue
+		}
+		contents := message.ParseContent()
+		changed := false
+		for j, content := range contents {
+			if content.Type != dto.ContentTypeImageURL {
+				continue
+			}
+			imageUrl := content.GetImageMedia()
+			if imageUrl == nil || imageUrl.Url == "" {
+				continue
+			}
+			processed, err := service.PreprocessImage(c, imageUrl.Url, maxLongEdge, jpegQuality, visionSetting.ConvertUrlToBase64)
+			if err != nil {
+				return fmt.Errorf("failed to preprocess image in message %d: %w", i, err)
+			}
+			if processed != imageUrl.Url {
+				imageUrl.Url = processed
+				contents[j].ImageUrl = imageUrl
+				changed = true
+			}
+		}
+		if changed {
+			request.Messages[i].SetMediaContent(contents)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/middleware"
 
@@ -22,7 +23,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(common.PermissionSystemRead), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/user-agreement", controller.GetUserAgreement)
 		apiRouter.GET("/privacy-policy", controller.GetPrivacyPolicy)
@@ -57,6 +58,9 @@ func SetApiRouter(router *gin.Engine) {
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
 			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.Verify2FALogin)
+			userRoute.POST("/login/2fa/recovery", middleware.CriticalRateLimit(), controller.Send2FARecoveryEmail)
+			userRoute.POST("/login/2fa/recovery/verify", middleware.CriticalRateLimit(), controller.Verify2FARecovery)
+			userRoute.POST("/ldap/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.LdapLogin)
 			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), controller.PasskeyLoginBegin)
 			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), controller.PasskeyLoginFinish)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
@@ -108,12 +112,13 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.DELETE("/oauth/bindings/:provider_id", controller.UnbindCustomOAuth)
 			}
 
+			userRoute.GET("/topup", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetAllTopUps)
+			userRoute.POST("/topup/complete", middleware.PermissionAuth(common.PermissionBillingManage), controller.AdminCompleteTopUp)
+
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			adminRoute.Use(middleware.PermissionAuth(common.PermissionUsersManage))
 			{
 				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/topup", controller.GetAllTopUps)
-				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
 				adminRoute.POST("/", controller.CreateUser)
@@ -125,6 +130,7 @@ func SetApiRouter(router *gin.Engine) {
 				// Admin 2FA routes
 				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
 				adminRoute.DELETE("/:id/2fa", controller.AdminDisable2FA)
+				adminRoute.PUT("/:id/admin_role", middleware.RootAuth(), controller.SetUserAdminRole)
 			}
 		}
 
@@ -140,7 +146,7 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestCreemPay)
 		}
 		subscriptionAdminRoute := apiRouter.Group("/subscription/admin")
-		subscriptionAdminRoute.Use(middleware.AdminAuth())
+		subscriptionAdminRoute.Use(middleware.PermissionAuth(common.PermissionBillingManage))
 		{
 			subscriptionAdminRoute.GET("/plans", controller.AdminListSubscriptionPlans)
 			subscriptionAdminRoute.POST("/plans", controller.AdminCreateSubscriptionPlan)
@@ -165,12 +171,37 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.GET("/effective", controller.GetEffectiveOptions)
+			optionRoute.GET("/cache_stats", controller.GetCacheStats)
 			optionRoute.GET("/channel_affinity_cache", controller.GetChannelAffinityCacheStats)
 			optionRoute.DELETE("/channel_affinity_cache", controller.ClearChannelAffinityCache)
+			optionRoute.GET("/semantic_cache", controller.GetSemanticCacheStats)
+			optionRoute.DELETE("/semantic_cache", controller.ClearSemanticCache)
+			optionRoute.GET("/relay_queue", controller.GetRelayQueueStats)
+			optionRoute.GET("/model_rewrite", controller.GetModelRewriteRules)
+			optionRoute.PUT("/model_rewrite", controller.UpdateModelRewriteRules)
+			optionRoute.POST("/model_rewrite/dry_run", controller.DryRunModelRewrite)
+			optionRoute.GET("/model_router", controller.GetModelRouterSetting)
+			optionRoute.PUT("/model_router", controller.UpdateModelRouterSetting)
+			optionRoute.POST("/model_router/dry_run", controller.DryRunModelRouter)
+			optionRoute.POST("/currency/fetch_rates", controller.FetchExchangeRates)
+			optionRoute.GET("/usage_event", controller.GetUsageEventInfo)
+			optionRoute.POST("/usage_event/test", controller.TestUsageEventPublish)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
 
+		// 自定义管理员角色，仅超级管理员可维护
+		adminRoleRoute := apiRouter.Group("/admin_role")
+		adminRoleRoute.Use(middleware.RootAuth())
+		{
+			adminRoleRoute.GET("/permissions", controller.GetAllPermissions)
+			adminRoleRoute.GET("/", controller.GetAdminRoles)
+			adminRoleRoute.POST("/", controller.CreateAdminRole)
+			adminRoleRoute.PUT("/", controller.UpdateAdminRole)
+			adminRoleRoute.DELETE("/:id", controller.DeleteAdminRole)
+		}
+
 		// Custom OAuth provider management (admin only)
 		customOAuthRoute := apiRouter.Group("/custom-oauth-provider")
 		customOAuthRoute.Use(middleware.RootAuth())
@@ -195,44 +226,57 @@ func SetApiRouter(router *gin.Engine) {
 			ratioSyncRoute.GET("/channels", controller.GetSyncableChannels)
 			ratioSyncRoute.POST("/fetch", controller.FetchUpstreamRatios)
 		}
+		channelsWriteAuth := middleware.PermissionAuth(common.PermissionChannelsWrite)
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
+		channelRoute.Use(middleware.PermissionAuth(common.PermissionChannelsRead))
 		{
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/export", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.OptionalSecureVerification(), controller.ExportChannels)
+			channelRoute.POST("/import", middleware.RootAuth(), controller.ImportChannels)
 			channelRoute.GET("/:id", controller.GetChannel)
+			channelRoute.GET("/:id/history", controller.GetChannelStatusHistory)
+			channelRoute.GET("/:id/capabilities", controller.GetChannelCapabilities)
+			channelRoute.PUT("/:id/capabilities", channelsWriteAuth, controller.SaveChannelCapability)
+			channelRoute.DELETE("/:id/capabilities/:capability_id", channelsWriteAuth, controller.DeleteChannelCapability)
+			channelRoute.POST("/:id/reconcile", controller.ReconcileChannelCost)
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
+			channelRoute.GET("/test", channelsWriteAuth, controller.TestAllChannels)
+			channelRoute.GET("/test/:id", channelsWriteAuth, controller.TestChannel)
+			channelRoute.POST("/proxy/test", channelsWriteAuth, controller.TestChannelProxy)
+			channelRoute.GET("/update_balance", channelsWriteAuth, controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", channelsWriteAuth, controller.UpdateChannelBalance)
+			channelRoute.POST("/", channelsWriteAuth, controller.AddChannel)
+			channelRoute.PUT("/", channelsWriteAuth, controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", channelsWriteAuth, controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", channelsWriteAuth, controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", channelsWriteAuth, controller.EnableTagChannels)
+			channelRoute.PUT("/tag", channelsWriteAuth, controller.EditTagChannels)
+			channelRoute.POST("/tag/test", channelsWriteAuth, controller.TestTagChannels)
+			channelRoute.POST("/tag/priority", channelsWriteAuth, controller.SetTagChannelsPriority)
+			channelRoute.DELETE("/:id", channelsWriteAuth, controller.DeleteChannel)
+			channelRoute.POST("/batch", channelsWriteAuth, controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", channelsWriteAuth, controller.FixChannelsAbilities)
 			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/codex/oauth/start", controller.StartCodexOAuth)
-			channelRoute.POST("/codex/oauth/complete", controller.CompleteCodexOAuth)
-			channelRoute.POST("/:id/codex/oauth/start", controller.StartCodexOAuthForChannel)
-			channelRoute.POST("/:id/codex/oauth/complete", controller.CompleteCodexOAuthForChannel)
-			channelRoute.POST("/:id/codex/refresh", controller.RefreshCodexChannelCredential)
+			channelRoute.POST("/fetch_models", channelsWriteAuth, controller.FetchModels)
+			channelRoute.POST("/sync_models", channelsWriteAuth, controller.SyncAllChannelUpstreamModels)
+			channelRoute.POST("/:id/sync_models", channelsWriteAuth, controller.SyncChannelUpstreamModels)
+			channelRoute.POST("/codex/oauth/start", channelsWriteAuth, controller.StartCodexOAuth)
+			channelRoute.POST("/codex/oauth/complete", channelsWriteAuth, controller.CompleteCodexOAuth)
+			channelRoute.POST("/:id/codex/oauth/start", channelsWriteAuth, controller.StartCodexOAuthForChannel)
+			channelRoute.POST("/:id/codex/oauth/complete", channelsWriteAuth, controller.CompleteCodexOAuthForChannel)
+			channelRoute.POST("/:id/codex/refresh", channelsWriteAuth, controller.RefreshCodexChannelCredential)
 			channelRoute.GET("/:id/codex/usage", controller.GetCodexChannelUsage)
-			channelRoute.POST("/ollama/pull", controller.OllamaPullModel)
-			channelRoute.POST("/ollama/pull/stream", controller.OllamaPullModelStream)
-			channelRoute.DELETE("/ollama/delete", controller.OllamaDeleteModel)
+			channelRoute.POST("/ollama/pull", channelsWriteAuth, controller.OllamaPullModel)
+			channelRoute.POST("/ollama/pull/stream", channelsWriteAuth, controller.OllamaPullModelStream)
+			channelRoute.DELETE("/ollama/delete", channelsWriteAuth, controller.OllamaDeleteModel)
 			channelRoute.GET("/ollama/version/:id", controller.OllamaVersion)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
+			channelRoute.POST("/batch/tag", channelsWriteAuth, controller.BatchSetChannelTag)
 			channelRoute.GET("/tag/models", controller.GetTagModels)
-			channelRoute.POST("/copy/:id", controller.CopyChannel)
-			channelRoute.POST("/multi_key/manage", controller.ManageMultiKeys)
+			channelRoute.POST("/copy/:id", channelsWriteAuth, controller.CopyChannel)
+			channelRoute.POST("/multi_key/manage", channelsWriteAuth, controller.ManageMultiKeys)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -243,6 +287,7 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
+			tokenRoute.POST("/:id/rotate", controller.RotateToken)
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
 		}
 
@@ -257,7 +302,7 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
+		redemptionRoute.Use(middleware.PermissionAuth(common.PermissionBillingManage))
 		{
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
@@ -267,98 +312,247 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		referralRoute := apiRouter.Group("/referral")
+		{
+			referralRoute.GET("/self", middleware.UserAuth(), controller.GetSelfReferral)
+			referralRoute.GET("/self/invitees", middleware.UserAuth(), controller.GetSelfReferralInvitees)
+			referralRoute.GET("/self/commissions", middleware.UserAuth(), controller.GetSelfReferralCommissions)
+			referralRoute.GET("/", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetReferrals)
+			referralRoute.GET("/commissions", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetReferralCommissions)
+			referralRoute.GET("/rates", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetReferralRates)
+			referralRoute.PUT("/rate", middleware.PermissionAuth(common.PermissionBillingManage), controller.SetReferralRate)
+			referralRoute.DELETE("/rate/:user_id", middleware.PermissionAuth(common.PermissionBillingManage), controller.DeleteReferralRate)
+		}
+		couponRoute := apiRouter.Group("/coupon")
+		couponRoute.Use(middleware.PermissionAuth(common.PermissionBillingManage))
+		{
+			couponRoute.GET("/", controller.GetCoupons)
+			couponRoute.GET("/report", controller.GetCouponReports)
+			couponRoute.GET("/usage", controller.GetCouponUsages)
+			couponRoute.GET("/:id", controller.GetCoupon)
+			couponRoute.POST("/", controller.AddCoupons)
+			couponRoute.PUT("/", controller.UpdateCoupon)
+			couponRoute.DELETE("/:id", controller.DeleteCoupon)
+		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(common.PermissionLogsWrite), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/channel_affinity_usage_cache", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetChannelAffinityUsageCacheStats)
+		logRoute.GET("/search", middleware.PermissionAuth(common.PermissionLogsRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.POST("/self/export", middleware.UserAuth(), controller.CreateSelfLogExport)
+		logRoute.GET("/self/export", middleware.UserAuth(), controller.GetSelfLogExports)
+		logRoute.GET("/self/export/:id", middleware.UserAuth(), controller.GetSelfLogExport)
+		logRoute.GET("/export/download/:id", controller.DownloadLogExport)
+		logRoute.GET("/archive", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetLogArchives)
+		logRoute.GET("/archive/search", middleware.PermissionAuth(common.PermissionLogsRead), controller.SearchArchivedLogs)
+		logRoute.POST("/archive/run", middleware.PermissionAuth(common.PermissionLogsWrite), controller.RunLogArchive)
+		logRoute.GET("/archive/:id/download", middleware.PermissionAuth(common.PermissionLogsRead), controller.DownloadLogArchive)
+		logRoute.POST("/archive/:id/restore", middleware.PermissionAuth(common.PermissionLogsWrite), controller.RestoreLogArchive)
+
+		impersonateRoute := apiRouter.Group("/impersonate")
+		impersonateRoute.Use(middleware.PermissionAuth(common.PermissionChannelsWrite))
+		{
+			impersonateRoute.POST("/chat", controller.ImpersonateChat)
+		}
+
+		bodyCaptureRoute := apiRouter.Group("/body_capture")
+		bodyCaptureRoute.Use(middleware.RootAuth())
+		{
+			bodyCaptureRoute.GET("/", controller.GetBodyCaptures)
+			bodyCaptureRoute.GET("/:id", controller.GetBodyCapture)
+			bodyCaptureRoute.DELETE("/:id", controller.DeleteBodyCapture)
+		}
+
+		apiRouter.GET("/pii/stats", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetPIIRedactionStats)
+
+		auditLogRoute := apiRouter.Group("/audit_log")
+		auditLogRoute.Use(middleware.PermissionAuth(common.PermissionAuditRead))
+		{
+			auditLogRoute.GET("/", controller.GetAuditLogs)
+		}
+
+		analyticsRoute := apiRouter.Group("/analytics")
+		analyticsRoute.GET("/usage", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetUsageAnalytics)
+		analyticsRoute.GET("/self/usage", middleware.UserAuth(), controller.GetSelfUsageAnalytics)
+		apiRouter.GET("/dashboard/overview", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetDashboardOverview)
+
+		billingRoute := apiRouter.Group("/billing")
+		{
+			billingRoute.GET("/statement/self", middleware.UserAuth(), controller.GetSelfBillingStatement)
+			billingRoute.GET("/statement/self/export", middleware.UserAuth(), controller.ExportSelfBillingStatement)
+			billingRoute.GET("/statement", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetUserBillingStatement)
+			billingRoute.GET("/statement/export", middleware.PermissionAuth(common.PermissionBillingManage), controller.ExportUserBillingStatement)
+			billingRoute.GET("/periods", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetBillingPeriods)
+			billingRoute.POST("/periods/finalize", middleware.RootAuth(), controller.FinalizeBillingPeriod)
+			billingRoute.GET("/invoice/self", middleware.UserAuth(), controller.GetSelfPostpaidInvoices)
+			billingRoute.GET("/invoice", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetPostpaidInvoices)
+			billingRoute.POST("/invoice/:id/settle", middleware.PermissionAuth(common.PermissionBillingManage), controller.SettlePostpaidInvoice)
+		}
+
+		quotaTransferRoute := apiRouter.Group("/quota_transfer")
+		{
+			quotaTransferRoute.GET("/self", middleware.UserAuth(), controller.GetSelfQuotaTransfers)
+			quotaTransferRoute.POST("/self", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.TransferSelfQuota)
+			quotaTransferRoute.GET("/", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetQuotaTransfers)
+			quotaTransferRoute.POST("/token", middleware.PermissionAuth(common.PermissionBillingManage), controller.MoveTokenQuota)
+		}
+
+		quotaGrantRoute := apiRouter.Group("/quota_grant")
+		quotaGrantRoute.Use(middleware.PermissionAuth(common.PermissionBillingManage))
+		{
+			quotaGrantRoute.GET("/", controller.GetQuotaGrants)
+			quotaGrantRoute.POST("/", controller.CreateQuotaGrant)
+			quotaGrantRoute.PUT("/", controller.UpdateQuotaGrant)
+			quotaGrantRoute.GET("/records", controller.GetQuotaGrantRecords)
+			quotaGrantRoute.POST("/:id/run", controller.RunQuotaGrant)
+			quotaGrantRoute.DELETE("/:id", controller.DeleteQuotaGrant)
+		}
+
+		webhookRoute := apiRouter.Group("/webhook")
+		webhookRoute.Use(middleware.UserAuth())
+		{
+			webhookRoute.GET("/self", controller.GetSelfWebhookEndpoints)
+			webhookRoute.POST("/self", controller.CreateSelfWebhookEndpoint)
+			webhookRoute.PUT("/self", controller.UpdateSelfWebhookEndpoint)
+			webhookRoute.DELETE("/self/:id", controller.DeleteSelfWebhookEndpoint)
+			webhookRoute.GET("/self/events", controller.GetSelfWebhookEvents)
+			webhookRoute.POST("/self/events/:id/redeliver", middleware.CriticalRateLimit(), controller.RedeliverSelfWebhookEvent)
+		}
+
+		// 路由只要求管理员身份，查询字段由 schema 按 RBAC 权限逐个校验，根字段未声明权限时拒绝
+		graphqlRoute := apiRouter.Group("/graphql")
+		graphqlRoute.Use(middleware.PermissionAuth())
+		{
+			graphqlRoute.GET("/", controller.GraphQL)
+			graphqlRoute.POST("/", controller.GraphQL)
+		}
+
+		organizationRoute := apiRouter.Group("/organization")
+		{
+			organizationRoute.GET("/self", middleware.UserAuth(), controller.GetSelfOrganization)
+			organizationSelfRoute := organizationRoute.Group("/self")
+			organizationSelfRoute.Use(middleware.UserAuth(), middleware.OrganizationAdminAuth())
+			{
+				organizationSelfRoute.GET("/members", controller.GetSelfOrganizationMembers)
+				organizationSelfRoute.POST("/members", controller.AddSelfOrganizationMember)
+				organizationSelfRoute.PUT("/members", controller.UpdateSelfOrganizationMember)
+				organizationSelfRoute.DELETE("/members/:id", controller.RemoveSelfOrganizationMember)
+				organizationSelfRoute.GET("/tokens", controller.GetSelfOrganizationTokens)
+				organizationSelfRoute.PUT("/tokens", controller.UpdateSelfOrganizationToken)
+				organizationSelfRoute.DELETE("/tokens/:id", controller.DeleteSelfOrganizationToken)
+				organizationSelfRoute.GET("/usage", controller.GetSelfOrganizationUsage)
+			}
+			organizationRoute.GET("/", middleware.PermissionAuth(common.PermissionUsersManage), controller.GetOrganizations)
+			organizationRoute.POST("/", middleware.PermissionAuth(common.PermissionUsersManage), controller.AddOrganization)
+			organizationRoute.PUT("/", middleware.PermissionAuth(common.PermissionUsersManage), controller.UpdateOrganization)
+			organizationRoute.GET("/usage", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetOrganizationsUsage)
+			organizationRoute.GET("/:id", middleware.PermissionAuth(common.PermissionUsersManage), controller.GetOrganization)
+			organizationRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionUsersManage), controller.DeleteOrganization)
+			organizationRoute.POST("/:id/quota", middleware.PermissionAuth(common.PermissionBillingManage), controller.AdjustOrganizationQuota)
+			organizationRoute.GET("/:id/members", middleware.PermissionAuth(common.PermissionUsersManage), controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/members", middleware.PermissionAuth(common.PermissionUsersManage), controller.SetOrganizationMember)
+			organizationRoute.DELETE("/:id/members/:user_id", middleware.PermissionAuth(common.PermissionUsersManage), controller.RemoveOrganizationMember)
+			organizationRoute.GET("/:id/usage", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetOrganizationUsage)
+		}
+
+		budgetRoute := apiRouter.Group("/budget")
+		{
+			budgetRoute.GET("/self", middleware.UserAuth(), controller.GetSelfBudgets)
+			budgetRoute.POST("/self", middleware.UserAuth(), controller.AddSelfBudget)
+			budgetRoute.PUT("/self", middleware.UserAuth(), controller.UpdateSelfBudget)
+			budgetRoute.DELETE("/self/:id", middleware.UserAuth(), controller.DeleteSelfBudget)
+			budgetRoute.GET("/", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetBudgets)
+		}
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
+		dataRoute.GET("/free_tier/self", middleware.UserAuth(), controller.GetSelfFreeTierUsage)
+		dataRoute.GET("/free_tier", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetUserFreeTierUsage)
 
 		logRoute.Use(middleware.CORS())
 		{
 			logRoute.GET("/token", controller.GetLogByKey)
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(common.PermissionChannelsRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 
 		prefillGroupRoute := apiRouter.Group("/prefill_group")
-		prefillGroupRoute.Use(middleware.AdminAuth())
+		prefillGroupRoute.Use(middleware.PermissionAuth(common.PermissionChannelsRead))
 		{
 			prefillGroupRoute.GET("/", controller.GetPrefillGroups)
-			prefillGroupRoute.POST("/", controller.CreatePrefillGroup)
-			prefillGroupRoute.PUT("/", controller.UpdatePrefillGroup)
-			prefillGroupRoute.DELETE("/:id", controller.DeletePrefillGroup)
+			prefillGroupRoute.POST("/", channelsWriteAuth, controller.CreatePrefillGroup)
+			prefillGroupRoute.PUT("/", channelsWriteAuth, controller.UpdatePrefillGroup)
+			prefillGroupRoute.DELETE("/:id", channelsWriteAuth, controller.DeletePrefillGroup)
 		}
 
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllTask)
+			taskRoute.POST("/callback/:platform", controller.TaskCallback)
 		}
 
 		vendorRoute := apiRouter.Group("/vendors")
-		vendorRoute.Use(middleware.AdminAuth())
+		vendorRoute.Use(middleware.PermissionAuth(common.PermissionChannelsRead))
 		{
 			vendorRoute.GET("/", controller.GetAllVendors)
 			vendorRoute.GET("/search", controller.SearchVendors)
 			vendorRoute.GET("/:id", controller.GetVendorMeta)
-			vendorRoute.POST("/", controller.CreateVendorMeta)
-			vendorRoute.PUT("/", controller.UpdateVendorMeta)
-			vendorRoute.DELETE("/:id", controller.DeleteVendorMeta)
+			vendorRoute.POST("/", channelsWriteAuth, controller.CreateVendorMeta)
+			vendorRoute.PUT("/", channelsWriteAuth, controller.UpdateVendorMeta)
+			vendorRoute.DELETE("/:id", channelsWriteAuth, controller.DeleteVendorMeta)
 		}
 
 		modelsRoute := apiRouter.Group("/models")
-		modelsRoute.Use(middleware.AdminAuth())
+		modelsRoute.Use(middleware.PermissionAuth(common.PermissionChannelsRead))
 		{
 			modelsRoute.GET("/sync_upstream/preview", controller.SyncUpstreamPreview)
-			modelsRoute.POST("/sync_upstream", controller.SyncUpstreamModels)
+			modelsRoute.POST("/sync_upstream", channelsWriteAuth, controller.SyncUpstreamModels)
 			modelsRoute.GET("/missing", controller.GetMissingModels)
 			modelsRoute.GET("/", controller.GetAllModelsMeta)
 			modelsRoute.GET("/search", controller.SearchModelsMeta)
 			modelsRoute.GET("/:id", controller.GetModelMeta)
-			modelsRoute.POST("/", controller.CreateModelMeta)
-			modelsRoute.PUT("/", controller.UpdateModelMeta)
-			modelsRoute.DELETE("/:id", controller.DeleteModelMeta)
+			modelsRoute.POST("/", channelsWriteAuth, controller.CreateModelMeta)
+			modelsRoute.PUT("/", channelsWriteAuth, controller.UpdateModelMeta)
+			modelsRoute.DELETE("/:id", channelsWriteAuth, controller.DeleteModelMeta)
 		}
 
 		// Deployments (model deployment management)
 		deploymentsRoute := apiRouter.Group("/deployments")
-		deploymentsRoute.Use(middleware.AdminAuth())
+		deploymentsRoute.Use(middleware.PermissionAuth(common.PermissionChannelsRead))
 		{
 			deploymentsRoute.GET("/settings", controller.GetModelDeploymentSettings)
-			deploymentsRoute.POST("/settings/test-connection", controller.TestIoNetConnection)
+			deploymentsRoute.POST("/settings/test-connection", channelsWriteAuth, controller.TestIoNetConnection)
 			deploymentsRoute.GET("/", controller.GetAllDeployments)
 			deploymentsRoute.GET("/search", controller.SearchDeployments)
-			deploymentsRoute.POST("/test-connection", controller.TestIoNetConnection)
+			deploymentsRoute.POST("/test-connection", channelsWriteAuth, controller.TestIoNetConnection)
 			deploymentsRoute.GET("/hardware-types", controller.GetHardwareTypes)
 			deploymentsRoute.GET("/locations", controller.GetLocations)
 			deploymentsRoute.GET("/available-replicas", controller.GetAvailableReplicas)
 			deploymentsRoute.POST("/price-estimation", controller.GetPriceEstimation)
 			deploymentsRoute.GET("/check-name", controller.CheckClusterNameAvailability)
-			deploymentsRoute.POST("/", controller.CreateDeployment)
+			deploymentsRoute.POST("/", channelsWriteAuth, controller.CreateDeployment)
 
 			deploymentsRoute.GET("/:id", controller.GetDeployment)
 			deploymentsRoute.GET("/:id/logs", controller.GetDeploymentLogs)
 			deploymentsRoute.GET("/:id/containers", controller.ListDeploymentContainers)
 			deploymentsRoute.GET("/:id/containers/:container_id", controller.GetContainerDetails)
-			deploymentsRoute.PUT("/:id", controller.UpdateDeployment)
-			deploymentsRoute.PUT("/:id/name", controller.UpdateDeploymentName)
-			deploymentsRoute.POST("/:id/extend", controller.ExtendDeployment)
-			deploymentsRoute.DELETE("/:id", controller.DeleteDeployment)
+			deploymentsRoute.PUT("/:id", channelsWriteAuth, controller.UpdateDeployment)
+			deploymentsRoute.PUT("/:id/name", channelsWriteAuth, controller.UpdateDeploymentName)
+			deploymentsRoute.POST("/:id/extend", channelsWriteAuth, controller.ExtendDeployment)
+			deploymentsRoute.DELETE("/:id", channelsWriteAuth, controller.DeleteDeployment)
 		}
 	}
 }
@@ -0,0 +1,22 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func SetMcpRouter(router *gin.Engine) {
+	mcpRouter := router.Group("/mcp")
+	mcpRouter.Use(middleware.GlobalAPIRateLimit())
+	mcpRouter.Use(middleware.CORS())
+	mcpRouter.Use(middleware.TokenAuth())
+	{
+		// Streamable HTTP 传输
+		mcpRouter.POST("", controller.McpStreamableHTTP)
+		mcpRouter.GET("", controller.McpStreamableHTTPStream)
+		// 旧版 SSE 传输
+		mcpRouter.GET("/sse", controller.McpSSE)
+		mcpRouter.POST("/message", controller.McpSSEMessage)
+	}
+}
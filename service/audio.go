@@ -3,7 +3,13 @@ package service
 import (
 	"encoding/base64"
 	"fmt"
+	"path/filepath"
 	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
 )
 
 func parseAudio(audioBase64 string, format string) (duration float64, err error) {
@@ -46,3 +52,30 @@ func DecodeBase64AudioData(audioBase64 string) (string, error) {
 
 	return audioBase64, nil
 }
+
+// GetAudioDurationSeconds 返回本次请求的音频时长（秒）。
+// 优先使用已记录的时长（上游 verbose_json 返回或预估阶段计算），否则解析上传的音频文件
+func GetAudioDurationSeconds(c *gin.Context) (float64, error) {
+	if duration, ok := common.GetContextKeyType[float64](c, constant.ContextKeyAudioDurationSeconds); ok {
+		return duration, nil
+	}
+	form, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing multipart form: %v", err)
+	}
+	total := 0.0
+	for _, fileHeader := range form.File["file"] {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return 0, fmt.Errorf("error opening audio file: %v", err)
+		}
+		duration, err := common.GetAudioDuration(c.Request.Context(), file, filepath.Ext(fileHeader.Filename))
+		_ = file.Close()
+		if err != nil {
+			return 0, fmt.Errorf("error getting audio duration: %v", err)
+		}
+		total += duration
+	}
+	common.SetContextKey(c, constant.ContextKeyAudioDurationSeconds, total)
+	return total, nil
+}
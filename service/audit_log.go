@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const auditMaskedValue = "***"
+
+// auditSnapshotLoaders 按实体类型读取变更前后的完整记录，未注册的实体只记录请求内容
+var auditSnapshotLoaders = map[string]func(id string) (any, error){
+	"channel": func(id string) (any, error) {
+		return loadAuditSnapshotById(id, func(id int) (any, error) { return model.GetChannelById(id, true) })
+	},
+	"user": func(id string) (any, error) {
+		return loadAuditSnapshotById(id, func(id int) (any, error) { return model.GetUserById(id, false) })
+	},
+	"redemption": func(id string) (any, error) {
+		return loadAuditSnapshotById(id, func(id int) (any, error) { return model.GetRedemptionById(id) })
+	},
+	"coupon": func(id string) (any, error) {
+		return loadAuditSnapshotById(id, func(id int) (any, error) { return model.GetCouponById(id) })
+	},
+	"admin_role": func(id string) (any, error) {
+		return loadAuditSnapshotById(id, func(id int) (any, error) { return model.GetAdminRoleById(id) })
+	},
+	"option": func(key string) (any, error) {
+		common.OptionMapRWMutex.RLock()
+		defer common.OptionMapRWMutex.RUnlock()
+		value, ok := common.OptionMap[key]
+		if !ok {
+			return nil, nil
+		}
+		return map[string]any{"key": key, "value": value}, nil
+	},
+}
+
+func loadAuditSnapshotById(id string, load func(id int) (any, error)) (any, error) {
+	intId, err := strconv.Atoi(id)
+	if err != nil || intId == 0 {
+		return nil, nil
+	}
+	snapshot, err := load(intId)
+	if err != nil {
+		// 记录不存在（如已删除）时视为空
+		return nil, nil
+	}
+	return snapshot, nil
+}
+
+// LoadAuditSnapshot 读取实体当前状态并转换为便于比较的结构，不支持的实体返回 nil
+func LoadAuditSnapshot(entity string, entityId string) map[string]any {
+	load, ok := auditSnapshotLoaders[entity]
+	if !ok || entityId == "" {
+		return nil
+	}
+	snapshot, err := load(entityId)
+	if err != nil || snapshot == nil {
+		return nil
+	}
+	return toAuditMap(snapshot)
+}
+
+func HasAuditSnapshotLoader(entity string) bool {
+	_, ok := auditSnapshotLoaders[entity]
+	return ok
+}
+
+func toAuditMap(v any) map[string]any {
+	data, err := common.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err = common.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// isAuditSensitiveField 密钥、密码类字段只记录是否变化，不记录内容
+func isAuditSensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	return name == "key" || strings.HasSuffix(name, "_key") || strings.HasSuffix(name, "token") ||
+		strings.Contains(name, "password") || strings.Contains(name, "secret")
+}
+
+func maskAuditValue(name string, value any) any {
+	if isAuditSensitiveField(name) {
+		if value == nil || value == "" {
+			return value
+		}
+		return auditMaskedValue
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		return maskAuditMap(v)
+	case []any:
+		masked := make([]any, len(v))
+		for i, item := range v {
+			masked[i] = maskAuditValue(name, item)
+		}
+		return masked
+	}
+	return value
+}
+
+func maskAuditMap(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	masked := make(map[string]any, len(m))
+	for k, v := range m {
+		masked[k] = maskAuditValue(k, v)
+	}
+	// 配置项按配置名脱敏
+	if key, ok := m["key"].(string); ok && isAuditSensitiveField(key) {
+		if _, hasValue := m["value"]; hasValue {
+			masked["value"] = maskAuditValue(key, m["value"])
+		}
+	}
+	return masked
+}
+
+// diffAuditMaps 比较脱敏前的顶层字段，返回发生变化的字段，敏感字段只体现发生了变化
+func diffAuditMaps(before map[string]any, after map[string]any) map[string]any {
+	diff := make(map[string]any)
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			diff[k] = map[string]any{"before": maskAuditValue(k, before[k]), "after": maskAuditValue(k, v)}
+		}
+	}
+	for k, v := range before {
+		if _, ok := after[k]; !ok {
+			diff[k] = map[string]any{"before": maskAuditValue(k, v), "after": nil}
+		}
+	}
+	if key, ok := after["key"].(string); ok && isAuditSensitiveField(key) {
+		if change, ok := diff["value"].(map[string]any); ok {
+			change["before"] = maskAuditValue(key, change["before"])
+			change["after"] = maskAuditValue(key, change["after"])
+		}
+	}
+	return diff
+}
+
+func marshalAuditMap(m map[string]any) string {
+	if m == nil {
+		return ""
+	}
+	data, err := common.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// RecordAuditLog 写入审计记录并按配置推送到外部 webhook。
+// before/after 为实体变更前后的状态，实体不支持读取时 after 为请求内容
+func RecordAuditLog(log *model.AuditLog, before map[string]any, after map[string]any) {
+	if before != nil && after != nil {
+		log.Diff = marshalAuditMap(diffAuditMaps(before, after))
+	}
+	log.Before = marshalAuditMap(maskAuditMap(before))
+	log.After = marshalAuditMap(maskAuditMap(after))
+	log.CreatedAt = common.GetTimestamp()
+	if err := model.CreateAuditLog(log); err != nil {
+		common.SysError("failed to record audit log: " + err.Error())
+	}
+	settings := system_setting.GetAuditLogSettings()
+	if settings.WebhookURL == "" {
+		return
+	}
+	url, secret := settings.WebhookURL, settings.WebhookSecret
+	gopool.Go(func() {
+		data, err := common.Marshal(log)
+		if err != nil {
+			return
+		}
+		title := fmt.Sprintf("%s %s %s", log.Username, log.Action, log.Entity)
+		if err = SendWebhookNotify(url, secret, dto.NewNotify(dto.NotifyTypeAuditLog, title, string(data), nil)); err != nil {
+			logger.LogWarn(context.Background(), fmt.Sprintf("failed to stream audit log %d: %v", log.Id, err))
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/tidwall/gjson"
+)
+
+const batchTickInterval = 10 * time.Second
+
+var (
+	batchTaskOnce     sync.Once
+	batchRelayHandler http.Handler
+	runningBatches    sync.Map
+	runningBatchCount atomic.Int32
+)
+
+// StartBatchTask 启动批处理调度；handler 为服务自身的路由，批处理中的每一行都以提交令牌的身份重放，
+// 从而复用渠道分发、重试、限流与计费逻辑
+func StartBatchTask(handler http.Handler) {
+	batchTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		batchRelayHandler = handler
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("batch task started: tick=%s", batchTickInterval))
+			ticker := time.NewTicker(batchTickInterval)
+			defer ticker.Stop()
+
+			runBatchSchedulerOnce()
+			for range ticker.C {
+				runBatchSchedulerOnce()
+			}
+		})
+	})
+}
+
+func runBatchSchedulerOnce() {
+	setting := operation_setting.GetBatchSetting()
+	if !setting.Enabled || !model.IsLeader() {
+		return
+	}
+	batches, err := model.GetUnfinishedBatches()
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("failed to load unfinished batches: %v", err))
+		return
+	}
+	maxRunning := max(setting.MaxRunningBatches, 1)
+	for _, batch := range batches {
+		if int(runningBatchCount.Load()) >= maxRunning {
+			return
+		}
+		if _, loaded := runningBatches.LoadOrStore(batch.Id, struct{}{}); loaded {
+			continue
+		}
+		runningBatchCount.Add(1)
+		gopool.Go(func() {
+			defer func() {
+				runningBatches.Delete(batch.Id)
+				runningBatchCount.Add(-1)
+			}()
+			processBatch(batch)
+		})
+	}
+}
+
+// batchRequestStaleSeconds 请求被领取后超过该时间仍未保存结果，视为执行中断
+const batchRequestStaleSeconds = 30 * 60
+
+func processBatch(batch *model.Batch) {
+	ctx := context.Background()
+	if batch.Status == dto.BatchStatusValidating {
+		inProgressAt := common.GetTimestamp()
+		started, err := model.TransitionBatchStatus(batch.Id, []string{dto.BatchStatusValidating},
+			map[string]any{"status": dto.BatchStatusInProgress, "in_progress_at": inProgressAt})
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to start batch %s: %v", batch.BatchId, err))
+			return
+		}
+		// 状态已被并发修改（如取消），由下一轮按最新状态处理
+		if !started {
+			return
+		}
+		batch.Status = dto.BatchStatusInProgress
+		batch.InProgressAt = inProgressAt
+	}
+
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		closeBatch(batch, dto.BatchStatusFailed, model.BatchRequestStatusFailed, "submitting token is no longer available")
+		return
+	}
+	authKey := "sk-" + token.Key
+	if batch.SpecificChannelId > 0 {
+		authKey += "-" + strconv.Itoa(batch.SpecificChannelId)
+	}
+
+	// 以提交者的 IP 执行，令牌 IP 白名单与日志中的 IP 与直接调用一致
+	clientIp := batch.ClientIp
+	if clientIp == "" {
+		clientIp = "127.0.0.1"
+	}
+	remoteAddr := net.JoinHostPort(clientIp, "0")
+
+	setting := operation_setting.GetBatchSetting()
+	concurrency := max(setting.Concurrency, 1)
+	for {
+		status, err := model.GetBatchStatus(batch.Id)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to get batch %s status: %v", batch.BatchId, err))
+			return
+		}
+		if status == dto.BatchStatusCancelling {
+			closeBatch(batch, dto.BatchStatusCancelled, model.BatchRequestStatusCancelled, "batch cancelled")
+			return
+		}
+		if batch.ExpiresAt > 0 && common.GetTimestamp() > batch.ExpiresAt {
+			closeBatch(batch, dto.BatchStatusExpired, model.BatchRequestStatusExpired, "batch expired before this request was executed")
+			return
+		}
+		// 不再是 leader 时停止，由新的 leader 继续执行剩余请求
+		if !operation_setting.GetBatchSetting().Enabled || !model.IsLeader() {
+			return
+		}
+
+		requests, err := model.GetPendingBatchRequests(batch.Id, concurrency*4)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to load batch %s requests: %v", batch.BatchId, err))
+			return
+		}
+		if len(requests) == 0 {
+			break
+		}
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, concurrency)
+		for _, request := range requests {
+			sem <- struct{}{}
+			wg.Add(1)
+			gopool.Go(func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				executeBatchRequest(request, authKey, remoteAddr, setting.MaxRetries)
+			})
+		}
+		wg.Wait()
+	}
+
+	// 已领取但结果未落库的请求不重新执行以免重复计费，超时后按中断计入失败
+	if err := model.FailStaleBatchRequests(batch.Id, common.GetTimestamp()-batchRequestStaleSeconds, "request was interrupted and its result is unknown"); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to close batch %s interrupted requests: %v", batch.BatchId, err))
+		return
+	}
+	running, err := model.CountRunningBatchRequests(batch.Id)
+	if err != nil || running > 0 {
+		return
+	}
+
+	// 允许从 finalizing 重入，覆盖上次在两步之间中断的情况
+	finalizing, err := model.TransitionBatchStatus(batch.Id, []string{dto.BatchStatusInProgress, dto.BatchStatusFinalizing},
+		map[string]any{"status": dto.BatchStatusFinalizing, "finalizing_at": common.GetTimestamp()})
+	if err != nil || !finalizing {
+		return
+	}
+	if _, err := model.TransitionBatchStatus(batch.Id, []string{dto.BatchStatusFinalizing},
+		map[string]any{"status": dto.BatchStatusCompleted, "completed_at": common.GetTimestamp()}); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to complete batch %s: %v", batch.BatchId, err))
+	}
+}
+
+// closeBatch 结束批处理，剩余未执行的请求按 requestStatus 计入失败
+func closeBatch(batch *model.Batch, status string, requestStatus string, message string) {
+	if err := model.CloseBatchPendingRequests(batch.Id, requestStatus, message); err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("failed to close batch %s requests: %v", batch.BatchId, err))
+		return
+	}
+	fields := map[string]any{"status": status}
+	now := common.GetTimestamp()
+	switch status {
+	case dto.BatchStatusCancelled:
+		fields["cancelled_at"] = now
+	case dto.BatchStatusExpired:
+		fields["expired_at"] = now
+	case dto.BatchStatusFailed:
+		fields["failed_at"] = now
+	}
+	from := []string{dto.BatchStatusValidating, dto.BatchStatusInProgress, dto.BatchStatusFinalizing, dto.BatchStatusCancelling}
+	if _, err := model.TransitionBatchStatus(batch.Id, from, fields); err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("failed to close batch %s: %v", batch.BatchId, err))
+	}
+}
+
+func executeBatchRequest(request *model.BatchRequest, authKey string, remoteAddr string, maxRetries int) {
+	// 先领取再执行，已被其他执行者领取或已关闭的请求直接跳过
+	claimed, err := model.ClaimBatchRequest(request)
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("failed to claim batch request %d: %v", request.Id, err))
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	var recorder *httptest.ResponseRecorder
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, request.Url, strings.NewReader(request.Body))
+		if err != nil {
+			request.Status = model.BatchRequestStatusFailed
+			request.Error = err.Error()
+			break
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+authKey)
+		req.RemoteAddr = remoteAddr
+		recorder = httptest.NewRecorder()
+		batchRelayHandler.ServeHTTP(recorder, req)
+		if (recorder.Code == http.StatusTooManyRequests || recorder.Code >= http.StatusInternalServerError) && attempt < maxRetries {
+			time.Sleep(time.Duration(attempt+1) * 2 * time.Second)
+			continue
+		}
+		break
+	}
+
+	usage := dto.BatchUsage{}
+	if recorder != nil {
+		body := recorder.Body.Bytes()
+		request.StatusCode = recorder.Code
+		request.RequestId = recorder.Header().Get(common.RequestIdKey)
+		if gjson.ValidBytes(body) {
+			request.Response = string(body)
+		} else {
+			quoted, _ := common.Marshal(string(body))
+			request.Response = string(quoted)
+		}
+		if recorder.Code >= 200 && recorder.Code < 300 {
+			request.Status = model.BatchRequestStatusCompleted
+			usage = batchResponseUsage(body)
+		} else {
+			request.Status = model.BatchRequestStatusFailed
+		}
+	}
+	if err := model.FinishBatchRequest(request, usage); err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("failed to save batch request %d: %v", request.Id, err))
+	}
+}
+
+// batchResponseUsage 兼容 chat/completions/embeddings 与 responses 两种 usage 结构
+func batchResponseUsage(body []byte) dto.BatchUsage {
+	usage := gjson.GetBytes(body, "usage")
+	if !usage.Exists() {
+		return dto.BatchUsage{}
+	}
+	result := dto.BatchUsage{
+		InputTokens:  int(usage.Get("prompt_tokens").Int()),
+		OutputTokens: int(usage.Get("completion_tokens").Int()),
+		TotalTokens:  int(usage.Get("total_tokens").Int()),
+	}
+	if result.InputTokens == 0 {
+		result.InputTokens = int(usage.Get("input_tokens").Int())
+	}
+	if result.OutputTokens == 0 {
+		result.OutputTokens = int(usage.Get("output_tokens").Int())
+	}
+	if result.TotalTokens == 0 {
+		result.TotalTokens = result.InputTokens + result.OutputTokens
+	}
+	return result
+}
@@ -24,6 +24,9 @@ func PreConsumeBilling(c *gin.Context, preConsumedQuota int, relayInfo *relaycom
 	if relayInfo == nil {
 		return types.NewError(fmt.Errorf("relayInfo is nil"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
+	if apiErr := CheckBudgets(relayInfo, preConsumedQuota); apiErr != nil {
+		return apiErr
+	}
 
 	pref := common.NormalizeBillingPreference(relayInfo.UserSetting.BillingPreference)
 	trySubscription := func() *types.NewAPIError {
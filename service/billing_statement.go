@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gorm.io/gorm"
+)
+
+const billingPeriodLayout = "2006-01"
+
+var ErrBillingPeriodFinalized = errors.New("账期已锁定")
+
+// StatementUsageItem 按模型汇总的用量，单价为生成账单时的模型基础价格（美元），实际扣费已包含分组倍率
+type StatementUsageItem struct {
+	*model.StatementUsage
+	QuotaType       int     `json:"quota_type"`
+	ModelPrice      float64 `json:"model_price"`
+	InputPricePerM  float64 `json:"input_price_per_m"`
+	OutputPricePerM float64 `json:"output_price_per_m"`
+	Amount          float64 `json:"amount"`
+}
+
+// Statement 用户在一个自然月内的账单
+type Statement struct {
+	UserId      int                          `json:"user_id"`
+	Username    string                       `json:"username"`
+	Period      string                       `json:"period"`
+	StartTime   int64                        `json:"start_time"`
+	EndTime     int64                        `json:"end_time"`
+	Finalized   bool                         `json:"finalized"`
+	GeneratedAt int64                        `json:"generated_at"`
+	Usage       []*StatementUsageItem        `json:"usage"`
+	TopUps      []*model.StatementTopUp      `json:"topups"`
+	Adjustments []*model.StatementAdjustment `json:"adjustments"`
+
+	UsageQuota      int64   `json:"usage_quota"`
+	UsageAmount     float64 `json:"usage_amount"`
+	TopUpQuota      int64   `json:"topup_quota"`
+	TopUpMoney      float64 `json:"topup_money"`
+	RefundedQuota   int64   `json:"refunded_quota"`
+	AdjustmentQuota int64   `json:"adjustment_quota"`
+
+	// 开启多币种展示时在返回前填充，不随账单保存
+	DisplayAmounts map[string]CurrencyAmounts `json:"display_amounts,omitempty"`
+}
+
+// FillStatementDisplayAmounts 填充账单各项额度在展示币种下的金额
+func FillStatementDisplayAmounts(statement *Statement) {
+	if !operation_setting.GetCurrencySetting().Enabled {
+		return
+	}
+	statement.DisplayAmounts = map[string]CurrencyAmounts{
+		"usage_quota":      QuotaCurrencyAmounts(statement.UsageQuota),
+		"topup_quota":      QuotaCurrencyAmounts(statement.TopUpQuota),
+		"refunded_quota":   QuotaCurrencyAmounts(statement.RefundedQuota),
+		"adjustment_quota": QuotaCurrencyAmounts(statement.AdjustmentQuota),
+	}
+}
+
+// ParseBillingPeriod 解析 YYYY-MM 格式的账期，返回本地时区的起止时间
+func ParseBillingPeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(billingPeriodLayout, period, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("账期格式应为 YYYY-MM")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+func CurrentBillingPeriod() string {
+	return time.Now().Format(billingPeriodLayout)
+}
+
+func statementUsageItem(usage *model.StatementUsage) *StatementUsageItem {
+	item := &StatementUsageItem{
+		StatementUsage: usage,
+		Amount:         float64(usage.Quota) / common.QuotaPerUnit,
+	}
+	if modelPrice, ok := ratio_setting.GetModelPrice(usage.ModelName, false); ok {
+		item.QuotaType = 1
+		item.ModelPrice = modelPrice
+		return item
+	}
+	// 倍率 1 对应 $0.002 / 1K tokens
+	modelRatio, _, _ := ratio_setting.GetModelRatio(usage.ModelName)
+	item.InputPricePerM = modelRatio * 2
+	item.OutputPricePerM = modelRatio * ratio_setting.GetCompletionRatio(usage.ModelName) * 2
+	return item
+}
+
+func generateStatement(userId int, period string, start time.Time, end time.Time) (*Statement, error) {
+	statement := &Statement{
+		UserId:      userId,
+		Period:      period,
+		StartTime:   start.Unix(),
+		EndTime:     end.Unix(),
+		GeneratedAt: common.GetTimestamp(),
+	}
+	statement.Username, _ = model.GetUsernameById(userId, false)
+
+	usage, err := model.GetStatementUsage(userId, statement.StartTime, statement.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	statement.Usage = make([]*StatementUsageItem, 0, len(usage))
+	for _, u := range usage {
+		item := statementUsageItem(u)
+		statement.Usage = append(statement.Usage, item)
+		statement.UsageQuota += u.Quota
+	}
+	statement.UsageAmount = float64(statement.UsageQuota) / common.QuotaPerUnit
+
+	statement.TopUps, err = model.GetStatementTopUps(userId, statement.StartTime, statement.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, topUp := range statement.TopUps {
+		statement.TopUpQuota += topUp.Quota
+		statement.TopUpMoney += topUp.Money
+	}
+
+	statement.Adjustments, err = model.GetStatementAdjustments(userId, statement.StartTime, statement.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, adjustment := range statement.Adjustments {
+		if adjustment.Type == model.LogTypeTopup {
+			statement.RefundedQuota -= adjustment.Quota
+		} else {
+			statement.AdjustmentQuota += adjustment.Quota
+		}
+	}
+	return statement, nil
+}
+
+// GetStatement 已锁定的账期返回快照，否则按当前数据实时生成
+func GetStatement(userId int, period string) (*Statement, error) {
+	start, end, err := ParseBillingPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := model.GetBillingPeriod(period); err == nil {
+		saved, err := model.GetBillingStatement(userId, period)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 锁定时该用户没有任何账目
+			statement := &Statement{UserId: userId, Period: period, StartTime: start.Unix(), EndTime: end.Unix(), Finalized: true, GeneratedAt: common.GetTimestamp()}
+			statement.Username, _ = model.GetUsernameById(userId, false)
+			return statement, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		statement := &Statement{}
+		if err := common.UnmarshalJsonStr(saved.Content, statement); err != nil {
+			return nil, err
+		}
+		return statement, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return generateStatement(userId, period, start, end)
+}
+
+// FinalizeBillingPeriod 为账期内所有有账目的用户生成并保存账单快照，仅允许锁定已结束的账期
+func FinalizeBillingPeriod(period string, operatorId int) (*model.BillingPeriod, error) {
+	start, end, err := ParseBillingPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if end.After(time.Now()) {
+		return nil, errors.New("账期尚未结束，无法锁定")
+	}
+	if _, err := model.GetBillingPeriod(period); err == nil {
+		return nil, ErrBillingPeriodFinalized
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	userIds, err := model.GetBillingUserIds(start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+	now := common.GetTimestamp()
+	statements := make([]*model.BillingStatement, 0, len(userIds))
+	for _, userId := range userIds {
+		statement, err := generateStatement(userId, period, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("generate statement for user %d: %w", userId, err)
+		}
+		statement.Finalized = true
+		statement.GeneratedAt = now
+		content, err := common.Marshal(statement)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, &model.BillingStatement{
+			UserId:     userId,
+			Period:     period,
+			UsageQuota: statement.UsageQuota,
+			TopUpQuota: statement.TopUpQuota,
+			Content:    string(content),
+			CreatedAt:  now,
+		})
+	}
+	billingPeriod := &model.BillingPeriod{
+		Period:         period,
+		StartTime:      start.Unix(),
+		EndTime:        end.Unix(),
+		StatementCount: len(statements),
+		FinalizedBy:    operatorId,
+		FinalizedAt:    now,
+	}
+	if err := model.FinalizeBillingPeriod(billingPeriod, statements); err != nil {
+		return nil, err
+	}
+	common.SysLog(fmt.Sprintf("billing period %s finalized by user %d, %d statements", period, operatorId, len(statements)))
+	return billingPeriod, nil
+}
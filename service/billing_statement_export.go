@@ -0,0 +1,235 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/QuantumNous/new-api/logger"
+)
+
+func formatStatementTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
+
+func formatStatementUnitPrice(item *StatementUsageItem) string {
+	if item.QuotaType == 1 {
+		return fmt.Sprintf("$%.6g / request", item.ModelPrice)
+	}
+	return fmt.Sprintf("$%.6g / $%.6g per 1M tokens", item.InputPricePerM, item.OutputPricePerM)
+}
+
+func statementSummaryRows(statement *Statement) [][]string {
+	return [][]string{
+		{"Usage", strconv.FormatInt(statement.UsageQuota, 10), fmt.Sprintf("$%.6f", statement.UsageAmount)},
+		{"Top-ups", strconv.FormatInt(statement.TopUpQuota, 10), fmt.Sprintf("%.2f", statement.TopUpMoney)},
+		{"Refunds", strconv.FormatInt(-statement.RefundedQuota, 10), ""},
+		{"Adjustments", strconv.FormatInt(statement.AdjustmentQuota, 10), ""},
+	}
+}
+
+// StatementCSV 导出 CSV，各部分之间以空行分隔
+func StatementCSV(statement *Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	// Excel 依赖 BOM 识别 UTF-8
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	rows := [][]string{
+		{"Statement", statement.Period},
+		{"User", strconv.Itoa(statement.UserId), statement.Username},
+		{"Period", formatStatementTime(statement.StartTime), formatStatementTime(statement.EndTime)},
+		{"Finalized", strconv.FormatBool(statement.Finalized)},
+		{"Generated at", formatStatementTime(statement.GeneratedAt)},
+		{},
+		{"Model", "Requests", "Prompt tokens", "Completion tokens", "Unit price", "Quota", "Amount (USD)"},
+	}
+	for _, item := range statement.Usage {
+		rows = append(rows, []string{
+			item.ModelName,
+			strconv.Itoa(item.Requests),
+			strconv.FormatInt(item.PromptTokens, 10),
+			strconv.FormatInt(item.CompletionTokens, 10),
+			formatStatementUnitPrice(item),
+			strconv.FormatInt(item.Quota, 10),
+			fmt.Sprintf("%.6f", item.Amount),
+		})
+	}
+	rows = append(rows, []string{}, []string{"Time", "Source", "Reference", "Payment method", "Money", "Quota", "Refunded quota", "Status"})
+	for _, topUp := range statement.TopUps {
+		rows = append(rows, []string{
+			formatStatementTime(topUp.Time),
+			topUp.Source,
+			topUp.Reference,
+			topUp.PaymentMethod,
+			fmt.Sprintf("%.2f", topUp.Money),
+			strconv.FormatInt(topUp.Quota, 10),
+			strconv.FormatInt(topUp.RefundedQuota, 10),
+			topUp.Status,
+		})
+	}
+	rows = append(rows, []string{}, []string{"Time", "Adjustment", "Quota"})
+	for _, adjustment := range statement.Adjustments {
+		rows = append(rows, []string{formatStatementTime(adjustment.Time), adjustment.Content, strconv.FormatInt(adjustment.Quota, 10)})
+	}
+	rows = append(rows, []string{}, []string{"Summary", "Quota", "Amount"})
+	rows = append(rows, statementSummaryRows(statement)...)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 40
+)
+
+// pdfWriter 生成只含文字的 A4 PDF，使用阅读器内置的 STSong-Light 字体以支持中文，无需嵌入字体文件；ASCII 字符按半角宽度排版
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (p *pdfWriter) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.y = pdfPageHeight - pdfMargin
+}
+
+func pdfHexString(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// row 按列起始位置输出一行，超出页面时换页
+func (p *pdfWriter) row(size float64, columns []float64, cells ...string) {
+	lineHeight := size * 1.5
+	if len(p.pages) == 0 || p.y-lineHeight < pdfMargin {
+		p.newPage()
+	}
+	p.y -= lineHeight
+	page := p.pages[len(p.pages)-1]
+	for i, cell := range cells {
+		if cell == "" || i >= len(columns) {
+			continue
+		}
+		fmt.Fprintf(page, "BT /F1 %.1f Tf %.1f %.1f Td %s Tj ET\n", size, pdfMargin+columns[i], p.y, pdfHexString(cell))
+	}
+}
+
+func (p *pdfWriter) gap() {
+	p.y -= 10
+}
+
+func (p *pdfWriter) bytes() []byte {
+	if len(p.pages) == 0 {
+		p.newPage()
+	}
+	var out bytes.Buffer
+	var offsets []int
+	writeObject := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n")
+	// 1: Catalog, 2: Pages, 3-4: 字体，之后每页占用页面与内容两个对象
+	pageCount := len(p.pages)
+	kids := make([]string, pageCount)
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	writeObject("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UTF16-H /DescendantFonts [4 0 R] >>")
+	writeObject("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 4 >> /FontDescriptor << /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >> /DW 1000 /W [1 95 500] >>")
+	for i, page := range p.pages {
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+i*2))
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+func truncateStatementCell(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// StatementPDF 导出 PDF 账单
+func StatementPDF(statement *Statement) []byte {
+	p := &pdfWriter{}
+	info := []float64{0, 110}
+	p.row(16, info, "Billing Statement "+statement.Period)
+	p.gap()
+	p.row(10, info, "User", fmt.Sprintf("#%d %s", statement.UserId, statement.Username))
+	p.row(10, info, "Period", formatStatementTime(statement.StartTime)+" - "+formatStatementTime(statement.EndTime))
+	status := "Preview (not finalized)"
+	if statement.Finalized {
+		status = "Finalized"
+	}
+	p.row(10, info, "Status", status)
+	p.row(10, info, "Generated at", formatStatementTime(statement.GeneratedAt))
+
+	p.gap()
+	usageColumns := []float64{0, 150, 200, 260, 320, 455}
+	p.row(12, usageColumns, "Usage by model")
+	p.row(8, usageColumns, "Model", "Requests", "Prompt", "Completion", "Unit price", "Amount (USD)")
+	for _, item := range statement.Usage {
+		p.row(8, usageColumns,
+			truncateStatementCell(item.ModelName, 32),
+			strconv.Itoa(item.Requests),
+			strconv.FormatInt(item.PromptTokens, 10),
+			strconv.FormatInt(item.CompletionTokens, 10),
+			formatStatementUnitPrice(item),
+			fmt.Sprintf("%.6f", item.Amount),
+		)
+	}
+
+	p.gap()
+	topUpColumns := []float64{0, 95, 160, 330, 390, 455}
+	p.row(12, topUpColumns, "Top-ups")
+	p.row(8, topUpColumns, "Time", "Source", "Reference", "Money", "Quota", "Refunded")
+	for _, topUp := range statement.TopUps {
+		p.row(8, topUpColumns,
+			formatStatementTime(topUp.Time),
+			topUp.Source,
+			truncateStatementCell(topUp.Reference, 36),
+			fmt.Sprintf("%.2f", topUp.Money),
+			logger.FormatQuota(int(topUp.Quota)),
+			logger.FormatQuota(int(topUp.RefundedQuota)),
+		)
+	}
+
+	p.gap()
+	adjustmentColumns := []float64{0, 95, 455}
+	p.row(12, adjustmentColumns, "Adjustments")
+	p.row(8, adjustmentColumns, "Time", "Description", "Quota")
+	for _, adjustment := range statement.Adjustments {
+		p.row(8, adjustmentColumns, formatStatementTime(adjustment.Time), truncateStatementCell(adjustment.Content, 40), logger.FormatQuota(int(adjustment.Quota)))
+	}
+
+	p.gap()
+	summaryColumns := []float64{0, 150, 300}
+	p.row(12, summaryColumns, "Summary")
+	for _, row := range statementSummaryRows(statement) {
+		p.row(10, summaryColumns, row...)
+	}
+	return p.bytes()
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+var bodyCaptureCleanupOnce sync.Once
+
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"x-goog-api-key":      true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=\-]+`), "${1}***"},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{8,}`), "sk-***"},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{20,}`), "AIza***"},
+	{regexp.MustCompile(`(?i)("(?:api[_-]?key|apikey|access[_-]?token|secret[_-]?key|secret|password|authorization)"\s*:\s*")[^"]*"`), `${1}***"`},
+	{regexp.MustCompile(`(?i)([?&](?:key|api[_-]?key|access[_-]?token)=)[^&\s"]+`), "${1}***"},
+}
+
+// RedactSecrets 去掉文本中常见格式的密钥，secrets 中的内容按原文替换
+func RedactSecrets(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		if len(secret) >= 8 {
+			text = strings.ReplaceAll(text, secret, "***")
+		}
+	}
+	for _, p := range secretPatterns {
+		text = p.pattern.ReplaceAllString(text, p.replacement)
+	}
+	return text
+}
+
+// RedactHeaders 去掉鉴权相关的请求头，其余请求头按文本规则脱敏
+func RedactHeaders(header map[string][]string, secrets ...string) map[string][]string {
+	redacted := make(map[string][]string, len(header))
+	for name, values := range header {
+		if sensitiveHeaders[strings.ToLower(name)] {
+			redacted[name] = []string{"***"}
+			continue
+		}
+		copied := make([]string, len(values))
+		for i, value := range values {
+			copied[i] = RedactSecrets(value, secrets...)
+		}
+		redacted[name] = copied
+	}
+	return redacted
+}
+
+// captureBuffer 最多记录 limit 字节，超出部分丢弃
+type captureBuffer struct {
+	mu        sync.Mutex
+	buffer    bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if remaining := b.limit - b.buffer.Len(); len(p) > remaining {
+		b.truncated = true
+		p = p[:max(remaining, 0)]
+	}
+	b.buffer.Write(p)
+	return len(p), nil
+}
+
+func (b *captureBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+type captureReadCloser struct {
+	io.Reader
+	closer  io.Closer
+	onClose func()
+}
+
+func (r *captureReadCloser) Close() error {
+	err := r.closer.Close()
+	r.onClose()
+	return err
+}
+
+// BodyCapture 记录一次上游请求的完整内容，nil 表示本次未被采样
+type BodyCapture struct {
+	record   *model.BodyCapture
+	start    time.Time
+	apiKey   string
+	header   http.Header
+	request  *captureBuffer
+	response *captureBuffer
+	once     sync.Once
+}
+
+// StartBodyCapture 按渠道/令牌采样率决定是否记录本次上游请求，命中时接管请求体
+func StartBodyCapture(c *gin.Context, info *relaycommon.RelayInfo, req *http.Request) *BodyCapture {
+	setting := operation_setting.GetBodyCaptureSetting()
+	if !setting.Enabled {
+		return nil
+	}
+	rate := setting.SampleRate(info.ChannelId, info.TokenId)
+	if rate <= 0 || rand.Float64() >= rate {
+		return nil
+	}
+	limit := setting.MaxBodyBytes
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	capture := &BodyCapture{
+		record: &model.BodyCapture{
+			RequestId: c.GetString(common.RequestIdKey),
+			UserId:    info.UserId,
+			TokenId:   info.TokenId,
+			ChannelId: info.ChannelId,
+			ModelName: info.UpstreamModelName,
+			Method:    req.Method,
+			Url:       RedactSecrets(req.URL.String()),
+			IsStream:  info.IsStream,
+		},
+		start:    time.Now(),
+		apiKey:   info.ApiKey,
+		header:   req.Header.Clone(),
+		request:  &captureBuffer{limit: limit},
+		response: &captureBuffer{limit: limit},
+	}
+	if req.Body != nil {
+		req.Body = &captureReadCloser{Reader: io.TeeReader(req.Body, capture.request), closer: req.Body, onClose: func() {}}
+	}
+	return capture
+}
+
+// Finish 请求失败时立即保存；成功时在响应体关闭后保存，流式响应保存完整的事件流
+func (capture *BodyCapture) Finish(resp *http.Response, err error) {
+	if capture == nil {
+		return
+	}
+	if err != nil || resp == nil || resp.Body == nil {
+		if err != nil {
+			capture.record.Error = RedactSecrets(err.Error(), capture.apiKey)
+		}
+		capture.save(nil)
+		return
+	}
+	capture.record.StatusCode = resp.StatusCode
+	header := resp.Header.Clone()
+	body := resp.Body
+	resp.Body = &captureReadCloser{
+		Reader:  io.TeeReader(body, capture.response),
+		closer:  body,
+		onClose: func() { capture.save(header) },
+	}
+}
+
+func (capture *BodyCapture) save(responseHeader http.Header) {
+	capture.once.Do(func() {
+		record := capture.record
+		record.CreatedAt = common.GetTimestamp()
+		record.Duration = time.Since(capture.start).Milliseconds()
+		record.Truncated = capture.request.truncated || capture.response.truncated
+		// 请求头在保存前脱敏，避免渠道密钥落库
+		payload := &model.BodyCapturePayload{
+			RequestHeaders:  RedactHeaders(capture.header, capture.apiKey),
+			RequestBody:     capture.request.String(),
+			ResponseHeaders: RedactHeaders(responseHeader, capture.apiKey),
+			ResponseBody:    capture.response.String(),
+		}
+		gopool.Go(func() {
+			if err := record.SetPayload(payload); err != nil {
+				common.SysError("body capture encrypt failed: " + err.Error())
+				return
+			}
+			if err := model.CreateBodyCapture(record); err != nil {
+				common.SysError("body capture save failed: " + err.Error())
+			}
+		})
+	})
+}
+
+// StartBodyCaptureCleanupTask 定期删除超过保留时间的记录
+func StartBodyCaptureCleanupTask() {
+	bodyCaptureCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				if hours := operation_setting.GetBodyCaptureSetting().RetentionHours; hours > 0 && model.IsLeader() {
+					before := time.Now().Add(-time.Duration(hours) * time.Hour).Unix()
+					if _, err := model.DeleteBodyCapturesBefore(before); err != nil {
+						common.SysError("body capture cleanup failed: " + err.Error())
+					}
+				}
+				time.Sleep(time.Hour)
+			}
+		})
+	})
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// GetSelfBudgets 返回用户的预算，跨月的预算按清零后的状态展示
+func GetSelfBudgets(userId int) ([]*model.Budget, error) {
+	budgets, err := model.GetUserBudgets(userId)
+	if err != nil {
+		return nil, err
+	}
+	period := CurrentBillingPeriod()
+	for _, budget := range budgets {
+		budget.ResetIfStale(period)
+	}
+	return budgets, nil
+}
+
+// CheckBudgets 预扣费前检查命中的预算，命中硬限额时在数据库中原子地预占预扣额度，超出硬限额时拒绝请求
+func CheckBudgets(relayInfo *relaycommon.RelayInfo, preConsumedQuota int) *types.NewAPIError {
+	relayInfo.BudgetIds = nil
+	relayInfo.BudgetReserved = 0
+	budgets, err := model.GetUserBudgetsCached(relayInfo.UserId)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	var ids []int
+	hardLimited := false
+	for _, budget := range budgets {
+		if !budget.Matches(relayInfo.TokenId, relayInfo.UsingGroup) {
+			continue
+		}
+		ids = append(ids, budget.Id)
+		if budget.HardLimit > 0 {
+			hardLimited = true
+		}
+	}
+	if hardLimited {
+		exceeded, err := model.ReserveBudgetSpent(ids, preConsumedQuota, CurrentBillingPeriod())
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		}
+		if exceeded != nil {
+			return types.NewErrorWithStatusCode(fmt.Errorf("已达到%s本月预算上限 %s, 本月已消费: %s", budgetScopeName(exceeded), logger.FormatQuota(exceeded.HardLimit), logger.FormatQuota(exceeded.Spent)), types.ErrorCodeBudgetExceeded, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		relayInfo.BudgetReserved = preConsumedQuota
+	}
+	relayInfo.BudgetIds = ids
+	return nil
+}
+
+// ReleaseBudgets 请求未结算时退回预扣阶段在预算上预占的额度，结算后调用不做任何事
+func ReleaseBudgets(relayInfo *relaycommon.RelayInfo) {
+	reserved := relayInfo.BudgetReserved
+	if reserved == 0 || len(relayInfo.BudgetIds) == 0 {
+		return
+	}
+	relayInfo.BudgetReserved = 0
+	ids, userId := relayInfo.BudgetIds, relayInfo.UserId
+	gopool.Go(func() {
+		if err := model.ReleaseBudgetSpent(ids, reserved, CurrentBillingPeriod()); err != nil {
+			common.SysError(fmt.Sprintf("failed to release budgets of user %d: %s", userId, err.Error()))
+		}
+	})
+}
+
+// SettleBudgets 实际消费与预扣额度相同、无需补扣或返还时单独结算预算
+func SettleBudgets(relayInfo *relaycommon.RelayInfo, consumed int) {
+	addBudgetSpent(relayInfo, consumed)
+}
+
+// addBudgetSpent 消费后将预占额度替换为实际消费，并在跨过提醒比例或达到硬限额时通知用户
+func addBudgetSpent(relayInfo *relaycommon.RelayInfo, consumed int) {
+	if len(relayInfo.BudgetIds) == 0 {
+		return
+	}
+	delta := consumed - relayInfo.BudgetReserved
+	if delta < 0 {
+		relayInfo.BudgetReserved = -delta
+		ReleaseBudgets(relayInfo)
+		return
+	}
+	relayInfo.BudgetReserved = 0
+	if delta == 0 {
+		return
+	}
+	ids := relayInfo.BudgetIds
+	userId, email, userSetting := relayInfo.UserId, relayInfo.UserEmail, relayInfo.UserSetting
+	gopool.Go(func() {
+		budgets, err := model.AddBudgetSpent(ids, delta, CurrentBillingPeriod())
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to update budgets of user %d: %s", userId, err.Error()))
+			return
+		}
+		for _, budget := range budgets {
+			notifyBudget(userId, email, userSetting, budget)
+		}
+	})
+}
+
+// budgetLevels 以软限额（未设置时为硬限额）为基准的提醒百分比，达到软限额和硬限额也各提醒一次
+func budgetLevels(budget *model.Budget) (base int, levels []int, hardLevel int) {
+	base = budget.SoftLimit
+	if base <= 0 {
+		base = budget.HardLimit
+	}
+	levels = budget.Thresholds()
+	if budget.SoftLimit > 0 {
+		levels = append(levels, 100)
+	}
+	if budget.HardLimit > 0 {
+		hardLevel = budget.HardLimit * 100 / base
+		levels = append(levels, hardLevel)
+	}
+	return base, levels, hardLevel
+}
+
+func notifyBudget(userId int, email string, userSetting dto.UserSetting, budget *model.Budget) {
+	base, levels, hardLevel := budgetLevels(budget)
+	if base <= 0 {
+		return
+	}
+	percent := budget.Spent * 100 / base
+	level := 0
+	for _, l := range levels {
+		if l <= percent && l > level {
+			level = l
+		}
+	}
+	if level <= budget.Notified {
+		return
+	}
+	marked, err := model.MarkBudgetNotified(budget.Id, level)
+	if err != nil || !marked {
+		return
+	}
+	scope := budgetScopeName(budget)
+	var title, content string
+	if hardLevel > 0 && level >= hardLevel {
+		title = "预算已用尽"
+		content = fmt.Sprintf("%s本月消费 %s 已达到预算上限 %s，后续请求将被拒绝，下月初自动恢复。", scope, logger.FormatQuota(budget.Spent), logger.FormatQuota(budget.HardLimit))
+	} else {
+		title = "预算使用提醒"
+		content = fmt.Sprintf("%s本月消费 %s，已达到预算 %s 的 %d%%。", scope, logger.FormatQuota(budget.Spent), logger.FormatQuota(base), level)
+	}
+	err = NotifyUser(userId, email, userSetting, dto.NewNotify(dto.NotifyTypeBudget, title, content, nil))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send budget notify to user %d: %s", userId, err.Error()))
+	}
+}
+
+func budgetScopeName(budget *model.Budget) string {
+	switch budget.Scope {
+	case model.BudgetScopeToken:
+		return fmt.Sprintf("令牌 #%d ", budget.TokenId)
+	case model.BudgetScopeGroup:
+		return fmt.Sprintf("分组 %s ", budget.Group)
+	default:
+		return "账户"
+	}
+}
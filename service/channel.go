@@ -19,6 +19,27 @@ func formatNotifyType(channelId int, status int) string {
 
 // disable & notify
 func DisableChannel(channelError types.ChannelError, reason string) {
+	disableChannel(channelError, reason, "")
+}
+
+// DisableChannelByError 根据上游错误禁用渠道，并在状态历史中保留错误详情
+func DisableChannelByError(channelError types.ChannelError, err *types.NewAPIError) {
+	reason, payload := "", ""
+	if err != nil {
+		reason = err.ErrorWithStatusCode()
+		body, marshalErr := common.Marshal(map[string]any{
+			"status_code": err.StatusCode,
+			"error_type":  err.GetErrorType(),
+			"error":       err.ToOpenAIError(),
+		})
+		if marshalErr == nil {
+			payload = string(body)
+		}
+	}
+	disableChannel(channelError, reason, payload)
+}
+
+func disableChannel(channelError types.ChannelError, reason string, errorPayload string) {
 	common.SysLog(fmt.Sprintf("通道「%s」（#%d）发生错误，准备禁用，原因：%s", channelError.ChannelName, channelError.ChannelId, reason))
 
 	// 检查是否启用自动禁用功能
@@ -29,6 +50,20 @@ func DisableChannel(channelError types.ChannelError, reason string) {
 
 	success := model.UpdateChannelStatus(channelError.ChannelId, channelError.UsingKey, common.ChannelStatusAutoDisabled, reason)
 	if success {
+		RecordChannelStatusChange(&model.ChannelStatusHistory{
+			ChannelId:    channelError.ChannelId,
+			FromStatus:   common.ChannelStatusEnabled,
+			ToStatus:     common.ChannelStatusAutoDisabled,
+			KeyIndex:     channelKeyIndex(channelError.ChannelId, channelError.UsingKey),
+			TriggerType:  model.ChannelStatusTriggerAutoDisable,
+			Reason:       reason,
+			ErrorPayload: errorPayload,
+		})
+		if channel, err := model.CacheGetChannel(channelError.ChannelId); err == nil && channel != nil {
+			if enqueueTagDisableNotify(channel.GetTag(), channelError.ChannelId, channelError.ChannelName, reason) {
+				return
+			}
+		}
 		subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelError.ChannelName, channelError.ChannelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelError.ChannelName, channelError.ChannelId, reason)
 		NotifyRootUser(formatNotifyType(channelError.ChannelId, common.ChannelStatusAutoDisabled), subject, content)
@@ -38,12 +73,36 @@ func DisableChannel(channelError types.ChannelError, reason string) {
 func EnableChannel(channelId int, usingKey string, channelName string) {
 	success := model.UpdateChannelStatus(channelId, usingKey, common.ChannelStatusEnabled, "")
 	if success {
+		RecordChannelStatusChange(&model.ChannelStatusHistory{
+			ChannelId:   channelId,
+			FromStatus:  common.ChannelStatusAutoDisabled,
+			ToStatus:    common.ChannelStatusEnabled,
+			KeyIndex:    channelKeyIndex(channelId, usingKey),
+			TriggerType: model.ChannelStatusTriggerAutoEnable,
+		})
 		subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusEnabled), subject, content)
 	}
 }
 
+// channelKeyIndex 返回多 key 渠道中 usingKey 的索引，整个渠道返回 -1
+func channelKeyIndex(channelId int, usingKey string) int {
+	if usingKey == "" {
+		return -1
+	}
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil || channel == nil || !channel.ChannelInfo.IsMultiKey {
+		return -1
+	}
+	for i, key := range channel.GetKeys() {
+		if key == usingKey {
+			return i
+		}
+	}
+	return -1
+}
+
 func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	if !common.AutomaticDisableChannelEnabled {
 		return false
@@ -57,6 +116,10 @@ func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	if types.IsSkipRetryError(err) {
 		return false
 	}
+	if rule := MatchChannelDisableRule(channelType, err); rule != nil {
+		return rule.Action == operation_setting.ChannelDisableRuleActionDisable ||
+			rule.Action == operation_setting.ChannelDisableRuleActionDisableKey
+	}
 	if operation_setting.ShouldDisableByStatusCode(err.StatusCode) {
 		return true
 	}
@@ -86,7 +86,7 @@ func getChannelAffinityCache() *cachex.HybridCache[int] {
 			Namespace: cachex.Namespace(channelAffinityCacheNamespace),
 			Redis:     common.RDB,
 			RedisEnabled: func() bool {
-				return common.RedisEnabled && common.RDB != nil
+				return common.RedisEnabled.Load() && common.RDB != nil
 			},
 			RedisCodec: cachex.IntCodec{},
 			Memory: func() *hot.HotCache[string, int] {
@@ -761,7 +761,7 @@ func getChannelAffinityUsageCacheStatsCache() *cachex.HybridCache[ChannelAffinit
 			Namespace: cachex.Namespace(channelAffinityUsageCacheStatsNamespace),
 			Redis:     common.RDB,
 			RedisEnabled: func() bool {
-				return common.RedisEnabled && common.RDB != nil
+				return common.RedisEnabled.Load() && common.RDB != nil
 			},
 			RedisCodec: cachex.JSONCodec[ChannelAffinityUsageCacheCounters]{},
 			Memory: func() *hot.HotCache[string, ChannelAffinityUsageCacheCounters] {
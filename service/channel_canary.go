@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const canaryTickInterval = 1 * time.Minute
+
+type canaryStat struct {
+	requests int64
+	errors   int64
+	duration time.Duration
+}
+
+func (s canaryStat) errorRate() float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	return float64(s.errors) * 100 / float64(s.requests)
+}
+
+func (s canaryStat) avgLatency() time.Duration {
+	if s.requests == 0 {
+		return 0
+	}
+	return s.duration / time.Duration(s.requests)
+}
+
+// canaryEvaluation 评估期内灰度渠道与同模型正常渠道（baseline）的请求统计
+type canaryEvaluation struct {
+	since    time.Time
+	models   map[string]bool
+	canary   canaryStat
+	baseline canaryStat
+}
+
+var (
+	canaryLock        sync.Mutex
+	canaryEvaluations = map[int]*canaryEvaluation{}
+
+	canaryOnce    sync.Once
+	canaryRunning atomic.Bool
+)
+
+// ObserveCanaryAttempt 记录一次上游请求，供灰度评估对比，仅在存在评估中的灰度渠道时生效
+func ObserveCanaryAttempt(modelName string, channelId int, failed bool, duration time.Duration) {
+	canaryLock.Lock()
+	defer canaryLock.Unlock()
+	if len(canaryEvaluations) == 0 {
+		return
+	}
+	record := func(stat *canaryStat) {
+		stat.requests++
+		stat.duration += duration
+		if failed {
+			stat.errors++
+		}
+	}
+	if evaluation, ok := canaryEvaluations[channelId]; ok {
+		record(&evaluation.canary)
+		return
+	}
+	for _, evaluation := range canaryEvaluations {
+		if evaluation.models[modelName] {
+			record(&evaluation.baseline)
+		}
+	}
+}
+
+// StartCanaryEvaluationTask 定时评估灰度渠道，统计数据只来自 leader 节点自身转发的请求
+func StartCanaryEvaluationTask() {
+	canaryOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("canary evaluation task started: tick=%s", canaryTickInterval))
+			ticker := time.NewTicker(canaryTickInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runCanaryEvaluationOnce()
+			}
+		})
+	})
+}
+
+func runCanaryEvaluationOnce() {
+	if !model.IsLeader() {
+		return
+	}
+	if !canaryRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer canaryRunning.Store(false)
+
+	setting := operation_setting.GetCanarySetting()
+	if !setting.AutoEvaluateEnabled {
+		canaryLock.Lock()
+		canaryEvaluations = map[int]*canaryEvaluation{}
+		canaryLock.Unlock()
+		return
+	}
+	channels, err := model.GetEnabledCanaryChannels()
+	if err != nil {
+		common.SysLog("failed to load canary channels: " + err.Error())
+		return
+	}
+
+	type finished struct {
+		channel    *model.Channel
+		evaluation canaryEvaluation
+	}
+	var done []finished
+	window := time.Duration(setting.EvaluationMinutes) * time.Minute
+	canaryLock.Lock()
+	active := make(map[int]*canaryEvaluation, len(channels))
+	for _, channel := range channels {
+		evaluation, ok := canaryEvaluations[channel.Id]
+		if !ok {
+			evaluation = &canaryEvaluation{since: time.Now(), models: make(map[string]bool)}
+			for _, modelName := range strings.Split(channel.Models, ",") {
+				if modelName = strings.TrimSpace(modelName); modelName != "" {
+					evaluation.models[modelName] = true
+				}
+			}
+		}
+		if time.Since(evaluation.since) >= window && evaluation.canary.requests >= int64(setting.MinRequests) {
+			done = append(done, finished{channel: channel, evaluation: *evaluation})
+			continue
+		}
+		active[channel.Id] = evaluation
+	}
+	canaryEvaluations = active
+	canaryLock.Unlock()
+
+	for _, item := range done {
+		concludeCanary(item.channel, item.evaluation, setting)
+	}
+}
+
+func concludeCanary(channel *model.Channel, evaluation canaryEvaluation, setting *operation_setting.CanarySetting) {
+	canary, baseline := evaluation.canary, evaluation.baseline
+	summary := fmt.Sprintf("灰度渠道错误率 %.2f%%、平均耗时 %dms（%d 次请求），正常渠道错误率 %.2f%%、平均耗时 %dms（%d 次请求）",
+		canary.errorRate(), canary.avgLatency().Milliseconds(), canary.requests,
+		baseline.errorRate(), baseline.avgLatency().Milliseconds(), baseline.requests)
+
+	reason := ""
+	if canary.errorRate() > baseline.errorRate()+setting.MaxErrorRateDelta {
+		reason = "错误率超出正常渠道"
+	} else if setting.MaxLatencyRatio > 0 && baseline.requests > 0 &&
+		float64(canary.avgLatency()) > float64(baseline.avgLatency())*setting.MaxLatencyRatio {
+		reason = "平均耗时超出正常渠道"
+	}
+	if reason != "" {
+		DisableChannel(*types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, "", true), fmt.Sprintf("灰度评估未通过，%s：%s", reason, summary))
+		return
+	}
+
+	if err := model.PromoteCanaryChannel(channel.Id); err != nil {
+		common.SysLog(fmt.Sprintf("failed to promote canary channel #%d: %s", channel.Id, err.Error()))
+		return
+	}
+	model.RefreshChannelCache()
+	common.SysLog(fmt.Sprintf("canary channel #%d promoted: %s", channel.Id, summary))
+	subject := fmt.Sprintf("灰度渠道「%s」（#%d）已转为正常渠道", channel.Name, channel.Id)
+	NotifyRootUser(formatNotifyType(channel.Id, common.ChannelStatusEnabled), subject, subject+"，"+summary)
+}
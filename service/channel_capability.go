@@ -0,0 +1,206 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// capabilityUnsupportedHints 上游错误中表示不支持某项能力的措辞
+var capabilityUnsupportedHints = []string{
+	"not support", "unsupported", "does not accept", "not enabled", "only supported", "not allowed", "is not a multimodal",
+}
+
+// capabilityErrorKeywords 各项能力在上游错误信息中的关键字
+var capabilityErrorKeywords = map[string][]string{
+	model.CapabilityVision:     {"image", "vision", "multimodal"},
+	model.CapabilityTools:      {"tool", "function call", "function_call", "functions"},
+	model.CapabilityJSONSchema: {"json_schema", "response_format", "structured output", "response schema", "responseschema"},
+	model.CapabilityAudio:      {"audio"},
+	model.CapabilityStreaming:  {"stream"},
+}
+
+// contextLengthPatterns 从超出上下文的错误中提取模型的最大上下文
+var contextLengthPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`maximum context length is (\d+)`),
+	regexp.MustCompile(`context (?:length|window) (?:of|is) (\d+)`),
+	regexp.MustCompile(`prompt is too long: \d+ tokens > (\d+) maximum`),
+	regexp.MustCompile(`exceeds the maximum number of tokens allowed \((\d+)\)`),
+}
+
+func collectCapabilityContent(value gjson.Result, text *strings.Builder, required *model.RequiredCapabilities) {
+	switch {
+	case value.Type == gjson.String:
+		text.WriteString(value.String())
+		text.WriteString("\n")
+	case value.IsArray():
+		for _, item := range value.Array() {
+			collectCapabilityContent(item, text, required)
+		}
+	case value.IsObject():
+		switch value.Get("type").String() {
+		case "image_url", "image", "input_image":
+			required.Vision = true
+			return
+		case "input_audio", "audio":
+			required.Audio = true
+			return
+		}
+		// Gemini 的 parts
+		for _, key := range []string{"inline_data.mime_type", "inlineData.mimeType", "file_data.mime_type", "fileData.mimeType"} {
+			mimeType := value.Get(key).String()
+			if strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/") {
+				required.Vision = true
+			} else if strings.HasPrefix(mimeType, "audio/") {
+				required.Audio = true
+			}
+		}
+		for _, key := range []string{"text", "content", "parts"} {
+			if item := value.Get(key); item.Exists() {
+				collectCapabilityContent(item, text, required)
+			}
+		}
+	}
+}
+
+// ExtractRequiredCapabilities 从 OpenAI、Claude、Responses 与 Gemini 格式的请求体中识别需要的渠道能力
+func ExtractRequiredCapabilities(body []byte, path string, modelName string) *model.RequiredCapabilities {
+	required := &model.RequiredCapabilities{}
+	var text strings.Builder
+	for _, key := range []string{"system", "messages", "input", "prompt", "contents", "systemInstruction", "system_instruction"} {
+		collectCapabilityContent(gjson.GetBytes(body, key), &text, required)
+	}
+	required.Streaming = gjson.GetBytes(body, "stream").Bool() || strings.Contains(path, ":streamGenerateContent")
+	required.Tools = len(gjson.GetBytes(body, "tools").Array()) > 0 || len(gjson.GetBytes(body, "functions").Array()) > 0
+	required.JSONSchema = gjson.GetBytes(body, "response_format.type").String() == "json_schema" ||
+		gjson.GetBytes(body, "text.format.type").String() == "json_schema"
+	for _, key := range []string{"generationConfig.responseSchema", "generationConfig.responseJsonSchema", "generation_config.response_schema"} {
+		if gjson.GetBytes(body, key).Exists() {
+			required.JSONSchema = true
+		}
+	}
+	for _, modality := range gjson.GetBytes(body, "modalities").Array() {
+		if modality.String() == "audio" {
+			required.Audio = true
+		}
+	}
+	if gjson.GetBytes(body, "audio").IsObject() {
+		required.Audio = true
+	}
+	maxOutput := int64(0)
+	for _, key := range []string{"max_tokens", "max_completion_tokens", "max_output_tokens", "generationConfig.maxOutputTokens"} {
+		maxOutput = max(maxOutput, gjson.GetBytes(body, key).Int())
+	}
+	if prompt := EstimateTokenByModel(modelName, text.String()); prompt > 0 {
+		required.ContextTokens = prompt + int(maxOutput)
+	}
+	return required
+}
+
+// DetectRequiredCapabilities 识别本次请求需要的渠道能力并写入上下文，未开启或无法识别时返回 nil
+func DetectRequiredCapabilities(c *gin.Context, modelName string) *model.RequiredCapabilities {
+	if !operation_setting.GetChannelCapabilitySetting().Enabled || c.Request.Method != http.MethodPost {
+		return nil
+	}
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil || !gjson.ValidBytes(body) {
+		return nil
+	}
+	required := ExtractRequiredCapabilities(body, c.Request.URL.Path, modelName)
+	if required.IsEmpty() {
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeyRequiredCapabilities, required)
+	return required
+}
+
+func GetRequiredCapabilities(c *gin.Context) *model.RequiredCapabilities {
+	if c == nil {
+		return nil
+	}
+	required, _ := common.GetContextKeyType[*model.RequiredCapabilities](c, constant.ContextKeyRequiredCapabilities)
+	return required
+}
+
+func containsAny(message string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(message, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCapabilityMismatch 根据上游错误判断渠道缺少的能力，只考虑本次请求确实用到的能力
+func matchCapabilityMismatch(message string, required *model.RequiredCapabilities) *model.ChannelCapability {
+	message = strings.ToLower(message)
+	for _, pattern := range contextLengthPatterns {
+		if match := pattern.FindStringSubmatch(message); match != nil {
+			if limit, err := strconv.Atoi(match[1]); err == nil && limit > 0 {
+				return &model.ChannelCapability{MaxContext: limit}
+			}
+		}
+	}
+	if !containsAny(message, capabilityUnsupportedHints) {
+		return nil
+	}
+	unsupported := common.GetPointer(false)
+	switch {
+	case required.Vision && containsAny(message, capabilityErrorKeywords[model.CapabilityVision]):
+		return &model.ChannelCapability{Vision: unsupported}
+	case required.Audio && containsAny(message, capabilityErrorKeywords[model.CapabilityAudio]):
+		return &model.ChannelCapability{Audio: unsupported}
+	case required.JSONSchema && containsAny(message, capabilityErrorKeywords[model.CapabilityJSONSchema]):
+		return &model.ChannelCapability{JSONSchema: unsupported}
+	case required.Tools && containsAny(message, capabilityErrorKeywords[model.CapabilityTools]):
+		return &model.ChannelCapability{Tools: unsupported}
+	case required.Streaming && containsAny(message, capabilityErrorKeywords[model.CapabilityStreaming]):
+		return &model.ChannelCapability{Streaming: unsupported}
+	}
+	return nil
+}
+
+// DetectChannelCapabilityMismatch 上游因能力缺失拒绝请求时登记到能力表，返回 true 表示换用其他渠道重试可能成功
+func DetectChannelCapabilityMismatch(c *gin.Context, channelId int, modelName string, err *types.NewAPIError) bool {
+	if err == nil || !operation_setting.GetChannelCapabilitySetting().AutoDetect {
+		return false
+	}
+	switch err.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+	default:
+		return false
+	}
+	required := GetRequiredCapabilities(c)
+	if required.IsEmpty() {
+		return false
+	}
+	detected := matchCapabilityMismatch(err.Error(), required)
+	if detected == nil {
+		return false
+	}
+	recorded, recordErr := model.RecordDetectedChannelCapability(channelId, modelName, detected, err.Error())
+	if recordErr != nil {
+		logger.LogError(c, fmt.Sprintf("failed to record channel #%d capability: %s", channelId, recordErr.Error()))
+		return false
+	}
+	// 估算的 tokens 未超过登记的上下文上限时，选路无法据此排除该渠道，不再重试
+	if detected.MaxContext > 0 && detected.MaxContext >= required.ContextTokens {
+		return false
+	}
+	return recorded
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/tidwall/gjson"
+)
+
+var channelDisableRuleRegexCache sync.Map // map[string]*regexp.Regexp
+
+func getChannelDisableRuleRegex(pattern string) *regexp.Regexp {
+	if re, ok := channelDisableRuleRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	channelDisableRuleRegexCache.Store(pattern, compiled)
+	return compiled
+}
+
+// matchRuleRegex 空规则视为通配，无效正则视为不匹配
+func matchRuleRegex(pattern string, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	re := getChannelDisableRuleRegex(pattern)
+	if re == nil {
+		return false
+	}
+	return re.MatchString(s)
+}
+
+func upstreamErrorBody(err *types.NewAPIError) []byte {
+	if err.RelayError != nil {
+		if body, marshalErr := common.Marshal(err.RelayError); marshalErr == nil {
+			return body
+		}
+	}
+	return err.Metadata
+}
+
+func matchChannelDisableRule(rule *operation_setting.ChannelDisableRule, channelType int, err *types.NewAPIError) bool {
+	if len(rule.ChannelTypes) > 0 {
+		found := false
+		for _, t := range rule.ChannelTypes {
+			if t == channelType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.StatusCodes != "" {
+		ranges, parseErr := operation_setting.ParseHTTPStatusCodeRanges(rule.StatusCodes)
+		if parseErr != nil {
+			return false
+		}
+		matched := false
+		for _, r := range ranges {
+			if err.StatusCode >= r.Start && err.StatusCode <= r.End {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	oaiErr := err.ToOpenAIError()
+	if !matchRuleRegex(rule.ErrorTypeRegex, oaiErr.Type) {
+		return false
+	}
+	if !matchRuleRegex(rule.ErrorCodeRegex, fmt.Sprintf("%v", oaiErr.Code)) {
+		return false
+	}
+	if !matchRuleRegex(rule.MessageRegex, err.Error()) {
+		return false
+	}
+	if rule.JSONPath != "" {
+		result := gjson.GetBytes(upstreamErrorBody(err), rule.JSONPath)
+		if !result.Exists() {
+			return false
+		}
+		if !matchRuleRegex(rule.JSONValueRegex, result.String()) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchChannelDisableRule 按顺序评估管理员配置的渠道错误规则，返回第一条命中的规则
+func MatchChannelDisableRule(channelType int, err *types.NewAPIError) *operation_setting.ChannelDisableRule {
+	if err == nil {
+		return nil
+	}
+	setting := operation_setting.GetChannelDisableRuleSetting()
+	if setting == nil || !setting.Enabled {
+		return nil
+	}
+	for i := range setting.Rules {
+		rule := &setting.Rules[i]
+		if matchChannelDisableRule(rule, channelType, err) {
+			return rule
+		}
+	}
+	return nil
+}
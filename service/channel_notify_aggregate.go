@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+type tagDisableNotifyEntry struct {
+	ChannelId   int
+	ChannelName string
+	Reason      string
+}
+
+var (
+	tagDisableNotifyLock    sync.Mutex
+	tagDisableNotifyPending = make(map[string][]tagDisableNotifyEntry)
+)
+
+// enqueueTagDisableNotify 将渠道禁用通知放入标签聚合队列，返回 false 表示未启用聚合
+func enqueueTagDisableNotify(tag string, channelId int, channelName string, reason string) bool {
+	setting := operation_setting.GetMonitorSetting()
+	if tag == "" || !setting.DisableNotifyAggregateByTag {
+		return false
+	}
+	window := setting.DisableNotifyAggregateSeconds
+	if window <= 0 {
+		window = 60
+	}
+
+	tagDisableNotifyLock.Lock()
+	defer tagDisableNotifyLock.Unlock()
+	entries, exists := tagDisableNotifyPending[tag]
+	tagDisableNotifyPending[tag] = append(entries, tagDisableNotifyEntry{
+		ChannelId:   channelId,
+		ChannelName: channelName,
+		Reason:      reason,
+	})
+	if !exists {
+		time.AfterFunc(time.Duration(window)*time.Second, func() {
+			flushTagDisableNotify(tag)
+		})
+	}
+	return true
+}
+
+// FlushTagDisableNotifies 退出前立即发送所有尚未到期的聚合通知
+func FlushTagDisableNotifies() {
+	tagDisableNotifyLock.Lock()
+	tags := make([]string, 0, len(tagDisableNotifyPending))
+	for tag := range tagDisableNotifyPending {
+		tags = append(tags, tag)
+	}
+	tagDisableNotifyLock.Unlock()
+	for _, tag := range tags {
+		flushTagDisableNotify(tag)
+	}
+}
+
+func flushTagDisableNotify(tag string) {
+	tagDisableNotifyLock.Lock()
+	entries := tagDisableNotifyPending[tag]
+	delete(tagDisableNotifyPending, tag)
+	tagDisableNotifyLock.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	var builder strings.Builder
+	for _, entry := range entries {
+		builder.WriteString(fmt.Sprintf("通道「%s」（#%d），原因：%s\n", entry.ChannelName, entry.ChannelId, entry.Reason))
+	}
+	subject := fmt.Sprintf("标签「%s」下 %d 个通道已被禁用", tag, len(entries))
+	common.SysLog(subject)
+	NotifyRootUser(fmt.Sprintf("%s_tag_%s", dto.NotifyTypeChannelUpdate, tag), subject, builder.String())
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ProxyTestResult 代理连通性测试结果，分别记录代理本身与经代理访问目标地址的情况
+type ProxyTestResult struct {
+	ProxyReachable  bool   `json:"proxy_reachable"`
+	ProxyLatencyMs  int64  `json:"proxy_latency_ms"`
+	TargetReachable bool   `json:"target_reachable"`
+	TargetLatencyMs int64  `json:"target_latency_ms"`
+	StatusCode      int    `json:"status_code,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+func proxyHostWithPort(parsedURL *url.URL) string {
+	if parsedURL.Port() != "" {
+		return parsedURL.Host
+	}
+	port := "1080"
+	switch parsedURL.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	}
+	return net.JoinHostPort(parsedURL.Hostname(), port)
+}
+
+// TestProxyConnectivity 先直连代理端口，再经代理请求目标地址；目标返回任意 HTTP 状态码都视为可达
+func TestProxyConnectivity(ctx context.Context, proxyURL string, targetURL string) *ProxyTestResult {
+	result := &ProxyTestResult{}
+	parsedURL, err := url.Parse(proxyURL)
+	if err != nil || parsedURL.Host == "" {
+		result.Error = "代理地址格式错误"
+		return result
+	}
+
+	start := time.Now()
+	conn, err := (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, "tcp", proxyHostWithPort(parsedURL))
+	if err != nil {
+		result.Error = fmt.Sprintf("无法连接代理服务器: %s", err.Error())
+		return result
+	}
+	_ = conn.Close()
+	result.ProxyReachable = true
+	result.ProxyLatencyMs = time.Since(start).Milliseconds()
+
+	client, err := NewProxyHttpClient(proxyURL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("目标地址格式错误: %s", err.Error())
+		return result
+	}
+	start = time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = fmt.Sprintf("经代理访问目标地址失败: %s", err.Error())
+		return result
+	}
+	_ = resp.Body.Close()
+	result.TargetReachable = true
+	result.TargetLatencyMs = time.Since(start).Milliseconds()
+	result.StatusCode = resp.StatusCode
+	return result
+}
@@ -49,6 +49,9 @@ func StartCodexCredentialAutoRefreshTask() {
 }
 
 func runCodexCredentialAutoRefreshOnce() {
+	if !model.IsLeader() {
+		return
+	}
 	if !codexCredentialRefreshRunning.CompareAndSwap(false, true) {
 		return
 	}
@@ -129,7 +132,7 @@ func runCodexCredentialAutoRefreshOnce() {
 					logger.LogWarn(ctx, fmt.Sprintf("codex credential auto-refresh: InitChannelCache panic: %v", r))
 				}
 			}()
-			model.InitChannelCache()
+			model.RefreshChannelCache()
 		}()
 		ResetProxyClientCache()
 	}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// messageGroup 截断时一起保留或丢弃的连续消息，助手的工具调用与其后的工具结果不能拆开
+type messageGroup struct {
+	start  int
+	end    int
+	tokens int
+	pinned bool // 系统消息与最后一组消息始终保留
+}
+
+func estimateMessageTokens(message dto.Message, model string) int {
+	meta := (&dto.GeneralOpenAIRequest{Messages: []dto.Message{message}}).GetTokenCountMeta()
+	return CountTextToken(meta.CombineText, model) + 3 + len(meta.Files)*520
+}
+
+func groupMessages(messages []dto.Message, model string) []messageGroup {
+	groups := make([]messageGroup, 0, len(messages))
+	for i, message := range messages {
+		tokens := estimateMessageTokens(message, model)
+		last := len(groups) - 1
+		if message.Role == "tool" && last >= 0 && !groups[last].pinned {
+			groups[last].end = i + 1
+			groups[last].tokens += tokens
+			continue
+		}
+		groups = append(groups, messageGroup{
+			start:  i,
+			end:    i + 1,
+			tokens: tokens,
+			pinned: message.Role == "system" || message.Role == "developer",
+		})
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		if !groups[i].pinned {
+			groups[i].pinned = true
+			break
+		}
+	}
+	return groups
+}
+
+// truncationOrder 返回依次尝试丢弃的消息组下标
+func truncationOrder(groups []messageGroup, strategy string) []int {
+	candidates := make([]int, 0, len(groups))
+	for i, group := range groups {
+		if !group.pinned {
+			candidates = append(candidates, i)
+		}
+	}
+	if strategy != constant.ContextTruncationMiddleOut || len(candidates) < 2 {
+		return candidates
+	}
+	// 保留第一条对话消息，从剩余消息的中间向两侧依次丢弃
+	rest := candidates[1:]
+	order := make([]int, 0, len(rest))
+	mid := len(rest) / 2
+	for offset := 0; len(order) < len(rest); offset++ {
+		if mid-offset >= 0 {
+			order = append(order, rest[mid-offset])
+		}
+		if offset > 0 && mid+offset < len(rest) {
+			order = append(order, rest[mid+offset])
+		}
+	}
+	return order
+}
+
+// truncateMessages 按策略丢弃消息直到预估 token 不超过 budget，无法满足时返回 false
+func truncateMessages(messages []dto.Message, strategy string, promptTokens int, budget int, model string) ([]dto.Message, bool) {
+	groups := groupMessages(messages, model)
+	dropped := make(map[int]bool)
+	for _, index := range truncationOrder(groups, strategy) {
+		if promptTokens <= budget {
+			break
+		}
+		dropped[index] = true
+		promptTokens -= groups[index].tokens
+	}
+	if promptTokens > budget {
+		return nil, false
+	}
+	kept := make([]dto.Message, 0, len(messages))
+	for i, group := range groups {
+		if !dropped[i] {
+			kept = append(kept, messages[group.start:group.end]...)
+		}
+	}
+	return kept, true
+}
+
+// ApplyContextLimit 预估输入加上 max_tokens 超出模型上下文窗口时，按令牌配置的策略截断对话消息，
+// 未配置策略或截断后仍超出时拒绝请求。返回截断后重新预估的输入 token 数
+func ApplyContextLimit(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request, meta *types.TokenCountMeta, promptTokens int) (int, *types.NewAPIError) {
+	window := operation_setting.GetContextLimitSetting().GetContextWindow(info.OriginModelName)
+	if window <= 0 || meta == nil || promptTokens+meta.MaxTokens <= window {
+		return promptTokens, nil
+	}
+
+	strategy := common.GetContextKeyString(c, constant.ContextKeyTokenContextTruncation)
+	textRequest, ok := request.(*dto.GeneralOpenAIRequest)
+	if strategy != "" && ok && len(textRequest.Messages) > 0 {
+		messages, fits := truncateMessages(textRequest.Messages, strategy, promptTokens, window-meta.MaxTokens, info.OriginModelName)
+		if fits {
+			originalCount := len(textRequest.Messages)
+			newAPIError := replaceRequestMessages(c, textRequest, messages)
+			if newAPIError != nil {
+				return promptTokens, newAPIError
+			}
+			tokens, err := EstimateRequestToken(c, textRequest.GetTokenCountMeta(), info)
+			if err != nil {
+				return promptTokens, types.NewError(err, types.ErrorCodeCountTokenFailed)
+			}
+			logger.LogInfo(c, fmt.Sprintf("context truncated by %s: %d -> %d messages, %d -> %d tokens", strategy, originalCount, len(messages), promptTokens, tokens))
+			return tokens, nil
+		}
+	}
+
+	return promptTokens, types.NewErrorWithStatusCode(
+		fmt.Errorf("This model's maximum context length is %d tokens. However, you requested about %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or completion.",
+			window, promptTokens+meta.MaxTokens, promptTokens, meta.MaxTokens),
+		types.ErrorCodeContextLengthExceeded, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+// replaceRequestMessages 同时更新解析后的请求与缓存的请求体，透传请求体时也使用截断后的消息
+func replaceRequestMessages(c *gin.Context, request *dto.GeneralOpenAIRequest, messages []dto.Message) *types.NewAPIError {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
+	}
+	data, err := common.Marshal(messages)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	body, err = sjson.SetRawBytes(body, "messages", data)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	if err = common.ReplaceRequestBody(c, body); err != nil {
+		return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
+	}
+	request.Messages = messages
+	return nil
+}
@@ -51,9 +51,13 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 	}
 
 	// Convert tools
-	tools, _ := common.Any2Type[[]dto.Tool](claudeRequest.Tools)
+	tools, _ := common.Any2Type[[]claudeToolDefinition](claudeRequest.Tools)
 	openAITools := make([]dto.ToolCallRequest, 0)
 	for _, claudeTool := range tools {
+		if claudeTool.Type != "" && claudeTool.Type != "custom" {
+			// web_search、bash 等服务端工具由 Anthropic 执行，OpenAI 上游无法调用
+			continue
+		}
 		openAITool := dto.ToolCallRequest{
 			Type: "function",
 			Function: dto.FunctionRequest{
@@ -65,6 +69,9 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		openAITools = append(openAITools, openAITool)
 	}
 	openAIRequest.Tools = openAITools
+	if len(openAITools) > 0 {
+		openAIRequest.ToolChoice, openAIRequest.ParallelTooCalls = toolChoiceClaude2OpenAI(claudeRequest.ToolChoice)
+	}
 
 	// Convert messages
 	openAIMessages := make([]dto.Message, 0)
@@ -135,14 +142,9 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 					}
 					mediaMessages = append(mediaMessages, message)
 				case "image":
-					// Handle image conversion (base64 to URL or keep as is)
-					imageData := fmt.Sprintf("data:%s;base64,%s", mediaMsg.Source.MediaType, mediaMsg.Source.Data)
-					//textContent += fmt.Sprintf("[Image: %s]", imageData)
-					mediaMessage := dto.MediaContent{
-						Type:     "image_url",
-						ImageUrl: &dto.MessageImageUrl{Url: imageData},
+					if mediaMessage, ok := imageClaude2OpenAI(mediaMsg.Source); ok {
+						mediaMessages = append(mediaMessages, mediaMessage)
 					}
-					mediaMessages = append(mediaMessages, mediaMessage)
 				case "tool_use":
 					toolCall := dto.ToolCallRequest{
 						ID:   mediaMsg.Id,
@@ -164,13 +166,22 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 						Name:       &toolName,
 						ToolCallId: mediaMsg.ToolUseId,
 					}
-					//oaiToolMessage.SetStringContent(*mediaMsg.GetMediaContent().Text)
 					if mediaMsg.IsStringContent() {
 						oaiToolMessage.SetStringContent(mediaMsg.GetStringContent())
 					} else {
-						mediaContents := mediaMsg.ParseMediaContent()
-						encodeJson, _ := common.Marshal(mediaContents)
-						oaiToolMessage.SetStringContent(string(encodeJson))
+						// OpenAI 的 tool 消息只支持文本，结果中的图片放入随后的 user 消息
+						var texts []string
+						for _, resultContent := range mediaMsg.ParseMediaContent() {
+							switch resultContent.Type {
+							case "text":
+								texts = append(texts, resultContent.GetText())
+							case "image":
+								if mediaMessage, ok := imageClaude2OpenAI(resultContent.Source); ok {
+									mediaMessages = append(mediaMessages, mediaMessage)
+								}
+							}
+						}
+						oaiToolMessage.SetStringContent(strings.Join(texts, "\n"))
 					}
 					openAIMessages = append(openAIMessages, oaiToolMessage)
 				}
@@ -178,9 +189,17 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 
 			if len(toolCalls) > 0 {
 				openAIMessage.SetToolCalls(toolCalls)
-			}
-
-			if len(mediaMessages) > 0 && len(toolCalls) == 0 {
+				// assistant 消息可以同时包含文本与工具调用
+				var texts []string
+				for _, mediaMessage := range mediaMessages {
+					if mediaMessage.Type == "text" && mediaMessage.Text != "" {
+						texts = append(texts, mediaMessage.Text)
+					}
+				}
+				if len(texts) > 0 {
+					openAIMessage.SetStringContent(strings.Join(texts, "\n"))
+				}
+			} else if len(mediaMessages) > 0 {
 				openAIMessage.SetMediaContent(mediaMessages)
 			}
 		}
@@ -194,6 +213,56 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 	return &openAIRequest, nil
 }
 
+// claudeToolDefinition 自定义工具的 type 为空或 custom，服务端工具带有版本化的 type
+type claudeToolDefinition struct {
+	Type string `json:"type,omitempty"`
+	dto.Tool
+}
+
+func toolChoiceClaude2OpenAI(toolChoice any) (any, *bool) {
+	choice, err := common.Any2Type[dto.ClaudeToolChoice](toolChoice)
+	if toolChoice == nil || err != nil {
+		return nil, nil
+	}
+	var parallelToolCalls *bool
+	if choice.DisableParallelToolUse {
+		parallelToolCalls = common.GetPointer(false)
+	}
+	switch choice.Type {
+	case "auto":
+		return "auto", parallelToolCalls
+	case "any":
+		return "required", parallelToolCalls
+	case "none":
+		return "none", nil
+	case "tool":
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": choice.Name},
+		}, parallelToolCalls
+	}
+	return nil, parallelToolCalls
+}
+
+func imageClaude2OpenAI(source *dto.ClaudeMessageSource) (dto.MediaContent, bool) {
+	if source == nil {
+		return dto.MediaContent{}, false
+	}
+	var url string
+	switch source.Type {
+	case "url":
+		url = source.Url
+	case "base64":
+		url = fmt.Sprintf("data:%s;base64,%v", source.MediaType, source.Data)
+	default:
+		return dto.MediaContent{}, false
+	}
+	return dto.MediaContent{
+		Type:     "image_url",
+		ImageUrl: &dto.MessageImageUrl{Url: url},
+	}, true
+}
+
 func generateStopBlock(index int) *dto.ClaudeResponse {
 	return &dto.ClaudeResponse{
 		Type:  "content_block_stop",
@@ -201,300 +270,177 @@ func generateStopBlock(index int) *dto.ClaudeResponse {
 	}
 }
 
+// startClaudeBlock 结束当前内容块并开始新的内容块，每个内容块使用递增的序号
+func startClaudeBlock(convertInfo *relaycommon.ClaudeConvertInfo, messageType string, block *dto.ClaudeMediaMessage) []*dto.ClaudeResponse {
+	var claudeResponses []*dto.ClaudeResponse
+	if convertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+		claudeResponses = append(claudeResponses, generateStopBlock(convertInfo.Index))
+		convertInfo.Index++
+	}
+	convertInfo.LastMessagesType = messageType
+	return append(claudeResponses, &dto.ClaudeResponse{
+		Index:        common.GetPointer(convertInfo.Index),
+		Type:         "content_block_start",
+		ContentBlock: block,
+	})
+}
+
+func claudeBlockDelta(index int, delta *dto.ClaudeMediaMessage) *dto.ClaudeResponse {
+	return &dto.ClaudeResponse{
+		Index: common.GetPointer(index),
+		Type:  "content_block_delta",
+		Delta: delta,
+	}
+}
+
+// StreamResponseOpenAI2Claude 转换一个 OpenAI 流式数据块，结束事件由 FinishStreamResponseOpenAI2Claude 在获得最终用量后发送
 func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
-	if info.ClaudeConvertInfo.Done {
+	convertInfo := info.ClaudeConvertInfo
+	if convertInfo.Done {
 		return nil
 	}
 
 	var claudeResponses []*dto.ClaudeResponse
-	if info.SendResponseCount == 1 {
-		msg := &dto.ClaudeMediaMessage{
-			Id:    openAIResponse.Id,
-			Model: openAIResponse.Model,
-			Type:  "message",
-			Role:  "assistant",
-			Usage: &dto.ClaudeUsage{
-				InputTokens:  info.GetEstimatePromptTokens(),
-				OutputTokens: 0,
-			},
-		}
-		msg.SetContent(make([]any, 0))
-		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-			Type:    "message_start",
-			Message: msg,
-		})
-		//claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-		//	Type: "ping",
-		//})
-		if openAIResponse.IsToolCall() {
-			info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-			var toolCall dto.ToolCallResponse
-			if len(openAIResponse.Choices) > 0 && len(openAIResponse.Choices[0].Delta.ToolCalls) > 0 {
-				toolCall = openAIResponse.Choices[0].Delta.ToolCalls[0]
-			} else {
-				first := openAIResponse.GetFirstToolCall()
-				if first != nil {
-					toolCall = *first
-				} else {
-					toolCall = dto.ToolCallResponse{}
-				}
-			}
-			resp := &dto.ClaudeResponse{
-				Type: "content_block_start",
-				ContentBlock: &dto.ClaudeMediaMessage{
-					Id:    toolCall.ID,
-					Type:  "tool_use",
-					Name:  toolCall.Function.Name,
-					Input: map[string]interface{}{},
-				},
-			}
-			resp.SetIndex(0)
-			claudeResponses = append(claudeResponses, resp)
-			// 首块包含工具 delta，则追加 input_json_delta
-			if toolCall.Function.Arguments != "" {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &info.ClaudeConvertInfo.Index,
-					Type:  "content_block_delta",
-					Delta: &dto.ClaudeMediaMessage{
-						Type:        "input_json_delta",
-						PartialJson: &toolCall.Function.Arguments,
-					},
-				})
-			}
-		} else {
-
-		}
-		// 判断首个响应是否存在内容（非标准的 OpenAI 响应）
-		if len(openAIResponse.Choices) > 0 {
-			reasoning := openAIResponse.Choices[0].Delta.GetReasoningContent()
-			content := openAIResponse.Choices[0].Delta.GetContentString()
-
-			if reasoning != "" {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &info.ClaudeConvertInfo.Index,
-					Type:  "content_block_start",
-					ContentBlock: &dto.ClaudeMediaMessage{
-						Type:     "thinking",
-						Thinking: common.GetPointer[string](""),
-					},
-				})
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &info.ClaudeConvertInfo.Index,
-					Type:  "content_block_delta",
-					Delta: &dto.ClaudeMediaMessage{
-						Type:     "thinking_delta",
-						Thinking: &reasoning,
-					},
-				})
-				info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeThinking
-			} else if content != "" {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &info.ClaudeConvertInfo.Index,
-					Type:  "content_block_start",
-					ContentBlock: &dto.ClaudeMediaMessage{
-						Type: "text",
-						Text: common.GetPointer[string](""),
-					},
-				})
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &info.ClaudeConvertInfo.Index,
-					Type:  "content_block_delta",
-					Delta: &dto.ClaudeMediaMessage{
-						Type: "text_delta",
-						Text: common.GetPointer[string](content),
-					},
-				})
-				info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-			}
-		}
-
-		// 如果首块就带 finish_reason，需要立即发送停止块
-		if len(openAIResponse.Choices) > 0 && openAIResponse.Choices[0].FinishReason != nil && *openAIResponse.Choices[0].FinishReason != "" {
-			info.FinishReason = *openAIResponse.Choices[0].FinishReason
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-			oaiUsage := openAIResponse.Usage
-			if oaiUsage == nil {
-				oaiUsage = info.ClaudeConvertInfo.Usage
-			}
-			if oaiUsage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
-			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-			info.ClaudeConvertInfo.Done = true
-		}
-		return claudeResponses
+	if !convertInfo.Started {
+		claudeResponses = append(claudeResponses, startClaudeMessage(openAIResponse, info))
 	}
-
 	if len(openAIResponse.Choices) == 0 {
-		// no choices
-		// 可能为非标准的 OpenAI 响应，判断是否已经完成
-		if info.ClaudeConvertInfo.Done {
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-			oaiUsage := info.ClaudeConvertInfo.Usage
-			if oaiUsage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
-			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-		}
 		return claudeResponses
-	} else {
-		chosenChoice := openAIResponse.Choices[0]
-		doneChunk := chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != ""
-		if doneChunk {
-			info.FinishReason = *chosenChoice.FinishReason
-		}
-
-		var claudeResponse dto.ClaudeResponse
-		var isEmpty bool
-		claudeResponse.Type = "content_block_delta"
-		if len(chosenChoice.Delta.ToolCalls) > 0 {
-			toolCalls := chosenChoice.Delta.ToolCalls
-			if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools {
-				claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-				info.ClaudeConvertInfo.Index++
-			}
-			info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-
-			for i, toolCall := range toolCalls {
-				blockIndex := info.ClaudeConvertInfo.Index
-				if toolCall.Index != nil {
-					blockIndex = *toolCall.Index
-				} else if len(toolCalls) > 1 {
-					blockIndex = info.ClaudeConvertInfo.Index + i
-				}
-
-				idx := blockIndex
-				if toolCall.Function.Name != "" {
-					claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-						Index: &idx,
-						Type:  "content_block_start",
-						ContentBlock: &dto.ClaudeMediaMessage{
-							Id:    toolCall.ID,
-							Type:  "tool_use",
-							Name:  toolCall.Function.Name,
-							Input: map[string]interface{}{},
-						},
-					})
-				}
-
-				if len(toolCall.Function.Arguments) > 0 {
-					claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-						Index: &idx,
-						Type:  "content_block_delta",
-						Delta: &dto.ClaudeMediaMessage{
-							Type:        "input_json_delta",
-							PartialJson: &toolCall.Function.Arguments,
-						},
-					})
-				}
+	}
 
-				info.ClaudeConvertInfo.Index = blockIndex
+	choice := openAIResponse.Choices[0]
+	if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+		if convertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
+			claudeResponses = append(claudeResponses, startClaudeBlock(convertInfo, relaycommon.LastMessageTypeThinking, &dto.ClaudeMediaMessage{
+				Type:     "thinking",
+				Thinking: common.GetPointer[string](""),
+			})...)
+		}
+		claudeResponses = append(claudeResponses, claudeBlockDelta(convertInfo.Index, &dto.ClaudeMediaMessage{
+			Type:     "thinking_delta",
+			Thinking: &reasoning,
+		}))
+	}
+	if content := choice.Delta.GetContentString(); content != "" {
+		if convertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
+			claudeResponses = append(claudeResponses, startClaudeBlock(convertInfo, relaycommon.LastMessageTypeText, &dto.ClaudeMediaMessage{
+				Type: "text",
+				Text: common.GetPointer[string](""),
+			})...)
+		}
+		claudeResponses = append(claudeResponses, claudeBlockDelta(convertInfo.Index, &dto.ClaudeMediaMessage{
+			Type: "text_delta",
+			Text: &content,
+		}))
+	}
+	for i, toolCall := range choice.Delta.ToolCalls {
+		// 同一个工具调用的参数分多个数据块返回，按 OpenAI 的 index 归入同一个 tool_use 内容块
+		toolIndex := i
+		if toolCall.Index != nil {
+			toolIndex = *toolCall.Index
+		} else if toolCall.ID == "" && toolCall.Function.Name == "" && convertInfo.LastMessagesType == relaycommon.LastMessageTypeTools {
+			toolIndex = convertInfo.ToolIndex
+		}
+		blockIndex, ok := convertInfo.ToolBlocks[toolIndex]
+		if !ok {
+			id := toolCall.ID
+			if id == "" {
+				id = "toolu_" + common.GetUUID()
 			}
-		} else {
-			reasoning := chosenChoice.Delta.GetReasoningContent()
-			textContent := chosenChoice.Delta.GetContentString()
-			if reasoning != "" || textContent != "" {
-				if reasoning != "" {
-					if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
-						claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-							Index: &info.ClaudeConvertInfo.Index,
-							Type:  "content_block_start",
-							ContentBlock: &dto.ClaudeMediaMessage{
-								Type:     "thinking",
-								Thinking: common.GetPointer[string](""),
-							},
-						})
-					}
-					info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeThinking
-					claudeResponse.Delta = &dto.ClaudeMediaMessage{
-						Type:     "thinking_delta",
-						Thinking: &reasoning,
-					}
-				} else {
-					if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
-						if info.ClaudeConvertInfo.LastMessagesType == relaycommon.LastMessageTypeThinking || info.ClaudeConvertInfo.LastMessagesType == relaycommon.LastMessageTypeTools {
-							claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-							info.ClaudeConvertInfo.Index++
-						}
-						claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-							Index: &info.ClaudeConvertInfo.Index,
-							Type:  "content_block_start",
-							ContentBlock: &dto.ClaudeMediaMessage{
-								Type: "text",
-								Text: common.GetPointer[string](""),
-							},
-						})
-					}
-					info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-					claudeResponse.Delta = &dto.ClaudeMediaMessage{
-						Type: "text_delta",
-						Text: common.GetPointer[string](textContent),
-					}
-				}
-			} else {
-				isEmpty = true
+			claudeResponses = append(claudeResponses, startClaudeBlock(convertInfo, relaycommon.LastMessageTypeTools, &dto.ClaudeMediaMessage{
+				Id:    id,
+				Type:  "tool_use",
+				Name:  toolCall.Function.Name,
+				Input: map[string]interface{}{},
+			})...)
+			blockIndex = convertInfo.Index
+			if convertInfo.ToolBlocks == nil {
+				convertInfo.ToolBlocks = make(map[int]int)
 			}
+			convertInfo.ToolBlocks[toolIndex] = blockIndex
 		}
-
-		claudeResponse.Index = &info.ClaudeConvertInfo.Index
-		if !isEmpty && claudeResponse.Delta != nil {
-			claudeResponses = append(claudeResponses, &claudeResponse)
+		convertInfo.ToolIndex = toolIndex
+		if toolCall.Function.Arguments != "" {
+			arguments := toolCall.Function.Arguments
+			claudeResponses = append(claudeResponses, claudeBlockDelta(blockIndex, &dto.ClaudeMediaMessage{
+				Type:        "input_json_delta",
+				PartialJson: &arguments,
+			}))
 		}
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		info.FinishReason = *choice.FinishReason
+	}
+	return claudeResponses
+}
 
-		if doneChunk || info.ClaudeConvertInfo.Done {
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-			oaiUsage := openAIResponse.Usage
-			if oaiUsage == nil {
-				oaiUsage = info.ClaudeConvertInfo.Usage
-			}
-			if oaiUsage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
-			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-			info.ClaudeConvertInfo.Done = true
-			return claudeResponses
-		}
+func startClaudeMessage(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) *dto.ClaudeResponse {
+	info.ClaudeConvertInfo.Started = true
+	msg := &dto.ClaudeMediaMessage{
+		Id:    openAIResponse.Id,
+		Model: openAIResponse.Model,
+		Type:  "message",
+		Role:  "assistant",
+		Usage: &dto.ClaudeUsage{
+			InputTokens:  info.GetEstimatePromptTokens(),
+			OutputTokens: 0,
+		},
+	}
+	if msg.Model == "" {
+		msg.Model = info.UpstreamModelName
 	}
+	msg.SetContent(make([]any, 0))
+	return &dto.ClaudeResponse{
+		Type:    "message_start",
+		Message: msg,
+	}
+}
 
+// FinishStreamResponseOpenAI2Claude 结束最后一个内容块，发送包含用量与停止原因的 message_delta 与 message_stop
+func FinishStreamResponseOpenAI2Claude(info *relaycommon.RelayInfo, usage *dto.Usage) []*dto.ClaudeResponse {
+	convertInfo := info.ClaudeConvertInfo
+	if convertInfo.Done {
+		return nil
+	}
+	var claudeResponses []*dto.ClaudeResponse
+	if !convertInfo.Started {
+		claudeResponses = append(claudeResponses, startClaudeMessage(&dto.ChatCompletionsStreamResponse{}, info))
+	}
+	if convertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+		claudeResponses = append(claudeResponses, generateStopBlock(convertInfo.Index))
+		convertInfo.LastMessagesType = relaycommon.LastMessageTypeNone
+	}
+
+	stopReason := stopReasonOpenAI2Claude(info.FinishReason)
+	if stopReason == "" || (stopReason == "end_turn" && len(convertInfo.ToolBlocks) > 0) {
+		// 部分上游返回工具调用时 finish_reason 为 stop 或为空
+		stopReason = "end_turn"
+		if len(convertInfo.ToolBlocks) > 0 {
+			stopReason = "tool_use"
+		}
+	}
+	if usage == nil {
+		usage = convertInfo.Usage
+	}
+	claudeUsage := &dto.ClaudeUsage{}
+	if usage != nil {
+		claudeUsage = &dto.ClaudeUsage{
+			InputTokens:              usage.PromptTokens,
+			OutputTokens:             usage.CompletionTokens,
+			CacheCreationInputTokens: usage.PromptTokensDetails.CachedCreationTokens,
+			CacheReadInputTokens:     usage.PromptTokensDetails.CachedTokens,
+		}
+	}
+	claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+		Type:  "message_delta",
+		Usage: claudeUsage,
+		Delta: &dto.ClaudeMediaMessage{
+			StopReason: &stopReason,
+		},
+	}, &dto.ClaudeResponse{
+		Type: "message_stop",
+	})
+	convertInfo.Done = true
 	return claudeResponses
 }
 
@@ -509,26 +455,25 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 	}
 	for _, choice := range openAIResponse.Choices {
 		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
-		if choice.FinishReason == "tool_calls" {
-			for _, toolUse := range choice.Message.ParseToolCalls() {
-				claudeContent := dto.ClaudeMediaMessage{}
-				claudeContent.Type = "tool_use"
-				claudeContent.Id = toolUse.ID
-				claudeContent.Name = toolUse.Function.Name
-				var mapParams map[string]interface{}
-				if err := common.Unmarshal([]byte(toolUse.Function.Arguments), &mapParams); err == nil {
-					claudeContent.Input = mapParams
-				} else {
-					claudeContent.Input = toolUse.Function.Arguments
-				}
-				contents = append(contents, claudeContent)
-			}
-		} else {
+		// 部分上游在 finish_reason 为 stop 时也会返回工具调用，文本与工具调用都需要保留
+		toolCalls := choice.Message.ParseToolCalls()
+		if text := choice.Message.StringContent(); text != "" || len(toolCalls) == 0 {
 			claudeContent := dto.ClaudeMediaMessage{}
 			claudeContent.Type = "text"
-			claudeContent.SetText(choice.Message.StringContent())
+			claudeContent.SetText(text)
 			contents = append(contents, claudeContent)
 		}
+		for _, toolUse := range toolCalls {
+			claudeContent := dto.ClaudeMediaMessage{}
+			claudeContent.Type = "tool_use"
+			claudeContent.Id = toolUse.ID
+			claudeContent.Name = toolUse.Function.Name
+			claudeContent.Input = ParseToolArguments(toolUse.Function.Arguments)
+			contents = append(contents, claudeContent)
+		}
+		if len(toolCalls) > 0 && (stopReason == "" || stopReason == "end_turn") {
+			stopReason = "tool_use"
+		}
 	}
 	claudeResponse.Content = contents
 	claudeResponse.StopReason = stopReason
@@ -552,6 +497,118 @@ func toJSONString(v interface{}) string {
 	return string(b)
 }
 
+// ParseToolArguments 将 OpenAI 工具调用的参数转换为 Claude tool_use 的 input。
+// 输出被截断时参数可能是不完整的 JSON，尝试补全后解析，仍然失败时返回空对象
+func ParseToolArguments(arguments string) map[string]any {
+	input := make(map[string]any)
+	if strings.TrimSpace(arguments) == "" {
+		return input
+	}
+	if err := common.UnmarshalJsonStr(arguments, &input); err == nil {
+		return input
+	}
+	if repaired, ok := RepairPartialJSON(arguments); ok {
+		input = make(map[string]any)
+		if err := common.UnmarshalJsonStr(repaired, &input); err == nil {
+			return input
+		}
+	}
+	return make(map[string]any)
+}
+
+// RepairPartialJSON 补全被截断的 JSON：闭合未结束的字符串、对象与数组，
+// 无法补全最后一个值时回退到前一个完整的成员
+func RepairPartialJSON(s string) (string, bool) {
+	// 结构性逗号与左括号的位置，作为回退点
+	var cuts []int
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+		switch ch {
+		case '"':
+			inString = true
+		case ',':
+			cuts = append(cuts, i)
+		case '{', '[':
+			cuts = append(cuts, i+1)
+		}
+	}
+	if candidate := closeJSON(s); json.Valid([]byte(candidate)) {
+		return candidate, true
+	}
+	for i := len(cuts) - 1; i >= 0; i-- {
+		if candidate := closeJSON(s[:cuts[i]]); json.Valid([]byte(candidate)) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// closeJSON 按未闭合的顺序补全字符串与括号
+func closeJSON(s string) string {
+	var stack []byte
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+		switch ch {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	var b strings.Builder
+	b.WriteString(s)
+	if inString {
+		if escaped {
+			// 丢弃未完成的转义符
+			trimmed := b.String()[:b.Len()-1]
+			b.Reset()
+			b.WriteString(trimmed)
+		}
+		b.WriteByte('"')
+	}
+	result := strings.TrimRight(b.String(), " \t\r\n")
+	switch {
+	case strings.HasSuffix(result, ","):
+		result = strings.TrimSuffix(result, ",")
+	case strings.HasSuffix(result, ":"):
+		result += "null"
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		result += string(stack[i])
+	}
+	return result
+}
+
 func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
 	openaiRequest := &dto.GeneralOpenAIRequest{
 		Model:  info.UpstreamModelName,
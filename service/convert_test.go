@@ -0,0 +1,252 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+func TestParseToolArgumentsPartialJSON(t *testing.T) {
+	cases := []struct {
+		arguments string
+		expected  string
+	}{
+		{``, `{}`},
+		{`{"city":"Paris","days":3}`, `{"city":"Paris","days":3}`},
+		{`{"city":"Par`, `{"city":"Par"}`},
+		{`{"city":"Paris",`, `{"city":"Paris"}`},
+		{`{"city":"Paris","days":`, `{"city":"Paris","days":null}`},
+		{`{"city":"Paris","da`, `{"city":"Paris"}`},
+		{`{"city":"Paris","days":tr`, `{"city":"Paris"}`},
+		{`{"path":"C:\`, `{"path":"C:"}`},
+		{`{"tags":["a","b`, `{"tags":["a","b"]}`},
+		{`{"filter":{"from":1,"to":[2,3`, `{"filter":{"from":1,"to":[2,3]}}`},
+		{`not json`, `{}`},
+		{`["a"]`, `{}`},
+	}
+	for _, tc := range cases {
+		got, _ := json.Marshal(ParseToolArguments(tc.arguments))
+		assertJSONEqual(t, tc.expected, string(got))
+	}
+}
+
+func TestClaudeToOpenAIRequestToolsAndImages(t *testing.T) {
+	body := `{
+		"model": "claude-sonnet",
+		"max_tokens": 1024,
+		"tools": [
+			{"name": "get_weather", "description": "weather", "input_schema": {"type": "object"}},
+			{"type": "web_search_20250305", "name": "web_search"}
+		],
+		"tool_choice": {"type": "any", "disable_parallel_tool_use": true},
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "what is this?"},
+				{"type": "image", "source": {"type": "url", "url": "https://example.com/a.png"}}
+			]},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": [
+					{"type": "text", "text": "sunny"},
+					{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AAAA"}}
+				]}
+			]}
+		]
+	}`
+	var claudeRequest dto.ClaudeRequest
+	if err := common.UnmarshalJsonStr(body, &claudeRequest); err != nil {
+		t.Fatal(err)
+	}
+	request, err := ClaudeToOpenAIRequest(claudeRequest, &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(request.Tools) != 1 || request.Tools[0].Function.Name != "get_weather" {
+		t.Fatalf("server tools should be skipped, got %+v", request.Tools)
+	}
+	if request.ToolChoice != "required" || request.ParallelTooCalls == nil || *request.ParallelTooCalls {
+		t.Fatalf("unexpected tool choice %v / %v", request.ToolChoice, request.ParallelTooCalls)
+	}
+	if len(request.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(request.Messages))
+	}
+
+	user := request.Messages[0].ParseContent()
+	if len(user) != 2 || user[1].GetImageMedia().Url != "https://example.com/a.png" {
+		t.Fatalf("unexpected user content %+v", user)
+	}
+
+	assistant := request.Messages[1]
+	if assistant.StringContent() != "Let me check." {
+		t.Fatalf("assistant text should be kept with tool calls, got %q", assistant.StringContent())
+	}
+	toolCalls := assistant.ParseToolCalls()
+	if len(toolCalls) != 1 || toolCalls[0].ID != "toolu_1" || toolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("unexpected tool calls %+v", toolCalls)
+	}
+
+	tool := request.Messages[2]
+	if tool.Role != "tool" || tool.ToolCallId != "toolu_1" || tool.StringContent() != "sunny" {
+		t.Fatalf("unexpected tool message %+v", tool)
+	}
+	images := request.Messages[3].ParseContent()
+	if request.Messages[3].Role != "user" || len(images) != 1 || images[0].GetImageMedia().Url != "data:image/png;base64,AAAA" {
+		t.Fatalf("tool result image should follow as user message, got %+v", request.Messages[3])
+	}
+}
+
+func newClaudeStreamInfo() *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gpt"},
+		ClaudeConvertInfo: &relaycommon.ClaudeConvertInfo{
+			LastMessagesType: relaycommon.LastMessageTypeNone,
+		},
+	}
+}
+
+func convertOpenAIStream(t *testing.T, info *relaycommon.RelayInfo, chunks []string, usage *dto.Usage) []*dto.ClaudeResponse {
+	t.Helper()
+	var events []*dto.ClaudeResponse
+	for _, chunk := range chunks {
+		var streamResponse dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(chunk, &streamResponse); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, StreamResponseOpenAI2Claude(&streamResponse, info)...)
+	}
+	return append(events, FinishStreamResponseOpenAI2Claude(info, usage)...)
+}
+
+func describeClaudeEvents(events []*dto.ClaudeResponse) []string {
+	described := make([]string, 0, len(events))
+	for _, event := range events {
+		item := event.Type
+		if event.Index != nil {
+			item += ":" + string(rune('0'+*event.Index))
+		}
+		if event.ContentBlock != nil {
+			item += ":" + event.ContentBlock.Type
+		}
+		if event.Delta != nil && event.Delta.PartialJson != nil {
+			item += ":" + *event.Delta.PartialJson
+		}
+		described = append(described, item)
+	}
+	return described
+}
+
+func TestStreamResponseOpenAI2ClaudeToolCalls(t *testing.T) {
+	info := newClaudeStreamInfo()
+	chunks := []string{
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"role":"assistant","content":"Checking"}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+	}
+	events := convertOpenAIStream(t, info, chunks, &dto.Usage{PromptTokens: 10, CompletionTokens: 5})
+
+	expected := []string{
+		"message_start",
+		"content_block_start:0:text",
+		"content_block_delta:0",
+		"content_block_stop:0",
+		"content_block_start:1:tool_use",
+		`content_block_delta:1:{"city":`,
+		`content_block_delta:1:"Paris"}`,
+		"content_block_stop:1",
+		"content_block_start:2:tool_use",
+		"content_block_delta:2:{}",
+		"content_block_stop:2",
+		"message_delta",
+		"message_stop",
+	}
+	if got := describeClaudeEvents(events); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected events:\n%s", strings.Join(got, "\n"))
+	}
+	messageDelta := events[len(events)-2]
+	if *messageDelta.Delta.StopReason != "tool_use" || messageDelta.Usage.OutputTokens != 5 {
+		t.Fatalf("unexpected message_delta %+v %+v", messageDelta.Delta, messageDelta.Usage)
+	}
+	if events[4].ContentBlock.Id != "call_a" || events[8].ContentBlock.Name != "get_time" {
+		t.Fatalf("unexpected tool blocks %+v %+v", events[4].ContentBlock, events[8].ContentBlock)
+	}
+}
+
+func TestStreamResponseOpenAI2ClaudeReasoningAndText(t *testing.T) {
+	info := newClaudeStreamInfo()
+	chunks := []string{
+		`{"choices":[{"index":0,"delta":{"reasoning_content":"think"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"answer"},"finish_reason":"stop"}]}`,
+	}
+	events := convertOpenAIStream(t, info, chunks, nil)
+
+	expected := []string{
+		"message_start",
+		"content_block_start:0:thinking",
+		"content_block_delta:0",
+		"content_block_stop:0",
+		"content_block_start:1:text",
+		"content_block_delta:1",
+		"content_block_stop:1",
+		"message_delta",
+		"message_stop",
+	}
+	if got := describeClaudeEvents(events); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected events:\n%s", strings.Join(got, "\n"))
+	}
+	if *events[len(events)-2].Delta.StopReason != "end_turn" {
+		t.Fatalf("unexpected stop reason %s", *events[len(events)-2].Delta.StopReason)
+	}
+	if FinishStreamResponseOpenAI2Claude(info, nil) != nil {
+		t.Fatal("finish should only run once")
+	}
+}
+
+func TestResponseOpenAI2ClaudeTextAndToolCalls(t *testing.T) {
+	body := `{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"Checking","tool_calls":[{"id":"call_a","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Par"}}]}}],"usage":{"prompt_tokens":3,"completion_tokens":4}}`
+	var response dto.OpenAITextResponse
+	if err := common.UnmarshalJsonStr(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	claudeResponse := ResponseOpenAI2Claude(&response, &relaycommon.RelayInfo{})
+
+	contents := claudeResponse.Content
+	if len(contents) != 2 {
+		t.Fatalf("expected text and tool_use blocks, got %+v", claudeResponse.Content)
+	}
+	if contents[0].GetText() != "Checking" || contents[1].Type != "tool_use" {
+		t.Fatalf("unexpected contents %+v", contents)
+	}
+	if !reflect.DeepEqual(contents[1].Input, map[string]any{"city": "Par"}) {
+		t.Fatalf("unexpected tool input %+v", contents[1].Input)
+	}
+	if claudeResponse.StopReason != "tool_use" {
+		t.Fatalf("unexpected stop reason %s", claudeResponse.StopReason)
+	}
+}
+
+func assertJSONEqual(t *testing.T, expected, actual string) {
+	t.Helper()
+	var expectedValue, actualValue any
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Fatalf("invalid expected JSON %s: %v", expected, err)
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		t.Fatalf("invalid actual JSON %s: %v", actual, err)
+	}
+	if !reflect.DeepEqual(expectedValue, actualValue) {
+		t.Fatalf("JSON mismatch\nexpected: %s\nactual:   %s", expected, actual)
+	}
+}
@@ -0,0 +1,412 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const (
+	UpstreamProviderOpenAI    = "openai"
+	UpstreamProviderAnthropic = "anthropic"
+	UpstreamProviderAzure     = "azure"
+)
+
+// 差额低于该值（美元）时不标记，避免舍入误差产生大量噪音
+const reconciliationMinDifference = 0.01
+
+// upstreamExportColumns 账单导出文件中日期、模型与费用列的候选列名，列名比较时忽略大小写与非字母数字字符
+type upstreamExportColumns struct {
+	date     []string
+	model    []string
+	cost     []string
+	currency []string // 费用列的币种，列名以 usd 结尾的费用列不换算
+}
+
+var upstreamExportFormats = map[string]upstreamExportColumns{
+	// OpenAI 控制台 Usage / Costs 导出
+	UpstreamProviderOpenAI: {
+		date:  []string{"date", "starttime", "starttimeiso", "timestamp"},
+		model: []string{"model", "snapshotid", "lineitem"},
+		cost:  []string{"costusd", "cost", "amountvalue", "amount"},
+	},
+	// Anthropic Console 用量与费用导出
+	UpstreamProviderAnthropic: {
+		date:  []string{"usagedateutc", "date", "startingat"},
+		model: []string{"model", "modelversion"},
+		cost:  []string{"costusd", "cost", "amount"},
+	},
+	// Azure Cost Management 导出，模型取自计量名称
+	UpstreamProviderAzure: {
+		date:     []string{"date", "usagedate", "billingperiodstartdate"},
+		model:    []string{"metername", "meter", "metersubcategory", "productname"},
+		cost:     []string{"costinusd", "costinbillingcurrency", "pretaxcost", "cost"},
+		currency: []string{"billingcurrency", "billingcurrencycode", "currency"},
+	},
+}
+
+var upstreamDateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 MST",
+	"01/02/2006",
+	"1/2/2006",
+	"01/02/2006 15:04:05",
+}
+
+// UpstreamCostRow 上游账单中的一行费用
+type UpstreamCostRow struct {
+	Time  time.Time
+	Model string
+	Cost  float64
+}
+
+// ReconciliationLine 单个模型的对账结果，ExpectedCost 按当前的模型倍率/价格配置估算，
+// ChannelCost 为 ExpectedCost 乘以渠道成本比例，与上游费用比较的是 ChannelCost
+type ReconciliationLine struct {
+	ModelName         string   `json:"model_name"`
+	UpstreamModels    []string `json:"upstream_models"`
+	Requests          int      `json:"requests"`
+	PromptTokens      int64    `json:"prompt_tokens"`
+	CompletionTokens  int64    `json:"completion_tokens"`
+	BilledAmount      float64  `json:"billed_amount"`
+	ExpectedCost      float64  `json:"expected_cost"`
+	ChannelCost       float64  `json:"channel_cost"`
+	UpstreamCost      float64  `json:"upstream_cost"`
+	Difference        float64  `json:"difference"`
+	DifferencePercent float64  `json:"difference_percent"`
+	Flagged           bool     `json:"flagged"`
+}
+
+// ReconciliationReport 渠道在一段时间内上游实际费用与本站记录用量的对账报告
+type ReconciliationReport struct {
+	ChannelId    int                   `json:"channel_id"`
+	ChannelName  string                `json:"channel_name"`
+	Provider     string                `json:"provider"`
+	StartTime    int64                 `json:"start_time"`
+	EndTime      int64                 `json:"end_time"`
+	Threshold    float64               `json:"threshold"`
+	Rows         int                   `json:"rows"`
+	SkippedRows  int                   `json:"skipped_rows"`
+	Lines        []*ReconciliationLine `json:"lines"`
+	Total        *ReconciliationLine   `json:"total"`
+	FlaggedLines int                   `json:"flagged_lines"`
+	GeneratedAt  int64                 `json:"generated_at"`
+}
+
+func normalizeExportHeader(header string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(header) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func findExportColumn(index map[string]int, candidates []string) int {
+	for _, candidate := range candidates {
+		if i, ok := index[candidate]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseUpstreamTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(ts, 0), true
+	}
+	for _, layout := range upstreamDateLayouts {
+		// 账单导出一般使用 UTC
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseUpstreamCost(value string) (float64, bool) {
+	value = strings.NewReplacer("$", "", ",", "", " ", "").Replace(strings.TrimSpace(value))
+	if value == "" {
+		return 0, false
+	}
+	cost, err := strconv.ParseFloat(value, 64)
+	return cost, err == nil
+}
+
+// ParseUpstreamCostExport 解析服务商的账单导出 CSV，返回有效行与跳过的行数
+func ParseUpstreamCostExport(provider string, reader io.Reader) ([]UpstreamCostRow, int, error) {
+	format, ok := upstreamExportFormats[provider]
+	if !ok {
+		return nil, 0, fmt.Errorf("不支持的服务商：%s", provider)
+	}
+	r := csv.NewReader(reader)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, 0, errors.New("无法读取 CSV 表头")
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[normalizeExportHeader(strings.TrimPrefix(name, "\xEF\xBB\xBF"))] = i
+	}
+	dateCol := findExportColumn(index, format.date)
+	modelCol := findExportColumn(index, format.model)
+	costCol := findExportColumn(index, format.cost)
+	if dateCol < 0 || modelCol < 0 || costCol < 0 {
+		return nil, 0, errors.New("CSV 缺少日期、模型或费用列，请确认导出格式与服务商一致")
+	}
+	currencyCol := -1
+	if !strings.HasSuffix(normalizeExportHeader(header[costCol]), "usd") {
+		currencyCol = findExportColumn(index, format.currency)
+	}
+
+	var rows []UpstreamCostRow
+	skipped := 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if max(dateCol, modelCol, costCol) >= len(record) {
+			skipped++
+			continue
+		}
+		t, okTime := parseUpstreamTime(record[dateCol])
+		cost, okCost := parseUpstreamCost(record[costCol])
+		modelName := strings.TrimSpace(record[modelCol])
+		if !okTime || !okCost || modelName == "" {
+			skipped++
+			continue
+		}
+		if currencyCol >= 0 && currencyCol < len(record) {
+			// 按账单币种换算为美元，无法换算的行跳过
+			if currency := strings.TrimSpace(record[currencyCol]); currency != "" {
+				rate, ok := operation_setting.GetCurrencySetting().GetRate(currency)
+				if !ok {
+					skipped++
+					continue
+				}
+				cost /= rate
+			}
+		}
+		rows = append(rows, UpstreamCostRow{Time: t, Model: modelName, Cost: cost})
+	}
+	return rows, skipped, nil
+}
+
+func normalizeReconcileModel(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "-")
+}
+
+// matchReconcileModel 将上游的模型或计量名称匹配到本站日志中的模型，完全一致优先，否则取最长的前缀匹配
+func matchReconcileModel(upstream string, logged []string) string {
+	name := normalizeReconcileModel(upstream)
+	best, bestLen := "", 0
+	for _, candidate := range logged {
+		normalized := normalizeReconcileModel(candidate)
+		if normalized == name {
+			return candidate
+		}
+		if strings.HasPrefix(name, normalized) && len(normalized) > bestLen {
+			best, bestLen = candidate, len(normalized)
+		}
+	}
+	return best
+}
+
+func expectedUsageCost(item *StatementUsageItem) float64 {
+	if item.QuotaType == 1 {
+		return float64(item.Requests) * item.ModelPrice
+	}
+	return (float64(item.PromptTokens)*item.InputPricePerM + float64(item.CompletionTokens)*item.OutputPricePerM) / 1e6
+}
+
+func (line *ReconciliationLine) evaluate(threshold float64) {
+	line.Difference = line.UpstreamCost - line.ChannelCost
+	switch {
+	case line.ChannelCost > 0:
+		line.DifferencePercent = line.Difference * 100 / line.ChannelCost
+	case line.UpstreamCost > 0:
+		line.DifferencePercent = 100
+	}
+	line.Flagged = math.Abs(line.Difference) >= reconciliationMinDifference && math.Abs(line.DifferencePercent) > threshold
+}
+
+// ReconcileChannelCost 将上游账单与渠道在 [start, end) 内的消费日志按模型对账，
+// start 与 end 为 0 时使用账单中的日期范围
+func ReconcileChannelCost(channel *model.Channel, provider string, rows []UpstreamCostRow, skipped int, start int64, end int64, threshold float64) (*ReconciliationReport, error) {
+	if len(rows) == 0 {
+		return nil, errors.New("账单中没有可用的费用记录")
+	}
+	if start == 0 || end == 0 {
+		minTime, maxTime := rows[0].Time, rows[0].Time
+		for _, row := range rows {
+			if row.Time.Before(minTime) {
+				minTime = row.Time
+			}
+			if row.Time.After(maxTime) {
+				maxTime = row.Time
+			}
+		}
+		if start == 0 {
+			start = time.Date(minTime.Year(), minTime.Month(), minTime.Day(), 0, 0, 0, 0, minTime.Location()).Unix()
+		}
+		if end == 0 {
+			end = time.Date(maxTime.Year(), maxTime.Month(), maxTime.Day(), 0, 0, 0, 0, maxTime.Location()).AddDate(0, 0, 1).Unix()
+		}
+	}
+	if end <= start {
+		return nil, errors.New("结束时间必须晚于开始时间")
+	}
+
+	usage, err := model.GetChannelUsageByModel(channel.Id, start, end)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconciliationReport{
+		ChannelId:   channel.Id,
+		ChannelName: channel.Name,
+		Provider:    provider,
+		StartTime:   start,
+		EndTime:     end,
+		Threshold:   threshold,
+		SkippedRows: skipped,
+		GeneratedAt: common.GetTimestamp(),
+	}
+	costRatio := channel.GetOtherSettings().CostRatio
+	if costRatio <= 0 {
+		costRatio = 1
+	}
+	lines := make(map[string]*ReconciliationLine, len(usage))
+	logged := make([]string, 0, len(usage))
+	for _, u := range usage {
+		item := statementUsageItem(u)
+		expectedCost := expectedUsageCost(item)
+		lines[u.ModelName] = &ReconciliationLine{
+			ModelName:        u.ModelName,
+			UpstreamModels:   []string{},
+			Requests:         u.Requests,
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			BilledAmount:     item.Amount,
+			ExpectedCost:     expectedCost,
+			ChannelCost:      expectedCost * costRatio,
+		}
+		logged = append(logged, u.ModelName)
+	}
+	// 未能匹配到日志模型的上游费用单独列出，ModelName 为空
+	unmatched := make(map[string]*ReconciliationLine)
+	for _, row := range rows {
+		ts := row.Time.Unix()
+		if ts < start || ts >= end {
+			report.SkippedRows++
+			continue
+		}
+		report.Rows++
+		line := lines[matchReconcileModel(row.Model, logged)]
+		if line == nil {
+			line = unmatched[row.Model]
+			if line == nil {
+				line = &ReconciliationLine{UpstreamModels: []string{}}
+				unmatched[row.Model] = line
+			}
+		}
+		line.UpstreamCost += row.Cost
+		if !common.StringsContains(line.UpstreamModels, row.Model) {
+			line.UpstreamModels = append(line.UpstreamModels, row.Model)
+		}
+	}
+
+	total := &ReconciliationLine{ModelName: "total", UpstreamModels: []string{}}
+	report.Lines = make([]*ReconciliationLine, 0, len(lines)+len(unmatched))
+	for _, line := range lines {
+		report.Lines = append(report.Lines, line)
+	}
+	for _, line := range unmatched {
+		report.Lines = append(report.Lines, line)
+	}
+	for _, line := range report.Lines {
+		line.evaluate(threshold)
+		if line.Flagged {
+			report.FlaggedLines++
+		}
+		total.Requests += line.Requests
+		total.PromptTokens += line.PromptTokens
+		total.CompletionTokens += line.CompletionTokens
+		total.BilledAmount += line.BilledAmount
+		total.ExpectedCost += line.ExpectedCost
+		total.ChannelCost += line.ChannelCost
+		total.UpstreamCost += line.UpstreamCost
+	}
+	total.evaluate(threshold)
+	report.Total = total
+	sort.SliceStable(report.Lines, func(i, j int) bool {
+		if report.Lines[i].Flagged != report.Lines[j].Flagged {
+			return report.Lines[i].Flagged
+		}
+		return math.Abs(report.Lines[i].Difference) > math.Abs(report.Lines[j].Difference)
+	})
+	return report, nil
+}
+
+// ReconciliationCSV 导出对账报告
+func ReconciliationCSV(report *ReconciliationReport) ([]byte, error) {
+	var buf bytes.Buffer
+	// Excel 依赖 BOM 识别 UTF-8
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	rows := [][]string{
+		{"Channel", strconv.Itoa(report.ChannelId), report.ChannelName},
+		{"Provider", report.Provider},
+		{"Period", formatStatementTime(report.StartTime), formatStatementTime(report.EndTime)},
+		{"Threshold (%)", strconv.FormatFloat(report.Threshold, 'f', -1, 64)},
+		{"Generated at", formatStatementTime(report.GeneratedAt)},
+		{},
+		{"Model", "Upstream models", "Requests", "Prompt tokens", "Completion tokens", "Billed (USD)", "Expected cost (USD)", "Channel cost (USD)", "Upstream cost (USD)", "Difference (USD)", "Difference (%)", "Flagged"},
+	}
+	lines := make([]*ReconciliationLine, 0, len(report.Lines)+1)
+	lines = append(append(lines, report.Lines...), report.Total)
+	for _, line := range lines {
+		rows = append(rows, []string{
+			line.ModelName,
+			strings.Join(line.UpstreamModels, "; "),
+			strconv.Itoa(line.Requests),
+			strconv.FormatInt(line.PromptTokens, 10),
+			strconv.FormatInt(line.CompletionTokens, 10),
+			fmt.Sprintf("%.6f", line.BilledAmount),
+			fmt.Sprintf("%.6f", line.ExpectedCost),
+			fmt.Sprintf("%.6f", line.ChannelCost),
+			fmt.Sprintf("%.6f", line.UpstreamCost),
+			fmt.Sprintf("%.6f", line.Difference),
+			fmt.Sprintf("%.2f", line.DifferencePercent),
+			strconv.FormatBool(line.Flagged),
+		})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/tidwall/gjson"
+)
+
+const exchangeRateTickInterval = 10 * time.Minute
+
+var exchangeRateOnce sync.Once
+
+// CurrencyAmounts 额度在各展示币种下的金额，键为币种代码
+type CurrencyAmounts map[string]float64
+
+// QuotaCurrencyAmounts 将基础单位的额度换算为已启用的各币种金额，未开启多币种展示时返回 nil
+func QuotaCurrencyAmounts(quota int64) CurrencyAmounts {
+	setting := operation_setting.GetCurrencySetting()
+	if !setting.Enabled {
+		return nil
+	}
+	return USDCurrencyAmounts(float64(quota) / common.QuotaPerUnit)
+}
+
+// USDCurrencyAmounts 将美元金额换算为已启用的各币种金额，未开启多币种展示时返回 nil
+func USDCurrencyAmounts(usd float64) CurrencyAmounts {
+	setting := operation_setting.GetCurrencySetting()
+	if !setting.Enabled {
+		return nil
+	}
+	amounts := make(CurrencyAmounts, len(setting.Currencies))
+	for _, currency := range setting.Currencies {
+		if rate, ok := setting.GetRate(currency); ok {
+			amounts[currency] = math.Round(usd*rate*1e6) / 1e6
+		}
+	}
+	return amounts
+}
+
+// CurrencyDisplayInfo 返回给前端的多币种展示配置
+func CurrencyDisplayInfo() map[string]any {
+	setting := operation_setting.GetCurrencySetting()
+	if !setting.Enabled {
+		return nil
+	}
+	rates := make(map[string]float64, len(setting.Currencies))
+	symbols := make(map[string]string, len(setting.Currencies))
+	for _, currency := range setting.Currencies {
+		if rate, ok := setting.GetRate(currency); ok {
+			rates[currency] = rate
+			symbols[currency] = setting.GetSymbol(currency)
+		}
+	}
+	return map[string]any{
+		"currencies":      setting.Currencies,
+		"rates":           rates,
+		"symbols":         symbols,
+		"last_fetched_at": setting.LastFetchedAt,
+	}
+}
+
+// StartExchangeRateTask 定时从配置的地址拉取汇率，结果写入配置并同步到其他节点
+func StartExchangeRateTask() {
+	exchangeRateOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("exchange rate task started: tick=%s", exchangeRateTickInterval))
+			ticker := time.NewTicker(exchangeRateTickInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				setting := operation_setting.GetCurrencySetting()
+				if !setting.Enabled || !setting.AutoFetchEnabled || !model.IsLeader() {
+					continue
+				}
+				interval := int64(max(setting.AutoFetchIntervalMinutes, 10)) * 60
+				if common.GetTimestamp()-setting.LastFetchedAt < interval {
+					continue
+				}
+				if _, err := FetchExchangeRates(); err != nil {
+					logger.LogWarn(context.Background(), fmt.Sprintf("failed to fetch exchange rates: %v", err))
+				}
+			}
+		})
+	})
+}
+
+// FetchExchangeRates 拉取以 USD 为基准的汇率，只更新已启用的币种
+func FetchExchangeRates() (map[string]float64, error) {
+	setting := operation_setting.GetCurrencySetting()
+	if setting.AutoFetchURL == "" {
+		return nil, fmt.Errorf("exchange rate url is not configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, setting.AutoFetchURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rate api returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	fetched := gjson.GetBytes(body, "rates")
+	if !fetched.IsObject() {
+		return nil, fmt.Errorf("exchange rate api response has no rates")
+	}
+	rates := make(map[string]float64, len(setting.Rates))
+	for currency, rate := range setting.Rates {
+		rates[currency] = rate
+	}
+	for _, currency := range setting.Currencies {
+		currency = strings.ToUpper(currency)
+		if currency == "USD" {
+			continue
+		}
+		if rate := fetched.Get(currency).Float(); rate > 0 {
+			rates[currency] = rate
+		}
+	}
+	data, err := common.Marshal(rates)
+	if err != nil {
+		return nil, err
+	}
+	if err = model.UpdateOption("currency_setting.rates", string(data)); err != nil {
+		return nil, err
+	}
+	if err = model.UpdateOption("currency_setting.last_fetched_at", strconv.FormatInt(common.GetTimestamp(), 10)); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const dashboardOverviewCacheTTL = time.Minute
+
+var dashboardOverviewCache struct {
+	sync.Mutex
+	limit     int
+	expiresAt time.Time
+	overview  *DashboardOverview
+}
+
+// DashboardSummary 一个时间段内的汇总用量
+type DashboardSummary struct {
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Tokens           int     `json:"tokens"`
+	Quota            int     `json:"quota"`
+	Revenue          float64 `json:"revenue"` // 按 QuotaPerUnit 折算的消费金额
+	ErrorRate        float64 `json:"error_rate"`
+}
+
+// DashboardChange 与上一周期相比的变化，数量类为百分比，上一周期为 0 时为空；错误率为百分点差值
+type DashboardChange struct {
+	Requests  *float64 `json:"requests"`
+	Tokens    *float64 `json:"tokens"`
+	Revenue   *float64 `json:"revenue"`
+	ErrorRate float64  `json:"error_rate"`
+}
+
+type DashboardRankItem struct {
+	Key           string  `json:"key"`
+	Name          string  `json:"name,omitempty"`
+	Requests      int     `json:"requests"`
+	Tokens        int     `json:"tokens"`
+	Quota         int     `json:"quota"`
+	Revenue       float64 `json:"revenue"`
+	PreviousQuota int     `json:"previous_quota"`
+}
+
+// DashboardComparison 当前周期与上一周期截至相同时刻的对比
+type DashboardComparison struct {
+	Start         int64               `json:"start"`
+	End           int64               `json:"end"`
+	PreviousStart int64               `json:"previous_start"`
+	PreviousEnd   int64               `json:"previous_end"`
+	Current       DashboardSummary    `json:"current"`
+	Previous      DashboardSummary    `json:"previous"`
+	Change        DashboardChange     `json:"change"`
+	TopModels     []DashboardRankItem `json:"top_models"`
+	TopUsers      []DashboardRankItem `json:"top_users"`
+}
+
+type DashboardOverview struct {
+	Today       DashboardComparison `json:"today"`
+	Week        DashboardComparison `json:"week"`
+	GeneratedAt int64               `json:"generated_at"`
+}
+
+// usageStatCoverage 汇总表已覆盖到的时间，之后的数据需从原始日志补齐
+type usageStatCoverage struct {
+	hourEnd int64
+	dayEnd  int64
+}
+
+// GetDashboardOverview 基于用量汇总表计算今日与本周的概览，结果缓存一分钟
+func GetDashboardOverview(limit int) (*DashboardOverview, error) {
+	dashboardOverviewCache.Lock()
+	defer dashboardOverviewCache.Unlock()
+	if dashboardOverviewCache.overview != nil && dashboardOverviewCache.limit == limit && time.Now().Before(dashboardOverviewCache.expiresAt) {
+		return dashboardOverviewCache.overview, nil
+	}
+	overview, err := buildDashboardOverview(time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	dashboardOverviewCache.limit = limit
+	dashboardOverviewCache.expiresAt = time.Now().Add(dashboardOverviewCacheTTL)
+	dashboardOverviewCache.overview = overview
+	return overview, nil
+}
+
+func getUsageStatCoverage(now time.Time) (*usageStatCoverage, error) {
+	// ClickHouse 直接从原始日志聚合，不存在汇总延迟
+	if model.ClickHouseEnabled() {
+		return &usageStatCoverage{hourEnd: now.Unix(), dayEnd: dayStart(now).Unix()}, nil
+	}
+	if !operation_setting.GetAnalyticsSetting().Enabled {
+		return nil, errors.New("请先开启用量统计汇总")
+	}
+	coverage := &usageStatCoverage{}
+	latestHour, err := model.GetLatestUsageStatBucket(model.UsageStatPeriodHour)
+	if err != nil {
+		return nil, err
+	}
+	if latestHour > 0 {
+		coverage.hourEnd = latestHour + 3600
+	}
+	latestDay, err := model.GetLatestUsageStatBucket(model.UsageStatPeriodDay)
+	if err != nil {
+		return nil, err
+	}
+	if latestDay > 0 {
+		coverage.dayEnd = dayStart(time.Unix(latestDay, 0)).AddDate(0, 0, 1).Unix()
+	}
+	return coverage, nil
+}
+
+// loadHourlyUsageStats 读取 [start, end) 的小时汇总，尚未汇总的部分从原始日志补齐
+func loadHourlyUsageStats(start int64, end int64, coverage *usageStatCoverage) ([]*model.UsageStat, error) {
+	if start >= end {
+		return nil, nil
+	}
+	var stats []*model.UsageStat
+	if hourEnd := min(end, coverage.hourEnd); hourEnd > start {
+		hourly, err := model.QueryUsageStats(model.UsageStatFilter{Period: model.UsageStatPeriodHour, Start: start, End: hourEnd})
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, hourly...)
+	}
+	if tailStart := max(start, coverage.hourEnd); tailStart < end {
+		tail, err := model.SummarizeLogUsage(tailStart, end)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, tail...)
+	}
+	return stats, nil
+}
+
+// loadUsageStats 完整且已汇总的自然日使用日汇总，其余时段使用小时汇总
+func loadUsageStats(start time.Time, end time.Time, coverage *usageStatCoverage) ([]*model.UsageStat, error) {
+	firstDay := dayStart(start)
+	if firstDay.Before(start) {
+		firstDay = firstDay.AddDate(0, 0, 1)
+	}
+	lastDay := min(dayStart(end).Unix(), coverage.dayEnd)
+	if firstDay.Unix() >= lastDay {
+		return loadHourlyUsageStats(start.Unix(), end.Unix(), coverage)
+	}
+	stats, err := model.QueryUsageStats(model.UsageStatFilter{Period: model.UsageStatPeriodDay, Start: firstDay.Unix(), End: lastDay})
+	if err != nil {
+		return nil, err
+	}
+	head, err := loadHourlyUsageStats(start.Unix(), firstDay.Unix(), coverage)
+	if err != nil {
+		return nil, err
+	}
+	tail, err := loadHourlyUsageStats(lastDay, end.Unix(), coverage)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(stats, head...), tail...), nil
+}
+
+func summarizeDashboardStats(stats []*model.UsageStat) DashboardSummary {
+	summary := DashboardSummary{}
+	for _, stat := range stats {
+		summary.Requests += stat.Requests
+		summary.Errors += stat.Errors
+		summary.PromptTokens += stat.PromptTokens
+		summary.CompletionTokens += stat.CompletionTokens
+		summary.Quota += stat.Quota
+	}
+	summary.Tokens = summary.PromptTokens + summary.CompletionTokens
+	summary.Revenue = float64(summary.Quota) / common.QuotaPerUnit
+	if summary.Requests > 0 {
+		summary.ErrorRate = float64(summary.Errors) / float64(summary.Requests)
+	}
+	return summary
+}
+
+func percentChange(current float64, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := (current - previous) / previous * 100
+	return &change
+}
+
+// rankDashboardStats 按消费额度排序取前 limit 项，并附上上一周期的额度
+func rankDashboardStats(current []*model.UsageStat, previous []*model.UsageStat, groupBy string, limit int) []DashboardRankItem {
+	items := make(map[string]*DashboardRankItem)
+	for _, stat := range current {
+		key := usageStatGroupKey(stat, groupBy)
+		item, ok := items[key]
+		if !ok {
+			item = &DashboardRankItem{Key: key}
+			items[key] = item
+		}
+		item.Requests += stat.Requests
+		item.Tokens += stat.PromptTokens + stat.CompletionTokens
+		item.Quota += stat.Quota
+	}
+	for _, stat := range previous {
+		if item, ok := items[usageStatGroupKey(stat, groupBy)]; ok {
+			item.PreviousQuota += stat.Quota
+		}
+	}
+	ranked := make([]DashboardRankItem, 0, len(items))
+	for _, item := range items {
+		item.Revenue = float64(item.Quota) / common.QuotaPerUnit
+		ranked = append(ranked, *item)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Quota != ranked[j].Quota {
+			return ranked[i].Quota > ranked[j].Quota
+		}
+		return ranked[i].Requests > ranked[j].Requests
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+func compareDashboardPeriods(start time.Time, previousStart time.Time, now time.Time, coverage *usageStatCoverage, limit int) (DashboardComparison, error) {
+	previousEnd := previousStart.Add(now.Sub(start))
+	comparison := DashboardComparison{
+		Start:         start.Unix(),
+		End:           now.Unix(),
+		PreviousStart: previousStart.Unix(),
+		PreviousEnd:   previousEnd.Unix(),
+	}
+	current, err := loadUsageStats(start, now, coverage)
+	if err != nil {
+		return comparison, err
+	}
+	previous, err := loadUsageStats(previousStart, previousEnd, coverage)
+	if err != nil {
+		return comparison, err
+	}
+	comparison.Current = summarizeDashboardStats(current)
+	comparison.Previous = summarizeDashboardStats(previous)
+	comparison.Change = DashboardChange{
+		Requests:  percentChange(float64(comparison.Current.Requests), float64(comparison.Previous.Requests)),
+		Tokens:    percentChange(float64(comparison.Current.Tokens), float64(comparison.Previous.Tokens)),
+		Revenue:   percentChange(comparison.Current.Revenue, comparison.Previous.Revenue),
+		ErrorRate: (comparison.Current.ErrorRate - comparison.Previous.ErrorRate) * 100,
+	}
+	comparison.TopModels = rankDashboardStats(current, previous, "model", limit)
+	comparison.TopUsers = rankDashboardStats(current, previous, "user", limit)
+	for i := range comparison.TopUsers {
+		userId, _ := strconv.Atoi(comparison.TopUsers[i].Key)
+		comparison.TopUsers[i].Name, _ = model.GetUsernameById(userId, false)
+	}
+	return comparison, nil
+}
+
+func buildDashboardOverview(now time.Time, limit int) (*DashboardOverview, error) {
+	coverage, err := getUsageStatCoverage(now)
+	if err != nil {
+		return nil, err
+	}
+	today := dayStart(now)
+	// 周一为一周的第一天
+	weekStart := today.AddDate(0, 0, -(int(now.Weekday())+6)%7)
+	overview := &DashboardOverview{GeneratedAt: now.Unix()}
+	if overview.Today, err = compareDashboardPeriods(today, today.AddDate(0, 0, -1), now, coverage, limit); err != nil {
+		return nil, err
+	}
+	if overview.Week, err = compareDashboardPeriods(weekStart, weekStart.AddDate(0, 0, -7), now, coverage, limit); err != nil {
+		return nil, err
+	}
+	return overview, nil
+}
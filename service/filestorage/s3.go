@@ -0,0 +1,133 @@
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// s3Storage 通过 S3 REST API 读写对象，兼容 AWS S3 与 MinIO、R2 等 S3 协议存储
+type s3Storage struct {
+	endpoint    *url.URL
+	region      string
+	bucket      string
+	keyPrefix   string
+	pathStyle   bool
+	credentials aws.Credentials
+	signer      *v4.Signer
+}
+
+func newS3Storage(setting *operation_setting.FileSetting) (*s3Storage, error) {
+	if setting.S3Bucket == "" || setting.S3AccessKey == "" || setting.S3SecretKey == "" {
+		return nil, errors.New("s3 storage requires bucket, access key and secret key")
+	}
+	region := setting.S3Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := setting.S3Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	endpointURL, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	return &s3Storage{
+		endpoint:  endpointURL,
+		region:    region,
+		bucket:    setting.S3Bucket,
+		keyPrefix: setting.S3KeyPrefix,
+		pathStyle: setting.S3PathStyle,
+		credentials: aws.Credentials{
+			AccessKeyID:     setting.S3AccessKey,
+			SecretAccessKey: setting.S3SecretKey,
+		},
+		signer: v4.NewSigner(),
+	}, nil
+}
+
+func (s *s3Storage) objectURL(key string) string {
+	objectKey := strings.TrimPrefix(s.keyPrefix+key, "/")
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = u.Path + "/" + s.bucket + "/" + objectKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = u.Path + "/" + objectKey
+	}
+	return u.String()
+}
+
+func (s *s3Storage) do(ctx context.Context, method string, key string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	// 上传时不计算请求体哈希，避免为签名把整个文件读入内存
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if err := s.signer.SignHTTP(ctx, s.credentials, req, payloadHash, "s3", s.region, time.Now()); err != nil {
+		return nil, err
+	}
+	return service.GetHttpClient().Do(req)
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, reader io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, key, reader, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *s3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("s3 request failed: status %d, body: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
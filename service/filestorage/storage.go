@@ -0,0 +1,36 @@
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("file not found in storage")
+
+// Storage 文件存储后端，key 由调用方生成，只包含字母、数字、"-"、"_"、"." 与 "/"
+type Storage interface {
+	Put(ctx context.Context, key string, reader io.Reader, size int64) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// GetStorage 按驱动名称返回存储后端，driver 为空时使用当前配置的驱动
+func GetStorage(driver string) (Storage, error) {
+	setting := operation_setting.GetFileSetting()
+	if driver == "" {
+		driver = setting.StorageDriver
+	}
+	switch driver {
+	case "", operation_setting.FileStorageDriverLocal:
+		return newLocalStorage(setting.LocalPath), nil
+	case operation_setting.FileStorageDriverS3:
+		return newS3Storage(setting)
+	default:
+		return nil, fmt.Errorf("unsupported storage driver: %s", driver)
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const freeTierDayLayout = "2006-01-02"
+
+// FreeTierStatus 某个模型当天的免费额度与已用量
+type FreeTierStatus struct {
+	ModelName     string `json:"model_name"`
+	Day           string `json:"day"`
+	RequestLimit  int    `json:"request_limit"`
+	RequestUsed   int    `json:"request_used"`
+	TokenLimit    int    `json:"token_limit"`
+	TokenUsed     int    `json:"token_used"`
+	NextResetTime int64  `json:"next_reset_time"`
+}
+
+// FreeTierDay 免费额度按配置时区的自然日重置
+func FreeTierDay(now time.Time) string {
+	return now.In(operation_setting.GetFreeTierSetting().Location()).Format(freeTierDayLayout)
+}
+
+func freeTierNextReset(now time.Time) int64 {
+	local := now.In(operation_setting.GetFreeTierSetting().Location())
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location()).Unix()
+}
+
+// ReserveFreeTier 预扣费前原子占用当天的免费额度，返回仍需预扣的额度。
+// 按次数时占用一次请求；按 token 时按预估的提示 token 数占用，结算时再按实际用量校正
+func ReserveFreeTier(relayInfo *relaycommon.RelayInfo, preConsumedQuota int) int {
+	freeQuota, ok := operation_setting.GetFreeTierQuota(relayInfo.OriginModelName)
+	if !ok {
+		return preConsumedQuota
+	}
+	day := FreeTierDay(time.Now())
+	if freeQuota.Requests > 0 {
+		reserved, err := model.ConsumeFreeTierRequest(relayInfo.UserId, relayInfo.OriginModelName, day, freeQuota.Requests, 0)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to reserve free tier of user %d: %s", relayInfo.UserId, err.Error()))
+			return preConsumedQuota
+		}
+		if !reserved {
+			return preConsumedQuota
+		}
+		relayInfo.FreeTierDay = day
+		relayInfo.FreeTierRequest = true
+		return 0
+	}
+	estimated := relayInfo.GetEstimatePromptTokens()
+	if estimated <= 0 {
+		return preConsumedQuota
+	}
+	covered, err := model.ConsumeFreeTierTokens(relayInfo.UserId, relayInfo.OriginModelName, day, freeQuota.Tokens, estimated, 1)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to reserve free tier of user %d: %s", relayInfo.UserId, err.Error()))
+		return preConsumedQuota
+	}
+	if covered <= 0 {
+		return preConsumedQuota
+	}
+	relayInfo.FreeTierDay = day
+	relayInfo.FreeTierTokens = covered
+	return int(int64(preConsumedQuota) * int64(estimated-covered) / int64(estimated))
+}
+
+// ReleaseFreeTier 请求失败时释放预扣费阶段占用的免费额度
+func ReleaseFreeTier(relayInfo *relaycommon.RelayInfo) {
+	if relayInfo.FreeTierDay == "" {
+		return
+	}
+	tokens := 0
+	if !relayInfo.FreeTierRequest {
+		tokens = -relayInfo.FreeTierTokens
+	}
+	if err := model.AdjustFreeTierUsage(relayInfo.UserId, relayInfo.OriginModelName, relayInfo.FreeTierDay, -1, tokens); err != nil {
+		common.SysError(fmt.Sprintf("failed to release free tier of user %d: %s", relayInfo.UserId, err.Error()))
+	}
+	relayInfo.FreeTierDay = ""
+	relayInfo.FreeTierRequest = false
+	relayInfo.FreeTierTokens = 0
+}
+
+// ApplyFreeTier 结算时优先使用当天的免费额度，返回抵扣后仍需扣除的额度。
+// 按次数时整次请求免费；按 token 时按抵扣的 token 比例减免。预扣费阶段已预占的额度按实际用量校正
+func ApplyFreeTier(relayInfo *relaycommon.RelayInfo, quota int, totalTokens int) int {
+	if relayInfo.FreeTierDay != "" {
+		return settleReservedFreeTier(relayInfo, quota, totalTokens)
+	}
+	if quota <= 0 || totalTokens <= 0 {
+		return quota
+	}
+	freeQuota, ok := operation_setting.GetFreeTierQuota(relayInfo.OriginModelName)
+	if !ok {
+		return quota
+	}
+	day := FreeTierDay(time.Now())
+	if freeQuota.Requests > 0 {
+		consumed, err := model.ConsumeFreeTierRequest(relayInfo.UserId, relayInfo.OriginModelName, day, freeQuota.Requests, totalTokens)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to consume free tier of user %d: %s", relayInfo.UserId, err.Error()))
+			return quota
+		}
+		if !consumed {
+			return quota
+		}
+		relayInfo.FreeTierRequest = true
+		return 0
+	}
+	covered, err := model.ConsumeFreeTierTokens(relayInfo.UserId, relayInfo.OriginModelName, day, freeQuota.Tokens, totalTokens, 1)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to consume free tier of user %d: %s", relayInfo.UserId, err.Error()))
+		return quota
+	}
+	if covered <= 0 {
+		return quota
+	}
+	relayInfo.FreeTierTokens = covered
+	return int(int64(quota) * int64(totalTokens-covered) / int64(totalTokens))
+}
+
+func settleReservedFreeTier(relayInfo *relaycommon.RelayInfo, quota int, totalTokens int) int {
+	day := relayInfo.FreeTierDay
+	relayInfo.FreeTierDay = ""
+	if relayInfo.FreeTierRequest {
+		if err := model.AdjustFreeTierUsage(relayInfo.UserId, relayInfo.OriginModelName, day, 0, totalTokens); err != nil {
+			common.SysError(fmt.Sprintf("failed to record free tier tokens of user %d: %s", relayInfo.UserId, err.Error()))
+		}
+		return 0
+	}
+	reserved := relayInfo.FreeTierTokens
+	covered := min(reserved, totalTokens)
+	if totalTokens > reserved {
+		// 实际用量超出预占部分，继续用剩余的免费 token 抵扣
+		if freeQuota, ok := operation_setting.GetFreeTierQuota(relayInfo.OriginModelName); ok && freeQuota.Tokens > 0 {
+			extra, err := model.ConsumeFreeTierTokens(relayInfo.UserId, relayInfo.OriginModelName, day, freeQuota.Tokens, totalTokens-reserved, 0)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to consume free tier of user %d: %s", relayInfo.UserId, err.Error()))
+			}
+			covered += extra
+		}
+	} else if totalTokens < reserved {
+		if err := model.AdjustFreeTierUsage(relayInfo.UserId, relayInfo.OriginModelName, day, 0, totalTokens-reserved); err != nil {
+			common.SysError(fmt.Sprintf("failed to release free tier of user %d: %s", relayInfo.UserId, err.Error()))
+		}
+	}
+	relayInfo.FreeTierTokens = covered
+	if quota <= 0 || totalTokens <= 0 {
+		return quota
+	}
+	return int(int64(quota) * int64(totalTokens-covered) / int64(totalTokens))
+}
+
+// GetFreeTierStatus 返回用户当天所有配置了免费额度的模型的使用情况
+func GetFreeTierStatus(userId int) ([]FreeTierStatus, error) {
+	setting := operation_setting.GetFreeTierSetting()
+	statuses := make([]FreeTierStatus, 0)
+	if !setting.Enabled {
+		return statuses, nil
+	}
+	now := time.Now()
+	day := FreeTierDay(now)
+	nextReset := freeTierNextReset(now)
+	for modelName := range setting.Models {
+		quota, ok := operation_setting.GetFreeTierQuota(modelName)
+		if !ok {
+			continue
+		}
+		usage, err := model.GetFreeTierUsage(userId, modelName, day)
+		if err != nil {
+			return nil, err
+		}
+		status := FreeTierStatus{
+			ModelName:     modelName,
+			Day:           day,
+			RequestUsed:   usage.Requests,
+			TokenUsed:     usage.Tokens,
+			NextResetTime: nextReset,
+		}
+		if quota.Requests > 0 {
+			status.RequestLimit = quota.Requests
+		} else {
+			status.TokenLimit = quota.Tokens
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ModelName < statuses[j].ModelName
+	})
+	return statuses, nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// GuardrailVars 提示词模板变量
+type GuardrailVars struct {
+	Username  string
+	UserId    int
+	Group     string
+	TokenName string
+	Model     string
+}
+
+func renderGuardrailTemplate(text string, vars GuardrailVars) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	now := time.Now()
+	return strings.NewReplacer(
+		"{{username}}", vars.Username,
+		"{{user_id}}", strconv.Itoa(vars.UserId),
+		"{{group}}", vars.Group,
+		"{{token_name}}", vars.TokenName,
+		"{{model}}", vars.Model,
+		"{{date}}", now.Format("2006-01-02"),
+		"{{datetime}}", now.Format("2006-01-02 15:04:05"),
+	).Replace(text)
+}
+
+// mergeGuardrailRules 合并多条规则并渲染模板变量
+func mergeGuardrailRules(rules []operation_setting.GuardrailRule, vars GuardrailVars) operation_setting.GuardrailRule {
+	var systemPrompts, prefixes, suffixes []string
+	for _, rule := range rules {
+		if rule.SystemPrompt != "" {
+			systemPrompts = append(systemPrompts, renderGuardrailTemplate(rule.SystemPrompt, vars))
+		}
+		if rule.UserPrefix != "" {
+			prefixes = append(prefixes, renderGuardrailTemplate(rule.UserPrefix, vars))
+		}
+		if rule.UserSuffix != "" {
+			suffixes = append(suffixes, renderGuardrailTemplate(rule.UserSuffix, vars))
+		}
+	}
+	return operation_setting.GuardrailRule{
+		SystemPrompt: strings.Join(systemPrompts, "\n"),
+		UserPrefix:   strings.Join(prefixes, "\n"),
+		UserSuffix:   strings.Join(suffixes, "\n"),
+	}
+}
+
+func wrapText(text string, rule operation_setting.GuardrailRule) string {
+	if rule.UserPrefix != "" {
+		text = rule.UserPrefix + "\n" + text
+	}
+	if rule.UserSuffix != "" {
+		text = text + "\n" + rule.UserSuffix
+	}
+	return text
+}
+
+// wrapContent 处理字符串或内容块数组形式的消息内容，textType 为新增内容块的类型
+func wrapContent(content any, rule operation_setting.GuardrailRule, textType string) any {
+	switch v := content.(type) {
+	case string:
+		return wrapText(v, rule)
+	case []any:
+		if rule.UserPrefix != "" {
+			v = append([]any{map[string]any{"type": textType, "text": rule.UserPrefix}}, v...)
+		}
+		if rule.UserSuffix != "" {
+			v = append(v, map[string]any{"type": textType, "text": rule.UserSuffix})
+		}
+		return v
+	}
+	return content
+}
+
+// lastUserMessage 返回最后一条用户消息，Gemini 的消息可能不带 role
+func lastUserMessage(messages []any, allowEmptyRole bool) map[string]any {
+	for i := len(messages) - 1; i >= 0; i-- {
+		message, ok := messages[i].(map[string]any)
+		if !ok {
+			continue
+		}
+		role, _ := message["role"].(string)
+		if role == "user" || (allowEmptyRole && role == "") {
+			return message
+		}
+	}
+	return nil
+}
+
+func joinSystemText(prompt string, existing string) string {
+	if existing == "" {
+		return prompt
+	}
+	return prompt + "\n" + existing
+}
+
+func applyChatGuardrail(data map[string]any, rule operation_setting.GuardrailRule) {
+	messages, _ := data["messages"].([]any)
+	if rule.UserPrefix != "" || rule.UserSuffix != "" {
+		if message := lastUserMessage(messages, false); message != nil {
+			message["content"] = wrapContent(message["content"], rule, "text")
+		}
+	}
+	if rule.SystemPrompt != "" {
+		data["messages"] = append([]any{map[string]any{"role": "system", "content": rule.SystemPrompt}}, messages...)
+	}
+}
+
+func applyClaudeGuardrail(data map[string]any, rule operation_setting.GuardrailRule) {
+	if messages, ok := data["messages"].([]any); ok && (rule.UserPrefix != "" || rule.UserSuffix != "") {
+		if message := lastUserMessage(messages, false); message != nil {
+			message["content"] = wrapContent(message["content"], rule, "text")
+		}
+	}
+	if rule.SystemPrompt == "" {
+		return
+	}
+	switch system := data["system"].(type) {
+	case []any:
+		data["system"] = append([]any{map[string]any{"type": "text", "text": rule.SystemPrompt}}, system...)
+	case string:
+		data["system"] = joinSystemText(rule.SystemPrompt, system)
+	default:
+		data["system"] = rule.SystemPrompt
+	}
+}
+
+func applyResponsesGuardrail(data map[string]any, rule operation_setting.GuardrailRule) {
+	switch input := data["input"].(type) {
+	case string:
+		data["input"] = wrapText(input, rule)
+	case []any:
+		if message := lastUserMessage(input, false); message != nil {
+			message["content"] = wrapContent(message["content"], rule, "input_text")
+		}
+	}
+	if rule.SystemPrompt != "" {
+		instructions, _ := data["instructions"].(string)
+		data["instructions"] = joinSystemText(rule.SystemPrompt, instructions)
+	}
+}
+
+func applyGeminiGuardrail(data map[string]any, rule operation_setting.GuardrailRule) {
+	if contents, ok := data["contents"].([]any); ok && (rule.UserPrefix != "" || rule.UserSuffix != "") {
+		if message := lastUserMessage(contents, true); message != nil {
+			parts, _ := message["parts"].([]any)
+			if rule.UserPrefix != "" {
+				parts = append([]any{map[string]any{"text": rule.UserPrefix}}, parts...)
+			}
+			if rule.UserSuffix != "" {
+				parts = append(parts, map[string]any{"text": rule.UserSuffix})
+			}
+			message["parts"] = parts
+		}
+	}
+	if rule.SystemPrompt == "" {
+		return
+	}
+	key := "systemInstruction"
+	if _, ok := data["system_instruction"]; ok {
+		key = "system_instruction"
+	}
+	instruction, _ := data[key].(map[string]any)
+	if instruction == nil {
+		instruction = map[string]any{}
+	}
+	parts, _ := instruction["parts"].([]any)
+	instruction["parts"] = append([]any{map[string]any{"text": rule.SystemPrompt}}, parts...)
+	data[key] = instruction
+}
+
+func applyCompletionsGuardrail(data map[string]any, rule operation_setting.GuardrailRule) {
+	prompt, ok := data["prompt"].(string)
+	if !ok {
+		return
+	}
+	prompt = wrapText(prompt, rule)
+	if rule.SystemPrompt != "" {
+		prompt = rule.SystemPrompt + "\n" + prompt
+	}
+	data["prompt"] = prompt
+}
+
+// ApplyGuardrails 按请求路径识别格式，将强制提示词写入请求体，不支持的格式原样返回
+func ApplyGuardrails(path string, body []byte, rules []operation_setting.GuardrailRule, vars GuardrailVars) ([]byte, bool, error) {
+	var apply func(map[string]any, operation_setting.GuardrailRule)
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		apply = applyChatGuardrail
+	case strings.HasSuffix(path, "/v1/messages"):
+		apply = applyClaudeGuardrail
+	case strings.HasPrefix(path, "/v1/responses"):
+		apply = applyResponsesGuardrail
+	case strings.HasSuffix(path, "/v1/completions"):
+		apply = applyCompletionsGuardrail
+	case strings.Contains(path, ":generateContent") || strings.Contains(path, ":streamGenerateContent"):
+		apply = applyGeminiGuardrail
+	default:
+		return body, false, nil
+	}
+	decoded, err := decodeJSONBody(body)
+	if err != nil {
+		return nil, false, err
+	}
+	data, ok := decoded.(map[string]any)
+	if !ok {
+		return body, false, nil
+	}
+	apply(data, mergeGuardrailRules(rules, vars))
+	encoded, err := encodeJSONBody(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return encoded, true, nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
+	"github.com/gorilla/websocket"
 	"golang.org/x/net/proxy"
 )
 
@@ -33,16 +34,33 @@ func checkRedirect(req *http.Request, via []*http.Request) error {
 	return nil
 }
 
-func InitHttpClient() {
-	transport := &http.Transport{
-		MaxIdleConns:        common.RelayMaxIdleConns,
-		MaxIdleConnsPerHost: common.RelayMaxIdleConnsPerHost,
-		ForceAttemptHTTP2:   true,
-		Proxy:               http.ProxyFromEnvironment, // Support HTTP_PROXY, HTTPS_PROXY, NO_PROXY env vars
+type connectTimeoutKey struct{}
+
+// WithConnectTimeout 为单次请求指定建立新连接的超时，复用连接池中的空闲连接时不生效
+func WithConnectTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if timeout <= 0 {
+		return ctx
 	}
-	if common.TLSInsecureSkipVerify {
-		transport.TLSClientConfig = common.InsecureTLSConfig
+	return context.WithValue(ctx, connectTimeoutKey{}, timeout)
+}
+
+func withConnectTimeout(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return dial(ctx, network, addr)
 	}
+}
+
+func InitHttpClient() {
+	// 默认客户端支持 HTTP_PROXY、HTTPS_PROXY、NO_PROXY 环境变量
+	transport, _ := newUpstreamTransport("direct", func(transport *http.Transport) error {
+		transport.Proxy = http.ProxyFromEnvironment
+		return nil
+	})
 
 	if common.RelayTimeout == 0 {
 		httpClient = &http.Client{
@@ -75,9 +93,7 @@ func ResetProxyClientCache() {
 	proxyClientLock.Lock()
 	defer proxyClientLock.Unlock()
 	for _, client := range proxyClients {
-		if transport, ok := client.Transport.(*http.Transport); ok && transport != nil {
-			transport.CloseIdleConnections()
-		}
+		client.CloseIdleConnections()
 	}
 	proxyClients = make(map[string]*http.Client)
 }
@@ -102,68 +118,95 @@ func NewProxyHttpClient(proxyURL string) (*http.Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	transport, err := newUpstreamTransport(parsedURL.Redacted(), func(transport *http.Transport) error {
+		return applyProxyToTransport(transport, parsedURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+	client.Timeout = time.Duration(common.RelayTimeout) * time.Second
 
-	switch parsedURL.Scheme {
-	case "http", "https":
-		transport := &http.Transport{
-			MaxIdleConns:        common.RelayMaxIdleConns,
-			MaxIdleConnsPerHost: common.RelayMaxIdleConnsPerHost,
-			ForceAttemptHTTP2:   true,
-			Proxy:               http.ProxyURL(parsedURL),
-		}
-		if common.TLSInsecureSkipVerify {
-			transport.TLSClientConfig = common.InsecureTLSConfig
+	// 同一代理地址共用一个连接池
+	proxyClientLock.Lock()
+	defer proxyClientLock.Unlock()
+	if existing, ok := proxyClients[proxyURL]; ok {
+		return existing, nil
+	}
+	proxyClients[proxyURL] = client
+	return client, nil
+}
+
+// newSOCKS5DialContext 创建经 SOCKS5 代理拨号的函数，支持用户名密码认证
+func newSOCKS5DialContext(parsedURL *url.URL) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	// 获取认证信息
+	var auth *proxy.Auth
+	if parsedURL.User != nil {
+		auth = &proxy.Auth{
+			User:     parsedURL.User.Username(),
+			Password: "",
 		}
-		client := &http.Client{
-			Transport:     transport,
-			CheckRedirect: checkRedirect,
+		if password, ok := parsedURL.User.Password(); ok {
+			auth.Password = password
 		}
-		client.Timeout = time.Duration(common.RelayTimeout) * time.Second
-		proxyClientLock.Lock()
-		proxyClients[proxyURL] = client
-		proxyClientLock.Unlock()
-		return client, nil
+	}
+
+	// 创建 SOCKS5 代理拨号器
+	// proxy.SOCKS5 使用 tcp 参数，所有 TCP 连接包括 DNS 查询都将通过代理进行。行为与 socks5h 相同
+	dialer, err := proxy.SOCKS5("tcp", parsedURL.Host, auth, proxy.Direct)
+	if err != nil {
+		return nil, err
+	}
+	if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+		return contextDialer.DialContext, nil
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.Dial(network, addr)
+	}, nil
+}
 
+func applyProxyToTransport(transport *http.Transport, parsedURL *url.URL) error {
+	switch parsedURL.Scheme {
+	case "http", "https":
+		transport.Proxy = http.ProxyURL(parsedURL)
+		return nil
 	case "socks5", "socks5h":
-		// 获取认证信息
-		var auth *proxy.Auth
-		if parsedURL.User != nil {
-			auth = &proxy.Auth{
-				User:     parsedURL.User.Username(),
-				Password: "",
-			}
-			if password, ok := parsedURL.User.Password(); ok {
-				auth.Password = password
-			}
+		dialContext, err := newSOCKS5DialContext(parsedURL)
+		if err != nil {
+			return err
 		}
+		transport.DialContext = withConnectTimeout(dialContext)
+		return nil
+	default:
+		return fmt.Errorf("unsupported proxy scheme: %s, must be http, https, socks5 or socks5h", parsedURL.Scheme)
+	}
+}
 
-		// 创建 SOCKS5 代理拨号器
-		// proxy.SOCKS5 使用 tcp 参数，所有 TCP 连接包括 DNS 查询都将通过代理进行。行为与 socks5h 相同
-		dialer, err := proxy.SOCKS5("tcp", parsedURL.Host, auth, proxy.Direct)
+// NewProxyWebsocketDialer 创建经渠道代理连接上游的 websocket 拨号器
+func NewProxyWebsocketDialer(proxyURL string) (*websocket.Dialer, error) {
+	if proxyURL == "" {
+		return websocket.DefaultDialer, nil
+	}
+	parsedURL, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	dialer := *websocket.DefaultDialer
+	switch parsedURL.Scheme {
+	case "http", "https":
+		dialer.Proxy = http.ProxyURL(parsedURL)
+	case "socks5", "socks5h":
+		dialContext, err := newSOCKS5DialContext(parsedURL)
 		if err != nil {
 			return nil, err
 		}
-
-		transport := &http.Transport{
-			MaxIdleConns:        common.RelayMaxIdleConns,
-			MaxIdleConnsPerHost: common.RelayMaxIdleConnsPerHost,
-			ForceAttemptHTTP2:   true,
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				return dialer.Dial(network, addr)
-			},
-		}
-		if common.TLSInsecureSkipVerify {
-			transport.TLSClientConfig = common.InsecureTLSConfig
-		}
-
-		client := &http.Client{Transport: transport, CheckRedirect: checkRedirect}
-		client.Timeout = time.Duration(common.RelayTimeout) * time.Second
-		proxyClientLock.Lock()
-		proxyClients[proxyURL] = client
-		proxyClientLock.Unlock()
-		return client, nil
-
+		dialer.Proxy = nil
+		dialer.NetDialContext = dialContext
 	default:
 		return nil, fmt.Errorf("unsupported proxy scheme: %s, must be http, https, socks5 or socks5h", parsedURL.Scheme)
 	}
+	if common.TLSInsecureSkipVerify {
+		dialer.TLSClientConfig = common.InsecureTLSConfig
+	}
+	return &dialer, nil
 }
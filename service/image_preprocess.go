@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+)
+
+// maxPreprocessImagePixels 缩放时允许解码的最大像素数
+const maxPreprocessImagePixels = 50_000_000
+
+// PreprocessImage 加载图片（链接下载经过 SSRF 校验），最长边超过 maxLongEdge 时等比缩放并重新编码为 data URL；
+// 无需缩放时，链接在 forceBase64 为 true 时转为 data URL，否则原样返回
+func PreprocessImage(c *gin.Context, imageUrl string, maxLongEdge int, jpegQuality int, forceBase64 bool) (string, error) {
+	isURL := strings.HasPrefix(imageUrl, "http://") || strings.HasPrefix(imageUrl, "https://")
+	if maxLongEdge <= 0 && !(isURL && forceBase64) {
+		return imageUrl, nil
+	}
+
+	var source *types.FileSource
+	if isURL {
+		source = types.NewURLFileSource(imageUrl)
+	} else {
+		source = types.NewBase64FileSource(imageUrl, "")
+	}
+	cachedData, err := LoadFileSource(c, source, "vision_preprocess")
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(cachedData.MimeType, "image/") {
+		return "", fmt.Errorf("unsupported image content type: %s", cachedData.MimeType)
+	}
+	base64Data, err := cachedData.GetBase64Data()
+	if err != nil {
+		return "", fmt.Errorf("failed to get image data: %w", err)
+	}
+
+	config, format, err := GetImageConfig(c, source)
+	// gif 可能为动图，缩放会丢失动画帧，只做格式转换
+	needResize := err == nil && format != "gif" && maxLongEdge > 0 && max(config.Width, config.Height) > maxLongEdge
+	if !needResize {
+		if isURL && forceBase64 {
+			return fmt.Sprintf("data:%s;base64,%s", cachedData.MimeType, base64Data), nil
+		}
+		return imageUrl, nil
+	}
+
+	decodedData, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image data: %w", err)
+	}
+	// 解码前按实际数据检查尺寸，避免超大图片解码时占用过多内存
+	config, _, err = image.DecodeConfig(bytes.NewReader(decodedData))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image config: %w", err)
+	}
+	if int64(config.Width)*int64(config.Height) > maxPreprocessImagePixels {
+		return "", fmt.Errorf("image too large: %dx%d exceeds %d pixels", config.Width, config.Height, maxPreprocessImagePixels)
+	}
+	src, _, err := image.Decode(bytes.NewReader(decodedData))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	scale := float64(maxLongEdge) / float64(max(config.Width, config.Height))
+	width := max(int(float64(config.Width)*scale), 1)
+	height := max(int(float64(config.Height)*scale), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	buffer := &bytes.Buffer{}
+	mimeType := "image/png"
+	if format == "jpeg" {
+		mimeType = "image/jpeg"
+		err = jpeg.Encode(buffer, dst, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		// png、webp 等可能带透明通道，统一编码为 png
+		err = png.Encode(buffer, dst)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to encode resized image: %w", err)
+	}
+	if common.DebugEnabled {
+		logger.LogDebug(c, fmt.Sprintf("image resized from %dx%d to %dx%d", config.Width, config.Height, width, height))
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(buffer.Bytes())), nil
+}
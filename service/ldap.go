@@ -0,0 +1,191 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/ldap"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+const ldapTimeout = 10 * time.Second
+
+var ErrLdapInvalidCredentials = errors.New("LDAP 用户名或密码错误")
+
+// LdapUser 从目录中读取的用户信息
+type LdapUser struct {
+	DN          string
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+// ldapConnect 建立连接并使用服务账号绑定
+func ldapConnect(settings *system_setting.LDAPSettings) (*ldap.Conn, error) {
+	if settings.URL == "" || settings.BaseDN == "" {
+		return nil, errors.New("LDAP 未配置服务器地址或 Base DN")
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+	conn, err := ldap.Dial(settings.URL, ldapTimeout, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if settings.StartTLS && strings.HasPrefix(settings.URL, "ldap://") {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if settings.BindDN != "" {
+		if err = conn.Bind(settings.BindDN, settings.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func ldapAttributes(settings *system_setting.LDAPSettings) []string {
+	attrs := []string{}
+	for _, attr := range []string{settings.UsernameAttribute, settings.EmailAttribute, settings.DisplayNameAttribute, settings.GroupAttribute} {
+		if attr != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+func toLdapUser(settings *system_setting.LDAPSettings, entry *ldap.Entry) *LdapUser {
+	user := &LdapUser{
+		DN:          entry.DN,
+		Username:    entry.GetAttributeValue(settings.UsernameAttribute),
+		Email:       entry.GetAttributeValue(settings.EmailAttribute),
+		DisplayName: entry.GetAttributeValue(settings.DisplayNameAttribute),
+	}
+	if settings.GroupAttribute != "" {
+		user.Groups = entry.GetAttributeValues(settings.GroupAttribute)
+	}
+	return user
+}
+
+// LdapAuthenticate 以服务账号搜索登录名对应的条目，再用该条目 DN 和用户密码绑定校验
+func LdapAuthenticate(username string, password string) (*LdapUser, error) {
+	// 空密码会被服务器视为匿名绑定而成功，必须拒绝
+	if username == "" || password == "" {
+		return nil, ErrLdapInvalidCredentials
+	}
+	settings := system_setting.GetLDAPSettings()
+	conn, err := ldapConnect(settings)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     settings.BaseDN,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     strings.ReplaceAll(settings.UserFilter, "%s", ldap.EscapeFilter(username)),
+		Attributes: ldapAttributes(settings),
+		SizeLimit:  2,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, ErrLdapInvalidCredentials
+	}
+	if err = conn.Bind(entries[0].DN, password); err != nil {
+		if ldap.IsResultCode(err, ldap.ResultInvalidCredentials) {
+			return nil, ErrLdapInvalidCredentials
+		}
+		return nil, err
+	}
+	user := toLdapUser(settings, entries[0])
+	if user.Username == "" {
+		user.Username = username
+	}
+	return user, nil
+}
+
+// ldapLookup 按 DN 读取条目，条目已被删除时返回 nil
+func ldapLookup(conn *ldap.Conn, settings *system_setting.LDAPSettings, dn string) (*LdapUser, error) {
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     dn,
+		Scope:      ldap.ScopeBaseObject,
+		Filter:     "(objectClass=*)",
+		Attributes: ldapAttributes(settings),
+	})
+	if ldap.IsResultCode(err, ldap.ResultNoSuchObject) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return toLdapUser(settings, entries[0]), nil
+}
+
+func parseLdapGroupRoleMapping(mapping string) (map[string]int, error) {
+	roles := make(map[string]int)
+	if strings.TrimSpace(mapping) == "" {
+		return roles, nil
+	}
+	raw := make(map[string]string)
+	if err := json.Unmarshal([]byte(mapping), &raw); err != nil {
+		return nil, err
+	}
+	for group, role := range raw {
+		switch role {
+		case "admin":
+			roles[strings.ToLower(group)] = common.RoleAdminUser
+		case "common":
+			roles[strings.ToLower(group)] = common.RoleCommonUser
+		default:
+			return nil, fmt.Errorf("组 %s 的角色 %s 无效，只能为 admin 或 common", group, role)
+		}
+	}
+	return roles, nil
+}
+
+// ValidateLdapGroupRoleMapping 校验组角色映射配置
+func ValidateLdapGroupRoleMapping(mapping string) error {
+	_, err := parseLdapGroupRoleMapping(mapping)
+	return err
+}
+
+// LdapMapRole 根据所属组计算角色，组可以用完整 DN 或首个 RDN 的值匹配，命中多个时取最高角色。
+// 未配置映射时返回 false，保持用户现有角色
+func LdapMapRole(groups []string) (int, bool) {
+	roles, err := parseLdapGroupRoleMapping(system_setting.GetLDAPSettings().GroupRoleMapping)
+	if err != nil || len(roles) == 0 {
+		return 0, false
+	}
+	role := common.RoleCommonUser
+	for _, group := range groups {
+		group = strings.ToLower(group)
+		mapped, ok := roles[group]
+		if !ok {
+			mapped, ok = roles[ldapGroupName(group)]
+		}
+		if ok && mapped > role {
+			role = mapped
+		}
+	}
+	return role, true
+}
+
+// ldapGroupName 取 cn=admins,ou=groups,dc=example 中的 admins
+func ldapGroupName(dn string) string {
+	first, _, _ := strings.Cut(dn, ",")
+	if _, value, ok := strings.Cut(first, "="); ok {
+		return strings.TrimSpace(value)
+	}
+	return dn
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	ldapSyncTickInterval = 1 * time.Minute
+	ldapSyncBatchSize    = 100
+)
+
+var (
+	ldapSyncOnce    sync.Once
+	ldapSyncRunning atomic.Bool
+	ldapSyncLast    atomic.Int64
+)
+
+// StartLdapSyncTask 按配置的间隔从目录同步 LDAP 用户的组与角色，条目被删除的用户会被禁用
+func StartLdapSyncTask() {
+	ldapSyncOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("ldap sync task started: tick=%s", ldapSyncTickInterval))
+			ticker := time.NewTicker(ldapSyncTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				settings := system_setting.GetLDAPSettings()
+				if !settings.Enabled || settings.SyncInterval <= 0 || !model.IsLeader() {
+					continue
+				}
+				now := time.Now().Unix()
+				if now-ldapSyncLast.Load() < int64(settings.SyncInterval)*60 {
+					continue
+				}
+				ldapSyncLast.Store(now)
+				runLdapSyncOnce()
+			}
+		})
+	})
+}
+
+func runLdapSyncOnce() {
+	if !ldapSyncRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer ldapSyncRunning.Store(false)
+
+	ctx := context.Background()
+	settings := system_setting.GetLDAPSettings()
+	conn, err := ldapConnect(settings)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("ldap sync task failed to connect: %v", err))
+		return
+	}
+	defer conn.Close()
+
+	updated := 0
+	disabled := 0
+	lastId := 0
+	for {
+		users, err := model.GetLdapUsers(lastId, ldapSyncBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("ldap sync task failed to load users: %v", err))
+			return
+		}
+		for _, user := range users {
+			lastId = user.Id
+			entry, err := ldapLookup(conn, settings, user.LdapDn)
+			if err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("ldap sync task failed to look up user %d: %v", user.Id, err))
+				return
+			}
+			role, status := user.Role, user.Status
+			if entry == nil {
+				status = common.UserStatusDisabled
+			} else if mapped, ok := LdapMapRole(entry.Groups); ok && user.Role != common.RoleRootUser {
+				role = mapped
+			}
+			if role == user.Role && status == user.Status {
+				continue
+			}
+			if err = model.UpdateLdapUserRoleAndStatus(user.Id, role, status); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("ldap sync task failed to update user %d: %v", user.Id, err))
+				continue
+			}
+			if status != user.Status {
+				disabled++
+			} else {
+				updated++
+			}
+		}
+		if len(users) < ldapSyncBatchSize {
+			break
+		}
+	}
+	if updated > 0 || disabled > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("ldap sync task: roles updated=%d, disabled=%d", updated, disabled))
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"math"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
@@ -49,6 +50,23 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if embeddingRequest, ok := relayInfo.Request.(*dto.EmbeddingRequest); ok && embeddingRequest.Dimensions > 0 {
+		other["dimensions"] = embeddingRequest.Dimensions
+	}
+
+	if redactions, ok := common.GetContextKey(ctx, constant.ContextKeyPIIRedactions); ok {
+		other["pii_redactions"] = redactions
+	}
+	if common.GetContextKeyBool(ctx, constant.ContextKeyGuardrailApplied) {
+		other["guardrail_applied"] = true
+	}
+	if adjustments, ok := common.GetContextKey(ctx, constant.ContextKeyParamPolicyAdjustments); ok {
+		other["param_policy_adjustments"] = adjustments
+	}
+
+	if client := common.GetContextKeyString(ctx, constant.ContextKeyCLIClient); client != "" {
+		other["cli_client"] = client
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
@@ -63,6 +81,13 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		adminInfo["multi_key_index"] = common.GetContextKeyInt(ctx, constant.ContextKeyChannelMultiKeyIndex)
 	}
 
+	if requestedModel := common.GetContextKeyString(ctx, constant.ContextKeyRequestedModel); requestedModel != "" {
+		adminInfo["requested_model"] = requestedModel
+	}
+	if failovers := common.GetContextKeyInt(ctx, constant.ContextKeyStreamFailovers); failovers > 0 {
+		adminInfo["stream_failovers"] = failovers
+	}
+
 	isLocalCountTokens := common.GetContextKeyBool(ctx, constant.ContextKeyLocalCountTokens)
 	if isLocalCountTokens {
 		adminInfo["local_count_tokens"] = isLocalCountTokens
@@ -74,9 +99,39 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	appendRequestPath(ctx, relayInfo, other)
 	appendRequestConversionChain(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
+	appendPricingRule(relayInfo.PriceData.PricingRule, relayInfo.PriceData.PricingRatio, other)
+	appendFreeTier(relayInfo, other)
+	appendAudioDuration(ctx, other)
 	return other
 }
 
+func appendFreeTier(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo.FreeTierRequest {
+		other["free_tier"] = true
+	} else if relayInfo.FreeTierTokens > 0 {
+		other["free_tier"] = true
+		other["free_tier_tokens"] = relayInfo.FreeTierTokens
+	}
+}
+
+// appendPricingRule 记录命中的差异化定价规则，model_ratio/model_price 已是规则生效后的值
+func appendPricingRule(rule string, ratio float64, other map[string]interface{}) {
+	if rule == "" {
+		return
+	}
+	other["pricing_rule"] = rule
+	other["pricing_ratio"] = ratio
+}
+
+func appendAudioDuration(ctx *gin.Context, other map[string]interface{}) {
+	if ctx == nil || other == nil {
+		return
+	}
+	if duration, ok := common.GetContextKeyType[float64](ctx, constant.ContextKeyAudioDurationSeconds); ok && duration > 0 {
+		other["audio_seconds"] = math.Round(duration*100) / 100
+	}
+}
+
 func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil {
 		return
@@ -211,6 +266,7 @@ func GenerateMjOtherInfo(relayInfo *relaycommon.RelayInfo, priceData types.PerCa
 	if priceData.GroupRatioInfo.HasSpecialRatio {
 		other["user_group_ratio"] = priceData.GroupRatioInfo.GroupSpecialRatio
 	}
+	appendPricingRule(priceData.PricingRule, priceData.PricingRatio, other)
 	appendRequestPath(nil, relayInfo, other)
 	return other
 }
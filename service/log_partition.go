@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const logPartitionTickInterval = 6 * time.Hour
+
+var logPartitionOnce sync.Once
+
+// StartLogPartitionTask 日志表已分区时定期预建后续月份的分区
+func StartLogPartitionTask() {
+	logPartitionOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(logPartitionTickInterval)
+			defer ticker.Stop()
+			for {
+				if model.IsLeader() {
+					if err := model.EnsureLogPartitions(); err != nil {
+						logger.LogWarn(context.Background(), fmt.Sprintf("failed to create log partitions: %v", err))
+					}
+				}
+				<-ticker.C
+			}
+		})
+	})
+}
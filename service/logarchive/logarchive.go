@@ -0,0 +1,334 @@
+package logarchive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/filestorage"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	archiveCheckInterval    = 10 * time.Minute
+	archiveMaxBatchesPerRun = 100
+	archiveRetentionBatch   = 100
+)
+
+var ErrArchiveRunning = errors.New("log archive is already running")
+
+var (
+	archiveOnce    sync.Once
+	archiveRunning atomic.Bool
+	archiveLastRun time.Time
+)
+
+// Query 归档日志查询条件，零值表示不限
+type Query struct {
+	StartTimestamp int64
+	EndTimestamp   int64
+	Type           int
+	Username       string
+	TokenName      string
+	ModelName      string
+	ChannelId      int
+	Group          string
+	RequestId      string
+}
+
+func (q *Query) match(log *model.Log) bool {
+	if q.StartTimestamp != 0 && log.CreatedAt < q.StartTimestamp {
+		return false
+	}
+	if q.EndTimestamp != 0 && log.CreatedAt > q.EndTimestamp {
+		return false
+	}
+	if q.Type != model.LogTypeUnknown && log.Type != q.Type {
+		return false
+	}
+	if q.Username != "" && log.Username != q.Username {
+		return false
+	}
+	if q.TokenName != "" && log.TokenName != q.TokenName {
+		return false
+	}
+	if q.ModelName != "" && !strings.HasPrefix(log.ModelName, q.ModelName) {
+		return false
+	}
+	if q.ChannelId != 0 && log.ChannelId != q.ChannelId {
+		return false
+	}
+	if q.Group != "" && log.Group != q.Group {
+		return false
+	}
+	if q.RequestId != "" && log.RequestId != q.RequestId {
+		return false
+	}
+	return true
+}
+
+func StartLogArchiveTask() {
+	archiveOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		// 以最近一次归档时间为准，避免重启后立即重复执行
+		if latest, err := model.GetLatestLogArchive(); err == nil {
+			archiveLastRun = time.Unix(latest.CreatedAt, 0)
+		}
+		gopool.Go(func() {
+			for {
+				setting := operation_setting.GetLogArchiveSetting()
+				interval := time.Duration(setting.IntervalHours) * time.Hour
+				if interval <= 0 {
+					interval = 24 * time.Hour
+				}
+				if setting.Enabled && time.Since(archiveLastRun) >= interval && model.IsLeader() {
+					if _, err := Run(context.Background()); err != nil && !errors.Is(err, ErrArchiveRunning) {
+						common.SysError("log archive failed: " + err.Error())
+					}
+				}
+				time.Sleep(archiveCheckInterval)
+			}
+		})
+	})
+}
+
+// Run 执行一次归档并清理过期的归档文件，返回本次归档的日志条数
+func Run(ctx context.Context) (int, error) {
+	if !archiveRunning.CompareAndSwap(false, true) {
+		return 0, ErrArchiveRunning
+	}
+	defer archiveRunning.Store(false)
+	archiveLastRun = time.Now()
+
+	setting := operation_setting.GetLogArchiveSetting()
+	storage, err := filestorage.GetStorage(setting.StorageDriver)
+	if err != nil {
+		return 0, err
+	}
+	days := setting.ArchiveAfterDays
+	if days <= 0 {
+		days = 30
+	}
+	batchSize := setting.BatchSize
+	if batchSize <= 0 {
+		batchSize = 10000
+	}
+	cutoff := time.Now().AddDate(0, 0, -days).Unix()
+
+	// 从上次归档的位置继续，未删除原日志时也不会重复导出
+	lastId, err := model.GetLastArchivedLogId()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for i := 0; i < archiveMaxBatchesPerRun; i++ {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		logs, err := model.GetLogsForArchive(lastId, cutoff, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(logs) == 0 {
+			break
+		}
+		if err := archiveBatch(ctx, storage, setting, logs, cutoff); err != nil {
+			return total, err
+		}
+		total += len(logs)
+		lastId = logs[len(logs)-1].Id
+		if len(logs) < batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		common.SysLog(fmt.Sprintf("archived %d logs before %s", total, time.Unix(cutoff, 0).Format(time.DateOnly)))
+	}
+	if err := applyArchiveRetention(ctx, setting); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+func archiveKey(prefix string, logs []*model.Log) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		prefix = "log-archive"
+	}
+	day := time.Unix(logs[0].CreatedAt, 0).Format("2006/01/02")
+	return fmt.Sprintf("%s/%s/%d-%d.jsonl.gz", prefix, day, logs[0].Id, logs[len(logs)-1].Id)
+}
+
+func encodeLogs(logs []*model.Log) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	for _, log := range logs {
+		data, err := common.Marshal(log)
+		if err != nil {
+			return nil, err
+		}
+		writer.Write(data)
+		writer.Write([]byte{'\n'})
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func archiveBatch(ctx context.Context, storage filestorage.Storage, setting *operation_setting.LogArchiveSetting, logs []*model.Log, cutoff int64) error {
+	data, err := encodeLogs(logs)
+	if err != nil {
+		return err
+	}
+	key := archiveKey(setting.KeyPrefix, logs)
+	if err := storage.Put(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("upload %s: %w", key, err)
+	}
+	archive := &model.LogArchive{
+		Storage:   setting.StorageDriver,
+		ObjectKey: key,
+		StartId:   logs[0].Id,
+		EndId:     logs[len(logs)-1].Id,
+		StartTime: logs[0].CreatedAt,
+		EndTime:   logs[0].CreatedAt,
+		RowCount:  len(logs),
+		Size:      int64(len(data)),
+		CreatedAt: common.GetTimestamp(),
+	}
+	if archive.Storage == "" {
+		archive.Storage = operation_setting.GetFileSetting().StorageDriver
+	}
+	for _, log := range logs {
+		archive.StartTime = min(archive.StartTime, log.CreatedAt)
+		archive.EndTime = max(archive.EndTime, log.CreatedAt)
+	}
+	if err := model.CreateLogArchive(archive); err != nil {
+		return err
+	}
+	if !setting.DeleteAfterArchive {
+		return nil
+	}
+	if _, err := model.DeleteArchivedLogs(archive.StartId, archive.EndId, cutoff); err != nil {
+		return err
+	}
+	return model.UpdateLogArchivePurged(archive.Id, true)
+}
+
+// applyArchiveRetention 删除超过保留天数的归档文件
+func applyArchiveRetention(ctx context.Context, setting *operation_setting.LogArchiveSetting) error {
+	if setting.ArchiveRetentionDays <= 0 {
+		return nil
+	}
+	timestamp := time.Now().AddDate(0, 0, -setting.ArchiveRetentionDays).Unix()
+	for {
+		archives, err := model.GetExpiredLogArchives(timestamp, archiveRetentionBatch)
+		if err != nil {
+			return err
+		}
+		for _, archive := range archives {
+			storage, err := filestorage.GetStorage(archive.Storage)
+			if err != nil {
+				return err
+			}
+			if err := storage.Delete(ctx, archive.ObjectKey); err != nil && !errors.Is(err, filestorage.ErrNotFound) {
+				return err
+			}
+			if err := model.DeleteLogArchive(archive.Id); err != nil {
+				return err
+			}
+		}
+		if len(archives) < archiveRetentionBatch {
+			return nil
+		}
+	}
+}
+
+// Open 打开归档文件的压缩内容
+func Open(ctx context.Context, archive *model.LogArchive) (io.ReadCloser, error) {
+	storage, err := filestorage.GetStorage(archive.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(ctx, archive.ObjectKey)
+}
+
+// readArchive 逐条读取归档中的日志，fn 返回 false 时停止
+func readArchive(ctx context.Context, archive *model.LogArchive, fn func(log *model.Log) bool) error {
+	reader, err := Open(ctx, archive)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var log model.Log
+		if err := common.Unmarshal(scanner.Bytes(), &log); err != nil {
+			return err
+		}
+		if !fn(&log) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// Search 在与时间范围有交集的归档中查找日志，最多返回 limit 条
+func Search(ctx context.Context, query *Query, limit int) ([]*model.Log, error) {
+	archives, _, err := model.GetLogArchives(query.StartTimestamp, query.EndTimestamp, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]*model.Log, 0)
+	for _, archive := range archives {
+		err := readArchive(ctx, archive, func(log *model.Log) bool {
+			if query.match(log) {
+				logs = append(logs, log)
+			}
+			return len(logs) < limit
+		})
+		if err != nil {
+			return logs, fmt.Errorf("read %s: %w", archive.ObjectKey, err)
+		}
+		if len(logs) >= limit {
+			break
+		}
+	}
+	return logs, nil
+}
+
+// Restore 把归档中的日志写回数据库，返回实际写入的条数
+func Restore(ctx context.Context, archive *model.LogArchive) (int64, error) {
+	logs := make([]*model.Log, 0, archive.RowCount)
+	if err := readArchive(ctx, archive, func(log *model.Log) bool {
+		logs = append(logs, log)
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	return model.RestoreLogs(logs)
+}
+
+func IsRunning() bool {
+	return archiveRunning.Load()
+}
@@ -0,0 +1,451 @@
+package logexport
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/filestorage"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	exportBatchSize       = 1000
+	exportTimeout         = time.Hour
+	exportStaleTimeout    = 2 * time.Hour // 超过该时长仍未完成的导出视为已中断
+	exportCleanupInterval = 10 * time.Minute
+	exportCleanupBatch    = 100
+)
+
+var (
+	exportRunning     atomic.Int32
+	exportCleanupOnce sync.Once
+)
+
+// Request 用户提交的导出条件
+type Request struct {
+	Format         string `json:"format"`
+	Type           int    `json:"type"`
+	StartTimestamp int64  `json:"start_timestamp"`
+	EndTimestamp   int64  `json:"end_timestamp"`
+	ModelName      string `json:"model_name"`
+	TokenName      string `json:"token_name"`
+}
+
+// exportRow 导出文件中的一行，只包含用户可见字段
+type exportRow struct {
+	CreatedAt        int64  `json:"created_at"`
+	Type             int    `json:"type"`
+	TokenName        string `json:"token_name"`
+	ModelName        string `json:"model_name"`
+	Group            string `json:"group"`
+	Quota            int    `json:"quota"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	UseTime          int    `json:"use_time"`
+	IsStream         bool   `json:"is_stream"`
+	RequestId        string `json:"request_id"`
+	Ip               string `json:"ip"`
+	Content          string `json:"content"`
+	Other            string `json:"other"`
+}
+
+var csvHeader = []string{"Time", "Type", "Token", "Model", "Group", "Quota", "Prompt tokens", "Completion tokens",
+	"Use time (s)", "Stream", "Request ID", "IP", "Content", "Other"}
+
+func newExportRow(log *model.Log) *exportRow {
+	return &exportRow{
+		CreatedAt:        log.CreatedAt,
+		Type:             log.Type,
+		TokenName:        log.TokenName,
+		ModelName:        log.ModelName,
+		Group:            log.Group,
+		Quota:            log.Quota,
+		PromptTokens:     log.PromptTokens,
+		CompletionTokens: log.CompletionTokens,
+		UseTime:          log.UseTime,
+		IsStream:         log.IsStream,
+		RequestId:        log.RequestId,
+		Ip:               log.Ip,
+		Content:          log.Content,
+		Other:            log.Other,
+	}
+}
+
+func formatTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
+
+// csvSafe 避免以公式字符开头的单元格在表格软件中被当作公式执行
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (r *exportRow) csvRecord() []string {
+	return []string{
+		formatTime(r.CreatedAt),
+		strconv.Itoa(r.Type),
+		csvSafe(r.TokenName),
+		csvSafe(r.ModelName),
+		csvSafe(r.Group),
+		strconv.Itoa(r.Quota),
+		strconv.Itoa(r.PromptTokens),
+		strconv.Itoa(r.CompletionTokens),
+		strconv.Itoa(r.UseTime),
+		strconv.FormatBool(r.IsStream),
+		r.RequestId,
+		r.Ip,
+		csvSafe(r.Content),
+		csvSafe(r.Other),
+	}
+}
+
+// Create 校验导出条件与并发限制并创建导出任务，文件在后台生成
+func Create(userId int, req *Request) (*model.LogExport, error) {
+	setting := operation_setting.GetLogExportSetting()
+	if !setting.Enabled {
+		return nil, errors.New("日志导出功能未开启")
+	}
+	if req.Format == "" {
+		req.Format = model.LogExportFormatCSV
+	}
+	if req.Format != model.LogExportFormatCSV && req.Format != model.LogExportFormatJSONL {
+		return nil, fmt.Errorf("不支持的导出格式：%s", req.Format)
+	}
+	if req.StartTimestamp <= 0 || req.EndTimestamp <= 0 || req.EndTimestamp < req.StartTimestamp {
+		return nil, errors.New("请指定有效的起止时间")
+	}
+	if setting.MaxRangeDays > 0 && req.EndTimestamp-req.StartTimestamp > int64(setting.MaxRangeDays)*86400 {
+		return nil, fmt.Errorf("单次导出的时间跨度不能超过 %d 天", setting.MaxRangeDays)
+	}
+	if setting.MaxConcurrentPerUser > 0 {
+		active, err := model.CountUserActiveLogExports(userId)
+		if err != nil {
+			return nil, err
+		}
+		if active >= int64(setting.MaxConcurrentPerUser) {
+			return nil, fmt.Errorf("已有 %d 个导出正在进行，请等待完成后再试", active)
+		}
+	}
+	export := &model.LogExport{
+		ExportId:       "export-" + common.GetUUID(),
+		UserId:         userId,
+		Format:         req.Format,
+		Status:         model.LogExportStatusPending,
+		LogType:        req.Type,
+		StartTimestamp: req.StartTimestamp,
+		EndTimestamp:   req.EndTimestamp,
+		ModelName:      req.ModelName,
+		TokenName:      req.TokenName,
+		CreatedAt:      common.GetTimestamp(),
+	}
+	if err := model.CreateLogExport(export); err != nil {
+		return nil, err
+	}
+	gopool.Go(func() {
+		run(export)
+	})
+	return export, nil
+}
+
+// acquireSlot 限制单个实例同时生成的导出数量，超出时等待
+func acquireSlot(ctx context.Context) error {
+	for {
+		limit := int32(operation_setting.GetLogExportSetting().MaxConcurrent)
+		running := exportRunning.Load()
+		if limit <= 0 || running < limit {
+			if exportRunning.CompareAndSwap(running, running+1) {
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func run(export *model.LogExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	if err := acquireSlot(ctx); err != nil {
+		finish(export, model.LogExportStatusPending, fmt.Errorf("排队超时：%w", err))
+		return
+	}
+	defer exportRunning.Add(-1)
+
+	export.Status = model.LogExportStatusProcessing
+	if ok, err := model.UpdateLogExportStatus(export, model.LogExportStatusPending); err != nil || !ok {
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to start log export %s: %s", export.ExportId, err.Error()))
+		}
+		return
+	}
+	finish(export, model.LogExportStatusProcessing, writeFile(ctx, export))
+}
+
+// writeFile 把日志写入临时文件后上传到存储后端，达到行数或大小上限时截断
+func writeFile(ctx context.Context, export *model.LogExport) error {
+	setting := operation_setting.GetLogExportSetting()
+	maxBytes := int64(setting.MaxSizeMB) << 20
+
+	tmp, err := os.CreateTemp("", "log-export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	buffered := bufio.NewWriter(tmp)
+	var line strings.Builder
+	csvWriter := csv.NewWriter(&line)
+	// encodeRow 把一行编码到 line 中，返回编码后的内容
+	encodeRow := func(record []string, row *exportRow) (string, error) {
+		line.Reset()
+		if export.Format == model.LogExportFormatJSONL {
+			data, err := common.Marshal(row)
+			if err != nil {
+				return "", err
+			}
+			line.Write(data)
+			line.WriteByte('\n')
+		} else {
+			if err := csvWriter.Write(record); err != nil {
+				return "", err
+			}
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return "", err
+			}
+		}
+		return line.String(), nil
+	}
+
+	var written int64
+	if export.Format == model.LogExportFormatCSV {
+		// Excel 依赖 BOM 识别 UTF-8
+		header, err := encodeRow(csvHeader, nil)
+		if err != nil {
+			return err
+		}
+		header = "\xEF\xBB\xBF" + header
+		if _, err := buffered.WriteString(header); err != nil {
+			return err
+		}
+		written += int64(len(header))
+	}
+
+	err = model.IterateUserLogs(export.UserId, export.LogType, export.StartTimestamp, export.EndTimestamp, export.ModelName, export.TokenName,
+		exportBatchSize, func(logs []*model.Log) (bool, error) {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+			for _, log := range logs {
+				if setting.MaxRows > 0 && export.Rows >= setting.MaxRows {
+					export.Truncated = true
+					return false, nil
+				}
+				row := newExportRow(log)
+				var record []string
+				if export.Format == model.LogExportFormatCSV {
+					record = row.csvRecord()
+				}
+				encoded, err := encodeRow(record, row)
+				if err != nil {
+					return false, err
+				}
+				if maxBytes > 0 && written+int64(len(encoded)) > maxBytes {
+					export.Truncated = true
+					return false, nil
+				}
+				if _, err := buffered.WriteString(encoded); err != nil {
+					return false, err
+				}
+				written += int64(len(encoded))
+				export.Rows++
+			}
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, 0); err != nil {
+		return err
+	}
+
+	storage, err := filestorage.GetStorage("")
+	if err != nil {
+		return err
+	}
+	export.Storage = operation_setting.GetFileSetting().StorageDriver
+	export.StorageKey = "log_exports/" + strconv.Itoa(export.UserId) + "/" + export.Filename()
+	if err := storage.Put(ctx, export.StorageKey, tmp, written); err != nil {
+		return fmt.Errorf("failed to store export file: %w", err)
+	}
+	export.Bytes = written
+	return nil
+}
+
+// finish 记录导出结果并通知用户
+func finish(export *model.LogExport, fromStatus string, exportErr error) {
+	now := time.Now()
+	export.CompletedAt = now.Unix()
+	if exportErr != nil {
+		export.Status = model.LogExportStatusFailed
+		export.Error = exportErr.Error()
+	} else {
+		export.Status = model.LogExportStatusCompleted
+		export.ExpiresAt = now.Add(time.Duration(operation_setting.GetLogExportSetting().RetentionHours) * time.Hour).Unix()
+	}
+	ok, err := model.UpdateLogExportStatus(export, fromStatus)
+	if err != nil || !ok {
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to update log export %s: %s", export.ExportId, err.Error()))
+		}
+		if export.StorageKey != "" {
+			deleteFile(export)
+		}
+		return
+	}
+	notify(export)
+}
+
+func notify(export *model.LogExport) {
+	user, err := model.GetUserById(export.UserId, true)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get user %d for log export notify: %s", export.UserId, err.Error()))
+		return
+	}
+	var title, content string
+	if export.Status == model.LogExportStatusCompleted {
+		downloadURL, _ := DownloadURL(export)
+		title = "日志导出已完成"
+		content = fmt.Sprintf("您的使用日志导出（%s 至 %s）已生成，共 %d 行", formatTime(export.StartTimestamp),
+			formatTime(export.EndTimestamp), export.Rows)
+		if export.Truncated {
+			content += "，已达到导出上限，仅包含部分日志"
+		}
+		content += fmt.Sprintf("。下载链接 %d 分钟内有效：%s，文件将保留至 %s",
+			operation_setting.GetLogExportSetting().DownloadURLMinutes, downloadURL, formatTime(export.ExpiresAt))
+	} else {
+		title = "日志导出失败"
+		content = fmt.Sprintf("您的使用日志导出（%s 至 %s）生成失败：%s", formatTime(export.StartTimestamp),
+			formatTime(export.EndTimestamp), export.Error)
+	}
+	err = service.NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewNotify(dto.NotifyTypeLogExport, title, content, nil))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send log export notify to user %d: %s", user.Id, err.Error()))
+	}
+}
+
+func downloadSign(exportId string, expires int64) string {
+	return common.GenerateHMAC(fmt.Sprintf("log_export:%s:%d", exportId, expires))
+}
+
+// DownloadURL 生成带签名的下载链接，有效期不超过文件的保留期
+func DownloadURL(export *model.LogExport) (string, int64) {
+	expires := time.Now().Add(time.Duration(operation_setting.GetLogExportSetting().DownloadURLMinutes) * time.Minute).Unix()
+	if export.ExpiresAt > 0 && expires > export.ExpiresAt {
+		expires = export.ExpiresAt
+	}
+	downloadURL := fmt.Sprintf("%s/api/log/export/download/%s?expires=%d&sign=%s", strings.TrimRight(system_setting.ServerAddress, "/"),
+		url.PathEscape(export.ExportId), expires, downloadSign(export.ExportId, expires))
+	return downloadURL, expires
+}
+
+func VerifySign(exportId string, expires int64, sign string) bool {
+	if expires < time.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(sign), []byte(downloadSign(exportId, expires)))
+}
+
+// Open 打开导出文件，调用方负责关闭
+func Open(ctx context.Context, export *model.LogExport) (io.ReadCloser, error) {
+	storage, err := filestorage.GetStorage(export.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(ctx, export.StorageKey)
+}
+
+func deleteFile(export *model.LogExport) {
+	storage, err := filestorage.GetStorage(export.Storage)
+	if err == nil {
+		err = storage.Delete(context.Background(), export.StorageKey)
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to delete log export file %s: %s", export.StorageKey, err.Error()))
+	}
+}
+
+func StartLogExportCleanupTask() {
+	exportCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(exportCleanupInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if model.IsLeader() {
+					cleanup()
+				}
+			}
+		})
+	})
+}
+
+// cleanup 删除过期的导出文件，并把中断的导出置为失败
+func cleanup() {
+	now := time.Now()
+	if n, err := model.FailStaleLogExports(now.Add(-exportStaleTimeout).Unix(), "导出已中断，请重新提交"); err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("log export cleanup failed: %v", err))
+	} else if n > 0 {
+		common.SysLog(fmt.Sprintf("log export cleanup: %d stale exports marked failed", n))
+	}
+	for {
+		exports, err := model.GetExpiredLogExports(now.Unix(), exportCleanupBatch)
+		if err != nil {
+			logger.LogWarn(context.Background(), fmt.Sprintf("log export cleanup failed: %v", err))
+			return
+		}
+		for _, export := range exports {
+			deleteFile(export)
+			if err := model.MarkLogExportExpired(export.Id); err != nil {
+				logger.LogWarn(context.Background(), fmt.Sprintf("log export cleanup failed: %v", err))
+				return
+			}
+		}
+		if len(exports) < exportCleanupBatch {
+			return
+		}
+	}
+}
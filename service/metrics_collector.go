@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	channelStatusDesc = prometheus.NewDesc("newapi_channel_status",
+		"Channel status (1 enabled, 2 manually disabled, 3 auto disabled).",
+		[]string{"channel", "name", "type"}, nil)
+	channelResponseTimeDesc = prometheus.NewDesc("newapi_channel_response_time_milliseconds",
+		"Channel response time from the last test.",
+		[]string{"channel", "name", "type"}, nil)
+	dbUpDesc    = prometheus.NewDesc("newapi_db_up", "Whether the database responds to ping.", nil, nil)
+	redisUpDesc = prometheus.NewDesc("newapi_redis_up", "Whether Redis responds to ping, absent when Redis is disabled.", nil, nil)
+
+	redisDegradedDesc     = prometheus.NewDesc("newapi_redis_degraded", "Whether rate limiting and caching have fallen back to memory because Redis is unavailable.", nil, nil)
+	redisDegradationsDesc = prometheus.NewDesc("newapi_redis_degradations_total", "Times this node entered Redis degraded mode.", nil, nil)
+	redisPingFailuresDesc = prometheus.NewDesc("newapi_redis_ping_failures_total", "Failed Redis health check pings.", nil, nil)
+	redisPingLatencyDesc  = prometheus.NewDesc("newapi_redis_ping_latency_milliseconds", "Latency of the last successful Redis health check ping.", nil, nil)
+)
+
+// systemCollector 抓取时实时读取渠道状态与 DB/Redis 健康状况
+type systemCollector struct{}
+
+func (systemCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- channelStatusDesc
+	ch <- channelResponseTimeDesc
+	ch <- dbUpDesc
+	ch <- redisUpDesc
+	ch <- redisDegradedDesc
+	ch <- redisDegradationsDesc
+	ch <- redisPingFailuresDesc
+	ch <- redisPingLatencyDesc
+}
+
+func (systemCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dbUp := 0.0
+	if sqlDB, err := model.DB.DB(); err == nil && sqlDB.PingContext(ctx) == nil {
+		dbUp = 1
+	}
+	ch <- prometheus.MustNewConstMetric(dbUpDesc, prometheus.GaugeValue, dbUp)
+
+	if redisHealth := common.GetRedisHealthStats(); redisHealth.Configured {
+		redisUp := 0.0
+		if common.RDB.Ping(ctx).Err() == nil {
+			redisUp = 1
+		}
+		redisDegraded := 0.0
+		if redisHealth.Degraded {
+			redisDegraded = 1
+		}
+		ch <- prometheus.MustNewConstMetric(redisUpDesc, prometheus.GaugeValue, redisUp)
+		ch <- prometheus.MustNewConstMetric(redisDegradedDesc, prometheus.GaugeValue, redisDegraded)
+		ch <- prometheus.MustNewConstMetric(redisDegradationsDesc, prometheus.CounterValue, float64(redisHealth.Degradations))
+		ch <- prometheus.MustNewConstMetric(redisPingFailuresDesc, prometheus.CounterValue, float64(redisHealth.PingFailures))
+		ch <- prometheus.MustNewConstMetric(redisPingLatencyDesc, prometheus.GaugeValue, float64(redisHealth.LastPingLatency))
+	}
+
+	if dbUp == 0 {
+		return
+	}
+	channels, err := model.GetChannelsForMetrics()
+	if err != nil {
+		common.SysError("failed to load channels for metrics: " + err.Error())
+		return
+	}
+	for _, channel := range channels {
+		labels := []string{strconv.Itoa(channel.Id), channel.Name, strconv.Itoa(channel.Type)}
+		ch <- prometheus.MustNewConstMetric(channelStatusDesc, prometheus.GaugeValue, float64(channel.Status), labels...)
+		ch <- prometheus.MustNewConstMetric(channelResponseTimeDesc, prometheus.GaugeValue, float64(channel.ResponseTime), labels...)
+	}
+}
+
+func init() {
+	metrics.Registry.MustRegister(systemCollector{})
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -13,6 +14,8 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting"
 
@@ -257,3 +260,28 @@ func DoMidjourneyHttpRequest(c *gin.Context, timeout time.Duration, fullRequestU
 		Response:   midjResponse,
 	}, responseBody, nil
 }
+
+// SaveMidjourneyTask 保存轮询或上游回调得到的任务状态，任务已经结束时不再覆盖。
+// 上游返回失败时将任务置为结束并退还额度，多个实例同时处理同一任务时只有写入结束状态的一方退还
+func SaveMidjourneyTask(ctx context.Context, task *model.Midjourney) error {
+	shouldReturnQuota := false
+	if (task.Progress != "100%" && task.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
+		logger.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
+		task.Progress = "100%"
+		shouldReturnQuota = task.Quota != 0
+	}
+	updated, err := task.UpdateUnfinished()
+	if err != nil {
+		return err
+	}
+	if !updated || !shouldReturnQuota {
+		return nil
+	}
+	err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
+	if err != nil {
+		logger.LogError(ctx, "fail to increase user quota: "+err.Error())
+	}
+	logContent := fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, logger.LogQuota(task.Quota))
+	model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+var modelRewriteRegexCache sync.Map // map[string]*regexp.Regexp
+
+func getModelRewriteRegex(pattern string) *regexp.Regexp {
+	if re, ok := modelRewriteRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	// 正则需完整匹配模型名
+	compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil
+	}
+	modelRewriteRegexCache.Store(pattern, compiled)
+	return compiled
+}
+
+func modelRewriteRuleActive(rule *operation_setting.ModelRewriteRule, now time.Time) bool {
+	if rule.Disabled {
+		return false
+	}
+	if len(rule.Weekdays) > 0 && !slices.Contains(rule.Weekdays, int(now.Weekday())) {
+		return false
+	}
+	if rule.StartTime == "" || rule.EndTime == "" {
+		return true
+	}
+	current := now.Format("15:04")
+	if rule.StartTime <= rule.EndTime {
+		return current >= rule.StartTime && current < rule.EndTime
+	}
+	// 跨零点，例如 22:00-06:00
+	return current >= rule.StartTime || current < rule.EndTime
+}
+
+func applyModelRewriteRule(rule *operation_setting.ModelRewriteRule, modelName string) (string, bool) {
+	if !rule.Regex {
+		return rule.Target, rule.Match == modelName
+	}
+	re := getModelRewriteRegex(rule.Match)
+	if re == nil || !re.MatchString(modelName) {
+		return "", false
+	}
+	return re.ReplaceAllString(modelName, rule.Target), true
+}
+
+// EvaluateModelRewriteRules 分组规则优先于全局规则，同类规则按顺序取第一条命中；只改写一次，不做链式改写
+func EvaluateModelRewriteRules(rules []operation_setting.ModelRewriteRule, modelName string, group string, now time.Time) (string, *operation_setting.ModelRewriteRule) {
+	for _, groupRules := range []bool{true, false} {
+		for i := range rules {
+			rule := &rules[i]
+			if (len(rule.Groups) > 0) != groupRules {
+				continue
+			}
+			if groupRules && !slices.Contains(rule.Groups, group) {
+				continue
+			}
+			if !modelRewriteRuleActive(rule, now) {
+				continue
+			}
+			if target, ok := applyModelRewriteRule(rule, modelName); ok && target != "" {
+				return target, rule
+			}
+		}
+	}
+	return modelName, nil
+}
+
+// ResolveModelRewrite 返回改写后的模型名，未启用或未命中时原样返回
+func ResolveModelRewrite(modelName string, group string) (string, *operation_setting.ModelRewriteRule) {
+	setting := operation_setting.GetModelRewriteSetting()
+	if !setting.Enabled || len(setting.Rules) == 0 {
+		return modelName, nil
+	}
+	return EvaluateModelRewriteRules(setting.Rules, modelName, group, time.Now())
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// ModelRouteFeatures 虚拟模型路由使用的请求特征
+type ModelRouteFeatures struct {
+	PromptTokens int  `json:"prompt_tokens"`
+	HasTools     bool `json:"has_tools"`
+	HasImages    bool `json:"has_images"`
+}
+
+func collectRouteContent(value gjson.Result, text *strings.Builder, features *ModelRouteFeatures) {
+	switch {
+	case value.Type == gjson.String:
+		text.WriteString(value.String())
+		text.WriteString("\n")
+	case value.IsArray():
+		for _, item := range value.Array() {
+			collectRouteContent(item, text, features)
+		}
+	case value.IsObject():
+		switch value.Get("type").String() {
+		case "image_url", "image", "input_image":
+			features.HasImages = true
+			return
+		}
+		for _, key := range []string{"text", "content"} {
+			if item := value.Get(key); item.Exists() {
+				collectRouteContent(item, text, features)
+			}
+		}
+	}
+}
+
+// ExtractModelRouteFeatures 从 OpenAI、Claude 与 Responses 格式的请求体中提取路由特征
+func ExtractModelRouteFeatures(body []byte, modelName string) ModelRouteFeatures {
+	features := ModelRouteFeatures{}
+	var text strings.Builder
+	for _, path := range []string{"system", "messages", "input", "prompt"} {
+		collectRouteContent(gjson.GetBytes(body, path), &text, &features)
+	}
+	features.HasTools = len(gjson.GetBytes(body, "tools").Array()) > 0 || len(gjson.GetBytes(body, "functions").Array()) > 0
+	features.PromptTokens = CountTextToken(text.String(), modelName)
+	return features
+}
+
+func modelRouteRuleMatches(rule *operation_setting.ModelRouteRule, features ModelRouteFeatures, group string) bool {
+	if len(rule.Groups) > 0 && !slices.Contains(rule.Groups, group) {
+		return false
+	}
+	if features.PromptTokens < rule.MinPromptTokens {
+		return false
+	}
+	if rule.MaxPromptTokens > 0 && features.PromptTokens > rule.MaxPromptTokens {
+		return false
+	}
+	if rule.HasTools != nil && *rule.HasTools != features.HasTools {
+		return false
+	}
+	if rule.HasImages != nil && *rule.HasImages != features.HasImages {
+		return false
+	}
+	return true
+}
+
+// EvaluateModelRouter 按顺序返回第一条命中规则的目标模型，均未命中时使用默认模型
+func EvaluateModelRouter(virtual *operation_setting.VirtualModel, features ModelRouteFeatures, group string) (string, *operation_setting.ModelRouteRule) {
+	for i := range virtual.Rules {
+		rule := &virtual.Rules[i]
+		if modelRouteRuleMatches(rule, features, group) {
+			return rule.Target, rule
+		}
+	}
+	return virtual.Default, nil
+}
+
+// ResolveVirtualModel 请求的是虚拟模型时返回路由后的模型名
+func ResolveVirtualModel(c *gin.Context, modelName string, group string) (string, bool) {
+	virtual := operation_setting.GetModelRouterSetting().GetVirtualModel(modelName)
+	if virtual == nil {
+		return modelName, false
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return virtual.Default, true
+	}
+	target, _ := EvaluateModelRouter(virtual, ExtractModelRouteFeatures(body, virtual.Default), group)
+	return target, true
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// ModerationResult 内容审核结果
+type ModerationResult struct {
+	Flagged    bool     `json:"flagged"`
+	Provider   string   `json:"provider"`
+	Categories []string `json:"categories"`
+}
+
+var moderationPatternCache sync.Map
+
+// compileModerationPatterns 编译并缓存正则列表，配置保存时已校验过语法
+func compileModerationPatterns(patterns []string) []*regexp.Regexp {
+	key := strings.Join(patterns, "\x00")
+	if v, ok := moderationPatternCache.Load(key); ok {
+		return v.([]*regexp.Regexp)
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		if re, err := regexp.Compile(p); err == nil {
+			compiled = append(compiled, re)
+		}
+	}
+	moderationPatternCache.Store(key, compiled)
+	return compiled
+}
+
+// ValidateModerationPatterns 校验正则列表
+func ValidateModerationPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("正则表达式 %s 无效: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// ModerateText 依次使用配置的审核方式检查输入，任一命中即返回命中结果
+func ModerateText(ctx context.Context, providers []string, text string) (*ModerationResult, error) {
+	if text == "" {
+		return &ModerationResult{}, nil
+	}
+	setting := operation_setting.GetModerationSetting()
+	for _, provider := range providers {
+		var result *ModerationResult
+		var err error
+		switch provider {
+		case operation_setting.ModerationProviderKeyword:
+			result = moderateByKeyword(setting, text)
+		case operation_setting.ModerationProviderOpenAI:
+			result, err = moderateByOpenAI(ctx, setting, text)
+		case operation_setting.ModerationProviderHTTP:
+			result, err = moderateByHTTP(ctx, setting, text)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s moderation failed: %w", provider, err)
+		}
+		if result.Flagged {
+			result.Provider = provider
+			return result, nil
+		}
+	}
+	return &ModerationResult{}, nil
+}
+
+func moderateByKeyword(setting *operation_setting.ModerationSetting, text string) *ModerationResult {
+	result := &ModerationResult{}
+	if ok, words := AcSearch(strings.ToLower(text), setting.Keywords, true); ok {
+		result.Flagged = true
+		result.Categories = append(result.Categories, "keyword:"+strings.Join(words, ","))
+		return result
+	}
+	for _, re := range compileModerationPatterns(setting.Patterns) {
+		if re.MatchString(text) {
+			result.Flagged = true
+			result.Categories = append(result.Categories, "pattern:"+re.String())
+			return result
+		}
+	}
+	return result
+}
+
+func moderationPost(ctx context.Context, setting *operation_setting.ModerationSetting, url string, payload any, headers map[string]string, out any) error {
+	body, err := common.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(setting.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status code %d: %s", resp.StatusCode, string(data))
+	}
+	return common.Unmarshal(data, out)
+}
+
+func moderateByOpenAI(ctx context.Context, setting *operation_setting.ModerationSetting, text string) (*ModerationResult, error) {
+	if setting.OpenAIAPIKey == "" {
+		return nil, errors.New("api key is not configured")
+	}
+	var resp struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	url := strings.TrimSuffix(setting.OpenAIBaseURL, "/") + "/v1/moderations"
+	err := moderationPost(ctx, setting, url, map[string]any{
+		"model": setting.OpenAIModel,
+		"input": text,
+	}, map[string]string{"Authorization": "Bearer " + setting.OpenAIAPIKey}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	result := &ModerationResult{}
+	for _, r := range resp.Results {
+		if !r.Flagged {
+			continue
+		}
+		result.Flagged = true
+		for category, hit := range r.Categories {
+			if hit {
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+	return result, nil
+}
+
+func moderateByHTTP(ctx context.Context, setting *operation_setting.ModerationSetting, text string) (*ModerationResult, error) {
+	if setting.HTTPURL == "" {
+		return nil, errors.New("classifier url is not configured")
+	}
+	payload := map[string]any{"input": text}
+	headers := map[string]string{}
+	if setting.HTTPSecret != "" {
+		data, err := common.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		headers["X-Webhook-Signature"] = generateSignature(setting.HTTPSecret, data)
+	}
+	result := &ModerationResult{}
+	if err := moderationPost(ctx, setting, setting.HTTPURL, payload, headers, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ShouldModerateRequest 判断当前分组与模型是否需要内容审核
+func ShouldModerateRequest(info *relaycommon.RelayInfo) bool {
+	return len(operation_setting.GetModerationSetting().ResolveProviders(info.UsingGroup, info.OriginModelName)) > 0
+}
+
+// ModerateRelayRequest 转发前审核用户输入，命中时记录日志并返回策略错误
+func ModerateRelayRequest(c *gin.Context, info *relaycommon.RelayInfo, text string) *types.NewAPIError {
+	setting := operation_setting.GetModerationSetting()
+	providers := setting.ResolveProviders(info.UsingGroup, info.OriginModelName)
+	if len(providers) == 0 {
+		return nil
+	}
+	result, err := ModerateText(c.Request.Context(), providers, text)
+	if err != nil {
+		logger.LogWarn(c, err.Error())
+		if setting.FailOpen {
+			return nil
+		}
+		return types.NewErrorWithStatusCode(errors.New("内容审核服务暂时不可用，请稍后重试"), types.ErrorCodeModerationFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+	if !result.Flagged {
+		return nil
+	}
+	categories := strings.Join(result.Categories, ", ")
+	logger.LogWarn(c, fmt.Sprintf("content moderation flagged by %s: %s", result.Provider, categories))
+	content := fmt.Sprintf("内容审核拦截（%s）：%s", result.Provider, categories)
+	model.RecordErrorLog(c, info.UserId, 0, info.OriginModelName, c.GetString("token_name"), content, info.TokenId, 0, info.IsStream, info.UsingGroup, map[string]interface{}{
+		"moderation_provider":   result.Provider,
+		"moderation_categories": result.Categories,
+	})
+	if setting.NotifyAdmins {
+		userId, modelName := info.UserId, info.OriginModelName
+		gopool.Go(func() {
+			NotifyRootUser(dto.NotifyTypeModeration, "内容审核拦截", fmt.Sprintf("用户 %d 调用模型 %s 的请求被内容审核拦截（%s）：%s", userId, modelName, result.Provider, categories))
+		})
+	}
+	return types.NewErrorWithStatusCode(fmt.Errorf("request blocked by content policy: %s", categories), types.ErrorCodeContentPolicyViolation, http.StatusBadRequest, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
@@ -0,0 +1,259 @@
+package openaicompat
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// ResponsesStreamEvent 一条待发送的 Responses SSE 事件
+type ResponsesStreamEvent struct {
+	Type string
+	Data []byte
+}
+
+func responsesUsage(usage *dto.Usage) map[string]any {
+	if usage == nil {
+		return nil
+	}
+	return map[string]any{
+		"input_tokens":  usage.PromptTokens,
+		"output_tokens": usage.CompletionTokens,
+		"total_tokens":  usage.TotalTokens,
+		"input_tokens_details": map[string]any{
+			"cached_tokens": usage.PromptTokensDetails.CachedTokens,
+		},
+		"output_tokens_details": map[string]any{
+			"reasoning_tokens": usage.CompletionTokenDetails.ReasoningTokens,
+		},
+	}
+}
+
+func buildResponsesObject(id string, model string, createdAt int64, finishReason string, output []map[string]any, usage *dto.Usage) map[string]any {
+	status := "completed"
+	var incompleteDetails any
+	if finishReason == "length" {
+		status = "incomplete"
+		incompleteDetails = map[string]any{"reason": "max_output_tokens"}
+	}
+	if output == nil {
+		output = []map[string]any{}
+	}
+	return map[string]any{
+		"id":                 id,
+		"object":             "response",
+		"created_at":         createdAt,
+		"status":             status,
+		"model":              model,
+		"output":             output,
+		"incomplete_details": incompleteDetails,
+		"error":              nil,
+		"usage":              responsesUsage(usage),
+	}
+}
+
+func messageOutputItem(id string, text string, status string) map[string]any {
+	return map[string]any{
+		"type":   "message",
+		"id":     id,
+		"status": status,
+		"role":   "assistant",
+		"content": []map[string]any{
+			{"type": "output_text", "text": text, "annotations": []any{}},
+		},
+	}
+}
+
+func functionCallOutputItem(id string, callId string, name string, arguments string, status string) map[string]any {
+	return map[string]any{
+		"type":      "function_call",
+		"id":        id,
+		"call_id":   callId,
+		"name":      name,
+		"arguments": arguments,
+		"status":    status,
+	}
+}
+
+// ChatCompletionsResponseToResponsesResponse 将 chat/completions 非流式响应转换为 Responses 响应对象
+func ChatCompletionsResponseToResponsesResponse(resp *dto.OpenAITextResponse, responseId string, createdAt int64, usage *dto.Usage) map[string]any {
+	output := make([]map[string]any, 0)
+	finishReason := ""
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		finishReason = choice.FinishReason
+		if text := choice.Message.StringContent(); text != "" {
+			output = append(output, messageOutputItem("msg_"+common.GetUUID(), text, "completed"))
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			output = append(output, functionCallOutputItem("fc_"+common.GetUUID(), toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments, "completed"))
+		}
+	}
+	if usage == nil {
+		usage = &resp.Usage
+	}
+	return buildResponsesObject(responseId, resp.Model, createdAt, finishReason, output, usage)
+}
+
+type streamToolCall struct {
+	itemId      string
+	callId      string
+	name        string
+	arguments   strings.Builder
+	outputIndex int
+}
+
+// ChatToResponsesStreamConverter 将 chat/completions 流式分片转换为 Responses 流式事件
+type ChatToResponsesStreamConverter struct {
+	ResponseId string
+	Model      string
+	CreatedAt  int64
+
+	sequence          int
+	nextOutputIndex   int
+	messageId         string
+	messageIndex      int
+	text              strings.Builder
+	toolCalls         []*streamToolCall
+	toolCallsByIndex  map[int]*streamToolCall
+	finishReason      string
+	finalResponseJSON []byte
+}
+
+func NewChatToResponsesStreamConverter(responseId string, model string, createdAt int64) *ChatToResponsesStreamConverter {
+	return &ChatToResponsesStreamConverter{
+		ResponseId:       responseId,
+		Model:            model,
+		CreatedAt:        createdAt,
+		messageIndex:     -1,
+		toolCallsByIndex: make(map[int]*streamToolCall),
+	}
+}
+
+func (s *ChatToResponsesStreamConverter) event(eventType string, payload map[string]any) ResponsesStreamEvent {
+	payload["type"] = eventType
+	payload["sequence_number"] = s.sequence
+	s.sequence++
+	data, _ := common.Marshal(payload)
+	return ResponsesStreamEvent{Type: eventType, Data: data}
+}
+
+func (s *ChatToResponsesStreamConverter) inProgressResponse() map[string]any {
+	response := buildResponsesObject(s.ResponseId, s.Model, s.CreatedAt, "", nil, nil)
+	response["status"] = "in_progress"
+	return response
+}
+
+func (s *ChatToResponsesStreamConverter) Start() []ResponsesStreamEvent {
+	return []ResponsesStreamEvent{
+		s.event("response.created", map[string]any{"response": s.inProgressResponse()}),
+		s.event("response.in_progress", map[string]any{"response": s.inProgressResponse()}),
+	}
+}
+
+func (s *ChatToResponsesStreamConverter) HandleChunk(chunk *dto.ChatCompletionsStreamResponse) []ResponsesStreamEvent {
+	events := make([]ResponsesStreamEvent, 0)
+	if chunk.Model != "" {
+		s.Model = chunk.Model
+	}
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+		if delta := choice.Delta.GetContentString(); delta != "" {
+			if s.messageIndex < 0 {
+				s.messageId = "msg_" + common.GetUUID()
+				s.messageIndex = s.nextOutputIndex
+				s.nextOutputIndex++
+				item := messageOutputItem(s.messageId, "", "in_progress")
+				item["content"] = []any{}
+				events = append(events,
+					s.event("response.output_item.added", map[string]any{"output_index": s.messageIndex, "item": item}),
+					s.event("response.content_part.added", map[string]any{
+						"item_id": s.messageId, "output_index": s.messageIndex, "content_index": 0,
+						"part": map[string]any{"type": "output_text", "text": "", "annotations": []any{}},
+					}),
+				)
+			}
+			s.text.WriteString(delta)
+			events = append(events, s.event("response.output_text.delta", map[string]any{
+				"item_id": s.messageId, "output_index": s.messageIndex, "content_index": 0, "delta": delta,
+			}))
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			index := 0
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			call, ok := s.toolCallsByIndex[index]
+			if !ok {
+				call = &streamToolCall{
+					itemId:      "fc_" + common.GetUUID(),
+					callId:      toolCall.ID,
+					name:        toolCall.Function.Name,
+					outputIndex: s.nextOutputIndex,
+				}
+				s.nextOutputIndex++
+				s.toolCallsByIndex[index] = call
+				s.toolCalls = append(s.toolCalls, call)
+				events = append(events, s.event("response.output_item.added", map[string]any{
+					"output_index": call.outputIndex,
+					"item":         functionCallOutputItem(call.itemId, call.callId, call.name, "", "in_progress"),
+				}))
+			}
+			if toolCall.Function.Arguments != "" {
+				call.arguments.WriteString(toolCall.Function.Arguments)
+				events = append(events, s.event("response.function_call_arguments.delta", map[string]any{
+					"item_id": call.itemId, "output_index": call.outputIndex, "delta": toolCall.Function.Arguments,
+				}))
+			}
+		}
+	}
+	return events
+}
+
+// Finish 关闭所有输出条目并发送 response.completed
+func (s *ChatToResponsesStreamConverter) Finish(usage *dto.Usage) []ResponsesStreamEvent {
+	events := make([]ResponsesStreamEvent, 0)
+	output := make([]map[string]any, s.nextOutputIndex)
+	if s.messageIndex >= 0 {
+		text := s.text.String()
+		item := messageOutputItem(s.messageId, text, "completed")
+		output[s.messageIndex] = item
+		events = append(events,
+			s.event("response.output_text.done", map[string]any{
+				"item_id": s.messageId, "output_index": s.messageIndex, "content_index": 0, "text": text,
+			}),
+			s.event("response.content_part.done", map[string]any{
+				"item_id": s.messageId, "output_index": s.messageIndex, "content_index": 0,
+				"part": map[string]any{"type": "output_text", "text": text, "annotations": []any{}},
+			}),
+			s.event("response.output_item.done", map[string]any{"output_index": s.messageIndex, "item": item}),
+		)
+	}
+	for _, call := range s.toolCalls {
+		arguments := call.arguments.String()
+		item := functionCallOutputItem(call.itemId, call.callId, call.name, arguments, "completed")
+		output[call.outputIndex] = item
+		events = append(events,
+			s.event("response.function_call_arguments.done", map[string]any{
+				"item_id": call.itemId, "output_index": call.outputIndex, "arguments": arguments,
+			}),
+			s.event("response.output_item.done", map[string]any{"output_index": call.outputIndex, "item": item}),
+		)
+	}
+	response := buildResponsesObject(s.ResponseId, s.Model, s.CreatedAt, s.finishReason, output, usage)
+	s.finalResponseJSON, _ = common.Marshal(response)
+	eventType := "response.completed"
+	if response["status"] == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	events = append(events, s.event(eventType, map[string]any{"response": response}))
+	return events
+}
+
+// FinalResponse 返回 Finish 后的完整响应对象
+func (s *ChatToResponsesStreamConverter) FinalResponse() []byte {
+	return s.finalResponseJSON
+}
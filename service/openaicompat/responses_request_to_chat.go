@@ -0,0 +1,296 @@
+package openaicompat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// responsesContentToChat 将 Responses 的 content（字符串或 input_text/output_text/input_image 数组）转换为 chat content
+func responsesContentToChat(content any) any {
+	parts, ok := content.([]any)
+	if !ok {
+		return content
+	}
+	mediaContents := make([]dto.MediaContent, 0, len(parts))
+	for _, raw := range parts {
+		part, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch common.Interface2String(part["type"]) {
+		case "input_text", "output_text", "text":
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: common.Interface2String(part["text"]),
+			})
+		case "input_image":
+			url := common.Interface2String(part["image_url"])
+			if url == "" {
+				continue
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{
+					Url:    url,
+					Detail: common.Interface2String(part["detail"]),
+				},
+			})
+		case "input_file":
+			file := map[string]any{}
+			if data := common.Interface2String(part["file_data"]); data != "" {
+				file["file_data"] = data
+			}
+			if id := common.Interface2String(part["file_id"]); id != "" {
+				file["file_id"] = id
+			}
+			if name := common.Interface2String(part["filename"]); name != "" {
+				file["filename"] = name
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: file,
+			})
+		}
+	}
+	// 纯文本内容合并为字符串，兼容只接受字符串 content 的上游
+	if len(mediaContents) == 1 && mediaContents[0].Type == dto.ContentTypeText {
+		return mediaContents[0].Text
+	}
+	return mediaContents
+}
+
+func responsesInputToChatMessages(input json.RawMessage) ([]dto.Message, error) {
+	input = bytes.TrimSpace(input)
+	if len(input) == 0 || string(input) == "null" {
+		return nil, nil
+	}
+	if input[0] == '"' {
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		return []dto.Message{{Role: "user", Content: text}}, nil
+	}
+
+	var items []map[string]any
+	if err := common.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	messages := make([]dto.Message, 0, len(items))
+	var pendingToolCalls []dto.ToolCallRequest
+	flushToolCalls := func() error {
+		if len(pendingToolCalls) == 0 {
+			return nil
+		}
+		toolCalls, err := common.Marshal(pendingToolCalls)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, dto.Message{Role: "assistant", Content: "", ToolCalls: toolCalls})
+		pendingToolCalls = nil
+		return nil
+	}
+
+	for _, item := range items {
+		itemType := common.Interface2String(item["type"])
+		if itemType == "function_call" {
+			pendingToolCalls = append(pendingToolCalls, dto.ToolCallRequest{
+				ID:   common.Interface2String(item["call_id"]),
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      common.Interface2String(item["name"]),
+					Arguments: common.Interface2String(item["arguments"]),
+				},
+			})
+			continue
+		}
+		if err := flushToolCalls(); err != nil {
+			return nil, err
+		}
+		switch itemType {
+		case "", "message":
+			role := common.Interface2String(item["role"])
+			if role == "developer" {
+				role = "system"
+			}
+			if role == "" {
+				continue
+			}
+			messages = append(messages, dto.Message{Role: role, Content: responsesContentToChat(item["content"])})
+		case "function_call_output":
+			output := item["output"]
+			if _, ok := output.(string); !ok {
+				data, err := common.Marshal(output)
+				if err != nil {
+					return nil, err
+				}
+				output = string(data)
+			}
+			messages = append(messages, dto.Message{
+				Role:       "tool",
+				Content:    output,
+				ToolCallId: common.Interface2String(item["call_id"]),
+			})
+		default:
+			// reasoning 等条目在 chat/completions 中没有对应结构，直接忽略
+		}
+	}
+	if err := flushToolCalls(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func responsesToolsToChat(tools json.RawMessage) ([]dto.ToolCallRequest, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	var items []map[string]any
+	if err := common.Unmarshal(tools, &items); err != nil {
+		return nil, fmt.Errorf("invalid tools: %w", err)
+	}
+	chatTools := make([]dto.ToolCallRequest, 0, len(items))
+	for _, tool := range items {
+		toolType := common.Interface2String(tool["type"])
+		if toolType != "function" {
+			return nil, fmt.Errorf("tool type %s is not supported in chat completions compatibility mode", toolType)
+		}
+		chatTools = append(chatTools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        common.Interface2String(tool["name"]),
+				Description: common.Interface2String(tool["description"]),
+				Parameters:  tool["parameters"],
+			},
+		})
+	}
+	return chatTools, nil
+}
+
+func responsesToolChoiceToChat(toolChoice json.RawMessage) (any, error) {
+	if len(toolChoice) == 0 {
+		return nil, nil
+	}
+	var choice any
+	if err := common.Unmarshal(toolChoice, &choice); err != nil {
+		return nil, err
+	}
+	m, ok := choice.(map[string]any)
+	if !ok {
+		return choice, nil
+	}
+	if common.Interface2String(m["type"]) == "function" {
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": common.Interface2String(m["name"])},
+		}, nil
+	}
+	return nil, fmt.Errorf("tool_choice type %v is not supported in chat completions compatibility mode", m["type"])
+}
+
+func responsesTextFormatToChat(text json.RawMessage) (*dto.ResponseFormat, error) {
+	if len(text) == 0 {
+		return nil, nil
+	}
+	var textConfig struct {
+		Format map[string]any `json:"format"`
+	}
+	if err := common.Unmarshal(text, &textConfig); err != nil {
+		return nil, err
+	}
+	if textConfig.Format == nil {
+		return nil, nil
+	}
+	switch formatType := common.Interface2String(textConfig.Format["type"]); formatType {
+	case "", "text":
+		return nil, nil
+	case "json_object":
+		return &dto.ResponseFormat{Type: "json_object"}, nil
+	case "json_schema":
+		schema := dto.FormatJsonSchema{
+			Description: common.Interface2String(textConfig.Format["description"]),
+			Name:        common.Interface2String(textConfig.Format["name"]),
+			Schema:      textConfig.Format["schema"],
+		}
+		if strict, ok := textConfig.Format["strict"]; ok {
+			schema.Strict, _ = common.Marshal(strict)
+		}
+		data, err := common.Marshal(schema)
+		if err != nil {
+			return nil, err
+		}
+		return &dto.ResponseFormat{Type: "json_schema", JsonSchema: data}, nil
+	default:
+		return nil, fmt.Errorf("text.format type %s is not supported", formatType)
+	}
+}
+
+// ResponsesRequestToChatCompletionsRequest 将 /v1/responses 请求转换为 chat/completions 请求，
+// 用于不支持 Responses API 的上游；previous_response_id 需在调用前展开
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	if req.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if req.PreviousResponseID != "" {
+		return nil, errors.New("previous_response_id is not supported by this channel unless server-side response storage is enabled")
+	}
+
+	chatReq := &dto.GeneralOpenAIRequest{
+		Model:       req.Model,
+		Stream:      req.Stream,
+		MaxTokens:   req.MaxOutputTokens,
+		Temperature: req.Temperature,
+		User:        req.User,
+		Metadata:    req.Metadata,
+	}
+	if req.TopP != nil {
+		chatReq.TopP = *req.TopP
+	}
+	if req.Stream {
+		chatReq.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	if req.Reasoning != nil && req.Reasoning.Effort != "" {
+		chatReq.ReasoningEffort = req.Reasoning.Effort
+	}
+	if len(req.ParallelToolCalls) > 0 {
+		var parallel bool
+		if err := common.Unmarshal(req.ParallelToolCalls, &parallel); err == nil {
+			chatReq.ParallelTooCalls = &parallel
+		}
+	}
+
+	if len(req.Instructions) > 0 {
+		var instructions string
+		if err := common.Unmarshal(req.Instructions, &instructions); err == nil && strings.TrimSpace(instructions) != "" {
+			chatReq.Messages = append(chatReq.Messages, dto.Message{Role: "system", Content: instructions})
+		}
+	}
+	messages, err := responsesInputToChatMessages(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	chatReq.Messages = append(chatReq.Messages, messages...)
+	if len(chatReq.Messages) == 0 {
+		return nil, errors.New("input is required")
+	}
+
+	if chatReq.Tools, err = responsesToolsToChat(req.Tools); err != nil {
+		return nil, err
+	}
+	if chatReq.ToolChoice, err = responsesToolChoiceToChat(req.ToolChoice); err != nil {
+		return nil, err
+	}
+	if chatReq.ResponseFormat, err = responsesTextFormatToChat(req.Text); err != nil {
+		return nil, err
+	}
+	return chatReq, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// paramPolicyFields 各请求格式中受策略约束的字段路径
+type paramPolicyFields struct {
+	temperature string
+	maxTokens   []string // 第一个字段用于在未传入时补上上限
+	logprobs    []string
+	streamUsage bool // 是否支持 stream_options.include_usage
+}
+
+func getParamPolicyFields(path string) (paramPolicyFields, bool) {
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		return paramPolicyFields{
+			temperature: "temperature",
+			maxTokens:   []string{"max_tokens", "max_completion_tokens"},
+			logprobs:    []string{"logprobs", "top_logprobs"},
+			streamUsage: true,
+		}, true
+	case strings.HasSuffix(path, "/v1/completions"):
+		return paramPolicyFields{
+			temperature: "temperature",
+			maxTokens:   []string{"max_tokens"},
+			logprobs:    []string{"logprobs"},
+			streamUsage: true,
+		}, true
+	case strings.HasSuffix(path, "/v1/messages"):
+		return paramPolicyFields{
+			temperature: "temperature",
+			maxTokens:   []string{"max_tokens"},
+		}, true
+	case strings.HasPrefix(path, "/v1/responses"):
+		return paramPolicyFields{
+			temperature: "temperature",
+			maxTokens:   []string{"max_output_tokens"},
+			logprobs:    []string{"top_logprobs"},
+		}, true
+	case strings.Contains(path, ":generateContent") || strings.Contains(path, ":streamGenerateContent"):
+		return paramPolicyFields{
+			temperature: "generationConfig.temperature",
+			maxTokens:   []string{"generationConfig.maxOutputTokens"},
+			logprobs:    []string{"generationConfig.responseLogprobs", "generationConfig.logprobs"},
+		}, true
+	}
+	return paramPolicyFields{}, false
+}
+
+func isParamEnabled(value gjson.Result) bool {
+	switch value.Type {
+	case gjson.Null, gjson.False:
+		return false
+	case gjson.Number:
+		return value.Num != 0
+	}
+	return value.Exists()
+}
+
+// ParamPolicyViolation 策略为 reject 时请求中超出限制的参数
+type ParamPolicyViolation struct {
+	Field   string
+	Message string
+}
+
+func (v *ParamPolicyViolation) Error() string {
+	return fmt.Sprintf("parameter %s is not allowed: %s", v.Field, v.Message)
+}
+
+// ApplyParamPolicy 按请求路径识别格式，将超出策略的参数收敛到上限，返回调整说明；
+// 策略为 reject 时遇到超限参数返回 *ParamPolicyViolation，不支持的格式原样返回
+func ApplyParamPolicy(path string, body []byte, policy operation_setting.ParamPolicy) ([]byte, []string, error) {
+	fields, ok := getParamPolicyFields(path)
+	if !ok || !gjson.ValidBytes(body) || !gjson.ParseBytes(body).IsObject() {
+		return body, nil, nil
+	}
+	var adjustments []string
+	var err error
+	set := func(path string, value any, note string) {
+		if err != nil {
+			return
+		}
+		body, err = sjson.SetBytes(body, path, value)
+		adjustments = append(adjustments, note)
+	}
+	remove := func(path string, note string) {
+		if err != nil {
+			return
+		}
+		body, err = sjson.DeleteBytes(body, path)
+		adjustments = append(adjustments, note)
+	}
+
+	if policy.MaxTemperature != nil {
+		max := *policy.MaxTemperature
+		if value := gjson.GetBytes(body, fields.temperature); value.Type == gjson.Number && value.Float() > max {
+			if policy.Rejects() {
+				return nil, nil, &ParamPolicyViolation{Field: fields.temperature, Message: fmt.Sprintf("must be at most %g", max)}
+			}
+			set(fields.temperature, max, fmt.Sprintf("%s %g -> %g", fields.temperature, value.Float(), max))
+		}
+	}
+
+	if policy.MaxTokens > 0 {
+		present := false
+		for _, field := range fields.maxTokens {
+			value := gjson.GetBytes(body, field)
+			if value.Type != gjson.Number {
+				continue
+			}
+			present = true
+			if value.Int() > int64(policy.MaxTokens) {
+				if policy.Rejects() {
+					return nil, nil, &ParamPolicyViolation{Field: field, Message: fmt.Sprintf("must be at most %d", policy.MaxTokens)}
+				}
+				set(field, policy.MaxTokens, fmt.Sprintf("%s %d -> %d", field, value.Int(), policy.MaxTokens))
+			}
+		}
+		if !present {
+			set(fields.maxTokens[0], policy.MaxTokens, fmt.Sprintf("%s set to %d", fields.maxTokens[0], policy.MaxTokens))
+		}
+	}
+
+	if policy.ForbidLogprobs {
+		for _, field := range fields.logprobs {
+			if !isParamEnabled(gjson.GetBytes(body, field)) {
+				continue
+			}
+			if policy.Rejects() {
+				return nil, nil, &ParamPolicyViolation{Field: field, Message: "logprobs are disabled"}
+			}
+			remove(field, field+" removed")
+		}
+	}
+
+	if policy.ForceIncludeUsage && fields.streamUsage && gjson.GetBytes(body, "stream").Bool() &&
+		!gjson.GetBytes(body, "stream_options.include_usage").Bool() {
+		set("stream_options.include_usage", true, "stream_options.include_usage forced")
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, adjustments, nil
+}
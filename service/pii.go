@@ -0,0 +1,271 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+var builtinPIIPatterns = map[string]*regexp.Regexp{
+	operation_setting.PIIRuleEmail:      regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	operation_setting.PIIRuleIdCard:     regexp.MustCompile(`\b[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+	operation_setting.PIIRuleCreditCard: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+	operation_setting.PIIRulePhone:      regexp.MustCompile(`(?:\+?86[- ]?)?\b1[3-9]\d{9}\b`),
+}
+
+// builtinPIIOrder 身份证号须先于银行卡号匹配，避免被当作卡号
+var builtinPIIOrder = []string{
+	operation_setting.PIIRuleEmail,
+	operation_setting.PIIRuleIdCard,
+	operation_setting.PIIRuleCreditCard,
+	operation_setting.PIIRulePhone,
+}
+
+// piiTextFields 只处理承载用户文本的字段，避免改动模型名、图片数据等
+var piiTextFields = map[string]bool{
+	"content":      true,
+	"text":         true,
+	"input":        true,
+	"prompt":       true,
+	"instructions": true,
+	"system":       true,
+	"query":        true,
+	"documents":    true,
+	"arguments":    true,
+}
+
+type piiMatcher struct {
+	name    string
+	pattern *regexp.Regexp
+	verify  func(string) bool
+}
+
+var piiPatternCache sync.Map
+
+func compilePIIPattern(pattern string) *regexp.Regexp {
+	if v, ok := piiPatternCache.Load(pattern); ok {
+		return v.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	piiPatternCache.Store(pattern, re)
+	return re
+}
+
+// ValidatePIIRules 校验自定义规则
+func ValidatePIIRules(rules []operation_setting.PIIRule) error {
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("规则名不能为空")
+		}
+		if _, ok := builtinPIIPatterns[rule.Name]; ok {
+			return fmt.Errorf("规则名 %s 与内置规则重复", rule.Name)
+		}
+		if rule.Pattern == "" && len(rule.Words) == 0 {
+			return fmt.Errorf("规则 %s 需要配置正则或词典", rule.Name)
+		}
+		if rule.Pattern != "" {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("规则 %s 的正则无效: %v", rule.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func buildPIIMatchers(rules []string) []piiMatcher {
+	enabled := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		enabled[r] = true
+	}
+	matchers := make([]piiMatcher, 0, len(rules))
+	for _, name := range builtinPIIOrder {
+		if !enabled[name] {
+			continue
+		}
+		m := piiMatcher{name: name, pattern: builtinPIIPatterns[name]}
+		if name == operation_setting.PIIRuleCreditCard {
+			m.verify = luhnValid
+		}
+		matchers = append(matchers, m)
+	}
+	for _, rule := range operation_setting.GetPIISetting().CustomRules {
+		if !enabled[rule.Name] {
+			continue
+		}
+		pattern := rule.Pattern
+		if pattern == "" {
+			words := make([]string, 0, len(rule.Words))
+			for _, w := range rule.Words {
+				if w = strings.TrimSpace(w); w != "" {
+					words = append(words, regexp.QuoteMeta(w))
+				}
+			}
+			if len(words) == 0 {
+				continue
+			}
+			// 长词优先，避免短词截断长词
+			sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+			pattern = strings.Join(words, "|")
+		}
+		if re := compilePIIPattern(pattern); re != nil {
+			matchers = append(matchers, piiMatcher{name: rule.Name, pattern: re})
+		}
+	}
+	return matchers
+}
+
+func luhnValid(s string) bool {
+	sum, double, digits := 0, false, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// PIIRedactor 单个请求内的脱敏上下文，同一内容始终替换为同一占位符
+type PIIRedactor struct {
+	matchers     []piiMatcher
+	placeholders map[string]string // 原始内容 -> 占位符
+	originals    map[string]string // 占位符 -> 原始内容
+	counts       map[string]int
+}
+
+func NewPIIRedactor(rules []string) *PIIRedactor {
+	return &PIIRedactor{
+		matchers:     buildPIIMatchers(rules),
+		placeholders: map[string]string{},
+		originals:    map[string]string{},
+		counts:       map[string]int{},
+	}
+}
+
+func (r *PIIRedactor) placeholder(name string, value string) string {
+	if p, ok := r.placeholders[value]; ok {
+		return p
+	}
+	r.counts[name]++
+	p := fmt.Sprintf("[%s_%d]", strings.ToUpper(name), r.counts[name])
+	r.placeholders[value] = p
+	r.originals[p] = value
+	return p
+}
+
+// RedactText 将文本中的个人信息替换为占位符
+func (r *PIIRedactor) RedactText(text string) string {
+	for _, m := range r.matchers {
+		text = m.pattern.ReplaceAllStringFunc(text, func(s string) string {
+			if m.verify != nil && !m.verify(s) {
+				return s
+			}
+			return r.placeholder(m.name, s)
+		})
+	}
+	return text
+}
+
+func (r *PIIRedactor) redactValue(v any, inText bool) any {
+	switch val := v.(type) {
+	case string:
+		if inText {
+			return r.RedactText(val)
+		}
+	case []any:
+		for i, item := range val {
+			val[i] = r.redactValue(item, inText)
+		}
+	case map[string]any:
+		for k, item := range val {
+			val[k] = r.redactValue(item, piiTextFields[k])
+		}
+	}
+	return v
+}
+
+// RedactJSON 脱敏 JSON 请求体中的文本字段，未命中时返回原始内容
+func (r *PIIRedactor) RedactJSON(body []byte) ([]byte, error) {
+	if len(r.matchers) == 0 {
+		return body, nil
+	}
+	data, err := decodeJSONBody(body)
+	if err != nil {
+		return nil, err
+	}
+	data = r.redactValue(data, false)
+	if len(r.originals) == 0 {
+		return body, nil
+	}
+	return encodeJSONBody(data)
+}
+
+// Counts 返回各规则命中的不同内容数量
+func (r *PIIRedactor) Counts() map[string]int {
+	return r.counts
+}
+
+func (r *PIIRedactor) HasRedactions() bool {
+	return len(r.originals) > 0
+}
+
+// Restorer 返回将占位符还原为原始内容的替换器，原始内容按 JSON 字符串转义以便写回 JSON 响应
+func (r *PIIRedactor) Restorer() *strings.Replacer {
+	pairs := make([]string, 0, len(r.originals)*2)
+	for p, original := range r.originals {
+		escaped, _ := json.Marshal(original)
+		pairs = append(pairs, p, string(escaped[1:len(escaped)-1]))
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// piiCounters 进程启动以来各分组、各规则的脱敏次数
+var piiCounters sync.Map
+
+func RecordPIIRedactions(group string, counts map[string]int) {
+	for rule, n := range counts {
+		v, _ := piiCounters.LoadOrStore(group+"\x00"+rule, &atomic.Int64{})
+		v.(*atomic.Int64).Add(int64(n))
+	}
+}
+
+type PIIRedactionStat struct {
+	Group string `json:"group"`
+	Rule  string `json:"rule"`
+	Count int64  `json:"count"`
+}
+
+func GetPIIRedactionStats() []PIIRedactionStat {
+	stats := make([]PIIRedactionStat, 0)
+	piiCounters.Range(func(key, value any) bool {
+		group, rule, _ := strings.Cut(key.(string), "\x00")
+		stats = append(stats, PIIRedactionStat{Group: group, Rule: rule, Count: value.(*atomic.Int64).Load()})
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Group != stats[j].Group {
+			return stats[i].Group < stats[j].Group
+		}
+		return stats[i].Rule < stats[j].Rule
+	})
+	return stats
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	postpaidInvoiceInterval = time.Hour
+	// 账期结束后的出账窗口，超过窗口不再补开上一账期的账单
+	postpaidInvoiceWindow = 3 * 24 * time.Hour
+)
+
+var postpaidInvoiceOnce sync.Once
+
+// creditUsed 余额为负时已透支的额度
+func creditUsed(balance int) int {
+	return max(0, -balance)
+}
+
+// checkPostpaidCredit 后付费用户消费后检查信用额度：跨过提醒比例时通知，超出信用额度时按配置停用
+func checkPostpaidCredit(relayInfo *relaycommon.RelayInfo, consumed int) {
+	if relayInfo.UserCreditLimit <= 0 || consumed <= 0 {
+		return
+	}
+	gopool.Go(func() {
+		balance, err := model.GetUserQuota(relayInfo.UserId, false)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to check credit of user %d: %s", relayInfo.UserId, err.Error()))
+			return
+		}
+		limit := relayInfo.UserCreditLimit
+		before := creditUsed(balance + consumed)
+		after := creditUsed(balance)
+		setting := operation_setting.GetPostpaidSetting()
+
+		if after > limit {
+			if before > limit {
+				return
+			}
+			content := fmt.Sprintf("您的账户已透支 %s，超出信用额度 %s", logger.FormatQuota(after), logger.FormatQuota(limit))
+			if setting.SuspendOnExceed {
+				if err := model.DisableUser(relayInfo.UserId); err != nil {
+					common.SysError(fmt.Sprintf("failed to suspend user %d: %s", relayInfo.UserId, err.Error()))
+				} else {
+					model.RecordLog(relayInfo.UserId, model.LogTypeManage, "透支超出信用额度，账户已自动停用")
+					content += "，账户已停用，请结清欠费后联系管理员恢复"
+				}
+			}
+			notifyPostpaidUser(relayInfo.UserId, relayInfo.UserEmail, relayInfo.UserSetting, dto.NotifyTypeCreditLimit, "信用额度已用尽", content)
+			return
+		}
+
+		thresholds := append([]int(nil), setting.DunningThresholds...)
+		sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+		for _, threshold := range thresholds {
+			line := limit * threshold / 100
+			if before < line && after >= line {
+				content := fmt.Sprintf("您已使用信用额度的 %d%%（%s / %s），为避免服务中断，请及时充值",
+					threshold, logger.FormatQuota(after), logger.FormatQuota(limit))
+				notifyPostpaidUser(relayInfo.UserId, relayInfo.UserEmail, relayInfo.UserSetting, dto.NotifyTypeCreditLimit, "信用额度即将用尽", content)
+				return
+			}
+		}
+	})
+}
+
+func notifyPostpaidUser(userId int, email string, userSetting dto.UserSetting, notifyType string, title string, content string) {
+	err := NotifyUser(userId, email, userSetting, dto.NewNotify(notifyType, title, content, nil))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send postpaid notify to user %d: %s", userId, err.Error()))
+	}
+}
+
+func StartPostpaidInvoiceTask() {
+	postpaidInvoiceOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				if operation_setting.GetPostpaidSetting().InvoiceEnabled && model.IsLeader() {
+					runPostpaidInvoiceOnce(time.Now())
+				}
+				time.Sleep(postpaidInvoiceInterval)
+			}
+		})
+	})
+}
+
+// runPostpaidInvoiceOnce 在新账期开始后的出账窗口内为欠费用户开具上一账期账单，已开票的用户跳过
+func runPostpaidInvoiceOnce(now time.Time) {
+	periodEnd := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if now.Sub(periodEnd) > postpaidInvoiceWindow {
+		return
+	}
+	period := periodEnd.AddDate(0, -1, 0).Format(billingPeriodLayout)
+	debtors, err := model.GetPostpaidDebtors()
+	if err != nil {
+		common.SysError("failed to query postpaid debtors: " + err.Error())
+		return
+	}
+	dueDays := operation_setting.GetPostpaidSetting().InvoiceDueDays
+	created := 0
+	for _, user := range debtors {
+		unpaid, err := model.GetUnpaidInvoiceAmount(user.Id)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to query unpaid invoices of user %d: %s", user.Id, err.Error()))
+			continue
+		}
+		// 之前账单未结清的欠费不重复计入
+		amount := creditUsed(user.Quota) - unpaid
+		if amount <= 0 {
+			continue
+		}
+		invoice := &model.PostpaidInvoice{
+			UserId:    user.Id,
+			Period:    period,
+			Amount:    amount,
+			Status:    model.PostpaidInvoiceStatusUnpaid,
+			DueTime:   now.AddDate(0, 0, dueDays).Unix(),
+			CreatedAt: now.Unix(),
+		}
+		if err := model.CreatePostpaidInvoice(invoice); err != nil {
+			// 唯一索引冲突说明本账期已开票
+			continue
+		}
+		created++
+		content := fmt.Sprintf("您 %s 的后付费账单已生成，应付额度 %s，请于 %s 前结清。控制台：%s",
+			period, logger.FormatQuota(amount), time.Unix(invoice.DueTime, 0).Format("2006-01-02"), system_setting.ServerAddress)
+		notifyPostpaidUser(user.Id, user.Email, user.GetSetting(), dto.NotifyTypeInvoice, "后付费账单已生成", content)
+	}
+	if created > 0 {
+		common.SysLog(fmt.Sprintf("postpaid invoices for %s: created %d", period, created))
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const quotaGrantTickInterval = 1 * time.Minute
+
+var (
+	quotaGrantOnce    sync.Once
+	quotaGrantRunning atomic.Bool
+)
+
+// StartQuotaGrantTask 按计划周期性发放额度，每个周期只发放一次，停机期间错过的周期在恢复后补发最近一次
+func StartQuotaGrantTask() {
+	quotaGrantOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("quota grant task started: tick=%s", quotaGrantTickInterval))
+			ticker := time.NewTicker(quotaGrantTickInterval)
+			defer ticker.Stop()
+
+			runQuotaGrantOnce()
+			for range ticker.C {
+				runQuotaGrantOnce()
+			}
+		})
+	})
+}
+
+func runQuotaGrantOnce() {
+	if !model.IsLeader() {
+		return
+	}
+	if !quotaGrantRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer quotaGrantRunning.Store(false)
+
+	ctx := context.Background()
+	grants, err := model.GetEnabledQuotaGrants()
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("quota grant task failed to load grants: %v", err))
+		return
+	}
+	now := time.Now()
+	for _, grant := range grants {
+		_, period := grant.CurrentPeriod(now)
+		if period == grant.LastPeriod {
+			continue
+		}
+		if _, err = RunQuotaGrant(ctx, grant, period); err != nil && !errors.Is(err, model.ErrQuotaGrantPeriodClaimed) {
+			logger.LogWarn(ctx, fmt.Sprintf("quota grant task failed to run grant %d: %v", grant.Id, err))
+		}
+	}
+}
+
+// RunQuotaGrant 执行一次发放并记录结果，period 已发放过时返回 ErrQuotaGrantPeriodClaimed
+func RunQuotaGrant(ctx context.Context, grant *model.QuotaGrant, period string) (*model.QuotaGrantRecord, error) {
+	record, err := model.ClaimQuotaGrantPeriod(grant.Id, period)
+	if err != nil {
+		return nil, err
+	}
+	recipients, total, runErr := model.ExecuteQuotaGrant(grant)
+	if err = model.FinishQuotaGrantPeriod(record, len(recipients), total, runErr); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("quota grant task failed to save record of grant %d: %v", grant.Id, err))
+	}
+	grant.LastPeriod = period
+
+	subject := fmt.Sprintf("额度发放计划「%s」已执行", grant.Name)
+	content := fmt.Sprintf("额度发放计划「%s」周期 %s：共 %d 个对象，合计 %s", grant.Name, period, len(recipients), logger.LogQuota(int(total)))
+	if runErr != nil {
+		subject = fmt.Sprintf("额度发放计划「%s」执行失败", grant.Name)
+		content += "，错误：" + runErr.Error()
+	}
+	NotifyRootUser(dto.NotifyTypeQuotaGrant, subject, content)
+	if grant.Notify {
+		gopool.Go(func() {
+			notifyQuotaGrantRecipients(ctx, grant, recipients)
+		})
+	}
+	return record, runErr
+}
+
+func notifyQuotaGrantRecipients(ctx context.Context, grant *model.QuotaGrant, recipients []model.QuotaGrantRecipient) {
+	for _, recipient := range recipients {
+		userCache, err := model.GetUserCache(recipient.UserId)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("quota grant task failed to load user %d: %v", recipient.UserId, err))
+			continue
+		}
+		var content string
+		switch {
+		case recipient.TokenName != "" && grant.Action == model.QuotaGrantActionReset:
+			content = fmt.Sprintf("您的令牌「%s」剩余额度已按计划重置为 %s。", recipient.TokenName, logger.LogQuota(recipient.Quota))
+		case recipient.TokenName != "":
+			content = fmt.Sprintf("您的令牌「%s」已按计划增加 %s 额度。", recipient.TokenName, logger.LogQuota(recipient.Quota))
+		case grant.Action == model.QuotaGrantActionReset:
+			content = fmt.Sprintf("您的账户额度已按计划重置为 %s。", logger.LogQuota(recipient.Quota))
+		default:
+			content = fmt.Sprintf("您的账户已按计划获得 %s 额度。", logger.LogQuota(recipient.Quota))
+		}
+		if err = NotifyUser(recipient.UserId, userCache.Email, userCache.GetSetting(), dto.NewNotify(dto.NotifyTypeQuotaGrant, "额度已发放", content, nil)); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("quota grant task failed to notify user %d: %v", recipient.UserId, err))
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 推理内容的输出方式，由请求头 X-Reasoning-Format 或查询参数 reasoning_format 指定
+const (
+	ReasoningFormatReasoningContent = "reasoning_content" // 统一放入 reasoning_content 字段
+	ReasoningFormatThink            = "think"             // 以 <think> 标签拼接到 content 前
+	ReasoningFormatStrip            = "strip"             // 去除推理内容
+)
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// ReasoningFormatter 统一各上游推理内容的输出形式，流式响应需要跨数据块记录标签状态
+type ReasoningFormatter struct {
+	Format string
+
+	thinking      bool // think 模式下已输出 <think> 尚未闭合
+	inThinkTag    bool // 上游在 content 中以 <think> 标签输出推理内容
+	contentOutput bool // 已输出正文，之后的 <think> 视为普通文本
+}
+
+// SetupReasoningFormatter 读取本次请求指定的推理输出方式，未指定或取值无效时保持上游原样
+func SetupReasoningFormatter(c *gin.Context) {
+	format := c.GetHeader("X-Reasoning-Format")
+	if format == "" {
+		format = c.Query("reasoning_format")
+	}
+	switch format {
+	case ReasoningFormatReasoningContent, ReasoningFormatThink, ReasoningFormatStrip:
+		// 每次重试重新创建，避免沿用上一个渠道的标签状态
+		common.SetContextKey(c, constant.ContextKeyReasoningFormatter, &ReasoningFormatter{Format: format})
+	}
+}
+
+func getReasoningFormatter(c *gin.Context) *ReasoningFormatter {
+	if c == nil {
+		return nil
+	}
+	formatter, _ := common.GetContextKeyType[*ReasoningFormatter](c, constant.ContextKeyReasoningFormatter)
+	return formatter
+}
+
+// ReasoningFormatEnabled 当前请求是否需要改写推理内容的输出格式
+func ReasoningFormatEnabled(c *gin.Context) bool {
+	return getReasoningFormatter(c) != nil
+}
+
+// splitThinkTag 从 content 中拆出 <think> 标签内的推理内容，只识别正文开始前的标签
+func (f *ReasoningFormatter) splitThinkTag(content string) (reasoning string, rest string) {
+	for content != "" {
+		if f.inThinkTag {
+			end := strings.Index(content, thinkCloseTag)
+			if end < 0 {
+				return reasoning + content, rest
+			}
+			reasoning += content[:end]
+			content = strings.TrimLeft(content[end+len(thinkCloseTag):], "\n")
+			f.inThinkTag = false
+			continue
+		}
+		if f.contentOutput {
+			return reasoning, rest + content
+		}
+		trimmed := strings.TrimLeft(content, " \r\n")
+		if trimmed == "" {
+			return reasoning, rest + content
+		}
+		if !strings.HasPrefix(trimmed, thinkOpenTag) {
+			f.contentOutput = true
+			return reasoning, rest + content
+		}
+		content = strings.TrimLeft(trimmed[len(thinkOpenTag):], "\n")
+		f.inThinkTag = true
+	}
+	return reasoning, rest
+}
+
+func reasoningText(value gjson.Result) string {
+	if reasoning := value.Get("reasoning_content"); reasoning.Type == gjson.String {
+		return reasoning.String()
+	}
+	return value.Get("reasoning").String()
+}
+
+// FormatReasoningResponse 处理非流式对话响应的 choices[].message
+func FormatReasoningResponse(c *gin.Context, data []byte) []byte {
+	formatter := getReasoningFormatter(c)
+	if formatter == nil || !gjson.ValidBytes(data) {
+		return data
+	}
+	choices := gjson.GetBytes(data, "choices")
+	if !choices.IsArray() {
+		return data
+	}
+	for i, choice := range choices.Array() {
+		message := choice.Get("message")
+		if !message.Exists() {
+			continue
+		}
+		path := fmt.Sprintf("choices.%d.message", i)
+		reasoning := reasoningText(message)
+		content := message.Get("content")
+		text := content.String()
+		if content.Type == gjson.String {
+			// 非流式响应各 choice 独立解析
+			tagged, rest := (&ReasoningFormatter{}).splitThinkTag(text)
+			if tagged != "" {
+				reasoning = strings.TrimSpace(reasoning + tagged)
+				text = rest
+			}
+		}
+
+		data, _ = sjson.DeleteBytes(data, path+".reasoning_content")
+		data, _ = sjson.DeleteBytes(data, path+".reasoning")
+		switch formatter.Format {
+		case ReasoningFormatReasoningContent:
+			if reasoning != "" {
+				data, _ = sjson.SetBytes(data, path+".reasoning_content", reasoning)
+			}
+		case ReasoningFormatThink:
+			if reasoning != "" {
+				text = thinkOpenTag + "\n" + reasoning + "\n" + thinkCloseTag + "\n" + text
+			}
+		}
+		if content.Type == gjson.String || text != "" {
+			data, _ = sjson.SetBytes(data, path+".content", text)
+		}
+	}
+	return data
+}
+
+// FormatReasoningStreamData 处理流式对话响应的单个数据块 choices[].delta
+func FormatReasoningStreamData(c *gin.Context, data string) string {
+	formatter := getReasoningFormatter(c)
+	if formatter == nil || !strings.HasPrefix(data, "{") || !gjson.Valid(data) {
+		return data
+	}
+	choices := gjson.Get(data, "choices")
+	if !choices.IsArray() {
+		return data
+	}
+	for i, choice := range choices.Array() {
+		delta := choice.Get("delta")
+		if !delta.Exists() {
+			continue
+		}
+		path := fmt.Sprintf("choices.%d.delta", i)
+		reasoning := reasoningText(delta)
+		content := delta.Get("content")
+		hasContent := content.Type == gjson.String
+		text := content.String()
+		if hasContent && formatter.Format != ReasoningFormatThink {
+			var tagged string
+			tagged, text = formatter.splitThinkTag(text)
+			reasoning += tagged
+		}
+
+		data, _ = sjson.Delete(data, path+".reasoning_content")
+		data, _ = sjson.Delete(data, path+".reasoning")
+		switch formatter.Format {
+		case ReasoningFormatReasoningContent:
+			if reasoning != "" {
+				data, _ = sjson.Set(data, path+".reasoning_content", reasoning)
+			}
+		case ReasoningFormatThink:
+			var builder strings.Builder
+			if reasoning != "" {
+				if !formatter.thinking {
+					builder.WriteString(thinkOpenTag + "\n")
+					formatter.thinking = true
+				}
+				builder.WriteString(reasoning)
+			}
+			finished := choice.Get("finish_reason").String() != ""
+			if formatter.thinking && (text != "" || delta.Get("tool_calls").Exists() || finished) {
+				builder.WriteString("\n" + thinkCloseTag + "\n")
+				formatter.thinking = false
+			}
+			text = builder.String() + text
+		}
+		if hasContent || text != "" {
+			data, _ = sjson.Set(data, path+".content", text)
+		}
+	}
+	return data
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+var (
+	ErrRelayQueueFull    = errors.New("relay queue is full")
+	ErrRelayQueueTimeout = errors.New("relay queue wait timeout")
+)
+
+type relayQueueWaiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	index    int
+}
+
+// relayQueue 按优先级从高到低、同优先级先到先出的堆
+type relayQueue []*relayQueueWaiter
+
+func (q relayQueue) Len() int { return len(q) }
+
+func (q relayQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q relayQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *relayQueue) Push(x any) {
+	waiter := x.(*relayQueueWaiter)
+	waiter.index = len(*q)
+	*q = append(*q, waiter)
+}
+
+func (q *relayQueue) Pop() any {
+	old := *q
+	n := len(old)
+	waiter := old[n-1]
+	old[n-1] = nil
+	waiter.index = -1
+	*q = old[:n-1]
+	return waiter
+}
+
+var (
+	relayQueueMutex      sync.Mutex
+	relayQueues          = make(map[string]*relayQueue)
+	relayQueueSeq        uint64
+	relayQueueDispatcher sync.Once
+)
+
+var relayQueueStats struct {
+	enqueued atomic.Int64
+	dequeued atomic.Int64
+	timeouts atomic.Int64
+	rejected atomic.Int64
+}
+
+// WaitInRelayQueue 在模型对应的队列中等待，直到被放行、超时或请求被取消
+func WaitInRelayQueue(ctx context.Context, modelName string, group string, timeout time.Duration) error {
+	setting := operation_setting.GetRelayQueueSetting()
+	relayQueueMutex.Lock()
+	queue, ok := relayQueues[modelName]
+	if !ok {
+		queue = &relayQueue{}
+		relayQueues[modelName] = queue
+	}
+	if setting.MaxQueueSize > 0 && queue.Len() >= setting.MaxQueueSize {
+		relayQueueMutex.Unlock()
+		relayQueueStats.rejected.Add(1)
+		return ErrRelayQueueFull
+	}
+	relayQueueSeq++
+	waiter := &relayQueueWaiter{
+		priority: setting.GroupPriorities[group],
+		seq:      relayQueueSeq,
+		ready:    make(chan struct{}),
+	}
+	heap.Push(queue, waiter)
+	relayQueueMutex.Unlock()
+	relayQueueStats.enqueued.Add(1)
+	relayQueueDispatcher.Do(func() {
+		go runRelayQueueDispatcher()
+	})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-waiter.ready:
+		relayQueueStats.dequeued.Add(1)
+		return nil
+	case <-timer.C:
+		err = ErrRelayQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	relayQueueMutex.Lock()
+	defer relayQueueMutex.Unlock()
+	if waiter.index < 0 {
+		// 超时的同时恰好被放行
+		relayQueueStats.dequeued.Add(1)
+		return nil
+	}
+	heap.Remove(queue, waiter.index)
+	if errors.Is(err, ErrRelayQueueTimeout) {
+		relayQueueStats.timeouts.Add(1)
+	}
+	return err
+}
+
+// NotifyRelayQueue 模型有请求成功时放行一个排队中的请求
+func NotifyRelayQueue(modelName string) {
+	relayQueueMutex.Lock()
+	defer relayQueueMutex.Unlock()
+	releaseRelayQueueHead(modelName)
+}
+
+func releaseRelayQueueHead(modelName string) {
+	queue, ok := relayQueues[modelName]
+	if !ok {
+		return
+	}
+	if queue.Len() > 0 {
+		waiter := heap.Pop(queue).(*relayQueueWaiter)
+		close(waiter.ready)
+	}
+	if queue.Len() == 0 {
+		delete(relayQueues, modelName)
+	}
+}
+
+// runRelayQueueDispatcher 没有请求成功时，按间隔放行各队列的队首请求重新尝试
+func runRelayQueueDispatcher() {
+	for {
+		interval := time.Duration(operation_setting.GetRelayQueueSetting().RetryIntervalMs) * time.Millisecond
+		if interval <= 0 {
+			interval = time.Second
+		}
+		time.Sleep(interval)
+		relayQueueMutex.Lock()
+		for modelName := range relayQueues {
+			releaseRelayQueueHead(modelName)
+		}
+		relayQueueMutex.Unlock()
+	}
+}
+
+func GetRelayQueueStats() map[string]any {
+	relayQueueMutex.Lock()
+	depths := make(map[string]int, len(relayQueues))
+	total := 0
+	for modelName, queue := range relayQueues {
+		depths[modelName] = queue.Len()
+		total += queue.Len()
+	}
+	relayQueueMutex.Unlock()
+	return map[string]any{
+		"enabled":  operation_setting.GetRelayQueueSetting().Enabled,
+		"depth":    total,
+		"models":   depths,
+		"enqueued": relayQueueStats.enqueued.Load(),
+		"dequeued": relayQueueStats.dequeued.Load(),
+		"timeouts": relayQueueStats.timeouts.Load(),
+		"rejected": relayQueueStats.rejected.Load(),
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayRace 同一请求并发发往多个渠道，最先收到正常响应（或最先向客户端输出）的参与者胜出，
+// 胜出时取消其余参与者的上游请求。只有胜出者能写出响应并进入结算
+type RelayRace struct {
+	mu      sync.Mutex
+	winner  int
+	cancels []context.CancelFunc
+}
+
+func NewRelayRace() *RelayRace {
+	return &RelayRace{winner: -1}
+}
+
+func (r *RelayRace) claim(index int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner < 0 {
+		r.winner = index
+		for i, cancel := range r.cancels {
+			if i != index {
+				cancel()
+			}
+		}
+	}
+	return r.winner == index
+}
+
+// Winner 返回胜出者的序号，尚无胜出者时返回 -1
+func (r *RelayRace) Winner() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner
+}
+
+// Close 比赛结束后释放所有参与者的上下文
+func (r *RelayRace) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cancel := range r.cancels {
+		cancel()
+	}
+}
+
+// Enter 为一个参与者复制请求上下文：独立的取消信号、请求体与未胜出前不输出的 writer
+func (r *RelayRace) Enter(c *gin.Context, body []byte) *gin.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	entrant := &relayRaceEntrant{race: r, index: len(r.cancels)}
+	r.cancels = append(r.cancels, cancel)
+
+	cp := c.Copy()
+	cp.Request = c.Request.Clone(ctx)
+	cp.Request.Body = io.NopCloser(bytes.NewReader(body))
+	// 各参与者并发读取请求体，不能共享可 Seek 的 BodyStorage
+	cp.Set(common.KeyBodyStorage, nil)
+	cp.Set(common.KeyRequestBody, body)
+	entrant.writer = &relayRaceWriter{ResponseWriter: c.Writer, entrant: entrant, header: c.Writer.Header().Clone()}
+	cp.Writer = entrant.writer
+	common.SetContextKey(cp, constant.ContextKeyRelayRaceEntrant, entrant)
+	return cp
+}
+
+type relayRaceEntrant struct {
+	race   *RelayRace
+	index  int
+	writer *relayRaceWriter
+}
+
+func (e *relayRaceEntrant) claim() bool {
+	if e.writer.forwarding {
+		return true
+	}
+	if !e.race.claim(e.index) {
+		return false
+	}
+	header := e.writer.ResponseWriter.Header()
+	for key, values := range e.writer.header {
+		header[key] = values
+	}
+	e.writer.forwarding = true
+	return true
+}
+
+// ClaimRelayRace 上游返回正常响应后调用，非竞速请求总是返回 true；返回 false 表示已有其他渠道胜出
+func ClaimRelayRace(c *gin.Context) bool {
+	entrant, ok := common.GetContextKeyType[*relayRaceEntrant](c, constant.ContextKeyRelayRaceEntrant)
+	if !ok {
+		return true
+	}
+	return entrant.claim()
+}
+
+// WithRelayRaceContext 竞速请求的上游请求随参与者落败而取消
+func WithRelayRaceContext(c *gin.Context, req *http.Request) *http.Request {
+	if _, ok := common.GetContextKeyType[*relayRaceEntrant](c, constant.ContextKeyRelayRaceEntrant); !ok {
+		return req
+	}
+	return req.WithContext(c.Request.Context())
+}
+
+// relayRaceWriter 胜出前只记录响应头，首次写出时尝试胜出，落败的参与者写出的内容全部丢弃
+type relayRaceWriter struct {
+	gin.ResponseWriter
+	entrant    *relayRaceEntrant
+	header     http.Header
+	forwarding bool
+}
+
+func (w *relayRaceWriter) Header() http.Header {
+	if w.forwarding {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *relayRaceWriter) WriteHeader(code int) {
+	if w.entrant.claim() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *relayRaceWriter) WriteHeaderNow() {
+	if w.entrant.claim() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *relayRaceWriter) Write(data []byte) (int, error) {
+	if !w.entrant.claim() {
+		return 0, context.Canceled
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *relayRaceWriter) WriteString(s string) (int, error) {
+	if !w.entrant.claim() {
+		return 0, context.Canceled
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *relayRaceWriter) Flush() {
+	if w.forwarding {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *relayRaceWriter) Status() int {
+	if w.forwarding {
+		return w.ResponseWriter.Status()
+	}
+	return http.StatusOK
+}
+
+func (w *relayRaceWriter) Size() int {
+	if w.forwarding {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *relayRaceWriter) Written() bool {
+	return w.forwarding && w.ResponseWriter.Written()
+}
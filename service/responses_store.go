@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	storedResponseCleanupInterval  = 1 * time.Hour
+	storedResponseCleanupBatchSize = 1000
+)
+
+var storedResponseCleanupOnce sync.Once
+
+// NormalizeResponsesInput 将 input 统一为条目数组，字符串输入视为一条 user 消息
+func NormalizeResponsesInput(input json.RawMessage) ([]json.RawMessage, error) {
+	input = bytes.TrimSpace(input)
+	if len(input) == 0 || string(input) == "null" {
+		return nil, nil
+	}
+	if input[0] == '"' {
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{"role": "user", "content": text})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	}
+	var items []json.RawMessage
+	if err := common.Unmarshal(input, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ResolvePreviousResponse 在网关侧存储中回溯 previous_response_id，将历史轮次展开到 input 中，
+// 使续接请求不依赖上游保存的状态，可以被分发到任意渠道。本地未找到时保持原样交给上游处理。
+// 返回展开的历史上下文估算的 token 数，用于计费
+func ResolvePreviousResponse(userId int, request *dto.OpenAIResponsesRequest) (int, error) {
+	setting := operation_setting.GetResponsesSetting()
+	if !setting.StoreEnabled || request.PreviousResponseID == "" {
+		return 0, nil
+	}
+	maxDepth := max(setting.MaxChainDepth, 1)
+	records := make([]*model.StoredResponse, 0)
+	for id := request.PreviousResponseID; id != "" && len(records) < maxDepth; {
+		record, err := model.GetStoredResponse(userId, id)
+		if err != nil {
+			if len(records) == 0 {
+				return 0, nil
+			}
+			break
+		}
+		records = append(records, record)
+		id = record.PreviousResponseId
+	}
+
+	history := make([]json.RawMessage, 0)
+	for i := len(records) - 1; i >= 0; i-- {
+		items, err := NormalizeResponsesInput(json.RawMessage(records[i].Input))
+		if err != nil {
+			return 0, fmt.Errorf("invalid stored response %s: %w", records[i].ResponseId, err)
+		}
+		history = append(history, items...)
+		for _, output := range gjson.Get(records[i].Output, "output").Array() {
+			// reasoning 条目依赖上游状态，跨渠道重放会被拒绝
+			if output.Get("type").String() == "reasoning" {
+				continue
+			}
+			history = append(history, json.RawMessage(output.Raw))
+		}
+	}
+	current, err := NormalizeResponsesInput(request.Input)
+	if err != nil {
+		return 0, err
+	}
+	input, err := common.Marshal(append(history, current...))
+	if err != nil {
+		return 0, err
+	}
+	historyInput, err := common.Marshal(history)
+	if err != nil {
+		return 0, err
+	}
+	historyMeta := (&dto.OpenAIResponsesRequest{Input: historyInput}).GetTokenCountMeta()
+	request.Input = input
+	request.PreviousResponseID = ""
+	return CountTextToken(historyMeta.CombineText, request.Model), nil
+}
+
+// StoreResponse 保存本轮响应，显式传入 store=false 时不保存
+func StoreResponse(c *gin.Context, userId int, previousResponseId string, input json.RawMessage, store json.RawMessage) {
+	setting := operation_setting.GetResponsesSetting()
+	if !setting.StoreEnabled || string(bytes.TrimSpace(store)) == "false" {
+		return
+	}
+	finalResponse, ok := common.GetContextKeyType[[]byte](c, constant.ContextKeyResponsesFinalResponse)
+	if !ok || len(finalResponse) == 0 {
+		return
+	}
+	responseId := gjson.GetBytes(finalResponse, "id").String()
+	if responseId == "" {
+		return
+	}
+	items, err := NormalizeResponsesInput(input)
+	if err != nil {
+		return
+	}
+	inputJSON, err := common.Marshal(items)
+	if err != nil {
+		return
+	}
+	record := &model.StoredResponse{
+		ResponseId:         responseId,
+		UserId:             userId,
+		Model:              gjson.GetBytes(finalResponse, "model").String(),
+		PreviousResponseId: previousResponseId,
+		Input:              string(inputJSON),
+		Output:             string(finalResponse),
+	}
+	if setting.RetentionDays > 0 {
+		record.ExpiresAt = common.GetTimestamp() + int64(setting.RetentionDays)*24*3600
+	}
+	if err := model.SaveStoredResponse(record); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to store response %s: %v", responseId, err))
+	}
+}
+
+func StartStoredResponseCleanupTask() {
+	storedResponseCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(storedResponseCleanupInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if model.IsLeader() {
+					cleanupExpiredStoredResponses()
+				}
+			}
+		})
+	})
+}
+
+func cleanupExpiredStoredResponses() {
+	total := int64(0)
+	for {
+		n, err := model.DeleteExpiredStoredResponses(storedResponseCleanupBatchSize)
+		if err != nil {
+			logger.LogWarn(context.Background(), fmt.Sprintf("stored response cleanup failed: %v", err))
+			return
+		}
+		total += n
+		if n < storedResponseCleanupBatchSize {
+			break
+		}
+	}
+	if common.DebugEnabled && total > 0 {
+		logger.LogDebug(context.Background(), "stored response cleanup: deleted=%d", total)
+	}
+}
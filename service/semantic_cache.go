@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const (
+	semanticCacheRedisPrefix      = "semantic_cache:"
+	semanticCacheEmbeddingTimeout = 10 * time.Second
+)
+
+type semanticCacheEntry struct {
+	Vector    []float32 `json:"vector"`
+	Response  string    `json:"response"`
+	ExpiresAt int64     `json:"expires_at"`
+}
+
+// semanticCacheBackend 缓存后端，同一分区内按相似度线性检索
+type semanticCacheBackend interface {
+	search(ctx context.Context, partition string, vector []float32, threshold float64) (*semanticCacheEntry, float64, error)
+	store(ctx context.Context, partition string, entry *semanticCacheEntry, maxEntries int, ttl time.Duration) error
+	clear(ctx context.Context) (int, error)
+}
+
+// SemanticCacheQuery 一次缓存查询：分区由模型、用户与除消息外的请求参数决定，向量为归一化提示词的 embedding
+type SemanticCacheQuery struct {
+	Partition string
+	Vector    []float32
+}
+
+var semanticCacheStats struct {
+	lookups atomic.Int64
+	hits    atomic.Int64
+	misses  atomic.Int64
+	errors  atomic.Int64
+	stores  atomic.Int64
+}
+
+var memorySemanticCache = &memorySemanticCacheBackend{partitions: make(map[string][]*semanticCacheEntry)}
+
+func getSemanticCacheBackend() semanticCacheBackend {
+	if operation_setting.GetSemanticCacheSetting().Backend == operation_setting.SemanticCacheBackendRedis && common.RedisEnabled.Load() {
+		return redisSemanticCacheBackend{}
+	}
+	return memorySemanticCache
+}
+
+// PrepareSemanticCacheQuery 计算提示词 embedding 并生成查询
+func PrepareSemanticCacheQuery(ctx context.Context, partitionSeed string, prompt string) (*SemanticCacheQuery, error) {
+	vector, err := getSemanticCacheEmbedding(ctx, prompt)
+	if err != nil {
+		semanticCacheStats.errors.Add(1)
+		return nil, err
+	}
+	return &SemanticCacheQuery{
+		Partition: common.GenerateHMAC(partitionSeed),
+		Vector:    vector,
+	}, nil
+}
+
+// LookupSemanticCache 返回相似度最高且不低于阈值的缓存响应
+func LookupSemanticCache(ctx context.Context, query *SemanticCacheQuery) ([]byte, float64, bool) {
+	semanticCacheStats.lookups.Add(1)
+	threshold := operation_setting.GetSemanticCacheSetting().SimilarityThreshold
+	entry, similarity, err := getSemanticCacheBackend().search(ctx, query.Partition, query.Vector, threshold)
+	if err != nil {
+		semanticCacheStats.errors.Add(1)
+		common.SysError("semantic cache search failed: " + err.Error())
+	}
+	if entry == nil {
+		semanticCacheStats.misses.Add(1)
+		return nil, 0, false
+	}
+	semanticCacheStats.hits.Add(1)
+	return []byte(entry.Response), similarity, true
+}
+
+func StoreSemanticCache(ctx context.Context, query *SemanticCacheQuery, response []byte) {
+	setting := operation_setting.GetSemanticCacheSetting()
+	ttl := time.Duration(setting.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	entry := &semanticCacheEntry{
+		Vector:    query.Vector,
+		Response:  string(response),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	if err := getSemanticCacheBackend().store(ctx, query.Partition, entry, setting.MaxEntriesPerPartition, ttl); err != nil {
+		semanticCacheStats.errors.Add(1)
+		common.SysError("semantic cache store failed: " + err.Error())
+		return
+	}
+	semanticCacheStats.stores.Add(1)
+}
+
+func GetSemanticCacheStats() map[string]any {
+	lookups := semanticCacheStats.lookups.Load()
+	hits := semanticCacheStats.hits.Load()
+	hitRatio := 0.0
+	if lookups > 0 {
+		hitRatio = float64(hits) / float64(lookups)
+	}
+	return map[string]any{
+		"backend":   operation_setting.GetSemanticCacheSetting().Backend,
+		"lookups":   lookups,
+		"hits":      hits,
+		"misses":    semanticCacheStats.misses.Load(),
+		"errors":    semanticCacheStats.errors.Load(),
+		"stores":    semanticCacheStats.stores.Load(),
+		"hit_ratio": hitRatio,
+	}
+}
+
+// ClearSemanticCache 清空缓存并重置统计
+func ClearSemanticCache(ctx context.Context) (int, error) {
+	deleted, err := getSemanticCacheBackend().clear(ctx)
+	semanticCacheStats.lookups.Store(0)
+	semanticCacheStats.hits.Store(0)
+	semanticCacheStats.misses.Store(0)
+	semanticCacheStats.errors.Store(0)
+	semanticCacheStats.stores.Store(0)
+	return deleted, err
+}
+
+func getSemanticCacheEmbedding(ctx context.Context, input string) ([]float32, error) {
+	setting := operation_setting.GetSemanticCacheSetting()
+	payload, err := common.Marshal(map[string]any{
+		"model": setting.EmbeddingModel,
+		"input": input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, semanticCacheEmbeddingTimeout)
+	defer cancel()
+	url := strings.TrimSuffix(setting.EmbeddingBaseUrl, "/") + "/v1/embeddings"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if setting.EmbeddingApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+setting.EmbeddingApiKey)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding request failed: status %d", resp.StatusCode)
+	}
+	var embeddingResponse struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := common.Unmarshal(body, &embeddingResponse); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %w", err)
+	}
+	if len(embeddingResponse.Data) == 0 || len(embeddingResponse.Data[0].Embedding) == 0 {
+		return nil, errors.New("embedding response contains no vector")
+	}
+	return normalizeVector(embeddingResponse.Data[0].Embedding), nil
+}
+
+// normalizeVector 归一化为单位向量，相似度计算只需点积
+func normalizeVector(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 {
+		return vector
+	}
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
+}
+
+func vectorSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func bestSemanticCacheEntry(entries []*semanticCacheEntry, vector []float32, threshold float64, now int64) (*semanticCacheEntry, float64) {
+	var best *semanticCacheEntry
+	bestSimilarity := threshold
+	for _, entry := range entries {
+		if entry.ExpiresAt <= now {
+			continue
+		}
+		if similarity := vectorSimilarity(entry.Vector, vector); similarity >= bestSimilarity {
+			best = entry
+			bestSimilarity = similarity
+		}
+	}
+	return best, bestSimilarity
+}
+
+type memorySemanticCacheBackend struct {
+	mu         sync.RWMutex
+	partitions map[string][]*semanticCacheEntry
+}
+
+func (m *memorySemanticCacheBackend) search(ctx context.Context, partition string, vector []float32, threshold float64) (*semanticCacheEntry, float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, similarity := bestSemanticCacheEntry(m.partitions[partition], vector, threshold, time.Now().Unix())
+	return entry, similarity, nil
+}
+
+func (m *memorySemanticCacheBackend) store(ctx context.Context, partition string, entry *semanticCacheEntry, maxEntries int, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().Unix()
+	entries := m.partitions[partition][:0]
+	for _, existing := range m.partitions[partition] {
+		if existing.ExpiresAt > now {
+			entries = append(entries, existing)
+		}
+	}
+	entries = append(entries, entry)
+	// 超出上限时淘汰最早写入的条目
+	if maxEntries > 0 && len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+	m.partitions[partition] = entries
+	return nil
+}
+
+func (m *memorySemanticCacheBackend) clear(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := 0
+	for _, entries := range m.partitions {
+		deleted += len(entries)
+	}
+	m.partitions = make(map[string][]*semanticCacheEntry)
+	return deleted, nil
+}
+
+// redisSemanticCacheBackend 每个分区为一个 Hash，字段为条目 ID，值为条目 JSON
+type redisSemanticCacheBackend struct{}
+
+func (redisSemanticCacheBackend) search(ctx context.Context, partition string, vector []float32, threshold float64) (*semanticCacheEntry, float64, error) {
+	key := semanticCacheRedisPrefix + partition
+	values, err := common.RDB.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now().Unix()
+	entries := make([]*semanticCacheEntry, 0, len(values))
+	expired := make([]string, 0)
+	for field, value := range values {
+		entry := &semanticCacheEntry{}
+		if err := common.UnmarshalJsonStr(value, entry); err != nil || entry.ExpiresAt <= now {
+			expired = append(expired, field)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(expired) > 0 {
+		common.RDB.HDel(ctx, key, expired...)
+	}
+	entry, similarity := bestSemanticCacheEntry(entries, vector, threshold, now)
+	return entry, similarity, nil
+}
+
+func (redisSemanticCacheBackend) store(ctx context.Context, partition string, entry *semanticCacheEntry, maxEntries int, ttl time.Duration) error {
+	key := semanticCacheRedisPrefix + partition
+	if maxEntries > 0 {
+		count, err := common.RDB.HLen(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if count >= int64(maxEntries) {
+			return nil
+		}
+	}
+	data, err := common.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	pipe := common.RDB.TxPipeline()
+	pipe.HSet(ctx, key, common.GetUUID(), string(data))
+	pipe.Expire(ctx, key, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (redisSemanticCacheBackend) clear(ctx context.Context) (int, error) {
+	keys, err := cachex.ScanKeys(ctx, common.RDB, semanticCacheRedisPrefix+"*")
+	deleted := 0
+	for _, key := range keys {
+		if err := common.RDB.Del(ctx, key).Err(); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, err
+}
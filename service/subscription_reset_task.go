@@ -45,6 +45,9 @@ func StartSubscriptionQuotaResetTask() {
 }
 
 func runSubscriptionQuotaResetOnce() {
+	if !model.IsLeader() {
+		return
+	}
 	if !subscriptionResetRunning.CompareAndSwap(false, true) {
 		return
 	}
@@ -1,11 +1,220 @@
 package service
 
 import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/url"
 	"strings"
+	"time"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 )
 
+// 异步生成任务（音乐、视频等）的通用生命周期：提交时按次预扣费并写入任务，之后由轮询或上游回调查询结果，
+// 统一经 ApplyTaskResult 更新状态；任务失败时退还预扣额度，成功且上游返回 tokens 时按实际用量结算差额。
+// 新的异步供应商只需实现 channel.TaskAdaptor，需要回调时再实现 channel.TaskCallbackAdaptor
+
 func CoverTaskActionToModelName(platform constant.TaskPlatform, action string) string {
 	return strings.ToLower(string(platform)) + "_" + strings.ToLower(action)
 }
+
+// ApplyTaskResult 按上游返回的任务结果更新任务，task.Data 需由调用方先行写入。
+// 任务已被其他实例或回调结束时不做任何更改，退款与结算只在本次更新生效后执行，保证每个任务只结算一次
+func ApplyTaskResult(ctx context.Context, task *model.Task, result *relaycommon.TaskInfo) error {
+	if result.Status == "" {
+		result = relaycommon.FailTaskInfo("upstream returned empty status")
+	}
+	now := time.Now().Unix()
+	refund := false
+	var settlement *taskSettlement
+
+	task.Status = model.TaskStatus(result.Status)
+	switch result.Status {
+	case string(model.TaskStatusNotStart):
+	case model.TaskStatusSubmitted:
+		task.Progress = "10%"
+	case model.TaskStatusQueued:
+		task.Progress = "20%"
+	case model.TaskStatusInProgress:
+		task.Progress = "30%"
+		if task.StartTime == 0 {
+			task.StartTime = now
+		}
+	case model.TaskStatusSuccess:
+		task.Progress = "100%"
+		if task.FinishTime == 0 {
+			task.FinishTime = now
+		}
+		if !strings.HasPrefix(result.Url, "data:") {
+			task.FailReason = result.Url
+		}
+		if result.TotalTokens > 0 {
+			settlement = settleTaskQuota(task, result.TotalTokens)
+			if settlement != nil {
+				task.Quota = settlement.actualQuota
+			}
+		}
+	case model.TaskStatusFailure:
+		task.Progress = "100%"
+		if task.FinishTime == 0 {
+			task.FinishTime = now
+		}
+		if result.Reason != "" {
+			task.FailReason = result.Reason
+		}
+		logger.LogInfo(ctx, fmt.Sprintf("Task %s failed: %s", task.TaskID, task.FailReason))
+		refund = task.Quota != 0
+	default:
+		return fmt.Errorf("unknown task status %s for task %s", result.Status, task.TaskID)
+	}
+	if result.Progress != "" {
+		task.Progress = result.Progress
+	}
+
+	applied, err := task.UpdateUnfinished()
+	if err != nil {
+		return fmt.Errorf("update task %s failed: %w", task.TaskID, err)
+	}
+	if !applied {
+		logger.LogWarn(ctx, fmt.Sprintf("Task %s already finished, skip update", task.TaskID))
+		return nil
+	}
+
+	if refund {
+		if err := model.IncreaseUserQuota(task.UserId, task.Quota, false); err != nil {
+			logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
+		}
+		logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, logger.LogQuota(task.Quota))
+		model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+	}
+	if settlement != nil {
+		settlement.apply(ctx, task)
+	}
+	return nil
+}
+
+// FailTasks 将未结束的任务置为失败并退还预扣额度，用于渠道失效等无法继续查询的情况
+func FailTasks(ctx context.Context, tasks []*model.Task, reason string) {
+	for _, task := range tasks {
+		if err := ApplyTaskResult(ctx, task, relaycommon.FailTaskInfo(reason)); err != nil {
+			logger.LogError(ctx, err.Error())
+		}
+	}
+}
+
+type taskSettlement struct {
+	totalTokens      int
+	modelRatio       float64
+	groupRatio       float64
+	preConsumedQuota int
+	actualQuota      int
+}
+
+// settleTaskQuota 上游返回 tokens 且模型配置了倍率（非固定价格）时，按 tokens × 模型倍率 × 分组倍率计算实际额度
+func settleTaskQuota(task *model.Task, totalTokens int) *taskSettlement {
+	var taskData map[string]any
+	if err := json.Unmarshal(task.Data, &taskData); err != nil {
+		return nil
+	}
+	modelName, _ := taskData["model"].(string)
+	if modelName == "" {
+		return nil
+	}
+	modelRatio, hasRatioSetting, _ := ratio_setting.GetModelRatio(modelName)
+	// 按提交时间与服务渠道匹配差异化定价
+	if rule, ok := ratio_setting.MatchPricingRule(modelName, task.ChannelId, time.Unix(task.SubmitTime, 0)); ok {
+		modelRatio *= rule.Ratio
+	}
+	if !hasRatioSetting || modelRatio <= 0 {
+		return nil
+	}
+	group := task.Group
+	if group == "" {
+		if user, err := model.GetUserById(task.UserId, false); err == nil {
+			group = user.Group
+		}
+	}
+	if group == "" {
+		return nil
+	}
+	groupRatio := ratio_setting.GetGroupRatio(group)
+	if userGroupRatio, ok := ratio_setting.GetGroupGroupRatio(group, group); ok {
+		groupRatio = userGroupRatio
+	}
+	return &taskSettlement{
+		totalTokens:      totalTokens,
+		modelRatio:       modelRatio,
+		groupRatio:       groupRatio,
+		preConsumedQuota: task.Quota,
+		actualQuota:      int(float64(totalTokens) * modelRatio * groupRatio),
+	}
+}
+
+// apply 补扣或退还预扣费与实际消耗的差额
+func (s *taskSettlement) apply(ctx context.Context, task *model.Task) {
+	quotaDelta := s.actualQuota - s.preConsumedQuota
+	switch {
+	case quotaDelta > 0:
+		logger.LogInfo(ctx, fmt.Sprintf("异步任务 %s 预扣费后补扣费：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
+			task.TaskID, logger.LogQuota(quotaDelta), logger.LogQuota(s.actualQuota), logger.LogQuota(s.preConsumedQuota), s.totalTokens))
+		if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("补扣费失败: %s", err.Error()))
+			s.restore(ctx, task)
+			return
+		}
+		model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
+		model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
+		logContent := fmt.Sprintf("异步任务成功补扣费，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，补扣费 %s",
+			s.modelRatio, s.groupRatio, s.totalTokens,
+			logger.LogQuota(s.preConsumedQuota), logger.LogQuota(s.actualQuota), logger.LogQuota(quotaDelta))
+		model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+	case quotaDelta < 0:
+		refundQuota := -quotaDelta
+		logger.LogInfo(ctx, fmt.Sprintf("异步任务 %s 预扣费后返还：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
+			task.TaskID, logger.LogQuota(refundQuota), logger.LogQuota(s.actualQuota), logger.LogQuota(s.preConsumedQuota), s.totalTokens))
+		if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
+			s.restore(ctx, task)
+			return
+		}
+		logContent := fmt.Sprintf("异步任务成功退还多扣费用，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，退还 %s",
+			s.modelRatio, s.groupRatio, s.totalTokens,
+			logger.LogQuota(s.preConsumedQuota), logger.LogQuota(s.actualQuota), logger.LogQuota(refundQuota))
+		model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+	default:
+		logger.LogInfo(ctx, fmt.Sprintf("异步任务 %s 预扣费准确（%s，tokens：%d）", task.TaskID, logger.LogQuota(s.actualQuota), s.totalTokens))
+	}
+}
+
+// restore 差额结算失败时把任务记录的额度恢复为预扣费额度
+func (s *taskSettlement) restore(ctx context.Context, task *model.Task) {
+	task.Quota = s.preConsumedQuota
+	if err := model.TaskBulkUpdateByID([]int64{task.ID}, map[string]any{"quota": s.preConsumedQuota}); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("restore task %s quota failed: %s", task.TaskID, err.Error()))
+	}
+}
+
+func taskCallbackSign(platform constant.TaskPlatform) string {
+	return common.GenerateHMAC("task_callback:" + string(platform))
+}
+
+// TaskCallbackURL 返回提交任务时传给上游的回调地址，未开启 TASK_CALLBACK_ENABLED 或未设置服务器地址时返回空
+func TaskCallbackURL(platform constant.TaskPlatform) string {
+	if !common.GetEnvOrDefaultBool("TASK_CALLBACK_ENABLED", false) || system_setting.ServerAddress == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/task/callback/%s?sign=%s", strings.TrimRight(system_setting.ServerAddress, "/"),
+		url.PathEscape(string(platform)), taskCallbackSign(platform))
+}
+
+func VerifyTaskCallbackSign(platform constant.TaskPlatform, sign string) bool {
+	return hmac.Equal([]byte(sign), []byte(taskCallbackSign(platform)))
+}
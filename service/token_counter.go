@@ -180,6 +180,40 @@ func getImageToken(c *gin.Context, fileMeta *types.FileMeta, model string, strea
 	return tiles*tileTokens + baseTokens, nil
 }
 
+// getProviderImageToken 按 Claude / Gemini 的图片计费规则估算 token，无法识别或无法获取尺寸时返回 false
+func getProviderImageToken(c *gin.Context, fileMeta *types.FileMeta, model string, shouldFetchFiles bool) (int, bool) {
+	lowerModel := strings.ToLower(model)
+	isClaude := strings.HasPrefix(lowerModel, "claude")
+	isGemini := strings.HasPrefix(lowerModel, "gemini")
+	if !isClaude && !isGemini {
+		return 0, false
+	}
+	if fileMeta == nil || fileMeta.Source == nil || (fileMeta.Source.IsURL() && !shouldFetchFiles) {
+		return 0, false
+	}
+	config, _, err := GetImageConfig(c, fileMeta.Source)
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return 0, false
+	}
+	width := float64(config.Width)
+	height := float64(config.Height)
+
+	if isClaude {
+		// 最长边超过 1568 或像素数超过约 1.15MP 时服务端会等比缩放，tokens = 宽 * 高 / 750
+		scale := math.Min(1, 1568/math.Max(width, height))
+		scale = math.Min(scale, math.Sqrt(1150000/(width*height)))
+		tokens := int(math.Ceil(width * scale * height * scale / 750))
+		return min(tokens, 1600), true
+	}
+
+	// Gemini：两边均不超过 384 时按 258 计，否则按 768x768 切块，每块 258
+	if width <= 384 && height <= 384 {
+		return 258, true
+	}
+	tiles := math.Ceil(width/768) * math.Ceil(height/768)
+	return int(tiles) * 258, true
+}
+
 func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *relaycommon.RelayInfo) (int, error) {
 	// 是否统计token
 	if !constant.CountToken {
@@ -200,6 +234,7 @@ func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *rela
 		}
 		fileHeaders := multiForm.File["file"]
 		totalAudioToken := 0
+		totalDuration := 0.0
 		for _, fileHeader := range fileHeaders {
 			file, err := fileHeader.Open()
 			if err != nil {
@@ -214,7 +249,9 @@ func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *rela
 			}
 			// 一分钟 1000 token，与 $price / minute 对齐
 			totalAudioToken += int(math.Round(math.Ceil(duration) / 60.0 * 1000))
+			totalDuration += duration
 		}
+		common.SetContextKey(c, constant.ContextKeyAudioDurationSeconds, totalDuration)
 		return totalAudioToken, nil
 	}
 
@@ -282,6 +319,8 @@ func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *rela
 					return 0, fmt.Errorf("error counting image token, media index[%d], identifier[%s], err: %v", i, file.GetIdentifier(), err)
 				}
 				tkm += token
+			} else if token, ok := getProviderImageToken(c, file, model, shouldFetchFiles); ok {
+				tkm += token
 			} else {
 				tkm += 520
 			}
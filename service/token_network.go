@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	networkRejectLogInterval = time.Minute
+	ipGeoCacheTTL            = 24 * time.Hour
+	tokenLocationSeenTTL     = time.Hour
+	ipGeoCacheMaxEntries     = 10000
+)
+
+// IPGeo IP 归属的国家与自治系统
+type IPGeo struct {
+	Country string
+	Asn     string
+}
+
+type expiringEntry struct {
+	value    any
+	expireAt time.Time
+}
+
+// expiringCache 带过期时间的内存缓存，超过容量时整体清空
+type expiringCache struct {
+	mu      sync.Mutex
+	entries map[string]expiringEntry
+}
+
+func (e *expiringCache) get(key string) (any, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	entry, ok := e.entries[key]
+	if !ok || time.Now().After(entry.expireAt) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (e *expiringCache) set(key string, value any, ttl time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.entries == nil || len(e.entries) >= ipGeoCacheMaxEntries {
+		e.entries = make(map[string]expiringEntry)
+	}
+	e.entries[key] = expiringEntry{value: value, expireAt: time.Now().Add(ttl)}
+}
+
+var (
+	networkRejectLogged expiringCache
+	ipGeoCache          expiringCache
+	tokenLocationSeen   expiringCache
+)
+
+// RecordNetworkRejection 记录被网络限制拒绝的请求，同一令牌同一 IP 每分钟最多记录一次
+func RecordNetworkRejection(userId int, tokenId int, tokenName string, ip string, reason string) {
+	logger.LogWarn(context.Background(), fmt.Sprintf("token %d of user %d rejected from %s: %s", tokenId, userId, ip, reason))
+	if !system_setting.GetNetworkSecuritySettings().RecordRejected {
+		return
+	}
+	key := fmt.Sprintf("%d|%s", tokenId, ip)
+	if _, ok := networkRejectLogged.get(key); ok {
+		return
+	}
+	networkRejectLogged.set(key, true, networkRejectLogInterval)
+	gopool.Go(func() {
+		model.RecordNetworkRejectLog(userId, tokenId, tokenName, ip, fmt.Sprintf("令牌 %s 的请求被拒绝：%s", tokenName, reason))
+	})
+}
+
+// LookupIPGeo 通过配置的接口查询 IP 归属地，结果缓存一天
+func LookupIPGeo(ip string) (*IPGeo, error) {
+	if cached, ok := ipGeoCache.get(ip); ok {
+		return cached.(*IPGeo), nil
+	}
+	lookupURL := system_setting.GetNetworkSecuritySettings().GeoLookupURL
+	if lookupURL == "" {
+		return nil, fmt.Errorf("geo lookup url is not configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(lookupURL, "{ip}", ip), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geo lookup returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	geo, err := parseIPGeo(body)
+	if err != nil {
+		return nil, err
+	}
+	ipGeoCache.set(ip, geo, ipGeoCacheTTL)
+	return geo, nil
+}
+
+// parseIPGeo 兼容 ipapi.co、ip-api.com、ipinfo.io 等常见接口的返回格式
+func parseIPGeo(body []byte) (*IPGeo, error) {
+	var data map[string]any
+	if err := common.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	str := func(keys ...string) string {
+		for _, key := range keys {
+			switch v := data[key].(type) {
+			case string:
+				if v != "" {
+					return v
+				}
+			case float64:
+				return fmt.Sprintf("AS%d", int64(v))
+			}
+		}
+		return ""
+	}
+	geo := &IPGeo{
+		Country: strings.ToUpper(str("country_code", "countryCode", "country")),
+		Asn:     str("asn", "as", "org"),
+	}
+	// ip-api.com 与 ipinfo.io 的 ASN 字段形如 "AS15169 Google LLC"
+	if fields := strings.Fields(geo.Asn); len(fields) > 0 {
+		geo.Asn = strings.ToUpper(fields[0])
+	}
+	if len(geo.Country) > 8 {
+		geo.Country = geo.Country[:8]
+	}
+	if len(geo.Asn) > 32 {
+		geo.Asn = geo.Asn[:32]
+	}
+	if geo.Country == "" && geo.Asn == "" {
+		return nil, fmt.Errorf("geo lookup response has no country or asn")
+	}
+	return geo, nil
+}
+
+// TrackTokenLocation 异步记录令牌的使用位置，令牌首次出现在新的国家或 ASN 时通知用户
+func TrackTokenLocation(userId int, tokenId int, tokenName string, ip string) {
+	settings := system_setting.GetNetworkSecuritySettings()
+	if !settings.NewLocationNotify || settings.GeoLookupURL == "" {
+		return
+	}
+	if parsed := net.ParseIP(ip); parsed == nil || common.IsPrivateIP(parsed) {
+		return
+	}
+	seenKey := fmt.Sprintf("%d|%s", tokenId, ip)
+	if _, ok := tokenLocationSeen.get(seenKey); ok {
+		return
+	}
+	tokenLocationSeen.set(seenKey, true, tokenLocationSeenTTL)
+	gopool.Go(func() {
+		geo, err := LookupIPGeo(ip)
+		if err != nil {
+			logger.LogWarn(context.Background(), fmt.Sprintf("failed to look up geo of %s: %v", ip, err))
+			return
+		}
+		isNew, hadHistory, err := model.RecordTokenLocation(tokenId, geo.Country, geo.Asn, ip)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to record token %d location: %s", tokenId, err.Error()))
+			return
+		}
+		if !isNew || !hadHistory {
+			return
+		}
+		userCache, err := model.GetUserCache(userId)
+		if err != nil {
+			return
+		}
+		content := fmt.Sprintf("令牌 %s 在新的网络位置被使用：IP %s，国家/地区 %s，ASN %s。如非本人操作，请尽快禁用该令牌。", tokenName, ip, geo.Country, geo.Asn)
+		err = NotifyUser(userId, userCache.Email, userCache.GetSetting(), dto.NewNotify(dto.NotifyTypeTokenLocation, "令牌在新位置使用", content, nil))
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to send token location notify to user %d: %s", userId, err.Error()))
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"math"
+	"math/bits"
+)
+
+// 按 token 计费的常见请求使用定点整数计算额度，避免每次请求创建大量 decimal 对象。
+// 倍率按 1e-9 精度转换为整数，中间结果使用 128 位乘除；倍率超过 9 位小数时在舍入边界上可能与 decimal 结果相差 1
+
+const ratioScale = 1_000_000_000
+
+type TokenQuotaParams struct {
+	PromptTokens        int
+	CompletionTokens    int
+	CacheTokens         int
+	CacheCreationTokens int
+	ImageTokens         int
+	// PromptIncludesCached prompt_tokens 是否包含缓存 tokens，Anthropic 的 input_tokens 不包含
+	PromptIncludesCached bool
+
+	ModelRatio         float64
+	GroupRatio         float64
+	CompletionRatio    float64
+	CacheRatio         float64
+	CacheCreationRatio float64
+	ImageRatio         float64
+}
+
+func ratioToFixed(ratio float64) (uint64, bool) {
+	if ratio < 0 || ratio > 1e9 || math.IsNaN(ratio) {
+		return 0, false
+	}
+	return uint64(math.Round(ratio * ratioScale)), true
+}
+
+// mulDivRound 返回 a*b/d 四舍五入后的结果，商超出 64 位时返回 false
+func mulDivRound(a, b, d uint64) (uint64, bool) {
+	hi, lo := bits.Mul64(a, b)
+	if hi >= d {
+		return 0, false
+	}
+	quo, rem := bits.Div64(hi, lo, d)
+	if rem >= d-rem {
+		quo++
+	}
+	return quo, true
+}
+
+// CalcTokenQuota 计算 (基础 tokens + 各类 tokens × 对应倍率 + 补全 tokens × 补全倍率) × 模型倍率 × 分组倍率，
+// 出现负数或溢出时返回 false，由调用方改用 decimal 计算
+func CalcTokenQuota(p TokenQuotaParams) (int, bool) {
+	baseTokens := p.PromptTokens - p.ImageTokens
+	if p.CacheTokens != 0 && p.PromptIncludesCached {
+		baseTokens -= p.CacheTokens
+	}
+	if p.CacheCreationTokens != 0 && p.PromptIncludesCached {
+		baseTokens -= p.CacheCreationTokens
+	}
+	if baseTokens < 0 || p.CompletionTokens < 0 || p.CacheTokens < 0 || p.CacheCreationTokens < 0 || p.ImageTokens < 0 {
+		return 0, false
+	}
+
+	terms := [...]struct {
+		tokens int
+		ratio  float64
+	}{
+		{baseTokens, 1},
+		{p.CacheTokens, p.CacheRatio},
+		{p.CacheCreationTokens, p.CacheCreationRatio},
+		{p.ImageTokens, p.ImageRatio},
+		{p.CompletionTokens, p.CompletionRatio},
+	}
+	// 以 1/ratioScale 个 token 为单位的加权 tokens
+	var weighted uint64
+	for _, term := range terms {
+		if term.tokens == 0 {
+			continue
+		}
+		ratio, ok := ratioToFixed(term.ratio)
+		if !ok {
+			return 0, false
+		}
+		hi, lo := bits.Mul64(uint64(term.tokens), ratio)
+		if hi != 0 {
+			return 0, false
+		}
+		var carry uint64
+		weighted, carry = bits.Add64(weighted, lo, 0)
+		if carry != 0 {
+			return 0, false
+		}
+	}
+
+	modelRatio, ok := ratioToFixed(p.ModelRatio)
+	if !ok {
+		return 0, false
+	}
+	groupRatio, ok := ratioToFixed(p.GroupRatio)
+	if !ok {
+		return 0, false
+	}
+	// 先乘模型倍率仍保留 1/ratioScale 精度，再乘分组倍率换算为额度
+	weighted, ok = mulDivRound(weighted, modelRatio, ratioScale)
+	if !ok {
+		return 0, false
+	}
+	quota, ok := mulDivRound(weighted, groupRatio, ratioScale*ratioScale)
+	if !ok || quota > math.MaxInt64 {
+		return 0, false
+	}
+	return int(quota), true
+}
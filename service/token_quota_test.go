@@ -0,0 +1,175 @@
+package service
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// decimalTokenQuota 与 relay 中 postConsumeQuota 按倍率计费的 decimal 分支保持一致
+func decimalTokenQuota(p TokenQuotaParams) int {
+	return minQuota(p, int(decimalTokenQuotaValue(p).Round(0).IntPart()))
+}
+
+func decimalTokenQuotaValue(p TokenQuotaParams) decimal.Decimal {
+	baseTokens := decimal.NewFromInt(int64(p.PromptTokens))
+	dCacheTokens := decimal.NewFromInt(int64(p.CacheTokens))
+	dCachedCreationTokens := decimal.NewFromInt(int64(p.CacheCreationTokens))
+	dImageTokens := decimal.NewFromInt(int64(p.ImageTokens))
+	ratio := decimal.NewFromFloat(p.ModelRatio).Mul(decimal.NewFromFloat(p.GroupRatio))
+
+	var cachedTokensWithRatio, cachedCreationTokensWithRatio, imageTokensWithRatio decimal.Decimal
+	if !dCacheTokens.IsZero() {
+		if p.PromptIncludesCached {
+			baseTokens = baseTokens.Sub(dCacheTokens)
+		}
+		cachedTokensWithRatio = dCacheTokens.Mul(decimal.NewFromFloat(p.CacheRatio))
+	}
+	if !dCachedCreationTokens.IsZero() {
+		if p.PromptIncludesCached {
+			baseTokens = baseTokens.Sub(dCachedCreationTokens)
+		}
+		cachedCreationTokensWithRatio = dCachedCreationTokens.Mul(decimal.NewFromFloat(p.CacheCreationRatio))
+	}
+	if !dImageTokens.IsZero() {
+		baseTokens = baseTokens.Sub(dImageTokens)
+		imageTokensWithRatio = dImageTokens.Mul(decimal.NewFromFloat(p.ImageRatio))
+	}
+	promptQuota := baseTokens.Add(cachedTokensWithRatio).Add(imageTokensWithRatio).Add(cachedCreationTokensWithRatio)
+	completionQuota := decimal.NewFromInt(int64(p.CompletionTokens)).Mul(decimal.NewFromFloat(p.CompletionRatio))
+	quota := promptQuota.Add(completionQuota).Mul(ratio)
+	if !ratio.IsZero() && quota.LessThanOrEqual(decimal.Zero) {
+		quota = decimal.NewFromInt(1)
+	}
+	return quota
+}
+
+// minQuota 与 postConsumeQuota 对两条路径共同的处理一致：倍率非零时至少扣 1
+func minQuota(p TokenQuotaParams, quota int) int {
+	if quota == 0 && p.ModelRatio != 0 && p.GroupRatio != 0 {
+		return 1
+	}
+	return quota
+}
+
+func integerTokenQuota(p TokenQuotaParams) (int, bool) {
+	quota, ok := CalcTokenQuota(p)
+	return minQuota(p, quota), ok
+}
+
+func TestCalcTokenQuotaParity(t *testing.T) {
+	base := TokenQuotaParams{ModelRatio: 1, GroupRatio: 1, CompletionRatio: 1, CacheRatio: 1, CacheCreationRatio: 1, ImageRatio: 1, PromptIncludesCached: true}
+	with := func(f func(p *TokenQuotaParams)) TokenQuotaParams {
+		p := base
+		f(&p)
+		return p
+	}
+	cases := []struct {
+		name   string
+		params TokenQuotaParams
+		want   int
+	}{
+		{"plain", with(func(p *TokenQuotaParams) { p.PromptTokens, p.CompletionTokens = 1000, 500 }), 1500},
+		{"model and completion ratio", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.CompletionTokens, p.ModelRatio, p.CompletionRatio = 1000, 200, 1.25, 4
+		}), 2250},
+		{"group ratio", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.CompletionTokens, p.ModelRatio, p.GroupRatio = 1234, 567, 0.75, 0.8
+		}), 1081},
+		{"round half up", with(func(p *TokenQuotaParams) { p.PromptTokens, p.ModelRatio = 3, 0.5 }), 2},
+		{"round down", with(func(p *TokenQuotaParams) { p.PromptTokens, p.ModelRatio = 7, 1.0714 }), 7},
+		{"round down after group", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.ModelRatio, p.GroupRatio = 25, 0.3, 0.3
+		}), 2},
+		{"round half up after group", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.ModelRatio, p.GroupRatio = 50, 0.3, 0.3
+		}), 5},
+		{"rounds to zero bills one", with(func(p *TokenQuotaParams) { p.PromptTokens, p.ModelRatio = 7, 0.0714 }), 1},
+		{"tiny ratio bills one", with(func(p *TokenQuotaParams) { p.PromptTokens, p.ModelRatio = 1, 0.001 }), 1},
+		{"cache tokens included in prompt", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.CacheTokens, p.CompletionTokens, p.CacheRatio, p.ModelRatio = 10000, 8000, 100, 0.1, 1.5
+		}), 4350},
+		{"cache creation tokens included in prompt", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.CacheTokens, p.CacheCreationTokens, p.CacheRatio, p.CacheCreationRatio = 3000, 1000, 1000, 0.1, 1.25
+		}), 2350},
+		{"claude cache tokens not in prompt", with(func(p *TokenQuotaParams) {
+			p.PromptIncludesCached = false
+			p.PromptTokens, p.CacheTokens, p.CacheCreationTokens, p.CompletionTokens = 50, 20000, 3000, 800
+			p.CacheRatio, p.CacheCreationRatio, p.CompletionRatio, p.ModelRatio = 0.1, 1.25, 5, 1.5
+		}), 14700},
+		{"image tokens", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.ImageTokens, p.ImageRatio, p.CompletionTokens, p.CompletionRatio = 2000, 1500, 2, 100, 8
+		}), 4300},
+		// 未配置音频单价时 decimal 分支不扣除音频 tokens，与 prompt_tokens 一并按模型倍率计费
+		{"audio tokens without audio price", with(func(p *TokenQuotaParams) { p.PromptTokens, p.ModelRatio = 900, 2.5 }), 2250},
+		{"group ratio with cache and image", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.CacheTokens, p.ImageTokens, p.CompletionTokens = 12345, 2345, 1000, 678
+			p.CacheRatio, p.ImageRatio, p.CompletionRatio, p.ModelRatio, p.GroupRatio = 0.25, 1.5, 3, 0.375, 1.3
+		}), 6396},
+		{"large usage", with(func(p *TokenQuotaParams) {
+			p.PromptTokens, p.CompletionTokens, p.ModelRatio, p.CompletionRatio, p.GroupRatio = 20_000_000, 10_000_000, 37.5, 4, 2
+		}), 4_500_000_000},
+	}
+	for _, tc := range cases {
+		got, ok := integerTokenQuota(tc.params)
+		if !ok {
+			t.Fatalf("%s: integer path rejected params", tc.name)
+		}
+		if want := decimalTokenQuota(tc.params); got != want || got != tc.want {
+			t.Fatalf("%s: integer=%d decimal=%d want=%d", tc.name, got, want, tc.want)
+		}
+	}
+}
+
+// 倍率不超过 3 位小数时两条路径结果完全一致
+func TestCalcTokenQuotaParityRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ratio := func(max int) float64 {
+		return float64(rng.Intn(max*1000+1)) / 1000
+	}
+	for i := 0; i < 20000; i++ {
+		p := TokenQuotaParams{
+			PromptTokens:         rng.Intn(200000),
+			CompletionTokens:     rng.Intn(50000),
+			PromptIncludesCached: rng.Intn(2) == 0,
+			ModelRatio:           ratio(100),
+			GroupRatio:           ratio(3),
+			CompletionRatio:      ratio(10),
+			CacheRatio:           ratio(1),
+			CacheCreationRatio:   ratio(2),
+			ImageRatio:           ratio(3),
+		}
+		if p.PromptTokens > 0 {
+			p.CacheTokens = rng.Intn(p.PromptTokens/2 + 1)
+			p.CacheCreationTokens = rng.Intn(p.PromptTokens/4 + 1)
+			p.ImageTokens = rng.Intn(p.PromptTokens/4 + 1)
+		}
+		got, ok := integerTokenQuota(p)
+		if !ok {
+			t.Fatalf("integer path rejected %+v", p)
+		}
+		if want := decimalTokenQuota(p); got != want {
+			t.Fatalf("integer=%d decimal=%d for %+v", got, want, p)
+		}
+	}
+}
+
+// 无法用整数精确计算时返回 false，由调用方改用 decimal
+func TestCalcTokenQuotaFallback(t *testing.T) {
+	for name, p := range map[string]TokenQuotaParams{
+		"cache exceeds prompt": {PromptTokens: 10, CacheTokens: 20, PromptIncludesCached: true, ModelRatio: 1, GroupRatio: 1},
+		"image exceeds prompt": {PromptTokens: 10, ImageTokens: 20, ModelRatio: 1, GroupRatio: 1},
+		"negative completion":  {PromptTokens: 10, CompletionTokens: -1, ModelRatio: 1, GroupRatio: 1},
+		"negative ratio":       {PromptTokens: 10, ModelRatio: -1, GroupRatio: 1},
+		"nan ratio":            {PromptTokens: 10, ModelRatio: math.NaN(), GroupRatio: 1},
+		"huge ratio":           {PromptTokens: 10, ModelRatio: 2e9, GroupRatio: 1},
+		"weighted overflow":    {PromptTokens: 2_000_000_000, CompletionTokens: 1_000_000_000, CompletionRatio: 4, ModelRatio: 37.5, GroupRatio: 2},
+		"overflow":             {PromptTokens: math.MaxInt64, CompletionTokens: math.MaxInt64, CompletionRatio: 1e9, ModelRatio: 1e9, GroupRatio: 1e9},
+	} {
+		if _, ok := CalcTokenQuota(p); ok {
+			t.Fatalf("%s: expected fallback", name)
+		}
+	}
+}
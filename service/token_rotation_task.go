@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	tokenRotationTickInterval = 10 * time.Minute
+	tokenRotationBatchSize    = 100
+)
+
+var (
+	tokenRotationOnce    sync.Once
+	tokenRotationRunning atomic.Bool
+)
+
+// StartTokenRotationTask 按分组策略自动轮换令牌密钥，并在令牌到期前提醒用户
+func StartTokenRotationTask() {
+	tokenRotationOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("token rotation task started: tick=%s", tokenRotationTickInterval))
+			ticker := time.NewTicker(tokenRotationTickInterval)
+			defer ticker.Stop()
+
+			runTokenRotationOnce()
+			for range ticker.C {
+				runTokenRotationOnce()
+			}
+		})
+	})
+}
+
+func runTokenRotationOnce() {
+	if !model.IsLeader() {
+		return
+	}
+	if !tokenRotationRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer tokenRotationRunning.Store(false)
+
+	ctx := context.Background()
+	setting := operation_setting.GetTokenRotationSetting()
+	now := time.Now().Unix()
+	for group, policy := range setting.Groups {
+		if policy.IntervalDays <= 0 {
+			continue
+		}
+		overlapHours := policy.OverlapHours
+		if overlapHours <= 0 {
+			overlapHours = setting.DefaultOverlapHours
+		}
+		rotateGroupTokens(ctx, group, now-int64(policy.IntervalDays)*86400, int64(overlapHours)*3600)
+	}
+	if setting.ExpiryNotifyDays > 0 {
+		notifyExpiringTokens(ctx, now+int64(setting.ExpiryNotifyDays)*86400)
+	}
+}
+
+func rotateGroupTokens(ctx context.Context, group string, before int64, overlapSeconds int64) {
+	rotated := 0
+	lastId := 0
+	for {
+		tokens, err := model.GetTokensDueForRotation(group, before, lastId, tokenRotationBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("token rotation task failed to load tokens of group %s: %v", group, err))
+			return
+		}
+		for _, token := range tokens {
+			lastId = token.Id
+			if err = token.RotateKey(overlapSeconds); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("token rotation task failed to rotate token %d: %v", token.Id, err))
+				continue
+			}
+			rotated++
+			content := fmt.Sprintf("您的令牌「%s」已按分组策略自动轮换密钥，旧密钥将在 %s 后失效，请尽快在控制台查看新密钥并更新客户端配置。",
+				token.Name, time.Unix(token.PreviousKeyExpires, 0).Format("2006-01-02 15:04:05"))
+			if token.PreviousKeyExpires == 0 {
+				content = fmt.Sprintf("您的令牌「%s」已按分组策略自动轮换密钥，旧密钥已失效，请在控制台查看新密钥并更新客户端配置。", token.Name)
+			}
+			notifyTokenOwner(ctx, token, dto.NotifyTypeTokenRotation, "令牌密钥已自动轮换", content)
+		}
+		if len(tokens) < tokenRotationBatchSize {
+			break
+		}
+	}
+	if rotated > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("token rotation task: group=%s, rotated=%d", group, rotated))
+	}
+}
+
+func notifyExpiringTokens(ctx context.Context, before int64) {
+	for {
+		tokens, err := model.GetTokensExpiringBefore(before, tokenRotationBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("token rotation task failed to load expiring tokens: %v", err))
+			return
+		}
+		for _, token := range tokens {
+			// 先标记再通知，避免通知失败时每轮重复发送
+			if err = model.MarkTokenExpiryNotified(token.Id, token.ExpiredTime); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("token rotation task failed to mark token %d: %v", token.Id, err))
+				return
+			}
+			content := fmt.Sprintf("您的令牌「%s」将于 %s 到期，到期后将无法继续使用，请及时延长有效期或创建新令牌。",
+				token.Name, time.Unix(token.ExpiredTime, 0).Format("2006-01-02 15:04:05"))
+			notifyTokenOwner(ctx, token, dto.NotifyTypeTokenExpiry, "令牌即将到期", content)
+		}
+		if len(tokens) < tokenRotationBatchSize {
+			break
+		}
+	}
+}
+
+func notifyTokenOwner(ctx context.Context, token *model.Token, notifyType string, title string, content string) {
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("token rotation task failed to load user %d: %v", token.UserId, err))
+		return
+	}
+	if err = NotifyUser(token.UserId, userCache.Email, userCache.GetSetting(), dto.NewNotify(notifyType, title, content, nil)); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("token rotation task failed to notify user %d: %v", token.UserId, err))
+	}
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// TransformMeta 转换器可读取的请求信息，pre_auth 阶段只有路径与请求 ID
+type TransformMeta struct {
+	RequestId string `json:"request_id"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	UserId    int    `json:"user_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Group     string `json:"group,omitempty"`
+	TokenId   int    `json:"token_id,omitempty"`
+	TokenName string `json:"token_name,omitempty"`
+	Model     string `json:"model,omitempty"`
+	Quota     int    `json:"quota,omitempty"`  // 仅 post_billing 阶段
+	Tokens    int    `json:"tokens,omitempty"` // 仅 post_billing 阶段
+}
+
+// TransformContext 转换器的输入输出，转换器直接修改 Header 与 Body。
+// pre 阶段为请求头与请求体，post_response 阶段为响应头与响应体，post_billing 阶段 Body 为空
+type TransformContext struct {
+	Stage      string
+	Meta       TransformMeta
+	Header     http.Header
+	Body       []byte
+	StatusCode int
+}
+
+// TransformAbortError 转换器主动拒绝请求，不受 fail_open 影响
+type TransformAbortError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *TransformAbortError) Error() string {
+	return e.Message
+}
+
+type TransformHookFunc func(ctx context.Context, tc *TransformContext, params map[string]any) error
+
+var (
+	transformHooksLock sync.RWMutex
+	transformHooks     = map[string]TransformHookFunc{}
+)
+
+// RegisterTransformHook 注册内置转换器，名称重复时覆盖
+func RegisterTransformHook(name string, fn TransformHookFunc) {
+	transformHooksLock.Lock()
+	defer transformHooksLock.Unlock()
+	transformHooks[name] = fn
+}
+
+func getTransformHook(name string) TransformHookFunc {
+	transformHooksLock.RLock()
+	defer transformHooksLock.RUnlock()
+	return transformHooks[name]
+}
+
+// GetTransformHookNames 返回已注册的转换器名称
+func GetTransformHookNames() []string {
+	transformHooksLock.RLock()
+	defer transformHooksLock.RUnlock()
+	names := make([]string, 0, len(transformHooks))
+	for name := range transformHooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterTransformHook("set_header", setHeaderTransform)
+	RegisterTransformHook("remove_header", removeHeaderTransform)
+	RegisterTransformHook("json_set", jsonSetTransform)
+	RegisterTransformHook("json_delete", jsonDeleteTransform)
+	RegisterTransformHook("http", httpTransform)
+}
+
+func transformParamString(params map[string]any, key string) string {
+	value, _ := params[key].(string)
+	return value
+}
+
+func transformParamStrings(params map[string]any, key string) []string {
+	items, _ := params[key].([]any)
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok && s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+func transformParamMap(params map[string]any, key string) map[string]any {
+	value, _ := params[key].(map[string]any)
+	return value
+}
+
+// setHeaderTransform params: {"headers": {"X-Tenant": "acme"}}
+func setHeaderTransform(_ context.Context, tc *TransformContext, params map[string]any) error {
+	for key, value := range transformParamMap(params, "headers") {
+		tc.Header.Set(key, fmt.Sprint(value))
+	}
+	return nil
+}
+
+// removeHeaderTransform params: {"headers": ["X-Debug"]}
+func removeHeaderTransform(_ context.Context, tc *TransformContext, params map[string]any) error {
+	for _, key := range transformParamStrings(params, "headers") {
+		tc.Header.Del(key)
+	}
+	return nil
+}
+
+// jsonSetTransform params: {"values": {"metadata.tenant": "acme"}}，路径语法同 sjson
+func jsonSetTransform(_ context.Context, tc *TransformContext, params map[string]any) error {
+	if len(tc.Body) == 0 {
+		return nil
+	}
+	values := transformParamMap(params, "values")
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		body, err := sjson.SetBytes(tc.Body, path, values[path])
+		if err != nil {
+			return fmt.Errorf("set %s: %w", path, err)
+		}
+		tc.Body = body
+	}
+	return nil
+}
+
+// jsonDeleteTransform params: {"paths": ["user", "metadata.debug"]}
+func jsonDeleteTransform(_ context.Context, tc *TransformContext, params map[string]any) error {
+	if len(tc.Body) == 0 {
+		return nil
+	}
+	for _, path := range transformParamStrings(params, "paths") {
+		body, err := sjson.DeleteBytes(tc.Body, path)
+		if err != nil {
+			return fmt.Errorf("delete %s: %w", path, err)
+		}
+		tc.Body = body
+	}
+	return nil
+}
+
+type httpTransformRequest struct {
+	Stage      string            `json:"stage"`
+	Meta       TransformMeta     `json:"meta"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	StatusCode int               `json:"status_code,omitempty"`
+}
+
+type httpTransformResponse struct {
+	Body          *string           `json:"body"` // 为空时保持原内容
+	SetHeaders    map[string]string `json:"set_headers"`
+	RemoveHeaders []string          `json:"remove_headers"`
+	Reject        *struct {
+		StatusCode int    `json:"status_code"`
+		Message    string `json:"message"`
+	} `json:"reject"`
+}
+
+// httpTransform 将内容发送到外部转换服务，由其返回修改结果。
+// params: {"url": "...", "secret": "...", "timeout_seconds": 5}
+func httpTransform(ctx context.Context, tc *TransformContext, params map[string]any) error {
+	url := transformParamString(params, "url")
+	if url == "" {
+		return errors.New("url is not configured")
+	}
+	timeout := 5 * time.Second
+	if seconds, ok := params["timeout_seconds"].(float64); ok && seconds > 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	payload := httpTransformRequest{
+		Stage:      tc.Stage,
+		Meta:       tc.Meta,
+		Headers:    make(map[string]string, len(tc.Header)),
+		Body:       string(tc.Body),
+		StatusCode: tc.StatusCode,
+	}
+	for key := range tc.Header {
+		// 不向外部服务透露客户端凭证
+		if key == "Authorization" || key == "X-Api-Key" || key == "X-Goog-Api-Key" {
+			continue
+		}
+		payload.Headers[key] = tc.Header.Get(key)
+	}
+	data, err := common.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := transformParamString(params, "secret"); secret != "" {
+		req.Header.Set("X-Webhook-Signature", generateSignature(secret, data))
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status code %d: %s", resp.StatusCode, string(respData))
+	}
+	if tc.Stage == operation_setting.TransformStagePostBilling || len(bytes.TrimSpace(respData)) == 0 {
+		return nil
+	}
+	var result httpTransformResponse
+	if err = common.Unmarshal(respData, &result); err != nil {
+		return err
+	}
+	if result.Reject != nil {
+		status := result.Reject.StatusCode
+		if status < 400 || status > 599 {
+			status = http.StatusForbidden
+		}
+		return &TransformAbortError{StatusCode: status, Message: result.Reject.Message}
+	}
+	for key, value := range result.SetHeaders {
+		tc.Header.Set(key, value)
+	}
+	for _, key := range result.RemoveHeaders {
+		tc.Header.Del(key)
+	}
+	if result.Body != nil {
+		tc.Body = []byte(*result.Body)
+	}
+	return nil
+}
+
+// ValidateTransformHooks 检查阶段与转换器名称是否有效
+func ValidateTransformHooks(hooks []operation_setting.TransformHookConfig) error {
+	for i, hook := range hooks {
+		if !operation_setting.IsValidTransformStage(hook.Stage) {
+			return fmt.Errorf("第 %d 个转换器的阶段 %q 无效", i+1, hook.Stage)
+		}
+		if getTransformHook(hook.Hook) == nil {
+			return fmt.Errorf("第 %d 个转换器 %q 未注册，可用：%v", i+1, hook.Hook, GetTransformHookNames())
+		}
+		if hook.Hook == "http" && transformParamString(hook.Params, "url") == "" {
+			return fmt.Errorf("第 %d 个转换器未配置 url", i+1)
+		}
+		if hook.Stage == operation_setting.TransformStagePostBilling && hook.Hook != "http" {
+			return fmt.Errorf("post_billing 阶段只能使用 http 转换器")
+		}
+	}
+	return nil
+}
+
+// RunTransformHooks 按顺序执行转换器，fail_open 的转换器出错时只记录日志
+func RunTransformHooks(c *gin.Context, hooks []operation_setting.TransformHookConfig, tc *TransformContext) error {
+	ctx := context.Background()
+	if c != nil {
+		ctx = c.Request.Context()
+	}
+	for i := range hooks {
+		hook := &hooks[i]
+		fn := getTransformHook(hook.Hook)
+		if fn == nil {
+			continue
+		}
+		err := fn(ctx, tc, hook.Params)
+		if err == nil {
+			continue
+		}
+		var abortErr *TransformAbortError
+		if errors.As(err, &abortErr) || !hook.FailOpen {
+			return fmt.Errorf("transform hook %s failed: %w", hook.Name, err)
+		}
+		logger.LogWarn(ctx, fmt.Sprintf("transform hook %s skipped: %s", hook.Name, err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// maxIsolatedPools 独立连接池的数量上限，GetHttpClient 也会请求用户提供的地址，超出时淘汰最久未使用的连接池
+const maxIsolatedPools = 256
+
+// upstreamTransport 按上游域名分配独立的 http.Transport，连接池参数读取 upstream_pool_setting，
+// 参数变化后在下一次请求时重建该域名的连接池
+type upstreamTransport struct {
+	name string
+	// configure 设置代理与拨号方式
+	configure func(transport *http.Transport) error
+
+	mu    sync.Mutex
+	pools map[string]*upstreamPool
+}
+
+type upstreamPool struct {
+	transport *http.Transport
+	config    operation_setting.UpstreamPoolConfig
+	stats     *upstreamPoolStats
+	lastUsed  int64
+}
+
+type upstreamPoolStats struct {
+	requests   atomic.Int64
+	inFlight   atomic.Int64
+	openConns  atomic.Int64
+	dials      atomic.Int64
+	dialErrors atomic.Int64
+}
+
+type upstreamPoolKey struct {
+	client string
+	host   string
+}
+
+var upstreamPoolStatsMap sync.Map // upstreamPoolKey -> *upstreamPoolStats
+
+func newUpstreamTransport(name string, configure func(transport *http.Transport) error) (*upstreamTransport, error) {
+	t := &upstreamTransport{name: name, configure: configure, pools: make(map[string]*upstreamPool)}
+	// 提前校验代理配置
+	if err := configure(&http.Transport{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pool, err := t.pool(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	pool.stats.requests.Add(1)
+	pool.stats.inFlight.Add(1)
+	resp, err := pool.transport.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		pool.stats.inFlight.Add(-1)
+		return resp, err
+	}
+	resp.Body = &inFlightBody{ReadCloser: resp.Body, stats: pool.stats}
+	return resp, nil
+}
+
+func (t *upstreamTransport) pool(host string) (*upstreamPool, error) {
+	setting := operation_setting.GetUpstreamPoolSetting()
+	key := ""
+	if setting.Isolate {
+		key = host
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if key != "" && t.pools[key] == nil && !t.reserveIsolatedPoolLocked() {
+		// 独立连接池已满且都有进行中的请求，回落到共用连接池
+		key = ""
+	}
+	config := setting.Resolve(hostname(key))
+	now := time.Now().Unix()
+	pool := t.pools[key]
+	if pool != nil && pool.config == config {
+		pool.lastUsed = now
+		return pool, nil
+	}
+	if pool != nil {
+		// 进行中的请求继续使用旧连接，空闲连接立即关闭
+		pool.transport.CloseIdleConnections()
+	}
+	stats := upstreamStats(t.name, key)
+	transport, err := t.newTransport(config, stats)
+	if err != nil {
+		return nil, err
+	}
+	pool = &upstreamPool{transport: transport, config: config, stats: stats, lastUsed: now}
+	t.pools[key] = pool
+	return pool, nil
+}
+
+// reserveIsolatedPoolLocked 独立连接池达到上限时淘汰最久未使用且没有进行中请求的连接池，返回是否还能新建
+func (t *upstreamTransport) reserveIsolatedPoolLocked() bool {
+	isolated := len(t.pools)
+	if _, ok := t.pools[""]; ok {
+		isolated--
+	}
+	if isolated < maxIsolatedPools {
+		return true
+	}
+	evictKey := ""
+	var evictPool *upstreamPool
+	for key, pool := range t.pools {
+		if key == "" || pool.stats.inFlight.Load() > 0 {
+			continue
+		}
+		if evictPool == nil || pool.lastUsed < evictPool.lastUsed {
+			evictKey, evictPool = key, pool
+		}
+	}
+	if evictPool == nil {
+		return false
+	}
+	evictPool.transport.CloseIdleConnections()
+	delete(t.pools, evictKey)
+	upstreamPoolStatsMap.Delete(upstreamPoolKey{client: t.name, host: evictKey})
+	return true
+}
+
+func (t *upstreamTransport) newTransport(config operation_setting.UpstreamPoolConfig, stats *upstreamPoolStats) (*http.Transport, error) {
+	maxIdleConnsPerHost := config.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = common.RelayMaxIdleConnsPerHost
+	}
+	transport := &http.Transport{
+		MaxIdleConns:        common.RelayMaxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		MaxConnsPerHost:     config.MaxConnsPerHost,
+		IdleConnTimeout:     time.Duration(config.IdleConnTimeout) * time.Second,
+		ForceAttemptHTTP2:   config.HTTP2,
+		DialContext:         withConnectTimeout((&net.Dialer{}).DialContext),
+	}
+	if err := t.configure(transport); err != nil {
+		return nil, err
+	}
+	transport.DialContext = countingDial(transport.DialContext, stats)
+
+	var tlsConfig *tls.Config
+	if common.TLSInsecureSkipVerify {
+		tlsConfig = common.InsecureTLSConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+	if config.SessionResumption {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	transport.TLSClientConfig = tlsConfig
+	if !config.HTTP2 {
+		// 非 nil 的空映射会禁用 HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport, nil
+}
+
+func (t *upstreamTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, pool := range t.pools {
+		pool.transport.CloseIdleConnections()
+	}
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+func upstreamStats(name string, host string) *upstreamPoolStats {
+	key := upstreamPoolKey{client: name, host: host}
+	if stats, ok := upstreamPoolStatsMap.Load(key); ok {
+		return stats.(*upstreamPoolStats)
+	}
+	stats, _ := upstreamPoolStatsMap.LoadOrStore(key, &upstreamPoolStats{})
+	return stats.(*upstreamPoolStats)
+}
+
+func countingDial(dial func(ctx context.Context, network, addr string) (net.Conn, error), stats *upstreamPoolStats) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		stats.dials.Add(1)
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			stats.dialErrors.Add(1)
+			return nil, err
+		}
+		stats.openConns.Add(1)
+		return &countedConn{Conn: conn, stats: stats}, nil
+	}
+}
+
+type countedConn struct {
+	net.Conn
+	stats  *upstreamPoolStats
+	closed atomic.Bool
+}
+
+func (c *countedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.stats.openConns.Add(-1)
+	}
+	return c.Conn.Close()
+}
+
+// inFlightBody 响应体关闭或读取完毕时结束计数
+type inFlightBody struct {
+	io.ReadCloser
+	stats *upstreamPoolStats
+	done  atomic.Bool
+}
+
+func (b *inFlightBody) finish() {
+	if b.done.CompareAndSwap(false, true) {
+		b.stats.inFlight.Add(-1)
+	}
+}
+
+func (b *inFlightBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *inFlightBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+type UpstreamPoolStats struct {
+	Client     string `json:"client"` // direct 或代理地址
+	Host       string `json:"host"`   // 未隔离时为空，表示共用的连接池
+	Requests   int64  `json:"requests"`
+	InFlight   int64  `json:"in_flight"`
+	OpenConns  int64  `json:"open_conns"`
+	Dials      int64  `json:"dials"`
+	DialErrors int64  `json:"dial_errors"`
+	// Utilization 进行中的请求数占 MaxConnsPerHost 的比例，未限制连接数时为 0
+	Utilization float64                               `json:"utilization"`
+	Config      *operation_setting.UpstreamPoolConfig `json:"config,omitempty"`
+}
+
+// GetUpstreamPoolStats 返回各上游连接池的使用情况，按请求数从多到少排列
+func GetUpstreamPoolStats() []UpstreamPoolStats {
+	configs := make(map[upstreamPoolKey]operation_setting.UpstreamPoolConfig)
+	collect := func(t *upstreamTransport) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for host, pool := range t.pools {
+			configs[upstreamPoolKey{client: t.name, host: host}] = pool.config
+		}
+	}
+	if httpClient != nil {
+		if t, ok := httpClient.Transport.(*upstreamTransport); ok {
+			collect(t)
+		}
+	}
+	proxyClientLock.Lock()
+	for _, client := range proxyClients {
+		if t, ok := client.Transport.(*upstreamTransport); ok {
+			collect(t)
+		}
+	}
+	proxyClientLock.Unlock()
+
+	result := make([]UpstreamPoolStats, 0)
+	upstreamPoolStatsMap.Range(func(key, value any) bool {
+		stats := value.(*upstreamPoolStats)
+		poolKey := key.(upstreamPoolKey)
+		item := UpstreamPoolStats{
+			Client:     poolKey.client,
+			Host:       poolKey.host,
+			Requests:   stats.requests.Load(),
+			InFlight:   stats.inFlight.Load(),
+			OpenConns:  stats.openConns.Load(),
+			Dials:      stats.dials.Load(),
+			DialErrors: stats.dialErrors.Load(),
+		}
+		if config, ok := configs[poolKey]; ok {
+			item.Config = &config
+			if config.MaxConnsPerHost > 0 {
+				item.Utilization = float64(item.InFlight) / float64(config.MaxConnsPerHost)
+			}
+		}
+		result = append(result, item)
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Requests > result[j].Requests
+	})
+	return result
+}
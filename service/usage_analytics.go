@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	// 小时结束后再等待一段时间，避免遗漏写入稍晚的日志
+	usageRollupDelay          = 5 * time.Minute
+	usageRollupMaxHoursPerRun = 48
+	usageRetentionInterval    = time.Hour
+	usageRetentionBatchSize   = 1000
+)
+
+var (
+	usageAnalyticsOnce    sync.Once
+	usageRollupRunning    atomic.Bool
+	usageRollupNextHour   int64
+	usageRollupNextDay    int64
+	usageRetentionLastRun time.Time
+)
+
+// UsageAnalyticsPoint 汇总查询结果，延迟分位数为直方图估算值（秒）
+type UsageAnalyticsPoint struct {
+	BucketStart      int64   `json:"bucket_start"`
+	Key              string  `json:"key,omitempty"`
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Quota            int     `json:"quota"`
+	Amount           float64 `json:"amount"` // 按 QuotaPerUnit 折算的费用，便于按项目分摊成本
+	AvgLatency       float64 `json:"avg_latency"`
+	P50Latency       int     `json:"p50_latency"`
+	P95Latency       int     `json:"p95_latency"`
+	P99Latency       int     `json:"p99_latency"`
+}
+
+func StartUsageAnalyticsTask() {
+	usageAnalyticsOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				if operation_setting.GetAnalyticsSetting().Enabled && model.IsLeader() {
+					runUsageRollupOnce()
+				}
+				interval := time.Duration(operation_setting.GetAnalyticsSetting().RollupIntervalMinutes) * time.Minute
+				if interval <= 0 {
+					interval = 10 * time.Minute
+				}
+				time.Sleep(interval)
+			}
+		})
+	})
+}
+
+func hourStart(t time.Time) int64 {
+	return t.Unix() - t.Unix()%3600
+}
+
+// dayStart 本地时区的当天零点
+func dayStart(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func runUsageRollupOnce() {
+	if !usageRollupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer usageRollupRunning.Store(false)
+
+	ctx := context.Background()
+	setting := operation_setting.GetAnalyticsSetting()
+	now := time.Now()
+	if usageRollupNextHour == 0 {
+		latest, err := model.GetLatestUsageStatBucket(model.UsageStatPeriodHour)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("usage rollup init failed: %v", err))
+			return
+		}
+		if latest > 0 {
+			usageRollupNextHour = latest + 3600
+		} else {
+			usageRollupNextHour = hourStart(now.Add(-time.Duration(setting.BackfillHours) * time.Hour))
+		}
+	}
+
+	hours := 0
+	for hours < usageRollupMaxHoursPerRun && time.Unix(usageRollupNextHour+3600, 0).Add(usageRollupDelay).Before(now) {
+		if err := model.RollupUsageStatsHour(usageRollupNextHour); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("usage hourly rollup failed at %d: %v", usageRollupNextHour, err))
+			return
+		}
+		usageRollupNextHour += 3600
+		hours++
+	}
+
+	if usageRollupNextDay == 0 {
+		latest, err := model.GetLatestUsageStatBucket(model.UsageStatPeriodDay)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("usage rollup init failed: %v", err))
+			return
+		}
+		if latest > 0 {
+			usageRollupNextDay = dayStart(time.Unix(latest, 0)).AddDate(0, 0, 1).Unix()
+		} else {
+			// 回溯起点所在的当天不完整，从次日开始汇总
+			usageRollupNextDay = dayStart(now.Add(-time.Duration(setting.BackfillHours)*time.Hour)).AddDate(0, 0, 1).Unix()
+		}
+	}
+	for {
+		end := time.Unix(usageRollupNextDay, 0).AddDate(0, 0, 1).Unix()
+		if end > usageRollupNextHour {
+			break
+		}
+		if err := model.RollupUsageStatsDay(usageRollupNextDay, end); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("usage daily rollup failed at %d: %v", usageRollupNextDay, err))
+			return
+		}
+		usageRollupNextDay = end
+	}
+	if hours > 0 {
+		logger.LogDebug(ctx, "usage rollup: hours=%d, next_hour=%d, next_day=%d", hours, usageRollupNextHour, usageRollupNextDay)
+	}
+
+	if time.Since(usageRetentionLastRun) >= usageRetentionInterval {
+		usageRetentionLastRun = now
+		applyUsageRetention(ctx, setting, now)
+	}
+}
+
+func applyUsageRetention(ctx context.Context, setting *operation_setting.AnalyticsSetting, now time.Time) {
+	if setting.RawLogRetentionDays > 0 {
+		// 只清理已完成汇总的日志
+		target := min(now.AddDate(0, 0, -setting.RawLogRetentionDays).Unix(), usageRollupNextHour)
+		deleted, err := model.DeleteRolledUpLogs(ctx, target, usageRetentionBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("raw log retention failed: %v", err))
+		} else if deleted > 0 {
+			common.SysLog(fmt.Sprintf("raw log retention: deleted %d logs before %d", deleted, target))
+		}
+	}
+	if setting.HourlyRetentionDays > 0 {
+		if _, err := model.DeleteUsageStatsBefore(model.UsageStatPeriodHour, now.AddDate(0, 0, -setting.HourlyRetentionDays).Unix()); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("hourly usage retention failed: %v", err))
+		}
+	}
+	if setting.DailyRetentionDays > 0 {
+		if _, err := model.DeleteUsageStatsBefore(model.UsageStatPeriodDay, now.AddDate(0, 0, -setting.DailyRetentionDays).Unix()); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("daily usage retention failed: %v", err))
+		}
+	}
+}
+
+func usageStatGroupKey(stat *model.UsageStat, groupBy string) string {
+	switch groupBy {
+	case "user":
+		return strconv.Itoa(stat.UserId)
+	case "token":
+		return strconv.Itoa(stat.TokenId)
+	case "channel":
+		return strconv.Itoa(stat.ChannelId)
+	case "model":
+		return stat.ModelName
+	case "project":
+		return stat.Project
+	default:
+		return ""
+	}
+}
+
+// latencyPercentile 取累计数达到分位的直方图桶上限
+func latencyPercentile(latency []int, total int, p float64) int {
+	if total == 0 {
+		return 0
+	}
+	target := int(float64(total)*p + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	count := 0
+	for i, n := range latency {
+		count += n
+		if count >= target {
+			if i < len(model.UsageLatencyBounds) {
+				return model.UsageLatencyBounds[i]
+			}
+			break
+		}
+	}
+	return model.UsageLatencyBounds[len(model.UsageLatencyBounds)-1]
+}
+
+// AggregateUsageStats 按时间桶与 groupBy 维度合并汇总记录，summary 为 true 时不区分时间桶
+func AggregateUsageStats(stats []*model.UsageStat, groupBy string, summary bool) []UsageAnalyticsPoint {
+	type groupKey struct {
+		bucket int64
+		key    string
+	}
+	merged := make(map[groupKey]*model.UsageStat)
+	for _, stat := range stats {
+		k := groupKey{key: usageStatGroupKey(stat, groupBy)}
+		if !summary {
+			k.bucket = stat.BucketStart
+		}
+		if existing, ok := merged[k]; ok {
+			existing.Merge(stat)
+		} else {
+			copied := &model.UsageStat{BucketStart: k.bucket}
+			copied.Merge(stat)
+			merged[k] = copied
+		}
+	}
+	points := make([]UsageAnalyticsPoint, 0, len(merged))
+	for k, stat := range merged {
+		point := UsageAnalyticsPoint{
+			BucketStart:      k.bucket,
+			Key:              k.key,
+			Requests:         stat.Requests,
+			Errors:           stat.Errors,
+			PromptTokens:     stat.PromptTokens,
+			CompletionTokens: stat.CompletionTokens,
+			Quota:            stat.Quota,
+			Amount:           float64(stat.Quota) / common.QuotaPerUnit,
+		}
+		if stat.Requests > 0 {
+			point.AvgLatency = float64(stat.TotalUseTime) / float64(stat.Requests)
+		}
+		latency := stat.Latency()
+		point.P50Latency = latencyPercentile(latency, stat.Requests, 0.5)
+		point.P95Latency = latencyPercentile(latency, stat.Requests, 0.95)
+		point.P99Latency = latencyPercentile(latency, stat.Requests, 0.99)
+		points = append(points, point)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].BucketStart != points[j].BucketStart {
+			return points[i].BucketStart < points[j].BucketStart
+		}
+		return points[i].Quota > points[j].Quota
+	})
+	return points
+}
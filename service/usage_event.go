@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/kafka"
+	"github.com/QuantumNous/new-api/pkg/nats"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// UsageEvent 一次请求的用量记录，字段顺序与 UsageEventAvroSchema 一致
+type UsageEvent struct {
+	RequestId        string  `json:"request_id"`
+	Timestamp        int64   `json:"timestamp"` // 毫秒
+	UserId           int     `json:"user_id"`
+	Username         string  `json:"username"`
+	TokenId          int     `json:"token_id"`
+	TokenName        string  `json:"token_name"`
+	ChannelId        int     `json:"channel_id"`
+	Model            string  `json:"model"`
+	Group            string  `json:"group"`
+	Project          string  `json:"project"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Quota            int     `json:"quota"`
+	Cost             float64 `json:"cost"` // 美元
+	LatencyMs        int64   `json:"latency_ms"`
+	StatusCode       int     `json:"status_code"`
+}
+
+const UsageEventAvroSchema = `{"type":"record","name":"UsageEvent","namespace":"ai.newapi","fields":[` +
+	`{"name":"request_id","type":"string"},` +
+	`{"name":"timestamp","type":{"type":"long","logicalType":"timestamp-millis"}},` +
+	`{"name":"user_id","type":"int"},` +
+	`{"name":"username","type":"string"},` +
+	`{"name":"token_id","type":"int"},` +
+	`{"name":"token_name","type":"string"},` +
+	`{"name":"channel_id","type":"int"},` +
+	`{"name":"model","type":"string"},` +
+	`{"name":"group","type":"string"},` +
+	`{"name":"project","type":"string"},` +
+	`{"name":"prompt_tokens","type":"int"},` +
+	`{"name":"completion_tokens","type":"int"},` +
+	`{"name":"quota","type":"long"},` +
+	`{"name":"cost","type":"double"},` +
+	`{"name":"latency_ms","type":"long"},` +
+	`{"name":"status_code","type":"int"}]}`
+
+const usageEventErrorLogInterval = time.Minute
+
+var (
+	usageEventOnce    sync.Once
+	usageEventQueue   chan *UsageEvent
+	usageEventFlushes = make(chan chan struct{})
+	usageEventDropped atomic.Int64
+	usageEventFailed  atomic.Int64
+)
+
+func appendAvroString(buf []byte, s string) []byte {
+	buf = binary.AppendVarint(buf, int64(len(s)))
+	return append(buf, s...)
+}
+
+// encodeAvro 按 UsageEventAvroSchema 编码为 Avro 二进制，schemaId 大于 0 时添加 Confluent 头
+func (e *UsageEvent) encodeAvro(schemaId int) []byte {
+	buf := make([]byte, 0, 256)
+	if schemaId > 0 {
+		buf = append(buf, 0)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(schemaId))
+	}
+	buf = appendAvroString(buf, e.RequestId)
+	buf = binary.AppendVarint(buf, e.Timestamp)
+	buf = binary.AppendVarint(buf, int64(e.UserId))
+	buf = appendAvroString(buf, e.Username)
+	buf = binary.AppendVarint(buf, int64(e.TokenId))
+	buf = appendAvroString(buf, e.TokenName)
+	buf = binary.AppendVarint(buf, int64(e.ChannelId))
+	buf = appendAvroString(buf, e.Model)
+	buf = appendAvroString(buf, e.Group)
+	buf = appendAvroString(buf, e.Project)
+	buf = binary.AppendVarint(buf, int64(e.PromptTokens))
+	buf = binary.AppendVarint(buf, int64(e.CompletionTokens))
+	buf = binary.AppendVarint(buf, int64(e.Quota))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(e.Cost))
+	buf = binary.AppendVarint(buf, e.LatencyMs)
+	buf = binary.AppendVarint(buf, int64(e.StatusCode))
+	return buf
+}
+
+func (e *UsageEvent) encode(setting *operation_setting.UsageEventSetting) ([]byte, error) {
+	if setting.Format == operation_setting.UsageEventFormatAvro {
+		return e.encodeAvro(setting.AvroSchemaId), nil
+	}
+	return common.Marshal(e)
+}
+
+// PublishUsageEvent 放入内存队列后立即返回，队列已满时丢弃并计数
+func PublishUsageEvent(event *UsageEvent) {
+	if !operation_setting.GetUsageEventSetting().Enabled || usageEventQueue == nil {
+		return
+	}
+	event.Cost = float64(event.Quota) / common.QuotaPerUnit
+	select {
+	case usageEventQueue <- event:
+	default:
+		usageEventDropped.Add(1)
+	}
+}
+
+// UsageEventStats 返回自启动以来因队列已满丢弃与发送失败的事件数
+func UsageEventStats() (dropped int64, failed int64) {
+	return usageEventDropped.Load(), usageEventFailed.Load()
+}
+
+type usageEventSink interface {
+	publish(keys [][]byte, values [][]byte) error
+	Close() error
+}
+
+type kafkaUsageSink struct {
+	producer *kafka.Producer
+	topic    string
+}
+
+func (s *kafkaUsageSink) publish(keys [][]byte, values [][]byte) error {
+	now := time.Now().UnixMilli()
+	records := make([]kafka.Record, len(values))
+	for i := range values {
+		records[i] = kafka.Record{Key: keys[i], Value: values[i], Timestamp: now}
+	}
+	return s.producer.Produce(s.topic, records)
+}
+
+func (s *kafkaUsageSink) Close() error {
+	return s.producer.Close()
+}
+
+type natsUsageSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func (s *natsUsageSink) publish(_ [][]byte, values [][]byte) error {
+	for _, value := range values {
+		if err := s.conn.Publish(s.subject, value); err != nil {
+			return err
+		}
+	}
+	return s.conn.Flush()
+}
+
+func (s *natsUsageSink) Close() error {
+	return s.conn.Close()
+}
+
+func newUsageEventSink(setting *operation_setting.UsageEventSetting) (usageEventSink, error) {
+	switch setting.Backend {
+	case operation_setting.UsageEventBackendKafka:
+		if setting.KafkaTopic == "" {
+			return nil, errors.New("kafka topic is not configured")
+		}
+		var brokers []string
+		for _, broker := range strings.Split(setting.KafkaBrokers, ",") {
+			if broker = strings.TrimSpace(broker); broker != "" {
+				brokers = append(brokers, broker)
+			}
+		}
+		config := kafka.Config{
+			Brokers:  brokers,
+			ClientID: "new-api",
+			Username: setting.KafkaUsername,
+			Password: setting.KafkaPassword,
+			Acks:     int16(setting.KafkaAcks),
+		}
+		if setting.KafkaTLS {
+			config.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		producer, err := kafka.NewProducer(config)
+		if err != nil {
+			return nil, err
+		}
+		return &kafkaUsageSink{producer: producer, topic: setting.KafkaTopic}, nil
+	case operation_setting.UsageEventBackendNats:
+		if setting.NatsURL == "" || setting.NatsSubject == "" {
+			return nil, errors.New("nats url or subject is not configured")
+		}
+		conn, err := nats.Dial(setting.NatsURL, nats.Options{
+			Name:     "new-api",
+			Username: setting.NatsUsername,
+			Password: setting.NatsPassword,
+			Token:    setting.NatsSecret,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &natsUsageSink{conn: conn, subject: setting.NatsSubject}, nil
+	}
+	return nil, fmt.Errorf("unsupported usage event backend %q", setting.Backend)
+}
+
+// usageEventSinkKey 连接相关配置变化时重新建立连接
+func usageEventSinkKey(setting *operation_setting.UsageEventSetting) string {
+	return strings.Join([]string{
+		setting.Backend, setting.KafkaBrokers, setting.KafkaTopic, strconv.Itoa(setting.KafkaAcks), strconv.FormatBool(setting.KafkaTLS),
+		setting.KafkaUsername, setting.KafkaPassword, setting.NatsURL, setting.NatsSubject, setting.NatsUsername,
+		setting.NatsPassword, setting.NatsSecret,
+	}, "|")
+}
+
+func encodeUsageEvents(setting *operation_setting.UsageEventSetting, events []*UsageEvent) ([][]byte, [][]byte) {
+	keys := make([][]byte, 0, len(events))
+	values := make([][]byte, 0, len(events))
+	for _, event := range events {
+		value, err := event.encode(setting)
+		if err != nil {
+			usageEventFailed.Add(1)
+			continue
+		}
+		keys = append(keys, []byte(strconv.Itoa(event.UserId)))
+		values = append(values, value)
+	}
+	return keys, values
+}
+
+// StartUsageEventPublisher 每个节点各自批量发送本节点产生的用量事件
+func StartUsageEventPublisher() {
+	usageEventOnce.Do(func() {
+		setting := operation_setting.GetUsageEventSetting()
+		usageEventQueue = make(chan *UsageEvent, max(setting.BufferSize, 100))
+		gopool.Go(runUsageEventPublisher)
+	})
+}
+
+func runUsageEventPublisher() {
+	var sink usageEventSink
+	var sinkKey string
+	var lastErrorLog time.Time
+	closeSink := func() {
+		if sink != nil {
+			_ = sink.Close()
+			sink = nil
+		}
+	}
+	flush := func(events []*UsageEvent) {
+		setting := operation_setting.GetUsageEventSetting()
+		if key := usageEventSinkKey(setting); sink == nil || key != sinkKey {
+			closeSink()
+			var err error
+			if sink, err = newUsageEventSink(setting); err != nil {
+				usageEventFailed.Add(int64(len(events)))
+				if time.Since(lastErrorLog) >= usageEventErrorLogInterval {
+					lastErrorLog = time.Now()
+					logger.LogWarn(context.Background(), fmt.Sprintf("failed to connect usage event backend: %v", err))
+				}
+				return
+			}
+			sinkKey = key
+		}
+		keys, values := encodeUsageEvents(setting, events)
+		if err := sink.publish(keys, values); err != nil {
+			usageEventFailed.Add(int64(len(values)))
+			closeSink()
+			if time.Since(lastErrorLog) >= usageEventErrorLogInterval {
+				lastErrorLog = time.Now()
+				logger.LogWarn(context.Background(), fmt.Sprintf("failed to publish usage events: %v", err))
+			}
+		}
+	}
+
+	var batch []*UsageEvent
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	lastFlush := time.Now()
+	for {
+		select {
+		case event := <-usageEventQueue:
+			batch = append(batch, event)
+			if len(batch) < max(operation_setting.GetUsageEventSetting().BatchSize, 1) {
+				continue
+			}
+		case <-ticker.C:
+			setting := operation_setting.GetUsageEventSetting()
+			if !setting.Enabled {
+				batch = batch[:0]
+				closeSink()
+				continue
+			}
+			if len(batch) == 0 || time.Since(lastFlush) < time.Duration(max(setting.FlushIntervalMs, 100))*time.Millisecond {
+				continue
+			}
+		case done := <-usageEventFlushes:
+			// 退出前发送当前批次与队列中剩余的事件
+			batchSize := max(operation_setting.GetUsageEventSetting().BatchSize, 1)
+			for drained := false; !drained; {
+				select {
+				case event := <-usageEventQueue:
+					batch = append(batch, event)
+					if len(batch) < batchSize {
+						continue
+					}
+				default:
+					drained = true
+				}
+				if len(batch) > 0 && operation_setting.GetUsageEventSetting().Enabled {
+					flush(batch)
+				}
+				batch = nil
+			}
+			closeSink()
+			close(done)
+			continue
+		}
+		flush(batch)
+		batch = nil
+		lastFlush = time.Now()
+	}
+}
+
+// FlushUsageEvents 退出前发送队列中的用量事件，ctx 结束时不再等待
+func FlushUsageEvents(ctx context.Context) {
+	if usageEventQueue == nil {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case usageEventFlushes <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// TestUsageEventPublish 使用当前配置建立新连接并发送一条示例事件
+func TestUsageEventPublish() error {
+	setting := operation_setting.GetUsageEventSetting()
+	sink, err := newUsageEventSink(setting)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	event := &UsageEvent{
+		RequestId:  "test-" + common.GetUUID(),
+		Timestamp:  time.Now().UnixMilli(),
+		Model:      "test",
+		StatusCode: 200,
+	}
+	keys, values := encodeUsageEvents(setting, []*UsageEvent{event})
+	return sink.publish(keys, values)
+}
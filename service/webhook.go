@@ -12,6 +12,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/metrics"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 )
 
@@ -32,7 +33,13 @@ func generateSignature(secret string, payload []byte) string {
 }
 
 // SendWebhookNotify 发送 webhook 通知
-func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error {
+func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.IncWebhookFailure()
+		}
+	}()
+
 	// 处理占位符
 	content := data.Content
 	for _, value := range data.Values {
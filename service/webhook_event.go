@@ -0,0 +1,358 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	webhookEventTickInterval   = 30 * time.Second
+	webhookEndpointCacheTTL    = 60 // 秒，其他节点修改的推送地址最迟在该时间后生效
+	webhookEventBatchSize      = 100
+	webhookEventFirstRetryWait = 30 // 秒，之后每次翻倍
+	webhookEventMaxRetryWait   = 3600
+)
+
+var (
+	webhookEventOnce    sync.Once
+	webhookEventRunning atomic.Bool
+
+	webhookEndpointCache struct {
+		sync.RWMutex
+		byUser       map[int][]*model.WebhookEndpoint
+		channelUsers map[int]bool // 拥有 channels:read 权限、可以订阅渠道事件的用户
+		loadedAt     int64
+	}
+
+	webhookQuotaLowSent sync.Map
+)
+
+// WebhookEventEnvelope 推送给订阅方的事件体，签名覆盖 "{timestamp}.{body}"
+type WebhookEventEnvelope struct {
+	Id        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt int64  `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+// InvalidateWebhookEndpointCache 本节点修改推送地址后立即重新加载
+func InvalidateWebhookEndpointCache() {
+	webhookEndpointCache.Lock()
+	webhookEndpointCache.loadedAt = 0
+	webhookEndpointCache.Unlock()
+}
+
+func loadWebhookEndpoints() (map[int][]*model.WebhookEndpoint, map[int]bool) {
+	now := common.GetTimestamp()
+	webhookEndpointCache.RLock()
+	if now-webhookEndpointCache.loadedAt < webhookEndpointCacheTTL {
+		byUser, channelUsers := webhookEndpointCache.byUser, webhookEndpointCache.channelUsers
+		webhookEndpointCache.RUnlock()
+		return byUser, channelUsers
+	}
+	webhookEndpointCache.RUnlock()
+
+	webhookEndpointCache.Lock()
+	defer webhookEndpointCache.Unlock()
+	if now-webhookEndpointCache.loadedAt < webhookEndpointCacheTTL {
+		return webhookEndpointCache.byUser, webhookEndpointCache.channelUsers
+	}
+	endpoints, err := model.GetEnabledWebhookEndpoints()
+	if err != nil {
+		common.SysError("failed to load webhook endpoints: " + err.Error())
+		return webhookEndpointCache.byUser, webhookEndpointCache.channelUsers
+	}
+	byUser := make(map[int][]*model.WebhookEndpoint)
+	channelUsers := make(map[int]bool)
+	for _, endpoint := range endpoints {
+		byUser[endpoint.UserId] = append(byUser[endpoint.UserId], endpoint)
+		if endpoint.Subscribes(model.WebhookEventChannelStatusChanged) {
+			if _, checked := channelUsers[endpoint.UserId]; checked {
+				continue
+			}
+			owner, err := model.GetUserById(endpoint.UserId, false)
+			channelUsers[endpoint.UserId] = err == nil && common.HasPermissions(model.GetUserPermissions(owner.Id, owner.Role), common.PermissionChannelsRead)
+		}
+	}
+	webhookEndpointCache.byUser = byUser
+	webhookEndpointCache.channelUsers = channelUsers
+	webhookEndpointCache.loadedAt = now
+	return byUser, channelUsers
+}
+
+// HasWebhookSubscription 用户是否有启用中的推送地址订阅了该事件，用于在构造事件前快速判断
+func HasWebhookSubscription(userId int, eventType string) bool {
+	if !operation_setting.GetWebhookEventSetting().Enabled {
+		return false
+	}
+	byUser, _ := loadWebhookEndpoints()
+	for _, endpoint := range byUser[userId] {
+		if endpoint.Subscribes(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// EmitWebhookEvent 为用户订阅了该事件的每个推送地址写入投递记录并异步投递
+func EmitWebhookEvent(userId int, eventType string, data any) {
+	if !operation_setting.GetWebhookEventSetting().Enabled {
+		return
+	}
+	byUser, _ := loadWebhookEndpoints()
+	for _, endpoint := range byUser[userId] {
+		if endpoint.Subscribes(eventType) {
+			enqueueWebhookEvent(endpoint, eventType, data)
+		}
+	}
+}
+
+// EmitChannelStatusEvent 向拥有渠道读取权限的管理员推送渠道状态变更
+func EmitChannelStatusEvent(history *model.ChannelStatusHistory) {
+	if !operation_setting.GetWebhookEventSetting().Enabled {
+		return
+	}
+	byUser, channelUsers := loadWebhookEndpoints()
+	for userId, allowed := range channelUsers {
+		if !allowed {
+			continue
+		}
+		for _, endpoint := range byUser[userId] {
+			if endpoint.Subscribes(model.WebhookEventChannelStatusChanged) {
+				enqueueWebhookEvent(endpoint, model.WebhookEventChannelStatusChanged, history)
+			}
+		}
+	}
+}
+
+// RecordChannelStatusChange 记录渠道状态历史并推送 channel.status_changed 事件
+func RecordChannelStatusChange(history *model.ChannelStatusHistory) {
+	model.RecordChannelStatusHistory(history)
+	EmitChannelStatusEvent(history)
+}
+
+// EmitQuotaLowEvent 额度低于提醒阈值时推送 quota.low，同一用户在冷却时间内只推送一次
+func EmitQuotaLowEvent(userId int, remainQuota int, threshold int) {
+	setting := operation_setting.GetWebhookEventSetting()
+	if !HasWebhookSubscription(userId, model.WebhookEventQuotaLow) {
+		return
+	}
+	cooldown := time.Duration(max(setting.QuotaLowCooldown, 1)) * time.Minute
+	if common.RedisEnabled.Load() {
+		key := fmt.Sprintf("webhook_quota_low:%d", userId)
+		if value, _ := common.RedisGet(key); value != "" {
+			return
+		}
+		_ = common.RedisSet(key, "1", cooldown)
+	} else {
+		now := time.Now()
+		if last, ok := webhookQuotaLowSent.Load(userId); ok && now.Sub(last.(time.Time)) < cooldown {
+			return
+		}
+		webhookQuotaLowSent.Store(userId, now)
+	}
+	EmitWebhookEvent(userId, model.WebhookEventQuotaLow, map[string]any{
+		"user_id":      userId,
+		"remain_quota": remainQuota,
+		"threshold":    threshold,
+	})
+}
+
+func enqueueWebhookEvent(endpoint *model.WebhookEndpoint, eventType string, data any) {
+	now := common.GetTimestamp()
+	envelope := WebhookEventEnvelope{
+		Id:        "evt_" + common.GetUUID(),
+		Type:      eventType,
+		CreatedAt: now,
+		Data:      data,
+	}
+	payload, err := common.Marshal(envelope)
+	if err != nil {
+		common.SysError("failed to marshal webhook event: " + err.Error())
+		return
+	}
+	event := &model.WebhookEvent{
+		EventId:    envelope.Id,
+		EndpointId: endpoint.Id,
+		UserId:     endpoint.UserId,
+		Type:       eventType,
+		Payload:    string(payload),
+		Status:     model.WebhookDeliveryPending,
+		// 首次投递由当前节点立即执行，预留重试时间避免与定时任务重复投递
+		NextRetryAt: now + webhookEventFirstRetryWait,
+		CreatedAt:   now,
+	}
+	if err = event.Insert(); err != nil {
+		common.SysError("failed to save webhook event: " + err.Error())
+		return
+	}
+	gopool.Go(func() {
+		deliverWebhookEvent(endpoint, event)
+	})
+}
+
+// deliverWebhookEvent 投递一次并保存结果，失败时按指数退避安排下一次重试
+func deliverWebhookEvent(endpoint *model.WebhookEndpoint, event *model.WebhookEvent) {
+	setting := operation_setting.GetWebhookEventSetting()
+	event.Attempts++
+	statusCode, err := postWebhookEvent(endpoint, event, time.Duration(max(setting.TimeoutSeconds, 1))*time.Second)
+	event.ResponseCode = statusCode
+	now := common.GetTimestamp()
+	if err == nil {
+		event.Status = model.WebhookDeliverySuccess
+		event.LastError = ""
+		event.NextRetryAt = 0
+		event.DeliveredAt = now
+	} else {
+		event.LastError = err.Error()
+		if len(event.LastError) > 512 {
+			event.LastError = event.LastError[:512]
+		}
+		if event.Attempts >= max(setting.MaxAttempts, 1) {
+			event.Status = model.WebhookDeliveryFailed
+			event.NextRetryAt = 0
+		} else {
+			event.Status = model.WebhookDeliveryPending
+			wait := int64(webhookEventFirstRetryWait) << min(event.Attempts-1, 10)
+			event.NextRetryAt = now + min(wait, webhookEventMaxRetryWait)
+		}
+	}
+	if err := model.SaveWebhookDeliveryResult(event); err != nil {
+		common.SysError("failed to save webhook delivery result: " + err.Error())
+	}
+}
+
+func postWebhookEvent(endpoint *model.WebhookEndpoint, event *model.WebhookEvent, timeout time.Duration) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		"Content-Type":        "application/json",
+		"X-Webhook-Id":        event.EventId,
+		"X-Webhook-Event":     event.Type,
+		"X-Webhook-Timestamp": timestamp,
+	}
+	if endpoint.Secret != "" {
+		headers["X-Webhook-Signature"] = generateSignature(endpoint.Secret, []byte(timestamp+"."+event.Payload))
+	}
+
+	var resp *http.Response
+	var err error
+	if system_setting.EnableWorker() {
+		resp, err = DoWorkerRequest(&WorkerRequest{
+			URL:     endpoint.Url,
+			Key:     system_setting.WorkerValidKey,
+			Method:  http.MethodPost,
+			Headers: headers,
+			Body:    []byte(event.Payload),
+		})
+	} else {
+		fetchSetting := system_setting.GetFetchSetting()
+		if err = common.ValidateURLWithFetchSetting(endpoint.Url, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+			return 0, fmt.Errorf("request reject: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewBufferString(event.Payload))
+		if err != nil {
+			return 0, err
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err = GetHttpClient().Do(req)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// RedeliverWebhookEvent 手动重新投递，不受最大重试次数限制
+func RedeliverWebhookEvent(event *model.WebhookEvent) (*model.WebhookEvent, error) {
+	endpoint, err := model.GetWebhookEndpointById(event.EndpointId)
+	if err != nil {
+		return nil, err
+	}
+	deliverWebhookEvent(endpoint, event)
+	return event, nil
+}
+
+// StartWebhookEventTask 重试到期的投递并按保留天数清理投递记录
+func StartWebhookEventTask() {
+	webhookEventOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("webhook event task started: tick=%s", webhookEventTickInterval))
+			ticker := time.NewTicker(webhookEventTickInterval)
+			defer ticker.Stop()
+			lastCleanup := int64(0)
+			for range ticker.C {
+				setting := operation_setting.GetWebhookEventSetting()
+				if !setting.Enabled || !model.IsLeader() {
+					continue
+				}
+				now := common.GetTimestamp()
+				if setting.RetentionDays > 0 && now-lastCleanup >= 3600 {
+					lastCleanup = now
+					if _, err := model.DeleteWebhookEventsBefore(now - int64(setting.RetentionDays)*86400); err != nil {
+						logger.LogWarn(context.Background(), fmt.Sprintf("failed to clean webhook events: %v", err))
+					}
+				}
+				runWebhookEventRetries(now)
+			}
+		})
+	})
+}
+
+func runWebhookEventRetries(now int64) {
+	if !webhookEventRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer webhookEventRunning.Store(false)
+	events, err := model.GetDueWebhookEvents(now, webhookEventBatchSize)
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("failed to load webhook events: %v", err))
+		return
+	}
+	endpoints := make(map[int]*model.WebhookEndpoint)
+	for _, event := range events {
+		endpoint, ok := endpoints[event.EndpointId]
+		if !ok {
+			endpoint, err = model.GetWebhookEndpointById(event.EndpointId)
+			if err != nil {
+				endpoint = nil
+			}
+			endpoints[event.EndpointId] = endpoint
+		}
+		if endpoint == nil || !endpoint.Enabled {
+			event.Status = model.WebhookDeliveryFailed
+			event.NextRetryAt = 0
+			event.LastError = "endpoint is disabled or deleted"
+			_ = model.SaveWebhookDeliveryResult(event)
+			continue
+		}
+		deliverWebhookEvent(endpoint, event)
+	}
+}
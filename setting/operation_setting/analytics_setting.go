@@ -0,0 +1,32 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AnalyticsSetting 用量统计汇总与日志保留策略
+type AnalyticsSetting struct {
+	Enabled               bool `json:"enabled"`
+	RollupIntervalMinutes int  `json:"rollup_interval_minutes"`
+	BackfillHours         int  `json:"backfill_hours"`         // 首次启用时回溯汇总的小时数
+	RawLogRetentionDays   int  `json:"raw_log_retention_days"` // 已汇总的消费/错误日志保留天数，0 表示不清理
+	HourlyRetentionDays   int  `json:"hourly_retention_days"`  // 0 表示不清理
+	DailyRetentionDays    int  `json:"daily_retention_days"`   // 0 表示不清理
+}
+
+// 默认配置
+var analyticsSetting = AnalyticsSetting{
+	Enabled:               false,
+	RollupIntervalMinutes: 10,
+	BackfillHours:         24 * 7,
+	RawLogRetentionDays:   0,
+	HourlyRetentionDays:   90,
+	DailyRetentionDays:    0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("analytics_setting", &analyticsSetting)
+}
+
+func GetAnalyticsSetting() *AnalyticsSetting {
+	return &analyticsSetting
+}
@@ -0,0 +1,33 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AudioSetting 语音转写（transcriptions/translations）与语音合成（speech）配置
+type AudioSetting struct {
+	MaxFileSizeMB  int                `json:"max_file_size_mb"` // 上传音频文件大小上限，0 表示不限制
+	PricePerMinute map[string]float64 `json:"price_per_minute"` // 按音频时长计费的模型单价（美元/分钟），未配置的模型按 token 倍率计费
+}
+
+// 默认配置
+var audioSetting = AudioSetting{
+	MaxFileSizeMB:  25, // 与 OpenAI Whisper 上传限制一致
+	PricePerMinute: map[string]float64{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("audio_setting", &audioSetting)
+}
+
+func GetAudioSetting() *AudioSetting {
+	return &audioSetting
+}
+
+// GetAudioPricePerMinute 返回模型的按分钟单价，未配置时返回 false
+func GetAudioPricePerMinute(modelName string) (float64, bool) {
+	price, ok := audioSetting.PricePerMinute[modelName]
+	if !ok || price < 0 {
+		return 0, false
+	}
+	return price, true
+}
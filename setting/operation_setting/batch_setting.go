@@ -0,0 +1,32 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchSetting 批处理（/v1/batches）配置
+type BatchSetting struct {
+	Enabled             bool `json:"enabled"`
+	MaxRequestsPerBatch int  `json:"max_requests_per_batch"` // 单个批处理最多请求数
+	MaxInputFileSizeMB  int  `json:"max_input_file_size_mb"` // 输入文件大小上限
+	Concurrency         int  `json:"concurrency"`            // 单个批处理的并发请求数
+	MaxRunningBatches   int  `json:"max_running_batches"`    // 同时执行的批处理数量
+	MaxRetries          int  `json:"max_retries"`            // 遇到 429/5xx 时的重试次数
+}
+
+// 默认配置
+var batchSetting = BatchSetting{
+	Enabled:             true,
+	MaxRequestsPerBatch: 10000,
+	MaxInputFileSizeMB:  100,
+	Concurrency:         4,
+	MaxRunningBatches:   4,
+	MaxRetries:          2,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
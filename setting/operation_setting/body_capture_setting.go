@@ -0,0 +1,35 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BodyCaptureSetting 调试用的上游请求/响应体完整记录，按渠道或令牌采样，内容加密保存
+type BodyCaptureSetting struct {
+	Enabled            bool            `json:"enabled"`
+	ChannelSampleRates map[int]float64 `json:"channel_sample_rates"` // 渠道 id -> 采样率（0-1）
+	TokenSampleRates   map[int]float64 `json:"token_sample_rates"`   // 令牌 id -> 采样率（0-1）
+	MaxBodyBytes       int             `json:"max_body_bytes"`       // 请求体和响应体各自最多保存的字节数
+	RetentionHours     int             `json:"retention_hours"`      // 0 表示不清理
+}
+
+// 默认配置
+var bodyCaptureSetting = BodyCaptureSetting{
+	Enabled:            false,
+	ChannelSampleRates: map[int]float64{},
+	TokenSampleRates:   map[int]float64{},
+	MaxBodyBytes:       1 << 20,
+	RetentionHours:     72,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("body_capture_setting", &bodyCaptureSetting)
+}
+
+func GetBodyCaptureSetting() *BodyCaptureSetting {
+	return &bodyCaptureSetting
+}
+
+// SampleRate 渠道与令牌同时配置时取较大的采样率
+func (s *BodyCaptureSetting) SampleRate(channelId int, tokenId int) float64 {
+	return max(s.ChannelSampleRates[channelId], s.TokenSampleRates[tokenId])
+}
@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// CanarySetting 灰度渠道的自动评估：评估期结束后与同模型的正常渠道对比错误率与延迟，
+// 达标时转为正常渠道，否则自动禁用
+type CanarySetting struct {
+	AutoEvaluateEnabled bool    `json:"auto_evaluate_enabled"`
+	EvaluationMinutes   int     `json:"evaluation_minutes"`   // 评估期时长
+	MinRequests         int     `json:"min_requests"`         // 评估期内灰度渠道至少需要的请求数，不足时继续观察
+	MaxErrorRateDelta   float64 `json:"max_error_rate_delta"` // 错误率最多比正常渠道高出的百分点
+	MaxLatencyRatio     float64 `json:"max_latency_ratio"`    // 平均耗时最多为正常渠道的倍数，0 表示不比较
+}
+
+// 默认配置
+var canarySetting = CanarySetting{
+	AutoEvaluateEnabled: false,
+	EvaluationMinutes:   60,
+	MinRequests:         50,
+	MaxErrorRateDelta:   5,
+	MaxLatencyRatio:     1.5,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("canary_setting", &canarySetting)
+}
+
+func GetCanarySetting() *CanarySetting {
+	return &canarySetting
+}
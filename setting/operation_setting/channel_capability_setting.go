@@ -0,0 +1,24 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ChannelCapabilitySetting 渠道能力登记与按请求特性选路的配置
+type ChannelCapabilitySetting struct {
+	Enabled    bool `json:"enabled"`     // 根据请求需要的能力排除不支持的渠道
+	AutoDetect bool `json:"auto_detect"` // 从上游 400 类错误中识别能力缺失并自动登记
+}
+
+// 默认配置
+var channelCapabilitySetting = ChannelCapabilitySetting{
+	Enabled:    true,
+	AutoDetect: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_capability_setting", &channelCapabilitySetting)
+}
+
+func GetChannelCapabilitySetting() *ChannelCapabilitySetting {
+	return &channelCapabilitySetting
+}
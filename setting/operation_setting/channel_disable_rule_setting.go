@@ -0,0 +1,72 @@
+package operation_setting
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	ChannelDisableRuleActionDisable    = "disable"
+	ChannelDisableRuleActionDisableKey = "disable-key"
+	ChannelDisableRuleActionRetry      = "retry"
+	ChannelDisableRuleActionIgnore     = "ignore"
+)
+
+// ChannelDisableRule 渠道错误匹配规则，所有非空条件均满足时命中
+type ChannelDisableRule struct {
+	Name           string `json:"name"`
+	StatusCodes    string `json:"status_codes,omitempty"` // e.g. "401,500-599"
+	ErrorTypeRegex string `json:"error_type_regex,omitempty"`
+	ErrorCodeRegex string `json:"error_code_regex,omitempty"`
+	MessageRegex   string `json:"message_regex,omitempty"`
+	ChannelTypes   []int  `json:"channel_types,omitempty"`
+	JSONPath       string `json:"json_path,omitempty"` // gjson path on upstream error body
+	JSONValueRegex string `json:"json_value_regex,omitempty"`
+	Action         string `json:"action"` // disable, disable-key, retry, ignore
+}
+
+type ChannelDisableRuleSetting struct {
+	Enabled bool                 `json:"enabled"`
+	Rules   []ChannelDisableRule `json:"rules"`
+}
+
+var channelDisableRuleSetting = ChannelDisableRuleSetting{
+	Enabled: false,
+	Rules:   []ChannelDisableRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_disable_rule_setting", &channelDisableRuleSetting)
+}
+
+func GetChannelDisableRuleSetting() *ChannelDisableRuleSetting {
+	return &channelDisableRuleSetting
+}
+
+func ValidateChannelDisableRules(rules []ChannelDisableRule) error {
+	for i, rule := range rules {
+		switch rule.Action {
+		case ChannelDisableRuleActionDisable, ChannelDisableRuleActionDisableKey,
+			ChannelDisableRuleActionRetry, ChannelDisableRuleActionIgnore:
+		default:
+			return fmt.Errorf("rule #%d: invalid action %q", i+1, rule.Action)
+		}
+		if _, err := ParseHTTPStatusCodeRanges(rule.StatusCodes); err != nil {
+			return fmt.Errorf("rule #%d: %w", i+1, err)
+		}
+		for _, pattern := range []string{rule.ErrorTypeRegex, rule.ErrorCodeRegex, rule.MessageRegex, rule.JSONValueRegex} {
+			if pattern == "" {
+				continue
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("rule #%d: invalid regex %q: %w", i+1, pattern, err)
+			}
+		}
+		if rule.JSONValueRegex != "" && rule.JSONPath == "" {
+			return fmt.Errorf("rule #%d: json_value_regex requires json_path", i+1)
+		}
+	}
+	return nil
+}
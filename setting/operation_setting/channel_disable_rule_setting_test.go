@@ -0,0 +1,22 @@
+package operation_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateChannelDisableRules(t *testing.T) {
+	err := ValidateChannelDisableRules([]ChannelDisableRule{
+		{Name: "quota", StatusCodes: "402,429", ErrorCodeRegex: "^insufficient_quota$", Action: ChannelDisableRuleActionDisableKey},
+		{Name: "overloaded", JSONPath: "error.type", JSONValueRegex: "overloaded", Action: ChannelDisableRuleActionRetry},
+	})
+	require.NoError(t, err)
+}
+
+func TestValidateChannelDisableRules_Invalid(t *testing.T) {
+	require.Error(t, ValidateChannelDisableRules([]ChannelDisableRule{{Action: "ban"}}))
+	require.Error(t, ValidateChannelDisableRules([]ChannelDisableRule{{StatusCodes: "700", Action: ChannelDisableRuleActionIgnore}}))
+	require.Error(t, ValidateChannelDisableRules([]ChannelDisableRule{{MessageRegex: "(", Action: ChannelDisableRuleActionDisable}}))
+	require.Error(t, ValidateChannelDisableRules([]ChannelDisableRule{{JSONValueRegex: "x", Action: ChannelDisableRuleActionDisable}}))
+}
@@ -0,0 +1,59 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// CLICompatSetting Claude Code、Codex CLI 等命令行客户端的兼容配置
+type CLICompatSetting struct {
+	Enabled bool `json:"enabled"`
+	// Anthropic 路径（/v1/messages）上网关自身返回的错误使用 Anthropic 错误格式，客户端才能正确展示错误信息
+	ClaudeErrorFormat bool `json:"claude_error_format"`
+	// 转发到上游前从 anthropic-beta 中移除的值，订阅登录专用的 beta 与渠道的 API Key 一起发送会被上游拒绝
+	StripAnthropicBetas []string `json:"strip_anthropic_betas"`
+}
+
+// 默认配置
+var cliCompatSetting = CLICompatSetting{
+	Enabled:             true,
+	ClaudeErrorFormat:   true,
+	StripAnthropicBetas: []string{"oauth-2025-04-20"},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("cli_compat_setting", &cliCompatSetting)
+}
+
+func GetCLICompatSetting() *CLICompatSetting {
+	return &cliCompatSetting
+}
+
+// FilterAnthropicBeta 移除配置中禁止透传的 anthropic-beta 值，全部移除时返回空
+func FilterAnthropicBeta(value string) string {
+	setting := GetCLICompatSetting()
+	if !setting.Enabled || len(setting.StripAnthropicBetas) == 0 || value == "" {
+		return value
+	}
+	betas := strings.Split(value, ",")
+	kept := betas[:0]
+	for _, beta := range betas {
+		beta = strings.TrimSpace(beta)
+		if beta == "" {
+			continue
+		}
+		stripped := false
+		for _, strip := range setting.StripAnthropicBetas {
+			if strings.EqualFold(beta, strings.TrimSpace(strip)) {
+				stripped = true
+				break
+			}
+		}
+		if !stripped {
+			kept = append(kept, beta)
+		}
+	}
+	return strings.Join(kept, ",")
+}
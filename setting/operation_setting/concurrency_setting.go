@@ -0,0 +1,32 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ConcurrencySetting 单个令牌同时进行中的请求数限制
+type ConcurrencySetting struct {
+	GroupMaxConcurrency map[string]int `json:"group_max_concurrency"` // 分组默认的单令牌并发上限，令牌自身未设置时生效，0 表示不限制
+	RetryAfterSeconds   int            `json:"retry_after_seconds"`   // 超限时返回的 Retry-After
+}
+
+// 默认配置
+var concurrencySetting = ConcurrencySetting{
+	GroupMaxConcurrency: map[string]int{},
+	RetryAfterSeconds:   1,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("concurrency_setting", &concurrencySetting)
+}
+
+func GetConcurrencySetting() *ConcurrencySetting {
+	return &concurrencySetting
+}
+
+// GetTokenMaxConcurrency 令牌自身的上限优先，否则使用分组配置
+func GetTokenMaxConcurrency(tokenLimit int, group string) int {
+	if tokenLimit > 0 {
+		return tokenLimit
+	}
+	return concurrencySetting.GroupMaxConcurrency[group]
+}
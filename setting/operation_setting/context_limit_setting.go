@@ -0,0 +1,34 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ContextLimitSetting 转发前按模型上下文窗口检查输入长度，避免上游返回 400
+type ContextLimitSetting struct {
+	Enabled bool `json:"enabled"`
+	// 模型上下文窗口（token），键以 * 结尾时按前缀匹配，例如 "gpt-4o*"
+	Models map[string]int `json:"models"`
+}
+
+// 默认配置
+var contextLimitSetting = ContextLimitSetting{
+	Enabled: false,
+	Models:  map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("context_limit_setting", &contextLimitSetting)
+}
+
+func GetContextLimitSetting() *ContextLimitSetting {
+	return &contextLimitSetting
+}
+
+// GetContextWindow 返回模型的上下文窗口，未配置时返回 0
+func (s *ContextLimitSetting) GetContextWindow(model string) int {
+	if !s.Enabled {
+		return 0
+	}
+	window, _ := matchModelKey(s.Models, model)
+	return window
+}
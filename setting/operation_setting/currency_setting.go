@@ -0,0 +1,118 @@
+package operation_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// CurrencyPackage 按币种定价的充值套餐，Amount 为充值数量，Prices 为各币种的售价
+type CurrencyPackage struct {
+	Amount int64              `json:"amount"`
+	Prices map[string]float64 `json:"prices"`
+}
+
+// CurrencySetting 多币种展示：额度仍以基础单位存储，接口额外返回各币种的金额
+type CurrencySetting struct {
+	Enabled    bool               `json:"enabled"`
+	Currencies []string           `json:"currencies"` // 展示的币种，例如 USD、CNY、EUR
+	Rates      map[string]float64 `json:"rates"`      // 1 USD = X 目标币种，CNY 未配置时使用充值设置中的美元汇率
+	Symbols    map[string]string  `json:"symbols"`
+
+	AutoFetchEnabled         bool   `json:"auto_fetch_enabled"`
+	AutoFetchURL             string `json:"auto_fetch_url"` // 返回 {"rates": {"CNY": 7.1, ...}}，以 USD 为基准
+	AutoFetchIntervalMinutes int    `json:"auto_fetch_interval_minutes"`
+	LastFetchedAt            int64  `json:"last_fetched_at"`
+
+	Packages []CurrencyPackage `json:"packages"`
+}
+
+// 默认配置
+var currencySetting = CurrencySetting{
+	Enabled:    false,
+	Currencies: []string{"USD", "CNY", "EUR"},
+	Rates:      map[string]float64{"EUR": 0.92},
+	Symbols: map[string]string{
+		"USD": "$",
+		"CNY": "¥",
+		"EUR": "€",
+	},
+	AutoFetchEnabled:         false,
+	AutoFetchURL:             "https://open.er-api.com/v6/latest/USD",
+	AutoFetchIntervalMinutes: 360,
+	Packages:                 []CurrencyPackage{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("currency_setting", &currencySetting)
+}
+
+func GetCurrencySetting() *CurrencySetting {
+	return &currencySetting
+}
+
+// GetRate 返回 1 USD 兑换目标币种的数量，未知币种返回 false
+func (s *CurrencySetting) GetRate(currency string) (float64, bool) {
+	currency = strings.ToUpper(currency)
+	if currency == "USD" {
+		return 1, true
+	}
+	if rate, ok := s.Rates[currency]; ok && rate > 0 {
+		return rate, true
+	}
+	if currency == "CNY" && USDExchangeRate > 0 {
+		return USDExchangeRate, true
+	}
+	return 0, false
+}
+
+func (s *CurrencySetting) GetSymbol(currency string) string {
+	if symbol, ok := s.Symbols[currency]; ok && symbol != "" {
+		return symbol
+	}
+	return currency + " "
+}
+
+// GetPackage 返回充值数量对应的套餐
+func (s *CurrencySetting) GetPackage(amount int64) *CurrencyPackage {
+	for i := range s.Packages {
+		if s.Packages[i].Amount == amount {
+			return &s.Packages[i]
+		}
+	}
+	return nil
+}
+
+// GetPackagePrice 返回套餐在支付币种下的售价，未启用多币种或套餐未配置该币种时返回 false
+func (s *CurrencySetting) GetPackagePrice(amount int64, currency string) (float64, bool) {
+	if !s.Enabled {
+		return 0, false
+	}
+	pkg := s.GetPackage(amount)
+	if pkg == nil {
+		return 0, false
+	}
+	price, ok := pkg.Prices[strings.ToUpper(currency)]
+	return price, ok && price > 0
+}
+
+func ValidateCurrencyPackages(packages []CurrencyPackage) error {
+	amounts := make(map[int64]bool, len(packages))
+	for i, pkg := range packages {
+		if pkg.Amount <= 0 {
+			return fmt.Errorf("package #%d: amount must be positive", i+1)
+		}
+		if amounts[pkg.Amount] {
+			return fmt.Errorf("package #%d: duplicate amount %d", i+1, pkg.Amount)
+		}
+		amounts[pkg.Amount] = true
+		for currency, price := range pkg.Prices {
+			if price <= 0 {
+				return fmt.Errorf("package #%d: price of %s must be positive", i+1, currency)
+			}
+		}
+	}
+	return nil
+}
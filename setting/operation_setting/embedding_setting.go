@@ -0,0 +1,43 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// EmbeddingSetting Embeddings 请求拆分配置，输入条数超过上游限制时拆分为多个子请求依次发送
+type EmbeddingSetting struct {
+	MaxBatchSize      int                        `json:"max_batch_size"`       // 单个上游请求最多输入条数，0 表示不拆分
+	ModelMaxBatchSize map[string]int             `json:"model_max_batch_size"` // 按上游模型覆盖，例如部分厂商单次仅支持 10 条
+	DimensionRatio    map[string]map[int]float64 `json:"dimension_ratio"`      // 按模型与 dimensions 参数设置额外倍率，未配置的维度不加价
+}
+
+// 默认配置
+var embeddingSetting = EmbeddingSetting{
+	MaxBatchSize:      2048, // 与 OpenAI 单次请求输入数组上限一致
+	ModelMaxBatchSize: map[string]int{},
+	DimensionRatio:    map[string]map[int]float64{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("embedding_setting", &embeddingSetting)
+}
+
+func GetEmbeddingSetting() *EmbeddingSetting {
+	return &embeddingSetting
+}
+
+// GetEmbeddingMaxBatchSize 返回模型单次请求的输入条数上限，0 表示不拆分
+func GetEmbeddingMaxBatchSize(modelName string) int {
+	if size, ok := embeddingSetting.ModelMaxBatchSize[modelName]; ok {
+		return max(size, 0)
+	}
+	return max(embeddingSetting.MaxBatchSize, 0)
+}
+
+// GetEmbeddingDimensionRatio 返回模型在指定 dimensions 下的额外倍率
+func GetEmbeddingDimensionRatio(modelName string, dimensions int) (float64, bool) {
+	ratio, ok := embeddingSetting.DimensionRatio[modelName][dimensions]
+	if !ok || ratio < 0 {
+		return 0, false
+	}
+	return ratio, true
+}
@@ -0,0 +1,43 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	FileStorageDriverLocal = "local"
+	FileStorageDriverS3    = "s3"
+)
+
+// FileSetting 文件接口（/v1/files）及存储后端配置
+type FileSetting struct {
+	Enabled       bool   `json:"enabled"`
+	StorageDriver string `json:"storage_driver"`   // local 或 s3
+	LocalPath     string `json:"local_path"`       // 本地存储目录
+	MaxFileSizeMB int    `json:"max_file_size_mb"` // 单个文件大小上限
+	UserQuotaMB   int    `json:"user_quota_mb"`    // 每个用户的存储空间上限，0 表示不限制
+	S3Endpoint    string `json:"s3_endpoint"`      // 例如 https://s3.us-east-1.amazonaws.com，兼容 MinIO、R2 等
+	S3Region      string `json:"s3_region"`        // 签名使用的区域
+	S3Bucket      string `json:"s3_bucket"`        // 存储桶名称
+	S3AccessKey   string `json:"s3_access_key"`    // Access Key ID
+	S3SecretKey   string `json:"s3_secret_key"`    // Secret Access Key
+	S3PathStyle   bool   `json:"s3_path_style"`    // 使用 path-style 寻址（MinIO 等通常需要开启）
+	S3KeyPrefix   string `json:"s3_key_prefix"`    // 对象键前缀
+}
+
+// 默认配置
+var fileSetting = FileSetting{
+	Enabled:       false,
+	StorageDriver: FileStorageDriverLocal,
+	LocalPath:     "data/files",
+	MaxFileSizeMB: 512, // 与 OpenAI 单文件上传上限一致
+	UserQuotaMB:   1024,
+	S3Region:      "us-east-1",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+func GetFileSetting() *FileSetting {
+	return &fileSetting
+}
@@ -0,0 +1,56 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// FreeTierQuota 每位用户每天的免费额度，次数与 token 数二选一，同时设置时按次数
+type FreeTierQuota struct {
+	Requests int `json:"requests"`
+	Tokens   int `json:"tokens"`
+}
+
+// FreeTierSetting 按模型配置的每日免费额度，结算时优先于付费额度使用
+type FreeTierSetting struct {
+	Enabled  bool                     `json:"enabled"`
+	Timezone string                   `json:"timezone"` // 每日零点重置所用的时区，为空使用服务器时区
+	Models   map[string]FreeTierQuota `json:"models"`
+}
+
+// 默认配置
+var freeTierSetting = FreeTierSetting{
+	Enabled: false,
+	Models:  map[string]FreeTierQuota{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("free_tier_setting", &freeTierSetting)
+}
+
+func GetFreeTierSetting() *FreeTierSetting {
+	return &freeTierSetting
+}
+
+// GetFreeTierQuota 返回模型的每日免费额度，未启用或未配置时返回 false
+func GetFreeTierQuota(modelName string) (FreeTierQuota, bool) {
+	if !freeTierSetting.Enabled {
+		return FreeTierQuota{}, false
+	}
+	quota, ok := freeTierSetting.Models[modelName]
+	if !ok || (quota.Requests <= 0 && quota.Tokens <= 0) {
+		return FreeTierQuota{}, false
+	}
+	return quota, true
+}
+
+func (s *FreeTierSetting) Location() *time.Location {
+	if s.Timezone != "" {
+		if location, err := time.LoadLocation(s.Timezone); err == nil {
+			return location
+		}
+	}
+	return time.Local
+}
@@ -0,0 +1,55 @@
+package operation_setting
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// GuardrailRule 强制附加到请求中的提示词，支持 {{username}}、{{user_id}}、{{group}}、{{token_name}}、{{model}}、{{date}}、{{datetime}} 变量
+type GuardrailRule struct {
+	SystemPrompt string `json:"system_prompt"` // 作为独立的系统消息插入到最前面
+	UserPrefix   string `json:"user_prefix"`   // 添加到最后一条用户消息之前
+	UserSuffix   string `json:"user_suffix"`   // 添加到最后一条用户消息之后
+}
+
+func (r GuardrailRule) IsEmpty() bool {
+	return r.SystemPrompt == "" && r.UserPrefix == "" && r.UserSuffix == ""
+}
+
+// GuardrailSetting 服务端强制提示词配置，客户端无法移除
+type GuardrailSetting struct {
+	Enabled bool                     `json:"enabled"`
+	Groups  map[string]GuardrailRule `json:"groups"`
+	Tokens  map[string]GuardrailRule `json:"tokens"` // 键为令牌 ID
+}
+
+// 默认配置
+var guardrailSetting = GuardrailSetting{
+	Groups: map[string]GuardrailRule{},
+	Tokens: map[string]GuardrailRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("guardrail_setting", &guardrailSetting)
+}
+
+func GetGuardrailSetting() *GuardrailSetting {
+	return &guardrailSetting
+}
+
+// ResolveRules 返回分组与令牌适用的规则，分组规则在前，令牌规则在后
+func (s *GuardrailSetting) ResolveRules(group string, tokenId int) []GuardrailRule {
+	if !s.Enabled {
+		return nil
+	}
+	rules := make([]GuardrailRule, 0, 2)
+	if rule, ok := s.Groups[group]; ok && !rule.IsEmpty() {
+		rules = append(rules, rule)
+	}
+	if rule, ok := s.Tokens[strconv.Itoa(tokenId)]; ok && !rule.IsEmpty() {
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -0,0 +1,30 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// IdempotencySetting 幂等请求缓存：相同请求在有效期内直接返回已保存的响应，不再请求上游也不重复计费
+type IdempotencySetting struct {
+	Enabled          bool `json:"enabled"`
+	HashBody         bool `json:"hash_body"`          // 未携带 Idempotency-Key 时是否按请求体哈希去重
+	TTLSeconds       int  `json:"ttl_seconds"`        // 响应保存时长
+	MaxResponseBytes int  `json:"max_response_bytes"` // 超过该大小的响应不保存
+	MaxMemoryEntries int  `json:"max_memory_entries"` // 未启用 Redis 时内存中最多保存的条数
+}
+
+// 默认配置
+var idempotencySetting = IdempotencySetting{
+	Enabled:          false,
+	HashBody:         false,
+	TTLSeconds:       24 * 60 * 60,
+	MaxResponseBytes: 1 << 20,
+	MaxMemoryEntries: 10000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("idempotency_setting", &idempotencySetting)
+}
+
+func GetIdempotencySetting() *IdempotencySetting {
+	return &idempotencySetting
+}
@@ -0,0 +1,36 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// LogArchiveSetting 日志归档：定期把超过保留天数的日志压缩导出到对象存储
+type LogArchiveSetting struct {
+	Enabled              bool   `json:"enabled"`
+	ArchiveAfterDays     int    `json:"archive_after_days"` // 早于该天数的日志会被归档
+	IntervalHours        int    `json:"interval_hours"`
+	BatchSize            int    `json:"batch_size"`     // 单个归档文件包含的最大日志条数
+	StorageDriver        string `json:"storage_driver"` // 为空时使用文件存储的驱动配置
+	KeyPrefix            string `json:"key_prefix"`
+	DeleteAfterArchive   bool   `json:"delete_after_archive"`   // 上传成功后从数据库删除
+	ArchiveRetentionDays int    `json:"archive_retention_days"` // 归档文件保留天数，0 表示永久保留
+}
+
+// 默认配置
+var logArchiveSetting = LogArchiveSetting{
+	Enabled:              false,
+	ArchiveAfterDays:     30,
+	IntervalHours:        24,
+	BatchSize:            10000,
+	StorageDriver:        "",
+	KeyPrefix:            "log-archive",
+	DeleteAfterArchive:   true,
+	ArchiveRetentionDays: 0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_archive_setting", &logArchiveSetting)
+}
+
+func GetLogArchiveSetting() *LogArchiveSetting {
+	return &logArchiveSetting
+}
@@ -0,0 +1,36 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// LogExportSetting 用户自助导出使用日志（CSV/JSONL）的配置
+type LogExportSetting struct {
+	Enabled              bool `json:"enabled"`
+	MaxRangeDays         int  `json:"max_range_days"`          // 单次导出的最大时间跨度
+	MaxRows              int  `json:"max_rows"`                // 单个文件的最大行数，超出部分不导出
+	MaxSizeMB            int  `json:"max_size_mb"`             // 单个文件的大小上限，超出部分不导出
+	MaxConcurrentPerUser int  `json:"max_concurrent_per_user"` // 每个用户同时排队或生成中的导出数量
+	MaxConcurrent        int  `json:"max_concurrent"`          // 单个实例同时生成的导出数量，其余排队等待
+	RetentionHours       int  `json:"retention_hours"`         // 生成的文件保留时长，过期后删除
+	DownloadURLMinutes   int  `json:"download_url_minutes"`    // 签名下载链接的有效期
+}
+
+// 默认配置
+var logExportSetting = LogExportSetting{
+	Enabled:              true,
+	MaxRangeDays:         92,
+	MaxRows:              1000000,
+	MaxSizeMB:            200,
+	MaxConcurrentPerUser: 1,
+	MaxConcurrent:        2,
+	RetentionHours:       72,
+	DownloadURLMinutes:   60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_export_setting", &logExportSetting)
+}
+
+func GetLogExportSetting() *LogExportSetting {
+	return &logExportSetting
+}
@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// MCPSetting 网关自身的 MCP 服务（/mcp），以令牌鉴权提供模型列表、用量与余额查询工具
+type MCPSetting struct {
+	Enabled bool `json:"enabled"`
+	// 旧版 SSE 传输单个令牌可同时保持的连接数
+	MaxSSESessionsPerToken int `json:"max_sse_sessions_per_token"`
+}
+
+// 默认配置
+var mcpSetting = MCPSetting{
+	Enabled:                true,
+	MaxSSESessionsPerToken: 5,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("mcp_setting", &mcpSetting)
+}
+
+func GetMCPSetting() *MCPSetting {
+	return &mcpSetting
+}
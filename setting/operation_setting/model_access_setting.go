@@ -0,0 +1,77 @@
+package operation_setting
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// GroupModelPolicy 分组的模型访问策略，支持 * 与 ? 通配符
+type GroupModelPolicy struct {
+	Allow []string `json:"allow,omitempty"` // 为空表示不限制
+	Deny  []string `json:"deny,omitempty"`  // 优先于 allow
+}
+
+// ModelAccessSetting 按用户分组限制可访问的模型
+type ModelAccessSetting struct {
+	Enabled bool                        `json:"enabled"`
+	Groups  map[string]GroupModelPolicy `json:"groups"`
+}
+
+// 默认配置
+var modelAccessSetting = ModelAccessSetting{
+	Enabled: false,
+	Groups:  map[string]GroupModelPolicy{},
+}
+
+var modelPatternCache sync.Map // map[string]*regexp.Regexp
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_access_setting", &modelAccessSetting)
+}
+
+func GetModelAccessSetting() *ModelAccessSetting {
+	return &modelAccessSetting
+}
+
+// MatchModelPattern 通配符匹配模型名，* 匹配任意字符串，? 匹配单个字符
+func MatchModelPattern(pattern string, modelName string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == modelName
+	}
+	re, ok := modelPatternCache.Load(pattern)
+	if !ok {
+		expr := regexp.QuoteMeta(pattern)
+		expr = strings.ReplaceAll(expr, `\*`, ".*")
+		expr = strings.ReplaceAll(expr, `\?`, ".")
+		re, _ = modelPatternCache.LoadOrStore(pattern, regexp.MustCompile("^"+expr+"$"))
+	}
+	return re.(*regexp.Regexp).MatchString(modelName)
+}
+
+func matchAnyModelPattern(patterns []string, modelName string) bool {
+	for _, pattern := range patterns {
+		if MatchModelPattern(pattern, modelName) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsModelAllowedForGroup 未启用或分组未配置策略时不限制
+func IsModelAllowedForGroup(group string, modelName string) bool {
+	if !modelAccessSetting.Enabled {
+		return true
+	}
+	policy, ok := modelAccessSetting.Groups[group]
+	if !ok {
+		return true
+	}
+	if matchAnyModelPattern(policy.Deny, modelName) {
+		return false
+	}
+	return len(policy.Allow) == 0 || matchAnyModelPattern(policy.Allow, modelName)
+}
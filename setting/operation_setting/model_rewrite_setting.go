@@ -0,0 +1,72 @@
+package operation_setting
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ModelRewriteRule 模型别名/改写规则，在选择渠道之前生效
+type ModelRewriteRule struct {
+	Name      string   `json:"name"`
+	Match     string   `json:"match"` // 请求的模型名，Regex 为 true 时为正则（需完整匹配）
+	Regex     bool     `json:"regex,omitempty"`
+	Target    string   `json:"target"`               // 改写后的模型名，正则规则可使用 $1 等引用分组
+	Groups    []string `json:"groups,omitempty"`     // 生效的分组，为空表示全局规则
+	Weekdays  []int    `json:"weekdays,omitempty"`   // 生效的星期（0 为周日），为空表示每天
+	StartTime string   `json:"start_time,omitempty"` // 每日生效时间段 HH:MM（服务器时区），开始晚于结束时表示跨零点
+	EndTime   string   `json:"end_time,omitempty"`
+	Disabled  bool     `json:"disabled,omitempty"`
+}
+
+type ModelRewriteSetting struct {
+	Enabled bool               `json:"enabled"`
+	Rules   []ModelRewriteRule `json:"rules"`
+}
+
+// 默认配置
+var modelRewriteSetting = ModelRewriteSetting{
+	Enabled: false,
+	Rules:   []ModelRewriteRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_rewrite_setting", &modelRewriteSetting)
+}
+
+func GetModelRewriteSetting() *ModelRewriteSetting {
+	return &modelRewriteSetting
+}
+
+func ValidateModelRewriteRules(rules []ModelRewriteRule) error {
+	for i, rule := range rules {
+		if rule.Match == "" || rule.Target == "" {
+			return fmt.Errorf("rule #%d: match and target are required", i+1)
+		}
+		if rule.Regex {
+			if _, err := regexp.Compile(rule.Match); err != nil {
+				return fmt.Errorf("rule #%d: invalid regex %q: %w", i+1, rule.Match, err)
+			}
+		}
+		for _, weekday := range rule.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return fmt.Errorf("rule #%d: invalid weekday %d", i+1, weekday)
+			}
+		}
+		if (rule.StartTime == "") != (rule.EndTime == "") {
+			return fmt.Errorf("rule #%d: start_time and end_time must be set together", i+1)
+		}
+		for _, t := range []string{rule.StartTime, rule.EndTime} {
+			if t == "" {
+				continue
+			}
+			if _, err := time.Parse("15:04", t); err != nil {
+				return fmt.Errorf("rule #%d: invalid time %q, expected HH:MM", i+1, t)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ModelRouteRule 虚拟模型的一条路由规则，所有已配置的条件都满足时命中
+type ModelRouteRule struct {
+	Name            string   `json:"name,omitempty"`
+	Target          string   `json:"target"`                      // 命中后实际使用的模型
+	MinPromptTokens int      `json:"min_prompt_tokens,omitempty"` // 预估输入 token 下限（含）
+	MaxPromptTokens int      `json:"max_prompt_tokens,omitempty"` // 预估输入 token 上限（含），0 表示不限制
+	HasTools        *bool    `json:"has_tools,omitempty"`         // 是否携带工具定义，为空表示不限制
+	HasImages       *bool    `json:"has_images,omitempty"`        // 是否包含图片输入，为空表示不限制
+	Groups          []string `json:"groups,omitempty"`            // 生效的分组，为空表示所有分组
+}
+
+// VirtualModel 管理员定义的虚拟模型，客户端直接请求该名称，按规则顺序选择第一条命中的目标模型
+type VirtualModel struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Rules       []ModelRouteRule `json:"rules"`
+	Default     string           `json:"default"` // 没有规则命中时使用的模型
+}
+
+type ModelRouterSetting struct {
+	Enabled bool           `json:"enabled"`
+	Models  []VirtualModel `json:"models"`
+}
+
+// 默认配置
+var modelRouterSetting = ModelRouterSetting{
+	Enabled: false,
+	Models:  []VirtualModel{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_router_setting", &modelRouterSetting)
+}
+
+func GetModelRouterSetting() *ModelRouterSetting {
+	return &modelRouterSetting
+}
+
+// GetVirtualModel 按名称查找虚拟模型，未启用或不存在时返回 nil
+func (s *ModelRouterSetting) GetVirtualModel(name string) *VirtualModel {
+	if !s.Enabled {
+		return nil
+	}
+	for i := range s.Models {
+		if s.Models[i].Name == name {
+			return &s.Models[i]
+		}
+	}
+	return nil
+}
+
+func ValidateVirtualModels(models []VirtualModel) error {
+	names := make(map[string]bool, len(models))
+	for i, virtual := range models {
+		if virtual.Name == "" || virtual.Default == "" {
+			return fmt.Errorf("model #%d: name and default are required", i+1)
+		}
+		if names[virtual.Name] {
+			return fmt.Errorf("model #%d: duplicate name %q", i+1, virtual.Name)
+		}
+		names[virtual.Name] = true
+		for j, rule := range virtual.Rules {
+			if rule.Target == "" {
+				return fmt.Errorf("model %q rule #%d: target is required", virtual.Name, j+1)
+			}
+			if rule.MinPromptTokens < 0 || rule.MaxPromptTokens < 0 ||
+				(rule.MaxPromptTokens > 0 && rule.MinPromptTokens > rule.MaxPromptTokens) {
+				return fmt.Errorf("model %q rule #%d: invalid prompt token range", virtual.Name, j+1)
+			}
+		}
+	}
+	// 目标不能是另一个虚拟模型，避免链式路由
+	for _, virtual := range models {
+		targets := []string{virtual.Default}
+		for _, rule := range virtual.Rules {
+			targets = append(targets, rule.Target)
+		}
+		for _, target := range targets {
+			if names[target] {
+				return fmt.Errorf("model %q: target %q is a virtual model", virtual.Name, target)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	ModerationProviderOpenAI  = "openai"
+	ModerationProviderKeyword = "keyword"
+	ModerationProviderHTTP    = "http"
+)
+
+// ModerationRule 分组或模型的审核规则，Providers 为空时使用默认审核方式
+type ModerationRule struct {
+	Enabled   bool     `json:"enabled"`
+	Providers []string `json:"providers"`
+}
+
+// ModerationSetting 请求转发前的内容审核配置
+type ModerationSetting struct {
+	Enabled      bool     `json:"enabled"`
+	Providers    []string `json:"providers"` // 按顺序执行，任一命中即拦截
+	FailOpen     bool     `json:"fail_open"` // 审核服务出错时放行请求
+	NotifyAdmins bool     `json:"notify_admins"`
+
+	OpenAIBaseURL string `json:"openai_base_url"`
+	OpenAIAPIKey  string `json:"openai_api_key"`
+	OpenAIModel   string `json:"openai_model"`
+
+	Keywords []string `json:"keywords"` // 不区分大小写的关键词
+	Patterns []string `json:"patterns"` // 正则表达式
+
+	HTTPURL        string `json:"http_url"` // 自定义分类服务，返回 {"flagged": bool, "categories": []}
+	HTTPSecret     string `json:"http_secret"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+
+	Groups map[string]ModerationRule `json:"groups"` // 按令牌分组覆盖默认规则
+	Models map[string]ModerationRule `json:"models"` // 按模型覆盖分组规则，优先级最高
+}
+
+// 默认配置
+var moderationSetting = ModerationSetting{
+	Providers:      []string{ModerationProviderKeyword},
+	FailOpen:       true,
+	OpenAIBaseURL:  "https://api.openai.com",
+	OpenAIModel:    "omni-moderation-latest",
+	Keywords:       []string{},
+	Patterns:       []string{},
+	TimeoutSeconds: 5,
+	Groups:         map[string]ModerationRule{},
+	Models:         map[string]ModerationRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("moderation_setting", &moderationSetting)
+}
+
+func GetModerationSetting() *ModerationSetting {
+	return &moderationSetting
+}
+
+// ResolveProviders 返回分组与模型适用的审核方式，为空表示不审核
+func (s *ModerationSetting) ResolveProviders(group string, model string) []string {
+	enabled, providers := s.Enabled, s.Providers
+	if rule, ok := s.Groups[group]; ok {
+		enabled = rule.Enabled
+		if len(rule.Providers) > 0 {
+			providers = rule.Providers
+		}
+	}
+	if rule, ok := s.Models[model]; ok {
+		enabled = rule.Enabled
+		if len(rule.Providers) > 0 {
+			providers = rule.Providers
+		}
+	}
+	if !enabled {
+		return nil
+	}
+	return providers
+}
+
+func IsValidModerationProvider(provider string) bool {
+	switch provider {
+	case ModerationProviderOpenAI, ModerationProviderKeyword, ModerationProviderHTTP:
+		return true
+	}
+	return false
+}
@@ -10,12 +10,22 @@ import (
 type MonitorSetting struct {
 	AutoTestChannelEnabled bool    `json:"auto_test_channel_enabled"`
 	AutoTestChannelMinutes float64 `json:"auto_test_channel_minutes"`
+	// 按标签聚合渠道自动禁用通知，窗口期内同一标签只发送一条汇总
+	DisableNotifyAggregateByTag   bool `json:"disable_notify_aggregate_by_tag"`
+	DisableNotifyAggregateSeconds int  `json:"disable_notify_aggregate_seconds"`
+	// 按渠道同步策略定时拉取上游模型列表
+	UpstreamModelSyncEnabled bool    `json:"upstream_model_sync_enabled"`
+	UpstreamModelSyncMinutes float64 `json:"upstream_model_sync_minutes"`
 }
 
 // 默认配置
 var monitorSetting = MonitorSetting{
-	AutoTestChannelEnabled: false,
-	AutoTestChannelMinutes: 10,
+	AutoTestChannelEnabled:        false,
+	AutoTestChannelMinutes:        10,
+	DisableNotifyAggregateByTag:   false,
+	DisableNotifyAggregateSeconds: 60,
+	UpstreamModelSyncEnabled:      false,
+	UpstreamModelSyncMinutes:      360,
 }
 
 func init() {
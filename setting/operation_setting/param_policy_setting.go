@@ -0,0 +1,81 @@
+package operation_setting
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	ParamPolicyActionClamp  = "clamp"
+	ParamPolicyActionReject = "reject"
+)
+
+// ParamPolicy 强制执行的采样参数策略，超出限制的值按 Action 收敛或拒绝请求
+type ParamPolicy struct {
+	Action            string   `json:"action,omitempty"`              // clamp（默认）或 reject
+	MaxTemperature    *float64 `json:"max_temperature,omitempty"`     // temperature 上限，为空表示不限制
+	MaxTokens         int      `json:"max_tokens,omitempty"`          // 输出 token 上限，未传入时自动补上，0 表示不限制
+	ForbidLogprobs    bool     `json:"forbid_logprobs,omitempty"`     // 禁止请求 logprobs
+	ForceIncludeUsage bool     `json:"force_include_usage,omitempty"` // 流式请求强制开启 stream_options.include_usage
+}
+
+func (p ParamPolicy) IsEmpty() bool {
+	return p.MaxTemperature == nil && p.MaxTokens <= 0 && !p.ForbidLogprobs && !p.ForceIncludeUsage
+}
+
+func (p ParamPolicy) Rejects() bool {
+	return p.Action == ParamPolicyActionReject
+}
+
+// ParamPolicySetting 按分组或用户强制执行的采样参数策略
+type ParamPolicySetting struct {
+	Enabled bool                   `json:"enabled"`
+	Groups  map[string]ParamPolicy `json:"groups"`
+	Users   map[string]ParamPolicy `json:"users"` // 键为用户 ID
+}
+
+// 默认配置
+var paramPolicySetting = ParamPolicySetting{
+	Groups: map[string]ParamPolicy{},
+	Users:  map[string]ParamPolicy{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("param_policy_setting", &paramPolicySetting)
+}
+
+func GetParamPolicySetting() *ParamPolicySetting {
+	return &paramPolicySetting
+}
+
+// ResolvePolicy 返回用户适用的策略，用户策略优先于分组策略
+func (s *ParamPolicySetting) ResolvePolicy(group string, userId int) (ParamPolicy, bool) {
+	if !s.Enabled {
+		return ParamPolicy{}, false
+	}
+	if policy, ok := s.Users[strconv.Itoa(userId)]; ok && !policy.IsEmpty() {
+		return policy, true
+	}
+	if policy, ok := s.Groups[group]; ok && !policy.IsEmpty() {
+		return policy, true
+	}
+	return ParamPolicy{}, false
+}
+
+func ValidateParamPolicies(policies map[string]ParamPolicy) error {
+	for key, policy := range policies {
+		if policy.Action != "" && policy.Action != ParamPolicyActionClamp && policy.Action != ParamPolicyActionReject {
+			return fmt.Errorf("%s: unknown action %q", key, policy.Action)
+		}
+		if policy.MaxTemperature != nil && *policy.MaxTemperature < 0 {
+			return fmt.Errorf("%s: max_temperature must not be negative", key)
+		}
+		if policy.MaxTokens < 0 {
+			return fmt.Errorf("%s: max_tokens must not be negative", key)
+		}
+	}
+	return nil
+}
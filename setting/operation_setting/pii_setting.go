@@ -0,0 +1,65 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// 内置的个人信息识别规则
+const (
+	PIIRuleEmail      = "email"
+	PIIRulePhone      = "phone"
+	PIIRuleIdCard     = "id_card"
+	PIIRuleCreditCard = "credit_card"
+)
+
+// PIIRule 自定义识别规则，Pattern 与 Words 任选其一，Name 会作为占位符前缀
+type PIIRule struct {
+	Name    string   `json:"name"`
+	Pattern string   `json:"pattern"`
+	Words   []string `json:"words"`
+}
+
+// PIIPolicy 分组的脱敏策略，Rules 为空时使用默认规则
+type PIIPolicy struct {
+	Enabled bool     `json:"enabled"`
+	Rules   []string `json:"rules"`
+	Restore bool     `json:"restore"`
+}
+
+// PIISetting 请求转发前的个人信息脱敏配置
+type PIISetting struct {
+	Enabled     bool                 `json:"enabled"`
+	Rules       []string             `json:"rules"`   // 启用的规则名，包括内置规则与自定义规则
+	Restore     bool                 `json:"restore"` // 在响应中将占位符还原为原始内容
+	CustomRules []PIIRule            `json:"custom_rules"`
+	Groups      map[string]PIIPolicy `json:"groups"` // 按分组覆盖默认策略
+}
+
+// 默认配置
+var piiSetting = PIISetting{
+	Rules:       []string{PIIRuleEmail, PIIRulePhone, PIIRuleIdCard, PIIRuleCreditCard},
+	CustomRules: []PIIRule{},
+	Groups:      map[string]PIIPolicy{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("pii_setting", &piiSetting)
+}
+
+func GetPIISetting() *PIISetting {
+	return &piiSetting
+}
+
+// ResolvePolicy 返回分组适用的规则与是否还原，规则为空表示不脱敏
+func (s *PIISetting) ResolvePolicy(group string) (rules []string, restore bool) {
+	enabled, rules, restore := s.Enabled, s.Rules, s.Restore
+	if policy, ok := s.Groups[group]; ok {
+		enabled, restore = policy.Enabled, policy.Restore
+		if len(policy.Rules) > 0 {
+			rules = policy.Rules
+		}
+	}
+	if !enabled {
+		return nil, false
+	}
+	return rules, restore
+}
@@ -0,0 +1,28 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// PostpaidSetting 后付费用户：信用额度使用提醒、超限停用与月末出账
+type PostpaidSetting struct {
+	DunningThresholds []int `json:"dunning_thresholds"` // 信用额度使用比例达到这些百分比时提醒用户
+	SuspendOnExceed   bool  `json:"suspend_on_exceed"`  // 透支超过信用额度时自动停用用户
+	InvoiceEnabled    bool  `json:"invoice_enabled"`    // 每月初为欠费的后付费用户生成上月账单
+	InvoiceDueDays    int   `json:"invoice_due_days"`
+}
+
+// 默认配置
+var postpaidSetting = PostpaidSetting{
+	DunningThresholds: []int{50, 80, 90},
+	SuspendOnExceed:   true,
+	InvoiceEnabled:    true,
+	InvoiceDueDays:    15,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("postpaid_setting", &postpaidSetting)
+}
+
+func GetPostpaidSetting() *PostpaidSetting {
+	return &postpaidSetting
+}
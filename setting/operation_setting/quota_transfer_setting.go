@@ -0,0 +1,44 @@
+package operation_setting
+
+import (
+	"math"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// QuotaTransferSetting 用户之间转账的手续费与限额，管理员在令牌之间调配额度不受此限制
+type QuotaTransferSetting struct {
+	Enabled         bool    `json:"enabled"`
+	FeePercent      float64 `json:"fee_percent"`       // 手续费比例（%），由转出方在转账额度之外额外支付
+	MinQuota        int     `json:"min_quota"`         // 单笔最少转账额度
+	MaxQuota        int     `json:"max_quota"`         // 单笔最多转账额度，0 表示不限制
+	DailyQuotaLimit int     `json:"daily_quota_limit"` // 每个用户每日累计转出额度上限，0 表示不限制
+	DailyCountLimit int     `json:"daily_count_limit"` // 每个用户每日转出次数上限，0 表示不限制
+}
+
+// 默认配置
+var quotaTransferSetting = QuotaTransferSetting{
+	Enabled:         false,
+	FeePercent:      0,
+	MinQuota:        500000,
+	MaxQuota:        0,
+	DailyQuotaLimit: 0,
+	DailyCountLimit: 10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("quota_transfer_setting", &quotaTransferSetting)
+}
+
+func GetQuotaTransferSetting() *QuotaTransferSetting {
+	return &quotaTransferSetting
+}
+
+// CalculateFee 返回转账手续费，不足 1 的部分向上取整
+func (s *QuotaTransferSetting) CalculateFee(quota int) int {
+	if s.FeePercent <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(quota) * s.FeePercent / 100))
+}
@@ -0,0 +1,24 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RealtimeSetting Realtime（WebSocket）会话限制，0 表示不限制
+type RealtimeSetting struct {
+	MaxSessionMinutes             int `json:"max_session_minutes"`               // 单个会话最长持续时间
+	MaxConcurrentSessionsPerToken int `json:"max_concurrent_sessions_per_token"` // 单个令牌同时在线的会话数
+}
+
+// 默认配置
+var realtimeSetting = RealtimeSetting{
+	MaxSessionMinutes:             60, // 与 OpenAI 官方会话上限一致
+	MaxConcurrentSessionsPerToken: 0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("realtime_setting", &realtimeSetting)
+}
+
+func GetRealtimeSetting() *RealtimeSetting {
+	return &realtimeSetting
+}
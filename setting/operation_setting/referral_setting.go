@@ -0,0 +1,26 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ReferralSetting 邀请返佣配置，被邀请用户充值后按比例返佣到邀请人的邀请额度
+type ReferralSetting struct {
+	Enabled        bool    `json:"enabled"`
+	CommissionRate float64 `json:"commission_rate"` // 默认返佣百分比，可按邀请人单独调整
+	MaxTopUps      int     `json:"max_topups"`      // 每位被邀请用户最多返佣的充值笔数，0 表示不限
+	ValidDays      int     `json:"valid_days"`      // 建立邀请关系后多少天内的充值返佣，0 表示不限
+}
+
+// 默认配置
+var referralSetting = ReferralSetting{
+	Enabled:        false,
+	CommissionRate: 5,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("referral_setting", &referralSetting)
+}
+
+func GetReferralSetting() *ReferralSetting {
+	return &referralSetting
+}
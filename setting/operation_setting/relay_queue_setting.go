@@ -0,0 +1,30 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RelayQueueSetting 渠道均被上游限流（429）时让请求排队等待，而不是立即失败
+type RelayQueueSetting struct {
+	Enabled         bool           `json:"enabled"`
+	MaxQueueSize    int            `json:"max_queue_size"`    // 单个模型最多排队的请求数，超出时直接返回错误
+	MaxWaitSeconds  int            `json:"max_wait_seconds"`  // 单个请求最长排队时间
+	RetryIntervalMs int            `json:"retry_interval_ms"` // 无请求成功时，队首请求重试的间隔
+	GroupPriorities map[string]int `json:"group_priorities"`  // 分组优先级，数值越大越先出队，未配置为 0
+}
+
+// 默认配置
+var relayQueueSetting = RelayQueueSetting{
+	Enabled:         false,
+	MaxQueueSize:    100,
+	MaxWaitSeconds:  30,
+	RetryIntervalMs: 1000,
+	GroupPriorities: map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("relay_queue_setting", &relayQueueSetting)
+}
+
+func GetRelayQueueSetting() *RelayQueueSetting {
+	return &relayQueueSetting
+}
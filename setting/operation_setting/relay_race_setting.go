@@ -0,0 +1,65 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	RelayRaceMinFanOut = 2
+	RelayRaceMaxFanOut = 3
+)
+
+// RelayRaceSetting 竞速模式：同一请求同时发往多个渠道，采用最先返回的响应，其余请求取消且不计费
+type RelayRaceSetting struct {
+	Enabled bool `json:"enabled"`
+	FanOut  int  `json:"fan_out"` // 同时请求的渠道数，限制在 2~3
+	// 允许竞速的模型，键以 * 结尾时按前缀匹配；为空表示不允许任何模型
+	Models []string `json:"models"`
+	// 允许令牌开启竞速的分组，为空表示所有分组
+	AllowedGroups []string `json:"allowed_groups"`
+	// 默认对所有请求开启竞速的分组，无需令牌单独开启
+	DefaultGroups []string `json:"default_groups"`
+}
+
+// 默认配置
+var relayRaceSetting = RelayRaceSetting{
+	Enabled:       false,
+	FanOut:        2,
+	Models:        []string{},
+	AllowedGroups: []string{},
+	DefaultGroups: []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("relay_race_setting", &relayRaceSetting)
+}
+
+func GetRelayRaceSetting() *RelayRaceSetting {
+	return &relayRaceSetting
+}
+
+// GetFanOut 返回限制在允许范围内的并发渠道数
+func (s *RelayRaceSetting) GetFanOut() int {
+	return min(max(s.FanOut, RelayRaceMinFanOut), RelayRaceMaxFanOut)
+}
+
+// ShouldRace 判断该分组与模型的请求是否使用竞速，tokenEnabled 为令牌是否开启了竞速
+func (s *RelayRaceSetting) ShouldRace(group string, model string, tokenEnabled bool) bool {
+	if !s.Enabled {
+		return false
+	}
+	models := make(map[string]bool, len(s.Models))
+	for _, item := range s.Models {
+		models[item] = true
+	}
+	if _, ok := matchModelKey(models, model); !ok {
+		return false
+	}
+	if slices.Contains(s.DefaultGroups, group) {
+		return true
+	}
+	return tokenEnabled && (len(s.AllowedGroups) == 0 || slices.Contains(s.AllowedGroups, group))
+}
@@ -0,0 +1,74 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// RelayTimeoutPolicy 上游请求的超时与重试策略，各项为零值时使用全局设置
+type RelayTimeoutPolicy struct {
+	ConnectTimeout    int  `json:"connect_timeout,omitempty"`     // 建立连接的超时，秒
+	RequestTimeout    int  `json:"request_timeout,omitempty"`     // 整体超时，秒，包含读取完整响应
+	StreamIdleTimeout int  `json:"stream_idle_timeout,omitempty"` // 流式响应两次数据之间的最长等待，秒
+	MaxRetries        *int `json:"max_retries,omitempty"`         // 失败后的重试次数，0 表示不重试
+}
+
+// Override 用 other 中已配置的项覆盖当前策略
+func (p RelayTimeoutPolicy) Override(other RelayTimeoutPolicy) RelayTimeoutPolicy {
+	if other.ConnectTimeout > 0 {
+		p.ConnectTimeout = other.ConnectTimeout
+	}
+	if other.RequestTimeout > 0 {
+		p.RequestTimeout = other.RequestTimeout
+	}
+	if other.StreamIdleTimeout > 0 {
+		p.StreamIdleTimeout = other.StreamIdleTimeout
+	}
+	if other.MaxRetries != nil && *other.MaxRetries >= 0 {
+		p.MaxRetries = other.MaxRetries
+	}
+	return p
+}
+
+type RelayTimeoutSetting struct {
+	// 键为模型名，以 * 结尾时按前缀匹配，例如 "o1*"
+	Models map[string]RelayTimeoutPolicy `json:"models"`
+}
+
+// 默认配置
+var relayTimeoutSetting = RelayTimeoutSetting{
+	Models: map[string]RelayTimeoutPolicy{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("relay_timeout_setting", &relayTimeoutSetting)
+}
+
+func GetRelayTimeoutSetting() *RelayTimeoutSetting {
+	return &relayTimeoutSetting
+}
+
+// Resolve 精确匹配优先，其次取最长的前缀匹配
+func (s *RelayTimeoutSetting) Resolve(model string) RelayTimeoutPolicy {
+	policy, _ := matchModelKey(s.Models, model)
+	return policy
+}
+
+// matchModelKey 按模型名查找配置，键以 * 结尾时按前缀匹配，多个前缀命中时取最长的
+func matchModelKey[T any](items map[string]T, model string) (T, bool) {
+	if item, ok := items[model]; ok {
+		return item, true
+	}
+	var matched T
+	longest := -1
+	for key, item := range items {
+		prefix, ok := strings.CutSuffix(key, "*")
+		if ok && len(prefix) > longest && strings.HasPrefix(model, prefix) {
+			matched = item
+			longest = len(prefix)
+		}
+	}
+	return matched, longest >= 0
+}
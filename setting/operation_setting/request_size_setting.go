@@ -0,0 +1,45 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	RequestSizeClassText  = "text"
+	RequestSizeClassImage = "image"
+	RequestSizeClassAudio = "audio"
+	RequestSizeClassFile  = "file"
+)
+
+// RequestSizeSetting 按接口类别限制请求体大小（MB，解压后），0 表示使用 MAX_REQUEST_BODY_MB
+type RequestSizeSetting struct {
+	TextMaxMB  int `json:"text_max_mb"`  // 对话、补全、嵌入等 JSON 请求，包含 base64 图片
+	ImageMaxMB int `json:"image_max_mb"` // 图片生成与编辑
+	AudioMaxMB int `json:"audio_max_mb"` // 语音转写、翻译与合成
+	FileMaxMB  int `json:"file_max_mb"`  // 文件上传、批处理与视频任务
+}
+
+// 默认配置
+var requestSizeSetting = RequestSizeSetting{}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("request_size_setting", &requestSizeSetting)
+}
+
+func GetRequestSizeSetting() *RequestSizeSetting {
+	return &requestSizeSetting
+}
+
+// LimitMB 返回该类别的上限，未单独配置时返回 0
+func (s *RequestSizeSetting) LimitMB(class string) int {
+	switch class {
+	case RequestSizeClassText:
+		return s.TextMaxMB
+	case RequestSizeClassImage:
+		return s.ImageMaxMB
+	case RequestSizeClassAudio:
+		return s.AudioMaxMB
+	case RequestSizeClassFile:
+		return s.FileMaxMB
+	}
+	return 0
+}
@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ResponsesSetting /v1/responses 相关配置
+type ResponsesSetting struct {
+	// 在网关侧保存 Responses 对象，使 previous_response_id 可以跨渠道续接
+	StoreEnabled  bool `json:"store_enabled"`
+	RetentionDays int  `json:"retention_days"`
+	// 回溯 previous_response_id 的最大轮数
+	MaxChainDepth int `json:"max_chain_depth"`
+	// 渠道不支持 Responses API 时转换为 chat/completions 请求
+	ChatFallbackEnabled bool `json:"chat_fallback_enabled"`
+}
+
+// 默认配置
+var responsesSetting = ResponsesSetting{
+	StoreEnabled:        false,
+	RetentionDays:       30,
+	MaxChainDepth:       100,
+	ChatFallbackEnabled: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("responses_setting", &responsesSetting)
+}
+
+func GetResponsesSetting() *ResponsesSetting {
+	return &responsesSetting
+}
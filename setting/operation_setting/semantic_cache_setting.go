@@ -0,0 +1,63 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	SemanticCacheBackendMemory = "memory"
+	SemanticCacheBackendRedis  = "redis"
+)
+
+// SemanticCacheSetting 语义缓存配置：按提示词向量相似度复用非流式 chat completions 响应
+type SemanticCacheSetting struct {
+	Enabled                bool     `json:"enabled"`
+	Backend                string   `json:"backend"`                   // memory 或 redis，未启用 Redis 时回退到内存
+	SimilarityThreshold    float64  `json:"similarity_threshold"`      // 余弦相似度不低于该值视为命中
+	TTLSeconds             int      `json:"ttl_seconds"`               // 缓存有效期
+	MaxEntriesPerPartition int      `json:"max_entries_per_partition"` // 每个分区（模型 + 请求参数）最多缓存条数
+	ShareAcrossUsers       bool     `json:"share_across_users"`        // 是否跨用户共享缓存，关闭时按用户隔离
+	Models                 []string `json:"models"`                    // 启用的模型，为空表示全部
+	Groups                 []string `json:"groups"`                    // 启用的分组，为空表示全部
+	EmbeddingBaseUrl       string   `json:"embedding_base_url"`        // OpenAI 兼容的 embeddings 服务地址，可指向本网关
+	EmbeddingApiKey        string   `json:"embedding_api_key"`
+	EmbeddingModel         string   `json:"embedding_model"`
+}
+
+// 默认配置
+var semanticCacheSetting = SemanticCacheSetting{
+	Enabled:                false,
+	Backend:                SemanticCacheBackendMemory,
+	SimilarityThreshold:    0.95,
+	TTLSeconds:             3600,
+	MaxEntriesPerPartition: 1000,
+	ShareAcrossUsers:       false,
+	Models:                 []string{},
+	Groups:                 []string{},
+	EmbeddingModel:         "text-embedding-3-small",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("semantic_cache_setting", &semanticCacheSetting)
+}
+
+func GetSemanticCacheSetting() *SemanticCacheSetting {
+	return &semanticCacheSetting
+}
+
+// IsSemanticCacheEnabledFor 判断模型与分组是否启用语义缓存
+func IsSemanticCacheEnabledFor(modelName string, group string) bool {
+	if !semanticCacheSetting.Enabled || semanticCacheSetting.EmbeddingBaseUrl == "" {
+		return false
+	}
+	if len(semanticCacheSetting.Models) > 0 && !slices.Contains(semanticCacheSetting.Models, modelName) {
+		return false
+	}
+	if len(semanticCacheSetting.Groups) > 0 && !slices.Contains(semanticCacheSetting.Groups, group) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// StreamFailoverSetting 流式 chat completions 上游中途断开时自动切换渠道
+type StreamFailoverSetting struct {
+	Enabled       bool `json:"enabled"`        // 尚未向客户端输出内容时，换渠道重试
+	ResumeEnabled bool `json:"resume_enabled"` // 已输出部分内容时也换渠道重试，仅限 temperature 为 0 的请求；重放时跳过客户端已收到的内容，新响应与已输出内容不一致时以错误结束
+}
+
+// 默认配置
+var streamFailoverSetting = StreamFailoverSetting{
+	Enabled:       false,
+	ResumeEnabled: false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("stream_failover_setting", &streamFailoverSetting)
+}
+
+func GetStreamFailoverSetting() *StreamFailoverSetting {
+	return &streamFailoverSetting
+}
@@ -0,0 +1,34 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// GroupRotationPolicy 分组内令牌的自动轮换策略
+type GroupRotationPolicy struct {
+	IntervalDays int `json:"interval_days"` // 距上次轮换（或创建）多少天后自动轮换，0 表示不轮换
+	OverlapHours int `json:"overlap_hours"` // 轮换后旧密钥继续可用的小时数
+}
+
+// TokenRotationSetting 令牌密钥轮换与到期提醒配置
+type TokenRotationSetting struct {
+	DefaultOverlapHours int                            `json:"default_overlap_hours"` // 手动轮换未指定重叠时长时使用
+	MaxOverlapHours     int                            `json:"max_overlap_hours"`     // 允许的最长重叠时长
+	Groups              map[string]GroupRotationPolicy `json:"groups"`                // 按用户分组配置自动轮换
+	ExpiryNotifyDays    int                            `json:"expiry_notify_days"`    // 令牌到期前多少天提醒，0 表示不提醒
+}
+
+// 默认配置
+var tokenRotationSetting = TokenRotationSetting{
+	DefaultOverlapHours: 24,
+	MaxOverlapHours:     168,
+	Groups:              map[string]GroupRotationPolicy{},
+	ExpiryNotifyDays:    3,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("token_rotation_setting", &tokenRotationSetting)
+}
+
+func GetTokenRotationSetting() *TokenRotationSetting {
+	return &tokenRotationSetting
+}
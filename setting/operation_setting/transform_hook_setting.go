@@ -0,0 +1,84 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	TransformStagePreAuth      = "pre_auth"      // 鉴权前，可读写原始请求头与请求体
+	TransformStagePreRelay     = "pre_relay"     // 选择渠道后、转发上游前，可读写请求头与请求体
+	TransformStagePostResponse = "post_response" // 非流式响应返回客户端前，可读写响应头与响应体
+	TransformStagePostBilling  = "post_billing"  // 计费完成后异步执行，只读
+)
+
+var TransformStages = []string{
+	TransformStagePreAuth,
+	TransformStagePreRelay,
+	TransformStagePostResponse,
+	TransformStagePostBilling,
+}
+
+func IsValidTransformStage(stage string) bool {
+	return slices.Contains(TransformStages, stage)
+}
+
+// TransformHookConfig 一个挂载到指定阶段的转换器，Hook 为已注册的转换器名称
+type TransformHookConfig struct {
+	Name     string         `json:"name"`
+	Stage    string         `json:"stage"`
+	Hook     string         `json:"hook"`
+	Params   map[string]any `json:"params"`
+	Groups   []string       `json:"groups"`    // 为空时对所有分组生效，pre_auth 阶段分组未知，忽略该条件
+	Models   []string       `json:"models"`    // 为空时对所有模型生效，pre_auth 阶段模型未知，忽略该条件
+	FailOpen bool           `json:"fail_open"` // 转换器出错时继续处理请求，否则直接返回错误
+	Disabled bool           `json:"disabled"`
+}
+
+// Matches 判断转换器是否适用于当前分组与模型，空值表示该阶段尚不可知
+func (h *TransformHookConfig) Matches(group string, model string) bool {
+	if h.Disabled {
+		return false
+	}
+	if group != "" && len(h.Groups) > 0 && !slices.Contains(h.Groups, group) {
+		return false
+	}
+	if model != "" && len(h.Models) > 0 && !slices.Contains(h.Models, model) {
+		return false
+	}
+	return true
+}
+
+type TransformHookSetting struct {
+	Enabled bool                  `json:"enabled"`
+	Hooks   []TransformHookConfig `json:"hooks"` // 同一阶段按配置顺序依次执行
+}
+
+// 默认配置
+var transformHookSetting = TransformHookSetting{
+	Hooks: []TransformHookConfig{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("transform_hook_setting", &transformHookSetting)
+}
+
+func GetTransformHookSetting() *TransformHookSetting {
+	return &transformHookSetting
+}
+
+// StageHooks 返回指定阶段适用的转换器
+func (s *TransformHookSetting) StageHooks(stage string, group string, model string) []TransformHookConfig {
+	if !s.Enabled {
+		return nil
+	}
+	var hooks []TransformHookConfig
+	for i := range s.Hooks {
+		if s.Hooks[i].Stage == stage && s.Hooks[i].Matches(group, model) {
+			hooks = append(hooks, s.Hooks[i])
+		}
+	}
+	return hooks
+}
@@ -0,0 +1,94 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// UpstreamPoolPolicy 上游连接池参数，未配置的项沿用默认策略
+type UpstreamPoolPolicy struct {
+	MaxIdleConnsPerHost int   `json:"max_idle_conns_per_host,omitempty"` // 0 表示使用 RELAY_MAX_IDLE_CONNS_PER_HOST
+	MaxConnsPerHost     int   `json:"max_conns_per_host,omitempty"`      // 包括使用中的连接，0 表示不限制
+	IdleConnTimeout     int   `json:"idle_conn_timeout,omitempty"`       // 空闲连接保留时间，秒
+	HTTP2               *bool `json:"http2,omitempty"`
+	SessionResumption   *bool `json:"session_resumption,omitempty"` // 复用 TLS 会话票据，减少重新握手
+}
+
+// UpstreamPoolConfig 合并默认策略与域名策略后的连接池参数
+type UpstreamPoolConfig struct {
+	MaxIdleConnsPerHost int  `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int  `json:"max_conns_per_host"`
+	IdleConnTimeout     int  `json:"idle_conn_timeout"`
+	HTTP2               bool `json:"http2"`
+	SessionResumption   bool `json:"session_resumption"`
+}
+
+func (c UpstreamPoolConfig) apply(p UpstreamPoolPolicy) UpstreamPoolConfig {
+	if p.MaxIdleConnsPerHost > 0 {
+		c.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+	}
+	if p.MaxConnsPerHost > 0 {
+		c.MaxConnsPerHost = p.MaxConnsPerHost
+	}
+	if p.IdleConnTimeout > 0 {
+		c.IdleConnTimeout = p.IdleConnTimeout
+	}
+	if p.HTTP2 != nil {
+		c.HTTP2 = *p.HTTP2
+	}
+	if p.SessionResumption != nil {
+		c.SessionResumption = *p.SessionResumption
+	}
+	return c
+}
+
+type UpstreamPoolSetting struct {
+	// Isolate 每个上游域名使用独立的连接池，某个上游占满连接时不影响其他上游
+	Isolate bool               `json:"isolate"`
+	Default UpstreamPoolPolicy `json:"default"`
+	// 键为域名，同时匹配其子域名，多个命中时取最长的
+	Domains map[string]UpstreamPoolPolicy `json:"domains"`
+}
+
+// 默认配置
+var upstreamPoolSetting = UpstreamPoolSetting{
+	Isolate: true,
+	Default: UpstreamPoolPolicy{},
+	Domains: map[string]UpstreamPoolPolicy{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("upstream_pool_setting", &upstreamPoolSetting)
+}
+
+func GetUpstreamPoolSetting() *UpstreamPoolSetting {
+	return &upstreamPoolSetting
+}
+
+// Resolve 返回 host 的连接池参数，host 为空时只使用默认策略
+func (s *UpstreamPoolSetting) Resolve(host string) UpstreamPoolConfig {
+	config := UpstreamPoolConfig{
+		IdleConnTimeout:   90,
+		HTTP2:             true,
+		SessionResumption: true,
+	}.apply(s.Default)
+	if host == "" {
+		return config
+	}
+	host = strings.ToLower(host)
+	var matched UpstreamPoolPolicy
+	longest := -1
+	for domain, policy := range s.Domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "*."))
+		if len(domain) > longest && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			matched = policy
+			longest = len(domain)
+		}
+	}
+	if longest >= 0 {
+		config = config.apply(matched)
+	}
+	return config
+}
@@ -0,0 +1,59 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	UsageEventBackendKafka = "kafka"
+	UsageEventBackendNats  = "nats"
+
+	UsageEventFormatJSON = "json"
+	UsageEventFormatAvro = "avro"
+)
+
+// UsageEventSetting 将每次请求的用量记录发布到消息队列，供实时数据管道消费
+type UsageEventSetting struct {
+	Enabled bool   `json:"enabled"`
+	Backend string `json:"backend"` // kafka 或 nats
+	Format  string `json:"format"`  // json 或 avro
+	// Avro 格式下的 Schema Registry ID，大于 0 时按 Confluent 格式在消息前写入魔数与 ID
+	AvroSchemaId int `json:"avro_schema_id"`
+
+	KafkaBrokers  string `json:"kafka_brokers"` // 逗号分隔的 host:port
+	KafkaTopic    string `json:"kafka_topic"`
+	KafkaAcks     int    `json:"kafka_acks"` // 0、1 或 -1
+	KafkaTLS      bool   `json:"kafka_tls"`
+	KafkaUsername string `json:"kafka_username"` // 不为空时使用 SASL/PLAIN
+	KafkaPassword string `json:"kafka_password"`
+
+	NatsURL      string `json:"nats_url"` // 例如 nats://127.0.0.1:4222，tls:// 表示使用 TLS
+	NatsSubject  string `json:"nats_subject"`
+	NatsUsername string `json:"nats_username"`
+	NatsPassword string `json:"nats_password"`
+	NatsSecret   string `json:"nats_secret"` // token 认证时使用，与用户名密码二选一
+
+	BufferSize      int `json:"buffer_size"` // 内存队列长度，队列满时丢弃新事件，修改后重启生效
+	BatchSize       int `json:"batch_size"`
+	FlushIntervalMs int `json:"flush_interval_ms"`
+}
+
+// 默认配置
+var usageEventSetting = UsageEventSetting{
+	Enabled:         false,
+	Backend:         UsageEventBackendKafka,
+	Format:          UsageEventFormatJSON,
+	KafkaTopic:      "new-api.usage",
+	KafkaAcks:       1,
+	NatsSubject:     "new-api.usage",
+	BufferSize:      10000,
+	BatchSize:       200,
+	FlushIntervalMs: 1000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("usage_event_setting", &usageEventSetting)
+}
+
+func GetUsageEventSetting() *UsageEventSetting {
+	return &usageEventSetting
+}
@@ -0,0 +1,30 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// UsageRateLimitSetting TPM（每分钟 token 数，滑动窗口）与 RPD（每日请求数）限制，0 表示不限制
+type UsageRateLimitSetting struct {
+	Enabled  bool           `json:"enabled"`
+	TokenTPM int            `json:"token_tpm"` // 单个令牌
+	TokenRPD int            `json:"token_rpd"`
+	UserTPM  int            `json:"user_tpm"` // 单个用户的所有令牌合计
+	UserRPD  int            `json:"user_rpd"`
+	ModelTPM map[string]int `json:"model_tpm"` // 单个用户在指定模型上的合计
+	ModelRPD map[string]int `json:"model_rpd"`
+}
+
+// 默认配置
+var usageRateLimitSetting = UsageRateLimitSetting{
+	Enabled:  false,
+	ModelTPM: map[string]int{},
+	ModelRPD: map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("usage_rate_limit_setting", &usageRateLimitSetting)
+}
+
+func GetUsageRateLimitSetting() *UsageRateLimitSetting {
+	return &usageRateLimitSetting
+}
@@ -0,0 +1,59 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// VisionSetting 图片输入预处理配置：转发前下载 image_url、按上游限制缩放并转为 base64
+type VisionSetting struct {
+	Enabled            bool           `json:"enabled"`               // 是否启用图片预处理
+	ConvertUrlToBase64 bool           `json:"convert_url_to_base64"` // 是否将图片链接统一转为 base64 data URL，适用于无法访问外网的上游
+	MaxLongEdge        int            `json:"max_long_edge"`         // 图片最长边上限（像素），超过时等比缩放，0 表示不缩放
+	ModelMaxLongEdge   map[string]int `json:"model_max_long_edge"`   // 按模型名前缀覆盖最长边上限，取最长匹配前缀
+	JpegQuality        int            `json:"jpeg_quality"`          // 缩放后重新编码 JPEG 的质量（1-100）
+}
+
+// 默认配置
+var visionSetting = VisionSetting{
+	Enabled:            false,
+	ConvertUrlToBase64: false,
+	MaxLongEdge:        2048, // OpenAI 高精度模式会先缩放到 2048x2048 以内
+	ModelMaxLongEdge: map[string]int{
+		"claude": 1568, // Anthropic 建议最长边不超过 1568，超过时服务端会自动缩放
+		"gemini": 3072,
+	},
+	JpegQuality: 85,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("vision_setting", &visionSetting)
+}
+
+func GetVisionSetting() *VisionSetting {
+	return &visionSetting
+}
+
+// GetVisionMaxLongEdge 返回模型的图片最长边上限，0 表示不缩放
+func GetVisionMaxLongEdge(modelName string) int {
+	lowerModel := strings.ToLower(modelName)
+	maxLongEdge := visionSetting.MaxLongEdge
+	matchedLen := 0
+	for prefix, size := range visionSetting.ModelMaxLongEdge {
+		if len(prefix) > matchedLen && strings.HasPrefix(lowerModel, strings.ToLower(prefix)) {
+			maxLongEdge = size
+			matchedLen = len(prefix)
+		}
+	}
+	return max(maxLongEdge, 0)
+}
+
+// GetVisionJpegQuality 返回合法范围内的 JPEG 编码质量
+func GetVisionJpegQuality() int {
+	if visionSetting.JpegQuality <= 0 || visionSetting.JpegQuality > 100 {
+		return 85
+	}
+	return visionSetting.JpegQuality
+}
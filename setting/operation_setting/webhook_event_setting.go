@@ -0,0 +1,32 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// WebhookEventSetting 用户订阅的事件推送，与告警通知的 webhook 相互独立
+type WebhookEventSetting struct {
+	Enabled             bool `json:"enabled"`
+	MaxEndpointsPerUser int  `json:"max_endpoints_per_user"`
+	MaxAttempts         int  `json:"max_attempts"`       // 含首次投递，超过后标记为失败，仍可手动重新投递
+	TimeoutSeconds      int  `json:"timeout_seconds"`    // 单次投递的超时时间
+	RetentionDays       int  `json:"retention_days"`     // 投递记录保留天数，0 表示不清理
+	QuotaLowCooldown    int  `json:"quota_low_cooldown"` // 同一用户 quota.low 事件的最小间隔（分钟）
+}
+
+// 默认配置
+var webhookEventSetting = WebhookEventSetting{
+	Enabled:             false,
+	MaxEndpointsPerUser: 5,
+	MaxAttempts:         6,
+	TimeoutSeconds:      10,
+	RetentionDays:       7,
+	QuotaLowCooldown:    60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("webhook_event_setting", &webhookEventSetting)
+}
+
+func GetWebhookEventSetting() *WebhookEventSetting {
+	return &webhookEventSetting
+}
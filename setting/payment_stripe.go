@@ -6,3 +6,6 @@ var StripePriceId = ""
 var StripeUnitPrice = 8.0
 var StripeMinTopUp = 1
 var StripePromotionCodesEnabled = false
+
+// StripeQuotaPackages 固定价格的额度套餐，JSON 数组
+var StripeQuotaPackages = "[]"
@@ -0,0 +1,49 @@
+package ratio_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ImagePriceSetting 图片按 模型 + 尺寸 + 品质 分档定价（美元/张），优先于模型固定价格。
+// 内层键格式为 "尺寸/品质"，例如 "1024x1024/hd"；可只写尺寸（"1024x1024"）匹配任意品质，
+// "*/hd" 匹配任意尺寸，"*" 匹配所有请求。未配置的模型沿用原有计费方式
+type ImagePriceSetting struct {
+	TierPrices map[string]map[string]float64 `json:"tier_prices"`
+}
+
+var imagePriceSetting = ImagePriceSetting{
+	TierPrices: map[string]map[string]float64{},
+}
+
+func init() {
+	config.GlobalConfig.Register("image_price_setting", &imagePriceSetting)
+}
+
+func GetImagePriceSetting() *ImagePriceSetting {
+	return &imagePriceSetting
+}
+
+// GetImageTierPrice 按 尺寸/品质 → 尺寸 → */品质 → * 的顺序查找单张图片价格
+func GetImageTierPrice(modelName string, size string, quality string) (float64, bool) {
+	tiers, ok := imagePriceSetting.TierPrices[modelName]
+	if !ok || len(tiers) == 0 {
+		return 0, false
+	}
+	size = strings.ToLower(strings.TrimSpace(size))
+	quality = strings.ToLower(strings.TrimSpace(quality))
+	if quality == "" {
+		quality = "standard"
+	}
+	candidates := []string{"*/" + quality, "*"}
+	if size != "" {
+		candidates = append([]string{size + "/" + quality, size}, candidates...)
+	}
+	for _, key := range candidates {
+		if price, ok := tiers[key]; ok && price >= 0 {
+			return price, true
+		}
+	}
+	return 0, false
+}
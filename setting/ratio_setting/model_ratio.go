@@ -357,6 +357,11 @@ func InitRatioSettings() {
 	cacheRatioMap = defaultCacheRatio
 	cacheRatioMapMutex.Unlock()
 
+	// Initialize createCacheRatioMap
+	createCacheRatioMapMutex.Lock()
+	createCacheRatioMap = defaultCreateCacheRatio
+	createCacheRatioMapMutex.Unlock()
+
 	// initialize imageRatioMap
 	imageRatioMapMutex.Lock()
 	imageRatioMap = defaultImageRatio
@@ -371,6 +376,8 @@ func InitRatioSettings() {
 	audioCompletionRatioMapMutex.Lock()
 	audioCompletionRatioMap = defaultAudioCompletionRatio
 	audioCompletionRatioMapMutex.Unlock()
+
+	InvalidatePricingSnapshot()
 }
 
 func GetModelPriceMap() map[string]float64 {
@@ -397,6 +404,7 @@ func UpdateModelPriceByJSONString(jsonStr string) error {
 	err := json.Unmarshal([]byte(jsonStr), &modelPriceMap)
 	if err == nil {
 		InvalidateExposedDataCache()
+		InvalidatePricingSnapshot()
 	}
 	return err
 }
@@ -436,6 +444,7 @@ func UpdateModelRatioByJSONString(jsonStr string) error {
 	err := common.Unmarshal([]byte(jsonStr), &modelRatioMap)
 	if err == nil {
 		InvalidateExposedDataCache()
+		InvalidatePricingSnapshot()
 	}
 	return err
 }
@@ -449,6 +458,15 @@ func handleThinkingBudgetModel(name, prefix, wildcard string) string {
 }
 
 func GetModelRatio(name string) (float64, bool, string) {
+	ratio, ok, name := lookupModelRatio(name)
+	if !ok {
+		return ratio, operation_setting.SelfUseModeEnabled, name
+	}
+	return ratio, true, name
+}
+
+// lookupModelRatio 查找已配置的模型倍率，未配置时返回默认倍率与 false
+func lookupModelRatio(name string) (float64, bool, string) {
 	modelRatioMapMutex.RLock()
 	defer modelRatioMapMutex.RUnlock()
 
@@ -462,7 +480,7 @@ func GetModelRatio(name string) (float64, bool, string) {
 			}
 			//return 0, true, name
 		}
-		return 37.5, operation_setting.SelfUseModeEnabled, name
+		return 37.5, false, name
 	}
 	return ratio, true, name
 }
@@ -519,6 +537,7 @@ func UpdateCompletionRatioByJSONString(jsonStr string) error {
 	err := common.Unmarshal([]byte(jsonStr), &CompletionRatio)
 	if err == nil {
 		InvalidateExposedDataCache()
+		InvalidatePricingSnapshot()
 	}
 	return err
 }
@@ -741,7 +760,11 @@ func UpdateImageRatioByJSONString(jsonStr string) error {
 	imageRatioMapMutex.Lock()
 	defer imageRatioMapMutex.Unlock()
 	imageRatioMap = make(map[string]float64)
-	return common.Unmarshal([]byte(jsonStr), &imageRatioMap)
+	err := common.Unmarshal([]byte(jsonStr), &imageRatioMap)
+	if err == nil {
+		InvalidatePricingSnapshot()
+	}
+	return err
 }
 
 func GetImageRatio(name string) (float64, bool) {
@@ -774,6 +797,7 @@ func UpdateAudioRatioByJSONString(jsonStr string) error {
 	audioRatioMap = tmp
 	audioRatioMapMutex.Unlock()
 	InvalidateExposedDataCache()
+	InvalidatePricingSnapshot()
 	return nil
 }
 
@@ -796,6 +820,7 @@ func UpdateAudioCompletionRatioByJSONString(jsonStr string) error {
 	audioCompletionRatioMap = tmp
 	audioCompletionRatioMapMutex.Unlock()
 	InvalidateExposedDataCache()
+	InvalidatePricingSnapshot()
 	return nil
 }
 
@@ -0,0 +1,140 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// PricingRule 差异化定价：在指定时段内按倍率调整模型倍率或按次价格，可限定模型与实际服务的渠道。
+// 模型名支持以 * 结尾的前缀匹配；StartTime/EndTime 为 "HH:MM"，均为空表示全天，
+// StartTime 大于 EndTime 表示跨零点（例如 22:00-06:00）
+type PricingRule struct {
+	Name       string   `json:"name"`
+	Models     []string `json:"models"`      // 为空表示所有模型
+	ChannelIds []int    `json:"channel_ids"` // 为空表示所有渠道
+	Weekdays   []int    `json:"weekdays"`    // 0 为周日，为空表示每天
+	StartTime  string   `json:"start_time"`
+	EndTime    string   `json:"end_time"`
+	Ratio      float64  `json:"ratio"`
+}
+
+// PricingRuleSetting 按顺序匹配，命中第一条规则后不再继续
+type PricingRuleSetting struct {
+	Enabled  bool          `json:"enabled"`
+	Timezone string        `json:"timezone"` // 为空使用服务器时区
+	Rules    []PricingRule `json:"rules"`
+}
+
+// 默认配置
+var pricingRuleSetting = PricingRuleSetting{
+	Enabled: false,
+	Rules:   []PricingRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("pricing_rule_setting", &pricingRuleSetting)
+}
+
+func GetPricingRuleSetting() *PricingRuleSetting {
+	return &pricingRuleSetting
+}
+
+// parseClock 把 "HH:MM" 转为当天的分钟数
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("时间格式应为 HH:MM: %s", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (rule *PricingRule) matchModel(modelName string) bool {
+	if len(rule.Models) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Models {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(modelName, prefix) {
+				return true
+			}
+		} else if pattern == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *PricingRule) matchTime(now time.Time) bool {
+	if len(rule.Weekdays) > 0 && !slices.Contains(rule.Weekdays, int(now.Weekday())) {
+		return false
+	}
+	if rule.StartTime == "" && rule.EndTime == "" {
+		return true
+	}
+	start, err := parseClock(rule.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(rule.EndTime)
+	if err != nil {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// ValidatePricingRules 保存配置前校验
+func ValidatePricingRules(rules []PricingRule) error {
+	for i, rule := range rules {
+		if rule.Ratio < 0 {
+			return fmt.Errorf("第 %d 条定价规则的倍率不能为负数", i+1)
+		}
+		if rule.StartTime != "" || rule.EndTime != "" {
+			if _, err := parseClock(rule.StartTime); err != nil {
+				return fmt.Errorf("第 %d 条定价规则%s", i+1, err.Error())
+			}
+			if _, err := parseClock(rule.EndTime); err != nil {
+				return fmt.Errorf("第 %d 条定价规则%s", i+1, err.Error())
+			}
+		}
+		for _, weekday := range rule.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return fmt.Errorf("第 %d 条定价规则的星期应在 0 到 6 之间", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// MatchPricingRule 返回当前时间、模型与渠道命中的第一条定价规则
+func MatchPricingRule(modelName string, channelId int, now time.Time) (PricingRule, bool) {
+	setting := pricingRuleSetting
+	if !setting.Enabled || len(setting.Rules) == 0 {
+		return PricingRule{}, false
+	}
+	if setting.Timezone != "" {
+		if location, err := time.LoadLocation(setting.Timezone); err == nil {
+			now = now.In(location)
+		}
+	}
+	for i, rule := range setting.Rules {
+		if len(rule.ChannelIds) > 0 && !slices.Contains(rule.ChannelIds, channelId) {
+			continue
+		}
+		if rule.matchModel(modelName) && rule.matchTime(now) {
+			if rule.Name == "" {
+				rule.Name = fmt.Sprintf("#%d", i+1)
+			}
+			return rule, true
+		}
+	}
+	return PricingRule{}, false
+}
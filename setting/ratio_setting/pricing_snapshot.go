@@ -0,0 +1,143 @@
+package ratio_setting
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 计费时按模型名读取预先计算好的价格与倍率，避免每次请求逐项加锁查表与匹配模型名。
+// 任一价格或倍率更新后生成新版本的快照，并在后台预先计算已配置的模型
+
+// 请求中的模型名由用户提供，限制快照按需缓存的模型数量
+const maxPricingSnapshotModels = 10000
+
+// ModelPricing 单个模型的价格与各项倍率
+type ModelPricing struct {
+	ModelPrice float64
+	UsePrice   bool
+	ModelRatio float64
+	// RatioFound 为 false 时 ModelRatio 为默认值，是否允许使用取决于自用模式
+	RatioFound           bool
+	MatchName            string
+	CompletionRatio      float64
+	CacheRatio           float64
+	CreateCacheRatio     float64
+	ImageRatio           float64
+	AudioRatio           float64
+	AudioCompletionRatio float64
+}
+
+// RatioAvailable 模型倍率已配置或已开启自用模式
+func (p ModelPricing) RatioAvailable() bool {
+	return p.RatioFound || operation_setting.SelfUseModeEnabled
+}
+
+type pricingSnapshot struct {
+	version int64
+	models  sync.Map // 模型名 -> ModelPricing
+	size    atomic.Int64
+}
+
+var (
+	pricingSnapshotPtr  atomic.Pointer[pricingSnapshot]
+	pricingVersion      atomic.Int64
+	pricingSnapshotHits atomic.Int64
+	pricingSnapshotMiss atomic.Int64
+)
+
+func currentPricingSnapshot() *pricingSnapshot {
+	if snapshot := pricingSnapshotPtr.Load(); snapshot != nil {
+		return snapshot
+	}
+	snapshot := &pricingSnapshot{version: pricingVersion.Load()}
+	if pricingSnapshotPtr.CompareAndSwap(nil, snapshot) {
+		return snapshot
+	}
+	return pricingSnapshotPtr.Load()
+}
+
+// InvalidatePricingSnapshot 价格或倍率更新后调用，生成新版本的快照
+func InvalidatePricingSnapshot() {
+	snapshot := &pricingSnapshot{version: pricingVersion.Add(1)}
+	pricingSnapshotPtr.Store(snapshot)
+	gopool.Go(func() {
+		warmPricingSnapshot(snapshot)
+	})
+}
+
+func warmPricingSnapshot(snapshot *pricingSnapshot) {
+	names := make(map[string]struct{})
+	modelRatioMapMutex.RLock()
+	for name := range modelRatioMap {
+		names[name] = struct{}{}
+	}
+	modelRatioMapMutex.RUnlock()
+	modelPriceMapMutex.RLock()
+	for name := range modelPriceMap {
+		names[name] = struct{}{}
+	}
+	modelPriceMapMutex.RUnlock()
+	for name := range names {
+		if pricingSnapshotPtr.Load() != snapshot {
+			// 已有更新的快照
+			return
+		}
+		snapshot.store(name, computeModelPricing(name))
+	}
+}
+
+func (s *pricingSnapshot) store(name string, pricing ModelPricing) {
+	if s.size.Load() >= maxPricingSnapshotModels {
+		return
+	}
+	if _, loaded := s.models.LoadOrStore(name, pricing); !loaded {
+		s.size.Add(1)
+	}
+}
+
+func computeModelPricing(name string) ModelPricing {
+	pricing := ModelPricing{}
+	pricing.ModelPrice, pricing.UsePrice = GetModelPrice(name, false)
+	pricing.ModelRatio, pricing.RatioFound, pricing.MatchName = lookupModelRatio(name)
+	pricing.CompletionRatio = GetCompletionRatio(name)
+	pricing.CacheRatio, _ = GetCacheRatio(name)
+	pricing.CreateCacheRatio, _ = GetCreateCacheRatio(name)
+	pricing.ImageRatio, _ = GetImageRatio(name)
+	pricing.AudioRatio = GetAudioRatio(name)
+	pricing.AudioCompletionRatio = GetAudioCompletionRatio(name)
+	return pricing
+}
+
+// GetModelPricing 从当前版本的快照读取模型价格，未命中时计算后加入快照
+func GetModelPricing(name string) ModelPricing {
+	snapshot := currentPricingSnapshot()
+	if pricing, ok := snapshot.models.Load(name); ok {
+		pricingSnapshotHits.Add(1)
+		return pricing.(ModelPricing)
+	}
+	pricingSnapshotMiss.Add(1)
+	pricing := computeModelPricing(name)
+	snapshot.store(name, pricing)
+	return pricing
+}
+
+type PricingSnapshotStats struct {
+	Version int64 `json:"version"`
+	Models  int64 `json:"models"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+func GetPricingSnapshotStats() PricingSnapshotStats {
+	snapshot := currentPricingSnapshot()
+	return PricingSnapshotStats{
+		Version: snapshot.version,
+		Models:  snapshot.size.Load(),
+		Hits:    pricingSnapshotHits.Load(),
+		Misses:  pricingSnapshotMiss.Load(),
+	}
+}
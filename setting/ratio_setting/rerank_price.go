@@ -0,0 +1,30 @@
+package ratio_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RerankPriceSetting rerank 按文档数计费（美元/千文档），配置后优先于按 token 计费。
+// 适用于 Cohere 等按搜索单元收费的上游；Jina、Voyage 等按 token 收费的模型无需配置
+type RerankPriceSetting struct {
+	DocumentPrices map[string]float64 `json:"document_prices"`
+}
+
+var rerankPriceSetting = RerankPriceSetting{
+	DocumentPrices: map[string]float64{},
+}
+
+func init() {
+	config.GlobalConfig.Register("rerank_price_setting", &rerankPriceSetting)
+}
+
+func GetRerankPriceSetting() *RerankPriceSetting {
+	return &rerankPriceSetting
+}
+
+// GetRerankDocumentPrice 返回模型每千文档的价格，未配置时返回 false
+func GetRerankDocumentPrice(modelName string) (float64, bool) {
+	price, ok := rerankPriceSetting.DocumentPrices[modelName]
+	if !ok || price < 0 {
+		return 0, false
+	}
+	return price, true
+}
@@ -0,0 +1,23 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type AuditLogSettings struct {
+	Enabled       bool   `json:"enabled"`
+	WebhookURL    string `json:"webhook_url"`    // 可选，将每条审计记录推送到外部 SIEM
+	WebhookSecret string `json:"webhook_secret"` // 用于 X-Webhook-Signature 签名
+}
+
+// 默认配置
+var defaultAuditLogSettings = AuditLogSettings{
+	Enabled: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("audit_log", &defaultAuditLogSettings)
+}
+
+func GetAuditLogSettings() *AuditLogSettings {
+	return &defaultAuditLogSettings
+}
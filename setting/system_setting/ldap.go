@@ -0,0 +1,40 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type LDAPSettings struct {
+	Enabled              bool   `json:"enabled"`
+	URL                  string `json:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS             bool   `json:"start_tls"`
+	InsecureSkipVerify   bool   `json:"insecure_skip_verify"`
+	BindDN               string `json:"bind_dn"` // 用于搜索用户的服务账号，留空则匿名搜索
+	BindPassword         string `json:"bind_password"`
+	BaseDN               string `json:"base_dn"`
+	UserFilter           string `json:"user_filter"` // %s 替换为转义后的登录名
+	UsernameAttribute    string `json:"username_attribute"`
+	EmailAttribute       string `json:"email_attribute"`
+	DisplayNameAttribute string `json:"display_name_attribute"`
+	GroupAttribute       string `json:"group_attribute"`
+	GroupRoleMapping     string `json:"group_role_mapping"`     // JSON，组 DN 或组名 -> admin / common
+	DisablePasswordLogin bool   `json:"disable_password_login"` // LDAP 来源的账户禁止使用本地密码登录
+	SyncInterval         int    `json:"sync_interval"`          // 分钟，0 表示不定期同步组与角色
+}
+
+// 默认配置
+var defaultLDAPSettings = LDAPSettings{
+	UserFilter:           "(uid=%s)",
+	UsernameAttribute:    "uid",
+	EmailAttribute:       "mail",
+	DisplayNameAttribute: "cn",
+	GroupAttribute:       "memberOf",
+	SyncInterval:         60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("ldap", &defaultLDAPSettings)
+}
+
+func GetLDAPSettings() *LDAPSettings {
+	return &defaultLDAPSettings
+}
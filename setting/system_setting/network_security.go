@@ -0,0 +1,24 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type NetworkSecuritySettings struct {
+	RecordRejected    bool   `json:"record_rejected"`     // 记录因网络限制被拒绝的请求
+	GeoLookupURL      string `json:"geo_lookup_url"`      // IP 归属地查询接口，{ip} 会被替换为客户端 IP
+	NewLocationNotify bool   `json:"new_location_notify"` // 令牌在新的国家或 ASN 下使用时通知用户
+}
+
+// 默认配置
+var defaultNetworkSecuritySettings = NetworkSecuritySettings{
+	RecordRejected: true,
+	GeoLookupURL:   "https://ipapi.co/{ip}/json/",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("network_security", &defaultNetworkSecuritySettings)
+}
+
+func GetNetworkSecuritySettings() *NetworkSecuritySettings {
+	return &defaultNetworkSecuritySettings
+}
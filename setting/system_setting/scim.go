@@ -0,0 +1,24 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type SCIMSettings struct {
+	Enabled      bool   `json:"enabled"`
+	Secret       string `json:"secret"`        // 身份提供方调用 /scim/v2 时使用的 Bearer Token
+	GroupMapping string `json:"group_mapping"` // JSON，SCIM 组名 -> 网关用户分组，未配置的组名按同名分组处理
+	DefaultGroup string `json:"default_group"` // 用户被移出所有组后回到的分组
+}
+
+// 默认配置
+var defaultSCIMSettings = SCIMSettings{
+	DefaultGroup: "default",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("scim", &defaultSCIMSettings)
+}
+
+func GetSCIMSettings() *SCIMSettings {
+	return &defaultSCIMSettings
+}
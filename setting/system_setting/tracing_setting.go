@@ -0,0 +1,29 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TracingSetting OpenTelemetry 链路追踪配置
+type TracingSetting struct {
+	Enabled     bool              `json:"enabled"`
+	Endpoint    string            `json:"endpoint"`     // OTLP/HTTP 地址，例如 http://otel-collector:4318
+	Headers     map[string]string `json:"headers"`      // 发送给 collector 的额外请求头，例如鉴权
+	SampleRatio float64           `json:"sample_ratio"` // 采样比例 0-1，上游已采样的请求始终记录
+	ServiceName string            `json:"service_name"`
+}
+
+var defaultTracingSetting = TracingSetting{
+	Enabled:     false,
+	Endpoint:    "",
+	Headers:     map[string]string{},
+	SampleRatio: 1,
+	ServiceName: "new-api",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("tracing_setting", &defaultTracingSetting)
+}
+
+func GetTracingSetting() *TracingSetting {
+	return &defaultTracingSetting
+}
@@ -0,0 +1,38 @@
+package system_setting
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type TwoFASettings struct {
+	RequireForCommon bool `json:"require_for_common"`
+	RequireForAdmin  bool `json:"require_for_admin"`
+	RequireForRoot   bool `json:"require_for_root"`
+	// 丢失认证器且备用码用尽时，允许通过注册邮箱收到的验证码关闭两步验证
+	EmailRecoveryEnabled bool `json:"email_recovery_enabled"`
+}
+
+// 默认配置
+var defaultTwoFASettings = TwoFASettings{}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("twofa", &defaultTwoFASettings)
+}
+
+func GetTwoFASettings() *TwoFASettings {
+	return &defaultTwoFASettings
+}
+
+// IsRequired 该角色是否必须启用两步验证才能使用控制台
+func (s *TwoFASettings) IsRequired(role int) bool {
+	switch {
+	case role >= common.RoleRootUser:
+		return s.RequireForRoot
+	case role >= common.RoleAdminUser:
+		return s.RequireForAdmin
+	default:
+		return s.RequireForCommon
+	}
+}
@@ -40,7 +40,11 @@ type ErrorCode string
 const (
 	ErrorCodeInvalidRequest         ErrorCode = "invalid_request"
 	ErrorCodeSensitiveWordsDetected ErrorCode = "sensitive_words_detected"
+	ErrorCodeContentPolicyViolation ErrorCode = "content_policy_violation"
+	ErrorCodeModerationFailed       ErrorCode = "moderation_failed"
 	ErrorCodeViolationFeeGrokCSAM   ErrorCode = "violation_fee.grok.csam"
+	ErrorCodeRateLimitExceeded      ErrorCode = "rate_limit_exceeded"
+	ErrorCodeContextLengthExceeded  ErrorCode = "context_length_exceeded"
 
 	// new api error
 	ErrorCodeCountTokenFailed   ErrorCode = "count_token_failed"
@@ -85,6 +89,7 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeBudgetExceeded             ErrorCode = "budget_exceeded"
 )
 
 type NewAPIError struct {
@@ -24,6 +24,11 @@ type PriceData struct {
 	UsePrice             bool
 	QuotaToPreConsume    int // 预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+	// 差异化定价：ModelRatio/ModelPrice 为应用规则后的值，Base* 为规则生效前的值
+	PricingRule    string
+	PricingRatio   float64
+	BaseModelRatio float64
+	BaseModelPrice float64
 }
 
 func (p *PriceData) AddOtherRatio(key string, ratio float64) {
@@ -40,6 +45,9 @@ type PerCallPriceData struct {
 	ModelPrice     float64
 	Quota          int
 	GroupRatioInfo GroupRatioInfo
+	PricingRule    string
+	PricingRatio   float64
+	BaseModelPrice float64
 }
 
 func (p *PriceData) ToSetting() string {
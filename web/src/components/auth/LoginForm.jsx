@@ -96,6 +96,7 @@ const LoginForm = () => {
   const [linuxdoLoading, setLinuxdoLoading] = useState(false);
   const [emailLoginLoading, setEmailLoginLoading] = useState(false);
   const [loginLoading, setLoginLoading] = useState(false);
+  const [ldapLogin, setLdapLogin] = useState(false);
   const [resetPasswordLoading, setResetPasswordLoading] = useState(false);
   const [otherLoginOptionsLoading, setOtherLoginOptionsLoading] =
     useState(false);
@@ -216,8 +217,11 @@ const LoginForm = () => {
     setLoginLoading(true);
     try {
       if (username && password) {
+        const loginPath = ldapLogin
+          ? '/api/user/ldap/login'
+          : '/api/user/login';
         const res = await API.post(
-          `/api/user/login?turnstile=${turnstileToken}`,
+          `${loginPath}?turnstile=${turnstileToken}`,
           {
             username,
             password,
@@ -243,7 +247,7 @@ const LoginForm = () => {
               centered: true,
             });
           }
-          navigate('/console');
+          navigateAfterLogin(data);
         } else {
           showError(message);
         }
@@ -479,6 +483,16 @@ const LoginForm = () => {
     setUserData(data);
     updateAPI();
     showSuccess('登录成功！');
+    navigateAfterLogin(data);
+  };
+
+  // 角色要求启用两步验证但尚未设置时，先进入个人设置
+  const navigateAfterLogin = (data) => {
+    if (data && data.require_2fa_setup) {
+      showInfo(t('管理员要求启用两步验证，请先在个人设置中完成设置'));
+      navigate('/console/personal');
+      return;
+    }
     navigate('/console');
   };
 
@@ -752,6 +766,17 @@ const LoginForm = () => {
                   prefix={<IconLock />}
                 />
 
+                {status.ldap_login && (
+                  <Checkbox
+                    checked={ldapLogin}
+                    onChange={(e) => setLdapLogin(e.target.checked)}
+                  >
+                    <Text size='small' className='text-gray-600'>
+                      {t('使用 LDAP 账号登录')}
+                    </Text>
+                  </Checkbox>
+                )}
+
                 {(hasUserAgreement || hasPrivacyPolicy) && (
                   <div className='pt-4'>
                     <Checkbox
@@ -934,6 +959,7 @@ const LoginForm = () => {
           onSuccess={handle2FASuccess}
           onBack={handleBackToLogin}
           isModal={true}
+          allowEmailRecovery={status.twofa_email_recovery}
         />
       </Modal>
     );
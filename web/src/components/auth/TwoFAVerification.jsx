@@ -29,10 +29,60 @@ import React, { useState } from 'react';
 
 const { Title, Text, Paragraph } = Typography;
 
-const TwoFAVerification = ({ onSuccess, onBack, isModal = false }) => {
+const TwoFAVerification = ({
+  onSuccess,
+  onBack,
+  isModal = false,
+  allowEmailRecovery = false,
+}) => {
   const [loading, setLoading] = useState(false);
   const [useBackupCode, setUseBackupCode] = useState(false);
   const [verificationCode, setVerificationCode] = useState('');
+  const [useEmailRecovery, setUseEmailRecovery] = useState(false);
+  const [recoveryCode, setRecoveryCode] = useState('');
+  const [recoverySending, setRecoverySending] = useState(false);
+
+  const sendRecoveryEmail = async () => {
+    setRecoverySending(true);
+    try {
+      const res = await API.post('/api/user/login/2fa/recovery');
+      if (res.data.success) {
+        showSuccess(res.data.message);
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('发送失败，请重试');
+    } finally {
+      setRecoverySending(false);
+    }
+  };
+
+  const handleRecoverySubmit = async () => {
+    if (!recoveryCode) {
+      showError('请输入恢复验证码');
+      return;
+    }
+    setLoading(true);
+    try {
+      const res = await API.post('/api/user/login/2fa/recovery/verify', {
+        code: recoveryCode,
+      });
+      if (res.data.success) {
+        showSuccess('两步验证已关闭，请尽快重新设置');
+        localStorage.setItem('user', JSON.stringify(res.data.data));
+        if (onSuccess) {
+          onSuccess(res.data.data);
+        }
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('验证失败，请重试');
+    } finally {
+      setLoading(false);
+    }
+  };
 
   const handleSubmit = async () => {
     if (!verificationCode) {
@@ -77,6 +127,59 @@ const TwoFAVerification = ({ onSuccess, onBack, isModal = false }) => {
     }
   };
 
+  if (isModal && useEmailRecovery) {
+    return (
+      <div className='space-y-4'>
+        <Paragraph className='text-gray-600 dark:text-gray-300'>
+          恢复验证码将发送到账户绑定的邮箱，验证通过后两步验证会被关闭
+        </Paragraph>
+
+        <Form onSubmit={handleRecoverySubmit}>
+          <Form.Input
+            field='recovery_code'
+            label='恢复验证码'
+            placeholder='请输入邮箱收到的恢复验证码'
+            value={recoveryCode}
+            onChange={setRecoveryCode}
+            size='large'
+            style={{ marginBottom: 16 }}
+            suffix={
+              <Button
+                theme='borderless'
+                loading={recoverySending}
+                onClick={sendRecoveryEmail}
+              >
+                发送验证码
+              </Button>
+            }
+          />
+
+          <Button
+            htmlType='submit'
+            type='primary'
+            loading={loading}
+            block
+            size='large'
+            style={{ marginBottom: 16 }}
+          >
+            验证并登录
+          </Button>
+        </Form>
+
+        <div style={{ textAlign: 'center' }}>
+          <Button
+            theme='borderless'
+            type='tertiary'
+            onClick={() => setUseEmailRecovery(false)}
+            style={{ color: '#1890ff', padding: 0 }}
+          >
+            使用认证器验证码
+          </Button>
+        </div>
+      </div>
+    );
+  }
+
   if (isModal) {
     return (
       <div className='space-y-4'>
@@ -124,6 +227,17 @@ const TwoFAVerification = ({ onSuccess, onBack, isModal = false }) => {
             {useBackupCode ? '使用认证器验证码' : '使用备用码'}
           </Button>
 
+          {allowEmailRecovery && (
+            <Button
+              theme='borderless'
+              type='tertiary'
+              onClick={() => setUseEmailRecovery(true)}
+              style={{ marginRight: 16, color: '#1890ff', padding: 0 }}
+            >
+              通过邮箱恢复
+            </Button>
+          )}
+
           {onBack && (
             <Button
               theme='borderless'
@@ -190,14 +190,15 @@ const CustomOAuthSetting = ({ serverAddress }) => {
 
   const handleSubmit = async () => {
     // Validate required fields
-    const requiredFields = [
-      'name',
-      'slug',
-      'client_id',
-      'authorization_endpoint',
-      'token_endpoint',
-      'user_info_endpoint',
-    ];
+    const requiredFields = ['name', 'slug', 'client_id'];
+    // 配置了 Issuer 或 Well-Known 时，留空的端点由后端从 Discovery 文档补全
+    if (!formValues.issuer && !formValues.well_known) {
+      requiredFields.push(
+        'authorization_endpoint',
+        'token_endpoint',
+        'user_info_endpoint',
+      );
+    }
     
     if (!editingProvider) {
       requiredFields.push('client_secret');
@@ -504,9 +505,6 @@ const CustomOAuthSetting = ({ serverAddress }) => {
                         OAUTH_PRESETS[selectedPreset].authorization_endpoint
                       : 'https://example.com/oauth/authorize'
                   }
-                  rules={[
-                    { required: true, message: t('请输入 Authorization Endpoint') },
-                  ]}
                 />
               </Col>
             </Row>
@@ -521,7 +519,6 @@ const CustomOAuthSetting = ({ serverAddress }) => {
                       ? t('自动生成：') + OAUTH_PRESETS[selectedPreset].token_endpoint
                       : 'https://example.com/oauth/token'
                   }
-                  rules={[{ required: true, message: t('请输入 Token Endpoint') }]}
                 />
               </Col>
               <Col span={12}>
@@ -533,9 +530,6 @@ const CustomOAuthSetting = ({ serverAddress }) => {
                       ? t('自动生成：') + OAUTH_PRESETS[selectedPreset].user_info_endpoint
                       : 'https://example.com/api/user'
                   }
-                  rules={[
-                    { required: true, message: t('请输入 User Info Endpoint') },
-                  ]}
                 />
               </Col>
             </Row>
@@ -557,6 +551,19 @@ const CustomOAuthSetting = ({ serverAddress }) => {
               </Col>
             </Row>
 
+            <Row gutter={16}>
+              <Col span={24}>
+                <Form.Input
+                  field="issuer"
+                  label={t('Issuer')}
+                  placeholder='https://sso.example.com/realms/main'
+                  extraText={t(
+                    '填写 Issuer 或 Well-Known URL 后，留空的端点将从 Discovery 文档自动获取',
+                  )}
+                />
+              </Col>
+            </Row>
+
             <Text strong style={{ display: 'block', margin: '16px 0 8px' }}>
               {t('字段映射')}
             </Text>
@@ -599,6 +606,25 @@ const CustomOAuthSetting = ({ serverAddress }) => {
               </Col>
             </Row>
 
+            <Row gutter={16}>
+              <Col span={12}>
+                <Form.Input
+                  field="group_field"
+                  label={t('分组字段')}
+                  placeholder={t('例如：groups、roles')}
+                />
+              </Col>
+              <Col span={12}>
+                <Form.TextArea
+                  field="group_mapping"
+                  label={t('分组映射')}
+                  placeholder='{"admins": "vip", "staff": "default"}'
+                  extraText={t('首次登录创建账号时，按字段值映射到分组')}
+                  autosize={{ minRows: 1, maxRows: 4 }}
+                />
+              </Col>
+            </Row>
+
             <Text strong style={{ display: 'block', margin: '16px 0 8px' }}>
               {t('高级选项')}
             </Text>
@@ -621,6 +647,19 @@ const CustomOAuthSetting = ({ serverAddress }) => {
                 </Form.Checkbox>
               </Col>
             </Row>
+
+            <Row gutter={16}>
+              <Col span={12}>
+                <Form.Checkbox field="use_pkce" noLabel>
+                  {t('启用 PKCE')}
+                </Form.Checkbox>
+              </Col>
+              <Col span={12}>
+                <Form.Checkbox field="auto_provision" noLabel>
+                  {t('关闭注册时仍自动创建账号')}
+                </Form.Checkbox>
+              </Col>
+            </Row>
           </Form>
         </Modal>
       </Form.Section>
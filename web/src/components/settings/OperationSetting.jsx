@@ -23,6 +23,18 @@ import SettingsGeneral from '../../pages/Setting/Operation/SettingsGeneral';
 import SettingsHeaderNavModules from '../../pages/Setting/Operation/SettingsHeaderNavModules';
 import SettingsSidebarModulesAdmin from '../../pages/Setting/Operation/SettingsSidebarModulesAdmin';
 import SettingsSensitiveWords from '../../pages/Setting/Operation/SettingsSensitiveWords';
+import SettingsModeration from '../../pages/Setting/Operation/SettingsModeration';
+import SettingsPII from '../../pages/Setting/Operation/SettingsPII';
+import SettingsGuardrail from '../../pages/Setting/Operation/SettingsGuardrail';
+import SettingsParamPolicy from '../../pages/Setting/Operation/SettingsParamPolicy';
+import SettingsTransformHooks from '../../pages/Setting/Operation/SettingsTransformHooks';
+import SettingsContextLimit from '../../pages/Setting/Operation/SettingsContextLimit';
+import SettingsRelayRace from '../../pages/Setting/Operation/SettingsRelayRace';
+import SettingsCanary from '../../pages/Setting/Operation/SettingsCanary';
+import SettingsQuotaTransfer from '../../pages/Setting/Operation/SettingsQuotaTransfer';
+import SettingsCurrency from '../../pages/Setting/Operation/SettingsCurrency';
+import SettingsWebhookEvent from '../../pages/Setting/Operation/SettingsWebhookEvent';
+import SettingsUsageEvent from '../../pages/Setting/Operation/SettingsUsageEvent';
 import SettingsLog from '../../pages/Setting/Operation/SettingsLog';
 import SettingsMonitoring from '../../pages/Setting/Operation/SettingsMonitoring';
 import SettingsCreditLimit from '../../pages/Setting/Operation/SettingsCreditLimit';
@@ -61,6 +73,47 @@ const OperationSetting = () => {
     CheckSensitiveOnPromptEnabled: false,
     SensitiveWords: '',
 
+    /* 内容审核设置 */
+    'moderation_setting.enabled': false,
+    'moderation_setting.fail_open': true,
+    'moderation_setting.notify_admins': false,
+
+    /* 个人信息脱敏设置 */
+    'pii_setting.enabled': false,
+    'pii_setting.restore': false,
+
+    /* 护栏提示词设置 */
+    'guardrail_setting.enabled': false,
+
+    /* 采样参数策略设置 */
+    'param_policy_setting.enabled': false,
+
+    /* 请求转换器设置 */
+    'transform_hook_setting.enabled': false,
+
+    /* 上下文长度检查设置 */
+    'context_limit_setting.enabled': false,
+
+    /* 竞速模式设置 */
+    'relay_race_setting.enabled': false,
+
+    /* 灰度渠道评估设置 */
+    'canary_setting.auto_evaluate_enabled': false,
+
+    /* 用户转账设置 */
+    'quota_transfer_setting.enabled': false,
+
+    /* 多币种展示设置 */
+    'currency_setting.enabled': false,
+    'currency_setting.auto_fetch_enabled': false,
+
+    /* 事件推送设置 */
+    'webhook_event_setting.enabled': false,
+
+    /* 用量事件发布设置 */
+    'usage_event_setting.enabled': false,
+    'usage_event_setting.kafka_tls': false,
+
     /* 日志设置 */
     LogConsumeEnabled: false,
 
@@ -135,6 +188,54 @@ const OperationSetting = () => {
         <Card style={{ marginTop: '10px' }}>
           <SettingsSensitiveWords options={inputs} refresh={onRefresh} />
         </Card>
+        {/* 内容审核设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsModeration options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 个人信息脱敏设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsPII options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 护栏提示词设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsGuardrail options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 采样参数策略设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsParamPolicy options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 请求转换器设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsTransformHooks options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 上下文长度检查设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsContextLimit options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 竞速模式设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsRelayRace options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 灰度渠道评估设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsCanary options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 用户转账设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsQuotaTransfer options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 多币种展示设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsCurrency options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 事件推送设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsWebhookEvent options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 用量事件发布设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsUsageEvent options={inputs} refresh={onRefresh} />
+        </Card>
         {/* 日志设置 */}
         <Card style={{ marginTop: '10px' }}>
           <SettingsLog options={inputs} refresh={onRefresh} />
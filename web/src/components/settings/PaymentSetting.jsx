@@ -47,6 +47,7 @@ const PaymentSetting = () => {
     StripeUnitPrice: 8.0,
     StripeMinTopUp: 1,
     StripePromotionCodesEnabled: false,
+    StripeQuotaPackages: '[]',
   });
 
   let [loading, setLoading] = useState(false);
@@ -39,6 +39,7 @@ import {
   showError,
   showSuccess,
   toBoolean,
+  verifyJSON,
 } from '../../helpers';
 import axios from 'axios';
 import { useTranslation } from 'react-i18next';
@@ -63,6 +64,35 @@ const SystemSetting = () => {
     'oidc.authorization_endpoint': '',
     'oidc.token_endpoint': '',
     'oidc.user_info_endpoint': '',
+    'ldap.enabled': false,
+    'ldap.url': '',
+    'ldap.start_tls': false,
+    'ldap.insecure_skip_verify': false,
+    'ldap.bind_dn': '',
+    'ldap.bind_password': '',
+    'ldap.base_dn': '',
+    'ldap.user_filter': '',
+    'ldap.username_attribute': '',
+    'ldap.email_attribute': '',
+    'ldap.display_name_attribute': '',
+    'ldap.group_attribute': '',
+    'ldap.group_role_mapping': '',
+    'ldap.disable_password_login': false,
+    'ldap.sync_interval': 60,
+    'scim.enabled': false,
+    'twofa.require_for_common': false,
+    'twofa.require_for_admin': false,
+    'twofa.require_for_root': false,
+    'twofa.email_recovery_enabled': false,
+    'network_security.record_rejected': true,
+    'network_security.new_location_notify': false,
+    'network_security.geo_lookup_url': '',
+    'audit_log.enabled': true,
+    'audit_log.webhook_url': '',
+    'audit_log.webhook_secret': '',
+    'scim.secret': '',
+    'scim.group_mapping': '',
+    'scim.default_group': '',
     Notice: '',
     SMTPServer: '',
     SMTPPort: '',
@@ -109,6 +139,12 @@ const SystemSetting = () => {
     'fetch_setting.ip_list': [],
     'fetch_setting.allowed_ports': [],
     'fetch_setting.apply_ip_filter_for_domain': false,
+    // 链路追踪配置
+    'tracing_setting.enabled': false,
+    'tracing_setting.endpoint': '',
+    'tracing_setting.headers': '',
+    'tracing_setting.sample_ratio': 1,
+    'tracing_setting.service_name': 'new-api',
   });
 
   const [originInputs, setOriginInputs] = useState({});
@@ -185,9 +221,22 @@ const SystemSetting = () => {
           case 'LinuxDOOAuthEnabled':
           case 'discord.enabled':
           case 'oidc.enabled':
+          case 'ldap.enabled':
+          case 'ldap.start_tls':
+          case 'ldap.insecure_skip_verify':
+          case 'ldap.disable_password_login':
+          case 'scim.enabled':
+          case 'twofa.require_for_common':
+          case 'twofa.require_for_admin':
+          case 'twofa.require_for_root':
+          case 'twofa.email_recovery_enabled':
+          case 'network_security.record_rejected':
+          case 'network_security.new_location_notify':
+          case 'audit_log.enabled':
           case 'passkey.enabled':
           case 'passkey.allow_insecure_origin':
           case 'WorkerAllowHttpImageRequestEnabled':
+          case 'tracing_setting.enabled':
             item.value = toBoolean(item.value);
             break;
           case 'passkey.origins':
@@ -204,8 +253,12 @@ const SystemSetting = () => {
             // 确保有默认值
             item.value = item.value || 'preferred';
             break;
+          case 'ldap.sync_interval':
+            item.value = parseInt(item.value);
+            break;
           case 'Price':
           case 'MinTopUp':
+          case 'tracing_setting.sample_ratio':
             item.value = parseFloat(item.value);
             break;
           default:
@@ -400,6 +453,33 @@ const SystemSetting = () => {
     }
   };
 
+  const submitTracing = async () => {
+    const headers = (inputs['tracing_setting.headers'] || '').trim();
+    if (headers !== '' && !verifyJSON(headers)) {
+      showError(t('请求头不是合法的 JSON 对象'));
+      return;
+    }
+    await updateOptions([
+      {
+        key: 'tracing_setting.enabled',
+        value: inputs['tracing_setting.enabled'],
+      },
+      {
+        key: 'tracing_setting.endpoint',
+        value: removeTrailingSlash(inputs['tracing_setting.endpoint'] || ''),
+      },
+      { key: 'tracing_setting.headers', value: headers || '{}' },
+      {
+        key: 'tracing_setting.sample_ratio',
+        value: String(inputs['tracing_setting.sample_ratio'] ?? 1),
+      },
+      {
+        key: 'tracing_setting.service_name',
+        value: inputs['tracing_setting.service_name'] || 'new-api',
+      },
+    ]);
+  };
+
   const handleAddEmail = () => {
     if (emailToAdd && emailToAdd.trim() !== '') {
       const domain = emailToAdd.trim();
@@ -578,6 +658,107 @@ const SystemSetting = () => {
     }
   };
 
+  const submitLDAPSettings = async () => {
+    if (inputs['ldap.group_role_mapping'] !== '') {
+      try {
+        JSON.parse(inputs['ldap.group_role_mapping']);
+      } catch (e) {
+        showError(t('组角色映射不是合法的 JSON'));
+        return;
+      }
+    }
+    const options = [];
+    [
+      'ldap.url',
+      'ldap.start_tls',
+      'ldap.insecure_skip_verify',
+      'ldap.bind_dn',
+      'ldap.base_dn',
+      'ldap.user_filter',
+      'ldap.username_attribute',
+      'ldap.email_attribute',
+      'ldap.display_name_attribute',
+      'ldap.group_attribute',
+      'ldap.group_role_mapping',
+      'ldap.disable_password_login',
+      'ldap.sync_interval',
+    ].forEach((key) => {
+      if (originInputs[key] !== inputs[key]) {
+        options.push({ key, value: inputs[key] });
+      }
+    });
+    if (
+      originInputs['ldap.bind_password'] !== inputs['ldap.bind_password'] &&
+      inputs['ldap.bind_password'] !== ''
+    ) {
+      options.push({
+        key: 'ldap.bind_password',
+        value: inputs['ldap.bind_password'],
+      });
+    }
+
+    if (options.length > 0) {
+      await updateOptions(options);
+    }
+  };
+
+  const submitSCIMSettings = async () => {
+    if (inputs['scim.group_mapping'] !== '') {
+      try {
+        JSON.parse(inputs['scim.group_mapping']);
+      } catch (e) {
+        showError(t('组映射不是合法的 JSON'));
+        return;
+      }
+    }
+    const options = [];
+    ['scim.enabled', 'scim.group_mapping', 'scim.default_group'].forEach(
+      (key) => {
+        if (originInputs[key] !== inputs[key]) {
+          options.push({ key, value: inputs[key] });
+        }
+      },
+    );
+    if (
+      originInputs['scim.secret'] !== inputs['scim.secret'] &&
+      inputs['scim.secret'] !== ''
+    ) {
+      options.push({ key: 'scim.secret', value: inputs['scim.secret'] });
+    }
+
+    if (options.length > 0) {
+      await updateOptions(options);
+    }
+  };
+
+  const submitNetworkSecuritySettings = async () => {
+    const key = 'network_security.geo_lookup_url';
+    if (originInputs[key] !== inputs[key]) {
+      await updateOptions([{ key, value: inputs[key] }]);
+    }
+  };
+
+  const submitAuditLogSettings = async () => {
+    const options = [];
+    if (
+      originInputs['audit_log.webhook_url'] !== inputs['audit_log.webhook_url']
+    ) {
+      options.push({
+        key: 'audit_log.webhook_url',
+        value: inputs['audit_log.webhook_url'],
+      });
+    }
+    if (inputs['audit_log.webhook_secret'] !== '') {
+      options.push({
+        key: 'audit_log.webhook_secret',
+        value: inputs['audit_log.webhook_secret'],
+      });
+    }
+    if (options.length > 0) {
+      await updateOptions(options);
+    }
+  };
+
   const submitTelegramSettings = async () => {
     const options = [
       { key: 'TelegramBotToken', value: inputs.TelegramBotToken },
@@ -782,6 +963,60 @@ const SystemSetting = () => {
                 </Form.Section>
               </Card>
 
+              <Card>
+                <Form.Section text={t('链路追踪设置')}>
+                  <Text>
+                    {t(
+                      '通过 OpenTelemetry 上报中继请求各阶段（鉴权、渠道分发、适配器、上游请求、计费）的耗时，并向上游透传 traceparent',
+                    )}
+                  </Text>
+                  <Form.Checkbox field='tracing_setting.enabled' noLabel>
+                    {t('启用链路追踪')}
+                  </Form.Checkbox>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field='tracing_setting.endpoint'
+                        label={t('OTLP 地址')}
+                        placeholder='http://otel-collector:4318'
+                        extraText={t(
+                          'OTLP/HTTP 协议，未填写路径时使用 /v1/traces',
+                        )}
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={6} lg={6} xl={6}>
+                      <Form.InputNumber
+                        field='tracing_setting.sample_ratio'
+                        label={t('采样比例')}
+                        min={0}
+                        max={1}
+                        step={0.1}
+                        extraText={t('0-1，调用方已采样的请求始终记录')}
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={6} lg={6} xl={6}>
+                      <Form.Input
+                        field='tracing_setting.service_name'
+                        label={t('服务名')}
+                        placeholder='new-api'
+                      />
+                    </Col>
+                  </Row>
+                  <Form.TextArea
+                    field='tracing_setting.headers'
+                    label={t('请求头')}
+                    placeholder='{"Authorization": "Bearer xxx"}'
+                    extraText={t('发送给 collector 的额外请求头，JSON 格式')}
+                    autosize
+                  />
+                  <Button onClick={submitTracing}>
+                    {t('更新链路追踪设置')}
+                  </Button>
+                </Form.Section>
+              </Card>
+
               <Card>
                 <Form.Section text={t('SSRF防护设置')}>
                   <Text extraText={t('SSRF防护详细说明')}>
@@ -1089,6 +1324,15 @@ const SystemSetting = () => {
                       >
                         {t('允许通过 OIDC 进行登录')}
                       </Form.Checkbox>
+                      <Form.Checkbox
+                        field="['ldap.enabled']"
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange('ldap.enabled', e)
+                        }
+                      >
+                        {t('允许通过 LDAP 进行登录')}
+                      </Form.Checkbox>
                     </Col>
                   </Row>
                 </Form.Section>
@@ -1223,6 +1467,163 @@ const SystemSetting = () => {
                 </Form.Section>
               </Card>
 
+              <Card>
+                <Form.Section text={t('配置两步验证')}>
+                  <Text>
+                    {t(
+                      '可要求指定角色必须启用两步验证，未启用的账户登录后只能访问个人设置',
+                    )}
+                  </Text>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                    style={{ marginTop: 16 }}
+                  >
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Checkbox
+                        field="['twofa.require_for_root']"
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange('twofa.require_for_root', e)
+                        }
+                      >
+                        {t('超级管理员必须启用两步验证')}
+                      </Form.Checkbox>
+                      <Form.Checkbox
+                        field="['twofa.require_for_admin']"
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange('twofa.require_for_admin', e)
+                        }
+                      >
+                        {t('管理员必须启用两步验证')}
+                      </Form.Checkbox>
+                      <Form.Checkbox
+                        field="['twofa.require_for_common']"
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange('twofa.require_for_common', e)
+                        }
+                      >
+                        {t('普通用户必须启用两步验证')}
+                      </Form.Checkbox>
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Checkbox
+                        field="['twofa.email_recovery_enabled']"
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange(
+                            'twofa.email_recovery_enabled',
+                            e,
+                          )
+                        }
+                      >
+                        {t('允许通过注册邮箱恢复两步验证')}
+                      </Form.Checkbox>
+                    </Col>
+                  </Row>
+                </Form.Section>
+              </Card>
+
+              <Card>
+                <Form.Section text={t('配置令牌网络安全')}>
+                  <Text>
+                    {t(
+                      '令牌与用户可配置 IP 白名单和黑名单，反向代理部署时请通过 TRUSTED_PROXIES 环境变量指定可信代理以获取真实 IP',
+                    )}
+                  </Text>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                    style={{ marginTop: 16 }}
+                  >
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Checkbox
+                        field="['network_security.record_rejected']"
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange(
+                            'network_security.record_rejected',
+                            e,
+                          )
+                        }
+                      >
+                        {t('记录因 IP 限制被拒绝的请求')}
+                      </Form.Checkbox>
+                      <Form.Checkbox
+                        field="['network_security.new_location_notify']"
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange(
+                            'network_security.new_location_notify',
+                            e,
+                          )
+                        }
+                      >
+                        {t('令牌在新的国家或 ASN 下使用时通知用户')}
+                      </Form.Checkbox>
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['network_security.geo_lookup_url']"
+                        label={t('IP 归属地查询接口')}
+                        placeholder='https://ipapi.co/{ip}/json/'
+                        extraText={t(
+                          '{ip} 会被替换为客户端 IP，支持 ipapi.co、ip-api.com、ipinfo.io 的返回格式',
+                        )}
+                      />
+                    </Col>
+                  </Row>
+                  <Button onClick={submitNetworkSecuritySettings}>
+                    {t('保存网络安全设置')}
+                  </Button>
+                </Form.Section>
+              </Card>
+
+              <Card>
+                <Form.Section text={t('配置审计日志')}>
+                  <Text>
+                    {t(
+                      '记录管理员通过管理接口进行的所有新增、修改与删除操作，可选推送到外部 SIEM',
+                    )}
+                  </Text>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                    style={{ marginTop: 16 }}
+                  >
+                    <Col xs={24} sm={24} md={24} lg={24} xl={24}>
+                      <Form.Checkbox
+                        field="['audit_log.enabled']"
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange('audit_log.enabled', e)
+                        }
+                      >
+                        {t('启用审计日志')}
+                      </Form.Checkbox>
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['audit_log.webhook_url']"
+                        label={t('审计日志推送地址')}
+                        placeholder='https://siem.example.com/webhook'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['audit_log.webhook_secret']"
+                        label={t('审计日志推送密钥')}
+                        type='password'
+                        placeholder={t('敏感信息不会发送到前端显示')}
+                        extraText={t('用于生成 X-Webhook-Signature 签名')}
+                      />
+                    </Col>
+                  </Row>
+                  <Button onClick={submitAuditLogSettings}>
+                    {t('保存审计日志设置')}
+                  </Button>
+                </Form.Section>
+              </Card>
+
               <Card>
                 <Form.Section text={t('配置邮箱域名白名单')}>
                   <Text>{t('用以防止恶意用户利用临时邮箱批量注册')}</Text>
@@ -1417,6 +1818,192 @@ const SystemSetting = () => {
                   </Button>
                 </Form.Section>
               </Card>
+              <Card>
+                <Form.Section text={t('配置 LDAP')}>
+                  <Text>
+                    {t(
+                      '用以支持通过 LDAP / Active Directory 账号登录，首次登录时自动创建账户',
+                    )}
+                  </Text>
+                  <Banner
+                    type='info'
+                    description={t(
+                      '用户过滤器中的 %s 会替换为登录名，例如 (uid=%s)，Active Directory 可使用 (sAMAccountName=%s)',
+                    )}
+                    style={{ marginBottom: 20, marginTop: 16 }}
+                  />
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['ldap.url']"
+                        label={t('服务器地址')}
+                        placeholder='ldaps://ldap.example.com:636'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['ldap.base_dn']"
+                        label={t('Base DN')}
+                        placeholder='dc=example,dc=com'
+                      />
+                    </Col>
+                  </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['ldap.bind_dn']"
+                        label={t('Bind DN')}
+                        placeholder={t('留空则匿名搜索用户')}
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['ldap.bind_password']"
+                        label={t('Bind 密码')}
+                        type='password'
+                        placeholder={t('敏感信息不会发送到前端显示')}
+                      />
+                    </Col>
+                  </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['ldap.user_filter']"
+                        label={t('用户过滤器')}
+                        placeholder='(uid=%s)'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['ldap.username_attribute']"
+                        label={t('用户名属性')}
+                        placeholder='uid'
+                      />
+                    </Col>
+                  </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field="['ldap.email_attribute']"
+                        label={t('邮箱属性')}
+                        placeholder='mail'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field="['ldap.display_name_attribute']"
+                        label={t('显示名称属性')}
+                        placeholder='cn'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field="['ldap.group_attribute']"
+                        label={t('组属性')}
+                        placeholder='memberOf'
+                      />
+                    </Col>
+                  </Row>
+                  <Form.TextArea
+                    field="['ldap.group_role_mapping']"
+                    label={t('组角色映射')}
+                    placeholder='{"cn=admins,ou=groups,dc=example,dc=com": "admin"}'
+                    extraText={t(
+                      'JSON 格式，键为组 DN 或组名，值为 admin 或 common；留空则不根据组调整角色',
+                    )}
+                    autosize
+                  />
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.InputNumber
+                        field="['ldap.sync_interval']"
+                        label={t('组同步间隔（分钟）')}
+                        extraText={t('0 表示不定期同步')}
+                        min={0}
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Checkbox field="['ldap.start_tls']" noLabel>
+                        {t('使用 StartTLS')}
+                      </Form.Checkbox>
+                      <Form.Checkbox
+                        field="['ldap.insecure_skip_verify']"
+                        noLabel
+                      >
+                        {t('跳过 TLS 证书校验')}
+                      </Form.Checkbox>
+                      <Form.Checkbox
+                        field="['ldap.disable_password_login']"
+                        noLabel
+                      >
+                        {t('禁止 LDAP 账户使用本地密码登录')}
+                      </Form.Checkbox>
+                    </Col>
+                  </Row>
+                  <Button onClick={submitLDAPSettings}>
+                    {t('保存 LDAP 设置')}
+                  </Button>
+                </Form.Section>
+              </Card>
+              <Card>
+                <Form.Section text={t('配置 SCIM')}>
+                  <Text>
+                    {t(
+                      '用以支持 Okta、Azure AD 等身份提供方通过 SCIM 2.0 自动创建、停用用户并分配分组',
+                    )}
+                  </Text>
+                  <Banner
+                    type='info'
+                    description={`${t('SCIM 地址填')} ${inputs.ServerAddress ? inputs.ServerAddress : t('网站地址')}/scim/v2，${t('停用用户时会同时禁用其全部令牌')}`}
+                    style={{ marginBottom: 20, marginTop: 16 }}
+                  />
+                  <Form.Checkbox field="['scim.enabled']" noLabel>
+                    {t('启用 SCIM 接口')}
+                  </Form.Checkbox>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['scim.secret']"
+                        label={t('Bearer Token')}
+                        type='password'
+                        placeholder={t('敏感信息不会发送到前端显示')}
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                      <Form.Input
+                        field="['scim.default_group']"
+                        label={t('默认分组')}
+                        placeholder='default'
+                        extraText={t('新建用户和被移出组的用户所在的分组')}
+                      />
+                    </Col>
+                  </Row>
+                  <Form.TextArea
+                    field="['scim.group_mapping']"
+                    label={t('组映射')}
+                    placeholder='{"Engineering": "vip"}'
+                    extraText={t(
+                      'JSON 格式，键为身份提供方中的组名，值为网关分组；未配置的组名按同名分组处理',
+                    )}
+                    autosize
+                  />
+                  <Button onClick={submitSCIMSettings}>
+                    {t('保存 SCIM 设置')}
+                  </Button>
+                </Form.Section>
+              </Card>
 
               <Card>
                 <Form.Section text={t('配置 GitHub OAuth App')}>
@@ -94,6 +94,14 @@ const REGION_EXAMPLE = {
   'claude-3-5-sonnet-20240620': 'europe-west1',
 };
 
+// 渠道级超时与重试设置，未填写时使用模型或全局设置
+const CHANNEL_TIMEOUT_KEYS = [
+  'connect_timeout',
+  'request_timeout',
+  'stream_idle_timeout',
+  'max_retries',
+];
+
 // 支持并且已适配通过接口获取模型列表的渠道类型
 const MODEL_FETCHABLE_TYPES = new Set([
   1, 4, 14, 34, 17, 26, 27, 24, 47, 25, 20, 23, 31, 40, 42, 48, 43,
@@ -150,6 +158,7 @@ const EditChannelModal = (props) => {
     groups: ['default'],
     priority: 0,
     weight: 0,
+    canary_percent: 0,
     tag: '',
     multi_key_mode: 'random',
     // 渠道额外设置的默认值
@@ -159,6 +168,7 @@ const EditChannelModal = (props) => {
     pass_through_body_enabled: false,
     system_prompt: '',
     system_prompt_override: false,
+    structured_output_emulation: false,
     settings: '',
     // 仅 Vertex: 密钥格式（存入 settings.vertex_key_type）
     vertex_key_type: 'json',
@@ -228,6 +238,7 @@ const EditChannelModal = (props) => {
   const [codexOAuthModalVisible, setCodexOAuthModalVisible] = useState(false);
   const [codexCredentialRefreshing, setCodexCredentialRefreshing] =
     useState(false);
+  const [proxyTesting, setProxyTesting] = useState(false);
 
   // 密钥显示状态
   const [keyDisplayState, setKeyDisplayState] = useState({
@@ -598,6 +609,11 @@ const EditChannelModal = (props) => {
           data.system_prompt = parsedSettings.system_prompt || '';
           data.system_prompt_override =
             parsedSettings.system_prompt_override || false;
+          data.structured_output_emulation =
+            parsedSettings.structured_output_emulation || false;
+          CHANNEL_TIMEOUT_KEYS.forEach((key) => {
+            data[key] = parsedSettings[key] ?? '';
+          });
         } catch (error) {
           console.error('解析渠道设置失败:', error);
           data.force_format = false;
@@ -606,6 +622,7 @@ const EditChannelModal = (props) => {
           data.pass_through_body_enabled = false;
           data.system_prompt = '';
           data.system_prompt_override = false;
+          data.structured_output_emulation = false;
         }
       } else {
         data.force_format = false;
@@ -614,6 +631,7 @@ const EditChannelModal = (props) => {
         data.pass_through_body_enabled = false;
         data.system_prompt = '';
         data.system_prompt_override = false;
+        data.structured_output_emulation = false;
       }
 
       if (data.settings) {
@@ -621,6 +639,9 @@ const EditChannelModal = (props) => {
           const parsedSettings = JSON.parse(data.settings);
           data.azure_responses_version =
             parsedSettings.azure_responses_version || '';
+          data.azure_deployments = parsedSettings.azure_deployments
+            ? JSON.stringify(parsedSettings.azure_deployments, null, 2)
+            : '';
           // 读取 Vertex 密钥格式
           data.vertex_key_type = parsedSettings.vertex_key_type || 'json';
           // 读取 AWS 密钥格式和区域
@@ -636,6 +657,7 @@ const EditChannelModal = (props) => {
         } catch (error) {
           console.error('解析其他设置失败:', error);
           data.azure_responses_version = '';
+          data.azure_deployments = '';
           data.region = '';
           data.vertex_key_type = 'json';
           data.aws_key_type = 'ak_sk';
@@ -682,6 +704,7 @@ const EditChannelModal = (props) => {
         pass_through_body_enabled: data.pass_through_body_enabled,
         system_prompt: data.system_prompt,
         system_prompt_override: data.system_prompt_override || false,
+        structured_output_emulation: data.structured_output_emulation || false,
       });
       initialModelsRef.current = (data.models || [])
         .map((model) => (model || '').trim())
@@ -919,6 +942,41 @@ const EditChannelModal = (props) => {
     }
   };
 
+  const handleTestProxy = async () => {
+    if (!inputs.proxy) {
+      showInfo(t('请先填写代理地址'));
+      return;
+    }
+    setProxyTesting(true);
+    try {
+      const res = await API.post('/api/channel/proxy/test', {
+        channel_id: isEdit ? parseInt(channelId) : 0,
+        type: inputs.type,
+        proxy: inputs.proxy,
+        url: inputs.base_url || '',
+      });
+      const { success, message, data } = res.data;
+      if (!success) {
+        showError(message);
+        return;
+      }
+      if (data.target_reachable) {
+        showSuccess(
+          t('代理可用，目标地址返回 {{status}}，耗时 {{ms}} ms', {
+            status: data.status_code,
+            ms: data.target_latency_ms,
+          }),
+        );
+      } else {
+        showError(data.error || t('代理测试失败'));
+      }
+    } catch (error) {
+      showError(error.message || t('代理测试失败'));
+    } finally {
+      setProxyTesting(false);
+    }
+  };
+
   useEffect(() => {
     if (inputs.type !== 45) {
       doubaoApiClickCountRef.current = 0;
@@ -1027,6 +1085,7 @@ const EditChannelModal = (props) => {
       pass_through_body_enabled: false,
       system_prompt: '',
       system_prompt_override: false,
+      structured_output_emulation: false,
     });
     // 重置密钥模式状态
     setKeyMode('append');
@@ -1354,7 +1413,15 @@ const EditChannelModal = (props) => {
       pass_through_body_enabled: localInputs.pass_through_body_enabled || false,
       system_prompt: localInputs.system_prompt || '',
       system_prompt_override: localInputs.system_prompt_override || false,
+      structured_output_emulation:
+        localInputs.structured_output_emulation || false,
     };
+    CHANNEL_TIMEOUT_KEYS.forEach((key) => {
+      if (Number.isFinite(localInputs[key])) {
+        channelExtraSettings[key] = localInputs[key];
+      }
+      delete localInputs[key];
+    });
     localInputs.setting = JSON.stringify(channelExtraSettings);
 
     // 处理 settings 字段（包括企业账户设置和字段透传控制）
@@ -1373,6 +1440,19 @@ const EditChannelModal = (props) => {
         localInputs.is_enterprise_account === true;
     }
 
+    // type === 3 (Azure): 保存模型到部署的映射
+    if (localInputs.type === 3) {
+      const azureDeployments = (localInputs.azure_deployments || '').trim();
+      if (azureDeployments === '') {
+        delete settings.azure_deployments;
+      } else if (!verifyJSON(azureDeployments)) {
+        showInfo(t('部署映射必须是合法的 JSON 格式！'));
+        return;
+      } else {
+        settings.azure_deployments = JSON.parse(azureDeployments);
+      }
+    }
+
     // type === 33 (AWS): 保存 aws_key_type 到 settings
     if (localInputs.type === 33) {
       settings.aws_key_type = localInputs.aws_key_type || 'ak_sk';
@@ -1405,7 +1485,10 @@ const EditChannelModal = (props) => {
     delete localInputs.pass_through_body_enabled;
     delete localInputs.system_prompt;
     delete localInputs.system_prompt_override;
+    delete localInputs.structured_output_emulation;
     delete localInputs.is_enterprise_account;
+    // 部署映射已写入 settings
+    delete localInputs.azure_deployments;
     // 顶层的 vertex_key_type 不应发送给后端
     delete localInputs.vertex_key_type;
     // 顶层的 aws_key_type 不应发送给后端
@@ -1989,10 +2072,12 @@ const EditChannelModal = (props) => {
                                 : t(
                                     '请输入密钥，一行一个，格式：AccessKey|SecretAccessKey|Region',
                                   )
-                              : t('请输入密钥，一行一个')
+                              : inputs.type === 59
+                                ? t('本地服务未开启鉴权时可留空')
+                                : t('请输入密钥，一行一个')
                           }
                           rules={
-                            isEdit
+                            isEdit || inputs.type === 4 || inputs.type === 59
                               ? []
                               : [{ required: true, message: t('请输入密钥') }]
                           }
@@ -2398,9 +2483,6 @@ const EditChannelModal = (props) => {
                         )}
                         value={inputs.other || ''}
                         onChange={(value) => handleInputChange('other', value)}
-                        rules={[
-                          { required: true, message: t('请填写部署地区') },
-                        ]}
                         template={REGION_EXAMPLE}
                         templateLabel={t('填入模板')}
                         editorType='region'
@@ -2558,6 +2640,33 @@ const EditChannelModal = (props) => {
                               showClear
                             />
                           </div>
+                          <div>
+                            <Form.TextArea
+                              field='azure_deployments'
+                              label={t('部署映射')}
+                              placeholder={
+                                t(
+                                  '此项可选，用于将模型映射到不同的部署及 API 版本，未配置的模型使用模型名作为部署名，例如：',
+                                ) +
+                                '\n' +
+                                JSON.stringify(
+                                  {
+                                    'gpt-4o': {
+                                      deployment: 'gpt4o-prod',
+                                      api_version: '2025-04-01-preview',
+                                    },
+                                  },
+                                  null,
+                                  2,
+                                )
+                              }
+                              autosize
+                              onChange={(value) =>
+                                handleInputChange('azure_deployments', value)
+                              }
+                              showClear
+                            />
+                          </div>
                         </>
                       )}
 
@@ -3012,6 +3121,21 @@ const EditChannelModal = (props) => {
                       </Col>
                     </Row>
 
+                    <Form.InputNumber
+                      field='canary_percent'
+                      label={t('灰度流量比例（%）')}
+                      placeholder={t('0 表示正常渠道')}
+                      min={0}
+                      max={100}
+                      onNumberChange={(value) =>
+                        handleInputChange('canary_percent', value)
+                      }
+                      style={{ width: '100%' }}
+                      extraText={t(
+                        '大于 0 时作为灰度渠道，只分得同优先级下该比例的请求；开启灰度自动评估后，评估期结束时按错误率与延迟自动转正或禁用',
+                      )}
+                    />
+
                     <Form.Switch
                       field='auto_ban'
                       label={t('是否自动禁用')}
@@ -3086,6 +3210,43 @@ const EditChannelModal = (props) => {
                           >
                             {t('新格式模板')}
                           </Text>
+                          <Text
+                            className='!text-semi-color-primary cursor-pointer'
+                            onClick={() =>
+                              handleInputChange(
+                                'param_override',
+                                JSON.stringify(
+                                  {
+                                    operations: [
+                                      {
+                                        path: 'temperature',
+                                        mode: 'max',
+                                        value: 1,
+                                      },
+                                      {
+                                        path: '',
+                                        mode: 'merge',
+                                        keep_origin: true,
+                                        value: {
+                                          safetySettings: [
+                                            {
+                                              category:
+                                                'HARM_CATEGORY_HARASSMENT',
+                                              threshold: 'BLOCK_ONLY_HIGH',
+                                            },
+                                          ],
+                                        },
+                                      },
+                                    ],
+                                  },
+                                  null,
+                                  2,
+                                ),
+                              )
+                            }
+                          >
+                            {t('限制与合并模板')}
+                          </Text>
                           <Text
                             className='!text-semi-color-primary cursor-pointer'
                             onClick={() => formatJsonField('param_override')}
@@ -3358,9 +3519,76 @@ const EditChannelModal = (props) => {
                         handleChannelSettingsChange('proxy', value)
                       }
                       showClear
-                      extraText={t('用于配置网络代理，支持 socks5 协议')}
+                      extraText={t(
+                        '用于配置网络代理，支持 http、https、socks5 协议，可在地址中携带用户名与密码',
+                      )}
+                      addonAfter={
+                        <Button
+                          theme='borderless'
+                          loading={proxyTesting}
+                          onClick={handleTestProxy}
+                        >
+                          {t('测试代理')}
+                        </Button>
+                      }
                     />
 
+                    <Row gutter={12}>
+                      <Col span={12}>
+                        <Form.InputNumber
+                          field='connect_timeout'
+                          label={t('连接超时（秒）')}
+                          placeholder={t('使用全局设置')}
+                          min={1}
+                          onNumberChange={(value) =>
+                            handleInputChange('connect_timeout', value)
+                          }
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+                      <Col span={12}>
+                        <Form.InputNumber
+                          field='request_timeout'
+                          label={t('请求超时（秒）')}
+                          placeholder={t('使用全局设置')}
+                          min={1}
+                          onNumberChange={(value) =>
+                            handleInputChange('request_timeout', value)
+                          }
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+                    </Row>
+                    <Row gutter={12}>
+                      <Col span={12}>
+                        <Form.InputNumber
+                          field='stream_idle_timeout'
+                          label={t('流式空闲超时（秒）')}
+                          placeholder={t('使用全局设置')}
+                          min={1}
+                          onNumberChange={(value) =>
+                            handleInputChange('stream_idle_timeout', value)
+                          }
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+                      <Col span={12}>
+                        <Form.InputNumber
+                          field='max_retries'
+                          label={t('失败重试次数')}
+                          placeholder={t('使用全局设置')}
+                          min={0}
+                          onNumberChange={(value) =>
+                            handleInputChange('max_retries', value)
+                          }
+                          style={{ width: '100%' }}
+                          extraText={t(
+                            '该渠道请求失败后的重试次数，设置为 0 则不重试',
+                          )}
+                        />
+                      </Col>
+                    </Row>
+
                     <Form.TextArea
                       field='system_prompt'
                       label={t('系统提示词')}
@@ -3391,6 +3619,21 @@ const EditChannelModal = (props) => {
                         '如果用户请求中包含系统提示词，则使用此设置拼接到用户的系统提示词前面',
                       )}
                     />
+                    <Form.Switch
+                      field='structured_output_emulation'
+                      label={t('结构化输出模拟')}
+                      checkedText={t('开')}
+                      uncheckedText={t('关')}
+                      onChange={(value) =>
+                        handleChannelSettingsChange(
+                          'structured_output_emulation',
+                          value,
+                        )
+                      }
+                      extraText={t(
+                        '上游不支持 response_format 时开启：改为提示词约束输出 JSON，非流式请求校验失败会自动重试一次',
+                      )}
+                    />
                   </Card>
                 </div>
               </div>
@@ -402,6 +402,27 @@ const renderOperations = (
         {t('编辑')}
       </Button>
 
+      <Button
+        type='tertiary'
+        size='small'
+        onClick={() => {
+          Modal.confirm({
+            title: t('确定要轮换此令牌的密钥吗？'),
+            content: t(
+              '将生成新密钥，旧密钥在重叠期内仍可使用，额度与限制保持不变',
+            ),
+            onOk: () => {
+              (async () => {
+                await manageToken(record.id, 'rotate', record);
+                await refresh();
+              })();
+            },
+          });
+        }}
+      >
+        {t('轮换')}
+      </Button>
+
       <Button
         type='danger'
         size='small'
@@ -72,11 +72,30 @@ const EditTokenModal = (props) => {
     model_limits_enabled: false,
     model_limits: [],
     allow_ips: '',
+    deny_ips: '',
     group: '',
     cross_group_retry: false,
+    max_concurrent_requests: 0,
+    project: '',
+    scopes: [],
+    context_truncation: '',
+    relay_race: false,
     tokenCount: 1,
   });
 
+  const scopeOptions = [
+    { label: t('对话'), value: 'chat' },
+    { label: t('向量'), value: 'embeddings' },
+    { label: t('图像'), value: 'images' },
+    { label: t('音频'), value: 'audio' },
+    { label: t('重排序'), value: 'rerank' },
+    { label: t('内容审核'), value: 'moderations' },
+    { label: t('实时语音'), value: 'realtime' },
+    { label: t('视频与异步任务'), value: 'video' },
+    { label: t('文件与批处理'), value: 'files' },
+    { label: t('只读用量查询'), value: 'dashboard' },
+  ];
+
   const handleCancel = () => {
     props.handleClose();
   };
@@ -162,6 +181,7 @@ const EditTokenModal = (props) => {
       } else {
         data.model_limits = [];
       }
+      data.scopes = data.scopes ? data.scopes.split(',') : [];
       if (formApiRef.current) {
         formApiRef.current.setValues({ ...getInitValues(), ...data });
       }
@@ -221,6 +241,7 @@ const EditTokenModal = (props) => {
       }
       localInputs.model_limits = localInputs.model_limits.join(',');
       localInputs.model_limits_enabled = localInputs.model_limits.length > 0;
+      localInputs.scopes = localInputs.scopes.join(',');
       let res = await API.put(`/api/token/`, {
         ...localInputs,
         id: parseInt(props.editingToken.id),
@@ -258,6 +279,7 @@ const EditTokenModal = (props) => {
         }
         localInputs.model_limits = localInputs.model_limits.join(',');
         localInputs.model_limits_enabled = localInputs.model_limits.length > 0;
+        localInputs.scopes = localInputs.scopes.join(',');
         let res = await API.post(`/api/token/`, localInputs);
         const { success, message } = res.data;
         if (success) {
@@ -559,6 +581,20 @@ const EditTokenModal = (props) => {
                       style={{ width: '100%' }}
                     />
                   </Col>
+                  <Col span={24}>
+                    <Form.Select
+                      field='scopes'
+                      label={t('接口范围')}
+                      placeholder={t('留空允许访问所有接口')}
+                      multiple
+                      optionList={scopeOptions}
+                      extraText={t(
+                        '仅选择“只读用量查询”时，该令牌只能查询额度与用量',
+                      )}
+                      showClear
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
                   <Col span={24}>
                     <Form.TextArea
                       field='allow_ips'
@@ -573,6 +609,63 @@ const EditTokenModal = (props) => {
                       style={{ width: '100%' }}
                     />
                   </Col>
+                  <Col span={24}>
+                    <Form.TextArea
+                      field='deny_ips'
+                      label={t('IP黑名单（支持CIDR表达式）')}
+                      placeholder={t('禁止访问的IP，一行一个，优先于白名单')}
+                      autosize
+                      rows={1}
+                      showClear
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
+                  <Col span={24}>
+                    <Form.InputNumber
+                      field='max_concurrent_requests'
+                      label={t('最大并发请求数')}
+                      min={0}
+                      precision={0}
+                      extraText={t('同时进行中的请求数上限，0 表示使用分组配置')}
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
+                  <Col span={24}>
+                    <Form.Select
+                      field='context_truncation'
+                      label={t('超出上下文时')}
+                      optionList={[
+                        { label: t('拒绝请求'), value: '' },
+                        { label: t('丢弃最早的消息'), value: 'drop_oldest' },
+                        { label: t('丢弃中间的消息'), value: 'middle_out' },
+                      ]}
+                      extraText={t(
+                        '仅在管理员配置了模型上下文窗口时生效，系统提示词与最后一条消息始终保留',
+                      )}
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='relay_race'
+                      label={t('竞速模式')}
+                      size='default'
+                      extraText={t(
+                        '同时请求多个渠道并采用最先返回的响应，仅对管理员允许的分组与模型生效',
+                      )}
+                    />
+                  </Col>
+                  <Col span={24}>
+                    <Form.Input
+                      field='project'
+                      label={t('所属项目')}
+                      placeholder={t('用于按项目统计用量，可选')}
+                      maxLength={64}
+                      extraText={t('请求头 X-Project-Id 可覆盖此设置')}
+                      showClear
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
                 </Row>
               </Card>
             </div>
@@ -79,6 +79,10 @@ const EditUserModal = (props) => {
     quota: 0,
     group: 'default',
     remark: '',
+    billing_mode: 'prepaid',
+    credit_limit: 0,
+    allow_ips: '',
+    deny_ips: '',
   });
 
   const fetchGroups = async () => {
@@ -119,6 +123,11 @@ const EditUserModal = (props) => {
       payload.quota = parseInt(payload.quota) || 0;
     if (userId) {
       payload.id = parseInt(userId);
+    } else {
+      delete payload.billing_mode;
+      delete payload.credit_limit;
+      delete payload.allow_ips;
+      delete payload.deny_ips;
     }
     const url = userId ? `/api/user/` : `/api/user/self`;
     const res = await API.put(url, payload);
@@ -249,6 +258,33 @@ const EditUserModal = (props) => {
                         showClear
                       />
                     </Col>
+
+                    {userId && (
+                      <>
+                        <Col span={24}>
+                          <Form.TextArea
+                            field='allow_ips'
+                            label={t('IP白名单（支持CIDR表达式）')}
+                            placeholder={t(
+                              '作用于该用户的全部令牌，一行一个，不填写则不限制',
+                            )}
+                            autosize
+                            rows={1}
+                            showClear
+                          />
+                        </Col>
+                        <Col span={24}>
+                          <Form.TextArea
+                            field='deny_ips'
+                            label={t('IP黑名单（支持CIDR表达式）')}
+                            placeholder={t('禁止访问的IP，一行一个，优先于白名单')}
+                            autosize
+                            rows={1}
+                            showClear
+                          />
+                        </Col>
+                      </>
+                    )}
                   </Row>
                 </Card>
 
@@ -306,6 +342,31 @@ const EditUserModal = (props) => {
                           />
                         </Form.Slot>
                       </Col>
+
+                      <Col span={10}>
+                        <Form.Select
+                          field='billing_mode'
+                          label={t('计费模式')}
+                          optionList={[
+                            { label: t('预付费'), value: 'prepaid' },
+                            { label: t('后付费'), value: 'postpaid' },
+                          ]}
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+
+                      {values.billing_mode === 'postpaid' && (
+                        <Col span={14}>
+                          <Form.InputNumber
+                            field='credit_limit'
+                            label={t('信用额度')}
+                            min={0}
+                            step={500000}
+                            extraText={t('后付费用户可透支至该额度，超出后停止服务')}
+                            style={{ width: '100%' }}
+                          />
+                        </Col>
+                      )}
                     </Row>
                   </Card>
                 )}
@@ -55,6 +55,8 @@ const RechargeCard = ({
   enableCreemTopUp,
   creemProducts,
   creemPreTopUp,
+  stripePackages,
+  stripePackagePreTopUp,
   presetAmounts,
   selectedPreset,
   selectPresetAmount,
@@ -74,6 +76,8 @@ const RechargeCard = ({
   payWay,
   redemptionCode,
   setRedemptionCode,
+  couponCode,
+  setCouponCode,
   topUp,
   isSubmitting,
   topUpLink,
@@ -364,6 +368,15 @@ const RechargeCard = ({
                   </Row>
                 )}
 
+                <Form.Input
+                  field='couponCode'
+                  label={t('优惠券')}
+                  placeholder={t('如有优惠券，请输入券码（可选）')}
+                  value={couponCode}
+                  onChange={(value) => setCouponCode(value)}
+                  showClear
+                />
+
                 {(enableOnlineTopUp || enableStripeTopUp) && (
                   <Form.Slot
                     label={
@@ -490,6 +503,32 @@ const RechargeCard = ({
                   </Form.Slot>
                 )}
 
+                {/* Stripe 额度套餐 */}
+                {enableStripeTopUp && stripePackages.length > 0 && (
+                  <Form.Slot label={t('Stripe 额度套餐')}>
+                    <div className='grid grid-cols-1 sm:grid-cols-2 md:grid-cols-3 gap-3'>
+                      {stripePackages.map((pkg) => (
+                        <Card
+                          key={pkg.id}
+                          onClick={() => stripePackagePreTopUp(pkg)}
+                          className='cursor-pointer !rounded-2xl transition-all hover:shadow-md border-gray-200 hover:border-gray-300'
+                          bodyStyle={{ textAlign: 'center', padding: '16px' }}
+                        >
+                          <div className='font-medium text-lg mb-2'>
+                            {pkg.name}
+                          </div>
+                          <div className='text-sm text-gray-600 mb-2'>
+                            {t('充值额度')}: {renderQuota(pkg.quota)}
+                          </div>
+                          <div className='text-lg font-semibold text-blue-600'>
+                            {pkg.price} {(pkg.currency || 'usd').toUpperCase()}
+                          </div>
+                        </Card>
+                      ))}
+                    </div>
+                  </Form.Slot>
+                )}
+
                 {/* Creem 充值区域 */}
                 {enableCreemTopUp && creemProducts.length > 0 && (
                   <Form.Slot label={t('Creem 充值')}>
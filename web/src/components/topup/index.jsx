@@ -46,6 +46,7 @@ const TopUp = () => {
   const [statusState] = useContext(StatusContext);
 
   const [redemptionCode, setRedemptionCode] = useState('');
+  const [couponCode, setCouponCode] = useState('');
   const [amount, setAmount] = useState(0.0);
   const [minTopUp, setMinTopUp] = useState(statusState?.status?.min_topup || 1);
   const [topUpCount, setTopUpCount] = useState(
@@ -70,6 +71,11 @@ const TopUp = () => {
   const [creemOpen, setCreemOpen] = useState(false);
   const [selectedCreemProduct, setSelectedCreemProduct] = useState(null);
 
+  // Stripe 额度套餐
+  const [stripePackages, setStripePackages] = useState([]);
+  const [stripePackageOpen, setStripePackageOpen] = useState(false);
+  const [selectedStripePackage, setSelectedStripePackage] = useState(null);
+
   const [isSubmitting, setIsSubmitting] = useState(false);
   const [open, setOpen] = useState(false);
   const [payWay, setPayWay] = useState('');
@@ -209,12 +215,14 @@ const TopUp = () => {
         res = await API.post('/api/user/stripe/pay', {
           amount: parseInt(topUpCount),
           payment_method: 'stripe',
+          coupon_code: couponCode,
         });
       } else {
         // 普通支付请求
         res = await API.post('/api/user/pay', {
           amount: parseInt(topUpCount),
           payment_method: payWay,
+          coupon_code: couponCode,
         });
       }
 
@@ -289,6 +297,7 @@ const TopUp = () => {
       const res = await API.post('/api/user/creem/pay', {
         product_id: selectedCreemProduct.productId,
         payment_method: 'creem',
+        coupon_code: couponCode,
       });
       if (res !== undefined) {
         const { message, data } = res.data;
@@ -311,6 +320,42 @@ const TopUp = () => {
     }
   };
 
+  const stripePackagePreTopUp = (pkg) => {
+    if (!enableStripeTopUp) {
+      showError(t('管理员未开启Stripe充值！'));
+      return;
+    }
+    setSelectedStripePackage(pkg);
+    setStripePackageOpen(true);
+  };
+
+  const onlineStripePackageTopUp = async () => {
+    if (!selectedStripePackage) {
+      showError(t('请选择套餐'));
+      return;
+    }
+    setConfirmLoading(true);
+    try {
+      const res = await API.post('/api/user/stripe/pay', {
+        package_id: selectedStripePackage.id,
+        payment_method: 'stripe',
+        coupon_code: couponCode,
+      });
+      const { message, data } = res.data;
+      if (message === 'success') {
+        window.open(data.pay_link, '_blank');
+      } else {
+        showError(typeof data === 'string' ? data : message || t('支付失败'));
+      }
+    } catch (err) {
+      console.log(err);
+      showError(t('支付请求失败'));
+    } finally {
+      setStripePackageOpen(false);
+      setConfirmLoading(false);
+    }
+  };
+
   const processCreemCallback = (data) => {
     // 与 Stripe 保持一致的实现方式
     window.open(data.checkout_url, '_blank');
@@ -467,6 +512,12 @@ const TopUp = () => {
             setCreemProducts([]);
           }
 
+          try {
+            setStripePackages(JSON.parse(data.stripe_packages || '[]'));
+          } catch (e) {
+            setStripePackages([]);
+          }
+
           // 如果没有自定义充值数量选项，根据最小充值金额生成预设充值额度选项
           if (topupInfo.amount_options.length === 0) {
             setPresetAmounts(generatePresetAmounts(minTopUpValue));
@@ -704,6 +755,34 @@ const TopUp = () => {
         t={t}
       />
 
+      {/* Stripe 额度套餐确认模态框 */}
+      <Modal
+        title={t('确认购买套餐')}
+        visible={stripePackageOpen}
+        onOk={onlineStripePackageTopUp}
+        onCancel={() => setStripePackageOpen(false)}
+        maskClosable={false}
+        size='small'
+        centered
+        confirmLoading={confirmLoading}
+      >
+        {selectedStripePackage && (
+          <>
+            <p>
+              {t('套餐名称')}：{selectedStripePackage.name}
+            </p>
+            <p>
+              {t('价格')}：{selectedStripePackage.price}{' '}
+              {(selectedStripePackage.currency || 'usd').toUpperCase()}
+            </p>
+            <p>
+              {t('充值额度')}：{renderQuota(selectedStripePackage.quota)}
+            </p>
+            <p>{t('是否确认充值？')}</p>
+          </>
+        )}
+      </Modal>
+
       {/* Creem 充值确认模态框 */}
       <Modal
         title={t('确定要充值 $')}
@@ -761,6 +840,8 @@ const TopUp = () => {
             enableCreemTopUp={enableCreemTopUp}
             creemProducts={creemProducts}
             creemPreTopUp={creemPreTopUp}
+            stripePackages={stripePackages}
+            stripePackagePreTopUp={stripePackagePreTopUp}
             presetAmounts={presetAmounts}
             selectedPreset={selectedPreset}
             selectPresetAmount={selectPresetAmount}
@@ -780,6 +861,8 @@ const TopUp = () => {
             payWay={payWay}
             redemptionCode={redemptionCode}
             setRedemptionCode={setRedemptionCode}
+            couponCode={couponCode}
+            setCouponCode={setCouponCode}
             topUp={topUp}
             isSubmitting={isSubmitting}
             topUpLink={topUpLink}
@@ -189,6 +189,16 @@ export const CHANNEL_OPTIONS = [
     color: 'blue',
     label: 'Codex (OpenAI OAuth)',
   },
+  {
+    value: 58,
+    color: 'purple',
+    label: 'Voyage AI',
+  },
+  {
+    value: 59,
+    color: 'grey',
+    label: '本地模型（vLLM / llama.cpp / Ollama OpenAI 兼容）',
+  },
 ];
 
 export const MODEL_TABLE_PAGE_SIZE = 10;
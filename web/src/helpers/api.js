@@ -215,23 +215,33 @@ export const processGroupsData = (data, userGroup) => {
 
 // 原来components中的utils.js
 
-export async function getOAuthState() {
-  let path = '/api/oauth/state';
+// provider 为开启 PKCE 的自定义 OAuth 提供商时，同时返回 code_challenge
+async function requestOAuthState(provider = '') {
+  const params = new URLSearchParams();
   let affCode = localStorage.getItem('aff');
   if (affCode && affCode.length > 0) {
-    path += `?aff=${affCode}`;
+    params.set('aff', affCode);
+  }
+  if (provider) {
+    params.set('provider', provider);
   }
-  const res = await API.get(path);
-  const { success, message, data } = res.data;
+  const query = params.toString();
+  const res = await API.get('/api/oauth/state' + (query ? `?${query}` : ''));
+  const { success, message, data, code_challenge } = res.data;
   if (success) {
-    return data;
+    return { state: data, codeChallenge: code_challenge };
   } else {
     showError(message);
-    return '';
+    return { state: '' };
   }
 }
 
-async function prepareOAuthState(options = {}) {
+export async function getOAuthState() {
+  const { state } = await requestOAuthState();
+  return state;
+}
+
+async function logoutBeforeOAuth(options = {}) {
   const { shouldLogout = false } = options;
   if (shouldLogout) {
     try {
@@ -240,6 +250,10 @@ async function prepareOAuthState(options = {}) {
     localStorage.removeItem('user');
     updateAPI();
   }
+}
+
+async function prepareOAuthState(options = {}) {
+  await logoutBeforeOAuth(options);
   return await getOAuthState();
 }
 
@@ -301,11 +315,15 @@ export async function onLinuxDOOAuthClicked(
  * @param {string} provider.client_id - OAuth client ID
  * @param {string} provider.authorization_endpoint - Authorization URL
  * @param {string} provider.scopes - OAuth scopes (space-separated)
+ * @param {boolean} provider.use_pkce - Whether to send a PKCE code challenge
  * @param {Object} options - Options
  * @param {boolean} options.shouldLogout - Whether to logout first
  */
 export async function onCustomOAuthClicked(provider, options = {}) {
-  const state = await prepareOAuthState(options);
+  await logoutBeforeOAuth(options);
+  const { state, codeChallenge } = await requestOAuthState(
+    provider.use_pkce ? provider.slug : '',
+  );
   if (!state) return;
   
   try {
@@ -328,6 +346,10 @@ export async function onCustomOAuthClicked(provider, options = {}) {
     authUrl.searchParams.set('response_type', 'code');
     authUrl.searchParams.set('scope', provider.scopes || 'openid profile email');
     authUrl.searchParams.set('state', state);
+    if (codeChallenge) {
+      authUrl.searchParams.set('code_challenge', codeChallenge);
+      authUrl.searchParams.set('code_challenge_method', 'S256');
+    }
     
     window.open(authUrl.toString());
   } catch (error) {
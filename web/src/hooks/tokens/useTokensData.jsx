@@ -171,13 +171,20 @@ export const useTokensData = (openFluentNotification) => {
         data.status = 2;
         res = await API.put('/api/token/?status_only=true', data);
         break;
+      case 'rotate':
+        res = await API.post(`/api/token/${id}/rotate`, {});
+        break;
     }
     const { success, message } = res.data;
     if (success) {
       showSuccess(t('操作成功完成！'));
       let token = res.data.data;
       let newTokens = [...tokens];
-      if (action !== 'delete') {
+      if (action === 'rotate') {
+        record.key = token.key;
+        record.rotated_time = token.rotated_time;
+        record.previous_key_expires = token.previous_key_expires;
+      } else if (action !== 'delete') {
         record.status = token.status;
       }
       setTokens(newTokens);
@@ -72,6 +72,7 @@ const defaultGlobalSettingInputs = {
   'global.chat_completions_to_responses_policy': '{}',
   'general_setting.ping_interval_enabled': false,
   'general_setting.ping_interval_seconds': 60,
+  'general_setting.non_stream_keep_alive_enabled': false,
 };
 
 export default function SettingGlobalModel(props) {
@@ -400,6 +401,22 @@ export default function SettingGlobalModel(props) {
                     disabled={!inputs['general_setting.ping_interval_enabled']}
                   />
                 </Col>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Switch
+                    label={t('非流式请求保活')}
+                    field={'general_setting.non_stream_keep_alive_enabled'}
+                    onChange={(value) =>
+                      setInputs({
+                        ...inputs,
+                        'general_setting.non_stream_keep_alive_enabled': value,
+                      })
+                    }
+                    disabled={!inputs['general_setting.ping_interval_enabled']}
+                    extraText={t(
+                      '等待上游响应时按Ping间隔写出换行符，仅对对话类请求生效，开启后上游出错也将返回200状态码',
+                    )}
+                  />
+                </Col>
               </Row>
             </Form.Section>
 
@@ -0,0 +1,161 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+export default function SettingsCanary(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'canary_setting.auto_evaluate_enabled': false,
+    'canary_setting.evaluation_minutes': 60,
+    'canary_setting.min_requests': 50,
+    'canary_setting.max_error_rate_delta': 5,
+    'canary_setting.max_latency_ratio': 1.5,
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: String(inputs[item.key]),
+      }),
+    );
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs({ ...inputs, ...currentInputs });
+    setInputsRow(structuredClone({ ...inputs, ...currentInputs }));
+    refForm.current.setValues({ ...inputs, ...currentInputs });
+  }, [props.options]);
+
+  const setField = (key) => (value) => setInputs({ ...inputs, [key]: value });
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('灰度渠道评估')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'canary_setting.auto_evaluate_enabled'}
+                  label={t('自动评估灰度渠道')}
+                  extraText={t(
+                    '评估期结束后与同模型的正常渠道对比错误率与平均耗时，达标时转为正常渠道，否则自动禁用',
+                  )}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('canary_setting.auto_evaluate_enabled')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'canary_setting.evaluation_minutes'}
+                  label={t('评估期')}
+                  min={1}
+                  suffix={t('分钟')}
+                  onChange={setField('canary_setting.evaluation_minutes')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'canary_setting.min_requests'}
+                  label={t('最少请求数')}
+                  min={1}
+                  extraText={t('评估期结束时请求数不足则继续观察')}
+                  onChange={setField('canary_setting.min_requests')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'canary_setting.max_error_rate_delta'}
+                  label={t('错误率最多高出')}
+                  min={0}
+                  suffix={t('个百分点')}
+                  onChange={setField('canary_setting.max_error_rate_delta')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'canary_setting.max_latency_ratio'}
+                  label={t('平均耗时最多为正常渠道的')}
+                  min={0}
+                  step={0.1}
+                  suffix={t('倍')}
+                  extraText={t('0 表示不比较耗时')}
+                  onChange={setField('canary_setting.max_latency_ratio')}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存灰度评估设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
@@ -0,0 +1,252 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+  verifyJSON,
+  timestamp2string,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+const JSON_KEYS = [
+  'currency_setting.currencies',
+  'currency_setting.rates',
+  'currency_setting.symbols',
+  'currency_setting.packages',
+];
+
+export default function SettingsCurrency(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'currency_setting.enabled': false,
+    'currency_setting.currencies': '',
+    'currency_setting.rates': '',
+    'currency_setting.symbols': '',
+    'currency_setting.auto_fetch_enabled': false,
+    'currency_setting.auto_fetch_url': '',
+    'currency_setting.auto_fetch_interval_minutes': 360,
+    'currency_setting.last_fetched_at': 0,
+    'currency_setting.packages': '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    for (const key of JSON_KEYS) {
+      if (inputs[key] && !verifyJSON(inputs[key])) {
+        return showError(t('币种设置必须是合法的 JSON'));
+      }
+    }
+    const updateArray = compareObjects(inputs, inputsRow).filter(
+      (item) => item.key !== 'currency_setting.last_fetched_at',
+    );
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: String(inputs[item.key]),
+      }),
+    );
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  async function fetchRates() {
+    setLoading(true);
+    try {
+      const res = await API.post('/api/option/currency/fetch_rates');
+      const { success, message } = res.data;
+      if (success) {
+        showSuccess(t('汇率已更新'));
+        props.refresh();
+      } else {
+        showError(message);
+      }
+    } catch (error) {
+      showError(t('拉取汇率失败'));
+    } finally {
+      setLoading(false);
+    }
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs({ ...inputs, ...currentInputs });
+    setInputsRow(structuredClone({ ...inputs, ...currentInputs }));
+    refForm.current.setValues({ ...inputs, ...currentInputs });
+  }, [props.options]);
+
+  const setField = (key) => (value) => setInputs({ ...inputs, [key]: value });
+  const lastFetchedAt = Number(inputs['currency_setting.last_fetched_at']);
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('多币种展示')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'currency_setting.enabled'}
+                  label={t('启用多币种展示')}
+                  extraText={t(
+                    '额度仍以基础单位存储，余额、账单等接口会同时返回各币种金额',
+                  )}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('currency_setting.enabled')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={16} lg={16} xl={16}>
+                <Form.Input
+                  field={'currency_setting.currencies'}
+                  label={t('展示币种')}
+                  placeholder='["USD", "CNY", "EUR"]'
+                  onChange={setField('currency_setting.currencies')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('汇率')}
+                  placeholder='{"CNY": 7.3, "EUR": 0.92}'
+                  extraText={t(
+                    '1 USD 兑换的目标币种数量，CNY 未配置时使用充值设置中的美元汇率',
+                  )}
+                  field={'currency_setting.rates'}
+                  onChange={setField('currency_setting.rates')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 3, maxRows: 8 }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('币种符号')}
+                  placeholder='{"USD": "$", "CNY": "¥", "EUR": "€"}'
+                  field={'currency_setting.symbols'}
+                  onChange={setField('currency_setting.symbols')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 3, maxRows: 8 }}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={6} lg={6} xl={6}>
+                <Form.Switch
+                  field={'currency_setting.auto_fetch_enabled'}
+                  label={t('自动拉取汇率')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('currency_setting.auto_fetch_enabled')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.Input
+                  field={'currency_setting.auto_fetch_url'}
+                  label={t('汇率接口地址')}
+                  placeholder='https://open.er-api.com/v6/latest/USD'
+                  extraText={
+                    t('接口需返回以 USD 为基准的 rates 字段') +
+                    (lastFetchedAt > 0
+                      ? '，' + t('上次更新') + ' ' + timestamp2string(lastFetchedAt)
+                      : '')
+                  }
+                  onChange={setField('currency_setting.auto_fetch_url')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={6} lg={6} xl={6}>
+                <Form.InputNumber
+                  field={'currency_setting.auto_fetch_interval_minutes'}
+                  label={t('拉取间隔')}
+                  min={10}
+                  suffix={t('分钟')}
+                  onChange={setField(
+                    'currency_setting.auto_fetch_interval_minutes',
+                  )}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={24}>
+                <Form.TextArea
+                  label={t('按币种定价的充值套餐')}
+                  placeholder='[{"amount": 100, "prices": {"CNY": 680, "USD": 95}}]'
+                  extraText={t(
+                    'amount 为充值数量；在线支付以人民币结算，配置了 CNY 价格的套餐按套餐价收款',
+                  )}
+                  field={'currency_setting.packages'}
+                  onChange={setField('currency_setting.packages')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 3, maxRows: 10 }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存币种设置')}
+              </Button>
+              <Button
+                size='default'
+                style={{ marginLeft: 8 }}
+                onClick={fetchRates}
+              >
+                {t('立即拉取汇率')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
@@ -36,6 +36,7 @@ import {
   showError,
   showSuccess,
   showWarning,
+  verifyJSON,
 } from '../../../helpers';
 import { useTranslation } from 'react-i18next';
 
@@ -51,6 +52,7 @@ export default function GeneralSettings(props) {
     'general_setting.custom_currency_exchange_rate': '',
     QuotaPerUnit: '',
     RetryTimes: '',
+    'relay_timeout_setting.models': '',
     USDExchangeRate: '',
     DisplayTokenStatEnabled: false,
     DefaultCollapseSidebar: false,
@@ -69,6 +71,10 @@ export default function GeneralSettings(props) {
   function onSubmit() {
     const updateArray = compareObjects(inputs, inputsRow);
     if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const timeoutModels = inputs['relay_timeout_setting.models'];
+    if (timeoutModels && !verifyJSON(timeoutModels)) {
+      return showError(t('模型超时策略不是合法的 JSON 字符串'));
+    }
     const requestQueue = updateArray.map((item) => {
       let value = '';
       if (typeof inputs[item.key] === 'boolean') {
@@ -244,6 +250,22 @@ export default function GeneralSettings(props) {
                 />
               </Col>
             </Row>
+            <Row gutter={16}>
+              <Col span={24}>
+                <Form.TextArea
+                  field={'relay_timeout_setting.models'}
+                  label={t('模型超时与重试策略')}
+                  extraText={t(
+                    '键为模型名，以 * 结尾时按前缀匹配；单位为秒，未配置的项使用全局设置，渠道中的配置优先',
+                  )}
+                  placeholder={
+                    '{"o1*": {"request_timeout": 600, "stream_idle_timeout": 300, "max_retries": 1}, "local-llama": {"connect_timeout": 3}}'
+                  }
+                  autosize={{ minRows: 3, maxRows: 10 }}
+                  onChange={handleFieldChange('relay_timeout_setting.models')}
+                />
+              </Col>
+            </Row>
             <Row gutter={16}>
               <Col xs={24} sm={12} md={8} lg={8} xl={8}>
                 <Form.Switch
@@ -0,0 +1,154 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+  verifyJSON,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+const JSON_KEYS = ['guardrail_setting.groups', 'guardrail_setting.tokens'];
+
+export default function SettingsGuardrail(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'guardrail_setting.enabled': false,
+    'guardrail_setting.groups': '',
+    'guardrail_setting.tokens': '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    for (const key of JSON_KEYS) {
+      if (inputs[key] && !verifyJSON(inputs[key])) {
+        return showError(t('护栏提示词配置必须是合法的 JSON'));
+      }
+    }
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: String(inputs[item.key]),
+      }),
+    );
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs({ ...inputs, ...currentInputs });
+    setInputsRow(structuredClone({ ...inputs, ...currentInputs }));
+    refForm.current.setValues({ ...inputs, ...currentInputs });
+  }, [props.options]);
+
+  const setField = (key) => (value) => setInputs({ ...inputs, [key]: value });
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('护栏提示词设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'guardrail_setting.enabled'}
+                  label={t('转发前注入护栏提示词')}
+                  extraText={
+                    t('支持的模板变量：') +
+                    '{{username}} {{user_id}} {{group}} {{token_name}} {{model}} {{date}} {{datetime}}'
+                  }
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('guardrail_setting.enabled')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('分组护栏提示词')}
+                  placeholder='{"default": {"system_prompt": "You are serving {{username}}. Follow the company policy.", "user_suffix": "Answer in English."}}'
+                  extraText={t(
+                    'system_prompt 作为独立的系统消息插入在最前，user_prefix 与 user_suffix 包裹最后一条用户消息',
+                  )}
+                  field={'guardrail_setting.groups'}
+                  onChange={setField('guardrail_setting.groups')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('令牌护栏提示词')}
+                  placeholder='{"12": {"system_prompt": "Only answer questions about billing."}}'
+                  extraText={t('按令牌 ID 配置，与分组护栏提示词叠加生效')}
+                  field={'guardrail_setting.tokens'}
+                  onChange={setField('guardrail_setting.tokens')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存护栏设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
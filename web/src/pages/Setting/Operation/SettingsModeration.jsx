@@ -0,0 +1,321 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+  verifyJSON,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+// 以换行编辑、以 JSON 数组保存的配置项
+const LIST_KEYS = ['moderation_setting.keywords', 'moderation_setting.patterns'];
+const SECRET_KEYS = [
+  'moderation_setting.openai_api_key',
+  'moderation_setting.http_secret',
+];
+const JSON_KEYS = ['moderation_setting.groups', 'moderation_setting.models'];
+
+const parseList = (value) => {
+  try {
+    const list = JSON.parse(value || '[]');
+    return Array.isArray(list) ? list : [];
+  } catch (e) {
+    return [];
+  }
+};
+
+export default function SettingsModeration(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'moderation_setting.enabled': false,
+    'moderation_setting.providers': [],
+    'moderation_setting.fail_open': true,
+    'moderation_setting.notify_admins': false,
+    'moderation_setting.openai_base_url': '',
+    'moderation_setting.openai_api_key': '',
+    'moderation_setting.openai_model': '',
+    'moderation_setting.keywords': '',
+    'moderation_setting.patterns': '',
+    'moderation_setting.http_url': '',
+    'moderation_setting.http_secret': '',
+    'moderation_setting.timeout_seconds': 5,
+    'moderation_setting.groups': '',
+    'moderation_setting.models': '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  const providerOptions = [
+    { label: t('关键词与正则'), value: 'keyword' },
+    { label: 'OpenAI Moderation', value: 'openai' },
+    { label: t('自定义 HTTP 分类服务'), value: 'http' },
+  ];
+
+  const toOptionValue = (key) => {
+    const value = inputs[key];
+    if (key === 'moderation_setting.providers') {
+      return JSON.stringify(value || []);
+    }
+    if (LIST_KEYS.includes(key)) {
+      return JSON.stringify(
+        value
+          .split('\n')
+          .map((item) => item.trim())
+          .filter((item) => item !== ''),
+      );
+    }
+    return String(value);
+  };
+
+  function onSubmit() {
+    for (const key of JSON_KEYS) {
+      if (inputs[key] && !verifyJSON(inputs[key])) {
+        return showError(t('分组与模型规则必须是合法的 JSON'));
+      }
+    }
+    const updateArray = compareObjects(inputs, inputsRow).filter(
+      (item) =>
+        JSON.stringify(item.oldValue) !== JSON.stringify(item.newValue) &&
+        (!SECRET_KEYS.includes(item.key) || inputs[item.key] !== ''),
+    );
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: toOptionValue(item.key),
+      }),
+    );
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (!Object.keys(inputs).includes(key)) continue;
+      if (key === 'moderation_setting.providers') {
+        currentInputs[key] = parseList(props.options[key]);
+      } else if (LIST_KEYS.includes(key)) {
+        currentInputs[key] = parseList(props.options[key]).join('\n');
+      } else {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs({ ...inputs, ...currentInputs });
+    setInputsRow(structuredClone({ ...inputs, ...currentInputs }));
+    refForm.current.setValues({ ...inputs, ...currentInputs });
+  }, [props.options]);
+
+  const setField = (key) => (value) => setInputs({ ...inputs, [key]: value });
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('内容审核设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'moderation_setting.enabled'}
+                  label={t('启用内容审核')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('moderation_setting.enabled')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'moderation_setting.fail_open'}
+                  label={t('审核服务异常时放行')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('moderation_setting.fail_open')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'moderation_setting.notify_admins'}
+                  label={t('拦截时通知管理员')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('moderation_setting.notify_admins')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Select
+                  field={'moderation_setting.providers'}
+                  label={t('审核方式')}
+                  multiple
+                  optionList={providerOptions}
+                  extraText={t('按顺序执行，任一命中即拦截')}
+                  onChange={setField('moderation_setting.providers')}
+                  style={{ width: '100%' }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'moderation_setting.timeout_seconds'}
+                  label={t('审核超时（秒）')}
+                  min={1}
+                  onChange={setField('moderation_setting.timeout_seconds')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.TextArea
+                  label={t('审核关键词')}
+                  placeholder={t('一行一个关键词，不区分大小写')}
+                  field={'moderation_setting.keywords'}
+                  onChange={setField('moderation_setting.keywords')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.TextArea
+                  label={t('审核正则')}
+                  placeholder={t('一行一个正则表达式')}
+                  field={'moderation_setting.patterns'}
+                  onChange={setField('moderation_setting.patterns')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Input
+                  field={'moderation_setting.openai_base_url'}
+                  label={t('OpenAI 审核接口地址')}
+                  placeholder='https://api.openai.com'
+                  onChange={setField('moderation_setting.openai_base_url')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Input
+                  field={'moderation_setting.openai_model'}
+                  label={t('OpenAI 审核模型')}
+                  placeholder='omni-moderation-latest'
+                  onChange={setField('moderation_setting.openai_model')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Input
+                  field={'moderation_setting.openai_api_key'}
+                  label={t('OpenAI 审核密钥')}
+                  type='password'
+                  placeholder={t('敏感信息不会发送到前端显示')}
+                  onChange={setField('moderation_setting.openai_api_key')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Input
+                  field={'moderation_setting.http_url'}
+                  label={t('自定义分类服务地址')}
+                  placeholder='https://classifier.example.com/moderate'
+                  extraText={t(
+                    '接收 {"input": "..."}，返回 {"flagged": true, "categories": []}',
+                  )}
+                  onChange={setField('moderation_setting.http_url')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Input
+                  field={'moderation_setting.http_secret'}
+                  label={t('自定义分类服务密钥')}
+                  type='password'
+                  placeholder={t('敏感信息不会发送到前端显示')}
+                  extraText={t('用于生成 X-Webhook-Signature 签名')}
+                  onChange={setField('moderation_setting.http_secret')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('分组审核规则')}
+                  placeholder='{"vip": {"enabled": false}, "free": {"enabled": true, "providers": ["keyword", "openai"]}}'
+                  extraText={t(
+                    '按令牌分组覆盖默认规则，providers 为空时使用默认审核方式',
+                  )}
+                  field={'moderation_setting.groups'}
+                  onChange={setField('moderation_setting.groups')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('模型审核规则')}
+                  placeholder='{"gpt-4o": {"enabled": true, "providers": ["openai"]}}'
+                  extraText={t('按模型覆盖分组规则，优先级最高')}
+                  field={'moderation_setting.models'}
+                  onChange={setField('moderation_setting.models')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存内容审核设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
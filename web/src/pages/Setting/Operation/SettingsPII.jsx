@@ -0,0 +1,204 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+  verifyJSON,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+const BUILTIN_RULES = ['email', 'phone', 'id_card', 'credit_card'];
+const JSON_KEYS = ['pii_setting.custom_rules', 'pii_setting.groups'];
+
+const parseJSON = (value, fallback) => {
+  try {
+    return JSON.parse(value) ?? fallback;
+  } catch (e) {
+    return fallback;
+  }
+};
+
+export default function SettingsPII(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'pii_setting.enabled': false,
+    'pii_setting.restore': false,
+    'pii_setting.rules': [],
+    'pii_setting.custom_rules': '',
+    'pii_setting.groups': '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  const ruleLabels = {
+    email: t('邮箱'),
+    phone: t('手机号'),
+    id_card: t('身份证号'),
+    credit_card: t('银行卡号'),
+  };
+  const customRuleNames = parseJSON(inputs['pii_setting.custom_rules'], [])
+    .map((rule) => rule?.name)
+    .filter((name) => name);
+  const ruleOptions = [...BUILTIN_RULES, ...customRuleNames].map((name) => ({
+    label: ruleLabels[name] || name,
+    value: name,
+  }));
+
+  function onSubmit() {
+    for (const key of JSON_KEYS) {
+      if (inputs[key] && !verifyJSON(inputs[key])) {
+        return showError(t('自定义规则与分组策略必须是合法的 JSON'));
+      }
+    }
+    const updateArray = compareObjects(inputs, inputsRow).filter(
+      (item) => JSON.stringify(item.oldValue) !== JSON.stringify(item.newValue),
+    );
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) => {
+      const value = inputs[item.key];
+      return API.put('/api/option/', {
+        key: item.key,
+        value: Array.isArray(value) ? JSON.stringify(value) : String(value),
+      });
+    });
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (!Object.keys(inputs).includes(key)) continue;
+      currentInputs[key] =
+        key === 'pii_setting.rules'
+          ? parseJSON(props.options[key], [])
+          : props.options[key];
+    }
+    setInputs({ ...inputs, ...currentInputs });
+    setInputsRow(structuredClone({ ...inputs, ...currentInputs }));
+    refForm.current.setValues({ ...inputs, ...currentInputs });
+  }, [props.options]);
+
+  const setField = (key) => (value) => setInputs({ ...inputs, [key]: value });
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('个人信息脱敏设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'pii_setting.enabled'}
+                  label={t('转发前脱敏个人信息')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('pii_setting.enabled')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'pii_setting.restore'}
+                  label={t('在响应中还原原始内容')}
+                  extraText={t('流式响应中被拆分的占位符可能无法还原')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('pii_setting.restore')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Select
+                  field={'pii_setting.rules'}
+                  label={t('启用的识别规则')}
+                  multiple
+                  optionList={ruleOptions}
+                  onChange={setField('pii_setting.rules')}
+                  style={{ width: '100%' }}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('自定义识别规则')}
+                  placeholder='[{"name": "project", "words": ["Apollo"]}, {"name": "employee_id", "pattern": "EMP\\d{6}"}]'
+                  extraText={t(
+                    '每条规则配置正则 pattern 或词典 words，name 作为占位符前缀，需在启用的识别规则中勾选',
+                  )}
+                  field={'pii_setting.custom_rules'}
+                  onChange={setField('pii_setting.custom_rules')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('分组脱敏策略')}
+                  placeholder='{"enterprise": {"enabled": true, "rules": ["email", "phone"], "restore": true}}'
+                  extraText={t(
+                    '按分组覆盖默认策略，rules 为空时使用启用的识别规则',
+                  )}
+                  field={'pii_setting.groups'}
+                  onChange={setField('pii_setting.groups')}
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存脱敏设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
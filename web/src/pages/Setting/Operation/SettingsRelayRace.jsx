@@ -0,0 +1,196 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+// 以换行编辑、以 JSON 数组保存的配置项
+const LIST_KEYS = [
+  'relay_race_setting.models',
+  'relay_race_setting.allowed_groups',
+  'relay_race_setting.default_groups',
+];
+
+const parseList = (value) => {
+  try {
+    const list = JSON.parse(value || '[]');
+    return Array.isArray(list) ? list : [];
+  } catch (e) {
+    return [];
+  }
+};
+
+export default function SettingsRelayRace(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'relay_race_setting.enabled': false,
+    'relay_race_setting.fan_out': 2,
+    'relay_race_setting.models': '',
+    'relay_race_setting.allowed_groups': '',
+    'relay_race_setting.default_groups': '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  const toOptionValue = (key) => {
+    const value = inputs[key];
+    if (LIST_KEYS.includes(key)) {
+      return JSON.stringify(
+        value
+          .split('\n')
+          .map((item) => item.trim())
+          .filter((item) => item !== ''),
+      );
+    }
+    return String(value);
+  };
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: toOptionValue(item.key),
+      }),
+    );
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (!Object.keys(inputs).includes(key)) continue;
+      if (LIST_KEYS.includes(key)) {
+        currentInputs[key] = parseList(props.options[key]).join('\n');
+      } else {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs({ ...inputs, ...currentInputs });
+    setInputsRow(structuredClone({ ...inputs, ...currentInputs }));
+    refForm.current.setValues({ ...inputs, ...currentInputs });
+  }, [props.options]);
+
+  const setField = (key) => (value) => setInputs({ ...inputs, [key]: value });
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('竞速模式')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'relay_race_setting.enabled'}
+                  label={t('启用竞速模式')}
+                  extraText={t(
+                    '同一请求同时发往多个渠道，采用最先返回的响应并取消其余请求，只按胜出渠道计费',
+                  )}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('relay_race_setting.enabled')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'relay_race_setting.fan_out'}
+                  label={t('并发渠道数')}
+                  min={2}
+                  max={3}
+                  onChange={setField('relay_race_setting.fan_out')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                <Form.TextArea
+                  label={t('允许竞速的模型')}
+                  placeholder={'gpt-4o-mini\nclaude-3-5-haiku*'}
+                  extraText={t(
+                    '每行一个，以 * 结尾时按前缀匹配；为空时不对任何模型竞速',
+                  )}
+                  field={'relay_race_setting.models'}
+                  onChange={setField('relay_race_setting.models')}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+              <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                <Form.TextArea
+                  label={t('允许令牌开启竞速的分组')}
+                  placeholder={'vip'}
+                  extraText={t('每行一个，为空表示所有分组')}
+                  field={'relay_race_setting.allowed_groups'}
+                  onChange={setField('relay_race_setting.allowed_groups')}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+              <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                <Form.TextArea
+                  label={t('默认开启竞速的分组')}
+                  placeholder={'realtime'}
+                  extraText={t('每行一个，这些分组的请求无需令牌开启即使用竞速')}
+                  field={'relay_race_setting.default_groups'}
+                  onChange={setField('relay_race_setting.default_groups')}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存竞速模式设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
@@ -0,0 +1,324 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+export default function SettingsUsageEvent(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'usage_event_setting.enabled': false,
+    'usage_event_setting.backend': 'kafka',
+    'usage_event_setting.format': 'json',
+    'usage_event_setting.avro_schema_id': 0,
+    'usage_event_setting.kafka_brokers': '',
+    'usage_event_setting.kafka_topic': 'new-api.usage',
+    'usage_event_setting.kafka_acks': '1',
+    'usage_event_setting.kafka_tls': false,
+    'usage_event_setting.kafka_username': '',
+    'usage_event_setting.kafka_password': '',
+    'usage_event_setting.nats_url': '',
+    'usage_event_setting.nats_subject': 'new-api.usage',
+    'usage_event_setting.nats_username': '',
+    'usage_event_setting.nats_password': '',
+    'usage_event_setting.nats_secret': '',
+    'usage_event_setting.buffer_size': 10000,
+    'usage_event_setting.batch_size': 200,
+    'usage_event_setting.flush_interval_ms': 1000,
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: String(inputs[item.key]),
+      }),
+    );
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  async function testPublish() {
+    setLoading(true);
+    try {
+      const res = await API.post('/api/option/usage_event/test');
+      const { success, message } = res.data;
+      if (success) {
+        showSuccess(t('测试事件已发送'));
+      } else {
+        showError(message);
+      }
+    } catch (error) {
+      showError(t('发送测试事件失败'));
+    } finally {
+      setLoading(false);
+    }
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs({ ...inputs, ...currentInputs });
+    setInputsRow(structuredClone({ ...inputs, ...currentInputs }));
+    refForm.current.setValues({ ...inputs, ...currentInputs });
+  }, [props.options]);
+
+  const setField = (key) => (value) => setInputs({ ...inputs, [key]: value });
+  const isKafka = inputs['usage_event_setting.backend'] === 'kafka';
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('用量事件发布')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={6} lg={6} xl={6}>
+                <Form.Switch
+                  field={'usage_event_setting.enabled'}
+                  label={t('发布用量事件')}
+                  extraText={t(
+                    '每次请求完成后将用户、令牌、渠道、模型、token 数、费用与耗时发布到消息队列',
+                  )}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={setField('usage_event_setting.enabled')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={6} lg={6} xl={6}>
+                <Form.Select
+                  field={'usage_event_setting.backend'}
+                  label={t('消息队列')}
+                  optionList={[
+                    { label: 'Kafka', value: 'kafka' },
+                    { label: 'NATS', value: 'nats' },
+                  ]}
+                  onChange={setField('usage_event_setting.backend')}
+                  style={{ width: '100%' }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={6} lg={6} xl={6}>
+                <Form.Select
+                  field={'usage_event_setting.format'}
+                  label={t('序列化格式')}
+                  optionList={[
+                    { label: 'JSON', value: 'json' },
+                    { label: 'Avro', value: 'avro' },
+                  ]}
+                  onChange={setField('usage_event_setting.format')}
+                  style={{ width: '100%' }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={6} lg={6} xl={6}>
+                <Form.InputNumber
+                  field={'usage_event_setting.avro_schema_id'}
+                  label={t('Avro Schema ID')}
+                  min={0}
+                  extraText={t('大于 0 时按 Schema Registry 格式写入消息头')}
+                  onChange={setField('usage_event_setting.avro_schema_id')}
+                />
+              </Col>
+            </Row>
+            {isKafka ? (
+              <Row gutter={16}>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.kafka_brokers'}
+                    label={t('Broker 地址')}
+                    placeholder='127.0.0.1:9092,127.0.0.2:9092'
+                    onChange={setField('usage_event_setting.kafka_brokers')}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.kafka_topic'}
+                    label={t('Topic')}
+                    onChange={setField('usage_event_setting.kafka_topic')}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={4} lg={4} xl={4}>
+                  <Form.Select
+                    field={'usage_event_setting.kafka_acks'}
+                    label={t('确认方式')}
+                    optionList={[
+                      { label: '0', value: '0' },
+                      { label: '1', value: '1' },
+                      { label: 'all', value: '-1' },
+                    ]}
+                    onChange={setField('usage_event_setting.kafka_acks')}
+                    style={{ width: '100%' }}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={4} lg={4} xl={4}>
+                  <Form.Switch
+                    field={'usage_event_setting.kafka_tls'}
+                    label={t('使用 TLS')}
+                    size='default'
+                    checkedText='｜'
+                    uncheckedText='〇'
+                    onChange={setField('usage_event_setting.kafka_tls')}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.kafka_username'}
+                    label={t('SASL 用户名')}
+                    extraText={t('留空表示不认证')}
+                    onChange={setField('usage_event_setting.kafka_username')}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.kafka_password'}
+                    label={t('SASL 密码')}
+                    mode='password'
+                    placeholder={t('敏感信息不会发送到前端显示')}
+                    onChange={setField('usage_event_setting.kafka_password')}
+                  />
+                </Col>
+              </Row>
+            ) : (
+              <Row gutter={16}>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.nats_url'}
+                    label={t('服务器地址')}
+                    placeholder='nats://127.0.0.1:4222'
+                    onChange={setField('usage_event_setting.nats_url')}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.nats_subject'}
+                    label={t('Subject')}
+                    onChange={setField('usage_event_setting.nats_subject')}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.nats_secret'}
+                    label={t('认证 Token')}
+                    mode='password'
+                    placeholder={t('敏感信息不会发送到前端显示')}
+                    extraText={t('与用户名密码二选一')}
+                    onChange={setField('usage_event_setting.nats_secret')}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.nats_username'}
+                    label={t('用户名')}
+                    onChange={setField('usage_event_setting.nats_username')}
+                  />
+                </Col>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.Input
+                    field={'usage_event_setting.nats_password'}
+                    label={t('密码')}
+                    mode='password'
+                    placeholder={t('敏感信息不会发送到前端显示')}
+                    onChange={setField('usage_event_setting.nats_password')}
+                  />
+                </Col>
+              </Row>
+            )}
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'usage_event_setting.buffer_size'}
+                  label={t('队列长度')}
+                  min={100}
+                  extraText={t('队列满时丢弃新事件，修改后重启生效')}
+                  onChange={setField('usage_event_setting.buffer_size')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'usage_event_setting.batch_size'}
+                  label={t('批量大小')}
+                  min={1}
+                  onChange={setField('usage_event_setting.batch_size')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'usage_event_setting.flush_interval_ms'}
+                  label={t('最长发送间隔')}
+                  min={100}
+                  suffix={t('毫秒')}
+                  onChange={setField('usage_event_setting.flush_interval_ms')}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存用量事件设置')}
+              </Button>
+              <Button
+                size='default'
+                style={{ marginLeft: 8 }}
+                onClick={testPublish}
+              >
+                {t('发送测试事件')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
@@ -33,6 +33,7 @@ import {
   removeTrailingSlash,
   showError,
   showSuccess,
+  verifyJSON,
 } from '../../../helpers';
 import { useTranslation } from 'react-i18next';
 
@@ -46,6 +47,7 @@ export default function SettingsPaymentGateway(props) {
     StripeUnitPrice: 8.0,
     StripeMinTopUp: 1,
     StripePromotionCodesEnabled: false,
+    StripeQuotaPackages: '[]',
   });
   const [originInputs, setOriginInputs] = useState({});
   const formApiRef = useRef(null);
@@ -68,6 +70,7 @@ export default function SettingsPaymentGateway(props) {
           props.options.StripePromotionCodesEnabled !== undefined
             ? props.options.StripePromotionCodesEnabled
             : false,
+        StripeQuotaPackages: props.options.StripeQuotaPackages || '[]',
       };
       setInputs(currentInputs);
       setOriginInputs({ ...currentInputs });
@@ -130,6 +133,18 @@ export default function SettingsPaymentGateway(props) {
         });
       }
 
+      if (originInputs['StripeQuotaPackages'] !== inputs.StripeQuotaPackages) {
+        if (!verifyJSON(inputs.StripeQuotaPackages)) {
+          showError(t('额度套餐不是合法的 JSON'));
+          setLoading(false);
+          return;
+        }
+        options.push({
+          key: 'StripeQuotaPackages',
+          value: inputs.StripeQuotaPackages,
+        });
+      }
+
       // 发送请求
       const requestQueue = options.map((opt) =>
         API.put('/api/option/', {
@@ -192,7 +207,7 @@ export default function SettingsPaymentGateway(props) {
           />
           <Banner
             type='warning'
-            description={`需要包含事件：checkout.session.completed 和 checkout.session.expired`}
+            description={`需要包含事件：checkout.session.completed、checkout.session.expired 和 charge.refunded（退款时扣回额度）`}
           />
           <Row gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}>
             <Col xs={24} sm={24} md={8} lg={8} xl={8}>
@@ -250,6 +265,15 @@ export default function SettingsPaymentGateway(props) {
               />
             </Col>
           </Row>
+          <Form.TextArea
+            field='StripeQuotaPackages'
+            label={t('额度套餐')}
+            extraText={t(
+              '固定价格的额度套餐，JSON 数组，例如：[{"id":"pro","name":"Pro","price":9.99,"currency":"usd","quota":5000000}]，可选 price_id 使用 Stripe 后台的价格',
+            )}
+            autosize={{ minRows: 3, maxRows: 10 }}
+            style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+          />
           <Button onClick={submitStripeSetting}>{t('更新 Stripe 设置')}</Button>
         </Form.Section>
       </Form>